@@ -0,0 +1,240 @@
+package qfs
+
+import (
+	"container/list"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// BlockCache is a local store of raw blocks shared between content-addressed
+// backends. Blocks are keyed by multihash, so the same content addressed by
+// different CID versions or codecs is stored once
+type BlockCache interface {
+	// GetBlock returns ErrNotFound if the block isn't cached
+	GetBlock(id cid.Cid) ([]byte, error)
+	// PutBlock stores a block, verifying data matches id
+	PutBlock(id cid.Cid, data []byte) error
+	HasBlock(id cid.Cid) bool
+}
+
+// BlockCacheUser is implemented by filesystems that consult a block cache
+// before their own storage or the network
+type BlockCacheUser interface {
+	SetBlockCache(c BlockCache)
+}
+
+// DiskBlockCache is a BlockCache stored in a single directory. When the cache
+// grows beyond its size limit the least recently used blocks are removed
+type DiskBlockCache struct {
+	dir      string
+	maxBytes int64
+
+	lk         sync.Mutex
+	size       int64
+	order      *list.List
+	entries    map[string]*list.Element
+	quarantine *Quarantine
+}
+
+type diskBlock struct {
+	key  string
+	size int64
+}
+
+var _ BlockCache = (*DiskBlockCache)(nil)
+
+// blockCacheTempPrefix prefixes the temp files blocks are written to before
+// they're renamed into place
+const blockCacheTempPrefix = ".tmp-"
+
+// NewDiskBlockCache opens or creates a block cache in dir. maxBytes limits
+// the size of the cache, a value of zero or less disables the limit
+func NewDiskBlockCache(dir string, maxBytes int64) (*DiskBlockCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating block cache directory: %w", err)
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	// oldest first, so the most recently written blocks end up at the front
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ModTime().Before(infos[j].ModTime()) })
+
+	c := &DiskBlockCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  map[string]*list.Element{},
+	}
+	for _, fi := range infos {
+		if fi.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(fi.Name(), blockCacheTempPrefix) {
+			// temp files are left by interrupted writes
+			if err := os.Remove(filepath.Join(dir, fi.Name())); err != nil {
+				log.Debugw("removing stale block cache file", "name", fi.Name(), "err", err)
+			}
+			continue
+		}
+		c.entries[fi.Name()] = c.order.PushFront(&diskBlock{key: fi.Name(), size: fi.Size()})
+		c.size += fi.Size()
+	}
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.evict()
+	return c, nil
+}
+
+// Size returns the number of bytes stored in the cache
+func (c *DiskBlockCache) Size() int64 {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	return c.size
+}
+
+// GetBlock reads a block from the cache
+func (c *DiskBlockCache) GetBlock(id cid.Cid) ([]byte, error) {
+	key := blockCacheKey(id)
+	c.lk.Lock()
+	el, ok := c.entries[key]
+	if ok {
+		c.order.MoveToFront(el)
+	}
+	q := c.quarantine
+	c.lk.Unlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(c.dir, key))
+	if os.IsNotExist(err) {
+		c.remove(key)
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	// corrupt blocks are dropped from the cache, treated as a miss so callers
+	// refetch a good copy
+	if verr := VerifyBlock(id, data); verr != nil {
+		log.Debugw("cached block failed verification", "cid", id.String(), "err", verr)
+		if q != nil {
+			if err := q.Add(id, data, "blockcache", verr.Error()); err != nil {
+				log.Debugw("quarantining cached block", "cid", id.String(), "err", err)
+			}
+		}
+		c.lk.Lock()
+		c.removeLocked(key)
+		c.lk.Unlock()
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+// SetQuarantine sets a quarantine to hold cached blocks that fail
+// verification. Without one corrupt blocks are discarded
+func (c *DiskBlockCache) SetQuarantine(q *Quarantine) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.quarantine = q
+}
+
+// PutBlock writes a block to the cache
+func (c *DiskBlockCache) PutBlock(id cid.Cid, data []byte) error {
+	if err := VerifyBlock(id, data); err != nil {
+		return err
+	}
+
+	key := blockCacheKey(id)
+	if c.HasBlock(id) {
+		return nil
+	}
+
+	// write to a temp file & rename so readers never see partial blocks
+	tmp, err := ioutil.TempFile(c.dir, blockCacheTempPrefix)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(c.dir, key)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		c.entries[key] = c.order.PushFront(&diskBlock{key: key, size: int64(len(data))})
+		c.size += int64(len(data))
+		c.evict()
+	}
+	return nil
+}
+
+// HasBlock reports whether a block is cached
+func (c *DiskBlockCache) HasBlock(id cid.Cid) bool {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	_, ok := c.entries[blockCacheKey(id)]
+	return ok
+}
+
+func (c *DiskBlockCache) remove(key string) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		c.size -= el.Value.(*diskBlock).size
+	}
+}
+
+// removeLocked deletes a block's file & entry. callers must hold the lock
+func (c *DiskBlockCache) removeLocked(key string) {
+	if err := os.Remove(filepath.Join(c.dir, key)); err != nil && !os.IsNotExist(err) {
+		log.Debugw("removing cached block", "key", key, "err", err)
+	}
+	if el, ok := c.entries[key]; ok {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		c.size -= el.Value.(*diskBlock).size
+	}
+}
+
+// evict removes least recently used blocks until the cache fits. callers must
+// hold the lock
+func (c *DiskBlockCache) evict() {
+	for c.maxBytes > 0 && c.size > c.maxBytes && c.order.Len() > 1 {
+		el := c.order.Back()
+		b := el.Value.(*diskBlock)
+		if err := os.Remove(filepath.Join(c.dir, b.key)); err != nil && !os.IsNotExist(err) {
+			log.Debugw("evicting cached block", "key", b.key, "err", err)
+		}
+		c.order.Remove(el)
+		delete(c.entries, b.key)
+		c.size -= b.size
+	}
+}
+
+// blockCacheKey keys blocks by multihash, so CIDs that differ only by version
+// or codec share an entry
+func blockCacheKey(id cid.Cid) string {
+	return id.Hash().B58String()
+}
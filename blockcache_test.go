@@ -0,0 +1,91 @@
+package qfs
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+)
+
+func TestDiskBlockCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qfs_block_cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := NewDiskBlockCache(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := []byte("aaaaaa")
+	mh, err := multihash.Sum(a, multihash.SHA2_256, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v0 := cid.NewCidV0(mh)
+	v1 := cid.NewCidV1(cid.Raw, mh)
+
+	if _, err := c.GetBlock(v0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for uncached block. got: %v", err)
+	}
+	if err := c.PutBlock(v0, []byte("wrong")); err == nil {
+		t.Errorf("expected mismatched block data to error")
+	}
+	if err := c.PutBlock(v0, a); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.PutBlock(v1, a); err != nil {
+		t.Fatal(err)
+	}
+	if c.Size() != int64(len(a)) {
+		t.Errorf("expected cids with the same multihash to be stored once. size: %d", c.Size())
+	}
+	data, err := c.GetBlock(v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(a) {
+		t.Errorf("data mismatch. want: %q got: %q", a, data)
+	}
+
+	b := []byte("bbbbbb")
+	bid, err := cid.V1Builder{Codec: cid.Raw, MhType: multihash.SHA2_256}.Sum(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.PutBlock(bid, b); err != nil {
+		t.Fatal(err)
+	}
+	if c.HasBlock(v0) {
+		t.Errorf("expected least recently used block to be evicted")
+	}
+	if !c.HasBlock(bid) {
+		t.Errorf("expected newest block to be cached")
+	}
+
+	// reopening picks up blocks already on disk, removing temp files left by
+	// interrupted writes
+	tmp := filepath.Join(dir, blockCacheTempPrefix+"123")
+	if err := ioutil.WriteFile(tmp, []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err = NewDiskBlockCache(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.HasBlock(bid) {
+		t.Errorf("expected reopened cache to have block")
+	}
+	if c.Size() != int64(len(b)) {
+		t.Errorf("expected temp files not to count toward the cache size. size: %d", c.Size())
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("expected temp file to be removed. stat error: %v", err)
+	}
+}
@@ -0,0 +1,674 @@
+// Package cachefs wraps a filesystem with a write-through cache, so repeated
+// reads of the same path don't go back to the wrapped filesystem. Files are
+// cached in a size-bounded in-memory LRU, and optionally in a size-bounded
+// on-disk LRU that survives restarts.
+//
+// Paths in content-addressed filesystems never change content, so they're
+// always safe to cache. Wrapping a mutable filesystem is only safe if callers
+// Invalidate paths whose content changes outside of the cache
+package cachefs
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log"
+	"github.com/mitchellh/mapstructure"
+	"github.com/qri-io/qfs"
+)
+
+var log = logging.Logger("cachefs")
+
+// DefaultMaxMemBytes is the in-memory cache bound when none is configured
+const DefaultMaxMemBytes = int64(64 << 20)
+
+// MiddlewareType names caching middleware in configuration
+const MiddlewareType = "cache"
+
+// Config configures a caching filesystem
+type Config struct {
+	// MaxMemBytes bounds the bytes cached in memory. defaults to
+	// DefaultMaxMemBytes
+	MaxMemBytes int64
+	// MaxFileBytes is the size of the largest file that will be cached.
+	// Larger files are read from the wrapped filesystem every time. defaults
+	// to a quarter of MaxMemBytes
+	MaxFileBytes int64
+	// Dir enables an on-disk cache in a directory. Files are written to disk
+	// & memory when they're cached, and read back from disk once they're
+	// evicted from memory
+	Dir string
+	// MaxDiskBytes bounds the on-disk cache. a value of zero or less
+	// disables the limit
+	MaxDiskBytes int64
+	// Popularity makes caching popularity-aware. Evictions take the least
+	// popular of the least recently used files, and a file is only admitted
+	// to a full memory tier if it's more popular than the file it would
+	// evict. A tracker can be shared with other caches
+	Popularity *qfs.Popularity
+	// TrackPopularity creates a tracker with qfs.DefaultPopularityConfig
+	// when Popularity is nil
+	TrackPopularity bool
+}
+
+// evictionSample is the number of least recently used files a
+// popularity-aware cache picks an eviction victim from
+const evictionSample = 4
+
+// Stats counts cache activity
+type Stats struct {
+	// MemHits & DiskHits count Gets answered from each cache tier
+	MemHits  int64
+	DiskHits int64
+	// Misses counts Gets passed to the wrapped filesystem
+	Misses int64
+	// MemEvictions & DiskEvictions count files evicted to make room
+	MemEvictions  int64
+	DiskEvictions int64
+	// Invalidations counts cached paths dropped with Invalidate or Delete
+	Invalidations int64
+	// Rejections counts files popularity admission kept out of memory
+	Rejections int64
+	// MemBytes & DiskBytes are the bytes currently cached in each tier
+	MemBytes  int64
+	DiskBytes int64
+}
+
+// FS caches files read from & written to a wrapped filesystem. An FS has the
+// same type as the filesystem it wraps, so it can stand in for it in a Mux
+type FS struct {
+	fs      qfs.Filesystem
+	ca      bool
+	maxMem  int64
+	maxFile int64
+	dir     string
+	maxDisk int64
+	// pop is nil when caching isn't popularity-aware. Files are tracked by
+	// their disk name, which both tiers can derive
+	pop *qfs.Popularity
+
+	lk    sync.Mutex
+	mem   lru
+	disk  lru
+	stats Stats
+}
+
+// lru is a size-bounded least recently used index
+type lru struct {
+	size    int64
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type entry struct {
+	key  string
+	size int64
+	// data & meta are held by memory entries only
+	data []byte
+	meta fileMeta
+}
+
+// fileMeta is the metadata of a cached file, restored when it's read back
+// from the cache
+type fileMeta struct {
+	ModTime   time.Time `json:"modTime"`
+	MediaType string    `json:"mediaType"`
+}
+
+func metaOf(f qfs.File) fileMeta {
+	return fileMeta{ModTime: f.ModTime(), MediaType: f.MediaType()}
+}
+
+// diskMagic starts the header line of files in the on-disk cache. The rest
+// of the line is the file's JSON-encoded metadata, followed by its content
+const diskMagic = "qfscache1 "
+
+var (
+	_ qfs.Filesystem   = (*FS)(nil)
+	_ qfs.DescribingFS = (*FS)(nil)
+	_ qfs.Unwrapper    = (*FS)(nil)
+	_ qfs.HasManyFS    = (*FS)(nil)
+	_ qfs.StatFS       = (*FS)(nil)
+	_ qfs.ReadDirFS    = (*FS)(nil)
+	_ qfs.WritableFS   = (*FS)(nil)
+)
+
+// New wraps fs with a cache
+func New(fs qfs.Filesystem, cfg Config) (*FS, error) {
+	if cfg.MaxMemBytes <= 0 {
+		cfg.MaxMemBytes = DefaultMaxMemBytes
+	}
+	if cfg.MaxFileBytes <= 0 {
+		cfg.MaxFileBytes = cfg.MaxMemBytes / 4
+	}
+	if cfg.Popularity == nil && cfg.TrackPopularity {
+		cfg.Popularity = qfs.NewPopularity(qfs.DefaultPopularityConfig())
+	}
+	_, ca := fs.(qfs.CAFS)
+	c := &FS{
+		fs:      fs,
+		ca:      ca,
+		maxMem:  cfg.MaxMemBytes,
+		maxFile: cfg.MaxFileBytes,
+		dir:     cfg.Dir,
+		maxDisk: cfg.MaxDiskBytes,
+		pop:     cfg.Popularity,
+		mem:     lru{order: list.New(), entries: map[string]*list.Element{}},
+		disk:    lru{order: list.New(), entries: map[string]*list.Element{}},
+	}
+	if c.dir != "" {
+		if err := c.loadDisk(); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// NewMiddleware is a qfs.MiddlewareConstructor for caching middleware. cfg
+// keys match the fields of Config. An on-disk cache directory is created
+// when the middleware is, so configuration errors surface early. If the
+// cache can't be set up when the middleware is applied, the error is logged
+// & the filesystem is left uncached
+func NewMiddleware(_ context.Context, cfgMap map[string]interface{}) (qfs.Middleware, error) {
+	cfg := Config{}
+	if err := mapstructure.Decode(cfgMap, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Dir != "" {
+		if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+			return nil, fmt.Errorf("creating cache directory: %w", err)
+		}
+	}
+	return func(fs qfs.Filesystem) qfs.Filesystem {
+		c, err := New(fs, cfg)
+		if err != nil {
+			log.Errorf("caching %q filesystem: %s", fs.Type(), err)
+			return fs
+		}
+		return c
+	}, nil
+}
+
+// loadDisk indexes files already in the cache directory
+func (c *FS) loadDisk() error {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return fmt.Errorf("creating cache directory: %w", err)
+	}
+	infos, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	// oldest first, so the most recently written files end up at the front
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ModTime().Before(infos[j].ModTime()) })
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	for _, fi := range infos {
+		if fi.IsDir() {
+			continue
+		}
+		path := filepath.Join(c.dir, fi.Name())
+		hdr, err := diskHeaderSize(path)
+		if filepath.Ext(fi.Name()) == ".tmp" || err != nil {
+			// temp files are left by interrupted writes, & files without a
+			// header by older versions of the cache
+			if err := os.Remove(path); err != nil {
+				log.Debugw("removing stale cache file", "name", fi.Name(), "err", err)
+			}
+			continue
+		}
+		size := fi.Size() - hdr
+		c.disk.entries[fi.Name()] = c.disk.order.PushFront(&entry{key: fi.Name(), size: size})
+		c.disk.size += size
+	}
+	c.evictDisk()
+	return nil
+}
+
+// Type returns the type of the wrapped filesystem
+func (c *FS) Type() string { return c.fs.Type() }
+
+// Describe returns the wrapped filesystem's descriptor
+func (c *FS) Describe() qfs.Descriptor { return qfs.Describe(c.fs) }
+
+// Unwrap returns the wrapped filesystem, so its other capabilities can be
+// found with qfs.As
+func (c *FS) Unwrap() qfs.Filesystem { return c.fs }
+
+// Stats returns a snapshot of cache activity
+func (c *FS) Stats() Stats {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	s := c.stats
+	s.MemBytes, s.DiskBytes = c.mem.size, c.disk.size
+	return s
+}
+
+// key normalizes a path to its cache key. Content-addressed paths are cached
+// in canonical form, so bare & prefixed keys share an entry
+func (c *FS) key(path string) string {
+	if c.ca {
+		return qfs.CanonicalPath(c.fs.Type(), path)
+	}
+	return path
+}
+
+// diskName is the file a key is cached in on disk
+func diskName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Has reports cached paths without consulting the wrapped filesystem
+func (c *FS) Has(ctx context.Context, path string) (bool, error) {
+	if _, _, ok := c.cached(c.key(path), false); ok {
+		return true, nil
+	}
+	return c.fs.Has(ctx, path)
+}
+
+// Get reads a file from the cache, falling back to the wrapped filesystem.
+// Files read from the wrapped filesystem are cached once they've been read
+// to the end, along with their modification time & media type
+func (c *FS) Get(ctx context.Context, path string) (qfs.File, error) {
+	key := c.key(path)
+	if c.pop != nil {
+		c.pop.Touch(diskName(key))
+	}
+	if data, meta, ok := c.cached(key, true); ok {
+		return &cachedFile{Memfile: qfs.NewMemfileBytes(key, data), meta: meta}, nil
+	}
+
+	f, err := c.fs.Get(ctx, path)
+	if err != nil || f.IsDirectory() || qfs.FileSize(f) > c.maxFile {
+		return f, err
+	}
+	return &captureFile{File: f, limit: c.maxFile, done: func(data []byte) { c.store(key, data, metaOf(f)) }}, nil
+}
+
+// Put writes a file to the wrapped filesystem, caching its content under the
+// returned path
+func (c *FS) Put(ctx context.Context, file qfs.File) (string, error) {
+	if file.IsDirectory() {
+		return c.fs.Put(ctx, file)
+	}
+	var data []byte
+	capture := &captureFile{File: file, limit: c.maxFile, done: func(d []byte) { data = d }}
+	path, err := c.fs.Put(ctx, capture)
+	if err != nil {
+		return path, err
+	}
+	if data != nil {
+		c.store(c.key(path), data, metaOf(file))
+	}
+	return path, nil
+}
+
+// Delete drops a path from the cache & deletes it from the wrapped
+// filesystem
+func (c *FS) Delete(ctx context.Context, path string) error {
+	c.Invalidate(path)
+	return c.fs.Delete(ctx, path)
+}
+
+// HasMany checks a batch of paths on the wrapped filesystem
+func (c *FS) HasMany(ctx context.Context, paths []string) (map[string]bool, error) {
+	return qfs.HasMany(ctx, c.fs, paths)
+}
+
+// Stat describes a path on the wrapped filesystem
+func (c *FS) Stat(ctx context.Context, path string) (os.FileInfo, error) {
+	return qfs.Stat(ctx, c.fs, path)
+}
+
+// ReadDir lists a directory of the wrapped filesystem
+func (c *FS) ReadDir(ctx context.Context, path string) ([]qfs.DirEntry, error) {
+	return qfs.ReadDir(ctx, c.fs, path)
+}
+
+// Copy copies src to dst on the wrapped filesystem, dropping dst from the
+// cache. Filesystems that can't copy in place return an error matching
+// qfs.ErrUnsupported
+func (c *FS) Copy(ctx context.Context, src, dst string) error {
+	w, ok := c.fs.(qfs.WritableFS)
+	if !ok {
+		return fmt.Errorf("%w: %q filesystem can't copy", qfs.ErrUnsupported, c.Type())
+	}
+	c.Invalidate(dst)
+	return w.Copy(ctx, src, dst)
+}
+
+// Rename moves src to dst on the wrapped filesystem, dropping both from the
+// cache. Filesystems that can't rename in place return an error matching
+// qfs.ErrUnsupported
+func (c *FS) Rename(ctx context.Context, src, dst string) error {
+	w, ok := c.fs.(qfs.WritableFS)
+	if !ok {
+		return fmt.Errorf("%w: %q filesystem can't rename", qfs.ErrUnsupported, c.Type())
+	}
+	c.Invalidate(src)
+	c.Invalidate(dst)
+	return w.Rename(ctx, src, dst)
+}
+
+// Invalidate drops a path from the cache, so the next Get reads from the
+// wrapped filesystem
+func (c *FS) Invalidate(path string) {
+	key := c.key(path)
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	found := c.removeMem(key)
+	if c.dir != "" && c.removeDisk(diskName(key)) {
+		found = true
+	}
+	if found {
+		c.stats.Invalidations++
+	}
+}
+
+// Purge drops every cached file
+func (c *FS) Purge() {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	for key := range c.mem.entries {
+		c.removeMem(key)
+	}
+	for name := range c.disk.entries {
+		c.removeDisk(name)
+	}
+}
+
+// cached looks a key up in memory then on disk, counting the lookup when
+// record is true. Files found on disk are promoted to memory
+func (c *FS) cached(key string, record bool) ([]byte, fileMeta, bool) {
+	c.lk.Lock()
+	if el, ok := c.mem.entries[key]; ok {
+		c.mem.order.MoveToFront(el)
+		if record {
+			c.stats.MemHits++
+		}
+		c.lk.Unlock()
+		e := el.Value.(*entry)
+		return e.data, e.meta, true
+	}
+	name := diskName(key)
+	el, onDisk := c.disk.entries[name]
+	if onDisk {
+		c.disk.order.MoveToFront(el)
+	}
+	c.lk.Unlock()
+
+	if onDisk {
+		data, meta, err := readDisk(filepath.Join(c.dir, name))
+		if err == nil {
+			c.lk.Lock()
+			if record {
+				c.stats.DiskHits++
+			}
+			c.putMem(key, data, meta)
+			c.lk.Unlock()
+			return data, meta, true
+		}
+		log.Debugw("reading cached file", "key", key, "err", err)
+		c.lk.Lock()
+		c.removeDisk(name)
+		c.lk.Unlock()
+	}
+
+	if record {
+		c.lk.Lock()
+		c.stats.Misses++
+		c.lk.Unlock()
+	}
+	return nil, fileMeta{}, false
+}
+
+// store caches a file in memory & on disk
+func (c *FS) store(key string, data []byte, meta fileMeta) {
+	if int64(len(data)) > c.maxFile {
+		return
+	}
+	name := diskName(key)
+	if c.dir != "" {
+		if err := c.writeDisk(name, data, meta); err != nil {
+			log.Debugw("writing cached file", "key", key, "err", err)
+		}
+	}
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.putMem(key, data, meta)
+	if c.dir != "" {
+		if _, ok := c.disk.entries[name]; !ok {
+			c.disk.entries[name] = c.disk.order.PushFront(&entry{key: name, size: int64(len(data))})
+			c.disk.size += int64(len(data))
+			c.evictDisk()
+		}
+	}
+}
+
+// writeDisk writes to a temp file & renames, so readers never see partial
+// files
+func (c *FS) writeDisk(name string, data []byte, meta fileMeta) error {
+	hdr, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(c.dir, "*.tmp")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	w.WriteString(diskMagic)
+	w.Write(hdr)
+	w.WriteByte('\n')
+	w.Write(data)
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(c.dir, name)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// readDisk reads a file from the on-disk cache
+func readDisk(path string) ([]byte, fileMeta, error) {
+	meta := fileMeta{}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, meta, err
+	}
+	i := bytes.IndexByte(raw, '\n')
+	if !bytes.HasPrefix(raw, []byte(diskMagic)) || i < 0 {
+		return nil, meta, fmt.Errorf("cached file has no header")
+	}
+	if err := json.Unmarshal(raw[len(diskMagic):i], &meta); err != nil {
+		return nil, meta, fmt.Errorf("decoding cached file header: %w", err)
+	}
+	return raw[i+1:], meta, nil
+}
+
+// diskHeaderSize returns the length of an on-disk cache file's header
+func diskHeaderSize(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, diskMagic) {
+		return 0, fmt.Errorf("cached file has no header")
+	}
+	return int64(len(line)), nil
+}
+
+// putMem adds a file to the memory tier, unless it's less popular than the
+// file it would evict. callers must hold the lock
+func (c *FS) putMem(key string, data []byte, meta fileMeta) {
+	if el, ok := c.mem.entries[key]; ok {
+		c.mem.order.MoveToFront(el)
+		return
+	}
+	size := int64(len(data))
+	if c.pop != nil && c.mem.size+size > c.maxMem && c.mem.order.Len() > 0 {
+		victim := c.victim(&c.mem, diskName)
+		if !c.pop.Admit(diskName(key), diskName(victim)) {
+			c.stats.Rejections++
+			return
+		}
+	}
+	c.mem.entries[key] = c.mem.order.PushFront(&entry{key: key, size: size, data: data, meta: meta})
+	c.mem.size += size
+	for c.mem.size > c.maxMem && c.mem.order.Len() > 1 {
+		c.removeMem(c.victim(&c.mem, diskName))
+		c.stats.MemEvictions++
+	}
+}
+
+// victim picks the entry to evict from a tier: the least popular of the
+// least recently used few when caching is popularity-aware, the least
+// recently used otherwise. The most recently used entry is never picked from
+// a tier with more than one entry. popKey maps the tier's keys to the keys
+// popularity is tracked by, a nil popKey uses them as they are. callers must
+// hold the lock
+func (c *FS) victim(l *lru, popKey func(string) string) string {
+	el := l.order.Back()
+	victim := el.Value.(*entry).key
+	if c.pop == nil {
+		return victim
+	}
+	if popKey == nil {
+		popKey = func(key string) string { return key }
+	}
+	least := c.pop.Estimate(popKey(victim))
+	for i := 1; i < evictionSample; i++ {
+		if el = el.Prev(); el == nil || el == l.order.Front() {
+			break
+		}
+		key := el.Value.(*entry).key
+		if est := c.pop.Estimate(popKey(key)); est < least {
+			victim, least = key, est
+		}
+	}
+	return victim
+}
+
+// removeMem drops a key from memory. callers must hold the lock
+func (c *FS) removeMem(key string) bool {
+	el, ok := c.mem.entries[key]
+	if !ok {
+		return false
+	}
+	c.mem.order.Remove(el)
+	delete(c.mem.entries, key)
+	c.mem.size -= el.Value.(*entry).size
+	return true
+}
+
+// removeDisk deletes a cached file. callers must hold the lock
+func (c *FS) removeDisk(name string) bool {
+	el, ok := c.disk.entries[name]
+	if !ok {
+		return false
+	}
+	if err := os.Remove(filepath.Join(c.dir, name)); err != nil && !os.IsNotExist(err) {
+		log.Debugw("removing cached file", "name", name, "err", err)
+	}
+	c.disk.order.Remove(el)
+	delete(c.disk.entries, name)
+	c.disk.size -= el.Value.(*entry).size
+	return true
+}
+
+// evictDisk removes least recently used files until the disk tier fits.
+// callers must hold the lock
+func (c *FS) evictDisk() {
+	for c.maxDisk > 0 && c.disk.size > c.maxDisk && c.disk.order.Len() > 1 {
+		c.removeDisk(c.victim(&c.disk, nil))
+		c.stats.DiskEvictions++
+	}
+}
+
+// cachedFile is a file read from the cache, reporting the modification time
+// & media type of the file that was cached
+type cachedFile struct {
+	*qfs.Memfile
+	meta fileMeta
+}
+
+func (f *cachedFile) ModTime() time.Time { return f.meta.ModTime }
+
+func (f *cachedFile) MediaType() string {
+	if f.meta.MediaType == "" {
+		return f.Memfile.MediaType()
+	}
+	return f.meta.MediaType
+}
+
+// captureFile copies what's read from a file, calling done with the content
+// once the file has been read to the end. Files larger than limit aren't
+// captured, nor are files that are seeked, since reads no longer cover the
+// file in order
+type captureFile struct {
+	qfs.File
+	limit int64
+	buf   bytes.Buffer
+	over  bool
+	done  func(data []byte)
+}
+
+func (f *captureFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	if !f.over {
+		if int64(f.buf.Len()+n) > f.limit {
+			f.over = true
+			f.buf = bytes.Buffer{}
+		} else {
+			f.buf.Write(p[:n])
+		}
+	}
+	if errors.Is(err, io.EOF) && !f.over && f.done != nil {
+		f.done(f.buf.Bytes())
+		f.done = nil
+	}
+	return n, err
+}
+
+// Seek seeks the wrapped file, giving up on capturing it unless the seek
+// only reports the current offset
+func (f *captureFile) Seek(offset int64, whence int) (int64, error) {
+	s, ok := f.File.(io.Seeker)
+	if !ok {
+		return 0, qfs.ErrNotSeekable
+	}
+	if offset != 0 || whence != io.SeekCurrent {
+		f.over = true
+		f.buf = bytes.Buffer{}
+	}
+	return s.Seek(offset, whence)
+}
+
+// Size returns the size of the wrapped file
+func (f *captureFile) Size() int64 { return qfs.FileSize(f.File) }
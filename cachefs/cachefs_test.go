@@ -0,0 +1,333 @@
+package cachefs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/qri-io/qfs"
+)
+
+// countingFS counts Gets that reach the wrapped filesystem
+type countingFS struct {
+	*qfs.MemFS
+	gets int
+}
+
+func (c *countingFS) Get(ctx context.Context, path string) (qfs.File, error) {
+	c.gets++
+	return c.MemFS.Get(ctx, path)
+}
+
+func TestCacheHits(t *testing.T) {
+	ctx := context.Background()
+	backend := &countingFS{MemFS: qfs.NewMemFS()}
+	path, err := backend.MemFS.Put(ctx, qfs.NewMemfileBytes("a.txt", []byte("hello")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs, err := New(backend, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fs.Type() != backend.Type() {
+		t.Errorf("type mismatch. want: %q, got: %q", backend.Type(), fs.Type())
+	}
+
+	for i := 0; i < 3; i++ {
+		expectContent(t, fs, path, "hello")
+	}
+	if backend.gets != 1 {
+		t.Errorf("expected one backend get, got %d", backend.gets)
+	}
+	s := fs.Stats()
+	if s.Misses != 1 || s.MemHits != 2 || s.MemBytes != 5 {
+		t.Errorf("unexpected stats: %#v", s)
+	}
+
+	fs.Invalidate(path)
+	expectContent(t, fs, path, "hello")
+	if backend.gets != 2 {
+		t.Errorf("expected invalidate to read through, got %d backend gets", backend.gets)
+	}
+	if s := fs.Stats(); s.Invalidations != 1 {
+		t.Errorf("expected 1 invalidation, got %d", s.Invalidations)
+	}
+
+	// an unfinished read doesn't cache partial content
+	fs.Invalidate(path)
+	f, err := fs.Get(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Read(make([]byte, 2))
+	f.Close()
+	if _, _, ok := fs.cached(fs.key(path), false); ok {
+		t.Error("expected partial read not to be cached")
+	}
+}
+
+func TestCachePutAndEvict(t *testing.T) {
+	ctx := context.Background()
+	backend := &countingFS{MemFS: qfs.NewMemFS()}
+	fs, err := New(backend, Config{MaxMemBytes: 10, MaxFileBytes: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := fs.Put(ctx, qfs.NewMemfileBytes("a.txt", []byte("aaaaaa")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectContent(t, fs, a, "aaaaaa")
+	if backend.gets != 0 {
+		t.Errorf("expected put to write through to the cache, got %d backend gets", backend.gets)
+	}
+
+	b, err := fs.Put(ctx, qfs.NewMemfileBytes("b.txt", []byte("bbbbbb")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := fs.Stats(); s.MemEvictions != 1 || s.MemBytes != 6 {
+		t.Errorf("expected a to be evicted. stats: %#v", s)
+	}
+	expectContent(t, fs, b, "bbbbbb")
+	expectContent(t, fs, a, "aaaaaa")
+	if backend.gets != 1 {
+		t.Errorf("expected evicted file to be read from the backend, got %d gets", backend.gets)
+	}
+
+	// files over the size limit pass through
+	big, err := fs.Put(ctx, qfs.NewMemfileBytes("big.txt", bytes.Repeat([]byte("c"), 11)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectContent(t, fs, big, "ccccccccccc")
+	expectContent(t, fs, big, "ccccccccccc")
+	if backend.gets != 3 {
+		t.Errorf("expected oversize file to pass through, got %d gets", backend.gets)
+	}
+
+	if err := fs.Delete(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := fs.Has(ctx, a); has {
+		t.Error("expected deleted path to be dropped from the cache")
+	}
+}
+
+func TestCachePopularity(t *testing.T) {
+	ctx := context.Background()
+	backend := &countingFS{MemFS: qfs.NewMemFS()}
+	paths := map[string]string{}
+	for _, name := range []string{"a", "b", "c", "d"} {
+		path, err := backend.MemFS.Put(ctx, qfs.NewMemfileBytes(name+".txt", []byte(name+name+name+name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths[name] = path
+	}
+
+	fs, err := New(backend, Config{MaxMemBytes: 12, MaxFileBytes: 12, TrackPopularity: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "a", "a", "b", "c"} {
+		expectContent(t, fs, paths[name], name+name+name+name)
+	}
+
+	// d is no more popular than the least popular file it would evict
+	expectContent(t, fs, paths["d"], "dddd")
+	if _, _, ok := fs.cached(fs.key(paths["d"]), false); ok {
+		t.Error("expected unpopular file not to be admitted")
+	}
+	if s := fs.Stats(); s.Rejections != 1 || s.MemEvictions != 0 {
+		t.Errorf("expected one rejection. stats: %#v", s)
+	}
+
+	// once it is, it evicts b rather than the less recently used, hotter a
+	expectContent(t, fs, paths["d"], "dddd")
+	for name, cached := range map[string]bool{"a": true, "b": false, "c": true, "d": true} {
+		if _, _, ok := fs.cached(fs.key(paths[name]), false); ok != cached {
+			t.Errorf("%s cached mismatch. want: %t, got: %t", name, cached, ok)
+		}
+	}
+	if s := fs.Stats(); s.Rejections != 1 || s.MemEvictions != 1 {
+		t.Errorf("expected one eviction. stats: %#v", s)
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "cachefs_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	backend := &countingFS{MemFS: qfs.NewMemFS()}
+	fs, err := New(backend, Config{MaxMemBytes: 8, MaxFileBytes: 8, Dir: dir, MaxDiskBytes: 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, s := range []string{"aaaa", "bbbb", "cccc", "dddd"} {
+		p, err := fs.Put(ctx, qfs.NewMemfileBytes(s+".txt", []byte(s)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, p)
+	}
+	if s := fs.Stats(); s.DiskEvictions != 1 || s.DiskBytes != 12 || s.MemEvictions != 2 {
+		t.Errorf("unexpected stats: %#v", s)
+	}
+
+	// evicted from memory, still on disk
+	expectContent(t, fs, paths[1], "bbbb")
+	if s := fs.Stats(); s.DiskHits != 1 {
+		t.Errorf("expected a disk hit. stats: %#v", s)
+	}
+
+	// a new cache over the same directory picks up cached files
+	fs2, err := New(backend, Config{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectContent(t, fs2, paths[3], "dddd")
+	if backend.gets != 0 {
+		t.Errorf("expected no backend gets, got %d", backend.gets)
+	}
+
+	fs2.Purge()
+	if s := fs2.Stats(); s.DiskBytes != 0 || s.MemBytes != 0 {
+		t.Errorf("expected purge to empty the cache. stats: %#v", s)
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 0 {
+		t.Errorf("expected purge to remove cached files, %d remain", len(infos))
+	}
+}
+
+// metaFS serves files with a fixed modification time & media type
+type metaFS struct {
+	*qfs.MemFS
+	modTime   time.Time
+	mediaType string
+}
+
+type metaFile struct {
+	qfs.File
+	fs *metaFS
+}
+
+func (f metaFile) ModTime() time.Time { return f.fs.modTime }
+func (f metaFile) MediaType() string  { return f.fs.mediaType }
+func (f metaFile) Size() int64        { return qfs.FileSize(f.File) }
+func (f metaFile) Seek(offset int64, whence int) (int64, error) {
+	return f.File.(io.Seeker).Seek(offset, whence)
+}
+
+func (m *metaFS) Get(ctx context.Context, path string) (qfs.File, error) {
+	f, err := m.MemFS.Get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return metaFile{File: f, fs: m}, nil
+}
+
+func TestCachedFileMetadata(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "cachefs_meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	backend := &metaFS{MemFS: qfs.NewMemFS(), modTime: modTime, mediaType: "application/x-test"}
+	path, err := backend.MemFS.Put(ctx, qfs.NewMemfileBytes("a.txt", []byte("hello")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// leftovers from an interrupted write & an older cache version
+	ioutil.WriteFile(filepath.Join(dir, "123.tmp"), []byte("partial"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, diskName("old")), []byte("no header"), 0644)
+
+	fs, err := New(backend, Config{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if infos, _ := ioutil.ReadDir(dir); len(infos) != 0 {
+		t.Errorf("expected stale cache files to be removed, %d remain", len(infos))
+	}
+
+	f, err := fs.Get(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := qfs.FileSize(f); size != 5 {
+		t.Errorf("expected an uncached file to report its size, got %d", size)
+	}
+	if _, err := f.(io.Seeker).Seek(0, io.SeekCurrent); err != nil {
+		t.Errorf("expected an uncached file to seek, got %v", err)
+	}
+	ioutil.ReadAll(f)
+	f.Close()
+
+	check := func(fs *FS) {
+		t.Helper()
+		f, err := fs.Get(ctx, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !f.ModTime().Equal(modTime) || f.MediaType() != "application/x-test" {
+			t.Errorf("expected cached file metadata to be restored. got %s, %q", f.ModTime(), f.MediaType())
+		}
+	}
+	check(fs)
+	// read back from disk by a new cache
+	fs2, err := New(backend, Config{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(fs2)
+	if s := fs2.Stats(); s.DiskHits != 1 || s.DiskBytes != 5 {
+		t.Errorf("expected a disk hit on 5 bytes. stats: %#v", s)
+	}
+
+	// seeking gives up on caching
+	fs.Invalidate(path)
+	if f, err = fs.Get(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+	f.(io.Seeker).Seek(1, io.SeekStart)
+	ioutil.ReadAll(f)
+	if _, _, ok := fs.cached(fs.key(path), false); ok {
+		t.Error("expected a seeked file not to be cached")
+	}
+}
+
+func expectContent(t *testing.T, fs qfs.Filesystem, path, expect string) {
+	t.Helper()
+	f, err := fs.Get(context.Background(), path)
+	if err != nil {
+		t.Fatalf("getting %q: %s", path, err)
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != expect {
+		t.Errorf("content mismatch for %q. want: %q, got: %q", path, expect, string(data))
+	}
+}
@@ -0,0 +1,262 @@
+package qfs
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// CIDFilter is a bloom filter of locally stored content. A negative answer
+// from MayContain is definite, so stores can answer Has for absent keys
+// without touching their datastore. Like the block cache, the filter is keyed
+// by multihash.
+//
+// Filters drift when content is added without going through the store that
+// maintains the filter. Rebuild repopulates the filter from a scan of the
+// store while continuing to serve lookups
+type CIDFilter struct {
+	lk    sync.RWMutex
+	bits  []uint64
+	k     uint32
+	count uint64
+	// next collects adds made during a rebuild
+	next *CIDFilter
+
+	checks         uint64
+	negatives      uint64
+	falsePositives uint64
+}
+
+// CIDFilterStats reports how well a filter is performing
+type CIDFilterStats struct {
+	// Count is the number of CIDs added to the filter
+	Count uint64 `json:"count"`
+	// Checks is the number of MayContain calls
+	Checks uint64 `json:"checks"`
+	// Negatives is the number of checks the filter answered on its own
+	Negatives uint64 `json:"negatives"`
+	// FalsePositives is the number of checks the filter passed on that the
+	// store reported as absent
+	FalsePositives uint64 `json:"falsePositives"`
+	// EstimatedFalsePositiveRate is the expected false positive rate given
+	// the filter's current fill
+	EstimatedFalsePositiveRate float64 `json:"estimatedFalsePositiveRate"`
+}
+
+// ObservedFalsePositiveRate is the fraction of positive checks the store
+// reported as absent
+func (s CIDFilterStats) ObservedFalsePositiveRate() float64 {
+	positives := s.Checks - s.Negatives
+	if positives == 0 {
+		return 0
+	}
+	return float64(s.FalsePositives) / float64(positives)
+}
+
+// NewCIDFilter creates a filter sized to hold expected CIDs with a false
+// positive rate of fpRate
+func NewCIDFilter(expected int, fpRate float64) *CIDFilter {
+	if expected < 1 {
+		expected = 1
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = 0.01
+	}
+	m := math.Ceil(-float64(expected) * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+	k := math.Round(m / float64(expected) * math.Ln2)
+	if k < 1 {
+		k = 1
+	}
+	return newCIDFilter(uint64(m), uint32(k))
+}
+
+func newCIDFilter(m uint64, k uint32) *CIDFilter {
+	return &CIDFilter{bits: make([]uint64, (m+63)/64), k: k}
+}
+
+// Add records a CID as present
+func (f *CIDFilter) Add(id cid.Cid) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	f.add(id)
+	if f.next != nil {
+		f.next.add(id)
+	}
+}
+
+func (f *CIDFilter) add(id cid.Cid) {
+	f.locations(id, func(bit uint64) bool {
+		f.bits[bit/64] |= 1 << (bit % 64)
+		return true
+	})
+	f.count++
+}
+
+// MayContain returns false if id is definitely not in the filter
+func (f *CIDFilter) MayContain(id cid.Cid) bool {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	f.checks++
+	contains := true
+	f.locations(id, func(bit uint64) bool {
+		contains = f.bits[bit/64]&(1<<(bit%64)) != 0
+		return contains
+	})
+	if !contains {
+		f.negatives++
+	}
+	return contains
+}
+
+// RecordFalsePositive notes that a CID the filter may contain was absent from
+// the store, feeding the observed false positive rate
+func (f *CIDFilter) RecordFalsePositive() {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	f.falsePositives++
+}
+
+// Stats returns the filter's accuracy metrics
+func (f *CIDFilter) Stats() CIDFilterStats {
+	f.lk.RLock()
+	defer f.lk.RUnlock()
+	m := float64(len(f.bits) * 64)
+	return CIDFilterStats{
+		Count:                      f.count,
+		Checks:                     f.checks,
+		Negatives:                  f.negatives,
+		FalsePositives:             f.falsePositives,
+		EstimatedFalsePositiveRate: math.Pow(1-math.Exp(-float64(f.k)*float64(f.count)/m), float64(f.k)),
+	}
+}
+
+// ErrRebuildInProgress is returned when starting a rebuild of a filter that's
+// already rebuilding
+var ErrRebuildInProgress = errors.New("filter rebuild already in progress")
+
+// Rebuild replaces the filter's contents with the CIDs scan adds. Lookups are
+// served from the existing contents until scan returns, and CIDs added during
+// the scan are kept. If scan fails the existing contents are left in place
+func (f *CIDFilter) Rebuild(scan func(add func(id cid.Cid)) error) error {
+	f.lk.Lock()
+	if f.next != nil {
+		f.lk.Unlock()
+		return ErrRebuildInProgress
+	}
+	next := newCIDFilter(uint64(len(f.bits)*64), f.k)
+	f.next = next
+	f.lk.Unlock()
+
+	err := scan(func(id cid.Cid) {
+		f.lk.Lock()
+		next.add(id)
+		f.lk.Unlock()
+	})
+
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	f.next = nil
+	if err != nil {
+		return err
+	}
+	f.bits = next.bits
+	f.count = next.count
+	f.checks, f.negatives, f.falsePositives = 0, 0, 0
+	return nil
+}
+
+// locations calls fn with each bit position for id until fn returns false,
+// using double hashing over the multihash
+func (f *CIDFilter) locations(id cid.Cid, fn func(bit uint64) bool) {
+	h := fnv.New64a()
+	h.Write(id.Hash())
+	h1 := h.Sum64()
+	h.Write([]byte{0})
+	h2 := h.Sum64() | 1
+	m := uint64(len(f.bits) * 64)
+	for i := uint32(0); i < f.k; i++ {
+		if !fn((h1 + uint64(i)*h2) % m) {
+			return
+		}
+	}
+}
+
+const cidFilterVersion uint32 = 1
+
+// WriteTo serializes the filter, implementing io.WriterTo. Stats aren't
+// persisted
+func (f *CIDFilter) WriteTo(w io.Writer) (int64, error) {
+	f.lk.RLock()
+	defer f.lk.RUnlock()
+	bw := bufio.NewWriter(w)
+	header := []interface{}{cidFilterVersion, f.k, f.count, uint64(len(f.bits))}
+	for _, v := range header {
+		if err := binary.Write(bw, binary.BigEndian, v); err != nil {
+			return 0, err
+		}
+	}
+	if err := binary.Write(bw, binary.BigEndian, f.bits); err != nil {
+		return 0, err
+	}
+	return int64(4 + 4 + 8 + 8 + len(f.bits)*8), bw.Flush()
+}
+
+// ReadCIDFilter deserializes a filter written with WriteTo
+func ReadCIDFilter(r io.Reader) (*CIDFilter, error) {
+	br := bufio.NewReader(r)
+	var (
+		version, k   uint32
+		count, words uint64
+	)
+	for _, v := range []interface{}{&version, &k, &count, &words} {
+		if err := binary.Read(br, binary.BigEndian, v); err != nil {
+			return nil, fmt.Errorf("reading cid filter header: %w", err)
+		}
+	}
+	if version != cidFilterVersion {
+		return nil, fmt.Errorf("unsupported cid filter version: %d", version)
+	}
+	f := &CIDFilter{bits: make([]uint64, words), k: k, count: count}
+	if err := binary.Read(br, binary.BigEndian, f.bits); err != nil {
+		return nil, fmt.Errorf("reading cid filter: %w", err)
+	}
+	return f, nil
+}
+
+// Save writes the filter to path, replacing any existing file atomically
+func (f *CIDFilter) Save(path string) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteTo(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadCIDFilter reads a filter saved at path
+func LoadCIDFilter(path string) (*CIDFilter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadCIDFilter(file)
+}
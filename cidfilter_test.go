@@ -0,0 +1,69 @@
+package qfs
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+func TestCIDFilter(t *testing.T) {
+	mkcid := func(i int) cid.Cid {
+		id, err := cid.V0Builder{}.Sum([]byte(fmt.Sprintf("block %d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	f := NewCIDFilter(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		f.Add(mkcid(i))
+	}
+	for i := 0; i < 1000; i++ {
+		if !f.MayContain(mkcid(i)) {
+			t.Fatalf("filter must contain every added cid. missing %d", i)
+		}
+	}
+	positives := 0
+	for i := 1000; i < 11000; i++ {
+		if f.MayContain(mkcid(i)) {
+			positives++
+		}
+	}
+	if rate := float64(positives) / 10000; rate > 0.03 {
+		t.Errorf("false positive rate too high: %f", rate)
+	}
+	if est := f.Stats().EstimatedFalsePositiveRate; est > 0.02 {
+		t.Errorf("estimated false positive rate too high: %f", est)
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := f.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ReadCIDFilter(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Stats().Count != 1000 || !loaded.MayContain(mkcid(7)) {
+		t.Errorf("loaded filter doesn't match saved filter")
+	}
+
+	// rebuilding keeps adds made during the scan & drops everything else
+	err = f.Rebuild(func(add func(cid.Cid)) error {
+		add(mkcid(0))
+		f.Add(mkcid(1))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.MayContain(mkcid(0)) || !f.MayContain(mkcid(1)) {
+		t.Errorf("expected rebuilt filter to contain scanned & concurrently added cids")
+	}
+	if f.Stats().Count != 2 {
+		t.Errorf("expected rebuilt count of 2. got: %d", f.Stats().Count)
+	}
+}
@@ -0,0 +1,121 @@
+package qfs
+
+import (
+	"context"
+	"fmt"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+)
+
+// DAGStats sizes the DAG rooted at root, walking it a level at a time with
+// GetBlocks. blocks & cumulativeSize count each distinct block once, giving
+// the DAG's size on disk. maxDepth is the number of links on the longest path
+// from the root, 0 for a DAG that's a single block. Every block must decode
+// as IPLD
+func DAGStats(ctx context.Context, store MerkleDagStore, root cid.Cid) (blocks int, cumulativeSize int64, maxDepth int, err error) {
+	w := newDAGWalk(store)
+	ids, err := w.walk(ctx, root)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	for _, id := range ids {
+		cumulativeSize += w.blocks[id].size
+	}
+	return len(ids), cumulativeSize, w.depth(root, map[cid.Cid]int{}), nil
+}
+
+// dagBlock is a block read by a dagWalk
+type dagBlock struct {
+	size  int64
+	links []cid.Cid
+}
+
+// dagWalk reads DAGs from a store, keeping the size & links of each block it
+// reads, so DAGs that share blocks only read them once
+type dagWalk struct {
+	store  MerkleDagStore
+	blocks map[cid.Cid]*dagBlock
+}
+
+func newDAGWalk(store MerkleDagStore) *dagWalk {
+	return &dagWalk{store: store, blocks: map[cid.Cid]*dagBlock{}}
+}
+
+// walk returns the CID of each block of the DAG rooted at root once
+func (w *dagWalk) walk(ctx context.Context, root cid.Cid) ([]cid.Cid, error) {
+	var reached []cid.Cid
+	seen := map[cid.Cid]struct{}{root: {}}
+	level := []cid.Cid{root}
+	for len(level) > 0 {
+		if err := w.fetch(ctx, level); err != nil {
+			return nil, err
+		}
+		reached = append(reached, level...)
+		var next []cid.Cid
+		for _, id := range level {
+			for _, l := range w.blocks[id].links {
+				if _, ok := seen[l]; !ok {
+					seen[l] = struct{}{}
+					next = append(next, l)
+				}
+			}
+		}
+		level = next
+	}
+	return reached, nil
+}
+
+// depth returns the number of links on the longest path from id, which must
+// have been walked. depths memoizes blocks reached by more than one path
+func (w *dagWalk) depth(id cid.Cid, depths map[cid.Cid]int) int {
+	if d, ok := depths[id]; ok {
+		return d
+	}
+	d := 0
+	for _, l := range w.blocks[id].links {
+		if ld := w.depth(l, depths) + 1; ld > d {
+			d = ld
+		}
+	}
+	depths[id] = d
+	return d
+}
+
+// fetch reads & decodes the blocks of ids that haven't been read yet
+func (w *dagWalk) fetch(ctx context.Context, ids []cid.Cid) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var missing []cid.Cid
+	for _, id := range ids {
+		if _, ok := w.blocks[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	data, err := w.store.GetBlocks(ctx, missing)
+	if err != nil {
+		return err
+	}
+	for i, id := range missing {
+		blk, err := blocks.NewBlockWithCid(data[i], id)
+		if err != nil {
+			return err
+		}
+		nd, err := format.Decode(blk)
+		if err != nil {
+			return fmt.Errorf("decoding block %s: %w", id, err)
+		}
+		b := &dagBlock{size: int64(len(data[i]))}
+		for _, l := range nd.Links() {
+			b.links = append(b.links, l.Cid)
+		}
+		w.blocks[id] = b
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package qfs
+
+import (
+	"context"
+	"testing"
+
+	merkledag "github.com/ipfs/go-merkledag"
+)
+
+func TestDAGStats(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemFS()
+
+	leaf := merkledag.NodeWithData([]byte("leaf"))
+	mid := merkledag.NodeWithData([]byte("mid"))
+	root := merkledag.NodeWithData([]byte("root"))
+	if err := mid.AddNodeLink("leaf", leaf); err != nil {
+		t.Fatal(err)
+	}
+	// root reaches leaf directly & through mid
+	if err := root.AddNodeLink("mid", mid); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.AddNodeLink("leaf", leaf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.PutBlocks(ctx, [][]byte{leaf.RawData(), mid.RawData(), root.RawData()}); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, size, depth, err := DAGStats(ctx, store, root.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSize := int64(len(leaf.RawData()) + len(mid.RawData()) + len(root.RawData()))
+	if blocks != 3 || size != wantSize || depth != 2 {
+		t.Errorf("expected 3 blocks, %d bytes, depth 2. got: %d blocks, %d bytes, depth %d", wantSize, blocks, size, depth)
+	}
+
+	if blocks, _, depth, err = DAGStats(ctx, store, leaf.Cid()); err != nil || blocks != 1 || depth != 0 {
+		t.Errorf("expected a single block of depth 0. got: %d blocks, depth %d, err %v", blocks, depth, err)
+	}
+	if _, _, _, err := DAGStats(ctx, NewMemFS(), root.Cid()); err == nil {
+		t.Error("expected sizing a missing DAG to fail")
+	}
+}
@@ -0,0 +1,110 @@
+package qfs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+)
+
+// DedupeReport describes how the blocks of several DAGs overlap, like
+// consecutive versions of a dataset. Blocks are counted once no matter how
+// many links to them a DAG has
+type DedupeReport struct {
+	// Roots describes each DAG, in the order roots were given
+	Roots []RootDedupe
+	// Blocks & Bytes count distinct blocks across all DAGs, the storage the
+	// DAGs take up together
+	Blocks int
+	Bytes  int64
+	// SharedBlocks & SharedBytes count distinct blocks that are part of more
+	// than one DAG
+	SharedBlocks int
+	SharedBytes  int64
+}
+
+// RootDedupe describes the blocks of one DAG in a DedupeReport
+type RootDedupe struct {
+	Root cid.Cid
+	// Blocks & Bytes count the blocks of the DAG, the storage it would take up
+	// on its own
+	Blocks int
+	Bytes  int64
+	// UniqueBlocks & UniqueBytes count blocks no other DAG has
+	UniqueBlocks int
+	UniqueBytes  int64
+	// NewBlocks & NewBytes count blocks no earlier DAG has, the storage this
+	// DAG adds to the ones before it
+	NewBlocks int
+	NewBytes  int64
+}
+
+// SavedBytes is the storage deduplication saves, the difference between the
+// bytes of each DAG stored on its own & the bytes of the DAGs stored together
+func (r DedupeReport) SavedBytes() int64 {
+	var total int64
+	for _, root := range r.Roots {
+		total += root.Bytes
+	}
+	return total - r.Bytes
+}
+
+// DedupeStats walks the DAGs rooted at roots, reporting the blocks & bytes
+// they share. Blocks are fetched a level at a time with GetBlocks, & a block
+// shared by several DAGs is only fetched once. Every block must decode as
+// IPLD, so stores have to hold the DAGs as blocks
+func DedupeStats(ctx context.Context, store MerkleDagStore, roots []cid.Cid) (DedupeReport, error) {
+	w := newDAGWalk(store)
+	counts := map[cid.Cid]*dedupeCount{}
+	reached := make([][]cid.Cid, len(roots))
+	for i, root := range roots {
+		var err error
+		if reached[i], err = w.walk(ctx, root); err != nil {
+			return DedupeReport{}, fmt.Errorf("walking %s: %w", root, err)
+		}
+		for _, id := range reached[i] {
+			c, ok := counts[id]
+			if !ok {
+				c = &dedupeCount{size: w.blocks[id].size, first: i}
+				counts[id] = c
+			}
+			c.roots++
+		}
+	}
+
+	report := DedupeReport{Roots: make([]RootDedupe, len(roots))}
+	for i, root := range roots {
+		rd := RootDedupe{Root: root}
+		for _, id := range reached[i] {
+			b := counts[id]
+			rd.Blocks++
+			rd.Bytes += b.size
+			if b.roots == 1 {
+				rd.UniqueBlocks++
+				rd.UniqueBytes += b.size
+			}
+			if b.first == i {
+				rd.NewBlocks++
+				rd.NewBytes += b.size
+			}
+		}
+		report.Roots[i] = rd
+	}
+	for _, b := range counts {
+		report.Blocks++
+		report.Bytes += b.size
+		if b.roots > 1 {
+			report.SharedBlocks++
+			report.SharedBytes += b.size
+		}
+	}
+	return report, nil
+}
+
+// dedupeCount counts the DAGs a block is part of
+type dedupeCount struct {
+	size  int64
+	roots int
+	// first is the index of the first DAG the block is part of
+	first int
+}
@@ -0,0 +1,70 @@
+package qfs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	merkledag "github.com/ipfs/go-merkledag"
+)
+
+func TestDedupeStats(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemFS()
+
+	put := func(nd *merkledag.ProtoNode) (cid.Cid, int64) {
+		ids, err := store.PutBlocks(ctx, [][]byte{nd.RawData()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ids[0].Equals(nd.Cid()) {
+			t.Fatalf("stored block cid mismatch. want: %s got: %s", nd.Cid(), ids[0])
+		}
+		return ids[0], int64(len(nd.RawData()))
+	}
+	node := func(data string, links ...*merkledag.ProtoNode) *merkledag.ProtoNode {
+		nd := merkledag.NodeWithData([]byte(data))
+		for _, l := range links {
+			if err := nd.AddNodeLink("", l); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return nd
+	}
+
+	a, b, c := node("aaaa"), node("bbbbbbbb"), node("cccccccccccc")
+	_, sizeA := put(a)
+	_, sizeB := put(b)
+	_, sizeC := put(c)
+	// v2 links a twice, it's still counted once
+	v1, v2 := node("v1", a, b), node("v2", a, a, c)
+	root1, size1 := put(v1)
+	root2, size2 := put(v2)
+
+	report, err := DedupeStats(ctx, store, []cid.Cid{root1, root2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r1, r2 := report.Roots[0], report.Roots[1]
+	if r1.Root != root1 || r1.Blocks != 3 || r1.Bytes != size1+sizeA+sizeB {
+		t.Errorf("unexpected first root: %+v", r1)
+	}
+	if r1.NewBlocks != 3 || r1.UniqueBlocks != 2 || r1.UniqueBytes != size1+sizeB {
+		t.Errorf("unexpected first root: %+v", r1)
+	}
+	if r2.Blocks != 3 || r2.NewBlocks != 2 || r2.NewBytes != size2+sizeC || r2.UniqueBytes != size2+sizeC {
+		t.Errorf("unexpected second root: %+v", r2)
+	}
+	if report.Blocks != 5 || report.Bytes != size1+size2+sizeA+sizeB+sizeC {
+		t.Errorf("expected 5 distinct blocks. got: %d blocks, %d bytes", report.Blocks, report.Bytes)
+	}
+	if report.SharedBlocks != 1 || report.SharedBytes != sizeA || report.SavedBytes() != sizeA {
+		t.Errorf("expected a to be shared. got: %d blocks, %d bytes, %d saved", report.SharedBlocks, report.SharedBytes, report.SavedBytes())
+	}
+
+	missing := node("missing")
+	if _, err := DedupeStats(ctx, store, []cid.Cid{missing.Cid()}); err == nil {
+		t.Error("expected walking a missing root to fail")
+	}
+}
@@ -0,0 +1,95 @@
+package qfs
+
+import (
+	"strings"
+)
+
+// Feature is a capability a filesystem may have. Features combine as a bit
+// set, so a set of required features is also a Feature
+type Feature uint
+
+const (
+	// FeatureWritable filesystems accept Put & Delete
+	FeatureWritable Feature = 1 << iota
+	// FeatureContentAddressed filesystems reference persisted content by hash
+	FeatureContentAddressed
+	// FeatureOnline filesystems can fetch content they don't hold from a
+	// network
+	FeatureOnline
+	// FeaturePinning filesystems implement PinningFS
+	FeaturePinning
+	// FeatureNaming filesystems implement NameSystem
+	FeatureNaming
+)
+
+var featureNames = []struct {
+	f    Feature
+	name string
+}{
+	{FeatureWritable, "writable"},
+	{FeatureContentAddressed, "content-addressed"},
+	{FeatureOnline, "online"},
+	{FeaturePinning, "pinning"},
+	{FeatureNaming, "naming"},
+}
+
+// String lists the names of set features
+func (f Feature) String() string {
+	names := []string{}
+	for _, fn := range featureNames {
+		if f&fn.f != 0 {
+			names = append(names, fn.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// Descriptor is a filesystem's identity & capabilities
+type Descriptor struct {
+	// Type is the filesystem's Type() string
+	Type string `json:"type"`
+	// Version identifies the implementation behind the filesystem, if it has
+	// a meaningful one
+	Version string `json:"version,omitempty"`
+	// Features is the set of capabilities the filesystem has right now.
+	// Features like FeatureOnline can change over a filesystem's lifetime
+	Features Feature `json:"features"`
+}
+
+// Has reports whether d has every feature in required
+func (d Descriptor) Has(required Feature) bool {
+	return d.Features&required == required
+}
+
+// ReadOnly reports whether the filesystem rejects writes
+func (d Descriptor) ReadOnly() bool { return !d.Has(FeatureWritable) }
+
+// DescribingFS is implemented by filesystems that describe their own
+// capabilities
+type DescribingFS interface {
+	Describe() Descriptor
+}
+
+// Describe returns the descriptor of a filesystem. Filesystems that don't
+// implement DescribingFS are described from the interfaces they implement &
+// assumed writable
+func Describe(fs Filesystem) Descriptor {
+	if d, ok := fs.(DescribingFS); ok {
+		return d.Describe()
+	}
+	return Descriptor{Type: fs.Type(), Features: inferFeatures(fs) | FeatureWritable}
+}
+
+// inferFeatures returns the features implied by the interfaces fs implements
+func inferFeatures(fs Filesystem) (f Feature) {
+	if _, ok := fs.(CAFS); ok {
+		f |= FeatureContentAddressed
+	}
+	if _, ok := fs.(PinningFS); ok {
+		f |= FeaturePinning
+	}
+	if _, ok := fs.(NameSystem); ok {
+		f |= FeatureNaming
+	}
+	return f
+}
@@ -0,0 +1,27 @@
+package qfs
+
+import (
+	"testing"
+)
+
+func TestDescribe(t *testing.T) {
+	d := Describe(NewMemFS())
+	if d.Type != MemFilestoreType {
+		t.Errorf("type mismatch. want %q, got %q", MemFilestoreType, d.Type)
+	}
+	if !d.Has(FeatureWritable | FeatureContentAddressed) {
+		t.Errorf("expected mem filesystem to be writable & content-addressed, got %s", d.Features)
+	}
+	if d.Has(FeatureOnline) {
+		t.Errorf("expected mem filesystem to be offline")
+	}
+
+	wrapped := Describe(NewProtectedFS(NewMemFS(), NewRefProtector()))
+	if wrapped.Type != d.Type || wrapped.Features != d.Features {
+		t.Errorf("expected wrapper to describe the wrapped filesystem. want %#v, got %#v", d, wrapped)
+	}
+
+	if s := (FeatureWritable | FeatureOnline).String(); s != "writable,online" {
+		t.Errorf("feature string mismatch. want %q, got %q", "writable,online", s)
+	}
+}
@@ -0,0 +1,242 @@
+package qfs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// Diff describes the first divergence found comparing two trees
+type Diff struct {
+	// Path is the location of the divergence relative to the compared roots,
+	// "" for the roots themselves
+	Path string
+	// Reason describes how the trees diverge
+	Reason string
+	// Offset is the first differing byte when file contents diverge, -1
+	// otherwise
+	Offset int64
+}
+
+// String implements the fmt.Stringer interface
+func (d Diff) String() string {
+	if d.Offset >= 0 {
+		return fmt.Sprintf("%s: %s at byte %d", d.displayPath(), d.Reason, d.Offset)
+	}
+	return fmt.Sprintf("%s: %s", d.displayPath(), d.Reason)
+}
+
+func (d Diff) displayPath() string {
+	if d.Path == "" {
+		return "/"
+	}
+	return d.Path
+}
+
+// Equal verifies the tree at pathA in fsA is identical to the tree at pathB
+// in fsB. When both filesystems are content-addressed and the paths share a
+// multihash the trees are equal without reading them. Otherwise Equal streams
+// both trees, comparing directory entries & file bytes, and reports the first
+// divergence. The returned Diff is only meaningful when equal is false
+func Equal(ctx context.Context, fsA Filesystem, pathA string, fsB Filesystem, pathB string) (equal bool, diff Diff, err error) {
+	if sameContentAddress(fsA, pathA, fsB, pathB) {
+		return true, Diff{}, nil
+	}
+
+	a, err := fsA.Get(ctx, pathA)
+	if err != nil {
+		return false, Diff{}, fmt.Errorf("getting %q: %w", pathA, err)
+	}
+	b, err := fsB.Get(ctx, pathB)
+	if err != nil {
+		closeFile(a)
+		return false, Diff{}, fmt.Errorf("getting %q: %w", pathB, err)
+	}
+
+	d, err := compareFiles(ctx, "", a, b)
+	if err != nil {
+		return false, Diff{}, err
+	}
+	if d != nil {
+		return false, *d, nil
+	}
+	return true, Diff{}, nil
+}
+
+// sameContentAddress reports whether both paths address the same content by
+// hash. CIDs that differ don't imply different content, as backends may chunk
+// or encode the same bytes differently
+func sameContentAddress(fsA Filesystem, pathA string, fsB Filesystem, pathB string) bool {
+	if _, ok := fsA.(CAFS); !ok {
+		return false
+	}
+	if _, ok := fsB.(CAFS); !ok {
+		return false
+	}
+	idA, restA, ok := splitCAPath(pathA)
+	if !ok {
+		return false
+	}
+	idB, restB, ok := splitCAPath(pathB)
+	if !ok {
+		return false
+	}
+	return restA == restB && string(idA.Hash()) == string(idB.Hash())
+}
+
+// splitCAPath splits a path like /ipfs/QmFoo/a/b into a CID & the remainder
+func splitCAPath(path string) (cid.Cid, string, bool) {
+	parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 3)
+	if len(parts) < 2 {
+		return cid.Cid{}, "", false
+	}
+	id, err := cid.Parse(parts[1])
+	if err != nil {
+		return cid.Cid{}, "", false
+	}
+	if len(parts) == 3 {
+		return id, strings.TrimSuffix(parts[2], "/"), true
+	}
+	return id, "", true
+}
+
+func compareFiles(ctx context.Context, path string, a, b File) (*Diff, error) {
+	if err := ctx.Err(); err != nil {
+		closeFile(a)
+		closeFile(b)
+		return nil, err
+	}
+
+	if a.IsDirectory() != b.IsDirectory() {
+		closeFile(a)
+		closeFile(b)
+		kind := func(f File) string {
+			if f.IsDirectory() {
+				return "directory"
+			}
+			return "file"
+		}
+		return &Diff{Path: path, Reason: fmt.Sprintf("%s vs %s", kind(a), kind(b)), Offset: -1}, nil
+	}
+	if a.IsDirectory() {
+		return compareDirs(ctx, path, a, b)
+	}
+
+	defer a.Close()
+	defer b.Close()
+	offset, same, err := compareStreams(a, b)
+	if err != nil {
+		return nil, fmt.Errorf("comparing %q: %w", path, err)
+	}
+	if !same {
+		return &Diff{Path: path, Reason: "contents differ", Offset: offset}, nil
+	}
+	return nil, nil
+}
+
+func compareDirs(ctx context.Context, path string, a, b File) (*Diff, error) {
+	entriesA, err := dirEntries(a)
+	if err != nil {
+		return nil, err
+	}
+	entriesB, err := dirEntries(b)
+	if err != nil {
+		closeEntries(entriesA)
+		return nil, err
+	}
+
+	names := map[string]struct{}{}
+	for name := range entriesA {
+		names[name] = struct{}{}
+	}
+	for name := range entriesB {
+		names[name] = struct{}{}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		chA, okA := entriesA[name]
+		chB, okB := entriesB[name]
+		var d *Diff
+		switch {
+		case !okA:
+			d = &Diff{Path: path + "/" + name, Reason: "missing from first tree", Offset: -1}
+		case !okB:
+			d = &Diff{Path: path + "/" + name, Reason: "missing from second tree", Offset: -1}
+		default:
+			delete(entriesA, name)
+			delete(entriesB, name)
+			if d, err = compareFiles(ctx, path+"/"+name, chA, chB); err != nil {
+				closeEntries(entriesA)
+				closeEntries(entriesB)
+				return nil, err
+			}
+		}
+		if d != nil {
+			closeEntries(entriesA)
+			closeEntries(entriesB)
+			return d, nil
+		}
+	}
+	return nil, nil
+}
+
+// dirEntries reads all entries of a directory, keyed by name
+func dirEntries(dir File) (map[string]File, error) {
+	entries := map[string]File{}
+	for {
+		f, err := dir.NextFile()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			closeEntries(entries)
+			return nil, err
+		}
+		entries[f.FileName()] = f
+	}
+}
+
+func closeEntries(entries map[string]File) {
+	for _, f := range entries {
+		closeFile(f)
+	}
+}
+
+func closeFile(f File) {
+	if !f.IsDirectory() {
+		f.Close()
+	}
+}
+
+// compareStreams reads a & b in lockstep, returning the offset of the first
+// differing byte
+func compareStreams(a, b io.Reader) (offset int64, same bool, err error) {
+	ra, rb := bufio.NewReader(a), bufio.NewReader(b)
+	for {
+		ca, errA := ra.ReadByte()
+		cb, errB := rb.ReadByte()
+		if errA != nil && errA != io.EOF {
+			return offset, false, errA
+		}
+		if errB != nil && errB != io.EOF {
+			return offset, false, errB
+		}
+		if errA == io.EOF || errB == io.EOF {
+			return offset, errA == errB, nil
+		}
+		if ca != cb {
+			return offset, false, nil
+		}
+		offset++
+	}
+}
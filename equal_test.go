@@ -0,0 +1,96 @@
+package qfs
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEqual(t *testing.T) {
+	ctx := context.Background()
+	fsA, fsB := NewMemFS(), NewMemFS()
+
+	put := func(fs Filesystem, f File) string {
+		t.Helper()
+		path, err := fs.Put(ctx, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	a := put(fsA, NewMemfileBytes("/a.txt", []byte("hello world")))
+	b := put(fsB, NewMemfileBytes("/a.txt", []byte("hello world")))
+	if eq, d, err := Equal(ctx, fsA, a, fsB, b); err != nil || !eq {
+		t.Errorf("expected identical files to be equal. got: %t %s %v", eq, d, err)
+	}
+
+	c := put(fsB, NewMemfileBytes("/c.txt", []byte("hello there")))
+	eq, d, err := Equal(ctx, fsA, a, fsB, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eq {
+		t.Fatal("expected different files not to be equal")
+	}
+	if d.Offset != 6 || d.Reason != "contents differ" {
+		t.Errorf("expected contents to differ at byte 6. got: %s", d)
+	}
+
+	short := put(fsB, NewMemfileBytes("/s.txt", []byte("hello")))
+	if eq, d, _ := Equal(ctx, fsA, a, fsB, short); eq || d.Offset != 5 {
+		t.Errorf("expected truncated file to differ at byte 5. got: %t %s", eq, d)
+	}
+
+	if _, _, err := Equal(ctx, fsA, "/mem/QmMissing", fsB, b); err == nil {
+		t.Errorf("expected error comparing missing path")
+	}
+}
+
+func TestEqualDirs(t *testing.T) {
+	ctx := context.Background()
+	mkdir := func(bData string, extra bool) File {
+		files := []File{
+			NewMemfileBytes("a.txt", []byte("a")),
+			NewMemdir("sub", NewMemfileBytes("b.txt", []byte(bData))),
+		}
+		if extra {
+			files = append(files, NewMemfileBytes("z.txt", []byte("z")))
+		}
+		return NewMemdir("/", files...)
+	}
+
+	cases := []struct {
+		a, b   File
+		expect string
+	}{
+		{mkdir("b", false), mkdir("b", false), ""},
+		{mkdir("b", false), mkdir("B", false), "/sub/b.txt: contents differ at byte 0"},
+		{mkdir("b", false), mkdir("b", true), "/z.txt: missing from first tree"},
+	}
+	for i, c := range cases {
+		eq, d, err := compareTrees(ctx, c.a, c.b)
+		if err != nil {
+			t.Fatalf("case %d: %s", i, err)
+		}
+		if c.expect == "" {
+			if !eq {
+				t.Errorf("case %d: expected equal. got: %s", i, d)
+			}
+			continue
+		}
+		if eq || d.String() != c.expect {
+			t.Errorf("case %d: expected diff %q. got: %t %q", i, c.expect, eq, d)
+		}
+	}
+}
+
+func compareTrees(ctx context.Context, a, b File) (bool, Diff, error) {
+	d, err := compareFiles(ctx, "", a, b)
+	if err != nil || d != nil {
+		if d == nil {
+			d = &Diff{}
+		}
+		return false, *d, err
+	}
+	return true, Diff{}, nil
+}
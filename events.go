@@ -0,0 +1,193 @@
+package qfs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// EventType names a kind of filesystem change
+type EventType string
+
+const (
+	// EventPut is emitted after a file is written
+	EventPut EventType = "put"
+	// EventDelete is emitted after a path is removed
+	EventDelete EventType = "delete"
+	// EventPin is emitted after content is pinned
+	EventPin EventType = "pin"
+	// EventUnpin is emitted after a pin is removed
+	EventUnpin EventType = "unpin"
+	// EventGC is emitted after a store garbage collects unpinned content.
+	// The event path is the root of the collected store, like "/ipfs"
+	EventGC EventType = "gc"
+)
+
+// Event describes a change made to a filesystem
+type Event struct {
+	Type EventType `json:"type"`
+	// FS is the type of the filesystem the change was made to
+	FS   string    `json:"fs"`
+	Path string    `json:"path"`
+	Time time.Time `json:"time"`
+}
+
+// EventSink receives events published to an EventBus
+type EventSink interface {
+	HandleEvent(ctx context.Context, e Event) error
+}
+
+// EventSinkFunc adapts a function to the EventSink interface
+type EventSinkFunc func(ctx context.Context, e Event) error
+
+// HandleEvent implements the EventSink interface
+func (fn EventSinkFunc) HandleEvent(ctx context.Context, e Event) error {
+	return fn(ctx, e)
+}
+
+// EventEmitter is an optional interface for filesystems that publish their
+// changes to an EventBus
+type EventEmitter interface {
+	Events() *EventBus
+}
+
+// EventBus delivers events to a set of sinks. Sinks are called in the order
+// they were added, synchronously with the operation that caused the event.
+// A sink that fails doesn't stop delivery to the others. Events are also sent
+// to watchers subscribed with Watch, which never block delivery. The zero
+// value is ready to use
+type EventBus struct {
+	lk    sync.RWMutex
+	sinks []EventSink
+	hub   WatchHub
+}
+
+var _ Watcher = (*EventBus)(nil)
+
+// NewEventBus creates an EventBus that delivers to sinks
+func NewEventBus(sinks ...EventSink) *EventBus {
+	return &EventBus{sinks: sinks}
+}
+
+// AddSink registers a sink to receive all future events
+func (b *EventBus) AddSink(s EventSink) {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	b.sinks = append(b.sinks, s)
+}
+
+// Publish delivers an event to all sinks, setting the event time if unset
+func (b *EventBus) Publish(ctx context.Context, e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.lk.RLock()
+	sinks := b.sinks
+	b.lk.RUnlock()
+
+	for _, s := range sinks {
+		if err := s.HandleEvent(ctx, e); err != nil {
+			log.Debugw("delivering event", "type", e.Type, "path", e.Path, "err", err)
+		}
+	}
+	b.hub.Publish(e)
+}
+
+// Watch subscribes to events published at or beneath path until ctx ends. An
+// empty path subscribes to every event, see WatchHub
+func (b *EventBus) Watch(ctx context.Context, path string) (<-chan Event, error) {
+	return b.hub.Watch(ctx, path)
+}
+
+// EventFS wraps a filesystem, publishing an event for each successful Put,
+// Delete, Pin & Unpin
+type EventFS struct {
+	Filesystem
+	Bus *EventBus
+}
+
+var (
+	_ Filesystem   = (*EventFS)(nil)
+	_ PinningFS    = (*EventFS)(nil)
+	_ DescribingFS = (*EventFS)(nil)
+	_ EventEmitter = (*EventFS)(nil)
+)
+
+// NewEventFS wraps fs, publishing changes to bus
+func NewEventFS(fs Filesystem, bus *EventBus) *EventFS {
+	return &EventFS{Filesystem: fs, Bus: bus}
+}
+
+// Events returns the bus changes are published to
+func (fs *EventFS) Events() *EventBus { return fs.Bus }
+
+// Describe returns the wrapped filesystem's descriptor
+func (fs *EventFS) Describe() Descriptor { return Describe(fs.Filesystem) }
+
+// Put writes a file & publishes an EventPut with the resulting path
+func (fs *EventFS) Put(ctx context.Context, file File) (string, error) {
+	path, err := fs.Filesystem.Put(ctx, file)
+	if err != nil {
+		return path, err
+	}
+	fs.Bus.Publish(ctx, Event{Type: EventPut, FS: fs.Type(), Path: path})
+	return path, nil
+}
+
+// Delete removes a path & publishes an EventDelete
+func (fs *EventFS) Delete(ctx context.Context, path string) error {
+	if err := fs.Filesystem.Delete(ctx, path); err != nil {
+		return err
+	}
+	fs.Bus.Publish(ctx, Event{Type: EventDelete, FS: fs.Type(), Path: path})
+	return nil
+}
+
+// Pin pins content & publishes an EventPin
+func (fs *EventFS) Pin(ctx context.Context, key string, recursive bool) error {
+	pfs, ok := fs.Filesystem.(PinningFS)
+	if !ok {
+		return fmt.Errorf("%s filesystem doesn't support pinning", fs.Type())
+	}
+	if err := pfs.Pin(ctx, key, recursive); err != nil {
+		return err
+	}
+	fs.Bus.Publish(ctx, Event{Type: EventPin, FS: fs.Type(), Path: key})
+	return nil
+}
+
+// Unpin removes a pin & publishes an EventUnpin
+func (fs *EventFS) Unpin(ctx context.Context, key string, recursive bool) error {
+	pfs, ok := fs.Filesystem.(PinningFS)
+	if !ok {
+		return fmt.Errorf("%s filesystem doesn't support pinning", fs.Type())
+	}
+	if err := pfs.Unpin(ctx, key, recursive); err != nil {
+		return err
+	}
+	fs.Bus.Publish(ctx, Event{Type: EventUnpin, FS: fs.Type(), Path: key})
+	return nil
+}
+
+// NDJSONSink writes each event as a line of JSON
+type NDJSONSink struct {
+	lk  sync.Mutex
+	enc *json.Encoder
+}
+
+var _ EventSink = (*NDJSONSink)(nil)
+
+// NewNDJSONSink creates a sink that streams events to w
+func NewNDJSONSink(w io.Writer) *NDJSONSink {
+	return &NDJSONSink{enc: json.NewEncoder(w)}
+}
+
+// HandleEvent implements the EventSink interface
+func (s *NDJSONSink) HandleEvent(ctx context.Context, e Event) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.enc.Encode(e)
+}
@@ -0,0 +1,125 @@
+package qfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEventFSNDJSON(t *testing.T) {
+	ctx := context.Background()
+	buf := &bytes.Buffer{}
+	store := &linkedPinFS{MemFS: NewMemFS(), memPinner: newMemPinner()}
+	fs := NewEventFS(store, NewEventBus(NewNDJSONSink(buf)))
+
+	path, err := fs.Put(ctx, NewMemfileBytes("/a.txt", []byte("a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Pin(ctx, path, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Unpin(ctx, path, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Delete(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+	// failed operations don't emit events
+	fs.Unpin(ctx, "/mem/missing", true)
+
+	got := []EventType{}
+	sc := bufio.NewScanner(buf)
+	for sc.Scan() {
+		e := Event{}
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Path != path || e.FS != MemFilestoreType || e.Time.IsZero() {
+			t.Errorf("unexpected event: %#v", e)
+		}
+		got = append(got, e.Type)
+	}
+	expect := []EventType{EventPut, EventPin, EventUnpin, EventDelete}
+	if len(got) != len(expect) {
+		t.Fatalf("event count mismatch. want: %v got: %v", expect, got)
+	}
+	for i := range expect {
+		if got[i] != expect[i] {
+			t.Errorf("event %d mismatch. want: %s got: %s", i, expect[i], got[i])
+		}
+	}
+}
+
+func TestEventBusWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bus := &EventBus{}
+	all, err := bus.Watch(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipfs, err := bus.Watch(ctx, "/ipfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bus.Publish(ctx, Event{Type: EventPut, Path: "/mem/a"})
+	bus.Publish(ctx, Event{Type: EventGC, Path: "/ipfs"})
+
+	if e := <-all; e.Type != EventPut || e.Time.IsZero() {
+		t.Errorf("expected timestamped put event. got: %#v", e)
+	}
+	if e := <-all; e.Type != EventGC {
+		t.Errorf("expected gc event. got: %#v", e)
+	}
+	if e := <-ipfs; e.Type != EventGC {
+		t.Errorf("expected /ipfs watcher to only see the gc event. got: %#v", e)
+	}
+
+	cancel()
+	if _, ok := <-all; ok {
+		t.Error("expected watch channel to close when its context ends")
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	secret := []byte("secret")
+	var calls int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if !VerifyWebhook(secret, body, r.Header.Get(WebhookSignatureHeader)) {
+			t.Errorf("invalid signature")
+		}
+		if r.URL.Path != "/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer s.Close()
+
+	n := NewWebhookNotifier(s.URL, secret)
+	n.Backoff = time.Millisecond
+	if err := n.HandleEvent(context.Background(), Event{Type: EventPut, Path: "/mem/a"}); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 1 retry. got %d calls", calls)
+	}
+
+	n.URL = s.URL + "/missing"
+	n.Retries = 0
+	if err := n.HandleEvent(context.Background(), Event{Type: EventPut}); err == nil {
+		t.Errorf("expected error for non-retryable status")
+	}
+}
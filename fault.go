@@ -0,0 +1,147 @@
+package qfs
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Fault injection points. Each names the Filesystem method a Fault applies to
+const (
+	FaultOpHas    = "has"
+	FaultOpGet    = "get"
+	FaultOpPut    = "put"
+	FaultOpDelete = "delete"
+)
+
+// Fault describes a failure to inject into filesystem operations. Faults let
+// downstream tests exercise error handling without writing a fake filesystem
+type Fault struct {
+	// Op is the injection point, one of the FaultOp constants
+	Op string
+	// Path limits the fault to operations on a single path. For Put the path
+	// is the FullPath of the file being put. Empty matches any path
+	Path string
+	// Nth triggers the fault only on the nth matching call, counting from 1.
+	// Zero triggers the fault on every matching call
+	Nth int
+	// Delay stalls the operation before it runs (or fails). Delays end early
+	// if the operation context is cancelled
+	Delay time.Duration
+	// Err is returned instead of running the operation. A nil Err runs the
+	// operation after any Delay
+	Err error
+}
+
+// FailNth creates a fault that returns err on the nth call to op
+func FailNth(op string, n int, err error) Fault {
+	return Fault{Op: op, Nth: n, Err: err}
+}
+
+// Slow creates a fault that delays every call to op by d
+func Slow(op string, d time.Duration) Fault {
+	return Fault{Op: op, Delay: d}
+}
+
+// FaultyFS wraps a filesystem, injecting configured faults into calls that
+// match them. A FaultyFS with no faults behaves exactly like the wrapped
+// filesystem
+type FaultyFS struct {
+	Filesystem
+
+	lk     sync.Mutex
+	faults []*faultState
+}
+
+type faultState struct {
+	Fault
+	calls int
+}
+
+var _ Filesystem = (*FaultyFS)(nil)
+
+// InjectFaults wraps fs in a FaultyFS with the given faults
+func InjectFaults(fs Filesystem, faults ...Fault) *FaultyFS {
+	f := &FaultyFS{Filesystem: fs}
+	for _, flt := range faults {
+		f.Add(flt)
+	}
+	return f
+}
+
+// Add registers a fault. Faults are checked in the order they're added, and
+// the first to trigger wins
+func (f *FaultyFS) Add(flt Fault) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	f.faults = append(f.faults, &faultState{Fault: flt})
+}
+
+// Reset removes all faults
+func (f *FaultyFS) Reset() {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	f.faults = nil
+}
+
+// Has returns whether the `path` is mapped to a value
+func (f *FaultyFS) Has(ctx context.Context, path string) (bool, error) {
+	if err := f.inject(ctx, FaultOpHas, path); err != nil {
+		return false, err
+	}
+	return f.Filesystem.Has(ctx, path)
+}
+
+// Get fetches a file
+func (f *FaultyFS) Get(ctx context.Context, path string) (File, error) {
+	if err := f.inject(ctx, FaultOpGet, path); err != nil {
+		return nil, err
+	}
+	return f.Filesystem.Get(ctx, path)
+}
+
+// Put places a file or directory on the filesystem
+func (f *FaultyFS) Put(ctx context.Context, file File) (string, error) {
+	if err := f.inject(ctx, FaultOpPut, file.FullPath()); err != nil {
+		return "", err
+	}
+	return f.Filesystem.Put(ctx, file)
+}
+
+// Delete removes a file or directory from the filesystem
+func (f *FaultyFS) Delete(ctx context.Context, path string) error {
+	if err := f.inject(ctx, FaultOpDelete, path); err != nil {
+		return err
+	}
+	return f.Filesystem.Delete(ctx, path)
+}
+
+// inject counts a call against all matching faults, sleeps for the delay of
+// the first triggered fault, and returns its error
+func (f *FaultyFS) inject(ctx context.Context, op, path string) error {
+	var triggered *Fault
+	f.lk.Lock()
+	for _, flt := range f.faults {
+		if flt.Op != op || (flt.Path != "" && flt.Path != path) {
+			continue
+		}
+		flt.calls++
+		if triggered == nil && (flt.Nth == 0 || flt.Nth == flt.calls) {
+			t := flt.Fault
+			triggered = &t
+		}
+	}
+	f.lk.Unlock()
+
+	if triggered == nil {
+		return nil
+	}
+	if triggered.Delay > 0 {
+		select {
+		case <-time.After(triggered.Delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return triggered.Err
+}
@@ -0,0 +1,45 @@
+package qfs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFaultyFS(t *testing.T) {
+	ctx := context.Background()
+	fs := InjectFaults(NewMemFS(), FailNth(FaultOpGet, 2, ErrNotFound))
+
+	path, err := fs.Put(ctx, NewMemfileBytes("/a.txt", []byte("a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fs.Get(ctx, path); err != nil {
+		t.Errorf("expected first get to succeed. got: %s", err)
+	}
+	if _, err := fs.Get(ctx, path); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected second get to return ErrNotFound. got: %v", err)
+	}
+	if _, err := fs.Get(ctx, path); err != nil {
+		t.Errorf("expected third get to succeed. got: %s", err)
+	}
+
+	errBoom := errors.New("boom")
+	fs.Add(Fault{Op: FaultOpPut, Path: "/b.txt", Err: errBoom})
+	if _, err := fs.Put(ctx, NewMemfileBytes("/b.txt", []byte("b"))); !errors.Is(err, errBoom) {
+		t.Errorf("expected put of matching path to fail. got: %v", err)
+	}
+	if _, err := fs.Put(ctx, NewMemfileBytes("/c.txt", []byte("c"))); err != nil {
+		t.Errorf("expected put of other path to succeed. got: %s", err)
+	}
+
+	fs.Reset()
+	fs.Add(Slow(FaultOpHas, time.Hour))
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := fs.Has(cctx, path); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected slow has to honor context deadline. got: %v", err)
+	}
+}
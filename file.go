@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"mime"
 	"path/filepath"
 	"strings"
 	"time"
@@ -17,6 +16,9 @@ var (
 	ErrNotDirectory = errors.New("file is not a directory")
 	// ErrNotFile is the result of attempting to perform "file like" operations on a directory
 	ErrNotFile = errors.New("file is a directory")
+	// ErrNotSeekable is returned seeking a SeekableFile whose underlying data
+	// doesn't support random access
+	ErrNotSeekable = errors.New("file is not seekable")
 )
 
 // File is an interface that provides functionality for handling
@@ -65,6 +67,32 @@ type SizeFile interface {
 	Size() int64
 }
 
+// SeekableFile is an opt-in interface for files that support random access,
+// which formats like Parquet & zip need to read their footers. Wrapping files
+// may implement SeekableFile without knowing whether the file they wrap can
+// seek, returning ErrNotSeekable when it can't
+type SeekableFile interface {
+	File
+	io.Seeker
+}
+
+// FileSize returns the length of f in bytes, or -1 if f doesn't implement
+// SizeFile
+func FileSize(f File) int64 {
+	if sf, ok := f.(SizeFile); ok {
+		return sf.Size()
+	}
+	return -1
+}
+
+// seekFile seeks f if it's an io.Seeker
+func seekFile(f File, offset int64, whence int) (int64, error) {
+	if s, ok := f.(io.Seeker); ok {
+		return s.Seek(offset, whence)
+	}
+	return 0, ErrNotSeekable
+}
+
 // PathSetter adds the capacity to modify a path property
 type PathSetter interface {
 	SetPath(path string)
@@ -76,12 +104,10 @@ func Walk(root File, visit func(f File) error) (err error) {
 	if root.IsDirectory() {
 		for {
 			f, err := root.NextFile()
-			if err != nil {
-				if err.Error() == "EOF" {
-					return visit(root)
-				} else {
-					return err
-				}
+			if errors.Is(err, io.EOF) {
+				return visit(root)
+			} else if err != nil {
+				return err
 			}
 
 			if err := Walk(f, visit); err != nil {
@@ -106,8 +132,9 @@ type Memfile struct {
 }
 
 var (
-	_ File     = (*Memfile)(nil)
-	_ SizeFile = (*Memfile)(nil)
+	_ File         = (*Memfile)(nil)
+	_ SizeFile     = (*Memfile)(nil)
+	_ SeekableFile = (*Memfile)(nil)
 )
 
 // NewMemfileReader creates a file from an io.Reader
@@ -129,7 +156,7 @@ func NewMemfileReaderSize(path string, r io.Reader, size int64) *Memfile {
 func NewMemfileBytes(path string, data []byte) *Memfile {
 	return &Memfile{
 		size:    int64(len(data)),
-		buf:     bytes.NewBuffer(data),
+		buf:     bytes.NewReader(data),
 		path:    path,
 		modTime: time.Now(),
 	}
@@ -140,6 +167,15 @@ func (m Memfile) Read(p []byte) (int, error) {
 	return m.buf.Read(p)
 }
 
+// Seek implements the io.Seeker interface. Memfiles created from bytes are
+// always seekable, Memfiles created from readers are seekable if the reader is
+func (m Memfile) Seek(offset int64, whence int) (int64, error) {
+	if s, ok := m.buf.(io.Seeker); ok {
+		return s.Seek(offset, whence)
+	}
+	return 0, ErrNotSeekable
+}
+
 // Close closes the file, if the backing reader implements the io.Closer interface
 // it will call close on the backing Reader
 func (m Memfile) Close() error {
@@ -174,9 +210,14 @@ func (Memfile) NextFile() (File, error) {
 	return nil, ErrNotDirectory
 }
 
-// MediaType for a memfile returns a mime type based on file extension
+// MediaType for a memfile sniffs the start of the file, falling back to a
+// mime type based on file extension. Memfiles that can't seek are typed by
+// extension alone, see SniffMediaType
 func (m Memfile) MediaType() string {
-	return mime.TypeByExtension(filepath.Ext(m.path))
+	if s, ok := m.buf.(io.ReadSeeker); ok {
+		return SniffMediaType(m.path, s)
+	}
+	return DetectMediaType(m.path, nil)
 }
 
 // ModTime returns the last-modified time for this file
@@ -184,6 +225,11 @@ func (m Memfile) ModTime() time.Time {
 	return m.modTime
 }
 
+// SetModTime sets the last-modified time for this file
+func (m *Memfile) SetModTime(t time.Time) {
+	m.modTime = t
+}
+
 func (m Memfile) Size() int64 {
 	return m.size
 }
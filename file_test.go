@@ -2,7 +2,11 @@ package qfs
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -71,8 +75,44 @@ func TestSizeFile(t *testing.T) {
 			if c.size != c.file.Size() {
 				t.Errorf("size mismatch. want: %d got: %d ", c.size, c.file.Size())
 			}
+			if got := FileSize(c.file); got != c.size {
+				t.Errorf("FileSize mismatch. want: %d got: %d ", c.size, got)
+			}
 		})
 	}
+
+	if got := FileSize(NewMemdir("/a")); got != -1 {
+		t.Errorf("expected directory to have unknown size, got %d", got)
+	}
+}
+
+func TestSeekableFile(t *testing.T) {
+	var f SeekableFile = NewMemfileBytes("a.txt", []byte("0123456789"))
+	if _, err := f.Seek(-3, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "789" {
+		t.Errorf("read after seek mismatch. want %q, got %q", "789", string(data))
+	}
+
+	f = NewMemfileReader("b.txt", &bytes.Buffer{})
+	if _, err := f.Seek(0, io.SeekStart); !errors.Is(err, ErrNotSeekable) {
+		t.Errorf("expected ErrNotSeekable seeking a buffer, got %v", err)
+	}
+
+	// wrappers preserve seeking
+	ctx, _ := Trace(context.Background())
+	traced := TraceFile(ctx, "mem", NewMemfileBytes("c.txt", []byte("0123456789"))).(SeekableFile)
+	if _, err := traced.Seek(5, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadAll(traced); string(data) != "56789" {
+		t.Errorf("read after seek mismatch. want %q, got %q", "56789", string(data))
+	}
 }
 
 func TestMemdirMakeDirP(t *testing.T) {
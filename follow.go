@@ -0,0 +1,295 @@
+package qfs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// PinManifest is a snapshot of a leader's pinset. Leaders publish manifests
+// either by writing them to a well-known path or announcing them over pubsub.
+// Followers apply manifests in sequence order, ignoring stale ones
+type PinManifest struct {
+	// Seq is a monotonically increasing sequence number set by the leader
+	Seq int64 `json:"seq"`
+	// Published is the time the leader created this manifest
+	Published time.Time `json:"published"`
+	// Pins is the full set of recursively-pinned root paths on the leader
+	Pins []string `json:"pins"`
+}
+
+// PinsetSource delivers pin manifests from a leader
+type PinsetSource interface {
+	// Subscribe emits a manifest each time the leader's pinset is observed.
+	// The returned channel must be closed when ctx is cancelled
+	Subscribe(ctx context.Context) (<-chan PinManifest, error)
+}
+
+// pollingPinsetSource polls a published manifest at a fixed path
+type pollingPinsetSource struct {
+	resolver PathResolver
+	path     string
+	interval time.Duration
+}
+
+// NewPollingPinsetSource creates a PinsetSource that reads a JSON-encoded
+// PinManifest from path on each interval. Any PathResolver works, so leaders
+// can publish manifests over HTTP, a local file, or a shared mutable store
+func NewPollingPinsetSource(resolver PathResolver, path string, interval time.Duration) PinsetSource {
+	return &pollingPinsetSource{
+		resolver: resolver,
+		path:     path,
+		interval: interval,
+	}
+}
+
+// Subscribe implements the PinsetSource interface
+func (s *pollingPinsetSource) Subscribe(ctx context.Context) (<-chan PinManifest, error) {
+	if s.interval <= 0 {
+		return nil, fmt.Errorf("polling interval must be greater than zero")
+	}
+
+	ch := make(chan PinManifest)
+	go func() {
+		defer close(ch)
+		t := time.NewTicker(s.interval)
+		defer t.Stop()
+
+		for {
+			if m, err := s.fetch(ctx); err != nil {
+				log.Debugw("fetching pin manifest", "path", s.path, "err", err)
+			} else {
+				select {
+				case ch <- m:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func (s *pollingPinsetSource) fetch(ctx context.Context) (PinManifest, error) {
+	m := PinManifest{}
+	f, err := s.resolver.Get(ctx, s.path)
+	if err != nil {
+		return m, err
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return m, err
+	}
+	err = json.Unmarshal(data, &m)
+	return m, err
+}
+
+// FollowerStats reports how closely a follower tracks its leader
+type FollowerStats struct {
+	// LeaderSeq is the highest manifest sequence number seen from the leader
+	LeaderSeq int64
+	// AppliedSeq is the sequence number of the last fully-applied manifest
+	AppliedSeq int64
+	// LastSync is the time the last manifest was fully applied
+	LastSync time.Time
+	// Lag is the duration between the leader publishing the last applied
+	// manifest and the follower finishing applying it
+	Lag time.Duration
+	// Pinned is the number of roots the follower currently holds for the leader
+	Pinned int
+	// Pending is the number of pin changes from the latest manifest that have
+	// not yet been applied
+	Pending int
+	// Errors counts failed pin & unpin operations since the follower started
+	Errors int
+}
+
+// Follower keeps the pins of a local store in sync with a leader's pinset,
+// turning the local store into a read-only mirror of the leader. Followers
+// only unpin content they pinned themselves. When the local store implements
+// PinCheckingFS, leader roots that are already pinned are left to whoever
+// pinned them, otherwise the follower pins every root it's sent
+type Follower struct {
+	local PinningFS
+	src   PinsetSource
+
+	// applyLk serializes Apply calls, so lk is only held to read & record
+	// state, never across pins
+	applyLk sync.Mutex
+
+	lk sync.Mutex
+	// pinned holds roots the follower pinned
+	pinned map[string]struct{}
+	// held holds leader roots that were already pinned locally
+	held  map[string]struct{}
+	stats FollowerStats
+}
+
+// NewFollower creates a follower that mirrors pins from src onto local
+func NewFollower(local PinningFS, src PinsetSource) *Follower {
+	return &Follower{
+		local:  local,
+		src:    src,
+		pinned: map[string]struct{}{},
+		held:   map[string]struct{}{},
+	}
+}
+
+// Run subscribes to the leader's pinset and applies manifests as they arrive.
+// Run blocks until ctx is cancelled or the source closes
+func (f *Follower) Run(ctx context.Context) error {
+	// replication is background work unless the caller says otherwise
+	if _, ok := ctx.Value(priorityCtxKey{}).(Priority); !ok {
+		ctx = WithPriority(ctx, PriorityBackground)
+	}
+
+	manifests, err := f.src.Subscribe(ctx)
+	if err != nil {
+		return err
+	}
+
+	for m := range manifests {
+		if err := f.Apply(ctx, m); err != nil {
+			log.Debugw("applying pin manifest", "seq", m.Seq, "err", err)
+		}
+	}
+	return ctx.Err()
+}
+
+// ErrStaleManifest is returned when applying a manifest older than the last
+// applied manifest
+var ErrStaleManifest = errors.New("stale pin manifest")
+
+// Apply brings local pins in line with a single manifest, pinning new roots
+// and unpinning roots the leader has dropped
+func (f *Follower) Apply(ctx context.Context, m PinManifest) error {
+	f.applyLk.Lock()
+	defer f.applyLk.Unlock()
+
+	add, rm, err := f.plan(m)
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	for _, p := range add {
+		held, err := f.alreadyPinned(ctx, p)
+		if err == nil && !held {
+			err = f.local.Pin(ctx, p, true)
+		}
+		f.lk.Lock()
+		switch {
+		case err != nil:
+			f.stats.Errors++
+		case held:
+			f.held[p] = struct{}{}
+			f.stats.Pending--
+		default:
+			f.pinned[p] = struct{}{}
+			f.stats.Pending--
+		}
+		f.lk.Unlock()
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("pinning %q: %w", p, err)
+		}
+	}
+	for _, p := range rm {
+		err := f.local.Unpin(ctx, p, true)
+		f.lk.Lock()
+		if err != nil {
+			f.stats.Errors++
+		} else {
+			delete(f.pinned, p)
+			f.stats.Pending--
+		}
+		f.lk.Unlock()
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("unpinning %q: %w", p, err)
+		}
+	}
+
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	f.stats.Pinned = len(f.pinned) + len(f.held)
+	if firstErr != nil {
+		return firstErr
+	}
+
+	f.stats.AppliedSeq = m.Seq
+	f.stats.LastSync = time.Now()
+	if !m.Published.IsZero() {
+		f.stats.Lag = f.stats.LastSync.Sub(m.Published)
+	}
+	return nil
+}
+
+// plan lists the roots a manifest adds & the roots the follower pinned that
+// it drops. Dropped roots the follower didn't pin are forgotten right away
+func (f *Follower) plan(m PinManifest) (add, rm []string, err error) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+
+	if m.Seq > f.stats.LeaderSeq {
+		f.stats.LeaderSeq = m.Seq
+	}
+	if m.Seq != 0 && m.Seq <= f.stats.AppliedSeq {
+		return nil, nil, ErrStaleManifest
+	}
+
+	want := make(map[string]struct{}, len(m.Pins))
+	for _, p := range m.Pins {
+		want[p] = struct{}{}
+	}
+	for p := range want {
+		_, pinned := f.pinned[p]
+		_, held := f.held[p]
+		if !pinned && !held {
+			add = append(add, p)
+		}
+	}
+	for p := range f.pinned {
+		if _, ok := want[p]; !ok {
+			rm = append(rm, p)
+		}
+	}
+	for p := range f.held {
+		if _, ok := want[p]; !ok {
+			delete(f.held, p)
+		}
+	}
+	f.stats.Pending = len(add) + len(rm)
+	return add, rm, nil
+}
+
+// alreadyPinned reports whether the local store pinned p before the follower
+// did. Stores that can't check pins report false
+func (f *Follower) alreadyPinned(ctx context.Context, p string) (bool, error) {
+	pc, ok := f.local.(PinCheckingFS)
+	if !ok {
+		return false, nil
+	}
+	pinned, err := pc.IsPinned(ctx, p)
+	if errors.Is(err, ErrUnsupported) {
+		return false, nil
+	}
+	return pinned, err
+}
+
+// Stats returns a snapshot of follower sync metrics
+func (f *Follower) Stats() FollowerStats {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	return f.stats
+}
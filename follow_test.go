@@ -0,0 +1,186 @@
+package qfs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type memPinner struct {
+	lk   sync.Mutex
+	pins map[string]struct{}
+}
+
+func newMemPinner() *memPinner {
+	return &memPinner{pins: map[string]struct{}{}}
+}
+
+func (p *memPinner) Pin(ctx context.Context, key string, recursive bool) error {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	p.pins[key] = struct{}{}
+	return nil
+}
+
+func (p *memPinner) Unpin(ctx context.Context, key string, recursive bool) error {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	if _, ok := p.pins[key]; !ok {
+		return errors.New("not pinned")
+	}
+	delete(p.pins, key)
+	return nil
+}
+
+func (p *memPinner) list() []string {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	res := []string{}
+	for k := range p.pins {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+type manifestResolver struct {
+	lk sync.Mutex
+	m  PinManifest
+}
+
+func (r *manifestResolver) set(m PinManifest) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	r.m = m
+}
+
+func (r *manifestResolver) Get(ctx context.Context, path string) (File, error) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	data, err := json.Marshal(r.m)
+	if err != nil {
+		return nil, err
+	}
+	return NewMemfileBytes(path, data), nil
+}
+
+func TestFollowerApply(t *testing.T) {
+	ctx := context.Background()
+	local := newMemPinner()
+	fol := NewFollower(local, nil)
+
+	if err := fol.Apply(ctx, PinManifest{Seq: 1, Pins: []string{"/mem/a", "/mem/b"}}); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"/mem/a", "/mem/b"}, local.list()); diff != "" {
+		t.Errorf("pins mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := fol.Apply(ctx, PinManifest{Seq: 2, Pins: []string{"/mem/b", "/mem/c"}}); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"/mem/b", "/mem/c"}, local.list()); diff != "" {
+		t.Errorf("pins mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := fol.Apply(ctx, PinManifest{Seq: 1, Pins: []string{}}); !errors.Is(err, ErrStaleManifest) {
+		t.Errorf("expected stale manifest error, got: %v", err)
+	}
+
+	// pins the follower didn't create must be left alone
+	local.Pin(ctx, "/mem/mine", true)
+	if err := fol.Apply(ctx, PinManifest{Seq: 3, Pins: []string{}}); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"/mem/mine"}, local.list()); diff != "" {
+		t.Errorf("pins mismatch (-want +got):\n%s", diff)
+	}
+
+	st := fol.Stats()
+	if st.LeaderSeq != 3 || st.AppliedSeq != 3 || st.Pinned != 0 || st.Pending != 0 {
+		t.Errorf("unexpected stats: %#v", st)
+	}
+}
+
+// pinCheckingPinner is a memPinner that reports its pins
+type pinCheckingPinner struct {
+	*memPinner
+}
+
+func (p pinCheckingPinner) IsPinned(ctx context.Context, key string) (bool, error) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	_, ok := p.pins[key]
+	return ok, nil
+}
+
+func TestFollowerLeavesExistingPins(t *testing.T) {
+	ctx := context.Background()
+	local := pinCheckingPinner{newMemPinner()}
+	local.Pin(ctx, "/mem/mine", true)
+	fol := NewFollower(local, nil)
+
+	if err := fol.Apply(ctx, PinManifest{Seq: 1, Pins: []string{"/mem/mine", "/mem/a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if st := fol.Stats(); st.Pinned != 2 || st.Pending != 0 {
+		t.Errorf("unexpected stats: %#v", st)
+	}
+
+	// dropping a root the follower didn't pin leaves the pin in place
+	if err := fol.Apply(ctx, PinManifest{Seq: 2, Pins: []string{}}); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"/mem/mine"}, local.list()); diff != "" {
+		t.Errorf("pins mismatch (-want +got):\n%s", diff)
+	}
+	if st := fol.Stats(); st.Pinned != 0 {
+		t.Errorf("expected no roots to be held. got %#v", st)
+	}
+}
+
+func TestFollowerRunPolling(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	leader := &manifestResolver{}
+	leader.set(PinManifest{Seq: 1, Published: time.Now(), Pins: []string{"/mem/a"}})
+
+	local := newMemPinner()
+	fol := NewFollower(local, NewPollingPinsetSource(leader, "/manifest.json", time.Millisecond*5))
+	errs := make(chan error)
+	go func() { errs <- fol.Run(ctx) }()
+
+	waitForSeq := func(seq int64) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for fol.Stats().AppliedSeq != seq {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for follower to apply seq %d", seq)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	waitForSeq(1)
+	leader.set(PinManifest{Seq: 2, Published: time.Now(), Pins: []string{"/mem/b"}})
+	waitForSeq(2)
+
+	if diff := cmp.Diff([]string{"/mem/b"}, local.list()); diff != "" {
+		t.Errorf("pins mismatch (-want +got):\n%s", diff)
+	}
+	if fol.Stats().Lag <= 0 {
+		t.Errorf("expected positive lag, got %s", fol.Stats().Lag)
+	}
+
+	cancel()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context cancelled error, got: %v", err)
+	}
+}
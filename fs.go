@@ -3,9 +3,11 @@ package qfs
 import (
 	"context"
 	"errors"
+	"io"
 	"path/filepath"
 	"strings"
 
+	"github.com/ipfs/go-cid"
 	logger "github.com/ipfs/go-log"
 )
 
@@ -15,6 +17,14 @@ var (
 	ErrNotFound = errors.New("path not found")
 	// ErrReadOnly is a sentinel value for Filesystems that aren't writable
 	ErrReadOnly = errors.New("readonly filesystem")
+	// ErrNotPinned is returned when unpinning content that isn't pinned
+	ErrNotPinned = errors.New("not pinned")
+	// ErrUnsupported is returned by filesystems for operations they don't
+	// implement
+	ErrUnsupported = errors.New("operation not supported")
+	// ErrTransient wraps errors from failures that may succeed if retried,
+	// like timeouts, rate limiting or a briefly unavailable service
+	ErrTransient = errors.New("transient failure")
 )
 
 // PathResolver is the "get" portion of a Filesystem
@@ -52,6 +62,9 @@ type Filesystem interface {
 type Config struct {
 	Type   string                 `json:"type"`
 	Config map[string]interface{} `json:"config,omitempty"`
+	// Middleware wraps the filesystem, outermost first. The Type of each
+	// entry names a middleware constructor, like ReadOnlyMiddlewareType
+	Middleware []Config `json:"middleware,omitempty"`
 }
 
 // Constructor is a function that creates a filesystem from a config map
@@ -79,10 +92,134 @@ type PinningFS interface {
 	Unpin(ctx context.Context, key string, recursive bool) error
 }
 
+// PinCheckingFS is an optional interface for PinningFS implementations that
+// can report whether a path is pinned in its own right, recursively or
+// directly, without changing any pins
+type PinCheckingFS interface {
+	IsPinned(ctx context.Context, key string) (bool, error)
+}
+
+// NameSystem is an optional interface for filesystems that can publish
+// mutable names, each pointing to content that can change over time
+type NameSystem interface {
+	// Publish points the name controlled by keyName at id, returning the
+	// name as a path. An empty keyName uses the filesystem's default key
+	Publish(ctx context.Context, id cid.Cid, keyName string) (name string, err error)
+	// Resolve returns the content a name currently points to
+	Resolve(ctx context.Context, name string) (cid.Cid, error)
+}
+
+// P2P is an optional interface for filesystems backed by a peer-to-peer
+// node, letting callers manage connections to specific peers, like
+// collaborators known to have content
+type P2P interface {
+	// Peers lists connected peers
+	Peers(ctx context.Context) ([]PeerInfo, error)
+	// ConnectPeer dials a peer at a multiaddr that ends in the peer's ID,
+	// like /ip4/1.2.3.4/tcp/4001/p2p/<peer id>
+	ConnectPeer(ctx context.Context, addr string) error
+	// DisconnectPeer closes every connection to a peer
+	DisconnectPeer(ctx context.Context, peerID string) error
+}
+
+// PeerInfo describes a connected peer
+type PeerInfo struct {
+	// ID is the peer's ID
+	ID string `json:"id"`
+	// Addr is the multiaddr of the connection to the peer
+	Addr string `json:"addr"`
+}
+
+// HasManyFS is an optional interface for filesystems that can check many
+// paths at once more cheaply than calling Has for each path
+type HasManyFS interface {
+	HasMany(ctx context.Context, paths []string) (map[string]bool, error)
+}
+
+// HasMany checks a batch of paths for existence, returning a map with an
+// entry for every path. Filesystems that implement HasManyFS answer in one
+// call, others fall back to calling Has for each path
+func HasMany(ctx context.Context, fs Filesystem, paths []string) (map[string]bool, error) {
+	if hm, ok := fs.(HasManyFS); ok {
+		return hm.HasMany(ctx, paths)
+	}
+	res := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		has, err := fs.Has(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		res[path] = has
+	}
+	return res, nil
+}
+
+type localHasCtxKey struct{}
+
+// WithLocalHas returns a context that asks filesystems to answer Has &
+// HasMany from their own storage only, never fetching from the network or
+// asking replicas & gateways
+func WithLocalHas(ctx context.Context) context.Context {
+	return context.WithValue(ctx, localHasCtxKey{}, true)
+}
+
+// LocalHasFromContext reports whether WithLocalHas is set on ctx
+func LocalHasFromContext(ctx context.Context) bool {
+	local, _ := ctx.Value(localHasCtxKey{}).(bool)
+	return local
+}
+
+// PutManyFS is an optional interface for filesystems that can store a batch
+// of files more cheaply than calling Put for each file
+type PutManyFS interface {
+	PutMany(ctx context.Context, files []File) ([]PutResult, error)
+}
+
+// PutMany stores a batch of files, returning a result for each file in the
+// order given. Filesystems that implement PutManyFS store the batch in one
+// call, others fall back to calling Put for each file. Results only carry a
+// Cid when the filesystem is content-addressed, and a Size of -1 when the
+// file's size isn't known
+func PutMany(ctx context.Context, fs Filesystem, files []File) ([]PutResult, error) {
+	if pm, ok := fs.(PutManyFS); ok {
+		return pm.PutMany(ctx, files)
+	}
+	res := make([]PutResult, len(files))
+	for i, f := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		size := FileSize(f)
+		path, err := fs.Put(ctx, f)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = PutResult{Size: size, Path: path}
+		if _, ok := fs.(CAFS); ok {
+			if id, err := cid.Parse(strings.TrimPrefix(path, "/"+fs.Type()+"/")); err == nil {
+				res[i].Cid = id
+			}
+		}
+	}
+	return res, nil
+}
+
+// CARFS is an optional interface for content-addressed filesystems that can
+// move whole DAGs as CAR (content-addressed archive) streams
+type CARFS interface {
+	// ExportCAR writes the DAG rooted at path to w
+	ExportCAR(ctx context.Context, path string, w io.Writer) error
+	// ImportCAR stores every block in r, pinning the archive's roots &
+	// returning their paths
+	ImportCAR(ctx context.Context, r io.Reader) ([]string, error)
+}
+
 // CAFS stands for "content-addressed filesystem". Filesystem that implement
 // this interface declare that  all paths to persisted content are reference-by
-// -hash.
-// TODO (b5) - write up a spec test suite for CAFS conformance
+// -hash. The spec package holds conformance tests for CAFS implementations
 type CAFS interface {
 	IsContentAddressedFilesystem()
 }
@@ -116,18 +253,35 @@ func AbsPath(path *string) (err error) {
 	return
 }
 
-// PathKind estimates what type of resolver string path is referring to
+// CanonicalPath returns the caller-facing form of a path in a
+// content-addressed filesystem of type fsType: /<fsType>/<key>, followed by
+// any path within key. Bare keys & keys that already carry the prefix give
+// the same result, so stored references never depend on which form a
+// filesystem happened to return
+func CanonicalPath(fsType, path string) string {
+	key := strings.TrimPrefix(path, "/"+fsType+"/")
+	return "/" + fsType + "/" + strings.TrimPrefix(key, "/")
+}
+
+// PathKind estimates what type of resolver string path is referring to.
+// IPNS names are resolved by ipfs filesystems, so /ipns/ paths are "ipfs"
 func PathKind(path string) string {
 	if path == "" {
 		return "none"
 	} else if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
 		return "http"
-	} else if strings.HasPrefix(path, "/ipfs") {
+	} else if strings.HasPrefix(path, "/ipfs") || strings.HasPrefix(path, "/ipns/") {
 		return "ipfs"
 	} else if strings.HasPrefix(path, "/mem") {
 		return "mem"
 	} else if strings.HasPrefix(path, "/map") {
 		return "map"
+	} else if strings.HasPrefix(path, "/tmpfs/") {
+		return "tmpfs"
+	} else if strings.HasPrefix(path, "/gcs/") {
+		return "gcs"
+	} else if strings.HasPrefix(path, "/zip/") {
+		return "zip"
 	}
 	return "local"
 }
@@ -1,6 +1,7 @@
 package qfs
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -56,7 +57,11 @@ func TestPathKind(t *testing.T) {
 		{"/path/to/location", "local"},
 		{"/", "local"},
 		{"/ipfs/Qmfoo", "ipfs"},
+		{"/ipns/example.com/data.json", "ipfs"},
 		{"/mem/Qmfoo", "mem"},
+		{"/tmpfs/bafkfoo", "tmpfs"},
+		{"/gcs/data/a.json", "gcs"},
+		{"/zip/data/a.json", "zip"},
 		{"/map/Qmfoo", "map"},
 	}
 
@@ -67,3 +72,70 @@ func TestPathKind(t *testing.T) {
 		}
 	}
 }
+
+func TestCanonicalPath(t *testing.T) {
+	cases := []struct {
+		fsType, in, out string
+	}{
+		{"ipfs", "QmFoo", "/ipfs/QmFoo"},
+		{"ipfs", "/ipfs/QmFoo", "/ipfs/QmFoo"},
+		{"ipfs", "QmFoo/a/b.json", "/ipfs/QmFoo/a/b.json"},
+		{"ipfs", "/ipfs/QmFoo/a/b.json", "/ipfs/QmFoo/a/b.json"},
+		{"mem", "/QmFoo", "/mem/QmFoo"},
+		{"tmpfs", "bafkFoo", "/tmpfs/bafkFoo"},
+	}
+
+	for i, c := range cases {
+		if got := CanonicalPath(c.fsType, c.in); got != c.out {
+			t.Errorf("case %d: expected: %s, got: %s", i, c.out, got)
+		}
+	}
+}
+
+func TestHasMany(t *testing.T) {
+	ctx := context.Background()
+	fs := NewMemFS()
+	path, err := fs.Put(ctx, NewMemfileBytes("a.txt", []byte("a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := HasMany(ctx, fs, []string{path, "/mem/QmMissing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got[path] || got["/mem/QmMissing"] || len(got) != 2 {
+		t.Errorf("unexpected HasMany result: %v", got)
+	}
+}
+
+func TestLocalHasFromContext(t *testing.T) {
+	ctx := context.Background()
+	if LocalHasFromContext(ctx) {
+		t.Error("expected local has to be unset by default")
+	}
+	if !LocalHasFromContext(WithLocalHas(ctx)) {
+		t.Error("expected WithLocalHas to set local has")
+	}
+}
+
+func TestPutMany(t *testing.T) {
+	ctx := context.Background()
+	fs := NewMemFS()
+	res, err := PutMany(ctx, fs, []File{
+		NewMemfileBytes("a.txt", []byte("a")),
+		NewMemfileBytes("b.txt", []byte("bb")),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || res[1].Size != 2 || !res[1].Cid.Defined() {
+		t.Fatalf("unexpected PutMany result: %#v", res)
+	}
+	if has, _ := fs.Has(ctx, res[1].Path); !has {
+		t.Errorf("expected fs to have put path %q", res[1].Path)
+	}
+	if res[1].Path != "/mem/"+res[1].Cid.String() {
+		t.Errorf("path & cid mismatch. path: %q cid: %s", res[1].Path, res[1].Cid)
+	}
+}
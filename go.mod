@@ -3,8 +3,11 @@ module github.com/qri-io/qfs
 go 1.15
 
 require (
+	bazil.org/fuse v0.0.0-20200117225306-7b5117fecadc
+	github.com/fsnotify/fsnotify v1.4.9
 	github.com/gabriel-vasile/mimetype v1.2.0 // indirect
 	github.com/google/go-cmp v0.5.5
+	github.com/ipfs/go-bitswap v0.3.4
 	github.com/ipfs/go-block-format v0.0.3
 	github.com/ipfs/go-blockservice v0.1.4
 	github.com/ipfs/go-cid v0.0.7
@@ -18,18 +21,27 @@ require (
 	github.com/ipfs/go-ipfs-pinner v0.1.1
 	github.com/ipfs/go-ipfs-posinfo v0.0.1
 	github.com/ipfs/go-ipfs-util v0.0.2
+	github.com/ipfs/go-ipld-cbor v0.0.5
 	github.com/ipfs/go-ipld-format v0.2.0
 	github.com/ipfs/go-log v1.0.5
 	github.com/ipfs/go-merkledag v0.3.2
 	github.com/ipfs/go-mfs v0.1.2
+	github.com/ipfs/go-path v0.0.9
 	github.com/ipfs/go-unixfs v0.2.5
 	github.com/ipfs/interface-go-ipfs-core v0.4.0
+	github.com/ipld/go-car v0.3.1
+	github.com/libp2p/go-libp2p v0.14.3
+	github.com/libp2p/go-libp2p-core v0.8.5
+	github.com/libp2p/go-libp2p-kad-dht v0.12.2
 	github.com/mattn/go-isatty v0.0.12 // indirect
 	github.com/mattn/go-runewidth v0.0.9 // indirect
 	github.com/mitchellh/mapstructure v1.1.2
 	github.com/mr-tron/base58 v1.2.0
+	github.com/multiformats/go-multiaddr v0.3.3
 	github.com/multiformats/go-multihash v0.0.15
+	github.com/opentracing/opentracing-go v1.2.0
 	github.com/otiai10/copy v1.2.0
+	github.com/prometheus/client_golang v1.10.0
 	github.com/qri-io/go-ipfs-http-client v0.0.6-0.20200623125303-7a2eee881baa
 	golang.org/x/sys v0.0.0-20210511113859-b0526f3d8744
 )
@@ -0,0 +1,321 @@
+package qfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// PutHook runs after a put finalizes the root path of written content, for
+// work like registering pins or updating indexes. fs is the wrapped
+// filesystem, so writes a hook makes don't run hooks
+type PutHook func(ctx context.Context, fs Filesystem, path string) error
+
+// DeleteHook runs after content is deleted, cleaning up data derived from
+// the content
+type DeleteHook func(ctx context.Context, fs Filesystem, path string) error
+
+// HookFS wraps a filesystem, running hooks after puts & deletes. Hooks added
+// with OnPut & OnDelete run first, in the order they're added. Hooks added
+// with AddPutHook & AddDeleteHook are named & declare the hooks they
+// require. They run once their requirements finish, & hooks that don't
+// depend on each other run in parallel.
+//
+// When a put hook fails the put is rolled back: the content is deleted &
+// delete hooks run for its path, undoing work done by the put hooks that
+// succeeded. Delete hooks are the inverse of put hooks, so hooks that derive
+// data from content should be registered as a pair
+type HookFS struct {
+	Filesystem
+
+	lk          sync.RWMutex
+	putHooks    []PutHook
+	deleteHooks []DeleteHook
+	namedPuts   []namedHook
+	namedDels   []namedHook
+}
+
+// ErrHookCycle is returned when the requirements of named hooks form a cycle
+var ErrHookCycle = errors.New("hook requirements form a cycle")
+
+var _ Filesystem = (*HookFS)(nil)
+
+// NewHookFS wraps fs in a HookFS with no hooks
+func NewHookFS(fs Filesystem) *HookFS {
+	return &HookFS{Filesystem: fs}
+}
+
+// OnPut adds a hook that runs after each successful put
+func (h *HookFS) OnPut(hook PutHook) {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+	h.putHooks = append(h.putHooks, hook)
+}
+
+// OnDelete adds a hook that runs after each successful delete
+func (h *HookFS) OnDelete(hook DeleteHook) {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+	h.deleteHooks = append(h.deleteHooks, hook)
+}
+
+// AddPutHook adds a named put hook that runs after the hooks it requires.
+// Required hooks may be added later, but must exist by the time content is
+// put. Adding a hook that completes a cycle of requirements fails with
+// ErrHookCycle
+func (h *HookFS) AddPutHook(name string, hook PutHook, requires ...string) error {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+	hooks, err := addNamedHook(h.namedPuts, namedHook{name: name, requires: requires, run: hook})
+	if err != nil {
+		return err
+	}
+	h.namedPuts = hooks
+	return nil
+}
+
+// AddDeleteHook adds a named delete hook that runs after the hooks it
+// requires, like AddPutHook
+func (h *HookFS) AddDeleteHook(name string, hook DeleteHook, requires ...string) error {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+	hooks, err := addNamedHook(h.namedDels, namedHook{name: name, requires: requires, run: hook})
+	if err != nil {
+		return err
+	}
+	h.namedDels = hooks
+	return nil
+}
+
+// Put writes a file & runs put hooks with the returned path. If a hook fails
+// the put is rolled back & the hook's error is returned. Content the wrapped
+// filesystem already held before the put is left in place by a rollback, the
+// way Transaction checks held paths. Nothing is written if a named hook
+// requires a hook that doesn't exist
+func (h *HookFS) Put(ctx context.Context, file File) (string, error) {
+	h.lk.RLock()
+	hooks := h.putHooks
+	levels, err := orderHooks(h.namedPuts, true)
+	h.lk.RUnlock()
+	if err != nil {
+		return "", err
+	}
+
+	want, held, file, err := heldBeforePut(ctx, h.Filesystem, file)
+	if err != nil {
+		return "", err
+	}
+	path, err := h.Filesystem.Put(ctx, file)
+	if err != nil {
+		return "", err
+	}
+
+	for _, hook := range hooks {
+		if err = hook(ctx, h.Filesystem, path); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = runHookLevels(ctx, h.Filesystem, path, levels, true)
+	}
+	if err != nil {
+		if held && path == want {
+			log.Debugw("keeping held path after failed put hook", "path", path)
+		} else if rbErr := h.Delete(ctx, path); rbErr != nil {
+			log.Errorf("rolling back put of %q: %s", path, rbErr)
+		}
+		return "", fmt.Errorf("put hook for %q: %w", path, err)
+	}
+	return path, nil
+}
+
+// Delete removes content & runs delete hooks. Hooks don't run if the delete
+// fails. Every hook runs even if an earlier hook fails, except named hooks
+// that require a hook that failed. The first hook error is returned
+func (h *HookFS) Delete(ctx context.Context, path string) error {
+	h.lk.RLock()
+	hooks := h.deleteHooks
+	levels, err := orderHooks(h.namedDels, true)
+	h.lk.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if err := h.Filesystem.Delete(ctx, path); err != nil {
+		return err
+	}
+
+	var firstErr error
+	for _, hook := range hooks {
+		if err := hook(ctx, h.Filesystem, path); err != nil {
+			log.Debugw("delete hook", "path", path, "err", err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("delete hook for %q: %w", path, err)
+			}
+		}
+	}
+	if err := runHookLevels(ctx, h.Filesystem, path, levels, false); err != nil && firstErr == nil {
+		firstErr = fmt.Errorf("delete hook for %q: %w", path, err)
+	}
+	return firstErr
+}
+
+// namedHook is a hook added with AddPutHook or AddDeleteHook
+type namedHook struct {
+	name     string
+	requires []string
+	run      func(ctx context.Context, fs Filesystem, path string) error
+}
+
+// addNamedHook appends hook to hooks, checking its name is unique & its
+// requirements don't complete a cycle
+func addNamedHook(hooks []namedHook, hook namedHook) ([]namedHook, error) {
+	if hook.name == "" {
+		return nil, fmt.Errorf("hook name is required")
+	}
+	for _, hk := range hooks {
+		if hk.name == hook.name {
+			return nil, fmt.Errorf("a hook named %q already exists", hook.name)
+		}
+	}
+	added := append(hooks[:len(hooks):len(hooks)], hook)
+	if _, err := orderHooks(added, false); err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+// orderHooks sorts hooks into levels, each hook in a later level than every
+// hook it requires, so the hooks of a level can run in parallel. When strict
+// is false requirements of hooks that don't exist yet are ignored
+func orderHooks(hooks []namedHook, strict bool) ([][]namedHook, error) {
+	byName := make(map[string]namedHook, len(hooks))
+	for _, hk := range hooks {
+		byName[hk.name] = hk
+	}
+	for _, hk := range hooks {
+		for _, req := range hk.requires {
+			if _, ok := byName[req]; !ok && strict {
+				return nil, fmt.Errorf("hook %q requires unknown hook %q", hk.name, req)
+			}
+		}
+	}
+
+	placed := map[string]bool{}
+	var levels [][]namedHook
+	remaining := hooks
+	for len(remaining) > 0 {
+		var level, next []namedHook
+		for _, hk := range remaining {
+			ready := true
+			for _, req := range hk.requires {
+				if _, ok := byName[req]; ok && !placed[req] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				level = append(level, hk)
+			} else {
+				next = append(next, hk)
+			}
+		}
+		if len(level) == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrHookCycle, strings.Join(hookCycle(next, byName), " -> "))
+		}
+		for _, hk := range level {
+			placed[hk.name] = true
+		}
+		levels = append(levels, level)
+		remaining = next
+	}
+	return levels, nil
+}
+
+// hookCycle returns the names along a requirement cycle among hooks, which
+// must contain one, starting & ending with the same name
+func hookCycle(hooks []namedHook, byName map[string]namedHook) []string {
+	onPath := map[string]int{}
+	done := map[string]bool{}
+	var path []string
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		if i, ok := onPath[name]; ok {
+			return append(append([]string{}, path[i:]...), name)
+		}
+		if done[name] {
+			return nil
+		}
+		onPath[name] = len(path)
+		path = append(path, name)
+		for _, req := range byName[name].requires {
+			if _, ok := byName[req]; !ok {
+				continue
+			}
+			if cycle := visit(req); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		delete(onPath, name)
+		done[name] = true
+		return nil
+	}
+	for _, hk := range hooks {
+		if cycle := visit(hk.name); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// runHookLevels runs the hooks of each level in parallel. Hooks that require
+// a hook that failed are skipped. When stopOnErr is true no further levels
+// start after a failure. The first error is returned
+func runHookLevels(ctx context.Context, fs Filesystem, path string, levels [][]namedHook, stopOnErr bool) error {
+	failed := map[string]bool{}
+	var firstErr error
+	for _, level := range levels {
+		errs := make([]error, len(level))
+		var wg sync.WaitGroup
+		for i, hk := range level {
+			skip := false
+			for _, req := range hk.requires {
+				skip = skip || failed[req]
+			}
+			if skip {
+				errs[i] = errSkippedHook
+				continue
+			}
+			wg.Add(1)
+			go func(i int, hk namedHook) {
+				defer wg.Done()
+				errs[i] = hk.run(ctx, fs, path)
+			}(i, hk)
+		}
+		wg.Wait()
+
+		for i, err := range errs {
+			if err == nil {
+				continue
+			}
+			failed[level[i].name] = true
+			if err == errSkippedHook {
+				continue
+			}
+			log.Debugw("named hook", "hook", level[i].name, "path", path, "err", err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", level[i].name, err)
+			}
+		}
+		if firstErr != nil && stopOnErr {
+			break
+		}
+	}
+	return firstErr
+}
+
+// errSkippedHook marks hooks skipped because a requirement failed
+var errSkippedHook = errors.New("required hook failed")
@@ -0,0 +1,193 @@
+package qfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHookFS(t *testing.T) {
+	ctx := context.Background()
+	fs := NewHookFS(NewMemFS())
+
+	var calls []string
+	indexed := map[string]bool{}
+	fs.OnPut(func(ctx context.Context, _ Filesystem, path string) error {
+		calls = append(calls, "index "+path)
+		indexed[path] = true
+		return nil
+	})
+	fs.OnDelete(func(ctx context.Context, _ Filesystem, path string) error {
+		calls = append(calls, "unindex "+path)
+		delete(indexed, path)
+		return nil
+	})
+
+	path, err := fs.Put(ctx, NewMemfileBytes("/a.txt", []byte("a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !indexed[path] {
+		t.Errorf("expected put hook to index %q", path)
+	}
+	if err := fs.Delete(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"index " + path, "unindex " + path}
+	if !reflect.DeepEqual(calls, expect) {
+		t.Errorf("unexpected hook calls. want: %v, got: %v", expect, calls)
+	}
+
+	// a failing put hook rolls the put back, running delete hooks to undo the
+	// hooks that succeeded
+	errBoom := errors.New("boom")
+	fs.OnPut(func(ctx context.Context, _ Filesystem, path string) error { return errBoom })
+	if _, err := fs.Put(ctx, NewMemfileBytes("/b.txt", []byte("b"))); !errors.Is(err, errBoom) {
+		t.Fatalf("expected put hook error. got: %v", err)
+	}
+	if len(indexed) != 0 {
+		t.Errorf("expected rollback to unindex content. got: %v", indexed)
+	}
+	if n := fs.Filesystem.(*MemFS).ObjectCount(); n != 0 {
+		t.Errorf("expected rollback to delete content. got %d objects", n)
+	}
+
+	// content that existed before the put survives a failed hook, without
+	// running delete hooks
+	mem := NewMemFS()
+	existing, err := mem.Put(ctx, NewMemfileBytes("/c.txt", []byte("c")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	held := NewHookFS(mem)
+	calls = nil
+	held.OnPut(func(ctx context.Context, _ Filesystem, path string) error { return errBoom })
+	held.OnDelete(func(ctx context.Context, _ Filesystem, path string) error {
+		calls = append(calls, "unindex "+path)
+		return nil
+	})
+	if _, err := held.Put(ctx, NewMemfileBytes("/again.txt", []byte("c"))); !errors.Is(err, errBoom) {
+		t.Fatalf("expected put hook error. got: %v", err)
+	}
+	if has, _ := mem.Has(ctx, existing); !has {
+		t.Errorf("expected failed put hook to keep existing content %q", existing)
+	}
+	if len(calls) != 0 {
+		t.Errorf("expected delete hooks not to run for held content. got: %v", calls)
+	}
+
+	// delete hooks don't run when the delete fails
+	calls = nil
+	faulty := NewHookFS(InjectFaults(NewMemFS(), FailNth(FaultOpDelete, 1, errBoom)))
+	faulty.OnDelete(func(ctx context.Context, _ Filesystem, path string) error {
+		calls = append(calls, "unindex "+path)
+		return nil
+	})
+	if err := faulty.Delete(ctx, "/mem/QmFoo"); !errors.Is(err, errBoom) {
+		t.Errorf("expected delete error. got: %v", err)
+	}
+	if len(calls) != 0 {
+		t.Errorf("expected delete hooks not to run. got: %v", calls)
+	}
+}
+
+func TestHookFSNamedHooks(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemFS()
+	fs := NewHookFS(mem)
+
+	var lk sync.Mutex
+	var calls []string
+	record := func(name string) {
+		lk.Lock()
+		defer lk.Unlock()
+		calls = append(calls, name)
+	}
+	// pin & stats don't depend on each other, so each waits for the other to
+	// start
+	started := map[string]chan struct{}{"pin": make(chan struct{}), "stats": make(chan struct{})}
+	meet := func(name, other string) PutHook {
+		return func(ctx context.Context, _ Filesystem, path string) error {
+			close(started[name])
+			select {
+			case <-time.After(time.Second):
+				return fmt.Errorf("%s expected to run in parallel", name)
+			case <-started[other]:
+			}
+			record(name)
+			return nil
+		}
+	}
+	indexErr := error(nil)
+	hooks := []struct {
+		name     string
+		hook     PutHook
+		requires []string
+	}{
+		{"notify", func(ctx context.Context, _ Filesystem, path string) error { record("notify"); return nil }, []string{"index", "pin"}},
+		{"index", func(ctx context.Context, _ Filesystem, path string) error { record("index"); return indexErr }, []string{"pin"}},
+		{"pin", meet("pin", "stats"), nil},
+		{"stats", meet("stats", "pin"), nil},
+	}
+	for _, h := range hooks {
+		if err := fs.AddPutHook(h.name, h.hook, h.requires...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var deleted []string
+	if err := fs.AddDeleteHook("unindex", func(ctx context.Context, _ Filesystem, path string) error {
+		deleted = append(deleted, path)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fs.Put(ctx, NewMemfileBytes("a.txt", []byte("a"))); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 4 || calls[2] != "index" || calls[3] != "notify" {
+		t.Errorf("expected pin & stats, then index, then notify. got: %v", calls)
+	}
+
+	calls = nil
+	started["pin"], started["stats"] = make(chan struct{}), make(chan struct{})
+	indexErr = errors.New("index full")
+	path, err := fs.Put(ctx, NewMemfileBytes("b.txt", []byte("b")))
+	if !errors.Is(err, indexErr) {
+		t.Fatalf("expected index error. got: %v", err)
+	}
+	if path != "" || len(deleted) != 1 {
+		t.Errorf("expected failed put to be rolled back with delete hooks. got path %q, deleted %v", path, deleted)
+	}
+	for _, c := range calls {
+		if c == "notify" {
+			t.Error("expected hook requiring a failed hook not to run")
+		}
+	}
+
+	if err := fs.AddPutHook("pin", nil); err == nil {
+		t.Error("expected duplicate hook name to fail")
+	}
+	if err := fs.AddPutHook("a", nil, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Put(ctx, NewMemfileBytes("c.txt", []byte("c"))); err == nil {
+		t.Error("expected put with an unknown hook requirement to fail")
+	}
+	if len(mem.Files) != 1 {
+		t.Errorf("expected nothing to be written with invalid hooks. got %d files", len(mem.Files))
+	}
+	err = fs.AddPutHook("b", nil, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fs.AddPutHook("c", nil, "a")
+	if !errors.Is(err, ErrHookCycle) || !strings.Contains(err.Error(), "a -> b -> c -> a") {
+		t.Errorf("expected a cycle error naming the cycle. got: %v", err)
+	}
+}
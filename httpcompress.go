@@ -0,0 +1,220 @@
+package qfs
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// DefaultUncompressibleMediaTypes lists media types that are already
+// compressed, so compressing them again in transfer only costs CPU. Entries
+// ending in "/" match every subtype
+var DefaultUncompressibleMediaTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zip",
+	"application/zstd",
+	"application/x-bzip2",
+	"application/x-xz",
+	"application/x-7z-compressed",
+	"application/vnd.apache.parquet",
+}
+
+// mediaTypeMatches reports whether mediaType is in types
+func mediaTypeMatches(types []string, mediaType string) bool {
+	mediaType = strings.TrimSpace(strings.Split(mediaType, ";")[0])
+	if mediaType == "" {
+		return false
+	}
+	for _, t := range types {
+		if t == mediaType || (strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// CompressingTransport is an http.RoundTripper that asks servers for gzipped
+// responses & transparently decompresses them. Requests for paths whose
+// extension maps to an uncompressible media type ask for the identity
+// encoding instead
+type CompressingTransport struct {
+	// Base performs requests, defaults to http.DefaultTransport
+	Base http.RoundTripper
+	// UncompressibleMediaTypes are never requested compressed, defaults to
+	// DefaultUncompressibleMediaTypes when nil
+	UncompressibleMediaTypes []string
+}
+
+var _ http.RoundTripper = (*CompressingTransport)(nil)
+
+// RoundTrip implements the http.RoundTripper interface
+func (t *CompressingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	// callers that negotiate their own encoding or ask for byte ranges get
+	// exactly what they asked for
+	if req.Header.Get("Accept-Encoding") != "" || req.Header.Get("Range") != "" {
+		return base.RoundTrip(req)
+	}
+
+	skip := t.UncompressibleMediaTypes
+	if skip == nil {
+		skip = DefaultUncompressibleMediaTypes
+	}
+	req = req.Clone(req.Context())
+	if mediaTypeMatches(skip, mime.TypeByExtension(path.Ext(req.URL.Path))) {
+		req.Header.Set("Accept-Encoding", "identity")
+		return base.RoundTrip(req)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	res, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(res.Header.Get("Content-Encoding"), "gzip") || req.Method == http.MethodHead {
+		return res, nil
+	}
+
+	gz, err := gzip.NewReader(res.Body)
+	if err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	res.Body = &gzipBody{gz: gz, body: res.Body}
+	res.Header.Del("Content-Encoding")
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+	res.Uncompressed = true
+	return res, nil
+}
+
+// gzipBody decompresses a response body, closing both on Close
+type gzipBody struct {
+	gz   *gzip.Reader
+	body io.ReadCloser
+}
+
+func (b *gzipBody) Read(p []byte) (int, error) { return b.gz.Read(p) }
+
+func (b *gzipBody) Close() error {
+	b.gz.Close()
+	return b.body.Close()
+}
+
+// CompressHandler wraps h, gzipping responses for clients that accept gzip
+// unless the response's media type is in uncompressible. A nil uncompressible
+// list uses DefaultUncompressibleMediaTypes
+func CompressHandler(h http.Handler, uncompressible []string) http.Handler {
+	if uncompressible == nil {
+		uncompressible = DefaultUncompressibleMediaTypes
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) || r.Method == http.MethodHead || r.Header.Get("Range") != "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipResponseWriter{ResponseWriter: w, skip: uncompressible}
+		defer gw.close()
+		h.ServeHTTP(gw, r)
+	})
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		parts := strings.Split(enc, ";")
+		if strings.TrimSpace(parts[0]) != "gzip" {
+			continue
+		}
+		for _, param := range parts[1:] {
+			if q := strings.TrimSpace(param); q == "q=0" || q == "q=0.0" {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter decides whether to compress when the response header is
+// written, based on the media type the handler set
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	skip        []string
+	wroteHeader bool
+	gz          *gzip.Writer
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	h := w.Header()
+	compress := status != http.StatusNoContent &&
+		status != http.StatusNotModified &&
+		h.Get("Content-Encoding") == "" &&
+		!mediaTypeMatches(w.skip, h.Get("Content-Type"))
+	if compress {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *gzipResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush sends buffered compressed data to the client, so streaming responses
+// keep streaming
+func (w *gzipResponseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack passes through to the underlying writer
+func (w *gzipResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+func (w *gzipResponseWriter) close() {
+	if w.gz != nil {
+		if err := w.gz.Close(); err != nil {
+			log.Debugw("closing gzip response", "err", err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package qfs
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressedTransfer(t *testing.T) {
+	body := strings.Repeat("a,b,c\n", 1000)
+	var gotEncoding string
+	s := httptest.NewServer(CompressHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotEncoding = r.Header.Get("Accept-Encoding")
+		if strings.HasSuffix(r.URL.Path, ".png") {
+			w.Header().Set("Content-Type", "image/png")
+		} else {
+			w.Header().Set("Content-Type", "text/csv")
+		}
+		w.Write([]byte(body))
+	}), nil))
+	defer s.Close()
+
+	// a plain client sees the gzip encoding on the wire
+	plain := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	req, _ := http.NewRequest("GET", s.URL+"/body.csv", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	res, err := plain.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.Header.Get("Content-Encoding") != "gzip" {
+		t.Errorf("expected server to gzip csv. got encoding: %q", res.Header.Get("Content-Encoding"))
+	}
+
+	cli := &http.Client{Transport: &CompressingTransport{}}
+	res, err = cli.Get(s.URL + "/body.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotEncoding != "gzip" {
+		t.Errorf("expected client to request gzip. got: %q", gotEncoding)
+	}
+	if string(data) != body || !res.Uncompressed {
+		t.Errorf("expected transparently decompressed body")
+	}
+
+	// already-compressed media types skip compression both ways
+	res, err = cli.Get(s.URL + "/image.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if gotEncoding != "identity" {
+		t.Errorf("expected client to request identity encoding for png. got: %q", gotEncoding)
+	}
+	req, _ = http.NewRequest("GET", s.URL+"/image.png", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	if res, err = plain.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.Header.Get("Content-Encoding") != "" {
+		t.Errorf("expected server not to compress png. got encoding: %q", res.Header.Get("Content-Encoding"))
+	}
+}
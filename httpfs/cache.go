@@ -0,0 +1,111 @@
+package httpfs
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// DefaultCacheSize is the number of response body bytes kept for
+// conditional requests when no cache size is configured
+const DefaultCacheSize = 8 << 20
+
+// etagCache keeps the bodies of responses that carry an ETag, so a later
+// request for the same URL can ask the server whether the body changed with
+// If-None-Match. The least recently used responses are evicted once bodies
+// exceed the cache's size
+type etagCache struct {
+	lk      sync.Mutex
+	size    int64
+	used    int64
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+// cachedResponse is a response body stored with the headers it came with
+type cachedResponse struct {
+	url    string
+	etag   string
+	header http.Header
+	body   []byte
+}
+
+func newETagCache(size int64) *etagCache {
+	return &etagCache{size: size, lru: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (c *etagCache) get(url string) *cachedResponse {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	el, ok := c.entries[url]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	return el.Value.(*cachedResponse)
+}
+
+func (c *etagCache) put(cr *cachedResponse) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	if int64(len(cr.body)) > c.size {
+		return
+	}
+	if el, ok := c.entries[cr.url]; ok {
+		c.remove(el)
+	}
+	c.entries[cr.url] = c.lru.PushFront(cr)
+	c.used += int64(len(cr.body))
+	for c.used > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *etagCache) remove(el *list.Element) {
+	cr := c.lru.Remove(el).(*cachedResponse)
+	delete(c.entries, cr.url)
+	c.used -= int64(len(cr.body))
+}
+
+// response rebuilds a response from the cached body
+func (cr *cachedResponse) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Header:        cr.header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(cr.body)),
+		ContentLength: int64(len(cr.body)),
+		Request:       req,
+	}
+}
+
+// cachingBody copies a response body as it's read, caching the copy once
+// the body is read to the end. Bodies that outgrow the cache aren't kept
+type cachingBody struct {
+	io.ReadCloser
+	cache *etagCache
+	cr    *cachedResponse
+	buf   bytes.Buffer
+	full  bool
+}
+
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if !b.full {
+		if int64(b.buf.Len()+n) > b.cache.size {
+			b.full = true
+			b.buf = bytes.Buffer{}
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF && !b.full {
+		b.cr.body = b.buf.Bytes()
+		b.cache.put(b.cr)
+		b.full = true
+	}
+	return n, err
+}
@@ -2,20 +2,62 @@ package httpfs
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"strings"
 	"time"
 
+	logging "github.com/ipfs/go-log"
 	"github.com/mitchellh/mapstructure"
 	"github.com/qri-io/qfs"
 )
 
+var log = logging.Logger("httpfs")
+
 // FSConfig adjusts the behaviour of an FS instance
 type FSConfig struct {
 	Client *http.Client // client to use to make requests
+	// DisableCompression turns off requesting gzipped responses
+	DisableCompression bool
+	// UncompressibleMediaTypes are fetched without compression. defaults to
+	// qfs.DefaultUncompressibleMediaTypes
+	UncompressibleMediaTypes []string
+	// Hosts lists the hosts BearerToken, basic auth & Headers are sent to, as
+	// "host" or "host:port". Requests for other hosts, including redirects,
+	// are sent without them. Hosts is required when any of them are set
+	Hosts []string
+	// BearerToken is sent as "Authorization: Bearer <token>" with requests
+	// for Hosts
+	BearerToken string
+	// Username & Password authenticate requests for Hosts with HTTP basic
+	// auth when BearerToken is empty
+	Username string
+	Password string
+	// Headers are set on requests for Hosts. Authentication settings &
+	// headers added to the request context with WithHeaders take precedence
+	Headers map[string]string
+	// Retries is the number of times a request that fails with a network
+	// error, 429 or 5xx status is retried
+	Retries int
+	// Backoff is the delay before the first retry, doubling each attempt.
+	// defaults to DefaultBackoff
+	Backoff time.Duration
+	// CacheSize is the number of response body bytes kept to revalidate with
+	// If-None-Match, so unchanged files aren't downloaded again. defaults to
+	// DefaultCacheSize
+	CacheSize int64
+	// DisableCache turns off conditional requests
+	DisableCache bool
 }
 
+// DefaultBackoff is the delay before the first retry of a failed request
+// when no backoff is configured
+const DefaultBackoff = 500 * time.Millisecond
+
 // Option is a function type for passing to NewFS
 type Option func(cfg *FSConfig)
 
@@ -34,6 +76,32 @@ func DefaultFSConfig() *FSConfig {
 	}
 }
 
+// ErrUnauthorized is returned when a server refuses a request for lack of
+// valid credentials
+var ErrUnauthorized = errors.New("httpfs: unauthorized")
+
+type headersCtxKey struct{}
+
+// WithHeaders returns a context that adds headers to requests made with it,
+// on top of any headers already in ctx. Context headers go to any host a
+// request is made for, but aren't sent on redirects to another host
+func WithHeaders(ctx context.Context, h http.Header) context.Context {
+	merged := HeadersFromContext(ctx).Clone()
+	if merged == nil {
+		merged = http.Header{}
+	}
+	for k, vs := range h {
+		merged[http.CanonicalHeaderKey(k)] = append([]string(nil), vs...)
+	}
+	return context.WithValue(ctx, headersCtxKey{}, merged)
+}
+
+// HeadersFromContext returns the headers set with WithHeaders, if any
+func HeadersFromContext(ctx context.Context) http.Header {
+	h, _ := ctx.Value(headersCtxKey{}).(http.Header)
+	return h
+}
+
 // if no cfgmap is given, return the default config
 func mapToConfig(cfgMap map[string]interface{}) (*FSConfig, error) {
 	if cfgMap == nil {
@@ -54,10 +122,15 @@ func NewFilesystem(_ context.Context, cfgMap map[string]interface{}) (qfs.Filesy
 // FS is a implementation of qfs.PathResolver that uses the local filesystem
 type FS struct {
 	cfg *FSConfig
+	// cache is nil when caching is disabled
+	cache *etagCache
 }
 
 // compile-time assertion that MapStore satisfies the Filesystem interface
-var _ qfs.Filesystem = (*FS)(nil)
+var (
+	_ qfs.Filesystem   = (*FS)(nil)
+	_ qfs.DescribingFS = (*FS)(nil)
+)
 
 // NewFS creates a new local filesytem PathResolver
 func NewFS(cfgMap map[string]interface{}, opts ...Option) (qfs.Filesystem, error) {
@@ -69,8 +142,35 @@ func NewFS(cfgMap map[string]interface{}, opts ...Option) (qfs.Filesystem, error
 	for _, opt := range opts {
 		opt(cfg)
 	}
+	if len(cfg.Hosts) == 0 && (cfg.BearerToken != "" || cfg.Username != "" || cfg.Password != "" || len(cfg.Headers) > 0) {
+		return nil, fmt.Errorf("httpfs: credentials & headers need hosts to be sent to")
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	cli := *cfg.Client
+	cli.CheckRedirect = cfg.checkRedirect(cfg.Client.CheckRedirect)
+	cfg.Client = &cli
+	if !cfg.DisableCompression {
+		cli := *cfg.Client
+		cli.Transport = &qfs.CompressingTransport{
+			Base:                     cli.Transport,
+			UncompressibleMediaTypes: cfg.UncompressibleMediaTypes,
+		}
+		cfg.Client = &cli
+	}
 
-	return &FS{cfg: cfg}, nil
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = DefaultBackoff
+	}
+	fs := &FS{cfg: cfg}
+	if !cfg.DisableCache {
+		if cfg.CacheSize <= 0 {
+			cfg.CacheSize = DefaultCacheSize
+		}
+		fs.cache = newETagCache(cfg.CacheSize)
+	}
+	return fs, nil
 }
 
 // FilestoreType uniquely identifies this filestore
@@ -81,32 +181,172 @@ func (httpfs *FS) Type() string {
 	return FilestoreType
 }
 
+// Describe reports http filesystems as online & read-only
+func (httpfs *FS) Describe() qfs.Descriptor {
+	return qfs.Descriptor{Type: FilestoreType, Features: qfs.FeatureOnline}
+}
+
 // Has returns whether the store has a File with the key
 // https has no caching strategy, so it'll always return false
 func (https *FS) Has(ctx context.Context, path string) (bool, error) {
 	return false, nil
 }
 
-// Get implements qfs.PathResolver
+// Get implements qfs.PathResolver. Requests that fail with a network error,
+// 429 or 5xx status are retried with exponential backoff. Responses with an
+// ETag are cached, & later requests for the same URL are answered from the
+// cache when the server responds 304 Not Modified
 func (httpfs *FS) Get(ctx context.Context, path string) (qfs.File, error) {
-	req, err := http.NewRequest("GET", path, nil)
+	resp, err := httpfs.request(ctx, path, "")
 	if err != nil {
 		return nil, err
 	}
+	return &HTTPResFile{
+		path: path,
+		res:  resp,
+		fs:   httpfs,
+		ctx:  ctx,
+		size: resp.ContentLength,
+	}, nil
+}
+
+// request gets path, retrying failures worth retrying. A non-empty rng is
+// sent as the Range header
+func (httpfs *FS) request(ctx context.Context, path, rng string) (*http.Response, error) {
+	backoff := httpfs.cfg.Backoff
+	for attempt := 0; ; attempt++ {
+		resp, retry, err := httpfs.get(ctx, path, rng)
+		if err == nil {
+			return resp, nil
+		}
+		if !retry || attempt >= httpfs.cfg.Retries {
+			return nil, err
+		}
+		log.Debugw("retrying request", "url", path, "attempt", attempt+1, "err", err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// get makes a single request, reporting whether a failure is worth retrying.
+// Range requests skip the cache
+func (httpfs *FS) get(ctx context.Context, path, rng string) (resp *http.Response, retry bool, err error) {
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		return nil, false, err
+	}
 	req = req.WithContext(ctx)
-	resp, err := httpfs.cfg.Client.Do(req)
+	httpfs.setHeaders(req)
+	var cached *cachedResponse
+	if rng != "" {
+		req.Header.Set("Range", rng)
+	} else if httpfs.cache != nil {
+		if cached = httpfs.cache.get(path); cached != nil {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+	}
+
+	resp, err = httpfs.cfg.Client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, ctx.Err() == nil, err
 	}
 
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, qfs.ErrNotFound
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		resp.Body.Close()
+		return cached.response(req), false, nil
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, false, qfs.ErrNotFound
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		resp.Body.Close()
+		return nil, false, fmt.Errorf("%w: %s %s", ErrUnauthorized, resp.Status, path)
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		resp.Body.Close()
+		return nil, true, fmt.Errorf("%w: httpfs: %s responded with %s", qfs.ErrTransient, path, resp.Status)
+	case rng != "" && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		resp.Body.Close()
+		return nil, false, errRangeNotSatisfiable
+	case rng != "" && resp.StatusCode != http.StatusPartialContent:
+		resp.Body.Close()
+		return nil, false, fmt.Errorf("%w: %s doesn't support range requests", qfs.ErrNotSeekable, path)
 	}
 
-	return &HTTPResFile{
-		path: path,
-		res:  resp,
-	}, nil
+	if etag := resp.Header.Get("ETag"); etag != "" && httpfs.cache != nil && resp.StatusCode == http.StatusOK {
+		resp.Body = &cachingBody{
+			ReadCloser: resp.Body,
+			cache:      httpfs.cache,
+			cr:         &cachedResponse{url: path, etag: etag, header: resp.Header.Clone()},
+		}
+	}
+	return resp, false, nil
+}
+
+// setHeaders applies configured headers, then credentials, then headers
+// from the request context. Configured headers & credentials are only set
+// for Hosts
+func (httpfs *FS) setHeaders(req *http.Request) {
+	httpfs.cfg.setScopedHeaders(req)
+	for k, vs := range HeadersFromContext(req.Context()) {
+		req.Header[k] = append([]string(nil), vs...)
+	}
+}
+
+// setScopedHeaders sets configured headers & credentials on requests for
+// Hosts
+func (cfg *FSConfig) setScopedHeaders(req *http.Request) {
+	if !cfg.scoped(req.URL) {
+		return
+	}
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	if cfg.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.BearerToken)
+	} else if cfg.Username != "" || cfg.Password != "" {
+		req.SetBasicAuth(cfg.Username, cfg.Password)
+	}
+}
+
+// scoped reports whether u is for one of Hosts
+func (cfg *FSConfig) scoped(u *url.URL) bool {
+	for _, h := range cfg.Hosts {
+		if strings.EqualFold(h, u.Host) || strings.EqualFold(h, u.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRedirect wraps a client's redirect policy. The client copies headers
+// from the original request to redirects, so redirects to another host drop
+// configured headers, credentials & context headers, getting configured
+// headers & credentials back if the host is one of Hosts
+func (cfg *FSConfig) checkRedirect(next func(*http.Request, []*http.Request) error) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if !strings.EqualFold(req.URL.Host, via[0].URL.Host) {
+			req.Header.Del("Authorization")
+			for k := range cfg.Headers {
+				req.Header.Del(k)
+			}
+			for k := range HeadersFromContext(req.Context()) {
+				req.Header.Del(k)
+			}
+			cfg.setScopedHeaders(req)
+		}
+		if next != nil {
+			return next(req, via)
+		}
+		// http.Client's default policy
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
 }
 
 // Put places a file or directory on the filesystem, returning the root path.
@@ -120,17 +360,34 @@ func (httpfs *FS) Delete(ctx context.Context, path string) (err error) {
 	return qfs.ErrReadOnly
 }
 
-// HTTPResFile implements qfs.File with a filesystem file
+// HTTPResFile implements qfs.File with a filesystem file. Files from servers
+// that support range requests can seek & read at offsets without reading
+// the whole body
 type HTTPResFile struct {
 	res  *http.Response
 	path string
+
+	// fs & ctx make range requests
+	fs  *FS
+	ctx context.Context
+	// offset is the position of the next Read, size is the length of the
+	// file or -1 when it's unknown
+	offset int64
+	size   int64
 }
 
-var _ qfs.File = (*HTTPResFile)(nil)
+var (
+	_ qfs.File         = (*HTTPResFile)(nil)
+	_ qfs.SizeFile     = (*HTTPResFile)(nil)
+	_ qfs.SeekableFile = (*HTTPResFile)(nil)
+	_ io.ReaderAt      = (*HTTPResFile)(nil)
+)
 
 // Read proxies to the response body reader
 func (rf *HTTPResFile) Read(p []byte) (int, error) {
-	return rf.res.Body.Read(p)
+	n, err := rf.res.Body.Read(p)
+	rf.offset += int64(n)
+	return n, err
 }
 
 // Close proxies to the response body reader
@@ -138,6 +395,13 @@ func (rf *HTTPResFile) Close() error {
 	return rf.res.Body.Close()
 }
 
+// Size gives the response Content-Length, which is -1 when the server doesn't
+// send one. Compressed responses are decoded transparently, so their length
+// is unknown until a range request reports it
+func (rf *HTTPResFile) Size() int64 {
+	return rf.size
+}
+
 // IsDirectory satisfies the qfs.File interface
 func (rf *HTTPResFile) IsDirectory() bool {
 	return false
@@ -0,0 +1,303 @@
+package httpfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/qri-io/qfs"
+)
+
+func TestAuthAndHeaders(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		if r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("secret"))
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	anon, err := NewFS(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := anon.Get(ctx, srv.URL); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized, got %v", err)
+	}
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	fs, err := NewFS(map[string]interface{}{
+		"hosts":       []string{host},
+		"bearerToken": "token",
+		"headers":     map[string]string{"X-Team": "data", "Authorization": "overridden"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.Get(ctx, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "secret" {
+		t.Errorf("expected body %q, got %q", "secret", data)
+	}
+	if got.Get("Authorization") != "Bearer token" || got.Get("X-Team") != "data" {
+		t.Errorf("unexpected request headers: %v", got)
+	}
+
+	basic, err := NewFS(map[string]interface{}{"hosts": []string{host}, "username": "user", "password": "pass"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx = WithHeaders(ctx, http.Header{"X-Request": {"1"}})
+	ctx = WithHeaders(ctx, http.Header{"x-trace": {"abc"}})
+	f, err = basic.Get(ctx, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if user, pass, ok := (&http.Request{Header: got}).BasicAuth(); !ok || user != "user" || pass != "pass" {
+		t.Errorf("expected basic auth user:pass, got %q:%q", user, pass)
+	}
+	if got.Get("X-Request") != "1" || got.Get("X-Trace") != "abc" {
+		t.Errorf("expected context headers on the request, got %v", got)
+	}
+
+	if _, err := NewFS(map[string]interface{}{"bearerToken": "token"}); err == nil {
+		t.Error("expected credentials without hosts to be rejected")
+	}
+}
+
+func TestCredentialsScopedToHosts(t *testing.T) {
+	var (
+		lk      sync.Mutex
+		offsite http.Header
+	)
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lk.Lock()
+		offsite = r.Header.Clone()
+		lk.Unlock()
+		w.Write([]byte("offsite"))
+	}))
+	defer other.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, other.URL, http.StatusFound)
+	}))
+	defer srv.Close()
+
+	ctx := WithHeaders(context.Background(), http.Header{"X-Request": {"1"}})
+	fs, err := NewFS(map[string]interface{}{
+		"hosts":       []string{strings.TrimPrefix(srv.URL, "http://")},
+		"bearerToken": "token",
+		"headers":     map[string]string{"X-Team": "data"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, u := range []string{srv.URL, other.URL} {
+		f, err := fs.Get(ctx, u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		lk.Lock()
+		if offsite.Get("Authorization") != "" || offsite.Get("X-Team") != "" {
+			t.Errorf("expected no credentials or configured headers for %s, got %v", u, offsite)
+		}
+		lk.Unlock()
+	}
+	if offsite.Get("X-Request") != "1" {
+		t.Errorf("expected context headers on requests made for another host, got %v", offsite)
+	}
+
+	// context headers aren't forwarded on a redirect to another host
+	f, err := fs.Get(ctx, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	lk.Lock()
+	defer lk.Unlock()
+	if offsite.Get("X-Request") != "" {
+		t.Errorf("expected context headers to be dropped on a cross-host redirect, got %v", offsite)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	fs, err := NewFS(map[string]interface{}{"retries": 1, "backoff": time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Get(ctx, srv.URL); !errors.Is(err, qfs.ErrTransient) {
+		t.Fatalf("expected get to fail with qfs.ErrTransient after exhausting retries. got: %v", err)
+	}
+
+	atomic.StoreInt32(&requests, 0)
+	fs, err = NewFS(map[string]interface{}{"retries": 2, "backoff": time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.Get(ctx, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if data, _ := ioutil.ReadAll(f); string(data) != "ok" {
+		t.Errorf("expected body %q, got %q", "ok", data)
+	}
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Errorf("expected 3 requests, got %d", n)
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	var full, notModified int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		atomic.AddInt32(&full, 1)
+		w.Header().Set("Content-Type", "text/csv")
+		w.Write([]byte("a,b,c"))
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	fs, err := NewFS(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		f, err := fs.Get(ctx, srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "a,b,c" {
+			t.Errorf("get %d: expected body %q, got %q", i, "a,b,c", data)
+		}
+		if f.MediaType() != "text/csv" {
+			t.Errorf("get %d: expected media type text/csv, got %q", i, f.MediaType())
+		}
+	}
+	if f, nm := atomic.LoadInt32(&full), atomic.LoadInt32(&notModified); f != 1 || nm != 2 {
+		t.Errorf("expected 1 full response & 2 revalidations, got %d & %d", f, nm)
+	}
+
+	uncached, err := NewFS(map[string]interface{}{"disableCache": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		f, err := uncached.Get(ctx, srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(f)
+		f.Close()
+	}
+	if f := atomic.LoadInt32(&full); f != 3 {
+		t.Errorf("expected uncached gets to download the full body, got %d full responses", f)
+	}
+}
+
+func TestRangeRequests(t *testing.T) {
+	content := "name,count\nalpha,1\nbravo,2\ncharlie,3\n"
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "data.csv", time.Time{}, strings.NewReader(content))
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	fs, err := NewFS(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.Get(ctx, srv.URL+"/data.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rf := f.(*HTTPResFile)
+
+	buf := make([]byte, 5)
+	if n, err := rf.ReadAt(buf, 11); err != nil || string(buf[:n]) != "alpha" {
+		t.Errorf("expected ReadAt to read %q, got %q, %v", "alpha", buf[:n], err)
+	}
+	buf = make([]byte, 10)
+	if n, err := rf.ReadAt(buf, int64(len(content)-4)); err != io.EOF || string(buf[:n]) != "e,3\n" {
+		t.Errorf("expected a short ReadAt at the end to return io.EOF, got %q, %v", buf[:n], err)
+	}
+
+	pos, err := rf.Seek(-8, io.SeekEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos != int64(len(content)-8) {
+		t.Errorf("expected position %d, got %d", len(content)-8, pos)
+	}
+	rest, err := ioutil.ReadAll(rf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rest) != "arlie,3\n" {
+		t.Errorf("expected tail %q, got %q", "arlie,3\n", rest)
+	}
+	if rf.Size() != int64(len(content)) {
+		t.Errorf("expected size %d, got %d", len(content), rf.Size())
+	}
+	if ranges[0] != "" || ranges[1] != "bytes=11-15" {
+		t.Errorf("unexpected range headers: %q", ranges)
+	}
+
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(content))
+	}))
+	defer plain.Close()
+	f, err = fs.Get(ctx, plain.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.(*HTTPResFile).ReadAt(buf, 4); !errors.Is(err, qfs.ErrNotSeekable) {
+		t.Errorf("expected ErrNotSeekable from a server without range support, got %v", err)
+	}
+}
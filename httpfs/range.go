@@ -0,0 +1,115 @@
+package httpfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/qri-io/qfs"
+)
+
+// errRangeNotSatisfiable is returned for range requests that start past the
+// end of a file
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// ReadAt reads len(p) bytes at off with a range request, leaving the
+// position of Read unchanged. Files on servers that don't support range
+// requests return an error matching qfs.ErrNotSeekable
+func (rf *HTTPResFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("httpfs: negative offset %d", off)
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	resp, err := rf.fs.request(rf.ctx, rf.path, fmt.Sprintf("bytes=%d-%d", off, off+int64(len(p))-1))
+	if errors.Is(err, errRangeNotSatisfiable) {
+		return 0, io.EOF
+	} else if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	rf.setSize(resp)
+
+	n, err := io.ReadFull(resp.Body, p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Seek moves the position of Read, requesting the rest of the file from the
+// new position with a range request
+func (rf *HTTPResFile) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = rf.offset + offset
+	case io.SeekEnd:
+		size, err := rf.totalSize()
+		if err != nil {
+			return 0, err
+		}
+		abs = size + offset
+	default:
+		return 0, fmt.Errorf("httpfs: invalid whence %d", whence)
+	}
+	if abs < 0 {
+		return 0, fmt.Errorf("httpfs: negative position %d", abs)
+	}
+	if abs == rf.offset {
+		return abs, nil
+	}
+
+	resp, err := rf.fs.request(rf.ctx, rf.path, fmt.Sprintf("bytes=%d-", abs))
+	if errors.Is(err, errRangeNotSatisfiable) {
+		// reads past the end of the file return io.EOF
+		resp = &http.Response{Body: http.NoBody}
+	} else if err != nil {
+		return rf.offset, err
+	}
+	rf.setSize(resp)
+	rf.res.Body.Close()
+	rf.res.Body = resp.Body
+	rf.offset = abs
+	return abs, nil
+}
+
+// totalSize returns the size of the file, asking the server for it with a
+// one byte range request when it's unknown
+func (rf *HTTPResFile) totalSize() (int64, error) {
+	if rf.size >= 0 {
+		return rf.size, nil
+	}
+	resp, err := rf.fs.request(rf.ctx, rf.path, "bytes=0-0")
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	rf.setSize(resp)
+	if rf.size < 0 {
+		return 0, fmt.Errorf("%w: size of %s is unknown", qfs.ErrNotSeekable, rf.path)
+	}
+	return rf.size, nil
+}
+
+// setSize records the file size from the Content-Range of a range response
+func (rf *HTTPResFile) setSize(resp *http.Response) {
+	if rf.size >= 0 || resp.Header == nil {
+		return
+	}
+	// Content-Range: bytes <first>-<last>/<size>
+	cr := resp.Header.Get("Content-Range")
+	i := strings.LastIndexByte(cr, '/')
+	if i < 0 {
+		return
+	}
+	if size, err := strconv.ParseInt(cr[i+1:], 10, 64); err == nil {
+		rf.size = size
+	}
+}
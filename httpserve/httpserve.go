@@ -0,0 +1,249 @@
+// Package httpserve serves a qfs.Filesystem over HTTP. Request paths are
+// filesystem paths: GET & HEAD read files & list directories, PUT writes the
+// request body, and DELETE removes a path. Files that can seek, or whose size
+// is known, are served with range request support
+package httpserve
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path/filepath"
+
+	logging "github.com/ipfs/go-log"
+	"github.com/qri-io/qfs"
+)
+
+var log = logging.Logger("httpserve")
+
+// Config adjusts the behaviour of a Handler
+type Config struct {
+	// ReadOnly rejects PUT & DELETE requests
+	ReadOnly bool
+}
+
+// Option is a function type for passing to NewHandler
+type Option func(cfg *Config)
+
+// OptionReadOnly rejects requests that would modify the filesystem
+func OptionReadOnly() Option {
+	return func(cfg *Config) {
+		cfg.ReadOnly = true
+	}
+}
+
+// Handler serves a filesystem over HTTP
+type Handler struct {
+	fs  qfs.Filesystem
+	cfg Config
+}
+
+var _ http.Handler = (*Handler)(nil)
+
+// NewHandler creates a handler serving fs
+func NewHandler(fs qfs.Filesystem, opts ...Option) *Handler {
+	h := &Handler{fs: fs}
+	for _, opt := range opts {
+		opt(&h.cfg)
+	}
+	return h
+}
+
+// DirEntry is an entry in a JSON directory listing
+type DirEntry struct {
+	Name  string `json:"name"`
+	Size  int64  `json:"size"`
+	Cid   string `json:"cid,omitempty"`
+	IsDir bool   `json:"isDir,omitempty"`
+}
+
+// ServeHTTP implements the http.Handler interface
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		h.get(w, r)
+	case http.MethodPut, http.MethodDelete:
+		if h.cfg.ReadOnly {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "filesystem is read-only", http.StatusMethodNotAllowed)
+			return
+		}
+		if r.Method == http.MethodPut {
+			h.put(w, r)
+		} else {
+			h.delete(w, r)
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		http.Error(w, fmt.Sprintf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	f, err := h.fs.Get(r.Context(), r.URL.Path)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer f.Close()
+
+	if f.IsDirectory() {
+		h.list(w, r)
+		return
+	}
+
+	mediaType := f.MediaType()
+	if mediaType == "" {
+		mediaType = mime.TypeByExtension(filepath.Ext(r.URL.Path))
+	}
+	if mediaType != "" {
+		w.Header().Set("Content-Type", mediaType)
+	}
+
+	if content, ok := readSeeker(f); ok {
+		if _, fwd := content.(*forwardSeeker); fwd && mediaType == "" {
+			// sniffing the content type would need to seek back to the start
+			w.Header().Set("Content-Type", "application/octet-stream")
+		}
+		// ServeContent handles ranges, conditional requests, HEAD & sniffing
+		// the content type when none is set
+		http.ServeContent(w, r, f.FileName(), f.ModTime(), content)
+		return
+	}
+
+	// without a size, ranges can't be served. stream the whole file
+	w.Header().Set("Accept-Ranges", "none")
+	if !f.ModTime().IsZero() {
+		w.Header().Set("Last-Modified", f.ModTime().UTC().Format(http.TimeFormat))
+	}
+	br := bufio.NewReader(f)
+	if mediaType == "" {
+		peek, _ := br.Peek(512)
+		w.Header().Set("Content-Type", http.DetectContentType(peek))
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := io.Copy(w, br); err != nil {
+		log.Debugw("streaming file", "path", r.URL.Path, "err", err)
+	}
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	entries, err := qfs.ReadDir(r.Context(), h.fs, r.URL.Path)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	listing := make([]DirEntry, len(entries))
+	for i, e := range entries {
+		listing[i] = DirEntry{Name: e.Name, Size: e.Size, IsDir: e.IsDir}
+		if e.Cid.Defined() {
+			listing[i].Cid = e.Cid.String()
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := json.NewEncoder(w).Encode(listing); err != nil {
+		log.Debugw("writing listing", "path", r.URL.Path, "err", err)
+	}
+}
+
+func (h *Handler) put(w http.ResponseWriter, r *http.Request) {
+	file := qfs.NewMemfileReaderSize(r.URL.Path, r.Body, r.ContentLength)
+	path, err := h.fs.Put(r.Context(), file)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Location", path)
+	w.WriteHeader(http.StatusCreated)
+	io.WriteString(w, path)
+}
+
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request) {
+	if err := h.fs.Delete(r.Context(), r.URL.Path); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeError maps filesystem errors to status codes
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, qfs.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, qfs.ErrReadOnly):
+		status = http.StatusForbidden
+	case errors.Is(err, qfs.ErrNotDirectory), errors.Is(err, qfs.ErrNotFile):
+		status = http.StatusBadRequest
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// readSeeker adapts a file for http.ServeContent. Seekable files are used
+// directly. Files of known size that can't seek can still serve a single
+// range by skipping forward
+func readSeeker(f qfs.File) (io.ReadSeeker, bool) {
+	if sf, ok := f.(qfs.SeekableFile); ok {
+		if _, err := sf.Seek(0, io.SeekCurrent); err == nil {
+			return sf, true
+		}
+	}
+	if size := qfs.FileSize(f); size >= 0 {
+		return &forwardSeeker{r: f, size: size}, true
+	}
+	return nil, false
+}
+
+// forwardSeeker answers seeks on a reader of known size, skipping forward to
+// the seek position on read. Seeking behind data that's been read fails
+type forwardSeeker struct {
+	r    io.Reader
+	size int64
+	// pos is the seek position, off the position of r
+	pos, off int64
+}
+
+func (s *forwardSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		offset += s.size
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative seek position %d", offset)
+	}
+	s.pos = offset
+	return offset, nil
+}
+
+func (s *forwardSeeker) Read(p []byte) (int, error) {
+	if s.pos < s.off {
+		return 0, fmt.Errorf("%w: cannot seek backwards", qfs.ErrNotSeekable)
+	}
+	if s.pos > s.off {
+		n, err := io.CopyN(ioutil.Discard, s.r, s.pos-s.off)
+		s.off += n
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := s.r.Read(p)
+	s.off += int64(n)
+	s.pos = s.off
+	return n, err
+}
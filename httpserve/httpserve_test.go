@@ -0,0 +1,141 @@
+package httpserve
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/qri-io/qfs"
+)
+
+func TestHandler(t *testing.T) {
+	s := httptest.NewServer(NewHandler(qfs.NewMemFS()))
+	defer s.Close()
+
+	res := do(t, http.MethodPut, s.URL+"/hello.txt", "hello world", nil)
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("put: expected %d, got %d", http.StatusCreated, res.StatusCode)
+	}
+	path := res.Header.Get("Location")
+	if !strings.HasPrefix(path, "/mem/") {
+		t.Fatalf("expected a /mem/ location, got %q", path)
+	}
+
+	res = do(t, http.MethodGet, s.URL+path, "", nil)
+	if body := readBody(t, res); res.StatusCode != http.StatusOK || body != "hello world" {
+		t.Errorf("get: unexpected response %d %q", res.StatusCode, body)
+	}
+	if ct := res.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("expected sniffed text content type, got %q", ct)
+	}
+
+	res = do(t, http.MethodGet, s.URL+path, "", map[string]string{"Range": "bytes=6-"})
+	if body := readBody(t, res); res.StatusCode != http.StatusPartialContent || body != "world" {
+		t.Errorf("range: unexpected response %d %q", res.StatusCode, body)
+	}
+
+	res = do(t, http.MethodHead, s.URL+path, "", nil)
+	if body := readBody(t, res); res.StatusCode != http.StatusOK || body != "" || res.ContentLength != 11 {
+		t.Errorf("head: unexpected response %d %q length %d", res.StatusCode, body, res.ContentLength)
+	}
+
+	res = do(t, http.MethodDelete, s.URL+path, "", nil)
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("delete: expected %d, got %d", http.StatusNoContent, res.StatusCode)
+	}
+	res = do(t, http.MethodGet, s.URL+path, "", nil)
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("get deleted: expected %d, got %d", http.StatusNotFound, res.StatusCode)
+	}
+
+	res = do(t, http.MethodPost, s.URL+path, "", nil)
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("post: expected %d, got %d", http.StatusMethodNotAllowed, res.StatusCode)
+	}
+}
+
+func TestHandlerDirectory(t *testing.T) {
+	fs := qfs.NewMemFS()
+	dir, err := fs.Put(context.Background(), qfs.NewMemdir("/",
+		qfs.NewMemfileBytes("a.json", []byte(`{}`)),
+		qfs.NewMemdir("b"),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := httptest.NewServer(NewHandler(fs, OptionReadOnly()))
+	defer s.Close()
+
+	res := do(t, http.MethodGet, s.URL+dir, "", nil)
+	listing := []DirEntry{}
+	if err := json.NewDecoder(res.Body).Decode(&listing); err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if len(listing) != 2 || listing[0].Name != "a.json" || listing[0].Size != 2 || !listing[1].IsDir {
+		t.Errorf("unexpected listing: %#v", listing)
+	}
+
+	res = do(t, http.MethodGet, s.URL+dir+"/a.json", "", nil)
+	if ct := res.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected content type by extension, got %q", ct)
+	}
+	res.Body.Close()
+
+	res = do(t, http.MethodPut, s.URL+"/c.txt", "data", nil)
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("read-only put: expected %d, got %d", http.StatusMethodNotAllowed, res.StatusCode)
+	}
+}
+
+func TestForwardSeeker(t *testing.T) {
+	// a reader of known size that can't seek
+	f := qfs.NewMemfileReaderSize("data", ioutil.NopCloser(strings.NewReader("0123456789")), 10)
+	rs, ok := readSeeker(f)
+	if !ok {
+		t.Fatal("expected a file of known size to be servable")
+	}
+	req := httptest.NewRequest(http.MethodGet, "/data", nil)
+	req.Header.Set("Range", "bytes=4-6")
+	w := httptest.NewRecorder()
+	// sniffing would read past the range, handlers set a type first
+	w.Header().Set("Content-Type", "text/plain")
+	http.ServeContent(w, req, "data", f.ModTime(), rs)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "456" {
+		t.Errorf("unexpected response %d %q", w.Code, w.Body.String())
+	}
+
+	if _, ok := readSeeker(qfs.NewMemfileReader("data", ioutil.NopCloser(strings.NewReader("")))); ok {
+		t.Error("expected a file of unknown size not to be seekable")
+	}
+}
+
+func do(t *testing.T, method, url, body string, headers map[string]string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func readBody(t *testing.T, res *http.Response) string {
+	t.Helper()
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
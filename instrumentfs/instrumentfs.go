@@ -0,0 +1,225 @@
+// Package instrumentfs wraps a filesystem with prometheus metrics. Every
+// operation is counted & timed, errors are counted, and bytes read from &
+// written to the filesystem are tallied, all labelled by filesystem type:
+//
+//	m, err := instrumentfs.NewMetrics(prometheus.DefaultRegisterer)
+//	...
+//	ipfs := m.Wrap(ipfsFS)
+//	local := m.Wrap(localFS)
+//
+// Filesystems wrapped by the same Metrics share collectors, so one registry
+// can report on every backend of a Mux
+package instrumentfs
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/qri-io/qfs"
+)
+
+// Namespace prefixes every metric name
+const Namespace = "qfs"
+
+// byte count directions
+const (
+	dirRead    = "read"
+	dirWritten = "written"
+)
+
+// Metrics holds the collectors recording filesystem activity
+type Metrics struct {
+	ops      *prometheus.CounterVec
+	errs     *prometheus.CounterVec
+	bytes    *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// NewMetrics creates filesystem collectors & registers them with reg
+func NewMetrics(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		ops: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "operations_total",
+			Help:      "Filesystem operations performed, by filesystem type & operation.",
+		}, []string{"fs", "op"}),
+		errs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "operation_errors_total",
+			Help:      "Filesystem operations that returned an error, by filesystem type & operation.",
+		}, []string{"fs", "op"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "bytes_total",
+			Help:      "Bytes read from & written to filesystems, by filesystem type & direction.",
+		}, []string{"fs", "direction"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "operation_duration_seconds",
+			Help:      "Filesystem operation latency, by filesystem type & operation.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"fs", "op"}),
+	}
+	for _, c := range []prometheus.Collector{m.ops, m.errs, m.bytes, m.duration} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Wrap instruments fs with these metrics
+func (m *Metrics) Wrap(fs qfs.Filesystem) *FS {
+	return &FS{fs: fs, m: m}
+}
+
+// Middleware is Wrap as qfs.Middleware, for use with qfs.Chain
+func (m *Metrics) Middleware(fs qfs.Filesystem) qfs.Filesystem {
+	return m.Wrap(fs)
+}
+
+// FS records metrics for a wrapped filesystem. An FS has the same type as the
+// filesystem it wraps, so it can stand in for it in a Mux
+type FS struct {
+	fs qfs.Filesystem
+	m  *Metrics
+}
+
+var (
+	_ qfs.Filesystem   = (*FS)(nil)
+	_ qfs.DescribingFS = (*FS)(nil)
+	_ qfs.Unwrapper    = (*FS)(nil)
+	_ qfs.HasManyFS    = (*FS)(nil)
+	_ qfs.StatFS       = (*FS)(nil)
+	_ qfs.ReadDirFS    = (*FS)(nil)
+)
+
+// New registers metrics with reg & wraps fs with them. Use NewMetrics & Wrap
+// to instrument more than one filesystem with the same registry
+func New(fs qfs.Filesystem, reg prometheus.Registerer) (*FS, error) {
+	m, err := NewMetrics(reg)
+	if err != nil {
+		return nil, err
+	}
+	return m.Wrap(fs), nil
+}
+
+// Type returns the type of the wrapped filesystem
+func (f *FS) Type() string { return f.fs.Type() }
+
+// Describe returns the wrapped filesystem's descriptor
+func (f *FS) Describe() qfs.Descriptor { return qfs.Describe(f.fs) }
+
+// Unwrap returns the wrapped filesystem, so its other capabilities can be
+// found with qfs.As
+func (f *FS) Unwrap() qfs.Filesystem { return f.fs }
+
+// observe records an operation that started at start
+func (f *FS) observe(op string, start time.Time, err error) {
+	fsType := f.fs.Type()
+	f.m.ops.WithLabelValues(fsType, op).Inc()
+	f.m.duration.WithLabelValues(fsType, op).Observe(time.Since(start).Seconds())
+	if err != nil {
+		f.m.errs.WithLabelValues(fsType, op).Inc()
+	}
+}
+
+// Has checks for a path on the wrapped filesystem
+func (f *FS) Has(ctx context.Context, path string) (bool, error) {
+	start := time.Now()
+	has, err := f.fs.Has(ctx, path)
+	f.observe("has", start, err)
+	return has, err
+}
+
+// Get fetches a file from the wrapped filesystem. Latency measures opening
+// the file, bytes are counted as the file is read
+func (f *FS) Get(ctx context.Context, path string) (qfs.File, error) {
+	start := time.Now()
+	file, err := f.fs.Get(ctx, path)
+	f.observe("get", start, err)
+	if err != nil {
+		return nil, err
+	}
+	return f.countFile(file, dirRead), nil
+}
+
+// Put writes a file to the wrapped filesystem, counting the bytes it reads
+// from file
+func (f *FS) Put(ctx context.Context, file qfs.File) (string, error) {
+	start := time.Now()
+	path, err := f.fs.Put(ctx, f.countFile(file, dirWritten))
+	f.observe("put", start, err)
+	return path, err
+}
+
+// Delete removes a path from the wrapped filesystem
+func (f *FS) Delete(ctx context.Context, path string) error {
+	start := time.Now()
+	err := f.fs.Delete(ctx, path)
+	f.observe("delete", start, err)
+	return err
+}
+
+// HasMany checks a batch of paths on the wrapped filesystem
+func (f *FS) HasMany(ctx context.Context, paths []string) (map[string]bool, error) {
+	start := time.Now()
+	res, err := qfs.HasMany(ctx, f.fs, paths)
+	f.observe("hasmany", start, err)
+	return res, err
+}
+
+// Stat describes a path on the wrapped filesystem
+func (f *FS) Stat(ctx context.Context, path string) (os.FileInfo, error) {
+	start := time.Now()
+	fi, err := qfs.Stat(ctx, f.fs, path)
+	f.observe("stat", start, err)
+	return fi, err
+}
+
+// ReadDir lists a directory of the wrapped filesystem
+func (f *FS) ReadDir(ctx context.Context, path string) ([]qfs.DirEntry, error) {
+	start := time.Now()
+	entries, err := qfs.ReadDir(ctx, f.fs, path)
+	f.observe("readdir", start, err)
+	return entries, err
+}
+
+func (f *FS) countFile(file qfs.File, direction string) qfs.File {
+	return &countingFile{File: file, c: f.m.bytes.WithLabelValues(f.fs.Type(), direction)}
+}
+
+// countingFile adds bytes read from a file to a counter. Files in a directory
+// are counted as they're iterated
+type countingFile struct {
+	qfs.File
+	c prometheus.Counter
+}
+
+func (f *countingFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	f.c.Add(float64(n))
+	return n, err
+}
+
+func (f *countingFile) NextFile() (qfs.File, error) {
+	next, err := f.File.NextFile()
+	if err != nil {
+		return next, err
+	}
+	return &countingFile{File: next, c: f.c}, nil
+}
+
+// Seek seeks the underlying file
+func (f *countingFile) Seek(offset int64, whence int) (int64, error) {
+	if s, ok := f.File.(io.Seeker); ok {
+		return s.Seek(offset, whence)
+	}
+	return 0, qfs.ErrNotSeekable
+}
+
+// Size returns the size of the underlying file
+func (f *countingFile) Size() int64 { return qfs.FileSize(f.File) }
@@ -0,0 +1,59 @@
+package instrumentfs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/qri-io/qfs"
+)
+
+func TestFS(t *testing.T) {
+	ctx := context.Background()
+	reg := prometheus.NewRegistry()
+	fs, err := New(qfs.NewMemFS(), reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := fs.Put(ctx, qfs.NewMemfileBytes("a.txt", []byte("hello world")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.Get(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(f); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Get(ctx, "/mem/missing"); !errors.Is(err, qfs.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got: %v", err)
+	}
+
+	m := fs.m
+	expect := map[string]float64{
+		"put ops":       testutil.ToFloat64(m.ops.WithLabelValues("mem", "put")),
+		"get ops":       testutil.ToFloat64(m.ops.WithLabelValues("mem", "get")),
+		"get errors":    testutil.ToFloat64(m.errs.WithLabelValues("mem", "get")),
+		"bytes read":    testutil.ToFloat64(m.bytes.WithLabelValues("mem", dirRead)),
+		"bytes written": testutil.ToFloat64(m.bytes.WithLabelValues("mem", dirWritten)),
+	}
+	want := map[string]float64{"put ops": 1, "get ops": 2, "get errors": 1, "bytes read": 11, "bytes written": 11}
+	for k, v := range want {
+		if expect[k] != v {
+			t.Errorf("%s: expected %v, got %v", k, v, expect[k])
+		}
+	}
+
+	if n, err := testutil.GatherAndCount(reg, "qfs_operation_duration_seconds"); err != nil || n != 2 {
+		t.Errorf("expected latency histograms for get & put, got %d (err: %v)", n, err)
+	}
+
+	if _, err := New(qfs.NewMemFS(), reg); err == nil {
+		t.Error("expected registering metrics twice to fail")
+	}
+}
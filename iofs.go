@@ -0,0 +1,322 @@
+package qfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"path"
+	"strings"
+	"time"
+)
+
+// IOFSType is the Type() of filesystems created with FromIOFS
+const IOFSType = "iofs"
+
+// ToIOFS adapts a filesystem to the standard library's fs.FS interface, so
+// qfs filesystems work with tools like fs.WalkDir, template.ParseFS &
+// http.FS. Names are resolved relative to root, which is typically a
+// directory path like /ipfs/<cid>. fs.FS methods don't take a context, so
+// operations run with context.Background().
+//
+// Errors matching ErrNotFound match fs.ErrNotExist, & ErrReadOnly matches
+// fs.ErrPermission. File sizes that aren't known are reported as 0
+func ToIOFS(fsys Filesystem, root string) fs.FS {
+	return &toIOFS{fsys: fsys, root: root}
+}
+
+type toIOFS struct {
+	fsys Filesystem
+	root string
+}
+
+var _ fs.FS = (*toIOFS)(nil)
+
+// Open implements the fs.FS interface
+func (t *toIOFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	p := t.root
+	if name != "." {
+		p = path.Join(t.root, name)
+	}
+	f, err := t.fsys.Get(context.Background(), p)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: ioFSError(err)}
+	}
+	return &ioFile{f: f, name: name, info: newIOFileInfo(path.Base(name), f)}, nil
+}
+
+// ioFSError converts qfs sentinel errors to their io/fs equivalents
+func ioFSError(err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return fs.ErrNotExist
+	case errors.Is(err, ErrReadOnly):
+		return fs.ErrPermission
+	}
+	return err
+}
+
+// ioFile is a qfs File as an fs.File. Directories implement
+// fs.ReadDirFile by reading their children with NextFile
+type ioFile struct {
+	f    File
+	name string
+	info *ioFileInfo
+}
+
+var (
+	_ fs.ReadDirFile = (*ioFile)(nil)
+	_ io.Seeker      = (*ioFile)(nil)
+)
+
+func (f *ioFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *ioFile) Read(p []byte) (int, error) { return f.f.Read(p) }
+func (f *ioFile) Close() error               { return f.f.Close() }
+
+// Seek seeks files that implement io.Seeker, returning ErrNotSeekable for
+// others
+func (f *ioFile) Seek(offset int64, whence int) (int64, error) {
+	return seekFile(f.f, offset, whence)
+}
+
+// ReadDir implements the fs.ReadDirFile interface
+func (f *ioFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !f.f.IsDirectory() {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: ErrNotDirectory}
+	}
+	entries := []fs.DirEntry{}
+	for n <= 0 || len(entries) < n {
+		child, err := f.f.NextFile()
+		if errors.Is(err, io.EOF) {
+			if n > 0 && len(entries) == 0 {
+				return nil, io.EOF
+			}
+			break
+		} else if err != nil {
+			return entries, &fs.PathError{Op: "readdir", Path: f.name, Err: err}
+		}
+		entries = append(entries, newIOFileInfo(child.FileName(), child))
+		child.Close()
+	}
+	return entries, nil
+}
+
+// ioFileInfo describes a qfs File as both an fs.FileInfo & an fs.DirEntry
+type ioFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+var (
+	_ fs.FileInfo = (*ioFileInfo)(nil)
+	_ fs.DirEntry = (*ioFileInfo)(nil)
+)
+
+func newIOFileInfo(name string, f File) *ioFileInfo {
+	size := FileSize(f)
+	if size < 0 {
+		size = 0
+	}
+	return &ioFileInfo{name: name, size: size, modTime: f.ModTime(), dir: f.IsDirectory()}
+}
+
+func (i *ioFileInfo) Name() string               { return i.name }
+func (i *ioFileInfo) Size() int64                { return i.size }
+func (i *ioFileInfo) ModTime() time.Time         { return i.modTime }
+func (i *ioFileInfo) IsDir() bool                { return i.dir }
+func (i *ioFileInfo) Sys() interface{}           { return nil }
+func (i *ioFileInfo) Type() fs.FileMode          { return i.Mode().Type() }
+func (i *ioFileInfo) Info() (fs.FileInfo, error) { return i, nil }
+
+// Mode reports files as read-only, qfs has no notion of permissions
+func (i *ioFileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// FromIOFS adapts a standard library fs.FS to a read-only Filesystem. Paths
+// are slash-separated names in fsys, with or without a leading slash. The
+// returned Filesystem implements ReadDirFS
+func FromIOFS(fsys fs.FS) Filesystem {
+	return &fromIOFS{fsys: fsys}
+}
+
+type fromIOFS struct {
+	fsys fs.FS
+}
+
+var (
+	_ Filesystem   = (*fromIOFS)(nil)
+	_ ReadDirFS    = (*fromIOFS)(nil)
+	_ DescribingFS = (*fromIOFS)(nil)
+)
+
+// ioFSName converts a qfs path to a name in an fs.FS
+func ioFSName(p string) string {
+	name := strings.TrimPrefix(path.Clean("/"+p), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// qfsError converts io/fs errors to qfs sentinel errors
+func qfsError(err error, p string) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrNotFound, p)
+	}
+	return err
+}
+
+// Type distinguishes this filesystem from others by a unique string prefix
+func (f *fromIOFS) Type() string { return IOFSType }
+
+// Describe reports io/fs filesystems as read-only
+func (f *fromIOFS) Describe() Descriptor { return Descriptor{Type: IOFSType} }
+
+// Has returns whether a file or directory exists at path
+func (f *fromIOFS) Has(ctx context.Context, p string) (bool, error) {
+	if _, err := fs.Stat(f.fsys, ioFSName(p)); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Get opens the file or directory at path
+func (f *fromIOFS) Get(ctx context.Context, p string) (File, error) {
+	return f.get(ioFSName(p))
+}
+
+func (f *fromIOFS) get(name string) (File, error) {
+	fp := "/" + name
+	if name == "." {
+		fp = "/"
+	}
+	file, err := f.fsys.Open(name)
+	if err != nil {
+		return nil, qfsError(err, fp)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return &ioFSDir{fsys: f, name: name, path: fp, modTime: info.ModTime()}, nil
+	}
+	return &ioFSFile{f: file, path: fp, info: info}, nil
+}
+
+// ReadDir lists the directory at path
+func (f *fromIOFS) ReadDir(ctx context.Context, p string) ([]DirEntry, error) {
+	des, err := fs.ReadDir(f.fsys, ioFSName(p))
+	if err != nil {
+		return nil, qfsError(err, p)
+	}
+	entries := make([]DirEntry, len(des))
+	for i, de := range des {
+		entries[i] = DirEntry{Name: de.Name(), Size: -1, IsDir: de.IsDir()}
+		if !de.IsDir() {
+			if info, err := de.Info(); err == nil {
+				entries[i].Size = info.Size()
+			}
+		}
+	}
+	return entries, nil
+}
+
+// Put is not supported, io/fs filesystems are read-only
+func (f *fromIOFS) Put(ctx context.Context, file File) (string, error) {
+	return "", ErrReadOnly
+}
+
+// Delete is not supported, io/fs filesystems are read-only
+func (f *fromIOFS) Delete(ctx context.Context, p string) error {
+	return ErrReadOnly
+}
+
+// ioFSFile is an fs.File as a qfs File
+type ioFSFile struct {
+	f    fs.File
+	path string
+	info fs.FileInfo
+}
+
+var (
+	_ SizeFile     = (*ioFSFile)(nil)
+	_ SeekableFile = (*ioFSFile)(nil)
+)
+
+func (f *ioFSFile) Read(p []byte) (int, error) { return f.f.Read(p) }
+func (f *ioFSFile) Close() error               { return f.f.Close() }
+func (f *ioFSFile) FileName() string           { return path.Base(f.path) }
+func (f *ioFSFile) FullPath() string           { return f.path }
+func (f *ioFSFile) IsDirectory() bool          { return false }
+func (f *ioFSFile) NextFile() (File, error)    { return nil, ErrNotDirectory }
+func (f *ioFSFile) ModTime() time.Time         { return f.info.ModTime() }
+func (f *ioFSFile) MediaType() string          { return mime.TypeByExtension(path.Ext(f.path)) }
+func (f *ioFSFile) Size() int64                { return f.info.Size() }
+
+// Seek seeks files that implement io.Seeker, returning ErrNotSeekable for
+// others
+func (f *ioFSFile) Seek(offset int64, whence int) (int64, error) {
+	if s, ok := f.f.(io.Seeker); ok {
+		return s.Seek(offset, whence)
+	}
+	return 0, ErrNotSeekable
+}
+
+// ioFSDir is a directory in an fs.FS as a qfs File. Entries are listed on
+// the first call to NextFile
+type ioFSDir struct {
+	fsys    *fromIOFS
+	name    string
+	path    string
+	modTime time.Time
+	entries []fs.DirEntry
+	listed  bool
+	i       int
+}
+
+var _ File = (*ioFSDir)(nil)
+
+func (d *ioFSDir) Read([]byte) (int, error) { return 0, ErrNotFile }
+func (d *ioFSDir) Close() error             { return nil }
+func (d *ioFSDir) FileName() string         { return path.Base(d.path) }
+func (d *ioFSDir) FullPath() string         { return d.path }
+func (d *ioFSDir) IsDirectory() bool        { return true }
+func (d *ioFSDir) ModTime() time.Time       { return d.modTime }
+func (d *ioFSDir) MediaType() string        { return "application/x-directory" }
+
+// NextFile opens the directory's children in name order
+func (d *ioFSDir) NextFile() (File, error) {
+	if !d.listed {
+		entries, err := fs.ReadDir(d.fsys.fsys, d.name)
+		if err != nil {
+			return nil, qfsError(err, d.path)
+		}
+		d.entries, d.listed = entries, true
+	}
+	if d.i >= len(d.entries) {
+		return nil, io.EOF
+	}
+	name := d.entries[d.i].Name()
+	d.i++
+	if d.name != "." {
+		name = path.Join(d.name, name)
+	}
+	return d.fsys.get(name)
+}
@@ -0,0 +1,69 @@
+package qfs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestIOFS(t *testing.T) {
+	ctx := context.Background()
+	mapFS := fstest.MapFS{
+		"a.txt":         {Data: []byte("a"), ModTime: time.Unix(1, 0)},
+		"dir/b.json":    {Data: []byte(`{"b":true}`), ModTime: time.Unix(2, 0)},
+		"dir/sub/c.csv": {Data: []byte("c\n"), ModTime: time.Unix(3, 0)},
+	}
+
+	fsys := FromIOFS(mapFS)
+	if err := fstest.TestFS(ToIOFS(fsys, "/"), "a.txt", "dir/b.json", "dir/sub/c.csv"); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := fsys.Get(ctx, "/dir/b.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"b":true}` || f.FullPath() != "/dir/b.json" || FileSize(f) != 10 {
+		t.Errorf("unexpected file %q: %q, size %d", f.FullPath(), data, FileSize(f))
+	}
+	if f.MediaType() != "application/json" {
+		t.Errorf("expected json media type, got %q", f.MediaType())
+	}
+
+	entries, err := ReadDir(ctx, fsys, "/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Name != "b.json" || entries[0].Size != 10 || !entries[1].IsDir {
+		t.Errorf("unexpected entries: %#v", entries)
+	}
+
+	if has, err := fsys.Has(ctx, "/missing"); err != nil || has {
+		t.Errorf("expected missing path not to exist. has: %t, err: %v", has, err)
+	}
+	if _, err := fsys.Get(ctx, "/missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got: %v", err)
+	}
+	if _, err := fsys.Put(ctx, NewMemfileBytes("/d.txt", nil)); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected ErrReadOnly, got: %v", err)
+	}
+
+	if _, err := fs.Stat(ToIOFS(fsys, "/dir"), "missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist, got: %v", err)
+	}
+	data, err = fs.ReadFile(ToIOFS(fsys, "/dir"), "sub/c.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "c\n" {
+		t.Errorf("expected to read beneath root, got %q", data)
+	}
+}
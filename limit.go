@@ -0,0 +1,307 @@
+package qfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// LimitMiddlewareType names limiting middleware in configuration
+const LimitMiddlewareType = "limit"
+
+// LimitConfig bounds the load a LimitedFS puts on the filesystem it wraps.
+// Zero values disable each limit
+type LimitConfig struct {
+	// Concurrency bounds operations in progress at once. Waiting operations
+	// are granted slots by priority, see WithPriority
+	Concurrency int
+	// OpsPerSecond bounds the rate operations start
+	OpsPerSecond float64
+	// BytesPerSecond bounds the rate file content is read from gets & written
+	// by puts
+	BytesPerSecond float64
+}
+
+// LimitedFS wraps a filesystem, bounding concurrent operations, operations
+// per second & bytes per second. Use it to keep parallel work like dataset
+// ingestion from overwhelming a shared IPFS node or remote API. Limits apply
+// to every operation, including batched reads, stats, directory listings &
+// pins, which fall back like the package functions of the same names when
+// the wrapped filesystem doesn't support them. Waiting for a limit is
+// cancelled with the operation's context
+type LimitedFS struct {
+	Filesystem
+
+	slots *PriorityLimiter
+	ops   *rateLimiter
+	bytes *rateLimiter
+}
+
+var (
+	_ Filesystem    = (*LimitedFS)(nil)
+	_ DescribingFS  = (*LimitedFS)(nil)
+	_ HasManyFS     = (*LimitedFS)(nil)
+	_ StatFS        = (*LimitedFS)(nil)
+	_ ReadDirFS     = (*LimitedFS)(nil)
+	_ PinningFS     = (*LimitedFS)(nil)
+	_ PinCheckingFS = (*LimitedFS)(nil)
+	_ Unwrapper     = (*LimitedFS)(nil)
+)
+
+// NewLimitedFS wraps fs with limits
+func NewLimitedFS(fs Filesystem, cfg LimitConfig) *LimitedFS {
+	l := &LimitedFS{Filesystem: fs}
+	if cfg.Concurrency > 0 {
+		l.slots = NewPriorityLimiter(cfg.Concurrency)
+	}
+	if cfg.OpsPerSecond > 0 {
+		l.ops = newRateLimiter(cfg.OpsPerSecond)
+	}
+	if cfg.BytesPerSecond > 0 {
+		l.bytes = newRateLimiter(cfg.BytesPerSecond)
+	}
+	return l
+}
+
+// NewLimitMiddleware is a MiddlewareConstructor for LimitedFS. cfg keys match
+// the fields of LimitConfig. Each filesystem the middleware wraps gets its own
+// limits
+func NewLimitMiddleware(_ context.Context, cfgMap map[string]interface{}) (Middleware, error) {
+	cfg := LimitConfig{}
+	if err := mapstructure.Decode(cfgMap, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Concurrency < 0 || cfg.OpsPerSecond < 0 || cfg.BytesPerSecond < 0 {
+		return nil, fmt.Errorf("limits can't be negative")
+	}
+	return func(fs Filesystem) Filesystem {
+		return NewLimitedFS(fs, cfg)
+	}, nil
+}
+
+// start waits for an operation slot & the operation rate limit
+func (l *LimitedFS) start(ctx context.Context) (release func(), err error) {
+	release = func() {}
+	if l.slots != nil {
+		if release, err = l.slots.Acquire(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if l.ops != nil {
+		if err := l.ops.wait(ctx, 1); err != nil {
+			release()
+			return nil, err
+		}
+	}
+	return release, nil
+}
+
+// Has returns whether the `path` is mapped to a value
+func (l *LimitedFS) Has(ctx context.Context, path string) (bool, error) {
+	release, err := l.start(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	return l.Filesystem.Has(ctx, path)
+}
+
+// Get fetches a file. The operation slot is held only while resolving the
+// file, reads of the returned file are limited to BytesPerSecond
+func (l *LimitedFS) Get(ctx context.Context, path string) (File, error) {
+	release, err := l.start(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	f, err := l.Filesystem.Get(ctx, path)
+	if err != nil || l.bytes == nil {
+		return f, err
+	}
+	return &rateLimitedFile{File: f, ctx: ctx, r: l.bytes}, nil
+}
+
+// Put places a file or directory on the filesystem, limiting the rate file
+// content is read to BytesPerSecond
+func (l *LimitedFS) Put(ctx context.Context, file File) (string, error) {
+	release, err := l.start(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	if l.bytes != nil {
+		file = &rateLimitedFile{File: file, ctx: ctx, r: l.bytes}
+	}
+	return l.Filesystem.Put(ctx, file)
+}
+
+// Delete removes a file or directory from the filesystem
+func (l *LimitedFS) Delete(ctx context.Context, path string) error {
+	release, err := l.start(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return l.Filesystem.Delete(ctx, path)
+}
+
+// Describe returns the wrapped filesystem's descriptor
+func (l *LimitedFS) Describe() Descriptor { return Describe(l.Filesystem) }
+
+// Unwrap returns the wrapped filesystem
+func (l *LimitedFS) Unwrap() Filesystem { return l.Filesystem }
+
+// HasMany checks a batch of paths as a single operation
+func (l *LimitedFS) HasMany(ctx context.Context, paths []string) (map[string]bool, error) {
+	release, err := l.start(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return HasMany(ctx, l.Filesystem, paths)
+}
+
+// Stat describes a path on the wrapped filesystem
+func (l *LimitedFS) Stat(ctx context.Context, path string) (os.FileInfo, error) {
+	release, err := l.start(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return Stat(ctx, l.Filesystem, path)
+}
+
+// ReadDir lists a directory of the wrapped filesystem
+func (l *LimitedFS) ReadDir(ctx context.Context, path string) ([]DirEntry, error) {
+	release, err := l.start(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return ReadDir(ctx, l.Filesystem, path)
+}
+
+// Pin pins path on the wrapped filesystem. Filesystems that don't pin return
+// an error matching ErrUnsupported
+func (l *LimitedFS) Pin(ctx context.Context, path string, recursive bool) error {
+	p, ok := l.Filesystem.(PinningFS)
+	if !ok {
+		return fmt.Errorf("%w: %q filesystem doesn't pin", ErrUnsupported, l.Type())
+	}
+	release, err := l.start(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return p.Pin(ctx, path, recursive)
+}
+
+// Unpin unpins path on the wrapped filesystem. Filesystems that don't pin
+// return an error matching ErrUnsupported
+func (l *LimitedFS) Unpin(ctx context.Context, path string, recursive bool) error {
+	p, ok := l.Filesystem.(PinningFS)
+	if !ok {
+		return fmt.Errorf("%w: %q filesystem doesn't pin", ErrUnsupported, l.Type())
+	}
+	release, err := l.start(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return p.Unpin(ctx, path, recursive)
+}
+
+// IsPinned checks path's pins on the wrapped filesystem. Filesystems that
+// can't check pins return an error matching ErrUnsupported
+func (l *LimitedFS) IsPinned(ctx context.Context, path string) (bool, error) {
+	pc, ok := l.Filesystem.(PinCheckingFS)
+	if !ok {
+		return false, fmt.Errorf("%w: %q filesystem can't check pins", ErrUnsupported, l.Type())
+	}
+	release, err := l.start(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	return pc.IsPinned(ctx, path)
+}
+
+// rateLimiter is a token bucket holding up to a second of tokens. Waits for
+// more tokens than the bucket holds are allowed, leaving the bucket in debt
+// that later waits pay off
+type rateLimiter struct {
+	lk     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(perSecond float64) *rateLimiter {
+	return &rateLimiter{rate: perSecond, tokens: perSecond, last: time.Now()}
+}
+
+// wait takes n tokens, blocking until the bucket is out of debt or ctx is
+// done. Tokens taken by a cancelled wait are returned
+func (r *rateLimiter) wait(ctx context.Context, n int) error {
+	r.lk.Lock()
+	now := time.Now()
+	r.tokens += now.Sub(r.last).Seconds() * r.rate
+	if burst := r.burst(); r.tokens > burst {
+		r.tokens = burst
+	}
+	r.last = now
+	r.tokens -= float64(n)
+	delay := time.Duration(-r.tokens / r.rate * float64(time.Second))
+	r.lk.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		r.lk.Lock()
+		r.tokens += float64(n)
+		r.lk.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (r *rateLimiter) burst() float64 {
+	if r.rate < 1 {
+		return 1
+	}
+	return r.rate
+}
+
+// rateLimitedFile limits reads of a file & the files of a directory
+type rateLimitedFile struct {
+	File
+	ctx context.Context
+	r   *rateLimiter
+}
+
+func (f *rateLimitedFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	if n > 0 {
+		if werr := f.r.wait(f.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+func (f *rateLimitedFile) NextFile() (File, error) {
+	ch, err := f.File.NextFile()
+	if err != nil {
+		return nil, err
+	}
+	return &rateLimitedFile{File: ch, ctx: f.ctx, r: f.r}, nil
+}
@@ -0,0 +1,137 @@
+package qfs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingFS calls put before each put
+type blockingFS struct {
+	Filesystem
+	put func()
+}
+
+func (fs *blockingFS) Put(ctx context.Context, f File) (string, error) {
+	fs.put()
+	return fs.Filesystem.Put(ctx, f)
+}
+
+func TestLimitedFSConcurrency(t *testing.T) {
+	ctx := context.Background()
+	block := make(chan struct{})
+	var lk sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	fs := NewLimitedFS(&blockingFS{Filesystem: NewMemFS(), put: func() {
+		lk.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		lk.Unlock()
+		<-block
+		lk.Lock()
+		inFlight--
+		lk.Unlock()
+	}}, LimitConfig{Concurrency: 2})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := fs.Put(ctx, NewMemfileBytes("a.txt", []byte("a"))); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	waitFor(t, func() bool { return fs.slots.Waiting(PriorityNormal) == 3 })
+	close(block)
+	wg.Wait()
+
+	if maxInFlight != 2 {
+		t.Errorf("expected at most 2 puts in flight. got: %d", maxInFlight)
+	}
+}
+
+func TestLimitedFSRates(t *testing.T) {
+	ctx := context.Background()
+	fs := NewLimitedFS(NewMemFS(), LimitConfig{OpsPerSecond: 20})
+
+	// the first second's worth of operations run right away
+	start := time.Now()
+	for i := 0; i < 22; i++ {
+		if _, err := fs.Has(ctx, "/mem/a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 75*time.Millisecond {
+		t.Errorf("expected 22 ops at 20 ops/sec to take at least 100ms. took: %s", elapsed)
+	}
+
+	fs = NewLimitedFS(NewMemFS(), LimitConfig{BytesPerSecond: 1000})
+	path, err := fs.Put(ctx, NewMemfileBytes("a.txt", make([]byte, 1100)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start = time.Now()
+	f, err := fs.Get(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(f); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Errorf("expected reading 1100 bytes after writing 1100 at 1000 bytes/sec to take at least 1s. took: %s", elapsed)
+	}
+
+	// waits are cancelled with their context
+	fs = NewLimitedFS(NewMemFS(), LimitConfig{OpsPerSecond: 1})
+	if _, err := fs.Has(ctx, "/mem/a"); err != nil {
+		t.Fatal(err)
+	}
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := fs.Has(cctx, "/mem/a"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected cancelled wait to fail with context.DeadlineExceeded. got: %v", err)
+	}
+}
+
+func TestLimitMiddleware(t *testing.T) {
+	ctx := context.Background()
+	mw, err := NewLimitMiddleware(ctx, map[string]interface{}{"concurrency": 2, "opsPerSecond": 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, ok := mw(NewMemFS()).(*LimitedFS)
+	if !ok {
+		t.Fatal("expected middleware to return a *LimitedFS")
+	}
+	if fs.Type() != MemFilestoreType {
+		t.Errorf("expected limited filesystem to keep its type. got: %q", fs.Type())
+	}
+	if fs.slots == nil || fs.ops == nil || fs.bytes != nil {
+		t.Errorf("expected concurrency & ops limits only")
+	}
+	if d := Describe(fs); !d.Has(FeatureContentAddressed) {
+		t.Errorf("expected limited filesystem to keep its descriptor. got: %v", d)
+	}
+	path, err := fs.Put(ctx, NewMemfileBytes("a.txt", []byte("a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := Stat(ctx, fs, path); err != nil || fi.Size() != 1 {
+		t.Errorf("expected stat to reach the wrapped filesystem. err: %v", err)
+	}
+	if err := fs.Pin(ctx, path, true); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected pinning a filesystem that doesn't pin to be unsupported. got: %v", err)
+	}
+
+	if _, err := NewLimitMiddleware(ctx, map[string]interface{}{"bytesPerSecond": -1}); err == nil {
+		t.Error("expected negative limit to fail")
+	}
+}
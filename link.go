@@ -0,0 +1,178 @@
+package qfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// SoftLinkMediaType is the media type of soft links
+const SoftLinkMediaType = "application/vnd.qfs.link"
+
+// linkFileMagic prefixes the content of every link file. Link files are plain
+// files to the stores that hold them, the prefix is how readers recognize them
+const linkFileMagic = "#qfs-link\n"
+
+// MaxLinkDepth is the number of links followed resolving a single path
+// before giving up
+const MaxLinkDepth = 16
+
+// ErrLinkDepth is returned when resolving a path follows more than
+// MaxLinkDepth links, usually because links form a cycle
+var ErrLinkDepth = errors.New("too many levels of links")
+
+// SoftLink is a file that references another path instead of holding
+// content. Filesystems store link files as ordinary small files, readers
+// recognize them with ReadLink
+type SoftLink struct {
+	*Memfile
+	// Target is the full qfs path the link refers to, which can be in any
+	// filesystem, so a tree stored in one filesystem can point into another
+	Target string
+}
+
+var _ File = (*SoftLink)(nil)
+
+// NewSoftLink creates a soft link at path that references target
+func NewSoftLink(path, target string) *SoftLink {
+	return &SoftLink{
+		Memfile: NewMemfileBytes(path, []byte(linkFileMagic+target+"\n")),
+		Target:  target,
+	}
+}
+
+// MediaType returns SoftLinkMediaType
+func (f *SoftLink) MediaType() string { return SoftLinkMediaType }
+
+// ReadLink checks whether f is a link file, returning its target if it is.
+// ReadLink consumes the start of f. When f isn't a link, the returned file
+// reads f from the beginning
+func ReadLink(f File) (target string, file File, isLink bool, err error) {
+	if f.IsDirectory() {
+		return "", f, false, nil
+	}
+
+	br := bufio.NewReader(f)
+	peeked, err := br.Peek(len(linkFileMagic))
+	file = &peekedFile{File: f, r: br}
+	if err != nil && err != io.EOF {
+		return "", file, false, err
+	}
+	if !bytes.Equal(peeked, []byte(linkFileMagic)) {
+		return "", file, false, nil
+	}
+
+	br.Discard(len(linkFileMagic))
+	line, err := br.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", file, false, err
+	}
+	target = strings.TrimSpace(line)
+	if target == "" {
+		return "", file, false, fmt.Errorf("link file %q has no target", f.FullPath())
+	}
+	return target, file, true, nil
+}
+
+type followLinksCtxKey struct{}
+
+// WithFollowLinks returns a context that asks filesystems that support links
+// to resolve link files on Get
+func WithFollowLinks(ctx context.Context) context.Context {
+	return context.WithValue(ctx, followLinksCtxKey{}, true)
+}
+
+// FollowLinksFromContext reports whether WithFollowLinks is set on ctx
+func FollowLinksFromContext(ctx context.Context) bool {
+	follow, _ := ctx.Value(followLinksCtxKey{}).(bool)
+	return follow
+}
+
+// FollowLinks replaces link files with their targets, resolved with resolver.
+// Directories are wrapped so links are followed as children are read. The
+// resolved file keeps the path & name of the link
+func FollowLinks(ctx context.Context, resolver PathResolver, f File) (File, error) {
+	return followLinks(ctx, resolver, f, 0)
+}
+
+func followLinks(ctx context.Context, resolver PathResolver, f File, depth int) (File, error) {
+	if f.IsDirectory() {
+		return &linkFollowingDir{File: f, ctx: ctx, resolver: resolver}, nil
+	}
+
+	target, f, isLink, err := ReadLink(f)
+	if err != nil || !isLink {
+		return f, err
+	}
+	f.Close()
+	if depth >= MaxLinkDepth {
+		return nil, fmt.Errorf("%w: resolving %q", ErrLinkDepth, f.FullPath())
+	}
+
+	resolved, err := resolver.Get(ctx, target)
+	if err != nil {
+		return nil, fmt.Errorf("following link %q to %q: %w", f.FullPath(), target, err)
+	}
+	resolved, err = followLinks(ctx, resolver, resolved, depth+1)
+	if err != nil {
+		return nil, err
+	}
+	return &linkedFile{File: resolved, path: f.FullPath()}, nil
+}
+
+// peekedFile reads a file through a buffer that has already peeked at its
+// start
+type peekedFile struct {
+	File
+	r *bufio.Reader
+}
+
+func (f *peekedFile) Read(p []byte) (int, error) {
+	return f.r.Read(p)
+}
+
+// Seek seeks the underlying file, discarding anything buffered
+func (f *peekedFile) Seek(offset int64, whence int) (int64, error) {
+	if whence == io.SeekCurrent {
+		// the underlying file is ahead of the reader by what's buffered
+		offset -= int64(f.r.Buffered())
+	}
+	n, err := seekFile(f.File, offset, whence)
+	if err == nil {
+		f.r.Reset(f.File)
+	}
+	return n, err
+}
+
+// linkedFile is a link target presented at the link's path
+type linkedFile struct {
+	File
+	path string
+}
+
+func (f *linkedFile) FullPath() string { return f.path }
+func (f *linkedFile) Seek(offset int64, whence int) (int64, error) {
+	return seekFile(f.File, offset, whence)
+}
+func (f *linkedFile) FileName() string { return filepath.Base(f.path) }
+func (f *linkedFile) Size() int64      { return FileSize(f.File) }
+
+// linkFollowingDir follows links in a directory's children as they're read
+type linkFollowingDir struct {
+	File
+	ctx      context.Context
+	resolver PathResolver
+}
+
+func (d *linkFollowingDir) NextFile() (File, error) {
+	f, err := d.File.NextFile()
+	if err != nil {
+		return nil, err
+	}
+	return FollowLinks(d.ctx, d.resolver, f)
+}
@@ -0,0 +1,87 @@
+package qfs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+func TestFollowLinks(t *testing.T) {
+	ctx := context.Background()
+	fs := NewMemFS()
+
+	target, err := fs.Put(ctx, NewMemfileBytes("/body.csv", []byte("a,b,c")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	link, err := fs.Put(ctx, NewSoftLink("/body_link", target))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := fs.Get(ctx, link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, f, isLink, err := ReadLink(f)
+	if err != nil || !isLink || got != target {
+		t.Fatalf("expected stored link to read back. got: %q, %t, %v", got, isLink, err)
+	}
+
+	if f, err = fs.Get(ctx, link); err != nil {
+		t.Fatal(err)
+	}
+	if f, err = FollowLinks(ctx, fs, f); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "a,b,c" {
+		t.Errorf("expected link to resolve to target content. got: %q", string(data))
+	}
+
+	// regular files pass through untouched
+	if f, err = fs.Get(ctx, target); err != nil {
+		t.Fatal(err)
+	}
+	if f, err = FollowLinks(ctx, fs, f); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ = ioutil.ReadAll(f); string(data) != "a,b,c" {
+		t.Errorf("expected regular file content. got: %q", string(data))
+	}
+
+	// links in directories resolve as children are read
+	dir := NewMemdir("/dir", NewMemfileBytes("plain.txt", []byte("plain")), NewSoftLink("linked.csv", target))
+	followed, err := FollowLinks(ctx, fs, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := map[string]string{}
+	for {
+		child, err := followed.NextFile()
+		if err != nil {
+			break
+		}
+		data, _ := ioutil.ReadAll(child)
+		contents[child.FileName()] = string(data)
+	}
+	if contents["plain.txt"] != "plain" || contents["linked.csv"] != "a,b,c" {
+		t.Errorf("unexpected directory contents: %v", contents)
+	}
+
+	// a link to itself fails instead of looping forever
+	loop := &loopResolver{}
+	if _, err := FollowLinks(ctx, loop, NewSoftLink("/loop", "/loop")); !errors.Is(err, ErrLinkDepth) {
+		t.Errorf("expected ErrLinkDepth. got: %v", err)
+	}
+}
+
+type loopResolver struct{}
+
+func (loopResolver) Get(ctx context.Context, path string) (File, error) {
+	return NewSoftLink(path, path), nil
+}
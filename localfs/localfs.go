@@ -2,13 +2,16 @@ package localfs
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io"
-	"mime"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"time"
 
+	logging "github.com/ipfs/go-log"
 	"github.com/mitchellh/mapstructure"
 	"github.com/qri-io/qfs"
 )
@@ -16,9 +19,17 @@ import (
 // FilestoreType uniquely identifies this filestore
 const FilestoreType = "local"
 
+var log = logging.Logger("localfs")
+
 // FSConfig adjusts the behaviour of an FS instance
 type FSConfig struct {
 	PWD string // working directory. defaults to system root
+	// Sync flushes written files & their directory entries to disk before Put
+	// returns, so a file that's been put survives a crash
+	Sync bool
+	// PreserveModTime sets the modification time of written files to the
+	// ModTime of the file that's put, when it has one
+	PreserveModTime bool
 }
 
 // Option is a function type for passing to NewFS
@@ -31,6 +42,20 @@ func OptionSetPWD(pwd string) Option {
 	}
 }
 
+// OptionSync flushes writes to disk before Put returns
+func OptionSync(sync bool) Option {
+	return func(cfg *FSConfig) {
+		cfg.Sync = sync
+	}
+}
+
+// OptionPreserveModTime keeps the modification times of put files
+func OptionPreserveModTime(preserve bool) Option {
+	return func(cfg *FSConfig) {
+		cfg.PreserveModTime = preserve
+	}
+}
+
 // DefaultFSConfig is the configuration state with no additional options
 // consumers of this package typically don't need to use this
 func DefaultFSConfig() *FSConfig {
@@ -57,7 +82,12 @@ type FS struct {
 }
 
 // compile-time assertion that MapStore satisfies the Filesystem interface
-var _ qfs.Filesystem = (*FS)(nil)
+var (
+	_ qfs.Filesystem = (*FS)(nil)
+	_ qfs.ReadDirFS  = (*FS)(nil)
+	_ qfs.StatFS     = (*FS)(nil)
+	_ qfs.WritableFS = (*FS)(nil)
+)
 
 // NewFilesystem creates a new local filesystem Pathresolver
 // with no options
@@ -97,8 +127,20 @@ func (lfs *FS) Has(ctx context.Context, path string) (bool, error) {
 	return true, nil
 }
 
+// Stat describes a local file or directory without opening it
+func (lfs *FS) Stat(ctx context.Context, path string) (os.FileInfo, error) {
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, qfs.ErrNotFound
+	}
+	return fi, err
+}
+
 // Get implements qfs.PathResolver
-func (lfs *FS) Get(ctx context.Context, path string) (qfs.File, error) {
+func (lfs *FS) Get(ctx context.Context, path string) (f qfs.File, err error) {
+	span, _ := qfs.StartSpan(ctx, "get", lfs.Type(), path)
+	defer func() { span.Finish(0, err) }()
+
 	fi, err := os.Stat(path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -109,25 +151,52 @@ func (lfs *FS) Get(ctx context.Context, path string) (qfs.File, error) {
 
 	if fi.IsDir() {
 		// TODO (b5): implement local directory support
-		return nil, fmt.Errorf("local directory is not supported")
+		return nil, fmt.Errorf("%w: getting local directories", qfs.ErrUnsupported)
 	}
 
-	f, err := os.Open(path)
+	osf, err := os.Open(path)
 	if err != nil {
-		return nil, fmt.Errorf("opening local file: %s", err.Error())
+		return nil, fmt.Errorf("opening local file: %w", err)
 	}
 
-	return &LocalFile{
-		File: *f,
+	return qfs.ProgressFile(&LocalFile{
+		File: *osf,
 		info: fi,
 		path: path,
-	}, nil
+	}, qfs.ProgressFromContext(ctx)), nil
+}
+
+// ReadDir lists a local directory
+func (lfs *FS) ReadDir(ctx context.Context, path string) ([]qfs.DirEntry, error) {
+	infos, err := ioutil.ReadDir(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, qfs.ErrNotFound
+		}
+		if fi, serr := os.Stat(path); serr == nil && !fi.IsDir() {
+			return nil, qfs.ErrNotDirectory
+		}
+		return nil, err
+	}
+
+	entries := make([]qfs.DirEntry, 0, len(infos))
+	for _, fi := range infos {
+		e := qfs.DirEntry{Name: fi.Name(), Size: fi.Size(), IsDir: fi.IsDir()}
+		if e.IsDir {
+			e.Size = -1
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
 }
 
 // Put places a file or directory on the filesystem, returning the root path.
 // The returned path may or may not honor the path of the given file
 func (lfs *FS) Put(ctx context.Context, file qfs.File) (resultPath string, err error) {
 	path := file.FullPath()
+	span, ctx := qfs.StartSpan(ctx, "put", lfs.Type(), path)
+	defer func() { span.Finish(0, err) }()
+
 	// ensure directory exists
 	if err := os.MkdirAll(filepath.Dir(path), 0666); err != nil {
 		return "", err
@@ -138,7 +207,7 @@ func (lfs *FS) Put(ctx context.Context, file qfs.File) (resultPath string, err e
 			childFile, err := file.NextFile()
 			if err != nil {
 				if err.Error() == "EOF" {
-					return path, err
+					return path, nil
 				}
 
 				return "", err
@@ -150,20 +219,181 @@ func (lfs *FS) Put(ctx context.Context, file qfs.File) (resultPath string, err e
 		}
 	}
 
-	f, err := os.Create(path)
+	var mtime time.Time
+	if lfs.cfg.PreserveModTime {
+		mtime = file.ModTime()
+	}
+	r := qfs.ProgressReader(file, qfs.FileSize(file), qfs.ProgressFromContext(ctx))
+	return path, writeFile(path, r, mtime, lfs.cfg.Sync)
+}
+
+// tempFileSuffix marks the temp files writeFile renames into place
+const tempFileSuffix = ".tmp-"
+
+// writeFile writes to a temp file in the destination directory & renames it
+// into place, so a partially written file is never visible at path, even
+// after a crash. A non-zero mtime sets the file's modification time.
+// Replacing a file keeps its mode, new files are created with mode 0666 less
+// the umask. When path is a symlink the file it links to is replaced, leaving
+// the link in place
+func writeFile(path string, r io.Reader, mtime time.Time, sync bool) (err error) {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := createTemp(dir, "."+base+tempFileSuffix)
 	if err != nil {
-		return path, err
+		return err
 	}
-	defer f.Close()
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
 
-	_, err = io.Copy(f, file)
-	return path, err
+	if _, err = io.Copy(tmp, r); err != nil {
+		return err
+	}
+	if sync {
+		if err = tmp.Sync(); err != nil {
+			return err
+		}
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if fi, statErr := os.Stat(path); statErr == nil {
+		if err = os.Chmod(tmp.Name(), fi.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	if !mtime.IsZero() {
+		if err = os.Chtimes(tmp.Name(), mtime, mtime); err != nil {
+			return err
+		}
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	if sync {
+		return syncDir(dir)
+	}
+	return nil
+}
+
+// createTemp creates a new file in dir named prefix followed by a random
+// suffix. Unlike ioutil.TempFile, which always uses mode 0600, the file is
+// created with mode 0666 so the umask applies
+func createTemp(dir, prefix string) (*os.File, error) {
+	for i := 0; i < 10000; i++ {
+		var suffix [8]byte
+		if _, err := rand.Read(suffix[:]); err != nil {
+			return nil, err
+		}
+		name := filepath.Join(dir, prefix+hex.EncodeToString(suffix[:]))
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) {
+			continue
+		}
+		return f, err
+	}
+	return nil, fmt.Errorf("creating temp file in %s: too many name collisions", dir)
+}
+
+// syncDir flushes a directory's entries to disk, persisting a rename
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
 }
 
 // Delete removes a file or directory from the filesystem
 func (lfs *FS) Delete(ctx context.Context, path string) (err error) {
+	span, _ := qfs.StartSpan(ctx, "delete", lfs.Type(), path)
+	defer func() { span.Finish(0, err) }()
+
 	// TODO (b5):
-	return fmt.Errorf("deleting local files via qfs.Localfs is not finished")
+	return fmt.Errorf("%w: deleting local files", qfs.ErrUnsupported)
+}
+
+// Copy copies a local file or directory tree to dst, creating dst's parent
+// directories. Copied files are written like Put writes them & keep their
+// modification times when PreserveModTime is set
+func (lfs *FS) Copy(ctx context.Context, src, dst string) (err error) {
+	span, ctx := qfs.StartSpan(ctx, "copy", lfs.Type(), src)
+	defer func() { span.Finish(0, err) }()
+
+	fi, err := os.Stat(src)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return qfs.ErrNotFound
+		}
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return lfs.copy(ctx, src, dst, fi)
+}
+
+func (lfs *FS) copy(ctx context.Context, src, dst string, fi os.FileInfo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		if err := os.MkdirAll(dst, 0755); err != nil {
+			return err
+		}
+		infos, err := ioutil.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, ch := range infos {
+			if err := lfs.copy(ctx, filepath.Join(src, ch.Name()), filepath.Join(dst, ch.Name()), ch); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var mtime time.Time
+	if lfs.cfg.PreserveModTime {
+		mtime = fi.ModTime()
+	}
+	return writeFile(dst, f, mtime, lfs.cfg.Sync)
+}
+
+// Rename moves a local file or directory to dst, creating dst's parent
+// directories
+func (lfs *FS) Rename(ctx context.Context, src, dst string) (err error) {
+	span, _ := qfs.StartSpan(ctx, "rename", lfs.Type(), src)
+	defer func() { span.Finish(0, err) }()
+
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return qfs.ErrNotFound
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err != nil {
+		return err
+	}
+	if lfs.cfg.Sync {
+		return syncDir(filepath.Dir(dst))
+	}
+	return nil
 }
 
 // LocalFile implements qfs.File with a filesystem file
@@ -174,8 +404,10 @@ type LocalFile struct {
 }
 
 var (
-	_ qfs.File     = (*LocalFile)(nil)
-	_ qfs.SizeFile = (*LocalFile)(nil)
+	_ qfs.File         = (*LocalFile)(nil)
+	_ qfs.SizeFile     = (*LocalFile)(nil)
+	_ qfs.SeekableFile = (*LocalFile)(nil)
+	_ qfs.StatFile     = (*LocalFile)(nil)
 )
 
 // IsDirectory satisfies the qfs.File interface
@@ -198,9 +430,10 @@ func (lf *LocalFile) FullPath() string {
 	return lf.path
 }
 
-// MediaType returns a mime type based on file extension
+// MediaType sniffs the start of the file, falling back to a mime type based
+// on file extension
 func (lf *LocalFile) MediaType() string {
-	return mime.TypeByExtension(filepath.Ext(lf.path))
+	return qfs.SniffMediaType(lf.path, &lf.File)
 }
 
 // ModTime returns time of last modification, if any
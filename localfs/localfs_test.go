@@ -2,9 +2,15 @@ package localfs
 
 import (
 	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/qri-io/qfs"
+	"github.com/qri-io/qfs/spec"
 )
 
 func TestMapToConfig(t *testing.T) {
@@ -41,3 +47,372 @@ func TestSizeFile(t *testing.T) {
 		t.Errorf("size mismatch. want: %d got: %d", expect, got)
 	}
 }
+
+func TestMediaType(t *testing.T) {
+	ctx := context.Background()
+	fs, err := NewFS(map[string]interface{}{
+		"PWD": ".",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := fs.Get(ctx, "testdata/text.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if mt := f.MediaType(); mt != "text/plain; charset=utf-8" {
+		t.Errorf("expected text media type. got: %q", mt)
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 12 {
+		t.Errorf("expected sniffing not to consume the file. read %d bytes", len(data))
+	}
+}
+
+func TestStat(t *testing.T) {
+	ctx := context.Background()
+	fs, err := NewFS(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := qfs.Stat(ctx, fs, "testdata/text.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Name() != "text.txt" || fi.Size() != 12 || fi.IsDir() {
+		t.Errorf("unexpected stat: %q %d %t", fi.Name(), fi.Size(), fi.IsDir())
+	}
+	if fi, err = qfs.Stat(ctx, fs, "testdata"); err != nil || !fi.IsDir() {
+		t.Errorf("expected directory stat. got: %v %v", fi, err)
+	}
+	if _, err := qfs.Stat(ctx, fs, "testdata/missing"); !errors.Is(err, qfs.ErrNotFound) {
+		t.Errorf("expected ErrNotFound. got: %v", err)
+	}
+
+	f, err := fs.Get(ctx, "testdata/text.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if fi, err := qfs.FileStat(f); err != nil || fi.Size() != 12 || fi.ModTime().IsZero() {
+		t.Errorf("expected open local file to describe itself. got: %v %v", fi, err)
+	}
+}
+
+func TestReadDir(t *testing.T) {
+	ctx := context.Background()
+	fs, err := NewFS(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := fs.(qfs.ReadDirFS).ReadDir(ctx, "testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name != "text.txt" || entries[0].Size != 12 || entries[0].IsDir {
+		t.Errorf("unexpected entries: %#v", entries)
+	}
+
+	if _, err := fs.(qfs.ReadDirFS).ReadDir(ctx, "testdata/text.txt"); !errors.Is(err, qfs.ErrNotDirectory) {
+		t.Errorf("expected ErrNotDirectory listing a file, got %v", err)
+	}
+	if _, err := fs.(qfs.ReadDirFS).ReadDir(ctx, "testdata/missing"); !errors.Is(err, qfs.ErrNotFound) {
+		t.Errorf("expected ErrNotFound listing a missing directory, got %v", err)
+	}
+}
+
+type failingReader struct{ n int }
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.n == 0 {
+		return 0, errors.New("read failed")
+	}
+	r.n--
+	return copy(p, "partial"), nil
+}
+
+func TestAtomicPut(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "localfs_atomic_put")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs, err := NewFS(map[string]interface{}{"sync": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fs.(*FS).cfg.Sync {
+		t.Error("expected sync to be configured from a config map")
+	}
+
+	path := filepath.Join(dir, "data.json")
+	if _, err := fs.Put(ctx, qfs.NewMemfileBytes(path, []byte(`{"v":1}`))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Put(ctx, qfs.NewMemfileReader(path, &failingReader{n: 2})); err == nil {
+		t.Fatal("expected a failed read to fail the put")
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"v":1}` {
+		t.Errorf("expected a failed put to leave the original file, got %q", data)
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 {
+		t.Errorf("expected temp files to be removed, found %d files", len(infos))
+	}
+	if mode := infos[0].Mode().Perm(); mode != 0644 {
+		t.Errorf("expected mode 0644, got %o", mode)
+	}
+}
+
+func TestPreserveModTime(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "localfs_preserve_mod_time")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs, err := NewFS(map[string]interface{}{"preserveModTime": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2019, 4, 1, 12, 30, 0, 0, time.UTC)
+	f := qfs.NewMemfileBytes(filepath.Join(dir, "a.txt"), []byte("a"))
+	f.SetModTime(mtime)
+	path, err := fs.Put(ctx, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := fs.Get(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer got.Close()
+	if !got.ModTime().Equal(mtime) {
+		t.Errorf("expected modification time %s. got: %s", mtime, got.ModTime())
+	}
+
+	// without the option files are modified when they're written
+	fs, err = NewFS(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f = qfs.NewMemfileBytes(filepath.Join(dir, "b.txt"), []byte("b"))
+	f.SetModTime(mtime)
+	if path, err = fs.Put(ctx, f); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := qfs.Stat(ctx, fs, path); err != nil || fi.ModTime().Equal(mtime) {
+		t.Errorf("expected modification time of write. got: %v %v", fi, err)
+	}
+}
+
+func TestCopyRename(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "localfs_copy_rename")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs, err := NewFS(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := fs.(qfs.WritableFS)
+
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "sub", "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	copied := filepath.Join(dir, "x", "copy")
+	if err := w.Copy(ctx, src, copied); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(copied, "sub", "a.txt")); err != nil || string(data) != "a" {
+		t.Errorf("expected copied file. got: %q %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(src, "sub", "a.txt")); err != nil {
+		t.Errorf("expected copy to keep the source. got: %s", err)
+	}
+
+	moved := filepath.Join(dir, "y", "moved.txt")
+	if err := w.Rename(ctx, filepath.Join(copied, "sub", "a.txt"), moved); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(moved); err != nil || string(data) != "a" {
+		t.Errorf("expected moved file. got: %q %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(copied, "sub", "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected rename to remove the source. got: %v", err)
+	}
+
+	if err := w.Copy(ctx, filepath.Join(dir, "missing"), copied); !errors.Is(err, qfs.ErrNotFound) {
+		t.Errorf("expected ErrNotFound copying a missing file. got: %v", err)
+	}
+	if err := w.Rename(ctx, filepath.Join(dir, "missing"), copied); !errors.Is(err, qfs.ErrNotFound) {
+		t.Errorf("expected ErrNotFound renaming a missing file. got: %v", err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "localfs_watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fs, err := NewFS(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := fs.(qfs.Watcher)
+	if _, err := w.Watch(ctx, filepath.Join(dir, "missing")); !errors.Is(err, qfs.ErrNotFound) {
+		t.Errorf("expected watching a missing path to return ErrNotFound, got: %v", err)
+	}
+
+	events, err := w.Watch(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "data.json")
+	if _, err := fs.Put(ctx, qfs.NewMemfileBytes(path, []byte(`{}`))); err != nil {
+		t.Fatal(err)
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-events:
+			if e.Path != path {
+				t.Fatalf("expected events only for %q, got %q", path, e.Path)
+			}
+			if e.Type == qfs.EventPut {
+				cancel()
+				for range events {
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for a put event")
+		}
+	}
+}
+
+func TestProgress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "localfs_progress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var calls int
+	var done, total int64
+	ctx := qfs.WithProgress(context.Background(), func(d, t int64) {
+		calls++
+		done, total = d, t
+	})
+	fs, err := NewFS(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "data.txt")
+	if _, err := fs.Put(ctx, qfs.NewMemfileBytes(path, []byte("hello progress"))); err != nil {
+		t.Fatal(err)
+	}
+	if calls == 0 || done != 14 || total != 14 {
+		t.Errorf("expected put progress of 14 of 14 bytes, got %d of %d", done, total)
+	}
+
+	calls, done, total = 0, 0, 0
+	f, err := fs.Get(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := ioutil.ReadAll(f); err != nil {
+		t.Fatal(err)
+	}
+	if calls == 0 || done != 14 || total != 14 {
+		t.Errorf("expected get progress of 14 of 14 bytes, got %d of %d", done, total)
+	}
+}
+
+func TestSpec(t *testing.T) {
+	spec.AssertFilesystem(t, spec.Config{
+		New: func(t *testing.T) qfs.Filesystem {
+			fs, err := NewFS(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return fs
+		},
+		Root: func(t *testing.T) string { return t.TempDir() },
+	})
+}
+
+func TestPutKeepsModeAndSymlinks(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "localfs_put_mode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs, err := NewFS(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := filepath.Join(dir, "target.txt")
+	if err := ioutil.WriteFile(target, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(target, 0600); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link.txt")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fs.Put(ctx, qfs.NewMemfileBytes(link, []byte("new"))); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Lstat(link); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("expected put to keep the symlink at %q. err: %v", link, err)
+	}
+	if data, _ := ioutil.ReadFile(target); string(data) != "new" {
+		t.Errorf("expected put through a symlink to write the target, got %q", data)
+	}
+	fi, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := fi.Mode().Perm(); mode != 0600 {
+		t.Errorf("expected put to keep mode 0600, got %o", mode)
+	}
+}
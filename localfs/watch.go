@@ -0,0 +1,111 @@
+package localfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/qri-io/qfs"
+)
+
+var _ qfs.Watcher = (*FS)(nil)
+
+// Watch sends an event when a file at or beneath path is written or removed.
+// Watching a directory watches its subdirectories, including ones created
+// after the watch starts. Files are watched through their parent directory so
+// the watch survives files being replaced by rename. Events are reported for
+// changes made by any process
+func (lfs *FS) Watch(ctx context.Context, path string) (<-chan qfs.Event, error) {
+	path = filepath.Clean(path)
+	fi, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", qfs.ErrNotFound, path)
+		}
+		return nil, err
+	}
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		err = addDirs(w, path)
+	} else {
+		err = w.Add(filepath.Dir(path))
+	}
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	events := make(chan qfs.Event)
+	go func() {
+		defer close(events)
+		defer w.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err := <-w.Errors:
+				log.Debugw("watching local files", "path", path, "err", err)
+			case e := <-w.Events:
+				if !fi.IsDir() && e.Name != path {
+					continue
+				}
+				if fi.IsDir() && e.Op&fsnotify.Create != 0 {
+					if info, err := os.Stat(e.Name); err == nil && info.IsDir() {
+						if err := addDirs(w, e.Name); err != nil {
+							log.Debugw("watching new directory", "path", e.Name, "err", err)
+						}
+					}
+				}
+				evt, ok := watchEvent(e)
+				if !ok {
+					continue
+				}
+				select {
+				case events <- evt:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+// watchEvent converts a filesystem notification to a qfs event. Permission
+// changes & the temp files Put writes through aren't reported
+func watchEvent(e fsnotify.Event) (qfs.Event, bool) {
+	if strings.Contains(filepath.Base(e.Name), tempFileSuffix) {
+		return qfs.Event{}, false
+	}
+	evt := qfs.Event{FS: FilestoreType, Path: e.Name, Time: time.Now()}
+	switch {
+	case e.Op&(fsnotify.Create|fsnotify.Write) != 0:
+		evt.Type = qfs.EventPut
+	case e.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+		evt.Type = qfs.EventDelete
+	default:
+		return qfs.Event{}, false
+	}
+	return evt, true
+}
+
+// addDirs watches dir & every directory beneath it
+func addDirs(w *fsnotify.Watcher, dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return w.Add(path)
+		}
+		return nil
+	})
+}
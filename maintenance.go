@@ -0,0 +1,230 @@
+package qfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TimeWindow is a daily span of local time during which maintenance may run.
+// Windows where End is before Start wrap past midnight
+type TimeWindow struct {
+	// Start & End are offsets from midnight
+	Start time.Duration
+	End   time.Duration
+	// Days limits the window to days of the week, keyed by the day the window
+	// starts. An empty list means every day
+	Days []time.Weekday
+}
+
+// Contains reports whether t falls inside the window
+func (w TimeWindow) Contains(t time.Time) bool {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End && w.onDay(t.Weekday())
+	}
+	// wrapping window: the late part belongs to today, the early part to the
+	// window that started yesterday
+	if offset >= w.Start {
+		return w.onDay(t.Weekday())
+	}
+	if offset < w.End {
+		return w.onDay((t.Weekday() + 6) % 7)
+	}
+	return false
+}
+
+func (w TimeWindow) onDay(d time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, day := range w.Days {
+		if day == d {
+			return true
+		}
+	}
+	return false
+}
+
+// PauseDetector reports conditions under which heavy background work should
+// pause, like running on battery or a metered connection
+type PauseDetector interface {
+	// Name identifies the detector in pause reasons
+	Name() string
+	// ShouldPause reports whether work should pause right now
+	ShouldPause(ctx context.Context) (bool, error)
+}
+
+// PauseDetectorFunc adapts a function to the PauseDetector interface
+type PauseDetectorFunc struct {
+	Label string
+	Fn    func(ctx context.Context) (bool, error)
+}
+
+// Name implements the PauseDetector interface
+func (d PauseDetectorFunc) Name() string { return d.Label }
+
+// ShouldPause implements the PauseDetector interface
+func (d PauseDetectorFunc) ShouldPause(ctx context.Context) (bool, error) { return d.Fn(ctx) }
+
+// BatteryDetector pauses work while a battery is discharging. It reads the
+// linux sysfs power supply class, and never pauses on systems without one
+type BatteryDetector struct {
+	// Root defaults to /sys/class/power_supply
+	Root string
+}
+
+// Name implements the PauseDetector interface
+func (d BatteryDetector) Name() string { return "battery" }
+
+// ShouldPause implements the PauseDetector interface
+func (d BatteryDetector) ShouldPause(ctx context.Context) (bool, error) {
+	root := d.Root
+	if root == "" {
+		root = "/sys/class/power_supply"
+	}
+	statuses, err := filepath.Glob(filepath.Join(root, "*", "status"))
+	if err != nil {
+		return false, err
+	}
+	for _, path := range statuses {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if strings.TrimSpace(string(data)) == "Discharging" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// MaintenanceScheduler confines heavy background work (GC, verification,
+// replication, reproviding) to configured windows, pausing it whenever a
+// detector reports it should. A scheduler with no windows allows work at any
+// time detectors don't object
+type MaintenanceScheduler struct {
+	Windows   []TimeWindow
+	Detectors []PauseDetector
+	// CheckInterval is how often waiting & running work rechecks the schedule.
+	// Defaults to one minute
+	CheckInterval time.Duration
+
+	// now is overridden in tests
+	now func() time.Time
+}
+
+// Allowed reports whether maintenance may run now, and if not, why
+func (s *MaintenanceScheduler) Allowed(ctx context.Context) (bool, string) {
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+
+	if len(s.Windows) > 0 {
+		t := now()
+		in := false
+		for _, w := range s.Windows {
+			if w.Contains(t) {
+				in = true
+				break
+			}
+		}
+		if !in {
+			return false, "outside maintenance window"
+		}
+	}
+
+	for _, d := range s.Detectors {
+		pause, err := d.ShouldPause(ctx)
+		if err != nil {
+			log.Debugw("checking pause detector", "detector", d.Name(), "err", err)
+			continue
+		}
+		if pause {
+			return false, fmt.Sprintf("paused by %s", d.Name())
+		}
+	}
+	return true, ""
+}
+
+// Wait blocks until maintenance is allowed or ctx ends
+func (s *MaintenanceScheduler) Wait(ctx context.Context) error {
+	for {
+		ok, reason := s.Allowed(ctx)
+		if ok {
+			return nil
+		}
+		log.Debugw("waiting for maintenance window", "reason", reason)
+		select {
+		case <-time.After(s.interval()):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Do waits until maintenance is allowed, then runs job. The context passed to
+// job is cancelled if maintenance stops being allowed while job runs, and Do
+// returns ErrMaintenancePaused. Jobs should be resumable
+func (s *MaintenanceScheduler) Do(ctx context.Context, job func(ctx context.Context) error) error {
+	if err := s.Wait(ctx); err != nil {
+		return err
+	}
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		lk     sync.Mutex
+		paused bool
+		done   = make(chan struct{})
+	)
+	go func() {
+		t := time.NewTicker(s.interval())
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if ok, reason := s.Allowed(jobCtx); !ok {
+					log.Debugw("pausing maintenance", "reason", reason)
+					lk.Lock()
+					paused = true
+					lk.Unlock()
+					cancel()
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := job(jobCtx)
+	close(done)
+
+	lk.Lock()
+	defer lk.Unlock()
+	if paused {
+		return ErrMaintenancePaused
+	}
+	return err
+}
+
+// ErrMaintenancePaused is returned by MaintenanceScheduler.Do when a job is
+// interrupted because maintenance stopped being allowed
+var ErrMaintenancePaused = errors.New("maintenance paused")
+
+func (s *MaintenanceScheduler) interval() time.Duration {
+	if s.CheckInterval > 0 {
+		return s.CheckInterval
+	}
+	return time.Minute
+}
@@ -0,0 +1,107 @@
+package qfs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTimeWindowContains(t *testing.T) {
+	// 2021-06-07 is a monday
+	at := func(day, hour int) time.Time { return time.Date(2021, 6, day, hour, 0, 0, 0, time.UTC) }
+
+	cases := []struct {
+		w      TimeWindow
+		t      time.Time
+		expect bool
+	}{
+		{TimeWindow{Start: 2 * time.Hour, End: 4 * time.Hour}, at(7, 3), true},
+		{TimeWindow{Start: 2 * time.Hour, End: 4 * time.Hour}, at(7, 4), false},
+		{TimeWindow{Start: 22 * time.Hour, End: 2 * time.Hour}, at(7, 23), true},
+		{TimeWindow{Start: 22 * time.Hour, End: 2 * time.Hour}, at(7, 1), true},
+		{TimeWindow{Start: 22 * time.Hour, End: 2 * time.Hour}, at(7, 12), false},
+		// window starting sunday night still applies early monday
+		{TimeWindow{Start: 22 * time.Hour, End: 2 * time.Hour, Days: []time.Weekday{time.Sunday}}, at(7, 1), true},
+		{TimeWindow{Start: 22 * time.Hour, End: 2 * time.Hour, Days: []time.Weekday{time.Sunday}}, at(7, 23), false},
+	}
+	for i, c := range cases {
+		if got := c.w.Contains(c.t); got != c.expect {
+			t.Errorf("case %d: expected %t, got %t", i, c.expect, got)
+		}
+	}
+}
+
+func TestBatteryDetector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qfs_power_supply")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "BAT0"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	status := filepath.Join(dir, "BAT0", "status")
+
+	d := BatteryDetector{Root: dir}
+	ioutil.WriteFile(status, []byte("Charging\n"), 0644)
+	if pause, _ := d.ShouldPause(context.Background()); pause {
+		t.Errorf("expected charging battery not to pause")
+	}
+	ioutil.WriteFile(status, []byte("Discharging\n"), 0644)
+	if pause, _ := d.ShouldPause(context.Background()); !pause {
+		t.Errorf("expected discharging battery to pause")
+	}
+}
+
+func TestMaintenanceSchedulerDo(t *testing.T) {
+	var metered int32
+	s := &MaintenanceScheduler{
+		CheckInterval: time.Millisecond,
+		Detectors: []PauseDetector{PauseDetectorFunc{
+			Label: "metered",
+			Fn: func(context.Context) (bool, error) {
+				return atomic.LoadInt32(&metered) == 1, nil
+			},
+		}},
+	}
+
+	ctx := context.Background()
+	ran := false
+	if err := s.Do(ctx, func(context.Context) error { ran = true; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if !ran {
+		t.Errorf("expected job to run")
+	}
+
+	err := s.Do(ctx, func(ctx context.Context) error {
+		atomic.StoreInt32(&metered, 1)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(err, ErrMaintenancePaused) {
+		t.Errorf("expected ErrMaintenancePaused. got: %v", err)
+	}
+
+	if ok, reason := s.Allowed(ctx); ok || reason != "paused by metered" {
+		t.Errorf("expected scheduler to be paused by metered detector. got: %t %q", ok, reason)
+	}
+
+	wctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := s.Wait(wctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected wait to block until deadline. got: %v", err)
+	}
+
+	s.now = func() time.Time { return time.Date(2021, 6, 7, 12, 0, 0, 0, time.UTC) }
+	s.Windows = []TimeWindow{{Start: time.Hour, End: 2 * time.Hour}}
+	atomic.StoreInt32(&metered, 0)
+	if ok, reason := s.Allowed(ctx); ok || reason != "outside maintenance window" {
+		t.Errorf("expected scheduler to be outside window. got: %t %q", ok, reason)
+	}
+}
@@ -1,6 +1,7 @@
 package qfs
 
 import (
+	"context"
 	"io"
 	"io/fs"
 	"io/ioutil"
@@ -22,6 +23,11 @@ type MerkleDagStore interface {
 
 	GetBlock(id cid.Cid) (r io.Reader, err error)
 	PutBlock(d []byte) (id cid.Cid, err error)
+	// GetBlocks & PutBlocks read & write batches of blocks, with results in
+	// the order of their arguments. Stores batch work internally, so they're
+	// much faster than a block at a time for DAGs with many small nodes
+	GetBlocks(ctx context.Context, ids []cid.Cid) ([][]byte, error)
+	PutBlocks(ctx context.Context, blocks [][]byte) ([]cid.Cid, error)
 
 	// files
 	PutFile(f fs.File) (PutResult, error)
@@ -141,6 +147,9 @@ func (l Link) IPLD() *format.Link {
 type PutResult struct {
 	Cid  cid.Cid
 	Size int64
+	// Path is the path the content can be read at, when the content was put
+	// through a Filesystem
+	Path string
 }
 
 func (pr *PutResult) ToLink(name string, isFile bool) Link {
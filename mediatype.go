@@ -0,0 +1,51 @@
+package qfs
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+)
+
+// sniffLen is the number of leading bytes http.DetectContentType considers
+const sniffLen = 512
+
+// DetectMediaType picks the media type of content at path that begins with
+// head. head is sniffed with http.DetectContentType, falling back to path's
+// extension when sniffing is inconclusive, which is the case for most text
+// formats like CSV & JSON. Empty content with no known extension has no media
+// type
+func DetectMediaType(path string, head []byte) string {
+	ext := mime.TypeByExtension(filepath.Ext(path))
+	if len(head) == 0 {
+		return ext
+	}
+	if len(head) > sniffLen {
+		head = head[:sniffLen]
+	}
+	sniffed := http.DetectContentType(head)
+	if ext != "" && (sniffed == "application/octet-stream" || sniffed == "text/plain; charset=utf-8") {
+		return ext
+	}
+	return sniffed
+}
+
+// SniffMediaType detects the media type of a seekable reader from its first
+// 512 bytes & path, restoring the reader's offset afterward. If rs can't seek
+// the media type is based on path's extension alone
+func SniffMediaType(path string, rs io.ReadSeeker) string {
+	offset, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return DetectMediaType(path, nil)
+	}
+	defer rs.Seek(offset, io.SeekStart)
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return DetectMediaType(path, nil)
+	}
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(rs, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return DetectMediaType(path, nil)
+	}
+	return DetectMediaType(path, head[:n])
+}
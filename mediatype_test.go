@@ -0,0 +1,60 @@
+package qfs
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestDetectMediaType(t *testing.T) {
+	png := []byte("\x89PNG\x0D\x0A\x1A\x0A rest of the image")
+	cases := []struct {
+		path   string
+		head   []byte
+		expect string
+	}{
+		{"image", png, "image/png"},
+		// sniffed content wins over a misleading extension
+		{"image.txt", png, "image/png"},
+		// inconclusive sniffs fall back to the extension
+		{"data.json", []byte(`{"a":1}`), "application/json"},
+		{"data", []byte("a,b,c\n1,2,3\n"), "text/plain; charset=utf-8"},
+		{"empty.json", nil, "application/json"},
+		{"empty", nil, ""},
+	}
+	for _, c := range cases {
+		if got := DetectMediaType(c.path, c.head); got != c.expect {
+			t.Errorf("%s: expected %q. got: %q", c.path, c.expect, got)
+		}
+	}
+}
+
+func TestMemfileMediaType(t *testing.T) {
+	f := NewMemfileBytes("page", []byte("<html><body>hi</body></html>"))
+	if _, err := f.Read(make([]byte, 6)); err != nil {
+		t.Fatal(err)
+	}
+	if mt := f.MediaType(); mt != "text/html; charset=utf-8" {
+		t.Errorf("expected sniffed html media type. got: %q", mt)
+	}
+	// sniffing doesn't move the read offset
+	rest, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rest) != "<body>hi</body></html>" {
+		t.Errorf("expected reading to resume after sniffing. got: %q", rest)
+	}
+
+	// readers that can't seek are typed by extension
+	r := NewMemfileReader("data.json", io.MultiReader(bytes.NewReader([]byte(`{}`))))
+	if mt := r.MediaType(); mt != "application/json" {
+		t.Errorf("expected extension media type. got: %q", mt)
+	}
+	r = NewMemfileReader("data", strings.NewReader("\x89PNG\x0D\x0A\x1A\x0A"))
+	if mt := r.MediaType(); mt != "image/png" {
+		t.Errorf("expected seekable reader to be sniffed. got: %q", mt)
+	}
+}
@@ -42,6 +42,23 @@ const MemFilestoreType = "mem"
 type MemFS struct {
 	Pinned  bool
 	Network []*MemFS
+	// VerifyContent re-hashes file data on Get, returning an error that
+	// matches ErrIntegrity if the data doesn't match the requested hash
+	VerifyContent bool
+	// UnixFS keys files & directories by the CID ipfs add assigns the same
+	// content, building unixfs DAGs with CidVersion, Chunker & RawLeaves.
+	// Keys then match the paths of an IPFS filesystem with the same add
+	// options
+	UnixFS bool
+	// CidVersion is 0 or 1
+	CidVersion int
+	// Chunker splits file data into blocks, in the "size-<bytes>" &
+	// "rabin-<min>-<avg>-<max>" forms ipfs add accepts. defaults to
+	// "size-262144"
+	Chunker string
+	// RawLeaves stores file data in raw blocks instead of wrapping leaves in
+	// unixfs nodes
+	RawLeaves bool
 
 	filesLk sync.Mutex
 	Files   map[string]filer
@@ -52,13 +69,30 @@ var (
 	_ Filesystem     = (*MemFS)(nil)
 	_ CAFS           = (*MemFS)(nil)
 	_ MerkleDagStore = (*MemFS)(nil)
+	_ PathPredictor  = (*MemFS)(nil)
 )
 
 // NewMemFilesystem allocates an instace of a mapstore that
 // can be used as a PathResolver
-// satisfies the FSConstructor interface
+// satisfies the FSConstructor interface. A "verifyContent" config value of
+// true sets VerifyContent. "unixfs", "cidVersion", "chunker" & "rawLeaves"
+// values set UnixFS, CidVersion, Chunker & RawLeaves
 func NewMemFilesystem(_ context.Context, cfg map[string]interface{}) (Filesystem, error) {
-	return NewMemFS(), nil
+	fs := NewMemFS()
+	fs.VerifyContent, _ = cfg["verifyContent"].(bool)
+	fs.UnixFS, _ = cfg["unixfs"].(bool)
+	fs.Chunker, _ = cfg["chunker"].(string)
+	fs.RawLeaves, _ = cfg["rawLeaves"].(bool)
+	switch v := cfg["cidVersion"].(type) {
+	case int:
+		fs.CidVersion = v
+	case float64:
+		fs.CidVersion = int(v)
+	}
+	if fs.CidVersion != 0 && fs.CidVersion != 1 {
+		return nil, fmt.Errorf("invalid cid version: %d", fs.CidVersion)
+	}
+	return fs, nil
 }
 
 // NewMemFS allocates an instance of a mapstore
@@ -121,6 +155,13 @@ func (m *MemFS) PutFileAtKey(ctx context.Context, key string, file File) error {
 
 // Put adds a file to the store
 func (m *MemFS) Put(ctx context.Context, file File) (key string, err error) {
+	if m.UnixFS {
+		nd, err := m.putUnixFS(ctx, newScratchDAG(), file)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("/%s/%s", MemFilestoreType, nd.Cid()), nil
+	}
 	key, err = m.put(ctx, file)
 	return fmt.Sprintf("/%s/%s", MemFilestoreType, key), err
 }
@@ -192,12 +233,12 @@ func (m *MemFS) put(ctx context.Context, file File) (key string, err error) {
 // Get returns a File from the store
 func (m *MemFS) Get(ctx context.Context, key string) (File, error) {
 	// Check if the local MapStore has the file.
-	f, err := m.getLocal(key)
+	f, err := m.getLocal(key, m.VerifyContent)
 	if err != nil {
 		if errors.Is(err, ErrNotFound) {
 			// Check if the anyone connected on the mock Network has the file.
 			for _, connect := range m.Network {
-				f, err := connect.getLocal(key)
+				f, err := connect.getLocal(key, m.VerifyContent)
 				if err == nil {
 					return f, nil
 				} else if err != ErrNotFound {
@@ -212,7 +253,7 @@ func (m *MemFS) Get(ctx context.Context, key string) (File, error) {
 	return f, nil
 }
 
-func (m *MemFS) getLocal(key string) (File, error) {
+func (m *MemFS) getLocal(key string, verify bool) (File, error) {
 	key = strings.TrimPrefix(key, fmt.Sprintf("/%s/", MemFilestoreType))
 	// key may be of the form /mem/QmFoo/file.json but MemFS indexes its maps
 	// using keys like /mem/QmFoo. Trim after the second part of the key.
@@ -228,7 +269,8 @@ func (m *MemFS) getLocal(key string) (File, error) {
 
 	log.Debugw("get", "hash", parts[0])
 	// Check if the local MemFS has the file
-	f := m.Files[parts[0]]
+	hash := parts[0]
+	f := m.Files[hash]
 	if f == nil {
 		return nil, ErrNotFound
 	}
@@ -240,19 +282,36 @@ func (m *MemFS) getLocal(key string) (File, error) {
 			return nil, ErrNotDirectory
 		}
 		log.Debugf("get part=%s files=%v", parts[0], dir.files)
-		f = m.Files[dir.files[parts[0]]]
+		hash = dir.files[parts[0]]
+		f = m.Files[hash]
 		if f == nil {
 			return nil, ErrNotFound
 		}
 		parts = parts[1:]
 	}
 
+	if file, ok := f.(fsFile); ok && verify {
+		if err := m.verifyFile(hash, file.data); err != nil {
+			return nil, err
+		}
+	}
 	return f.File()
 }
 
+// verifyMemFile checks data hashes to the key it's stored under. Files &
+// blocks are both keyed by the base58 multihash of their data, which is also
+// their CIDv0 string
+func verifyMemFile(hash string, data []byte) error {
+	id, err := cid.Decode(hash)
+	if err != nil {
+		return fmt.Errorf("%w: invalid key %q", ErrIntegrity, hash)
+	}
+	return VerifyBlock(id, data)
+}
+
 // Has returns whether the store has a File with the key
 func (m *MemFS) Has(ctx context.Context, key string) (exists bool, err error) {
-	if _, err := m.getLocal(key); err == nil {
+	if _, err := m.getLocal(key, false); err == nil {
 		return true, nil
 	}
 	return false, nil
@@ -292,6 +351,25 @@ func (m *MemFS) GetNode(id cid.Cid, path ...string) (DagNode, error) {
 		return nil, ErrNotFound
 	}
 
+	// directories are nodes linking to their entries
+	if dir, ok := f.(fsDir); ok {
+		nd := &merkledag.ProtoNode{}
+		for name, hash := range dir.files {
+			chID, err := cid.Decode(hash)
+			if err != nil {
+				return nil, err
+			}
+			var size uint64
+			if ch, ok := m.Files[hash].(fsFile); ok {
+				size = uint64(len(ch.data))
+			}
+			if err := nd.AddRawLink(name, &format.Link{Cid: chID, Size: size}); err != nil {
+				return nil, err
+			}
+		}
+		return &memDagNode{id: id, node: nd}, nil
+	}
+
 	file, err := f.File()
 	if err != nil {
 		return nil, err
@@ -356,6 +434,40 @@ func (m *MemFS) PutBlock(d []byte) (id cid.Cid, err error) {
 	return res.Cid, nil
 }
 
+// GetBlocks reads a batch of blocks
+func (m *MemFS) GetBlocks(ctx context.Context, ids []cid.Cid) ([][]byte, error) {
+	m.filesLk.Lock()
+	defer m.filesLk.Unlock()
+	data := make([][]byte, len(ids))
+	for i, id := range ids {
+		filer, ok := m.Files[id.String()]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+		}
+		f, err := filer.File()
+		if err != nil {
+			return nil, err
+		}
+		if data[i], err = ioutil.ReadAll(f); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// PutBlocks writes a batch of blocks
+func (m *MemFS) PutBlocks(ctx context.Context, blocks [][]byte) ([]cid.Cid, error) {
+	ids := make([]cid.Cid, len(blocks))
+	for i, d := range blocks {
+		res, err := m.putBlock("", d)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = res.Cid
+	}
+	return ids, nil
+}
+
 func (m *MemFS) putBlock(name string, data []byte) (PutResult, error) {
 	m.filesLk.Lock()
 	defer m.filesLk.Unlock()
@@ -397,7 +509,7 @@ func (m *MemFS) PutFile(f fs.File) (PutResult, error) {
 
 func (m *MemFS) GetFile(root cid.Cid, path ...string) (io.ReadCloser, error) {
 	if len(path) > 0 {
-		return nil, fmt.Errorf("memfs does not support pathing beyond a root CID")
+		return nil, fmt.Errorf("%w: memfs pathing beyond a root CID", ErrUnsupported)
 	}
 
 	m.filesLk.Lock()
@@ -573,3 +685,31 @@ func (n *nd) toDir(fs *MemFS) (string, fsDir) {
 	}
 	return hash, dir
 }
+
+// PredictPath computes the path putting file would return without storing
+// it. Directories return an error matching ErrUnsupported
+func (m *MemFS) PredictPath(ctx context.Context, file File) (string, error) {
+	if file.IsDirectory() {
+		return "", fmt.Errorf("%w: mem filesystem can't predict directory paths", ErrUnsupported)
+	}
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return "", err
+	}
+	if m.UnixFS {
+		prefix, err := m.unixfsPrefix()
+		if err != nil {
+			return "", err
+		}
+		nd, err := m.unixfsFile(newScratchDAG(), prefix, data)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("/%s/%s", MemFilestoreType, nd.Cid()), nil
+	}
+	hash, err := hashBytes(data)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("/%s/%s", MemFilestoreType, hash), nil
+}
@@ -3,8 +3,10 @@ package qfs
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"strings"
 	"testing"
 )
 
@@ -66,3 +68,203 @@ func (t testStore) Get(ctx context.Context, path string) (File, error) {
 
 	return nil, ErrNotFound
 }
+
+func TestMemFSVerifyContent(t *testing.T) {
+	ctx := context.Background()
+	fs := NewMemFS()
+	fs.VerifyContent = true
+
+	dirPath, err := fs.Put(ctx, NewMemdir("/",
+		NewMemfileBytes("a.txt", []byte(`this is file a`)),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Get(ctx, dirPath+"/a.txt"); err != nil {
+		t.Fatalf("expected intact file to verify: %s", err)
+	}
+
+	// swap the stored bytes for different content
+	hash, err := hashBytes([]byte(`this is file a`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.Files[hash] = fsFile{name: "a.txt", data: []byte(`tampered`)}
+
+	_, err = fs.Get(ctx, dirPath+"/a.txt")
+	if !errors.Is(err, ErrIntegrity) {
+		t.Errorf("expected ErrIntegrity, got: %v", err)
+	}
+	var corrupt *CorruptBlockError
+	if !errors.As(err, &corrupt) || corrupt.Cid.String() != hash {
+		t.Errorf("expected a corrupt block error for %s, got: %v", hash, err)
+	}
+
+	// files fetched from the network are verified by the fetching store
+	other := NewMemFS()
+	other.VerifyContent = true
+	other.AddConnection(fs)
+	if _, err := other.Get(ctx, "/mem/"+hash); !errors.Is(err, ErrIntegrity) {
+		t.Errorf("expected ErrIntegrity fetching from a peer, got: %v", err)
+	}
+
+	fs.VerifyContent = false
+	if _, err := fs.Get(ctx, dirPath+"/a.txt"); err != nil {
+		t.Errorf("expected unverified get to succeed, got: %v", err)
+	}
+}
+
+func TestMemFSBlockBatches(t *testing.T) {
+	ctx := context.Background()
+	fs := NewMemFS()
+
+	data := [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+	ids, err := fs.PutBlocks(ctx, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, id := range ids {
+		single, err := fs.PutBlock(data[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !id.Equals(single) {
+			t.Errorf("block %d: expected batch cid %s to match PutBlock cid %s", i, id, single)
+		}
+	}
+
+	got, err := fs.GetBlocks(ctx, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range data {
+		if !bytes.Equal(got[i], data[i]) {
+			t.Errorf("block %d: expected %q, got %q", i, data[i], got[i])
+		}
+	}
+
+	missing, err := NewMemFS().PutBlock([]byte("missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.GetBlocks(ctx, append(ids, missing)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got: %v", err)
+	}
+}
+
+func TestMemFSSnapshot(t *testing.T) {
+	ctx := context.Background()
+	fs := NewMemFS()
+
+	dirPath, err := fs.Put(ctx, NewMemdir("/",
+		NewMemfileBytes("a.txt", []byte(`this is file a`)),
+		NewMemdir("sub",
+			NewMemfileBytes("b.txt", []byte(`this is file b`)),
+		),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockID, err := fs.PutBlock([]byte("block"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := fs.Snapshot(buf); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := buf.Bytes()
+
+	loaded, err := LoadMemFS(bytes.NewReader(snapshot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.ObjectCount() != fs.ObjectCount() {
+		t.Errorf("object count mismatch. expected: %d, got: %d", fs.ObjectCount(), loaded.ObjectCount())
+	}
+	for path, expect := range map[string]string{
+		dirPath + "/a.txt":     `this is file a`,
+		dirPath + "/sub/b.txt": `this is file b`,
+	} {
+		f, err := loaded.Get(ctx, path)
+		if err != nil {
+			t.Errorf("getting %s: %s", path, err)
+			continue
+		}
+		data, err := ioutil.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expect {
+			t.Errorf("%s: expected %q, got %q", path, expect, data)
+		}
+	}
+	r, err := loaded.GetBlock(blockID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadAll(r); string(data) != "block" {
+		t.Errorf("expected block data %q, got %q", "block", data)
+	}
+
+	buf.Reset()
+	if err := loaded.Snapshot(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), snapshot) {
+		t.Error("expected snapshot of a loaded store to match the original snapshot")
+	}
+
+	if _, err := LoadMemFS(bytes.NewReader(snapshot[:len(snapshot)-3])); err == nil {
+		t.Error("expected truncated snapshot to fail")
+	}
+	bad := append([]byte{0, 0, 0, 9}, snapshot[4:]...)
+	if _, err := LoadMemFS(bytes.NewReader(bad)); err == nil {
+		t.Error("expected unsupported snapshot version to fail")
+	}
+}
+
+func TestMemFSUnixFS(t *testing.T) {
+	ctx := context.Background()
+	fs := NewMemFS()
+	fs.UnixFS = true
+	fs.VerifyContent = true
+
+	dirPath, err := fs.Put(ctx, NewMemdir("/",
+		NewMemfileBytes("a.txt", []byte(`this is file a`)),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.Get(ctx, dirPath+"/a.txt")
+	if err != nil {
+		t.Fatalf("expected unixfs file to verify: %s", err)
+	}
+	if data, _ := ioutil.ReadAll(f); string(data) != `this is file a` {
+		t.Errorf("unexpected file data: %q", data)
+	}
+
+	// the key of a lone file is the unixfs file's CID, not the data's hash
+	filePath, err := fs.Put(ctx, NewMemfileBytes("a.txt", []byte(`this is file a`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := hashBytes([]byte(`this is file a`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filePath == "/mem/"+hash {
+		t.Errorf("expected unixfs key to differ from the data hash %s", hash)
+	}
+
+	key := strings.TrimPrefix(filePath, "/mem/")
+	fs.Files[key] = fsFile{name: "a.txt", data: []byte(`tampered`)}
+	if _, err := fs.Get(ctx, filePath); !errors.Is(err, ErrIntegrity) {
+		t.Errorf("expected ErrIntegrity, got: %v", err)
+	}
+
+	if _, err := NewMemFilesystem(ctx, map[string]interface{}{"unixfs": true, "cidVersion": 2}); err == nil {
+		t.Error("expected invalid cid version to fail")
+	}
+}
@@ -0,0 +1,160 @@
+package qfs
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+const memSnapshotVersion uint32 = 1
+
+// snapshot entry kinds
+const (
+	memSnapshotFile byte = iota
+	memSnapshotDir
+)
+
+// Snapshot writes every object in the store to w in a compact binary
+// format, read back with LoadMemFS. Objects are written in key order, so
+// snapshots of stores with the same content are identical. Pinned,
+// VerifyContent & Network aren't persisted
+func (m *MemFS) Snapshot(w io.Writer) error {
+	m.filesLk.Lock()
+	defer m.filesLk.Unlock()
+
+	keys := make([]string, 0, len(m.Files))
+	for key := range m.Files {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	sw := &snapshotWriter{w: bufio.NewWriter(w)}
+	if err := binary.Write(sw.w, binary.BigEndian, memSnapshotVersion); err != nil {
+		return err
+	}
+	sw.uvarint(uint64(len(keys)))
+	for _, key := range keys {
+		switch f := m.Files[key].(type) {
+		case fsFile:
+			sw.w.WriteByte(memSnapshotFile)
+			sw.bytes([]byte(key))
+			sw.bytes([]byte(f.name))
+			sw.bytes([]byte(f.path))
+			sw.bytes(f.data)
+		case fsDir:
+			sw.w.WriteByte(memSnapshotDir)
+			sw.bytes([]byte(key))
+			sw.bytes([]byte(f.path))
+			names := make([]string, 0, len(f.files))
+			for name := range f.files {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			sw.uvarint(uint64(len(names)))
+			for _, name := range names {
+				sw.bytes([]byte(name))
+				sw.bytes([]byte(f.files[name]))
+			}
+		default:
+			return fmt.Errorf("snapshotting %s: unexpected object type %T", key, f)
+		}
+		if sw.err != nil {
+			return sw.err
+		}
+	}
+	return sw.w.Flush()
+}
+
+// LoadMemFS reads a store written with Snapshot
+func LoadMemFS(r io.Reader) (*MemFS, error) {
+	sr := &snapshotReader{r: bufio.NewReader(r)}
+	var version uint32
+	if err := binary.Read(sr.r, binary.BigEndian, &version); err != nil {
+		return nil, fmt.Errorf("reading memfs snapshot header: %w", err)
+	}
+	if version != memSnapshotVersion {
+		return nil, fmt.Errorf("unsupported memfs snapshot version: %d", version)
+	}
+
+	m := NewMemFS()
+	count := sr.uvarint()
+	for i := uint64(0); i < count && sr.err == nil; i++ {
+		kind, err := sr.r.ReadByte()
+		if err != nil {
+			sr.err = err
+			break
+		}
+		key := string(sr.bytes())
+		switch kind {
+		case memSnapshotFile:
+			f := fsFile{name: string(sr.bytes()), path: string(sr.bytes())}
+			f.data = sr.bytes()
+			m.Files[key] = f
+		case memSnapshotDir:
+			dir := fsDir{fs: m, path: string(sr.bytes()), files: map[string]string{}}
+			n := sr.uvarint()
+			for j := uint64(0); j < n && sr.err == nil; j++ {
+				name := string(sr.bytes())
+				dir.files[name] = string(sr.bytes())
+			}
+			m.Files[key] = dir
+		default:
+			return nil, fmt.Errorf("reading memfs snapshot: unknown object kind %d", kind)
+		}
+	}
+	if sr.err != nil {
+		if sr.err == io.EOF {
+			sr.err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("reading memfs snapshot: %w", sr.err)
+	}
+	return m, nil
+}
+
+// snapshotWriter writes length-prefixed values, keeping the first error
+type snapshotWriter struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func (sw *snapshotWriter) uvarint(v uint64) {
+	if sw.err == nil {
+		_, sw.err = sw.w.Write(sw.buf[:binary.PutUvarint(sw.buf[:], v)])
+	}
+}
+
+func (sw *snapshotWriter) bytes(b []byte) {
+	sw.uvarint(uint64(len(b)))
+	if sw.err == nil {
+		_, sw.err = sw.w.Write(b)
+	}
+}
+
+// snapshotReader reads values written by a snapshotWriter, keeping the first
+// error
+type snapshotReader struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (sr *snapshotReader) uvarint() uint64 {
+	if sr.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(sr.r)
+	sr.err = err
+	return v
+}
+
+func (sr *snapshotReader) bytes() []byte {
+	n := sr.uvarint()
+	if sr.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	_, sr.err = io.ReadFull(sr.r, b)
+	return b
+}
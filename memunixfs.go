@@ -0,0 +1,130 @@
+package qfs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	bserv "github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	chunker "github.com/ipfs/go-ipfs-chunker"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	format "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-unixfs/importer/balanced"
+	"github.com/ipfs/go-unixfs/importer/helpers"
+	uio "github.com/ipfs/go-unixfs/io"
+)
+
+// newScratchDAG creates a DAG service that keeps blocks in memory, used to
+// build unixfs DAGs whose root CIDs become MemFS keys
+func newScratchDAG() format.DAGService {
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	return merkledag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+}
+
+// unixfsPrefix builds CIDs for the configured CID version
+func (m *MemFS) unixfsPrefix() (cid.Builder, error) {
+	return merkledag.PrefixForCidVersion(m.CidVersion)
+}
+
+// putUnixFS adds a file or directory the way ipfs add does, keying each
+// stored file & directory by the CID of its unixfs node
+func (m *MemFS) putUnixFS(ctx context.Context, dag format.DAGService, file File) (format.Node, error) {
+	prefix, err := m.unixfsPrefix()
+	if err != nil {
+		return nil, err
+	}
+
+	if !file.IsDirectory() {
+		data, err := ioutil.ReadAll(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading from file: %w", err)
+		}
+		nd, err := m.unixfsFile(dag, prefix, data)
+		if err != nil {
+			return nil, err
+		}
+		m.filesLk.Lock()
+		m.Files[nd.Cid().String()] = fsFile{name: file.FileName(), path: file.FullPath(), data: data}
+		m.filesLk.Unlock()
+		return nd, nil
+	}
+
+	dir := fsDir{
+		fs:    m,
+		path:  file.FullPath(),
+		files: map[string]string{},
+	}
+	udir := uio.NewDirectory(dag)
+	udir.SetCidBuilder(prefix)
+	for {
+		f, err := file.NextFile()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("error getting next file: %w", err)
+		}
+		ch, err := m.putUnixFS(ctx, dag, f)
+		if err != nil {
+			return nil, err
+		}
+		if err := udir.AddChild(ctx, f.FileName(), ch); err != nil {
+			return nil, err
+		}
+		dir.files[f.FileName()] = ch.Cid().String()
+	}
+
+	nd, err := udir.GetNode()
+	if err != nil {
+		return nil, err
+	}
+	if err := dag.Add(ctx, nd); err != nil {
+		return nil, err
+	}
+	m.filesLk.Lock()
+	m.Files[nd.Cid().String()] = dir
+	m.filesLk.Unlock()
+	return nd, nil
+}
+
+// unixfsFile chunks data into a balanced unixfs DAG
+func (m *MemFS) unixfsFile(dag format.DAGService, prefix cid.Builder, data []byte) (format.Node, error) {
+	spl, err := chunker.FromString(bytes.NewReader(data), m.Chunker)
+	if err != nil {
+		return nil, err
+	}
+	params := helpers.DagBuilderParams{
+		Maxlinks:   helpers.DefaultLinksPerBlock,
+		CidBuilder: prefix,
+		RawLeaves:  m.RawLeaves,
+		Dagserv:    dag,
+	}
+	db, err := params.New(spl)
+	if err != nil {
+		return nil, err
+	}
+	return balanced.Layout(db)
+}
+
+// verifyFile checks file data hashes to the key it's stored under, either as
+// a block or as a unixfs file
+func (m *MemFS) verifyFile(hash string, data []byte) error {
+	err := verifyMemFile(hash, data)
+	if err == nil || !m.UnixFS {
+		return err
+	}
+	prefix, perr := m.unixfsPrefix()
+	if perr != nil {
+		return err
+	}
+	if nd, ferr := m.unixfsFile(newScratchDAG(), prefix, data); ferr == nil && nd.Cid().String() == hash {
+		return nil
+	}
+	return err
+}
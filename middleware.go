@@ -0,0 +1,164 @@
+package qfs
+
+import (
+	"context"
+	"os"
+	"reflect"
+)
+
+// ReadOnlyMiddlewareType names the ReadOnly middleware in configuration
+const ReadOnlyMiddlewareType = "readonly"
+
+// Middleware wraps a filesystem, adding behaviour like caching, metrics or
+// access control. Middleware should return a filesystem with the same Type as
+// the one it wraps, so the result can stand in for the original in a Mux
+type Middleware func(Filesystem) Filesystem
+
+// MiddlewareConstructor creates middleware from a config map, letting
+// middleware be configured alongside the filesystems it wraps
+type MiddlewareConstructor func(ctx context.Context, cfg map[string]interface{}) (Middleware, error)
+
+// Chain wraps base in middleware. The first middleware is outermost, seeing
+// calls first:
+//
+//   Chain(fs, a, b) == a(b(fs))
+func Chain(base Filesystem, mw ...Middleware) Filesystem {
+	for i := len(mw) - 1; i >= 0; i-- {
+		base = mw[i](base)
+	}
+	return base
+}
+
+// Unwrapper is implemented by middleware & other filesystems that wrap a
+// filesystem. Middleware that only intercepts some operations implements it
+// so capabilities of the filesystem it wraps can still be found with As
+type Unwrapper interface {
+	Unwrap() Filesystem
+}
+
+// Unwrap returns the filesystem fs wraps, or nil if fs doesn't implement
+// Unwrapper
+func Unwrap(fs Filesystem) Filesystem {
+	if u, ok := fs.(Unwrapper); ok {
+		return u.Unwrap()
+	}
+	return nil
+}
+
+// As finds the outermost filesystem in fs's chain of wrapped filesystems
+// that's assignable to the value target points to, setting target to it.
+// Middleware that implements an optional interface itself, like ReadOnly
+// refusing to pin, is found before the filesystems it wraps:
+//
+//	var p qfs.PinningFS
+//	if qfs.As(fs, &p) {
+//		err = p.Pin(ctx, path, true)
+//	}
+//
+// As panics if target isn't a non-nil pointer to an interface or to a type
+// implementing Filesystem
+func As(fs Filesystem, target interface{}) bool {
+	val := reflect.ValueOf(target)
+	if target == nil || val.Kind() != reflect.Ptr || val.IsNil() {
+		panic("qfs: As target must be a non-nil pointer")
+	}
+	typ := val.Type().Elem()
+	if typ.Kind() != reflect.Interface && !typ.Implements(filesystemType) {
+		panic("qfs: As target must be a pointer to an interface or a Filesystem")
+	}
+	for fs != nil {
+		if reflect.TypeOf(fs).AssignableTo(typ) {
+			val.Elem().Set(reflect.ValueOf(fs))
+			return true
+		}
+		fs = Unwrap(fs)
+	}
+	return false
+}
+
+var filesystemType = reflect.TypeOf((*Filesystem)(nil)).Elem()
+
+// ReadOnly wraps fs so it can't be changed: Put, Delete, Pin, Unpin, Copy &
+// Rename fail with ErrReadOnly. Reads pass through to fs, including batched
+// reads, directory listings & stats when fs supports them. ReadOnly is also
+// Middleware
+func ReadOnly(fs Filesystem) Filesystem {
+	return &readOnlyFS{Filesystem: fs}
+}
+
+// NewReadOnlyMiddleware is a MiddlewareConstructor for ReadOnly, which takes
+// no configuration
+func NewReadOnlyMiddleware(context.Context, map[string]interface{}) (Middleware, error) {
+	return ReadOnly, nil
+}
+
+type readOnlyFS struct {
+	Filesystem
+}
+
+var (
+	_ Filesystem   = (*readOnlyFS)(nil)
+	_ DescribingFS = (*readOnlyFS)(nil)
+	_ PinningFS    = (*readOnlyFS)(nil)
+	_ HasManyFS    = (*readOnlyFS)(nil)
+	_ ReadDirFS    = (*readOnlyFS)(nil)
+	_ StatFS       = (*readOnlyFS)(nil)
+	_ WritableFS   = (*readOnlyFS)(nil)
+	_ Unwrapper    = (*readOnlyFS)(nil)
+)
+
+// Unwrap returns the wrapped filesystem
+func (fs *readOnlyFS) Unwrap() Filesystem { return fs.Filesystem }
+
+// Describe returns the wrapped filesystem's descriptor without
+// FeatureWritable & FeaturePinning
+func (fs *readOnlyFS) Describe() Descriptor {
+	d := Describe(fs.Filesystem)
+	d.Features &^= FeatureWritable | FeaturePinning
+	return d
+}
+
+// Put always fails with ErrReadOnly
+func (fs *readOnlyFS) Put(context.Context, File) (string, error) {
+	return "", ErrReadOnly
+}
+
+// Delete always fails with ErrReadOnly
+func (fs *readOnlyFS) Delete(context.Context, string) error {
+	return ErrReadOnly
+}
+
+// Pin always fails with ErrReadOnly
+func (fs *readOnlyFS) Pin(context.Context, string, bool) error {
+	return ErrReadOnly
+}
+
+// Unpin always fails with ErrReadOnly
+func (fs *readOnlyFS) Unpin(context.Context, string, bool) error {
+	return ErrReadOnly
+}
+
+// Copy always fails with ErrReadOnly
+func (fs *readOnlyFS) Copy(context.Context, string, string) error {
+	return ErrReadOnly
+}
+
+// Rename always fails with ErrReadOnly
+func (fs *readOnlyFS) Rename(context.Context, string, string) error {
+	return ErrReadOnly
+}
+
+// HasMany checks paths on the wrapped filesystem
+func (fs *readOnlyFS) HasMany(ctx context.Context, paths []string) (map[string]bool, error) {
+	return HasMany(ctx, fs.Filesystem, paths)
+}
+
+// ReadDir lists a directory of the wrapped filesystem
+func (fs *readOnlyFS) ReadDir(ctx context.Context, path string) ([]DirEntry, error) {
+	return ReadDir(ctx, fs.Filesystem, path)
+}
+
+// Stat describes a path on the wrapped filesystem
+func (fs *readOnlyFS) Stat(ctx context.Context, path string) (os.FileInfo, error) {
+	return Stat(ctx, fs.Filesystem, path)
+}
@@ -0,0 +1,112 @@
+package qfs
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// recordingFS appends its name to a log on each Put before passing it on
+type recordingFS struct {
+	Filesystem
+	name string
+	log  *[]string
+}
+
+func (fs recordingFS) Put(ctx context.Context, f File) (string, error) {
+	*fs.log = append(*fs.log, fs.name)
+	return fs.Filesystem.Put(ctx, f)
+}
+
+func TestChain(t *testing.T) {
+	ctx := context.Background()
+	var order []string
+	named := func(name string) Middleware {
+		return func(fs Filesystem) Filesystem {
+			return recordingFS{Filesystem: fs, name: name, log: &order}
+		}
+	}
+
+	fs := Chain(NewMemFS(), named("outer"), named("inner"))
+	if fs.Type() != MemFilestoreType {
+		t.Errorf("expected chained filesystem to keep type %q. got: %q", MemFilestoreType, fs.Type())
+	}
+	if _, err := fs.Put(ctx, NewMemfileBytes("a.txt", []byte("a"))); err != nil {
+		t.Fatal(err)
+	}
+	if expect := []string{"outer", "inner"}; !reflect.DeepEqual(order, expect) {
+		t.Errorf("unexpected middleware order. want: %v, got: %v", expect, order)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemFS()
+	path, err := mem.Put(ctx, NewMemfileBytes("a.txt", []byte("a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := Chain(mem, ReadOnly)
+	if _, err := fs.Get(ctx, path); err != nil {
+		t.Errorf("expected reads to pass through. got: %s", err)
+	}
+	if _, err := fs.Put(ctx, NewMemfileBytes("b.txt", []byte("b"))); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected put to fail with ErrReadOnly. got: %v", err)
+	}
+	if err := fs.Delete(ctx, path); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected delete to fail with ErrReadOnly. got: %v", err)
+	}
+	pinner, ok := fs.(PinningFS)
+	if !ok {
+		t.Fatal("expected read-only filesystem to implement PinningFS")
+	}
+	if err := pinner.Pin(ctx, path, true); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected pin to fail with ErrReadOnly. got: %v", err)
+	}
+	if err := pinner.Unpin(ctx, path, true); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected unpin to fail with ErrReadOnly. got: %v", err)
+	}
+	has, err := HasMany(ctx, fs, []string{path})
+	if err != nil || !has[path] {
+		t.Errorf("expected HasMany to pass through. got: %v, %v", has, err)
+	}
+	if !Describe(fs).ReadOnly() {
+		t.Error("expected read-only filesystem to be described as read-only")
+	}
+}
+
+func TestAs(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemFS()
+	limited := NewLimitedFS(mem, LimitConfig{Concurrency: 2})
+
+	var dag MerkleDagStore
+	if !As(limited, &dag) {
+		t.Fatal("expected As to find the MerkleDagStore beneath limit middleware")
+	}
+	if dag != mem {
+		t.Errorf("expected As to set target to the wrapped mem filesystem. got: %T", dag)
+	}
+
+	// read-only middleware pins itself, so it's found before the filesystem
+	// it wraps
+	var p PinningFS
+	if !As(Chain(limited, ReadOnly), &p) {
+		t.Fatal("expected As to find a PinningFS")
+	}
+	if err := p.Pin(ctx, "/mem/a", true); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected pin to fail with ErrReadOnly. got: %v", err)
+	}
+
+	// recordingFS doesn't unwrap, hiding the filesystem it wraps
+	if As(recordingFS{Filesystem: mem}, &dag) {
+		t.Error("expected As to stop at filesystems that don't unwrap")
+	}
+
+	var w Watcher
+	if As(limited, &w) {
+		t.Error("expected As to report a missing capability")
+	}
+}
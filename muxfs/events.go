@@ -0,0 +1,58 @@
+package muxfs
+
+import (
+	"context"
+
+	"github.com/qri-io/qfs"
+)
+
+// Events returns the bus the mux publishes changes to. Muxed filesystems
+// that emit their own events have them forwarded to the bus, which includes
+// events the mux didn't cause, like garbage collection. Changes made through
+// the mux to filesystems that don't emit events are published by the mux
+func (m *Mux) Events() *qfs.EventBus {
+	return &m.events
+}
+
+// eventForwarder relays events from a muxed filesystem's bus to the mux bus
+// while the filesystem is muxed
+type eventForwarder struct {
+	m      *Mux
+	fsType string
+}
+
+var _ qfs.EventSink = (*eventForwarder)(nil)
+
+// HandleEvent implements the qfs.EventSink interface
+func (f *eventForwarder) HandleEvent(ctx context.Context, e qfs.Event) error {
+	f.m.lk.RLock()
+	muxed := f.m.forwarders[f.fsType] == f
+	f.m.lk.RUnlock()
+	if muxed {
+		f.m.events.Publish(ctx, e)
+	}
+	return nil
+}
+
+// forwardEvents relays events emitted by a muxed filesystem. Filesystems
+// added after being removed get a new forwarder, so events are never
+// forwarded twice. callers must hold the lock
+func (m *Mux) forwardEvents(fsType string, e qfs.EventEmitter) {
+	if m.forwarders == nil {
+		m.forwarders = map[string]*eventForwarder{}
+	}
+	f := &eventForwarder{m: m, fsType: fsType}
+	m.forwarders[fsType] = f
+	e.Events().AddSink(f)
+}
+
+// publish announces a change made through the mux to a filesystem of type
+// fsType, unless the filesystem announces its own changes
+func (m *Mux) publish(ctx context.Context, fsType string, t qfs.EventType, path string) {
+	m.lk.RLock()
+	_, forwarded := m.forwarders[fsType]
+	m.lk.RUnlock()
+	if !forwarded {
+		m.events.Publish(ctx, qfs.Event{Type: t, FS: fsType, Path: path})
+	}
+}
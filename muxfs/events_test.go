@@ -0,0 +1,72 @@
+package muxfs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/qri-io/qfs"
+)
+
+func TestMuxEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mux, err := New(ctx, []qfs.Config{{Type: qfs.MemFilestoreType}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []qfs.Event
+	mux.Events().AddSink(qfs.EventSinkFunc(func(ctx context.Context, e qfs.Event) error {
+		got = append(got, e)
+		return nil
+	}))
+
+	// the mux publishes changes to filesystems that don't emit events
+	path, err := mux.Put(ctx, qfs.NewMemfileBytes("/mem/a.txt", []byte("a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mux.Delete(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, got, qfs.EventPut, qfs.EventDelete)
+	if got[0].Path != path || got[0].FS != qfs.MemFilestoreType {
+		t.Errorf("unexpected put event: %#v", got[0])
+	}
+
+	// events from filesystems that emit their own are forwarded once
+	got = nil
+	bus := &qfs.EventBus{}
+	emitter := qfs.NewEventFS(qfs.NewMemFS(), bus)
+	if err := mux.Remove(qfs.MemFilestoreType); err != nil {
+		t.Fatal(err)
+	}
+	if err := mux.Add(emitter); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mux.Put(ctx, qfs.NewMemfileBytes("/mem/b.txt", []byte("b"))); err != nil {
+		t.Fatal(err)
+	}
+	bus.Publish(ctx, qfs.Event{Type: qfs.EventGC, FS: qfs.MemFilestoreType, Path: "/mem"})
+	expectEvents(t, got, qfs.EventPut, qfs.EventGC)
+
+	// removed filesystems stop forwarding
+	got = nil
+	if err := mux.Remove(qfs.MemFilestoreType); err != nil {
+		t.Fatal(err)
+	}
+	bus.Publish(ctx, qfs.Event{Type: qfs.EventGC, FS: qfs.MemFilestoreType, Path: "/mem"})
+	expectEvents(t, got)
+}
+
+func expectEvents(t *testing.T, got []qfs.Event, expect ...qfs.EventType) {
+	t.Helper()
+	if len(got) != len(expect) {
+		t.Fatalf("expected events %v. got: %v", expect, got)
+	}
+	for i, typ := range expect {
+		if got[i].Type != typ {
+			t.Errorf("event %d: expected %s. got: %s", i, typ, got[i].Type)
+		}
+	}
+}
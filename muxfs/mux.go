@@ -3,39 +3,88 @@ package muxfs
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
+	"strings"
 	"sync"
 
+	logging "github.com/ipfs/go-log"
 	"github.com/qri-io/qfs"
+	"github.com/qri-io/qfs/cachefs"
 	"github.com/qri-io/qfs/httpfs"
 	"github.com/qri-io/qfs/localfs"
+	"github.com/qri-io/qfs/qgcs"
 	"github.com/qri-io/qfs/qipfs"
+	"github.com/qri-io/qfs/retryfs"
+	"github.com/qri-io/qfs/tmpfs"
+	"github.com/qri-io/qfs/zipfs"
 )
 
 // FilestoreType uniquely identifies the mux filestore
 const FilestoreType = "mux"
 
+var log = logging.Logger("muxfs")
+
 // Mux multiplexes together multiple filesystems using path multiplexing.
 // It's a way to use multiple filesystem implementations as a single FS
 type Mux struct {
+	// lk guards the set of muxed filesystems, which can change at runtime
+	lk       sync.RWMutex
 	handlers map[string]qfs.Filesystem
+	// order lists handler types in the order they were set
+	order []string
 	// sophisticated writes require the Adder interface for writing with hooks.
-	// the first configured filesystem that implements qfs.AddingFS
-	// will be set to this string, and returned by the DefaultWriteFS method
+	// the first configured writable filesystem that implements
+	// qfs.MerkleDagStore will be set to this string, and returned by the
+	// DefaultWriteFS method
 	defaultWriteDestination string
-
+	// blockCache is shared with filesystems that implement qfs.BlockCacheUser
+	blockCache qfs.BlockCache
+	// resolver routes bare CIDs & /ipfs/ paths when set. It's guarded by lk,
+	// read it with cidResolver
+	resolver *cidResolver
+	// routes send puts matching user-supplied rules to specific filesystems
+	routes routes
+	// events receives changes made through the mux & events forwarded from
+	// muxed filesystems that emit their own
+	events     qfs.EventBus
+	forwarders map[string]*eventForwarder
+
+	// releasing holds a stop channel for each muxed ReleasingFilesystem
+	// that hasn't released yet
+	releasing map[string]chan struct{}
+	// ended is set when the context the mux was created with ends, after
+	// which the mux is done as soon as nothing is releasing
+	ended   bool
 	doneCh  chan struct{}
-	doneWg  sync.WaitGroup
+	closed  bool
 	doneErr error
 }
 
 // compile-time assertion that MapStore satisfies the Filesystem interface
-var _ qfs.Filesystem = (*Mux)(nil)
+var (
+	_ qfs.Filesystem    = (*Mux)(nil)
+	_ qfs.ContextScoper = (*Mux)(nil)
+	_ qfs.SessionFS     = (*Mux)(nil)
+	_ qfs.HasManyFS     = (*Mux)(nil)
+	_ qfs.DescribingFS  = (*Mux)(nil)
+	_ qfs.PinningFS     = (*Mux)(nil)
+	_ qfs.PinCheckingFS = (*Mux)(nil)
+	_ qfs.ReadDirFS     = (*Mux)(nil)
+	_ qfs.StatFS        = (*Mux)(nil)
+	_ qfs.Watcher       = (*Mux)(nil)
+	_ qfs.EventEmitter  = (*Mux)(nil)
+	_ qfs.WritableFS    = (*Mux)(nil)
+)
 
 // New creates a new Mux Filesystem, if no Option funcs are provided,
 // New uses a default set of Option funcs. Any Option functions passed to this
 // function must check whether their fields are nil or not.
-// The first configured filesystem that implements the qfs.AddingFS interface
-// becomes the default filesystem returned by DefaultWriteFS
+// The first configured writable filesystem that implements the
+// qfs.MerkleDagStore interface becomes the default filesystem returned by
+// DefaultWriteFS. Filesystems are wrapped in the middleware listed in their
+// config. The mux is done once ctx ends & every muxed ReleasingFilesystem has
+// released
 func New(ctx context.Context, cfgs []qfs.Config) (*Mux, error) {
 	mux := &Mux{
 		handlers: map[string]qfs.Filesystem{},
@@ -50,6 +99,9 @@ func New(ctx context.Context, cfgs []qfs.Config) (*Mux, error) {
 		if err != nil {
 			return nil, fmt.Errorf("constructing %q filesystem: %w", cfg.Type, err)
 		}
+		if fs, err = applyMiddleware(ctx, fs, cfg.Middleware); err != nil {
+			return nil, fmt.Errorf("constructing %q filesystem: %w", cfg.Type, err)
+		}
 
 		if err := mux.SetFilesystem(fs); err != nil {
 			return nil, err
@@ -57,15 +109,29 @@ func New(ctx context.Context, cfgs []qfs.Config) (*Mux, error) {
 	}
 
 	go func() {
-		mux.doneWg.Wait()
-		close(mux.doneCh)
+		<-ctx.Done()
+		mux.lk.Lock()
+		defer mux.lk.Unlock()
+		mux.ended = true
+		mux.checkDone()
 	}()
 
 	return mux, nil
 }
 
-// SetFilesystem designates the resolver for a given path kind string
+// SetFilesystem designates the resolver for a given path kind string. It's
+// equivalent to Add
 func (m *Mux) SetFilesystem(fs qfs.Filesystem) error {
+	return m.Add(fs)
+}
+
+// Add registers a filesystem with the mux, routing paths of its type to it.
+// Filesystems can be added while the mux is in use, but a mux that's done
+// rejects new filesystems. Only one filesystem of each type can be muxed at
+// a time, use Remove first to swap one out
+func (m *Mux) Add(fs qfs.Filesystem) error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
 	if m.handlers == nil {
 		m.handlers = map[string]qfs.Filesystem{}
 	}
@@ -73,29 +139,167 @@ func (m *Mux) SetFilesystem(fs qfs.Filesystem) error {
 	if m.handlers[fs.Type()] != nil {
 		return fmt.Errorf("mux already has a %q filesystem", fs.Type())
 	}
+	if m.closed {
+		return fmt.Errorf("adding %q filesystem: mux is done", fs.Type())
+	}
 
-	if releaser, ok := fs.(qfs.ReleasingFilesystem); ok {
-		m.doneWg.Add(1)
-		go func(releaser qfs.ReleasingFilesystem) {
-			<-releaser.Done()
-			m.doneErr = releaser.DoneErr()
-			m.doneWg.Done()
-		}(releaser)
+	// capabilities are looked up beneath middleware with qfs.As, so a wrapped
+	// filesystem is still released, pinned & written to like a bare one
+	var releaser qfs.ReleasingFilesystem
+	if qfs.As(fs, &releaser) {
+		m.watchRelease(fs.Type(), releaser)
 	}
-	if m.defaultWriteDestination == "" {
-		if _, ok := fs.(qfs.MerkleDagStore); ok {
-			m.defaultWriteDestination = fs.Type()
-		}
+	if m.defaultWriteDestination == "" && isDefaultWriteFS(fs) {
+		m.defaultWriteDestination = fs.Type()
+	}
+
+	var u qfs.BlockCacheUser
+	if m.blockCache != nil && qfs.As(fs, &u) {
+		u.SetBlockCache(m.blockCache)
+	}
+	var e qfs.EventEmitter
+	if qfs.As(fs, &e) {
+		m.forwardEvents(fs.Type(), e)
 	}
 
 	m.handlers[fs.Type()] = fs
+	m.order = append(m.order, fs.Type())
 	return nil
 }
 
+// Remove unregisters the filesystem of type fsType. The filesystem isn't
+// closed, and the mux no longer waits for it to release before it's done.
+// Put routes to fsType stay in place, and apply again if a filesystem of the
+// same type is added. Open sessions keep using the filesystems they started
+// with until they're closed
+func (m *Mux) Remove(fsType string) error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	if m.handlers[fsType] == nil {
+		return fmt.Errorf("mux has no %q filesystem", fsType)
+	}
+
+	delete(m.handlers, fsType)
+	delete(m.forwarders, fsType)
+	for i, kind := range m.order {
+		if kind == fsType {
+			m.order = append(m.order[:i:i], m.order[i+1:]...)
+			break
+		}
+	}
+	if stop, ok := m.releasing[fsType]; ok {
+		close(stop)
+		delete(m.releasing, fsType)
+	}
+
+	if m.defaultWriteDestination == fsType {
+		m.defaultWriteDestination = ""
+		for _, kind := range m.order {
+			if isDefaultWriteFS(m.handlers[kind]) {
+				m.defaultWriteDestination = kind
+				break
+			}
+		}
+	}
+	m.checkDone()
+	return nil
+}
+
+// isDefaultWriteFS reports whether fs can be the default write destination
+func isDefaultWriteFS(fs qfs.Filesystem) bool {
+	var dag qfs.MerkleDagStore
+	return qfs.As(fs, &dag) && qfs.Describe(fs).Has(qfs.FeatureWritable)
+}
+
+// watchRelease tracks a releasing filesystem until it's done or removed.
+// callers must hold the lock
+func (m *Mux) watchRelease(fsType string, releaser qfs.ReleasingFilesystem) {
+	if m.releasing == nil {
+		m.releasing = map[string]chan struct{}{}
+	}
+	stop := make(chan struct{})
+	m.releasing[fsType] = stop
+	go func() {
+		select {
+		case <-releaser.Done():
+		case <-stop:
+			return
+		}
+		m.lk.Lock()
+		defer m.lk.Unlock()
+		select {
+		case <-stop:
+			// removed while releasing
+			return
+		default:
+		}
+		delete(m.releasing, fsType)
+		m.doneErr = releaser.DoneErr()
+		m.checkDone()
+	}()
+}
+
+// checkDone closes the done channel once every registered releasing
+// filesystem has released. callers must hold the lock
+func (m *Mux) checkDone() {
+	if !m.ended || m.closed || m.doneCh == nil || len(m.releasing) > 0 {
+		return
+	}
+	m.closed = true
+	close(m.doneCh)
+}
+
+// handler returns the filesystem for paths of kind
+func (m *Mux) handler(kind string) (qfs.Filesystem, bool) {
+	m.lk.RLock()
+	defer m.lk.RUnlock()
+	fs, ok := m.handlers[kind]
+	return fs, ok
+}
+
+// Describe reports the mux as having the union of its members' features
+func (m *Mux) Describe() qfs.Descriptor {
+	m.lk.RLock()
+	defer m.lk.RUnlock()
+	d := qfs.Descriptor{Type: FilestoreType}
+	for _, fs := range m.handlers {
+		d.Features |= qfs.Describe(fs).Features
+	}
+	return d
+}
+
+// Members returns muxed filesystems that have every feature in required, in
+// the order they were added
+func (m *Mux) Members(required qfs.Feature) []qfs.Filesystem {
+	m.lk.RLock()
+	defer m.lk.RUnlock()
+	members := []qfs.Filesystem{}
+	for _, kind := range m.order {
+		if fs := m.handlers[kind]; qfs.Describe(fs).Has(required) {
+			members = append(members, fs)
+		}
+	}
+	return members
+}
+
+// writeHandler returns the filesystem that handles writes to paths of kind,
+// refusing read-only filesystems before they're sent the write
+func (m *Mux) writeHandler(kind, path string) (qfs.Filesystem, error) {
+	handler, ok := m.handler(kind)
+	if !ok {
+		return nil, noMuxerError(kind, path)
+	}
+	if qfs.Describe(handler).ReadOnly() {
+		return nil, fmt.Errorf("%w: %q filesystem. path: %s", qfs.ErrReadOnly, kind, path)
+	}
+	return handler, nil
+}
+
 // Filesystem returns the filesystem for a given fs type string, nil if no
 // filesystem for fsType exists
 func (m *Mux) Filesystem(fsType string) qfs.Filesystem {
-	return m.handlers[fsType]
+	fs, _ := m.handler(fsType)
+	return fs
 }
 
 // KnownFSTypes gives the set of filesystems known to muxfs.New
@@ -105,6 +309,9 @@ func KnownFSTypes() []string {
 		qipfs.FilestoreType,
 		localfs.FilestoreType,
 		qfs.MemFilestoreType,
+		tmpfs.FilestoreType,
+		qgcs.FilestoreType,
+		zipfs.FilestoreType,
 	}
 }
 
@@ -114,6 +321,34 @@ var constructors = map[string]qfs.Constructor{
 	qipfs.FilestoreType:   qipfs.NewFilesystem,
 	localfs.FilestoreType: localfs.NewFilesystem,
 	qfs.MemFilestoreType:  qfs.NewMemFilesystem,
+	tmpfs.FilestoreType:   tmpfs.NewFilesystem,
+	qgcs.FilestoreType:    qgcs.NewFilesystem,
+	zipfs.FilestoreType:   zipfs.NewFilesystem,
+}
+
+// middlewares maps middleware type strings to constructor functions
+var middlewares = map[string]qfs.MiddlewareConstructor{
+	qfs.ReadOnlyMiddlewareType: qfs.NewReadOnlyMiddleware,
+	qfs.LimitMiddlewareType:    qfs.NewLimitMiddleware,
+	cachefs.MiddlewareType:     cachefs.NewMiddleware,
+	retryfs.MiddlewareType:     retryfs.NewMiddleware,
+}
+
+// applyMiddleware wraps fs in configured middleware, outermost first
+func applyMiddleware(ctx context.Context, fs qfs.Filesystem, cfgs []qfs.Config) (qfs.Filesystem, error) {
+	mw := make([]qfs.Middleware, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		constructor, ok := middlewares[cfg.Type]
+		if !ok {
+			return nil, fmt.Errorf("unrecognized middleware type: %q", cfg.Type)
+		}
+		m, err := constructor(ctx, cfg.Config)
+		if err != nil {
+			return nil, fmt.Errorf("constructing %q middleware: %w", cfg.Type, err)
+		}
+		mw = append(mw, m)
+	}
+	return qfs.Chain(fs, mw...), nil
 }
 
 // Type distinguishes this filesystem from others by a unique string prefix
@@ -121,16 +356,58 @@ func (m *Mux) Type() string { return FilestoreType }
 
 // DoneErr will return any error value after the done channel is closed
 func (m *Mux) DoneErr() error {
+	m.lk.RLock()
+	defer m.lk.RUnlock()
 	return m.doneErr
 }
 
-// Done implements the qfs.ReleasingFilesystem interface
+// Done implements the qfs.ReleasingFilesystem interface. The channel closes
+// once the context the mux was created with ends & every muxed
+// ReleasingFilesystem has released
 func (m *Mux) Done() <-chan struct{} {
 	return m.doneCh
 }
 
+// canonicalPath rewrites a path returned by fs into the mux namespace. Paths
+// in content-addressed filesystems always carry the filesystem's prefix,
+// other paths pass through unchanged
+func canonicalPath(fs qfs.Filesystem, path string) string {
+	if !qfs.Describe(fs).Has(qfs.FeatureContentAddressed) {
+		return path
+	}
+	return qfs.CanonicalPath(fs.Type(), path)
+}
+
+// canonicalFile presents f at the canonical form of path in fs
+func canonicalFile(fs qfs.Filesystem, path string, f qfs.File) qfs.File {
+	if strings.HasPrefix(path, "/ipns/") {
+		// files read through a name keep the path of the content it resolved to
+		return f
+	}
+	if p := canonicalPath(fs, path); p != f.FullPath() {
+		return &pathFile{File: f, path: p}
+	}
+	return f
+}
+
+// pathFile is a file presented at a rewritten path
+type pathFile struct {
+	qfs.File
+	path string
+}
+
+func (f *pathFile) FullPath() string { return f.path }
+func (f *pathFile) Size() int64      { return qfs.FileSize(f.File) }
+
+func (f *pathFile) Seek(offset int64, whence int) (int64, error) {
+	if s, ok := f.File.(io.Seeker); ok {
+		return s.Seek(offset, whence)
+	}
+	return 0, qfs.ErrNotSeekable
+}
+
 func noMuxerError(kind, path string) error {
-	return fmt.Errorf("cannot resolve paths of kind '%s'. path: %s", kind, path)
+	return fmt.Errorf("%w: cannot resolve paths of kind '%s'. path: %s", qfs.ErrUnsupported, kind, path)
 }
 
 // Has returns whether the store has a File with the given path
@@ -138,57 +415,401 @@ func (m *Mux) Has(ctx context.Context, path string) (bool, error) {
 	if path == "" {
 		return false, nil
 	}
+	path = m.route(path)
+	if r := m.cidResolver(); r != nil {
+		if id, rest, ok := cidPath(path); ok {
+			return r.has(ctx, m, id, rest)
+		}
+	}
 
 	kind := qfs.PathKind(path)
-	handler, ok := m.handlers[kind]
+	handler, ok := m.handler(kind)
 	if !ok {
 		return false, noMuxerError(kind, path)
 	}
 
-	return handler.Has(ctx, path)
+	return qfs.TraceFilesystem(handler).Has(ctx, path)
 }
 
-// Get a path
-func (m *Mux) Get(ctx context.Context, path string) (qfs.File, error) {
-	if path == "" {
-		return nil, qfs.ErrNotFound
+// ReadDir lists a directory with the filesystem its path kind routes to
+func (m *Mux) ReadDir(ctx context.Context, path string) ([]qfs.DirEntry, error) {
+	path = m.route(path)
+	kind := qfs.PathKind(path)
+	handler, ok := m.handler(kind)
+	if !ok {
+		return nil, noMuxerError(kind, path)
 	}
+	return qfs.ReadDir(ctx, handler, path)
+}
 
+// Stat describes a path with the filesystem its path kind routes to
+func (m *Mux) Stat(ctx context.Context, path string) (os.FileInfo, error) {
+	path = m.route(path)
 	kind := qfs.PathKind(path)
-	handler, ok := m.handlers[kind]
+	handler, ok := m.handler(kind)
 	if !ok {
 		return nil, noMuxerError(kind, path)
 	}
+	return qfs.Stat(ctx, handler, path)
+}
+
+// HasMany checks a batch of paths, grouping them by kind so each muxed
+// filesystem answers its paths in a single qfs.HasMany call. With a CID
+// resolution set, bare CIDs & /ipfs/ paths are checked in resolution order
+func (m *Mux) HasMany(ctx context.Context, paths []string) (map[string]bool, error) {
+	byKind := map[string][]string{}
+	// requested maps each stored path back to the paths it was asked for by
+	requested := map[string][]string{}
+	res := make(map[string]bool, len(paths))
+	r := m.cidResolver()
+	var cidPaths []string
+	for _, path := range paths {
+		if path == "" {
+			res[path] = false
+			continue
+		}
+		stored := m.route(path)
+		if _, _, ok := cidPath(stored); ok && r != nil {
+			if _, ok := requested[stored]; !ok {
+				cidPaths = append(cidPaths, stored)
+			}
+		} else if _, ok := requested[stored]; !ok {
+			kind := qfs.PathKind(stored)
+			if _, ok := m.handler(kind); !ok {
+				return nil, noMuxerError(kind, stored)
+			}
+			byKind[kind] = append(byKind[kind], stored)
+		}
+		requested[stored] = append(requested[stored], path)
+	}
+
+	for kind, kindPaths := range byKind {
+		handler, ok := m.handler(kind)
+		if !ok {
+			return nil, noMuxerError(kind, kindPaths[0])
+		}
+		found, err := qfs.HasMany(ctx, handler, kindPaths)
+		if err != nil {
+			return nil, err
+		}
+		for stored, has := range found {
+			for _, path := range requested[stored] {
+				res[path] = has
+			}
+		}
+	}
+
+	if len(cidPaths) > 0 {
+		found, err := r.hasMany(ctx, m, cidPaths)
+		if err != nil {
+			return nil, err
+		}
+		for stored, has := range found {
+			for _, path := range requested[stored] {
+				res[path] = has
+			}
+		}
+	}
+	return res, nil
+}
 
-	return handler.Get(ctx, path)
+// Get a path. When ctx is created with qfs.WithFollowLinks, link files are
+// resolved through the mux, so links can point into any muxed filesystem
+func (m *Mux) Get(ctx context.Context, path string) (f qfs.File, err error) {
+	if path == "" {
+		return nil, qfs.ErrNotFound
+	}
+	span, ctx := qfs.StartSpan(ctx, "get", FilestoreType, path)
+	defer func() { span.Finish(0, err) }()
+
+	path = m.route(path)
+	r := m.cidResolver()
+	if id, rest, ok := cidPath(path); ok && r != nil {
+		f, err = r.get(ctx, m, id, rest)
+	} else {
+		kind := qfs.PathKind(path)
+		handler, ok := m.handler(kind)
+		if !ok {
+			return nil, noMuxerError(kind, path)
+		}
+		if f, err = qfs.TraceFilesystem(handler).Get(ctx, path); err == nil {
+			f = canonicalFile(handler, path, f)
+		}
+	}
+	if err != nil || !qfs.FollowLinksFromContext(ctx) {
+		return f, err
+	}
+	return qfs.FollowLinks(ctx, m, f)
 }
 
 // Put places a file or directory on the filesystem, returning the root path.
-// The returned path may or may not honor the path of the given file
+// The returned path may or may not honor the path of the given file. Files
+// that match a rule added with AddRoute go to the rule's filesystem, all
+// others are routed by path kind
 func (m *Mux) Put(ctx context.Context, file qfs.File) (resPath string, err error) {
+	span, ctx := qfs.StartSpan(ctx, "put", FilestoreType, file.FullPath())
+	defer func() { span.Finish(0, err) }()
+
+	if resPath, routed, err := m.putRouted(ctx, file); routed {
+		return resPath, err
+	}
 	path := file.FullPath()
+	handler, err := m.writeHandler(qfs.PathKind(path), path)
+	if err != nil {
+		return "", err
+	}
+
+	if resPath, err = qfs.TraceFilesystem(handler).Put(ctx, file); err != nil {
+		return "", err
+	}
+	resPath = canonicalPath(handler, resPath)
+	m.publish(ctx, handler.Type(), qfs.EventPut, resPath)
+	return resPath, nil
+}
+
+// Delete removes a file or directory from the filesystem. Deleting a routed
+// path removes the file from where it was stored & forgets the route
+func (m *Mux) Delete(ctx context.Context, path string) (err error) {
+	span, ctx := qfs.StartSpan(ctx, "delete", FilestoreType, path)
+	defer func() { span.Finish(0, err) }()
+
+	path = m.route(path)
+	handler, err := m.writeHandler(qfs.PathKind(path), path)
+	if err != nil {
+		return err
+	}
+
+	if err := qfs.TraceFilesystem(handler).Delete(ctx, path); err != nil {
+		return err
+	}
+	m.dropRoutes(path)
+	m.publish(ctx, handler.Type(), qfs.EventDelete, path)
+	return nil
+}
+
+// Pin pins path on the filesystem its kind routes to. Filesystems that don't
+// pin return an error matching qfs.ErrUnsupported
+func (m *Mux) Pin(ctx context.Context, path string, recursive bool) (err error) {
+	span, ctx := qfs.StartSpan(ctx, "pin", FilestoreType, path)
+	defer func() { span.Finish(0, err) }()
+
+	path = m.route(path)
+	p, err := m.pinner(path)
+	if err != nil {
+		return err
+	}
+	if err := p.Pin(ctx, path, recursive); err != nil {
+		return err
+	}
+	m.publish(ctx, qfs.PathKind(path), qfs.EventPin, path)
+	return nil
+}
+
+// Unpin unpins path on the filesystem its kind routes to
+func (m *Mux) Unpin(ctx context.Context, path string, recursive bool) (err error) {
+	span, ctx := qfs.StartSpan(ctx, "unpin", FilestoreType, path)
+	defer func() { span.Finish(0, err) }()
+
+	path = m.route(path)
+	p, err := m.pinner(path)
+	if err != nil {
+		return err
+	}
+	if err := p.Unpin(ctx, path, recursive); err != nil {
+		return err
+	}
+	m.publish(ctx, qfs.PathKind(path), qfs.EventUnpin, path)
+	return nil
+}
+
+// IsPinned checks path's pins on the filesystem its kind routes to.
+// Filesystems that can't report pins return an error matching
+// qfs.ErrUnsupported
+func (m *Mux) IsPinned(ctx context.Context, path string) (bool, error) {
+	path = m.route(path)
 	kind := qfs.PathKind(path)
-	handler, ok := m.handlers[kind]
+	handler, ok := m.handler(kind)
 	if !ok {
-		return "", noMuxerError(kind, path)
+		return false, noMuxerError(kind, path)
 	}
+	var pc qfs.PinCheckingFS
+	if !qfs.As(handler, &pc) {
+		return false, fmt.Errorf("%w: %q filesystem can't check pins. path: %s", qfs.ErrUnsupported, qfs.PathKind(path), path)
+	}
+	return pc.IsPinned(ctx, path)
+}
 
-	return handler.Put(ctx, file)
+// Copy copies src to dst on the filesystem src's kind routes to. dst is
+// passed through as is & read by that filesystem, so copying /ipfs/ content
+// takes an MFS path. Filesystems that can't copy in place return an error
+// matching qfs.ErrUnsupported
+func (m *Mux) Copy(ctx context.Context, src, dst string) (err error) {
+	span, ctx := qfs.StartSpan(ctx, "copy", FilestoreType, src)
+	defer func() { span.Finish(0, err) }()
+
+	src = m.route(src)
+	w, err := m.writable(src)
+	if err != nil {
+		return err
+	}
+	return w.Copy(ctx, src, dst)
 }
 
-// Delete removes a file or directory from the filesystem
-func (m *Mux) Delete(ctx context.Context, path string) (err error) {
+// Rename moves src to dst on the filesystem src's kind routes to. Renaming a
+// routed path forgets the route, dst is read as is afterwards
+func (m *Mux) Rename(ctx context.Context, src, dst string) (err error) {
+	span, ctx := qfs.StartSpan(ctx, "rename", FilestoreType, src)
+	defer func() { span.Finish(0, err) }()
+
+	src = m.route(src)
+	w, err := m.writable(src)
+	if err != nil {
+		return err
+	}
+	if err := w.Rename(ctx, src, dst); err != nil {
+		return err
+	}
+	m.dropRoutes(src)
+	return nil
+}
+
+func (m *Mux) writable(path string) (qfs.WritableFS, error) {
+	kind := qfs.PathKind(path)
+	handler, err := m.writeHandler(kind, path)
+	if err != nil {
+		return nil, err
+	}
+	var w qfs.WritableFS
+	if !qfs.As(handler, &w) {
+		return nil, fmt.Errorf("%w: %q filesystem can't copy or rename. path: %s", qfs.ErrUnsupported, kind, path)
+	}
+	return w, nil
+}
+
+func (m *Mux) pinner(path string) (qfs.PinningFS, error) {
+	kind := qfs.PathKind(path)
+	handler, ok := m.handler(kind)
+	if !ok {
+		return nil, noMuxerError(kind, path)
+	}
+	var p qfs.PinningFS
+	if !qfs.As(handler, &p) {
+		return nil, fmt.Errorf("%w: %q filesystem doesn't pin. path: %s", qfs.ErrUnsupported, kind, path)
+	}
+	return p, nil
+}
+
+// Watch watches path on the filesystem its kind routes to. Filesystems that
+// don't report changes return an error matching qfs.ErrUnsupported
+func (m *Mux) Watch(ctx context.Context, path string) (<-chan qfs.Event, error) {
+	path = m.route(path)
+	kind := qfs.PathKind(path)
+	handler, ok := m.handler(kind)
+	if !ok {
+		return nil, noMuxerError(kind, path)
+	}
+	var w qfs.Watcher
+	if !qfs.As(handler, &w) {
+		return nil, fmt.Errorf("%w: %q filesystem doesn't watch. path: %s", qfs.ErrUnsupported, kind, path)
+	}
+	return w.Watch(ctx, path)
+}
+
+// WithContext returns a view of the mux whose operations and resources are
+// bound to ctx. Resources are released when ctx ends
+func (m *Mux) WithContext(ctx context.Context) qfs.Filesystem {
+	return qfs.NewScopedFilesystem(ctx, m)
+}
+
+// NewSession creates a session that opens a session on each muxed filesystem
+// the first time a path of that kind is read
+func (m *Mux) NewSession(ctx context.Context) (qfs.Session, error) {
+	return &muxSession{mux: m, ctx: ctx, sessions: map[string]qfs.Session{}}, nil
+}
+
+type muxSession struct {
+	mux *Mux
+	ctx context.Context
+
+	lk       sync.Mutex
+	closed   bool
+	sessions map[string]qfs.Session
+}
+
+// Get a path within the session
+func (s *muxSession) Get(ctx context.Context, path string) (qfs.File, error) {
+	if path == "" {
+		return nil, qfs.ErrNotFound
+	}
+	path = s.mux.route(path)
+
 	kind := qfs.PathKind(path)
-	handler, ok := m.handlers[kind]
+	handler, ok := s.mux.handler(kind)
+	if !ok {
+		return nil, noMuxerError(kind, path)
+	}
+
+	s.lk.Lock()
+	if s.closed || s.ctx.Err() != nil {
+		s.lk.Unlock()
+		return nil, qfs.ErrSessionClosed
+	}
+	sess, ok := s.sessions[kind]
 	if !ok {
-		return noMuxerError(kind, path)
+		var err error
+		if sess, err = qfs.NewSession(s.ctx, handler); err != nil {
+			s.lk.Unlock()
+			return nil, err
+		}
+		s.sessions[kind] = sess
+	}
+	s.lk.Unlock()
+
+	span, ctx := qfs.StartSpan(ctx, "get", handler.Type(), path)
+	f, err := sess.Get(ctx, path)
+	span.Finish(0, err)
+	if err != nil {
+		return nil, err
+	}
+	f = qfs.TraceFile(ctx, handler.Type(), canonicalFile(handler, path, f))
+	if qfs.FollowLinksFromContext(ctx) {
+		return qfs.FollowLinks(ctx, s, f)
+	}
+	return f, nil
+}
+
+// Close closes all sessions opened on muxed filesystems
+func (s *muxSession) Close() (err error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.closed = true
+	for _, sess := range s.sessions {
+		if e := sess.Close(); e != nil && err == nil {
+			err = e
+		}
 	}
+	s.sessions = nil
+	return err
+}
 
-	return handler.Delete(ctx, path)
+// SetBlockCache shares a block cache between all muxed filesystems that
+// implement qfs.BlockCacheUser, including ones added later
+func (m *Mux) SetBlockCache(c qfs.BlockCache) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	m.blockCache = c
+	for _, fs := range m.handlers {
+		var u qfs.BlockCacheUser
+		if qfs.As(fs, &u) {
+			u.SetBlockCache(c)
+		}
+	}
 }
 
 // DefaultWriteFS gives the muxer's configured write destination
 func (m *Mux) DefaultWriteFS() qfs.Filesystem {
+	m.lk.RLock()
+	defer m.lk.RUnlock()
 	if m.defaultWriteDestination != "" {
 		return m.handlers[m.defaultWriteDestination]
 	}
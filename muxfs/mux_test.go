@@ -2,13 +2,22 @@ package muxfs
 
 import (
 	"context"
+	"errors"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
 	"github.com/qri-io/qfs"
+	"github.com/qri-io/qfs/cachefs"
 	"github.com/qri-io/qfs/qipfs"
+	"github.com/qri-io/qfs/retryfs"
+	"github.com/qri-io/qfs/tmpfs"
 )
 
 func TestDefaultNewMux(t *testing.T) {
@@ -147,3 +156,515 @@ func TestRepoLockPerContext(t *testing.T) {
 	}
 
 }
+
+func TestMuxWriteBackReadYourWrites(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	remote := qfs.InjectFaults(qfs.NewMemFS(), qfs.Slow(qfs.FaultOpPut, time.Hour))
+	wb := qfs.NewWriteBackFS(ctx, remote, qfs.NewMemFS())
+	mux := &Mux{}
+	if err := mux.SetFilesystem(wb); err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := mux.Put(ctx, qfs.NewMemfileBytes("/mem/a.txt", []byte("hello")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// replication is stalled, reads through the mux must hit the staging area
+	if has, err := mux.Has(ctx, path); err != nil || !has {
+		t.Errorf("expected mux to have %q. got: %t, %v", path, has, err)
+	}
+	f, err := mux.Get(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" {
+		t.Errorf("content mismatch. want: %q got: %q", "hello", string(data))
+	}
+	if wb.Pending() != 1 {
+		t.Errorf("expected 1 pending write. got: %d", wb.Pending())
+	}
+}
+
+func TestMuxFollowLinks(t *testing.T) {
+	ctx := context.Background()
+	mux := &Mux{}
+	if err := mux.SetFilesystem(qfs.NewMemFS()); err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := mux.Put(ctx, qfs.NewMemfileBytes("/mem/body.csv", []byte("a,b,c")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	link, err := mux.Put(ctx, qfs.NewSoftLink("/mem/body_link", target))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := mux.Get(ctx, link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, isLink, _ := qfs.ReadLink(f); !isLink {
+		t.Errorf("expected links not to be followed by default")
+	}
+
+	f, err = mux.Get(qfs.WithFollowLinks(ctx), link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "a,b,c" {
+		t.Errorf("expected followed link to read target content. got: %q", string(data))
+	}
+}
+
+func TestMuxHasMany(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tmp, err := tmpfs.NewFS(ctx, tmpfs.DefaultFSConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := &Mux{}
+	for _, fs := range []qfs.Filesystem{qfs.NewMemFS(), tmp} {
+		if err := mux.SetFilesystem(fs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	memPath, err := mux.Put(ctx, qfs.NewMemfileBytes("/mem/a.txt", []byte("a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpPath, err := tmp.Put(ctx, qfs.NewMemfileBytes("b.txt", []byte("b")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := mux.HasMany(ctx, []string{memPath, tmpPath, "/mem/QmMissing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got[memPath] || !got[tmpPath] || got["/mem/QmMissing"] {
+		t.Errorf("unexpected HasMany result: %v", got)
+	}
+
+	if _, err := mux.HasMany(ctx, []string{"http://example.com"}); err == nil {
+		t.Errorf("expected unmuxed path kind to error")
+	}
+}
+
+func TestMuxRoutesOnFeatures(t *testing.T) {
+	ctx := context.Background()
+	mfs, err := New(ctx, []qfs.Config{
+		{Type: "http"},
+		{Type: "mem"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := mfs.Put(ctx, qfs.NewMemfileBytes("http://example.com/a.txt", []byte("a"))); !errors.Is(err, qfs.ErrReadOnly) {
+		t.Errorf("expected put to read-only member to fail with ErrReadOnly, got %v", err)
+	}
+	if err := mfs.Delete(ctx, "http://example.com/a.txt"); !errors.Is(err, qfs.ErrReadOnly) {
+		t.Errorf("expected delete from read-only member to fail with ErrReadOnly, got %v", err)
+	}
+
+	writable := mfs.Members(qfs.FeatureWritable)
+	if len(writable) != 1 || writable[0].Type() != qfs.MemFilestoreType {
+		t.Errorf("expected only the mem filesystem to be writable, got %v", writable)
+	}
+	if all := mfs.Members(0); len(all) != 2 || all[0].Type() != "http" {
+		t.Errorf("expected members in configuration order, got %v", all)
+	}
+	if mfs.DefaultWriteFS().Type() != qfs.MemFilestoreType {
+		t.Errorf("expected default write filesystem to be mem, got %q", mfs.DefaultWriteFS().Type())
+	}
+
+	d := mfs.Describe()
+	if !d.Has(qfs.FeatureOnline | qfs.FeatureWritable | qfs.FeatureContentAddressed) {
+		t.Errorf("expected mux to have the union of member features, got %s", d.Features)
+	}
+}
+
+// bareKeyFS is a content-addressed filesystem that returns keys without its
+// prefix
+type bareKeyFS struct {
+	*cidMapFS
+}
+
+func (fs bareKeyFS) IsContentAddressedFilesystem() {}
+
+func (fs bareKeyFS) Put(ctx context.Context, f qfs.File) (string, error) {
+	const key = "QmY7Yh4UquoXHLPFo2XbhXkhBvFoPwmQUSa92pxnxjQuPU"
+	data, _ := ioutil.ReadAll(f)
+	fs.files[key] = string(data)
+	return key, nil
+}
+
+func (fs bareKeyFS) Describe() qfs.Descriptor {
+	return qfs.Descriptor{Type: fs.kind, Features: qfs.FeatureWritable | qfs.FeatureContentAddressed}
+}
+
+func TestMuxCanonicalPaths(t *testing.T) {
+	ctx := context.Background()
+	mux := &Mux{}
+	bare := bareKeyFS{&cidMapFS{kind: "bare", files: map[string]string{}}}
+	for _, fs := range []qfs.Filesystem{qfs.NewMemFS(), bare} {
+		if err := mux.SetFilesystem(fs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	key, err := mux.Put(ctx, qfs.NewMemfileBytes("/mem/a.txt", []byte("a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, "/mem/") {
+		t.Errorf("expected mem put to return a /mem/ path, got %q", key)
+	}
+	f, err := mux.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.FullPath() != key {
+		t.Errorf("expected get to return the canonical path %q, got %q", key, f.FullPath())
+	}
+	if f.FileName() != "a.txt" {
+		t.Errorf("expected file name to be preserved, got %q", f.FileName())
+	}
+	if sf, ok := f.(qfs.SeekableFile); !ok {
+		t.Error("expected mux to preserve seeking")
+	} else if _, err := sf.Seek(0, io.SeekEnd); err != nil {
+		t.Errorf("seeking muxed file: %s", err)
+	}
+
+	// paths of unknown kinds only reach the bare filesystem through a route
+	toBare := func(path, mediaType string) bool { return strings.HasPrefix(path, "/bare/") }
+	if err := mux.AddRoute(toBare, "bare"); err != nil {
+		t.Fatal(err)
+	}
+	key, err = mux.Put(ctx, qfs.NewMemfileBytes("/bare/b.txt", []byte("b")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "/bare/QmY7Yh4UquoXHLPFo2XbhXkhBvFoPwmQUSa92pxnxjQuPU" {
+		t.Errorf("expected bare key to be rewritten with its filesystem prefix, got %q", key)
+	}
+}
+
+func TestMuxReadDir(t *testing.T) {
+	ctx := context.Background()
+	mux := &Mux{}
+	if err := mux.SetFilesystem(qfs.NewMemFS()); err != nil {
+		t.Fatal(err)
+	}
+	key, err := mux.Put(ctx, qfs.NewMemdir("/mem/dir", qfs.NewMemfileBytes("a.txt", []byte("a"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// mem directories are stored under their full path
+	entries, err := mux.ReadDir(ctx, key+"/mem/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name != "a.txt" || entries[0].Size != 1 {
+		t.Errorf("unexpected entries: %#v", entries)
+	}
+	if _, err := mux.ReadDir(ctx, "http://example.com/dir"); err == nil {
+		t.Error("expected an error listing a path no filesystem handles")
+	}
+}
+
+func TestMuxCopyRename(t *testing.T) {
+	ctx := context.Background()
+	mux := &Mux{}
+	if err := mux.SetFilesystem(qfs.NewMemFS()); err != nil {
+		t.Fatal(err)
+	}
+	key, err := mux.Put(ctx, qfs.NewMemfileBytes("/mem/a.txt", []byte("a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mux.Copy(ctx, key, "/mem/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mux.Rename(ctx, "/mem/b.txt", "/mem/c.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if has, err := mux.Has(ctx, "/mem/c.txt"); err != nil || !has {
+		t.Errorf("expected renamed copy. got: %t %v", has, err)
+	}
+
+	if err := mux.SetFilesystem(&cidMapFS{kind: "map"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := mux.Copy(ctx, "/map/a", "/map/b"); !errors.Is(err, qfs.ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported from a filesystem that can't copy. got: %v", err)
+	}
+}
+
+func TestMuxAddRemove(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	muxCtx, cancelMux := context.WithCancel(ctx)
+	defer cancelMux()
+
+	mux, err := New(muxCtx, []qfs.Config{{Type: tmpfs.FilestoreType}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mem := qfs.NewMemFS()
+	if err := mux.Add(mem); err != nil {
+		t.Fatal(err)
+	}
+	if err := mux.Add(qfs.NewMemFS()); err == nil {
+		t.Error("expected adding a second mem filesystem to fail")
+	}
+	if mux.DefaultWriteFS() != mem {
+		t.Errorf("expected added mem filesystem to become the default write destination")
+	}
+	key, err := mux.Put(ctx, qfs.NewMemfileBytes("/mem/a.txt", []byte("a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mux.Remove(qfs.MemFilestoreType); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mux.Get(ctx, key); err == nil {
+		t.Error("expected get from a removed filesystem to fail")
+	}
+	if mux.DefaultWriteFS() != nil {
+		t.Errorf("expected no default write destination after removing mem")
+	}
+	if err := mux.Remove(qfs.MemFilestoreType); err == nil {
+		t.Error("expected removing a missing filesystem to fail")
+	}
+
+	// swap the tmpfs for one with a longer lifetime. the mux is done when
+	// the filesystems it holds release, not ones it used to hold
+	fsCtx, cancelFS := context.WithCancel(ctx)
+	defer cancelFS()
+	swapped, err := tmpfs.NewFS(fsCtx, tmpfs.DefaultFSConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mux.Remove(tmpfs.FilestoreType); err != nil {
+		t.Fatal(err)
+	}
+	if err := mux.Add(swapped); err != nil {
+		t.Fatal(err)
+	}
+
+	cancelMux()
+	select {
+	case <-mux.Done():
+		t.Fatal("mux finished while a muxed filesystem is still running")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancelFS()
+	select {
+	case <-mux.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected mux to finish once its filesystems released")
+	}
+	if err := mux.Add(qfs.NewMemFS()); err == nil {
+		t.Error("expected adding to a finished mux to fail")
+	}
+}
+
+func TestMuxTransaction(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path, err := ioutil.TempDir("", "muxfs_test_transaction")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+	if err := qipfs.InitRepo(path, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	mux, err := New(ctx, []qfs.Config{
+		{Type: "ipfs", Config: map[string]interface{}{"path": path}},
+		{Type: "mem"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ipfsPath, memPath string
+	err = qfs.WithTransaction(ctx, func(tx *qfs.Transaction) (err error) {
+		if ipfsPath, err = tx.Put(ctx, mux, qfs.NewMemfileBytes("/ipfs/a.txt", []byte("a"))); err != nil {
+			return err
+		}
+		memPath, err = tx.Put(ctx, mux, qfs.NewMemfileBytes("/mem/b.txt", []byte("b")))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// unpinning only succeeds if the commit pinned the write
+	if err := mux.Unpin(ctx, ipfsPath, true); err != nil {
+		t.Errorf("expected commit to pin %q: %s", ipfsPath, err)
+	}
+	if err := mux.Pin(ctx, memPath, true); !errors.Is(err, qfs.ErrUnsupported) {
+		t.Errorf("expected pinning a mem path to be unsupported, got: %v", err)
+	}
+
+	tx := qfs.NewTransaction()
+	memPath, err = tx.Put(ctx, mux, qfs.NewMemfileBytes("/mem/c.txt", []byte("c")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := mux.Has(ctx, memPath); has {
+		t.Errorf("expected rollback to delete %q", memPath)
+	}
+}
+
+func TestMuxOpSpans(t *testing.T) {
+	tracer := mocktracer.New()
+	prev := opentracing.GlobalTracer()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(prev)
+
+	ctx := context.Background()
+	mux, err := New(ctx, []qfs.Config{{Type: "local"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp, err := ioutil.TempFile("", "muxfs_test_spans")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	f, err := mux.Get(ctx, tmp.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 finished spans, got %d", len(spans))
+	}
+	local, m := spans[0], spans[1]
+	if m.OperationName != "qfs.mux.get" || local.OperationName != "qfs.local.get" {
+		t.Errorf("unexpected operation names: %q, %q", m.OperationName, local.OperationName)
+	}
+	if local.ParentID != m.SpanContext.SpanID {
+		t.Error("expected the local span to be a child of the mux span")
+	}
+}
+
+func TestMuxMiddleware(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mux, err := New(ctx, []qfs.Config{{
+		Type: qfs.MemFilestoreType,
+		Middleware: []qfs.Config{
+			{Type: qfs.ReadOnlyMiddlewareType},
+			{Type: qfs.LimitMiddlewareType, Config: map[string]interface{}{"concurrency": 4}},
+			{Type: cachefs.MiddlewareType, Config: map[string]interface{}{"maxMemBytes": 1024}},
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := mux.Filesystem(qfs.MemFilestoreType)
+	if fs == nil {
+		t.Fatal("expected wrapped mem filesystem to be muxed by its type")
+	}
+	if !qfs.Describe(fs).ReadOnly() {
+		t.Error("expected wrapped mem filesystem to be read-only")
+	}
+	if _, err := mux.Put(ctx, qfs.NewMemfileBytes("/mem/a.txt", []byte("a"))); !errors.Is(err, qfs.ErrReadOnly) {
+		t.Errorf("expected put to fail with ErrReadOnly. got: %v", err)
+	}
+
+	_, err = New(ctx, []qfs.Config{{
+		Type:       qfs.MemFilestoreType,
+		Middleware: []qfs.Config{{Type: "not-a-middleware"}},
+	}})
+	if err == nil {
+		t.Error("expected unknown middleware type to fail")
+	}
+}
+
+func TestMuxMiddlewareCapabilities(t *testing.T) {
+	for _, mw := range []qfs.Config{
+		{Type: qfs.LimitMiddlewareType, Config: map[string]interface{}{"concurrency": 4}},
+		{Type: cachefs.MiddlewareType, Config: map[string]interface{}{"maxMemBytes": 1024}},
+		{Type: retryfs.MiddlewareType},
+	} {
+		t.Run(mw.Type, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "mux_middleware_capabilities")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			if err := qipfs.InitRepo(dir, ""); err != nil {
+				t.Fatal(err)
+			}
+
+			fsCtx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			mux, err := New(fsCtx, []qfs.Config{{
+				Type:       "ipfs",
+				Config:     map[string]interface{}{"path": dir},
+				Middleware: []qfs.Config{mw},
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mux.DefaultWriteFS() == nil {
+				t.Fatal("expected wrapped ipfs filesystem to be the default write destination")
+			}
+
+			ctx := context.Background()
+			path, err := mux.Put(ctx, qfs.NewMemfileBytes("/ipfs/hello.txt", []byte("hello")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := mux.Pin(ctx, path, true); err != nil {
+				t.Errorf("expected pin through middleware to succeed. got: %s", err)
+			}
+			if pinned, err := mux.IsPinned(ctx, path); err != nil || !pinned {
+				t.Errorf("expected %s to be pinned. got: %t, %v", path, pinned, err)
+			}
+
+			cancel()
+			select {
+			case <-mux.Done():
+			case <-time.After(30 * time.Second):
+				t.Fatal("expected mux to be done once the wrapped ipfs filesystem released")
+			}
+			if _, err := mux.Put(ctx, qfs.NewMemfileBytes("/ipfs/again.txt", []byte("again"))); err == nil {
+				t.Error("expected put after release to fail")
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package muxfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	"github.com/qri-io/qfs"
+	"github.com/qri-io/qfs/qipfs"
+)
+
+// ResolvePolicy decides how a mux combines answers from several filesystems
+// that can resolve the same CID
+type ResolvePolicy int
+
+const (
+	// FirstHit returns content from the first filesystem in resolution order
+	// that has it
+	FirstHit ResolvePolicy = iota
+	// VerifyAgreement reads file content from every filesystem in resolution
+	// order that has it, failing with ErrResolutionDisagreement if any differ.
+	// Verification buffers whole files in memory. Directories are returned
+	// from the first filesystem that has them without verification
+	VerifyAgreement
+)
+
+// ErrResolutionDisagreement is returned when filesystems resolving the same
+// CID return different content under the VerifyAgreement policy
+var ErrResolutionDisagreement = errors.New("filesystems disagree on content")
+
+// CIDResolution configures how a mux resolves bare CIDs & /ipfs/ paths
+type CIDResolution struct {
+	// Order lists filesystem types to try, in order. Types the mux doesn't
+	// have are skipped
+	Order  []string
+	Policy ResolvePolicy
+}
+
+// ResolutionStats counts which filesystem served CID resolutions
+type ResolutionStats struct {
+	// Served maps filesystem type to the number of resolutions it answered.
+	// Under VerifyAgreement every agreeing filesystem is counted
+	Served map[string]int
+	// Misses counts resolutions no filesystem could answer
+	Misses int
+	// Disagreements counts resolutions that failed verification
+	Disagreements int
+}
+
+type cidResolver struct {
+	cfg CIDResolution
+
+	lk    sync.Mutex
+	stats ResolutionStats
+}
+
+// SetCIDResolution configures resolution of bare CIDs & /ipfs/ paths across
+// muxed filesystems. Without a resolution configured, bare CIDs are treated
+// as local paths & /ipfs/ paths go to the ipfs filesystem
+func (m *Mux) SetCIDResolution(r CIDResolution) error {
+	if len(r.Order) == 0 {
+		return fmt.Errorf("cid resolution order is empty")
+	}
+	if r.Policy != FirstHit && r.Policy != VerifyAgreement {
+		return fmt.Errorf("unknown cid resolve policy: %d", r.Policy)
+	}
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	m.resolver = &cidResolver{cfg: r, stats: ResolutionStats{Served: map[string]int{}}}
+	return nil
+}
+
+// cidResolver returns the configured CID resolver, nil if none is set
+func (m *Mux) cidResolver() *cidResolver {
+	m.lk.RLock()
+	defer m.lk.RUnlock()
+	return m.resolver
+}
+
+// CIDResolutionStats returns counts of which filesystem served CID
+// resolutions
+func (m *Mux) CIDResolutionStats() ResolutionStats {
+	r := m.cidResolver()
+	if r == nil {
+		return ResolutionStats{Served: map[string]int{}}
+	}
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	s := r.stats
+	s.Served = make(map[string]int, len(r.stats.Served))
+	for k, v := range r.stats.Served {
+		s.Served[k] = v
+	}
+	return s
+}
+
+// cidPath splits a bare CID or /ipfs/ path into a CID & the path within it
+func cidPath(path string) (id, rest string, ok bool) {
+	p := strings.TrimPrefix(path, "/"+qipfs.FilestoreType+"/")
+	if p == path && strings.HasPrefix(path, "/") {
+		return "", "", false
+	}
+	id = p
+	if i := strings.IndexByte(p, '/'); i >= 0 {
+		id, rest = p[:i], p[i:]
+	}
+	if _, err := cid.Decode(id); err != nil {
+		return "", "", false
+	}
+	return id, rest, true
+}
+
+func (r *cidResolver) record(fn func(s *ResolutionStats)) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	fn(&r.stats)
+}
+
+// has reports whether any filesystem in resolution order has a CID path
+func (r *cidResolver) has(ctx context.Context, m *Mux, id, rest string) (bool, error) {
+	for _, kind := range r.cfg.Order {
+		handler, ok := m.handler(kind)
+		if !ok {
+			continue
+		}
+		has, err := qfs.TraceFilesystem(handler).Has(ctx, fmt.Sprintf("/%s/%s%s", kind, id, rest))
+		if err != nil {
+			return false, err
+		}
+		if has {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// hasMany checks a batch of CID paths, asking each filesystem in resolution
+// order in a single qfs.HasMany call for the paths no earlier filesystem had
+func (r *cidResolver) hasMany(ctx context.Context, m *Mux, paths []string) (map[string]bool, error) {
+	res := make(map[string]bool, len(paths))
+	remaining := paths
+	for _, kind := range r.cfg.Order {
+		if len(remaining) == 0 {
+			break
+		}
+		handler, ok := m.handler(kind)
+		if !ok {
+			continue
+		}
+		// asked maps the path the filesystem is asked for to the requested path
+		asked := make(map[string]string, len(remaining))
+		kindPaths := make([]string, 0, len(remaining))
+		for _, path := range remaining {
+			id, rest, _ := cidPath(path)
+			p := fmt.Sprintf("/%s/%s%s", kind, id, rest)
+			asked[p] = path
+			kindPaths = append(kindPaths, p)
+		}
+		found, err := qfs.HasMany(ctx, qfs.TraceFilesystem(handler), kindPaths)
+		if err != nil {
+			return nil, err
+		}
+		remaining = remaining[:0:0]
+		for _, p := range kindPaths {
+			if found[p] {
+				res[asked[p]] = true
+			} else {
+				remaining = append(remaining, asked[p])
+			}
+		}
+	}
+	for _, path := range remaining {
+		res[path] = false
+	}
+	return res, nil
+}
+
+// get resolves a CID path through filesystems in resolution order
+func (r *cidResolver) get(ctx context.Context, m *Mux, id, rest string) (qfs.File, error) {
+	type hit struct {
+		kind string
+		data []byte
+	}
+	var (
+		hits    []hit
+		lastErr error = qfs.ErrNotFound
+	)
+
+	for _, kind := range r.cfg.Order {
+		handler, ok := m.handler(kind)
+		if !ok {
+			continue
+		}
+		f, err := qfs.TraceFilesystem(handler).Get(ctx, fmt.Sprintf("/%s/%s%s", kind, id, rest))
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			if !errors.Is(err, qfs.ErrNotFound) {
+				log.Debugw("resolving cid", "fs", kind, "cid", id, "err", err)
+			}
+			lastErr = err
+			continue
+		}
+		if r.cfg.Policy == FirstHit || f.IsDirectory() {
+			r.record(func(s *ResolutionStats) { s.Served[kind]++ })
+			return f, nil
+		}
+
+		data, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s from %q filesystem: %w", id, kind, err)
+		}
+		if len(hits) > 0 && !bytes.Equal(hits[0].data, data) {
+			r.record(func(s *ResolutionStats) { s.Disagreements++ })
+			return nil, fmt.Errorf("%w: %q and %q filesystems. cid: %s", ErrResolutionDisagreement, hits[0].kind, kind, id)
+		}
+		hits = append(hits, hit{kind: kind, data: data})
+	}
+
+	if len(hits) == 0 {
+		r.record(func(s *ResolutionStats) { s.Misses++ })
+		return nil, lastErr
+	}
+	r.record(func(s *ResolutionStats) {
+		for _, h := range hits {
+			s.Served[h.kind]++
+		}
+	})
+	return qfs.NewMemfileBytes(fmt.Sprintf("/%s/%s%s", hits[0].kind, id, rest), hits[0].data), nil
+}
@@ -0,0 +1,124 @@
+package muxfs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/qri-io/qfs"
+)
+
+// cidMapFS serves files keyed by CID under its own prefix
+type cidMapFS struct {
+	kind  string
+	files map[string]string
+}
+
+func (fs *cidMapFS) Type() string { return fs.kind }
+
+func (fs *cidMapFS) key(path string) string {
+	return strings.TrimPrefix(path, "/"+fs.kind+"/")
+}
+
+func (fs *cidMapFS) Has(ctx context.Context, path string) (bool, error) {
+	_, ok := fs.files[fs.key(path)]
+	return ok, nil
+}
+
+func (fs *cidMapFS) Get(ctx context.Context, path string) (qfs.File, error) {
+	data, ok := fs.files[fs.key(path)]
+	if !ok {
+		return nil, qfs.ErrNotFound
+	}
+	return qfs.NewMemfileBytes(path, []byte(data)), nil
+}
+
+func (fs *cidMapFS) Put(ctx context.Context, f qfs.File) (string, error) {
+	return "", qfs.ErrReadOnly
+}
+
+func (fs *cidMapFS) Delete(ctx context.Context, path string) error { return qfs.ErrReadOnly }
+
+func TestCIDResolution(t *testing.T) {
+	ctx := context.Background()
+	const (
+		shared = "QmY7Yh4UquoXHLPFo2XbhXkhBvFoPwmQUSa92pxnxjQuPU"
+		onlyB  = "QmPZ9gcCEpqKTo6aq61g2nXGUhM4iCL3ewB6LDXZCtioEB"
+	)
+	a := &cidMapFS{kind: "a", files: map[string]string{shared: "shared"}}
+	b := &cidMapFS{kind: "b", files: map[string]string{shared: "shared", onlyB: "b"}}
+
+	mux := &Mux{}
+	for _, fs := range []qfs.Filesystem{a, b} {
+		if err := mux.SetFilesystem(fs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mux.SetCIDResolution(CIDResolution{Order: []string{"b", "a"}, Policy: FirstHit}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{shared, "/ipfs/" + shared} {
+		f, err := mux.Get(ctx, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.FullPath() != "/b/"+shared {
+			t.Errorf("expected %q to resolve from b first. got %q", path, f.FullPath())
+		}
+	}
+	if _, err := mux.Get(ctx, "QmTz3oc4gdpRMKP2sdGUPZTAGRngqjsi99BPoztyP53JMM"); !errors.Is(err, qfs.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for unknown cid, got %v", err)
+	}
+	stats := mux.CIDResolutionStats()
+	if stats.Served["b"] != 2 || stats.Misses != 1 {
+		t.Errorf("unexpected stats: %#v", stats)
+	}
+
+	if err := mux.SetCIDResolution(CIDResolution{Order: []string{"a", "b"}, Policy: VerifyAgreement}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := mux.Get(ctx, shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadAll(f); string(data) != "shared" {
+		t.Errorf("content mismatch. want %q, got %q", "shared", string(data))
+	}
+	if stats := mux.CIDResolutionStats(); stats.Served["a"] != 1 || stats.Served["b"] != 1 {
+		t.Errorf("expected both agreeing filesystems to be counted. got %#v", stats)
+	}
+
+	b.files[shared] = "tampered"
+	if _, err := mux.Get(ctx, shared); !errors.Is(err, ErrResolutionDisagreement) {
+		t.Errorf("expected ErrResolutionDisagreement, got %v", err)
+	}
+	if has, err := mux.Has(ctx, "/ipfs/"+onlyB); err != nil || !has {
+		t.Errorf("expected has to check every filesystem in order. got %t, %v", has, err)
+	}
+
+	const missing = "QmTz3oc4gdpRMKP2sdGUPZTAGRngqjsi99BPoztyP53JMM"
+	found, err := mux.HasMany(ctx, []string{shared, "/ipfs/" + onlyB, missing})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found[shared] || !found["/ipfs/"+onlyB] || found[missing] || len(found) != 3 {
+		t.Errorf("expected HasMany to resolve cids in order. got %v", found)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			mux.SetCIDResolution(CIDResolution{Order: []string{"b", "a"}})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if _, err := mux.Has(ctx, shared); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+}
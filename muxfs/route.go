@@ -0,0 +1,164 @@
+package muxfs
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/qri-io/qfs"
+)
+
+// Matcher decides whether a file being put should be routed by a rule
+type Matcher func(path, mediaType string) bool
+
+// GlobMatcher matches files whose base name matches a filepath.Match pattern,
+// like "*.mp4"
+func GlobMatcher(pattern string) (Matcher, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid glob %q: %w", pattern, err)
+	}
+	return func(path, mediaType string) bool {
+		ok, _ := filepath.Match(pattern, filepath.Base(path))
+		return ok
+	}, nil
+}
+
+// MediaTypeMatcher matches files with any of the given media types. Types
+// ending in "/" match every subtype, so "video/" matches "video/mp4"
+func MediaTypeMatcher(types ...string) Matcher {
+	return func(path, mediaType string) bool {
+		mediaType = strings.TrimSpace(strings.Split(mediaType, ";")[0])
+		for _, t := range types {
+			if t == mediaType || (strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t)) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+type routeRule struct {
+	match  Matcher
+	fsType string
+}
+
+// routes holds put routing rules & the paths they've routed. Routed paths
+// are kept in memory, one entry per routed file that hasn't been deleted
+// through the mux. Callers that need routes to outlive the mux save them
+// with Routes & load them into the next mux with RestoreRoutes
+type routes struct {
+	lk    sync.RWMutex
+	rules []routeRule
+	// routed maps the path a file was put with to the path it was stored at
+	routed map[string]string
+}
+
+// AddRoute registers a rule sending Puts of files that match to the fsType
+// filesystem. Rules are evaluated at Put time in the order they were added,
+// and files no rule matches are routed by path kind. The path each routed
+// file was put with is recorded, so a Get of that path reads from where the
+// file was stored
+func (m *Mux) AddRoute(match Matcher, fsType string) error {
+	if match == nil {
+		return fmt.Errorf("route matcher is nil")
+	}
+	if _, ok := m.handler(fsType); !ok {
+		return fmt.Errorf("mux has no %q filesystem to route to", fsType)
+	}
+	m.routes.lk.Lock()
+	defer m.routes.lk.Unlock()
+	m.routes.rules = append(m.routes.rules, routeRule{match: match, fsType: fsType})
+	return nil
+}
+
+// RoutedPath returns the path a routed Put stored the file at path under
+func (m *Mux) RoutedPath(path string) (string, bool) {
+	m.routes.lk.RLock()
+	defer m.routes.lk.RUnlock()
+	stored, ok := m.routes.routed[path]
+	return stored, ok
+}
+
+// Routes returns a copy of the recorded routed paths, keyed by the path each
+// file was put with
+func (m *Mux) Routes() map[string]string {
+	m.routes.lk.RLock()
+	defer m.routes.lk.RUnlock()
+	res := make(map[string]string, len(m.routes.routed))
+	for path, stored := range m.routes.routed {
+		res[path] = stored
+	}
+	return res
+}
+
+// RestoreRoutes records routed paths saved from Routes, replacing any route
+// already recorded for the same path
+func (m *Mux) RestoreRoutes(routed map[string]string) {
+	m.routes.lk.Lock()
+	defer m.routes.lk.Unlock()
+	if m.routes.routed == nil {
+		m.routes.routed = make(map[string]string, len(routed))
+	}
+	for path, stored := range routed {
+		m.routes.routed[path] = stored
+	}
+}
+
+// route returns the path a routed Put stored path under, or path itself if
+// it wasn't routed
+func (m *Mux) route(path string) string {
+	if stored, ok := m.RoutedPath(path); ok {
+		return stored
+	}
+	return path
+}
+
+// dropRoutes forgets every route to stored, once it's been deleted or moved
+func (m *Mux) dropRoutes(stored string) {
+	m.routes.lk.Lock()
+	defer m.routes.lk.Unlock()
+	for path, s := range m.routes.routed {
+		if s == stored {
+			delete(m.routes.routed, path)
+		}
+	}
+}
+
+// putRouted puts file to the filesystem of the first rule that matches it,
+// reporting false if no rule matches
+func (m *Mux) putRouted(ctx context.Context, file qfs.File) (string, bool, error) {
+	path := file.FullPath()
+	m.routes.lk.RLock()
+	fsType := ""
+	for _, r := range m.routes.rules {
+		if r.match(path, file.MediaType()) {
+			fsType = r.fsType
+			break
+		}
+	}
+	m.routes.lk.RUnlock()
+	if fsType == "" {
+		return "", false, nil
+	}
+
+	handler, err := m.writeHandler(fsType, path)
+	if err != nil {
+		return "", true, err
+	}
+	stored, err := qfs.TraceFilesystem(handler).Put(ctx, file)
+	if err != nil {
+		return "", true, err
+	}
+	stored = canonicalPath(handler, stored)
+	m.publish(ctx, fsType, qfs.EventPut, stored)
+
+	m.routes.lk.Lock()
+	defer m.routes.lk.Unlock()
+	if m.routes.routed == nil {
+		m.routes.routed = map[string]string{}
+	}
+	m.routes.routed[path] = stored
+	return stored, true, nil
+}
@@ -0,0 +1,118 @@
+package muxfs
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/qri-io/qfs"
+)
+
+func TestPutRoutes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mux, err := New(ctx, []qfs.Config{{Type: "mem"}, {Type: "tmpfs"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mux.AddRoute(MediaTypeMatcher("video/"), "tmpfs"); err != nil {
+		t.Fatal(err)
+	}
+	glob, err := GlobMatcher("*.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mux.AddRoute(glob, "tmpfs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mux.AddRoute(glob, "nonexistent"); err == nil {
+		t.Error("expected routing to a missing filesystem to fail")
+	}
+
+	for _, name := range []string{"videos/a.mp4", "data/b.bin"} {
+		stored, err := mux.Put(ctx, qfs.NewMemfileBytes(name, []byte(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(stored, "/tmpfs/") {
+			t.Errorf("expected %q to be routed to tmpfs, got %q", name, stored)
+		}
+		if routed, ok := mux.RoutedPath(name); !ok || routed != stored {
+			t.Errorf("expected routed path for %q to be recorded as %q, got %q", name, stored, routed)
+		}
+
+		f, err := mux.Get(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := ioutil.ReadAll(f); string(data) != name {
+			t.Errorf("content mismatch getting %q. got %q", name, string(data))
+		}
+	}
+
+	stored, err := mux.Put(ctx, qfs.NewMemfileBytes("/mem/doc.txt", []byte("doc")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(stored, "/mem/") {
+		t.Errorf("expected unmatched file to be routed by path kind, got %q", stored)
+	}
+}
+
+func TestRoutedPathOps(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mux, err := New(ctx, []qfs.Config{{Type: "mem"}, {Type: "tmpfs"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mux.AddRoute(MediaTypeMatcher("video/"), "tmpfs"); err != nil {
+		t.Fatal(err)
+	}
+
+	name := "videos/a.mp4"
+	stored, err := mux.Put(ctx, qfs.NewMemfileBytes(name, []byte("video")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := mux.HasMany(ctx, []string{name, stored, "/mem/missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found[name] || !found[stored] || found["/mem/missing"] {
+		t.Errorf("unexpected HasMany result: %v", found)
+	}
+
+	sess, err := mux.NewSession(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sess.Close()
+	if _, err := sess.Get(ctx, name); err != nil {
+		t.Errorf("session get of routed path: %s", err)
+	}
+
+	saved := mux.Routes()
+	if saved[name] != stored {
+		t.Errorf("expected saved routes to map %q to %q, got %v", name, stored, saved)
+	}
+
+	if err := mux.Delete(ctx, name); err != nil {
+		t.Fatal(err)
+	}
+	if has, err := mux.Has(ctx, stored); err != nil || has {
+		t.Errorf("expected deleting the routed path to delete %q. has: %t err: %v", stored, has, err)
+	}
+	if _, ok := mux.RoutedPath(name); ok {
+		t.Error("expected the route to be dropped on delete")
+	}
+
+	mux.RestoreRoutes(saved)
+	if routed, ok := mux.RoutedPath(name); !ok || routed != stored {
+		t.Errorf("expected restored route %q, got %q", stored, routed)
+	}
+}
@@ -0,0 +1,238 @@
+package qfs
+
+import (
+	"context"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Popularity tracks how often & how recently content is accessed using a
+// bounded count-min sketch. Counts are periodically halved so old accesses
+// fade, giving a frequency score biased toward recent activity. Memory use is
+// fixed regardless of the number of distinct keys tracked.
+//
+// Caches use Admit to decide whether a new entry is worth evicting an existing
+// one (TinyLFU-style admission), and storage tiering uses IsCold to find
+// content that can move to slower storage
+type Popularity struct {
+	lk       sync.Mutex
+	rows     [][]uint32
+	width    uint64
+	adds     int
+	resetAt  int
+	topK     int
+	hot      map[string]*PopularityEntry
+	clockNow func() time.Time
+}
+
+// PopularityEntry is a single key's estimated popularity
+type PopularityEntry struct {
+	Key        string
+	Count      uint32
+	LastAccess time.Time
+}
+
+// PopularityConfig configures a popularity tracker
+type PopularityConfig struct {
+	// Width is the number of counters per sketch row. larger values reduce
+	// overcounting from hash collisions
+	Width int
+	// Depth is the number of independent sketch rows
+	Depth int
+	// TopK is the number of hottest keys retained for querying
+	TopK int
+	// ResetAfter is the number of recorded accesses after which all counters
+	// are halved. defaults to 10x Width
+	ResetAfter int
+}
+
+// DefaultPopularityConfig sizes a tracker for tens of thousands of keys in
+// roughly 64KiB of memory
+func DefaultPopularityConfig() PopularityConfig {
+	return PopularityConfig{
+		Width: 4096,
+		Depth: 4,
+		TopK:  100,
+	}
+}
+
+// NewPopularity creates a popularity tracker
+func NewPopularity(cfg PopularityConfig) *Popularity {
+	if cfg.Width <= 0 {
+		cfg.Width = DefaultPopularityConfig().Width
+	}
+	if cfg.Depth <= 0 {
+		cfg.Depth = DefaultPopularityConfig().Depth
+	}
+	if cfg.ResetAfter <= 0 {
+		cfg.ResetAfter = cfg.Width * 10
+	}
+
+	rows := make([][]uint32, cfg.Depth)
+	for i := range rows {
+		rows[i] = make([]uint32, cfg.Width)
+	}
+	return &Popularity{
+		rows:     rows,
+		width:    uint64(cfg.Width),
+		resetAt:  cfg.ResetAfter,
+		topK:     cfg.TopK,
+		hot:      map[string]*PopularityEntry{},
+		clockNow: time.Now,
+	}
+}
+
+// Touch records an access of key
+func (p *Popularity) Touch(key string) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	count := ^uint32(0)
+	for i, idx := range p.indexes(key) {
+		if p.rows[i][idx] < ^uint32(0) {
+			p.rows[i][idx]++
+		}
+		if p.rows[i][idx] < count {
+			count = p.rows[i][idx]
+		}
+	}
+
+	p.adds++
+	if p.adds >= p.resetAt {
+		p.age()
+		count /= 2
+	}
+	p.trackHot(key, count)
+}
+
+// Estimate returns the approximate recency-weighted access count for key.
+// Estimates may overcount but never undercount
+func (p *Popularity) Estimate(key string) uint32 {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	return p.estimate(key)
+}
+
+// Admit reports whether candidate is popular enough to replace victim in a
+// bounded cache
+func (p *Popularity) Admit(candidate, victim string) bool {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	return p.estimate(candidate) > p.estimate(victim)
+}
+
+// IsCold reports whether key has been accessed fewer than threshold times
+// within the tracker's aging window
+func (p *Popularity) IsCold(key string, threshold uint32) bool {
+	return p.Estimate(key) < threshold
+}
+
+// Hottest returns up to n of the most accessed keys, most popular first
+func (p *Popularity) Hottest(n int) []PopularityEntry {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	res := make([]PopularityEntry, 0, len(p.hot))
+	for _, e := range p.hot {
+		res = append(res, *e)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Count == res[j].Count {
+			return res[i].LastAccess.After(res[j].LastAccess)
+		}
+		return res[i].Count > res[j].Count
+	})
+	if n >= 0 && n < len(res) {
+		res = res[:n]
+	}
+	return res
+}
+
+func (p *Popularity) estimate(key string) uint32 {
+	count := ^uint32(0)
+	for i, idx := range p.indexes(key) {
+		if p.rows[i][idx] < count {
+			count = p.rows[i][idx]
+		}
+	}
+	return count
+}
+
+// indexes calculates a counter index for each row using double hashing
+func (p *Popularity) indexes(key string) []uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := sum&0xffffffff, sum>>32
+
+	idxs := make([]uint64, len(p.rows))
+	for i := range idxs {
+		idxs[i] = (h1 + uint64(i)*h2) % p.width
+	}
+	return idxs
+}
+
+// age halves all counters, fading out old accesses
+func (p *Popularity) age() {
+	for _, row := range p.rows {
+		for i := range row {
+			row[i] /= 2
+		}
+	}
+	for key, e := range p.hot {
+		e.Count /= 2
+		if e.Count == 0 {
+			delete(p.hot, key)
+		}
+	}
+	p.adds = 0
+}
+
+func (p *Popularity) trackHot(key string, count uint32) {
+	if p.topK <= 0 {
+		return
+	}
+
+	now := p.clockNow()
+	if e, ok := p.hot[key]; ok {
+		e.Count = count
+		e.LastAccess = now
+		return
+	}
+
+	if len(p.hot) >= p.topK {
+		var coldest *PopularityEntry
+		for _, e := range p.hot {
+			if coldest == nil || e.Count < coldest.Count {
+				coldest = e
+			}
+		}
+		if coldest.Count >= count {
+			return
+		}
+		delete(p.hot, coldest.Key)
+	}
+	p.hot[key] = &PopularityEntry{Key: key, Count: count, LastAccess: now}
+}
+
+// TrackPopularity wraps a filesystem, recording every successful Get with
+// the popularity tracker
+func TrackPopularity(fs Filesystem, p *Popularity) Filesystem {
+	return &popularityFS{Filesystem: fs, p: p}
+}
+
+type popularityFS struct {
+	Filesystem
+	p *Popularity
+}
+
+// Get implements the Filesystem interface
+func (pfs *popularityFS) Get(ctx context.Context, path string) (File, error) {
+	f, err := pfs.Filesystem.Get(ctx, path)
+	if err == nil {
+		pfs.p.Touch(path)
+	}
+	return f, err
+}
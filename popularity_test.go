@@ -0,0 +1,74 @@
+package qfs
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPopularity(t *testing.T) {
+	p := NewPopularity(PopularityConfig{Width: 256, Depth: 4, TopK: 2, ResetAfter: 1000})
+
+	for i := 0; i < 10; i++ {
+		p.Touch("/mem/hot")
+	}
+	for i := 0; i < 5; i++ {
+		p.Touch("/mem/warm")
+	}
+	p.Touch("/mem/cold")
+
+	if got := p.Estimate("/mem/hot"); got < 10 {
+		t.Errorf("expected estimate of at least 10, got %d", got)
+	}
+	if !p.Admit("/mem/hot", "/mem/cold") {
+		t.Errorf("expected hot key to be admitted over cold key")
+	}
+	if p.Admit("/mem/cold", "/mem/warm") {
+		t.Errorf("expected cold key to be rejected in favour of warm key")
+	}
+	if !p.IsCold("/mem/cold", 2) {
+		t.Errorf("expected /mem/cold to be cold")
+	}
+
+	hot := p.Hottest(10)
+	if len(hot) != 2 {
+		t.Fatalf("expected top-k to be bounded to 2 entries, got %d", len(hot))
+	}
+	if hot[0].Key != "/mem/hot" || hot[1].Key != "/mem/warm" {
+		t.Errorf("unexpected hottest order: %#v", hot)
+	}
+}
+
+func TestPopularityAging(t *testing.T) {
+	p := NewPopularity(PopularityConfig{Width: 64, Depth: 2, TopK: 10, ResetAfter: 8})
+	for i := 0; i < 7; i++ {
+		p.Touch("a")
+	}
+	// eighth touch triggers a reset, halving all counts
+	p.Touch("a")
+	if got := p.Estimate("a"); got != 4 {
+		t.Errorf("expected aged estimate of 4, got %d", got)
+	}
+}
+
+func TestTrackPopularity(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemFS()
+	p := NewPopularity(DefaultPopularityConfig())
+	fs := TrackPopularity(mem, p)
+
+	path, err := fs.Put(ctx, NewMemfileBytes("a.txt", []byte("foo")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Get(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Get(ctx, "/mem/nope"); err == nil {
+		t.Fatal("expected error getting missing path")
+	}
+
+	hot := p.Hottest(-1)
+	if len(hot) != 1 || hot[0].Key != path || hot[0].Count != 1 {
+		t.Errorf("unexpected hottest result: %#v", hot)
+	}
+}
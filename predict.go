@@ -0,0 +1,52 @@
+package qfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// PathPredictor is an optional interface for filesystems that can compute the
+// path putting a file would return, without writing anything. Content-addressed
+// filesystems predict paths by hashing file content. Filesystems that can't
+// predict the path of a particular file return an error matching
+// ErrUnsupported
+type PathPredictor interface {
+	PredictPath(ctx context.Context, file File) (string, error)
+}
+
+// heldBeforePut reports the path putting file to fs is expected to write to,
+// & whether fs already holds that path, see holds. Predicting a path reads
+// file content into memory, so heldBeforePut returns the file to put in
+// file's place. Directories & filesystems that can't predict paths are
+// expected to write to file's own path
+func heldBeforePut(ctx context.Context, fs Filesystem, file File) (path string, held bool, put File, err error) {
+	var pp PathPredictor
+	if file.IsDirectory() || !As(fs, &pp) {
+		return file.FullPath(), holds(ctx, fs, file.FullPath()), file, nil
+	}
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return "", false, nil, err
+	}
+	put = &replayFile{File: file, r: bytes.NewReader(data)}
+	path, err = pp.PredictPath(ctx, &replayFile{File: file, r: bytes.NewReader(data)})
+	if err != nil {
+		if !errors.Is(err, ErrUnsupported) {
+			log.Debugw("predicting put path", "path", file.FullPath(), "err", err)
+		}
+		path = file.FullPath()
+	}
+	return path, holds(ctx, fs, path), put, nil
+}
+
+// replayFile reads buffered content in place of the file it wraps
+type replayFile struct {
+	File
+	r io.Reader
+}
+
+func (f *replayFile) Read(p []byte) (int, error) { return f.r.Read(p) }
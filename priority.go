@@ -0,0 +1,207 @@
+package qfs
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Priority classifies an operation so shared resources can serve interactive
+// work before background work
+type Priority int
+
+const (
+	// PriorityBackground is for work no user is waiting on: replication,
+	// prefetching, verification
+	PriorityBackground Priority = iota
+	// PriorityNormal is the default priority of operations
+	PriorityNormal
+	// PriorityInteractive is for work a user is actively waiting on
+	PriorityInteractive
+
+	numPriorities = int(PriorityInteractive) + 1
+)
+
+// String implements the fmt.Stringer interface
+func (p Priority) String() string {
+	switch p {
+	case PriorityBackground:
+		return "background"
+	case PriorityNormal:
+		return "normal"
+	case PriorityInteractive:
+		return "interactive"
+	default:
+		return fmt.Sprintf("Priority(%d)", int(p))
+	}
+}
+
+type priorityCtxKey struct{}
+
+// WithPriority returns a context that marks operations performed with it as
+// having priority p
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityCtxKey{}, p)
+}
+
+// PriorityFromContext returns the priority set by WithPriority, defaulting to
+// PriorityNormal
+func PriorityFromContext(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityCtxKey{}).(Priority); ok && p >= PriorityBackground && p <= PriorityInteractive {
+		return p
+	}
+	return PriorityNormal
+}
+
+// PriorityLimiter bounds the number of concurrent operations, granting free
+// slots to the highest priority waiter first. Pin queues, replication,
+// prefetching & rate limiting share a limiter so background work never starves
+// interactive work
+type PriorityLimiter struct {
+	lk      sync.Mutex
+	free    int
+	waiters [numPriorities]*list.List
+}
+
+// NewPriorityLimiter creates a limiter allowing n concurrent operations
+func NewPriorityLimiter(n int) *PriorityLimiter {
+	if n < 1 {
+		n = 1
+	}
+	l := &PriorityLimiter{free: n}
+	for i := range l.waiters {
+		l.waiters[i] = list.New()
+	}
+	return l
+}
+
+// Acquire waits for a slot at the priority set on ctx. Callers must call the
+// returned release func when their operation completes
+func (l *PriorityLimiter) Acquire(ctx context.Context) (release func(), err error) {
+	p := PriorityFromContext(ctx)
+
+	l.lk.Lock()
+	if l.free > 0 && !l.waitingAtOrAbove(p) {
+		l.free--
+		l.lk.Unlock()
+		return l.releaseFunc(), nil
+	}
+	ready := make(chan struct{})
+	el := l.waiters[p].PushBack(ready)
+	l.lk.Unlock()
+
+	select {
+	case <-ready:
+		return l.releaseFunc(), nil
+	case <-ctx.Done():
+		l.lk.Lock()
+		select {
+		case <-ready:
+			// granted a slot while cancelling, hand it on
+			l.lk.Unlock()
+			l.releaseFunc()()
+		default:
+			l.waiters[p].Remove(el)
+			l.lk.Unlock()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// Waiting returns the number of operations waiting for a slot at priority p
+func (l *PriorityLimiter) Waiting(p Priority) int {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	return l.waiters[p].Len()
+}
+
+func (l *PriorityLimiter) waitingAtOrAbove(p Priority) bool {
+	for i := int(p); i < numPriorities; i++ {
+		if l.waiters[i].Len() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *PriorityLimiter) releaseFunc() func() {
+	var once sync.Once
+	return func() {
+		once.Do(l.release)
+	}
+}
+
+// release hands a slot to the highest priority waiter, or frees it
+func (l *PriorityLimiter) release() {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	for i := numPriorities - 1; i >= 0; i-- {
+		if el := l.waiters[i].Front(); el != nil {
+			l.waiters[i].Remove(el)
+			close(el.Value.(chan struct{}))
+			return
+		}
+	}
+	l.free++
+}
+
+// PriorityLimitedFS runs filesystem operations through a PriorityLimiter
+type PriorityLimitedFS struct {
+	Filesystem
+	Limiter *PriorityLimiter
+}
+
+var (
+	_ Filesystem = (*PriorityLimitedFS)(nil)
+	_ Unwrapper  = (*PriorityLimitedFS)(nil)
+)
+
+// Unwrap returns the wrapped filesystem
+func (fs *PriorityLimitedFS) Unwrap() Filesystem { return fs.Filesystem }
+
+// NewPriorityLimitedFS wraps fs, sharing l with any other users of the limiter
+func NewPriorityLimitedFS(fs Filesystem, l *PriorityLimiter) *PriorityLimitedFS {
+	return &PriorityLimitedFS{Filesystem: fs, Limiter: l}
+}
+
+// Has returns whether the `path` is mapped to a value
+func (fs *PriorityLimitedFS) Has(ctx context.Context, path string) (bool, error) {
+	release, err := fs.Limiter.Acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	return fs.Filesystem.Has(ctx, path)
+}
+
+// Get fetches a file. The slot is held only while resolving the file, not
+// while it's read
+func (fs *PriorityLimitedFS) Get(ctx context.Context, path string) (File, error) {
+	release, err := fs.Limiter.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return fs.Filesystem.Get(ctx, path)
+}
+
+// Put places a file or directory on the filesystem
+func (fs *PriorityLimitedFS) Put(ctx context.Context, file File) (string, error) {
+	release, err := fs.Limiter.Acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	return fs.Filesystem.Put(ctx, file)
+}
+
+// Delete removes a file or directory from the filesystem
+func (fs *PriorityLimitedFS) Delete(ctx context.Context, path string) error {
+	release, err := fs.Limiter.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return fs.Filesystem.Delete(ctx, path)
+}
@@ -0,0 +1,81 @@
+package qfs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPriorityFromContext(t *testing.T) {
+	ctx := context.Background()
+	if p := PriorityFromContext(ctx); p != PriorityNormal {
+		t.Errorf("expected default priority to be normal. got: %s", p)
+	}
+	if p := PriorityFromContext(WithPriority(ctx, PriorityInteractive)); p != PriorityInteractive {
+		t.Errorf("expected interactive priority. got: %s", p)
+	}
+}
+
+func TestPriorityLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := NewPriorityLimiter(1)
+
+	release, err := l.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order := make(chan Priority, 2)
+	acquire := func(p Priority) {
+		rel, err := l.Acquire(WithPriority(ctx, p))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		order <- p
+		rel()
+	}
+
+	go acquire(PriorityBackground)
+	waitFor(t, func() bool { return l.Waiting(PriorityBackground) == 1 })
+	go acquire(PriorityInteractive)
+	waitFor(t, func() bool { return l.Waiting(PriorityInteractive) == 1 })
+
+	release()
+	if p := <-order; p != PriorityInteractive {
+		t.Errorf("expected interactive waiter to be served first. got: %s", p)
+	}
+	if p := <-order; p != PriorityBackground {
+		t.Errorf("expected background waiter to be served second. got: %s", p)
+	}
+
+	// cancelled waiters give up their place
+	release, err = l.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(cctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded. got: %v", err)
+	}
+	if n := l.Waiting(PriorityNormal); n != 0 {
+		t.Errorf("expected cancelled waiter to be removed. %d waiting", n)
+	}
+	release()
+	if _, err := l.Acquire(ctx); err != nil {
+		t.Errorf("expected slot to be free after release. got: %s", err)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,84 @@
+package qfs
+
+import (
+	"context"
+	"io"
+)
+
+// ProgressFunc reports the progress of a transfer. bytesTotal is -1 when the
+// size of the transfer isn't known
+type ProgressFunc func(bytesDone, bytesTotal int64)
+
+type progressCtxKey struct{}
+
+// WithProgress reports the progress of files read from Get & written with Put
+// under the returned context to fn, so UIs can show progress of large
+// transfers. fn is called after every read, from whichever goroutine is
+// reading, once per file being transferred
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressCtxKey{}, fn)
+}
+
+// ProgressFromContext returns the progress func set on ctx, or nil
+func ProgressFromContext(ctx context.Context) ProgressFunc {
+	fn, _ := ctx.Value(progressCtxKey{}).(ProgressFunc)
+	return fn
+}
+
+// ProgressReader wraps r, reporting the bytes read of total to fn after each
+// read. r is returned unwrapped when fn is nil
+func ProgressReader(r io.Reader, total int64, fn ProgressFunc) io.Reader {
+	if fn == nil {
+		return r
+	}
+	return &progressReader{r: r, total: total, fn: fn}
+}
+
+type progressReader struct {
+	r     io.Reader
+	total int64
+	done  int64
+	fn    ProgressFunc
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.done += int64(n)
+		p.fn(p.done, p.total)
+	}
+	return n, err
+}
+
+// ProgressFile wraps a file so reads report progress to fn. Directories are
+// returned unwrapped, as are files when fn is nil
+func ProgressFile(f File, fn ProgressFunc) File {
+	if fn == nil || f.IsDirectory() {
+		return f
+	}
+	return &progressFile{File: f, fn: fn}
+}
+
+type progressFile struct {
+	File
+	fn   ProgressFunc
+	done int64
+}
+
+// Read reports bytes read from the underlying file
+func (f *progressFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	if n > 0 {
+		f.done += int64(n)
+		f.fn(f.done, FileSize(f.File))
+	}
+	return n, err
+}
+
+// Seek seeks the underlying file. Progress counts bytes read, not the offset
+func (f *progressFile) Seek(offset int64, whence int) (int64, error) {
+	return seekFile(f.File, offset, whence)
+}
+
+// Size returns the size of the underlying file
+func (f *progressFile) Size() int64 { return FileSize(f.File) }
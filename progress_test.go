@@ -0,0 +1,39 @@
+package qfs
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+)
+
+func TestProgressFile(t *testing.T) {
+	data := bytes.Repeat([]byte("a"), 1000)
+	var done, total int64
+	fn := ProgressFunc(func(d, t int64) { done, total = d, t })
+
+	ctx := WithProgress(context.Background(), fn)
+	f := ProgressFile(NewMemfileBytes("a.txt", data), ProgressFromContext(ctx))
+	if _, err := ioutil.ReadAll(f); err != nil {
+		t.Fatal(err)
+	}
+	if done != 1000 || total != 1000 {
+		t.Errorf("expected 1000 of 1000 bytes, got %d of %d", done, total)
+	}
+
+	done, total = 0, 0
+	if _, err := ioutil.ReadAll(ProgressReader(bytes.NewReader(data), -1, fn)); err != nil {
+		t.Fatal(err)
+	}
+	if done != 1000 || total != -1 {
+		t.Errorf("expected 1000 bytes of unknown total, got %d of %d", done, total)
+	}
+
+	dir := NewMemdir("/a")
+	if ProgressFile(dir, fn) != File(dir) {
+		t.Error("expected directories to be returned unwrapped")
+	}
+	if ProgressFromContext(context.Background()) != nil {
+		t.Error("expected no progress func on a plain context")
+	}
+}
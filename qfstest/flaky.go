@@ -0,0 +1,174 @@
+package qfstest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/qri-io/qfs"
+)
+
+// ErrFlaky is the error Flaky filesystems inject unless configured otherwise
+var ErrFlaky = errors.New("qfstest: injected failure")
+
+// FlakyConfig configures the failures a Flaky filesystem injects
+type FlakyConfig struct {
+	// Seed makes random failures reproducible
+	Seed int64
+	// FailPercent is the percentage of operations that fail, from 0 to 100
+	FailPercent int
+	// FailOn fails the Kth operation, counting from 1. Zero disables it
+	FailOn int
+	// Latency stalls every operation. Latency ends early if the operation
+	// context is cancelled
+	Latency time.Duration
+	// PartialReads caps each Read of files returned by Get at this many
+	// bytes, exercising readers that assume full reads. Zero disables it
+	PartialReads int
+	// Ops limits failures & latency to operations named by the qfs.FaultOp
+	// constants. Empty applies to every operation
+	Ops []string
+	// Err is returned by failed operations, defaults to ErrFlaky
+	Err error
+}
+
+// Flaky wraps a filesystem, failing & slowing operations as configured so
+// retry & rollback logic can be tested against unreliable storage
+type Flaky struct {
+	qfs.Filesystem
+
+	cfg   FlakyConfig
+	lk    sync.Mutex
+	rand  *rand.Rand
+	calls int
+	fails int
+}
+
+var _ qfs.Filesystem = (*Flaky)(nil)
+
+// NewFlaky wraps fs in a Flaky filesystem
+func NewFlaky(fs qfs.Filesystem, cfg FlakyConfig) *Flaky {
+	if cfg.Err == nil {
+		cfg.Err = ErrFlaky
+	}
+	return &Flaky{
+		Filesystem: fs,
+		cfg:        cfg,
+		rand:       rand.New(rand.NewSource(cfg.Seed)),
+	}
+}
+
+// Calls returns the number of operations the filesystem has counted
+func (f *Flaky) Calls() int {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	return f.calls
+}
+
+// Failures returns the number of operations the filesystem has failed
+func (f *Flaky) Failures() int {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	return f.fails
+}
+
+// Has returns whether the `path` is mapped to a value
+func (f *Flaky) Has(ctx context.Context, path string) (bool, error) {
+	if err := f.inject(ctx, qfs.FaultOpHas, path); err != nil {
+		return false, err
+	}
+	return f.Filesystem.Has(ctx, path)
+}
+
+// Get fetches a file
+func (f *Flaky) Get(ctx context.Context, path string) (qfs.File, error) {
+	if err := f.inject(ctx, qfs.FaultOpGet, path); err != nil {
+		return nil, err
+	}
+	file, err := f.Filesystem.Get(ctx, path)
+	if err != nil || f.cfg.PartialReads <= 0 {
+		return file, err
+	}
+	return &partialFile{File: file, max: f.cfg.PartialReads}, nil
+}
+
+// Put places a file or directory on the filesystem
+func (f *Flaky) Put(ctx context.Context, file qfs.File) (string, error) {
+	if err := f.inject(ctx, qfs.FaultOpPut, file.FullPath()); err != nil {
+		return "", err
+	}
+	return f.Filesystem.Put(ctx, file)
+}
+
+// Delete removes a file or directory from the filesystem
+func (f *Flaky) Delete(ctx context.Context, path string) error {
+	if err := f.inject(ctx, qfs.FaultOpDelete, path); err != nil {
+		return err
+	}
+	return f.Filesystem.Delete(ctx, path)
+}
+
+// inject counts an operation, waits out any latency & decides whether the
+// operation fails
+func (f *Flaky) inject(ctx context.Context, op, path string) error {
+	if !f.applies(op) {
+		return nil
+	}
+
+	f.lk.Lock()
+	f.calls++
+	fail := f.calls == f.cfg.FailOn || (f.cfg.FailPercent > 0 && f.rand.Intn(100) < f.cfg.FailPercent)
+	if fail {
+		f.fails++
+	}
+	f.lk.Unlock()
+
+	if f.cfg.Latency > 0 {
+		select {
+		case <-time.After(f.cfg.Latency):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if fail {
+		return fmt.Errorf("%w: %s %s", f.cfg.Err, op, path)
+	}
+	return nil
+}
+
+func (f *Flaky) applies(op string) bool {
+	if len(f.cfg.Ops) == 0 {
+		return true
+	}
+	for _, o := range f.cfg.Ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// partialFile returns at most max bytes from each Read, including reads of
+// the files of a directory
+type partialFile struct {
+	qfs.File
+	max int
+}
+
+func (f *partialFile) Read(p []byte) (int, error) {
+	if len(p) > f.max {
+		p = p[:f.max]
+	}
+	return f.File.Read(p)
+}
+
+func (f *partialFile) NextFile() (qfs.File, error) {
+	ch, err := f.File.NextFile()
+	if err != nil {
+		return nil, err
+	}
+	return &partialFile{File: ch, max: f.max}, nil
+}
@@ -0,0 +1,94 @@
+package qfstest
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/qri-io/qfs"
+)
+
+func TestFlakyFailOn(t *testing.T) {
+	ctx := context.Background()
+	fs := NewFlaky(qfs.NewMemFS(), FlakyConfig{FailOn: 2})
+
+	path, err := fs.Put(ctx, qfs.NewMemfileBytes("/a.txt", []byte("a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Get(ctx, path); !errors.Is(err, ErrFlaky) {
+		t.Errorf("expected second call to fail with ErrFlaky. got: %v", err)
+	}
+	if _, err := fs.Get(ctx, path); err != nil {
+		t.Errorf("expected third call to succeed. got: %s", err)
+	}
+	if fs.Calls() != 3 || fs.Failures() != 1 {
+		t.Errorf("expected 3 calls & 1 failure. got: %d calls, %d failures", fs.Calls(), fs.Failures())
+	}
+}
+
+func TestFlakyFailPercent(t *testing.T) {
+	ctx := context.Background()
+	errBoom := errors.New("boom")
+	count := func() int {
+		fs := NewFlaky(qfs.NewMemFS(), FlakyConfig{Seed: 3, FailPercent: 30, Ops: []string{qfs.FaultOpHas}, Err: errBoom})
+		failed := 0
+		for i := 0; i < 1000; i++ {
+			if _, err := fs.Has(ctx, "/mem/QmFoo"); errors.Is(err, errBoom) {
+				failed++
+			} else if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := fs.Put(ctx, qfs.NewMemfileBytes("/a.txt", []byte("a"))); err != nil {
+			t.Errorf("expected operations not in Ops to succeed. got: %s", err)
+		}
+		return failed
+	}
+
+	failed := count()
+	if failed < 250 || failed > 350 {
+		t.Errorf("expected about 300 of 1000 calls to fail. got: %d", failed)
+	}
+	if again := count(); again != failed {
+		t.Errorf("expected the same seed to fail the same calls. got: %d, then %d", failed, again)
+	}
+}
+
+func TestFlakyLatency(t *testing.T) {
+	fs := NewFlaky(qfs.NewMemFS(), FlakyConfig{Latency: time.Hour})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := fs.Has(ctx, "/mem/QmFoo"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected latency to honor context deadline. got: %v", err)
+	}
+}
+
+func TestFlakyPartialReads(t *testing.T) {
+	ctx := context.Background()
+	fs := NewFlaky(qfs.NewMemFS(), FlakyConfig{PartialReads: 3})
+
+	path, err := fs.Put(ctx, qfs.NewMemdir("/",
+		qfs.NewMemfileBytes("a.txt", []byte("hello world")),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.Get(ctx, path+"/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 8)
+	if n, err := f.Read(buf); err != nil || n != 3 {
+		t.Errorf("expected a 3 byte read. got: %d, %v", n, err)
+	}
+	rest, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rest) != "lo world" {
+		t.Errorf("expected remaining data %q. got: %q", "lo world", rest)
+	}
+}
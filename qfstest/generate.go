@@ -0,0 +1,161 @@
+// Package qfstest generates reproducible content for tests & benchmarks.
+// Generators are seeded, so the same configuration produces byte-identical
+// trees on every machine, making results comparable. Flaky filesystems inject
+// storage failures for testing error handling
+package qfstest
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/qri-io/qfs"
+)
+
+// Distribution draws a non-negative integer from r
+type Distribution func(r *rand.Rand) int
+
+// Constant always draws n
+func Constant(n int) Distribution {
+	return func(*rand.Rand) int { return n }
+}
+
+// Uniform draws evenly from [min, max]
+func Uniform(min, max int) Distribution {
+	if max < min {
+		min, max = max, min
+	}
+	return func(r *rand.Rand) int {
+		return min + r.Intn(max-min+1)
+	}
+}
+
+// LogUniform draws from [min, max] with values spread evenly across orders of
+// magnitude, which resembles real file size distributions: many small files
+// and a few large ones. min must be at least 1
+func LogUniform(min, max int) Distribution {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	lo, hi := math.Log(float64(min)), math.Log(float64(max))
+	return func(r *rand.Rand) int {
+		n := int(math.Exp(lo + r.Float64()*(hi-lo)))
+		if n > max {
+			n = max
+		}
+		return n
+	}
+}
+
+// TreeConfig configures a generated file tree
+type TreeConfig struct {
+	// Seed makes generation reproducible
+	Seed int64
+	// Root is the path of the root directory, defaults to "/"
+	Root string
+	// Files is the number of files in the tree
+	Files int
+	// Size draws the size of each file in bytes
+	Size Distribution
+	// Depth draws the number of directories between the root and each file
+	Depth Distribution
+	// Fanout is the number of distinct subdirectory names at each level
+	Fanout int
+}
+
+// DefaultTreeConfig is a small tree of mixed size files
+func DefaultTreeConfig() TreeConfig {
+	return TreeConfig{
+		Seed:   1,
+		Root:   "/",
+		Files:  20,
+		Size:   LogUniform(16, 64*1024),
+		Depth:  Uniform(0, 3),
+		Fanout: 3,
+	}
+}
+
+// GenerateTree builds a directory of random files. Directory entries are
+// sorted by name
+func GenerateTree(cfg TreeConfig) *qfs.Memdir {
+	if cfg.Root == "" {
+		cfg.Root = "/"
+	}
+	if cfg.Size == nil {
+		cfg.Size = Constant(0)
+	}
+	if cfg.Depth == nil {
+		cfg.Depth = Constant(0)
+	}
+	if cfg.Fanout < 1 {
+		cfg.Fanout = 1
+	}
+
+	r := rand.New(rand.NewSource(cfg.Seed))
+	root := &dirNode{}
+	for i := 0; i < cfg.Files; i++ {
+		d := root
+		depth := cfg.Depth(r)
+		for j := 0; j < depth; j++ {
+			d = d.dir(fmt.Sprintf("dir_%d", r.Intn(cfg.Fanout)))
+		}
+		name := fmt.Sprintf("file_%d.dat", i)
+		// derive each file's content seed from the tree seed so file contents
+		// don't shift when the shape of the tree changes
+		d.files = append(d.files, fileNode{name: name, size: cfg.Size(r), seed: cfg.Seed ^ int64(i+1)<<20})
+	}
+	return root.memdir(cfg.Root)
+}
+
+// GenerateBytes returns size reproducible random bytes
+func GenerateBytes(seed int64, size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+// GenerateFile creates a file of size reproducible random bytes
+func GenerateFile(seed int64, path string, size int) *qfs.Memfile {
+	return qfs.NewMemfileBytes(path, GenerateBytes(seed, size))
+}
+
+type fileNode struct {
+	name string
+	size int
+	seed int64
+}
+
+type dirNode struct {
+	dirs  map[string]*dirNode
+	files []fileNode
+}
+
+func (d *dirNode) dir(name string) *dirNode {
+	if d.dirs == nil {
+		d.dirs = map[string]*dirNode{}
+	}
+	ch, ok := d.dirs[name]
+	if !ok {
+		ch = &dirNode{}
+		d.dirs[name] = ch
+	}
+	return ch
+}
+
+// memdir converts the node to a directory. Children are named relative to
+// their parent, and get full paths when added to it
+func (d *dirNode) memdir(path string) *qfs.Memdir {
+	children := make([]qfs.File, 0, len(d.dirs)+len(d.files))
+	for _, f := range d.files {
+		children = append(children, GenerateFile(f.seed, f.name, f.size))
+	}
+	for name, ch := range d.dirs {
+		children = append(children, ch.memdir(name))
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].FileName() < children[j].FileName() })
+	return qfs.NewMemdir(path, children...)
+}
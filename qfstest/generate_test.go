@@ -0,0 +1,83 @@
+package qfstest
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qri-io/qfs"
+)
+
+func TestGenerateTreeIsReproducible(t *testing.T) {
+	cfg := DefaultTreeConfig()
+	a := treeContents(t, GenerateTree(cfg))
+	b := treeContents(t, GenerateTree(cfg))
+	if diff := cmp.Diff(a, b); diff != "" {
+		t.Errorf("trees generated with the same seed differ (-a +b):\n%s", diff)
+	}
+	if len(a) != cfg.Files {
+		t.Errorf("expected %d files. got: %d", cfg.Files, len(a))
+	}
+
+	cfg.Seed = 2
+	if diff := cmp.Diff(a, treeContents(t, GenerateTree(cfg))); diff == "" {
+		t.Errorf("expected a different seed to produce a different tree")
+	}
+}
+
+func TestGenerateTreeShape(t *testing.T) {
+	got := treeContents(t, GenerateTree(TreeConfig{
+		Seed:   7,
+		Root:   "/root",
+		Files:  3,
+		Size:   Constant(4),
+		Depth:  Constant(2),
+		Fanout: 1,
+	}))
+	for _, path := range []string{
+		"/root/dir_0/dir_0/file_0.dat",
+		"/root/dir_0/dir_0/file_1.dat",
+		"/root/dir_0/dir_0/file_2.dat",
+	} {
+		data, ok := got[path]
+		if !ok {
+			t.Errorf("expected file %q. got: %v", path, got)
+			continue
+		}
+		if len(data) != 4 {
+			t.Errorf("expected %q to be 4 bytes. got: %d", path, len(data))
+		}
+	}
+}
+
+func BenchmarkMemFSPutTree(b *testing.B) {
+	ctx := context.Background()
+	cfg := DefaultTreeConfig()
+	for i := 0; i < b.N; i++ {
+		fs := qfs.NewMemFS()
+		if _, err := fs.Put(ctx, GenerateTree(cfg)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func treeContents(t *testing.T, root qfs.File) map[string]string {
+	t.Helper()
+	contents := map[string]string{}
+	err := qfs.Walk(root, func(f qfs.File) error {
+		if f.IsDirectory() {
+			return nil
+		}
+		data, err := ioutil.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		contents[f.FullPath()] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return contents
+}
@@ -0,0 +1,5 @@
+// Package qfuse mounts a qfs.Filesystem as a local directory with FUSE, so
+// content stored in any filesystem can be browsed with ordinary tools. Mounts
+// are read-only: directories are listed with qfs.ReadDir, and files are read
+// with Get. FUSE is supported on linux, darwin & freebsd
+package qfuse
@@ -0,0 +1,278 @@
+// +build linux darwin freebsd
+
+package qfuse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+
+	"bazil.org/fuse"
+	fusefs "bazil.org/fuse/fs"
+	logging "github.com/ipfs/go-log"
+	"github.com/qri-io/qfs"
+)
+
+var log = logging.Logger("qfuse")
+
+// FS serves a directory of a qfs.Filesystem over FUSE
+type FS struct {
+	fs   qfs.Filesystem
+	root string
+}
+
+var (
+	_ fusefs.FS                 = (*FS)(nil)
+	_ fusefs.NodeStringLookuper = (*dir)(nil)
+	_ fusefs.HandleReadDirAller = (*dir)(nil)
+	_ fusefs.NodeOpener         = (*file)(nil)
+	_ fusefs.HandleReader       = (*handle)(nil)
+	_ fusefs.HandleReleaser     = (*handle)(nil)
+)
+
+// NewFS creates a FUSE filesystem serving the directory at root in fs
+func NewFS(fs qfs.Filesystem, root string) *FS {
+	return &FS{fs: fs, root: root}
+}
+
+// Root returns the root directory node
+func (f *FS) Root() (fusefs.Node, error) {
+	return &dir{fs: f.fs, path: f.root}, nil
+}
+
+// MountPoint is a mounted filesystem
+type MountPoint struct {
+	dir  string
+	conn *fuse.Conn
+	done chan struct{}
+	err  error
+}
+
+// Mount serves the directory at root in fs at mountpoint, which must be an
+// existing directory. The filesystem is unmounted when ctx ends or Unmount is
+// called
+func Mount(ctx context.Context, fs qfs.Filesystem, root, mountpoint string) (*MountPoint, error) {
+	if _, err := qfs.ReadDir(ctx, fs, root); err != nil {
+		return nil, fmt.Errorf("reading mount root %q: %w", root, err)
+	}
+
+	conn, err := fuse.Mount(mountpoint,
+		fuse.ReadOnly(),
+		fuse.FSName(fs.Type()),
+		fuse.Subtype("qfs"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	mp := &MountPoint{dir: mountpoint, conn: conn, done: make(chan struct{})}
+	go func() {
+		defer close(mp.done)
+		mp.err = fusefs.Serve(conn, NewFS(fs, root))
+		conn.Close()
+	}()
+
+	<-conn.Ready
+	if err := conn.MountError; err != nil {
+		mp.Unmount()
+		return nil, err
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			if err := mp.Unmount(); err != nil {
+				log.Errorf("unmounting %q: %s", mountpoint, err)
+			}
+		case <-mp.done:
+		}
+	}()
+	log.Debugw("mounted", "root", root, "mountpoint", mountpoint)
+	return mp, nil
+}
+
+// Unmount unmounts the filesystem
+func (mp *MountPoint) Unmount() error {
+	select {
+	case <-mp.done:
+		return nil
+	default:
+	}
+	return fuse.Unmount(mp.dir)
+}
+
+// Done is closed once the filesystem is unmounted
+func (mp *MountPoint) Done() <-chan struct{} {
+	return mp.done
+}
+
+// Err returns the error that stopped serving the mount, if any. Err is only
+// valid once Done is closed
+func (mp *MountPoint) Err() error {
+	return mp.err
+}
+
+// dir is a directory node
+type dir struct {
+	fs   qfs.Filesystem
+	path string
+}
+
+// Attr reports a read-only directory
+func (d *dir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0555
+	return nil
+}
+
+// Lookup finds a child of the directory
+func (d *dir) Lookup(ctx context.Context, name string) (fusefs.Node, error) {
+	entries, err := qfs.ReadDir(ctx, d.fs, d.path)
+	if err != nil {
+		return nil, errno(err)
+	}
+	for _, e := range entries {
+		if e.Name == name {
+			return d.node(e), nil
+		}
+	}
+	return nil, fuse.ENOENT
+}
+
+// ReadDirAll lists the directory
+func (d *dir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	entries, err := qfs.ReadDir(ctx, d.fs, d.path)
+	if err != nil {
+		return nil, errno(err)
+	}
+	dirents := make([]fuse.Dirent, len(entries))
+	for i, e := range entries {
+		dirents[i] = fuse.Dirent{Name: e.Name, Type: fuse.DT_File}
+		if e.IsDir {
+			dirents[i].Type = fuse.DT_Dir
+		}
+	}
+	return dirents, nil
+}
+
+func (d *dir) node(e qfs.DirEntry) fusefs.Node {
+	p := path.Join(d.path, e.Name)
+	if e.IsDir {
+		return &dir{fs: d.fs, path: p}
+	}
+	return &file{fs: d.fs, path: p, size: e.Size}
+}
+
+// file is a file node
+type file struct {
+	fs   qfs.Filesystem
+	path string
+	// size is -1 when the filesystem doesn't report it
+	size int64
+}
+
+// Attr reports a read-only file
+func (f *file) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = 0444
+	if f.size > 0 {
+		a.Size = uint64(f.size)
+	}
+	return nil
+}
+
+// Open gets the file from the filesystem
+func (f *file) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fusefs.Handle, error) {
+	if !req.Flags.IsReadOnly() {
+		return nil, fuse.EPERM
+	}
+	qf, err := f.fs.Get(ctx, f.path)
+	if err != nil {
+		return nil, errno(err)
+	}
+	if f.size < 0 {
+		// without a size the kernel can't tell where the file ends, read
+		// directly until the file reports EOF
+		resp.Flags |= fuse.OpenDirectIO
+	}
+	return &handle{file: f, f: qf}, nil
+}
+
+// handle is an open file. Reads are sequential unless the file is seekable,
+// reading backwards reopens the file
+type handle struct {
+	file *file
+
+	lk  sync.Mutex
+	f   qfs.File
+	off int64
+}
+
+// Read reads from the file at the requested offset
+func (h *handle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	if req.Offset != h.off {
+		if err := h.seek(ctx, req.Offset); err != nil {
+			return errno(err)
+		}
+	}
+	buf := make([]byte, req.Size)
+	n, err := io.ReadFull(h.f, buf)
+	h.off += int64(n)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return errno(err)
+	}
+	resp.Data = buf[:n]
+	return nil
+}
+
+func (h *handle) seek(ctx context.Context, off int64) error {
+	if sf, ok := h.f.(qfs.SeekableFile); ok {
+		_, err := sf.Seek(off, io.SeekStart)
+		if err == nil {
+			h.off = off
+			return nil
+		} else if !errors.Is(err, qfs.ErrNotSeekable) {
+			return err
+		}
+	}
+
+	if off < h.off {
+		f, err := h.file.fs.Get(ctx, h.file.path)
+		if err != nil {
+			return err
+		}
+		h.f.Close()
+		h.f, h.off = f, 0
+	}
+	n, err := io.CopyN(ioutil.Discard, h.f, off-h.off)
+	h.off += n
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+// Release closes the file
+func (h *handle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+	return h.f.Close()
+}
+
+// errno converts filesystem errors to FUSE errors
+func errno(err error) error {
+	switch {
+	case errors.Is(err, qfs.ErrNotFound):
+		return fuse.ENOENT
+	case errors.Is(err, qfs.ErrNotDirectory):
+		return fuse.Errno(syscall.ENOTDIR)
+	}
+	return err
+}
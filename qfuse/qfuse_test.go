@@ -0,0 +1,93 @@
+// +build linux darwin freebsd
+
+package qfuse
+
+import (
+	"context"
+	"testing"
+
+	"bazil.org/fuse"
+	fusefs "bazil.org/fuse/fs"
+	"github.com/qri-io/qfs"
+)
+
+func TestNodes(t *testing.T) {
+	ctx := context.Background()
+	mem := qfs.NewMemFS()
+	root, err := mem.Put(ctx, qfs.NewMemdir("/",
+		qfs.NewMemfileBytes("a.txt", []byte("hello world")),
+		qfs.NewMemdir("b",
+			qfs.NewMemfileBytes("c.txt", []byte("nested")),
+		),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rootNode, err := NewFS(mem, root).Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := rootNode.(*dir)
+
+	dirents, err := d.ReadDirAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirents) != 2 || dirents[0].Name != "a.txt" || dirents[0].Type != fuse.DT_File || dirents[1].Name != "b" || dirents[1].Type != fuse.DT_Dir {
+		t.Errorf("unexpected listing: %#v", dirents)
+	}
+
+	if _, err := d.Lookup(ctx, "missing"); err != fuse.ENOENT {
+		t.Errorf("expected ENOENT looking up a missing name, got: %v", err)
+	}
+
+	nd, err := d.Lookup(ctx, "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attr := fuse.Attr{}
+	if err := nd.Attr(ctx, &attr); err != nil {
+		t.Fatal(err)
+	}
+	if attr.Size != 11 || attr.Mode != 0444 {
+		t.Errorf("unexpected attributes: %s", attr)
+	}
+
+	h, err := nd.(fusefs.NodeOpener).Open(ctx, &fuse.OpenRequest{Flags: fuse.OpenReadOnly}, &fuse.OpenResponse{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := func(off int64, size int) string {
+		t.Helper()
+		resp := &fuse.ReadResponse{}
+		if err := h.(fusefs.HandleReader).Read(ctx, &fuse.ReadRequest{Offset: off, Size: size}, resp); err != nil {
+			t.Fatal(err)
+		}
+		return string(resp.Data)
+	}
+	if got := read(6, 5); got != "world" {
+		t.Errorf("expected %q, got %q", "world", got)
+	}
+	if got := read(0, 5); got != "hello" {
+		t.Errorf("reading backwards: expected %q, got %q", "hello", got)
+	}
+	if got := read(5, 100); got != " world" {
+		t.Errorf("reading past the end: expected %q, got %q", " world", got)
+	}
+	if err := h.(fusefs.HandleReleaser).Release(ctx, &fuse.ReleaseRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := nd.(fusefs.NodeOpener).Open(ctx, &fuse.OpenRequest{Flags: fuse.OpenWriteOnly}, &fuse.OpenResponse{}); err != fuse.EPERM {
+		t.Errorf("expected EPERM opening for writing, got: %v", err)
+	}
+
+	sub, err := d.Lookup(ctx, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sub.(*dir).Lookup(ctx, "c.txt"); err != nil {
+		t.Errorf("expected to find nested file: %s", err)
+	}
+}
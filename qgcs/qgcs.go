@@ -0,0 +1,317 @@
+// Package qgcs is a qfs.Filesystem backed by a Google Cloud Storage bucket.
+// It speaks the GCS JSON API directly, so it needs no local IPFS node &
+// no cloud SDK. Files are stored as objects named by their path, and are
+// addressed as /gcs/<object name>
+package qgcs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	logging "github.com/ipfs/go-log"
+	"github.com/mitchellh/mapstructure"
+	"github.com/qri-io/qfs"
+)
+
+// FilestoreType uniquely identifies this filestore
+const FilestoreType = "gcs"
+
+// DefaultEndpoint is the GCS JSON API host
+const DefaultEndpoint = "https://storage.googleapis.com"
+
+var log = logging.Logger("qgcs")
+
+// ErrNoBucket is returned when constructing a filesystem without a bucket
+var ErrNoBucket = errors.New("gcs bucket is required")
+
+// FSConfig adjusts the behaviour of an FS instance
+type FSConfig struct {
+	// Bucket is the name of the bucket files are stored in
+	Bucket string
+	// Endpoint is the base URL of the storage API. defaults to DefaultEndpoint,
+	// and can point at an emulator for testing
+	Endpoint string
+	// Token is an OAuth2 access token sent with every request. Leave empty
+	// when Client handles authorization, or the bucket is public
+	Token string
+	// Client to use to make requests. Clients from golang.org/x/oauth2/google
+	// authorize requests with application default credentials
+	Client *http.Client
+}
+
+// Option is a function type for passing to NewFS
+type Option func(cfg *FSConfig)
+
+// OptionSetHTTPClient sets the http client to use
+func OptionSetHTTPClient(cli *http.Client) Option {
+	return func(cfg *FSConfig) {
+		cfg.Client = cli
+	}
+}
+
+// DefaultFSConfig is the configuration state with no additional options
+// consumers of this package typically don't need to use this
+func DefaultFSConfig() *FSConfig {
+	return &FSConfig{
+		Endpoint: DefaultEndpoint,
+		Client:   http.DefaultClient,
+	}
+}
+
+// if no cfgMap is given, return the default config
+func mapToConfig(cfgMap map[string]interface{}) (*FSConfig, error) {
+	cfg := DefaultFSConfig()
+	if cfgMap == nil {
+		return cfg, nil
+	}
+	if err := mapstructure.Decode(cfgMap, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// FS is a qfs.Filesystem that stores files in a GCS bucket
+type FS struct {
+	cfg *FSConfig
+}
+
+// compile-time assertion that FS satisfies the Filesystem interface
+var _ qfs.Filesystem = (*FS)(nil)
+
+// NewFilesystem creates a new gcs filesystem from a config map
+func NewFilesystem(_ context.Context, cfgMap map[string]interface{}) (qfs.Filesystem, error) {
+	return NewFS(cfgMap)
+}
+
+// NewFS creates a new gcs filesystem
+func NewFS(cfgMap map[string]interface{}, opts ...Option) (*FS, error) {
+	cfg, err := mapToConfig(cfgMap)
+	if err != nil {
+		return nil, err
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.Bucket == "" {
+		return nil, ErrNoBucket
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = DefaultEndpoint
+	}
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	return &FS{cfg: cfg}, nil
+}
+
+// Type distinguishes this filesystem from others by a unique string prefix
+func (gfs *FS) Type() string {
+	return FilestoreType
+}
+
+// objectName converts a path to the name of the object it's stored as
+func objectName(path string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(path, "/"+FilestoreType+"/"), "/")
+}
+
+// objectURL gives the API url of an object, with query params
+func (gfs *FS) objectURL(name string, query url.Values) string {
+	u := fmt.Sprintf("%s/storage/v1/b/%s/o/%s", gfs.cfg.Endpoint, url.PathEscape(gfs.cfg.Bucket), url.PathEscape(name))
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+func (gfs *FS) do(ctx context.Context, method, u string, body io.Reader, contentType string) (*http.Response, error) {
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if gfs.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+gfs.cfg.Token)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return gfs.cfg.Client.Do(req)
+}
+
+// Has returns whether the bucket has an object at path
+func (gfs *FS) Has(ctx context.Context, path string) (bool, error) {
+	res, err := gfs.do(ctx, http.MethodGet, gfs.objectURL(objectName(path), url.Values{"fields": {"name"}}), nil, "")
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return false, responseError(res, path)
+	}
+	return true, nil
+}
+
+// Get streams the object at path. The returned file reads directly from the
+// response, and must be closed
+func (gfs *FS) Get(ctx context.Context, path string) (qfs.File, error) {
+	name := objectName(path)
+	res, err := gfs.do(ctx, http.MethodGet, gfs.objectURL(name, url.Values{"alt": {"media"}}), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, qfs.ErrNotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		return nil, responseError(res, path)
+	}
+	return &File{path: "/" + FilestoreType + "/" + name, res: res}, nil
+}
+
+// Put uploads a file to the bucket, returning its /gcs/ path. Directories
+// upload each file they contain under the directory's path
+func (gfs *FS) Put(ctx context.Context, file qfs.File) (string, error) {
+	name := objectName(file.FullPath())
+	if name == "" {
+		return "", fmt.Errorf("gcs object name is required. path: %q", file.FullPath())
+	}
+	path := "/" + FilestoreType + "/" + name
+
+	if file.IsDirectory() {
+		for {
+			child, err := file.NextFile()
+			if errors.Is(err, io.EOF) {
+				return path, nil
+			} else if err != nil {
+				return "", err
+			}
+			if _, err := gfs.Put(ctx, child); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	u := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?%s", gfs.cfg.Endpoint, url.PathEscape(gfs.cfg.Bucket), url.Values{
+		"uploadType": {"media"},
+		"name":       {name},
+	}.Encode())
+	mediaType := file.MediaType()
+	if mediaType == "" {
+		mediaType = "application/octet-stream"
+	}
+	res, err := gfs.do(ctx, http.MethodPost, u, file, mediaType)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", responseError(res, path)
+	}
+	log.Debugw("put object", "bucket", gfs.cfg.Bucket, "name", name)
+	return path, nil
+}
+
+// Delete removes the object at path. Deleting an object that doesn't exist
+// returns qfs.ErrNotFound
+func (gfs *FS) Delete(ctx context.Context, path string) error {
+	res, err := gfs.do(ctx, http.MethodDelete, gfs.objectURL(objectName(path), nil), nil, "")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return qfs.ErrNotFound
+	}
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK {
+		return responseError(res, path)
+	}
+	return nil
+}
+
+// responseError reads an API error response
+func responseError(res *http.Response, path string) error {
+	data, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1<<16))
+	apiErr := struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}{}
+	msg := strings.TrimSpace(string(data))
+	if err := json.Unmarshal(data, &apiErr); err == nil && apiErr.Error.Message != "" {
+		msg = apiErr.Error.Message
+	}
+	return fmt.Errorf("gcs %s (%d): %s. path: %s", res.Request.Method, res.StatusCode, msg, path)
+}
+
+// File is a GCS object read from a streaming response
+type File struct {
+	path string
+	res  *http.Response
+}
+
+var (
+	_ qfs.File     = (*File)(nil)
+	_ qfs.SizeFile = (*File)(nil)
+)
+
+// Read proxies to the response body reader
+func (f *File) Read(p []byte) (int, error) {
+	return f.res.Body.Read(p)
+}
+
+// Close proxies to the response body reader
+func (f *File) Close() error {
+	return f.res.Body.Close()
+}
+
+// Size gives the response Content-Length, or -1 if it's unknown
+func (f *File) Size() int64 {
+	return f.res.ContentLength
+}
+
+// IsDirectory satisfies the qfs.File interface
+func (f *File) IsDirectory() bool {
+	return false
+}
+
+// NextFile satisfies the qfs.File interface
+func (f *File) NextFile() (qfs.File, error) {
+	return nil, qfs.ErrNotDirectory
+}
+
+// FileName returns a filename associated with this file
+func (f *File) FileName() string {
+	return filepath.Base(f.path)
+}
+
+// FullPath returns the /gcs/ path of the file
+func (f *File) FullPath() string {
+	return f.path
+}
+
+// MediaType gives the content type the object was stored with
+func (f *File) MediaType() string {
+	return strings.Split(f.res.Header.Get("Content-Type"), ";")[0]
+}
+
+// ModTime gives the object's last modification time, if the response
+// reports it
+func (f *File) ModTime() time.Time {
+	t, _ := http.ParseTime(f.res.Header.Get("Last-Modified"))
+	return t
+}
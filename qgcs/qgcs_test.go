@@ -0,0 +1,143 @@
+package qgcs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/qri-io/qfs"
+)
+
+// fakeGCS is an in-memory stand-in for the GCS JSON API
+type fakeGCS struct {
+	lk      sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+}
+
+func newFakeGCS() *fakeGCS {
+	return &fakeGCS{objects: map[string][]byte{}, types: map[string]string{}}
+}
+
+func (s *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/upload/storage/v1/b/bucket/o") {
+		data, _ := ioutil.ReadAll(r.Body)
+		name := r.URL.Query().Get("name")
+		s.objects[name] = data
+		s.types[name] = r.Header.Get("Content-Type")
+		w.Write([]byte(`{"name":"` + name + `"}`))
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.EscapedPath(), "/storage/v1/b/bucket/o/")
+	name = strings.Replace(name, "%2F", "/", -1)
+	data, ok := s.objects[name]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":{"code":404,"message":"No such object"}}`))
+		return
+	}
+	switch {
+	case r.Method == http.MethodDelete:
+		delete(s.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	case r.URL.Query().Get("alt") == "media":
+		w.Header().Set("Content-Type", s.types[name])
+		w.Write(data)
+	default:
+		w.Write([]byte(`{"name":"` + name + `"}`))
+	}
+}
+
+func TestFS(t *testing.T) {
+	ctx := context.Background()
+	s := httptest.NewServer(newFakeGCS())
+	defer s.Close()
+
+	fs, err := NewFS(map[string]interface{}{"Bucket": "bucket", "Endpoint": s.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := qfs.NewMemfileBytes("data/a.json", []byte(`{"a":1}`))
+	path, err := fs.Put(ctx, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/gcs/data/a.json" {
+		t.Errorf("unexpected put path: %q", path)
+	}
+
+	if has, err := fs.Has(ctx, path); err != nil || !has {
+		t.Errorf("expected fs to have %q. has: %t err: %v", path, has, err)
+	}
+	if has, err := fs.Has(ctx, "/gcs/missing"); err != nil || has {
+		t.Errorf("expected fs not to have missing object. has: %t err: %v", has, err)
+	}
+
+	got, err := fs.Get(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(got)
+	got.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"a":1}` {
+		t.Errorf("content mismatch. got: %q", string(data))
+	}
+	if got.MediaType() != "application/json" {
+		t.Errorf("expected media type to round trip, got %q", got.MediaType())
+	}
+	if size := qfs.FileSize(got); size != 7 {
+		t.Errorf("size mismatch. want: 7 got: %d", size)
+	}
+
+	if err := fs.Delete(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Get(ctx, path); !errors.Is(err, qfs.ErrNotFound) {
+		t.Errorf("expected ErrNotFound after delete, got %v", err)
+	}
+	if err := fs.Delete(ctx, path); !errors.Is(err, qfs.ErrNotFound) {
+		t.Errorf("expected ErrNotFound deleting a missing object, got %v", err)
+	}
+}
+
+func TestPutDirectory(t *testing.T) {
+	ctx := context.Background()
+	s := httptest.NewServer(newFakeGCS())
+	defer s.Close()
+
+	fs, err := NewFS(map[string]interface{}{"Bucket": "bucket", "Endpoint": s.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := qfs.NewMemdir("/gcs/dir",
+		qfs.NewMemfileBytes("a.txt", []byte("a")),
+		qfs.NewMemfileBytes("b.txt", []byte("b")),
+	)
+	if _, err := fs.Put(ctx, dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"/gcs/dir/a.txt", "/gcs/dir/b.txt"} {
+		if has, err := fs.Has(ctx, p); err != nil || !has {
+			t.Errorf("expected fs to have %q. has: %t err: %v", p, has, err)
+		}
+	}
+}
+
+func TestNewFSRequiresBucket(t *testing.T) {
+	if _, err := NewFS(nil); !errors.Is(err, ErrNoBucket) {
+		t.Errorf("expected ErrNoBucket, got %v", err)
+	}
+}
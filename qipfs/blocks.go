@@ -0,0 +1,158 @@
+package qipfs
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/qri-io/qfs"
+)
+
+// blockPipelineDepth bounds the block requests in flight against a remote
+// node's API, which has no batch endpoint
+const blockPipelineDepth = 8
+
+// rawBlockPrefix builds the CIDs PutBlock assigns: CIDv1, raw, sha2-256
+var rawBlockPrefix = cid.Prefix{Version: 1, Codec: cid.Raw, MhType: multihash.SHA2_256, MhLength: -1}
+
+// PutBlocks writes a batch of raw blocks. With a local repo the batch is
+// written to the blockstore at once, otherwise puts to the remote API are
+// pipelined
+func (fst *Filestore) PutBlocks(ctx context.Context, data [][]byte) ([]cid.Cid, error) {
+	ids := make([]cid.Cid, len(data))
+	if bs, err := fst.blockService(); err == nil {
+		blks := make([]blocks.Block, len(data))
+		for i, d := range data {
+			id, err := rawBlockPrefix.Sum(d)
+			if err != nil {
+				return nil, err
+			}
+			if blks[i], err = blocks.NewBlockWithCid(d, id); err != nil {
+				return nil, err
+			}
+			ids[i] = id
+		}
+		if err := bs.AddBlocks(blks); err != nil {
+			return nil, err
+		}
+	} else {
+		err := pipeline(ctx, len(data), func(ctx context.Context, i int) (err error) {
+			ids[i], err = fst.drv.BlockPut(ctx, data[i], "raw")
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, id := range ids {
+		fst.filterAdd(id)
+	}
+	return ids, nil
+}
+
+// GetBlocks reads a batch of blocks, answering from the block cache first.
+// With a local repo the remaining blocks are fetched by the block service in
+// one request, otherwise gets from the remote API are pipelined
+func (fst *Filestore) GetBlocks(ctx context.Context, ids []cid.Cid) ([][]byte, error) {
+	data := make([][]byte, len(ids))
+	missing := make([]int, 0, len(ids))
+	for i, id := range ids {
+		if fst.blockCache != nil {
+			if d, err := fst.blockCache.GetBlock(id); err == nil {
+				data[i] = d
+				continue
+			}
+		}
+		missing = append(missing, i)
+	}
+
+	if bs, err := fst.blockService(); err == nil {
+		want := make([]cid.Cid, 0, len(missing))
+		for _, i := range missing {
+			want = append(want, ids[i])
+		}
+		got := make(map[cid.Cid][]byte, len(want))
+		for blk := range bs.GetBlocks(ctx, want) {
+			got[blk.Cid()] = blk.RawData()
+		}
+		for _, i := range missing {
+			d, ok := got[ids[i]]
+			if !ok {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				return nil, fmt.Errorf("%w: block %s", qfs.ErrNotFound, ids[i])
+			}
+			data[i] = d
+		}
+	} else {
+		err := pipeline(ctx, len(missing), func(ctx context.Context, j int) error {
+			i := missing[j]
+			r, err := fst.drv.BlockGet(ctx, ids[i])
+			if err != nil {
+				return typedError(err)
+			}
+			data[i], err = ioutil.ReadAll(r)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, i := range missing {
+		fst.filterAdd(ids[i])
+		if fst.blockCache != nil {
+			if err := fst.blockCache.PutBlock(ids[i], data[i]); err != nil {
+				log.Debugw("caching block", "cid", ids[i].String(), "err", err)
+			}
+		}
+	}
+	return data, nil
+}
+
+// pipeline calls fn for indexes 0 through n-1, with up to blockPipelineDepth
+// calls in flight. The first error cancels remaining calls & is returned
+func pipeline(ctx context.Context, n int, fn func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+		sem      = make(chan struct{}, blockPipelineDepth)
+	)
+	for i := 0; i < n; i++ {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := fn(ctx, i); err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
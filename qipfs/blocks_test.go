@@ -0,0 +1,69 @@
+package qipfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/qri-io/qfs"
+)
+
+func TestBlockBatches(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+	local, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api := &blockAPI{blocks: map[string][]byte{}, failAfter: -1}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+	remote, err := NewFilesystem(ctx, map[string]interface{}{"url": srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := make([][]byte, 50)
+	for i := range data {
+		data[i] = []byte(fmt.Sprintf("block %d", i))
+	}
+
+	for name, fs := range map[string]*Filestore{"local": local.(*Filestore), "http": remote.(*Filestore)} {
+		ids, err := fs.PutBlocks(ctx, data)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if len(ids) != len(data) {
+			t.Fatalf("%s: expected %d ids, got %d", name, len(data), len(ids))
+		}
+		for i, id := range ids {
+			expect, _ := rawBlockPrefix.Sum(data[i])
+			if !id.Equals(expect) {
+				t.Errorf("%s: block %d: expected cid %s, got %s", name, i, expect, id)
+			}
+		}
+
+		got, err := fs.GetBlocks(ctx, ids)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		for i := range data {
+			if string(got[i]) != string(data[i]) {
+				t.Errorf("%s: block %d: expected %q, got %q", name, i, data[i], got[i])
+			}
+		}
+	}
+
+	missing, _ := rawBlockPrefix.Sum([]byte("missing"))
+	if _, err := remote.(*Filestore).GetBlocks(ctx, []cid.Cid{missing}); !errors.Is(err, qfs.ErrNotFound) {
+		t.Errorf("expected a missing block to return ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package qipfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	blocks "github.com/ipfs/go-block-format"
+	bserv "github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-cid"
+	merkledag "github.com/ipfs/go-merkledag"
+	car "github.com/ipld/go-car"
+	httpapi "github.com/qri-io/go-ipfs-http-client"
+	"github.com/qri-io/qfs"
+)
+
+var _ qfs.CARFS = (*Filestore)(nil)
+
+// carDriver is implemented by drivers that move whole DAGs as CAR streams
+// themselves. Drivers that don't are exported & imported through their block
+// service
+type carDriver interface {
+	exportCAR(ctx context.Context, root cid.Cid, w io.Writer) error
+	importCAR(ctx context.Context, r io.Reader) ([]cid.Cid, error)
+}
+
+// exportCAR streams the DAG from the remote daemon's dag/export endpoint in a
+// single request
+func (d *httpDriver) exportCAR(ctx context.Context, root cid.Cid, w io.Writer) error {
+	api, ok := d.capi.(*httpapi.HttpApi)
+	if !ok {
+		return fmt.Errorf("http driver has unexpected api client %T", d.capi)
+	}
+	res, err := api.Request("dag/export", root.String()).Option("progress", false).Send(ctx)
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+	if res.Error != nil {
+		return res.Error
+	}
+	_, err = io.Copy(w, res.Output)
+	return err
+}
+
+// importCAR streams r to the remote daemon's dag/import endpoint in a single
+// request. The daemon pins the archive's roots
+func (d *httpDriver) importCAR(ctx context.Context, r io.Reader) ([]cid.Cid, error) {
+	api, ok := d.capi.(*httpapi.HttpApi)
+	if !ok {
+		return nil, fmt.Errorf("http driver has unexpected api client %T", d.capi)
+	}
+	res, err := api.Request("dag/import").Option("pin-roots", true).FileBody(r).Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	var roots []cid.Cid
+	dec := json.NewDecoder(res.Output)
+	for {
+		var out struct {
+			Root struct {
+				Cid         cid.Cid
+				PinErrorMsg string
+			}
+		}
+		if err := dec.Decode(&out); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("decoding dag/import response: %w", err)
+		}
+		if out.Root.PinErrorMsg != "" {
+			return nil, fmt.Errorf("pinning imported root %s: %s", out.Root.Cid, out.Root.PinErrorMsg)
+		}
+		roots = append(roots, out.Root.Cid)
+	}
+	return roots, nil
+}
+
+// the split driver's write endpoint is authoritative for both directions
+func (d *splitDriver) exportCAR(ctx context.Context, root cid.Cid, w io.Writer) error {
+	return d.httpDriver.exportCAR(ctx, root, w)
+}
+
+func (d *splitDriver) importCAR(ctx context.Context, r io.Reader) ([]cid.Cid, error) {
+	return d.httpDriver.importCAR(ctx, r)
+}
+
+// ExportCAR writes the DAG rooted at path to w as a CAR (content-addressed
+// archive) stream. Filestores backed by the HTTP API stream the archive from
+// the daemon in a single request
+func (fst *Filestore) ExportCAR(ctx context.Context, path string, w io.Writer) error {
+	root, err := cid.Parse(path)
+	if err != nil {
+		return err
+	}
+	if cd, ok := fst.drv.(carDriver); ok {
+		return cd.exportCAR(ctx, root, w)
+	}
+
+	bs, err := fst.blockService()
+	if err != nil {
+		return err
+	}
+	return car.WriteCar(ctx, merkledag.NewDAGService(bs), []cid.Cid{root}, w)
+}
+
+// ImportCAR stores every block in the CAR stream r & recursively pins the
+// archive's roots, returning root paths. Filestores backed by the HTTP API
+// stream the archive to the daemon in a single request. ImportCAR accepts
+// archives with any number of roots to satisfy qfs.CARFS, use ImportCARRoot
+// for the common single-rooted archive
+func (fst *Filestore) ImportCAR(ctx context.Context, r io.Reader) ([]string, error) {
+	var roots []cid.Cid
+	if cd, ok := fst.drv.(carDriver); ok {
+		var err error
+		if roots, err = cd.importCAR(ctx, r); err != nil {
+			return nil, err
+		}
+	} else {
+		bs, err := fst.blockService()
+		if err != nil {
+			return nil, err
+		}
+		h, err := car.LoadCar(blockServiceStore{bs}, r)
+		if err != nil {
+			return nil, err
+		}
+		for _, root := range h.Roots {
+			if err := fst.drv.Pin(ctx, pathFromHash(root.String()), true); err != nil {
+				return nil, fmt.Errorf("pinning imported root %s: %w", root, err)
+			}
+		}
+		roots = h.Roots
+	}
+
+	paths := make([]string, 0, len(roots))
+	for _, root := range roots {
+		fst.filterAddDAG(ctx, root)
+		paths = append(paths, pathFromHash(root.String()))
+	}
+	return paths, nil
+}
+
+// ImportCARRoot imports a single-rooted CAR stream like ImportCAR, returning
+// the root CID. Archives with any other number of roots are rejected before
+// anything is stored or pinned
+func (fst *Filestore) ImportCARRoot(ctx context.Context, r io.Reader) (cid.Cid, error) {
+	roots, r, err := carRoots(r)
+	if err != nil {
+		return cid.Undef, err
+	}
+	if len(roots) != 1 {
+		return cid.Undef, fmt.Errorf("expected CAR archive with one root, got %d", len(roots))
+	}
+	if _, err := fst.ImportCAR(ctx, r); err != nil {
+		return cid.Undef, err
+	}
+	return roots[0], nil
+}
+
+// carRoots reads the roots from the header of a CAR stream, returning a
+// reader of the whole stream, header included
+func carRoots(r io.Reader) ([]cid.Cid, io.Reader, error) {
+	read := &bytes.Buffer{}
+	h, err := car.ReadHeader(bufio.NewReader(io.TeeReader(r, read)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading CAR header: %w", err)
+	}
+	return h.Roots, io.MultiReader(read, r), nil
+}
+
+func (fst *Filestore) blockService() (bserv.BlockService, error) {
+	if sd, ok := fst.drv.(sessionDriver); ok {
+		if bs := sd.blockService(); bs != nil {
+			return bs, nil
+		}
+	}
+	return nil, fmt.Errorf("ipfs driver %T can't move CAR archives", fst.drv)
+}
+
+// blockServiceStore adapts a block service to the car.Store interface
+type blockServiceStore struct {
+	bs bserv.BlockService
+}
+
+func (s blockServiceStore) Put(blk blocks.Block) error { return s.bs.AddBlock(blk) }
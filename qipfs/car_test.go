@@ -0,0 +1,208 @@
+package qipfs
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	merkledag "github.com/ipfs/go-merkledag"
+	car "github.com/ipld/go-car"
+	"github.com/qri-io/qfs"
+)
+
+func TestCARRoundTrip(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srcPath := InitTestRepo(t)
+	defer os.RemoveAll(srcPath)
+	dstPath := InitTestRepo(t)
+	defer os.RemoveAll(dstPath)
+
+	src, err := NewFilesystem(ctx, map[string]interface{}{"path": srcPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err := NewFilesystem(ctx, map[string]interface{}{"path": dstPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// large enough to be chunked into a DAG of several blocks
+	content := bytes.Repeat([]byte("qfs car "), 1<<16)
+	key, err := src.Put(ctx, qfs.NewMemfileBytes("data.txt", content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := src.(qfs.CARFS).ExportCAR(ctx, key, buf); err != nil {
+		t.Fatal(err)
+	}
+	roots, err := dst.(qfs.CARFS).ImportCAR(ctx, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roots) != 1 || roots[0] != key {
+		t.Fatalf("imported roots mismatch. want [%s], got %v", key, roots)
+	}
+
+	f, err := dst.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadAll(f); !bytes.Equal(data, content) {
+		t.Errorf("imported file content mismatch")
+	}
+
+	pins, err := dst.(*Filestore).drv.Pins(ctx, "recursive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinned := false
+	for p := range pins {
+		pinned = pinned || pathFromHash(p.Cid.String()) == key
+	}
+	if !pinned {
+		t.Errorf("expected imported root to be pinned")
+	}
+
+	// archives move between offline filestores by CID
+	buf.Reset()
+	id, err := cid.Parse(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.(qfs.CARFS).ExportCAR(ctx, id.String(), buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := src.(*Filestore).ImportCARRoot(ctx, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equals(id) {
+		t.Errorf("imported root mismatch. want %s, got %s", id, got)
+	}
+}
+
+func TestImportCARRootRejectsMultipleRoots(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srcPath := InitTestRepo(t)
+	defer os.RemoveAll(srcPath)
+	dstPath := InitTestRepo(t)
+	defer os.RemoveAll(dstPath)
+
+	src, err := NewFilesystem(ctx, map[string]interface{}{"path": srcPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err := NewFilesystem(ctx, map[string]interface{}{"path": dstPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var roots []cid.Cid
+	for _, data := range []string{"root a", "root b"} {
+		key, err := src.Put(ctx, qfs.NewMemfileBytes("data.txt", []byte(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := cid.Parse(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		roots = append(roots, id)
+	}
+	bs, err := src.(*Filestore).blockService()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	if err := car.WriteCar(ctx, merkledag.NewDAGService(bs), roots, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := dst.(*Filestore).ImportCARRoot(ctx, buf); err == nil {
+		t.Fatal("expected an archive with two roots to be rejected")
+	}
+	for _, id := range roots {
+		if has, _ := dst.(*Filestore).drv.BlockHas(ctx, id); has {
+			t.Errorf("expected rejected archive not to store %s", id)
+		}
+		if pinned, _ := dst.(*Filestore).IsPinned(ctx, pathFromHash(id.String())); pinned {
+			t.Errorf("expected rejected archive not to pin %s", id)
+		}
+	}
+}
+
+func TestHTTPCARStreams(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	root := testBlockCid("car root")
+	archive := []byte("car bytes")
+	var imported []byte
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v0/dag/export":
+			if arg := r.URL.Query().Get("arg"); arg != root.String() {
+				t.Errorf("export root mismatch. want %q, got %q", root.String(), arg)
+			}
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(archive)
+		case "/api/v0/dag/import":
+			mr, err := r.MultipartReader()
+			if err != nil {
+				t.Errorf("reading import body: %s", err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			f, err := mr.NextPart()
+			if err != nil {
+				t.Errorf("reading import body: %s", err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			imported, _ = ioutil.ReadAll(f)
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"Root":{"Cid":{"/":"` + root.String() + `"},"PinErrorMsg":""}}` + "\n"))
+		default:
+			t.Errorf("unexpected request to %q", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	fs, err := NewFilesystem(ctx, map[string]interface{}{"url": s.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfs := fs.(qfs.CARFS)
+
+	buf := &bytes.Buffer{}
+	if err := cfs.ExportCAR(ctx, pathFromHash(root.String()), buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), archive) {
+		t.Errorf("exported archive mismatch. want %q, got %q", archive, buf.Bytes())
+	}
+
+	roots, err := cfs.ImportCAR(ctx, bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(imported, archive) {
+		t.Errorf("imported archive mismatch. want %q, got %q", archive, imported)
+	}
+	if len(roots) != 1 || roots[0] != pathFromHash(root.String()) {
+		t.Errorf("imported roots mismatch. got %v", roots)
+	}
+}
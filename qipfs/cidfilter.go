@@ -0,0 +1,111 @@
+package qipfs
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/ipfs/go-cid"
+	"github.com/qri-io/qfs"
+)
+
+// SetCIDFilter sets a filter of locally stored blocks that Has consults
+// before the blockstore. Blocks put or pinned through the filestore are added
+// to the filter. Gets that may fetch blocks from the network mark the filter
+// stale, & Has confirms filter misses with the blockstore until the next
+// RebuildCIDFilter. Blocks that arrive by other means, like a daemon sharing
+// the repo, are only picked up by RebuildCIDFilter
+func (fst *Filestore) SetCIDFilter(f *qfs.CIDFilter) {
+	fst.cidFilter = f
+}
+
+// CIDFilter returns the filter set with SetCIDFilter, if any
+func (fst *Filestore) CIDFilter() *qfs.CIDFilter {
+	return fst.cidFilter
+}
+
+// RebuildCIDFilter repopulates the CID filter from a scan of the local
+// blockstore. Has keeps using the existing filter contents while the scan
+// runs, so rebuilds can run in the background
+func (fst *Filestore) RebuildCIDFilter(ctx context.Context) error {
+	if fst.cidFilter == nil {
+		return nil
+	}
+	bs, err := fst.localBlockstore()
+	if err != nil {
+		return err
+	}
+	// blocks fetched once the scan starts mark the filter stale again
+	atomic.StoreInt32(&fst.cidFilterStale, 0)
+	err = fst.cidFilter.Rebuild(func(add func(id cid.Cid)) error {
+		keys, err := bs.AllKeysChan(ctx)
+		if err != nil {
+			return err
+		}
+		for id := range keys {
+			add(id)
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		fst.markFilterStale()
+	}
+	return err
+}
+
+// filterAdd records a block in the CID filter
+func (fst *Filestore) filterAdd(id cid.Cid) {
+	if fst.cidFilter != nil {
+		fst.cidFilter.Add(id)
+	}
+}
+
+// filterAddDAG records every block of a locally stored DAG in the CID filter.
+// The filter is marked stale if the DAG can't be listed
+func (fst *Filestore) filterAddDAG(ctx context.Context, root cid.Cid) {
+	if fst.cidFilter == nil {
+		return
+	}
+	ids, err := fst.drv.Refs(ctx, root)
+	if err != nil {
+		log.Debugw("adding dag to cid filter", "root", root.String(), "err", err)
+		fst.markFilterStale()
+		return
+	}
+	for _, id := range ids {
+		fst.cidFilter.Add(id)
+	}
+}
+
+// filterAddPin records the blocks a pin of path holds in the CID filter
+func (fst *Filestore) filterAddPin(ctx context.Context, path string, recursive bool) {
+	if fst.cidFilter == nil {
+		return
+	}
+	id, err := fst.pinCid(ctx, path)
+	if err != nil {
+		fst.markFilterStale()
+		return
+	}
+	if !recursive {
+		fst.cidFilter.Add(id)
+		return
+	}
+	fst.filterAddDAG(ctx, id)
+}
+
+// filterFetched marks the CID filter stale after a read that may have fetched
+// blocks from the network. Offline reads only see local blocks
+func (fst *Filestore) filterFetched() {
+	if fst.cidFilter != nil && fst.Online() && !fst.IsOffline() {
+		fst.markFilterStale()
+	}
+}
+
+func (fst *Filestore) markFilterStale() {
+	atomic.StoreInt32(&fst.cidFilterStale, 1)
+}
+
+// filterStale reports whether the CID filter may be missing local blocks
+func (fst *Filestore) filterStale() bool {
+	return atomic.LoadInt32(&fst.cidFilterStale) == 1
+}
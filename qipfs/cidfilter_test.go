@@ -0,0 +1,110 @@
+package qipfs
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/qri-io/qfs"
+)
+
+func TestCIDFilterHas(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	f, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst := f.(*Filestore)
+	fst.SetCIDFilter(qfs.NewCIDFilter(1000, 0.01))
+
+	key, err := fst.Put(ctx, qfs.NewMemfileBytes("a.txt", []byte("filtered")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has, err := fst.Has(ctx, key); err != nil || !has {
+		t.Errorf("expected filestore to have written key. got: %t, %v", has, err)
+	}
+
+	absent := "/ipfs/QmcBD4Mj1SNV37DtrLHYZ4HKDaSPWFv2HSwmcNpZVAMzmm"
+	if has, err := fst.Has(ctx, absent); err != nil || has {
+		t.Errorf("expected absent key to be missing. got: %t, %v", has, err)
+	}
+
+	// blocks already in the repo aren't in the filter until it's rebuilt
+	if err := fst.RebuildCIDFilter(ctx); err != nil {
+		t.Fatal(err)
+	}
+	stats := fst.CIDFilter().Stats()
+	if stats.Count < 2 {
+		t.Errorf("expected rebuild to scan the repo's blocks. got count: %d", stats.Count)
+	}
+	if has, err := fst.Has(ctx, key); err != nil || !has {
+		t.Errorf("expected filestore to have written key after rebuild. got: %t, %v", has, err)
+	}
+}
+
+func TestCIDFilterPinnedAndFetched(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	f, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst := f.(*Filestore)
+
+	// a file large enough to be chunked, stored before the filter is set
+	key, err := fst.Put(ctx, qfs.NewMemfileBytes("a.txt", make([]byte, 600<<10)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := cid.Parse(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := fst.drv.Refs(ctx, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) < 2 {
+		t.Fatalf("expected a chunked file. got %d blocks", len(ids))
+	}
+
+	fst.SetCIDFilter(qfs.NewCIDFilter(1000, 0.01))
+	if err := fst.Unpin(ctx, key, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := fst.Pin(ctx, key, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range ids {
+		if has, err := fst.Has(ctx, id.String()); err != nil || !has {
+			t.Errorf("expected pinned block %s in the filter. got: %t, %v", id, has, err)
+		}
+	}
+
+	// a stale filter confirms misses with the blockstore
+	fst.SetCIDFilter(qfs.NewCIDFilter(1000, 0.01))
+	fst.markFilterStale()
+	if has, err := fst.Has(ctx, key); err != nil || !has {
+		t.Errorf("expected stale filter miss to be confirmed. got: %t, %v", has, err)
+	}
+	if res, err := fst.HasMany(ctx, []string{ids[1].String()}); err != nil || !res[ids[1].String()] {
+		t.Errorf("expected stale filter miss to be confirmed by HasMany. got: %v, %v", res, err)
+	}
+	if err := fst.RebuildCIDFilter(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if fst.filterStale() {
+		t.Error("expected rebuild to clear the stale flag")
+	}
+}
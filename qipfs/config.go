@@ -2,6 +2,7 @@ package qipfs
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/ipfs/go-ipfs/core"
 	"github.com/mitchellh/mapstructure"
@@ -10,6 +11,10 @@ import (
 // ErrNoRepoPath is returned when no repo path is provided in the config
 var ErrNoRepoPath = errors.New("must provide a repo path to initialize an ipfs filesystem")
 
+// ErrNoWriteURL is returned when read endpoints are configured without a URL
+// to send writes to
+var ErrNoWriteURL = errors.New("read endpoints require a URL for writes")
+
 // StoreCfg configures the datastore
 type StoreCfg struct {
 	// embed options for creating a node
@@ -22,18 +27,79 @@ type StoreCfg struct {
 	// config an ipfs filesystem. The filesystem will instead be a `ipfs_http`
 	// filesystem.
 	URL string
+	// Auth is sent as the Authorization header of requests to URL
+	Auth string
+	// ReadURLs are ipfs http api addresses of replicas or gateways that
+	// serve reads for an `ipfs_http` filesystem, tried in order. Writes, pins
+	// and other admin operations always go to URL, and reads fall back to URL
+	// when no read endpoint answers
+	ReadURLs []string
+	// ReadAuth is sent as the Authorization header of requests to ReadURLs,
+	// so replicas never see the write credentials
+	ReadAuth string
 
 	// weather or not to serve the local IPFS HTTP API. does not apply when
 	// operating over HTTP via a URL
 	EnableAPI bool
+	// DisableHTTPCompression turns off gzip transfer encoding, both for
+	// requests to an HTTP API at URL and responses from the served API
+	DisableHTTPCompression bool
+	// UncompressibleMediaTypes are transferred without compression. defaults
+	// to qfs.DefaultUncompressibleMediaTypes
+	UncompressibleMediaTypes []string
 	// enable experimental IPFS pubsub service. does not apply when
 	// operating over HTTP via a URL
 	EnablePubSub bool
 	// DisableBootstrap will remove the bootstrap addrs from the node
 	DisableBootstrap bool
+	// BootstrapAddrs replaces the repo's bootstrap peers with a list of
+	// multiaddrs ending in /p2p/<peer id>, like the nodes of collaborators.
+	// The repo's config file isn't changed. Ignored when DisableBootstrap
+	// is set
+	BootstrapAddrs []string
 	// AdditionalSwarmListeningAddrs allows you to add a list of
 	// addresses you want the underlying libp2p swarm to listen on
 	AdditionalSwarmListeningAddrs []string
+	// Lite skips constructing a full IPFS node, using only a blockstore,
+	// pinner, and bitswap over a DHT client (when online). Lite filesystems
+	// start faster but don't support the HTTP API, pubsub, or MFS
+	Lite bool
+	// LoadRepoPlugins loads dynamic IPFS plugins from the repo's plugins
+	// directory. Only plugins compiled into go-ipfs are loaded by default
+	LoadRepoPlugins bool
+	// Plugins whitelists dynamic IPFS plugins from the repo's plugin
+	// directory by name
+	Plugins []string
+	// Lazy defers constructing the IPFS node until the first operation that
+	// needs it, or an explicit call to Warmup. The repo is still opened (and
+	// locked) at construction time
+	Lazy bool
+	// RemotePins lists remote pinning services that mirror the filesystem's
+	// pins. Put & Pin ask every service to pin, and Unpin removes the pin
+	// from every service
+	RemotePins []RemotePinCfg
+	// PutOptions sets how Put chunks & hashes files. The zero value matches
+	// go-ipfs defaults
+	PutOptions PutOptions
+	// VerifyContent fetches files block by block on Get, hashing each block
+	// & returning an error matching qfs.ErrIntegrity if a block doesn't match
+	// its CID. Useful when reads go through untrusted HTTP APIs or gateways
+	VerifyContent bool
+	// Offline restricts Get to blocks that are already stored locally, so
+	// missing content fails fast with qfs.ErrNotFound instead of being
+	// fetched from the network. Toggle at runtime with Filestore.SetOffline
+	Offline bool
+	// AutoMigrate migrates a repo at Path that's older than the embedded
+	// go-ipfs node expects, instead of failing with ErrNeedMigration.
+	// Migrations run fs-repo-migrations binaries from PATH, downloading any
+	// that are missing
+	AutoMigrate bool
+	// MigrationDryRun plans automatic migrations without running them, so
+	// opening a repo that needs migrating still fails with ErrNeedMigration
+	MigrationDryRun bool
+	// MigrationProgress is called as each automatic migration step starts &
+	// finishes
+	MigrationProgress func(MigrationProgress)
 }
 
 func mapToConfig(cfgmap map[string]interface{}) (*StoreCfg, error) {
@@ -69,5 +135,26 @@ func (cfg *StoreCfg) Validate() error {
 	if cfg.Path == "" && cfg.URL == "" {
 		return ErrNoRepoPath
 	}
+	if len(cfg.ReadURLs) > 0 && cfg.URL == "" {
+		return ErrNoWriteURL
+	}
+	for _, addr := range cfg.BootstrapAddrs {
+		if _, err := addrInfo(addr); err != nil {
+			return fmt.Errorf("invalid bootstrap address %q: %w", addr, err)
+		}
+	}
+	for _, rp := range cfg.RemotePins {
+		if rp.Endpoint == "" {
+			return fmt.Errorf("remote pinning service %q requires an endpoint", rp.Name)
+		}
+	}
 	return nil
 }
+
+// PluginOptions returns the plugin loading options for this configuration
+func (cfg *StoreCfg) PluginOptions() PluginOptions {
+	return PluginOptions{
+		LoadRepoPlugins: cfg.LoadRepoPlugins,
+		Plugins:         cfg.Plugins,
+	}
+}
@@ -29,3 +29,24 @@ func TestMapToConfig(t *testing.T) {
 		t.Errorf("expected cfg.URL to be %s, got %s", m["apiAddr"], cfg.URL)
 	}
 }
+
+func TestMapToConfigBootstrapAddrs(t *testing.T) {
+	addr := "/ip4/10.0.0.1/tcp/4001/p2p/QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN"
+	cfg, err := mapToConfig(map[string]interface{}{
+		"path":           "/path/to/repo",
+		"bootstrapAddrs": []string{addr},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.BootstrapAddrs) != 1 || cfg.BootstrapAddrs[0] != addr {
+		t.Errorf("expected bootstrap addrs [%s], got %v", addr, cfg.BootstrapAddrs)
+	}
+
+	if _, err := mapToConfig(map[string]interface{}{
+		"path":           "/path/to/repo",
+		"bootstrapAddrs": []string{"/ip4/10.0.0.1/tcp/4001"},
+	}); err == nil {
+		t.Error("expected a bootstrap address without a peer id to fail validation")
+	}
+}
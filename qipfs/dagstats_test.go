@@ -0,0 +1,49 @@
+package qipfs
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/qri-io/qfs"
+)
+
+func TestDAGStats(t *testing.T) {
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fs, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst := fs.(*Filestore)
+
+	data := make([]byte, 600<<10)
+	rand.New(rand.NewSource(1)).Read(data)
+	key, err := fst.Put(ctx, qfs.NewMemfileBytes("body.csv", data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := cid.Parse(strings.TrimPrefix(key, "/ipfs/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, size, depth, err := qfs.DAGStats(ctx, fst, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nd, err := fst.GetNode(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a 3 chunk file is a root linking to 3 leaves, none of them shared
+	if blocks != 4 || depth != 1 || size != nd.Size() {
+		t.Errorf("expected 4 blocks, depth 1 & %d bytes. got: %d blocks, depth %d, %d bytes", nd.Size(), blocks, depth, size)
+	}
+}
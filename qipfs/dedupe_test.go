@@ -0,0 +1,53 @@
+package qipfs
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/qri-io/qfs"
+)
+
+func TestDedupeStats(t *testing.T) {
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fs, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst := fs.(*Filestore)
+
+	// two versions of a 3 chunk file that differ in the last chunk
+	data := make([]byte, 600<<10)
+	rand.New(rand.NewSource(1)).Read(data)
+	var roots []cid.Cid
+	for _, b := range []byte{1, 2} {
+		data[len(data)-1] = b
+		key, err := fst.Put(ctx, qfs.NewMemfileBytes("body.csv", data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := cid.Parse(strings.TrimPrefix(key, "/ipfs/"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		roots = append(roots, id)
+	}
+
+	report, err := qfs.DedupeStats(ctx, fst, roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Roots[0].Blocks != 4 || report.Roots[1].NewBlocks != 2 {
+		t.Errorf("expected the second version to add a root & a chunk. got: %+v", report.Roots)
+	}
+	if report.SharedBlocks != 2 || report.SharedBytes < 2*(256<<10) {
+		t.Errorf("expected the first two chunks to be shared. got: %d blocks, %d bytes", report.SharedBlocks, report.SharedBytes)
+	}
+}
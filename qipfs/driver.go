@@ -0,0 +1,469 @@
+package qipfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	core "github.com/ipfs/go-ipfs/core"
+	format "github.com/ipfs/go-ipld-format"
+	unixfile "github.com/ipfs/go-unixfs/file"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	caopts "github.com/ipfs/interface-go-ipfs-core/options"
+	corepath "github.com/ipfs/interface-go-ipfs-core/path"
+	ma "github.com/multiformats/go-multiaddr"
+	httpapi "github.com/qri-io/go-ipfs-http-client"
+	"github.com/qri-io/qfs"
+)
+
+// driver is the narrow set of IPFS operations qipfs depends on. Keeping
+// go-ipfs types behind this interface confines the fallout of go-ipfs version
+// bumps to driver implementations. Both the in-process node and the HTTP API
+// client are drivers, and alternative IPFS implementations only need to
+// satisfy this interface to back a Filestore
+type driver interface {
+	// unixfs
+	Add(ctx context.Context, f files.Node, opts addOptions) (cid.Cid, error)
+	Get(ctx context.Context, path string) (files.Node, error)
+	// Ls lists the directory at path, reading only the directory & the root
+	// block of each child
+	Ls(ctx context.Context, path string) ([]qfs.DirEntry, error)
+
+	// dag
+	DagGet(ctx context.Context, id cid.Cid) (format.Node, error)
+	DagPut(ctx context.Context, nd format.Node) error
+	// DagResolve resolves an IPLD path like /ipfs/<cid>/a/b to the node it
+	// names
+	DagResolve(ctx context.Context, path string) (format.Node, error)
+	// Refs lists the CIDs of every block of the DAG rooted at root, root
+	// first. Callers list DAGs the node holds, like content just added or
+	// pinned
+	Refs(ctx context.Context, root cid.Cid) ([]cid.Cid, error)
+
+	// blocks
+	BlockGet(ctx context.Context, id cid.Cid) (io.Reader, error)
+	BlockPut(ctx context.Context, data []byte, format string) (cid.Cid, error)
+	// BlockHas checks for a block without fetching it from the network
+	BlockHas(ctx context.Context, id cid.Cid) (bool, error)
+
+	// pins
+	Pin(ctx context.Context, path string, recursive bool) error
+	Unpin(ctx context.Context, path string, recursive bool) error
+	Pins(ctx context.Context, pinType string) (<-chan pinInfo, error)
+	// IsPinned reports whether path has a recursive or direct pin. Content
+	// only pinned as part of another pin isn't pinned in its own right
+	IsPinned(ctx context.Context, path string) (bool, error)
+
+	// swarm
+	Peers(ctx context.Context) ([]qfs.PeerInfo, error)
+	Connect(ctx context.Context, addr string) error
+	Disconnect(ctx context.Context, addr string) error
+
+	// pubsub
+	Publish(ctx context.Context, topic string, data []byte) error
+	Subscribe(ctx context.Context, topic string) (<-chan pubsubMessage, error)
+
+	// ipns
+	NamePublish(ctx context.Context, path, key string) (name string, err error)
+	NameResolve(ctx context.Context, name string) (cid.Cid, error)
+}
+
+// addOptions configures driver.Add
+type addOptions struct {
+	CidVersion int
+	Chunker    string
+	RawLeaves  bool
+	MhType     uint64
+	Pin        bool
+	Resumable  bool
+}
+
+// pinInfo describes a single pin
+type pinInfo struct {
+	Cid  cid.Cid
+	Type string
+	Err  error
+}
+
+// pubsubMessage is a message received on a pubsub topic
+type pubsubMessage struct {
+	From string
+	Data []byte
+}
+
+// capiDriver implements driver with a CoreAPI, which both the in-process node
+// and the HTTP client provide
+type capiDriver struct {
+	capi coreiface.CoreAPI
+}
+
+var _ driver = (*capiDriver)(nil)
+
+func (d *capiDriver) Add(ctx context.Context, f files.Node, opts addOptions) (cid.Cid, error) {
+	aopts := []caopts.UnixfsAddOption{
+		caopts.Unixfs.CidVersion(opts.CidVersion),
+		caopts.Unixfs.RawLeaves(opts.RawLeaves),
+		caopts.Unixfs.Pin(opts.Pin),
+	}
+	if opts.MhType != 0 {
+		aopts = append(aopts, caopts.Unixfs.Hash(opts.MhType))
+	}
+	if opts.Chunker != "" {
+		aopts = append(aopts, caopts.Unixfs.Chunker(opts.Chunker))
+	}
+	p, err := d.capi.Unixfs().Add(ctx, f, aopts...)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+	return p.Cid(), nil
+}
+
+// Get streams files through the unixfs API, which doesn't expose the root
+// node, so the modification time is only resolved if it's read
+func (d *capiDriver) Get(ctx context.Context, path string) (files.Node, error) {
+	f, err := d.capi.Unixfs().Get(ctx, corepath.New(path))
+	if err != nil {
+		return nil, err
+	}
+	return withResolvedModTime(ctx, d, f, path), nil
+}
+
+func (d *capiDriver) Ls(ctx context.Context, path string) ([]qfs.DirEntry, error) {
+	nd, err := d.capi.ResolveNode(ctx, corepath.New(path))
+	if err != nil {
+		return nil, err
+	}
+	// listing a file would list its chunks
+	if !isUnixfsDir(nd) {
+		return nil, qfs.ErrNotDirectory
+	}
+	res, err := d.capi.Unixfs().Ls(ctx, corepath.IpfsPath(nd.Cid()), caopts.Unixfs.ResolveChildren(true))
+	if err != nil {
+		return nil, err
+	}
+	entries := []qfs.DirEntry{}
+	for e := range res {
+		if e.Err != nil {
+			return nil, e.Err
+		}
+		de := qfs.DirEntry{Name: e.Name, Cid: e.Cid, Size: int64(e.Size), IsDir: e.Type == coreiface.TDirectory}
+		if de.IsDir {
+			de.Size = -1
+		}
+		entries = append(entries, de)
+	}
+	return entries, nil
+}
+
+func (d *capiDriver) DagGet(ctx context.Context, id cid.Cid) (format.Node, error) {
+	return d.capi.Dag().Get(ctx, id)
+}
+
+func (d *capiDriver) DagPut(ctx context.Context, nd format.Node) error {
+	return d.capi.Dag().Add(ctx, nd)
+}
+
+func (d *capiDriver) DagResolve(ctx context.Context, path string) (format.Node, error) {
+	return d.capi.ResolveNode(ctx, corepath.New(path))
+}
+
+func (d *capiDriver) Refs(ctx context.Context, root cid.Cid) ([]cid.Cid, error) {
+	return walkRefs(ctx, d.capi.Dag(), root)
+}
+
+// walkRefs lists the CIDs of the DAG rooted at root a level at a time,
+// visiting each block once
+func walkRefs(ctx context.Context, ng format.NodeGetter, root cid.Cid) ([]cid.Cid, error) {
+	ids := []cid.Cid{root}
+	seen := map[cid.Cid]struct{}{root: {}}
+	level := []cid.Cid{root}
+	for len(level) > 0 {
+		var next []cid.Cid
+		for opt := range ng.GetMany(ctx, level) {
+			if opt.Err != nil {
+				return nil, opt.Err
+			}
+			for _, l := range opt.Node.Links() {
+				if _, ok := seen[l.Cid]; !ok {
+					seen[l.Cid] = struct{}{}
+					next = append(next, l.Cid)
+				}
+			}
+		}
+		ids = append(ids, next...)
+		level = next
+	}
+	return ids, nil
+}
+
+func (d *capiDriver) BlockGet(ctx context.Context, id cid.Cid) (io.Reader, error) {
+	return d.capi.Block().Get(ctx, corepath.IpfsPath(id))
+}
+
+func (d *capiDriver) BlockPut(ctx context.Context, data []byte, format string) (cid.Cid, error) {
+	bs, err := d.capi.Block().Put(ctx, bytes.NewBuffer(data), caopts.Block.Format(format))
+	if err != nil {
+		return cid.Cid{}, err
+	}
+	return bs.Path().Root(), nil
+}
+
+// BlockHas stats the block with an offline API, so checking for a block
+// never fetches it. Failures other than a missing block are returned, so an
+// unreachable API isn't mistaken for a miss
+func (d *capiDriver) BlockHas(ctx context.Context, id cid.Cid) (bool, error) {
+	offline, err := d.capi.WithOptions(caopts.Api.Offline(true))
+	if err != nil {
+		return false, err
+	}
+	if _, err := offline.Block().Stat(ctx, corepath.IpfsPath(id)); err != nil {
+		if err = typedError(err); errors.Is(err, qfs.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (d *capiDriver) Pin(ctx context.Context, path string, recursive bool) error {
+	return d.capi.Pin().Add(ctx, corepath.New(path), caopts.Pin.Recursive(recursive))
+}
+
+func (d *capiDriver) Unpin(ctx context.Context, path string, recursive bool) error {
+	return d.capi.Pin().Rm(ctx, corepath.New(path), caopts.Pin.RmRecursive(recursive))
+}
+
+func (d *capiDriver) IsPinned(ctx context.Context, path string) (bool, error) {
+	reason, pinned, err := d.capi.Pin().IsPinned(ctx, corepath.New(path))
+	if err != nil {
+		return false, err
+	}
+	return pinned && explicitPin(reason), nil
+}
+
+// explicitPin reports whether a pin reason names a recursive or direct pin.
+// Indirect pins give the CID of the pin they're held by as their reason
+func explicitPin(reason string) bool {
+	return reason == "recursive" || reason == "direct"
+}
+
+func (d *capiDriver) Pins(ctx context.Context, pinType string) (<-chan pinInfo, error) {
+	opt, err := caopts.Pin.Ls.Type(pinType)
+	if err != nil {
+		return nil, err
+	}
+	res, err := d.capi.Pin().Ls(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan pinInfo)
+	go func() {
+		defer close(ch)
+		for p := range res {
+			pi := pinInfo{Type: p.Type(), Err: p.Err()}
+			if pi.Err == nil {
+				pi.Cid = p.Path().Cid()
+			}
+			select {
+			case ch <- pi:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func (d *capiDriver) Peers(ctx context.Context) ([]qfs.PeerInfo, error) {
+	conns, err := d.capi.Swarm().Peers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	peers := make([]qfs.PeerInfo, 0, len(conns))
+	for _, c := range conns {
+		peers = append(peers, qfs.PeerInfo{
+			ID:   c.ID().Pretty(),
+			Addr: c.Address().String(),
+		})
+	}
+	return peers, nil
+}
+
+func (d *capiDriver) Connect(ctx context.Context, addr string) error {
+	pi, err := addrInfo(addr)
+	if err != nil {
+		return err
+	}
+	return d.capi.Swarm().Connect(ctx, *pi)
+}
+
+func (d *capiDriver) Disconnect(ctx context.Context, addr string) error {
+	maddr, err := ma.NewMultiaddr(addr)
+	if err != nil {
+		return fmt.Errorf("parsing multiaddr: %w", err)
+	}
+	return d.capi.Swarm().Disconnect(ctx, maddr)
+}
+
+func (d *capiDriver) Publish(ctx context.Context, topic string, data []byte) error {
+	return d.capi.PubSub().Publish(ctx, topic, data)
+}
+
+func (d *capiDriver) Subscribe(ctx context.Context, topic string) (<-chan pubsubMessage, error) {
+	sub, err := d.capi.PubSub().Subscribe(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan pubsubMessage)
+	go func() {
+		defer close(ch)
+		defer sub.Close()
+		for {
+			msg, err := sub.Next(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Debugw("reading pubsub subscription", "topic", topic, "err", err)
+				}
+				return
+			}
+			select {
+			case ch <- pubsubMessage{From: msg.From().Pretty(), Data: msg.Data()}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func (d *capiDriver) NamePublish(ctx context.Context, path, key string) (string, error) {
+	// offline nodes keep the record locally, announcing it once online
+	entry, err := d.capi.Name().Publish(ctx, corepath.New(path), caopts.Name.Key(key), caopts.Name.AllowOffline(true))
+	if err != nil {
+		return "", err
+	}
+	return "/ipns/" + entry.Name(), nil
+}
+
+func (d *capiDriver) NameResolve(ctx context.Context, name string) (cid.Cid, error) {
+	p, err := d.capi.Name().Resolve(ctx, name)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+	resolved, err := d.capi.ResolvePath(ctx, p)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+	return resolved.Cid(), nil
+}
+
+// nodeDriver drives an in-process IPFS node
+type nodeDriver struct {
+	capiDriver
+	node *core.IpfsNode
+}
+
+func newNodeDriver(node *core.IpfsNode, capi coreiface.CoreAPI) *nodeDriver {
+	return &nodeDriver{
+		capiDriver: capiDriver{capi: capi},
+		node:       node,
+	}
+}
+
+// Get reads files from the root node it resolves, the way the node's unixfs
+// API does, keeping the node for the file's modification time
+func (d *nodeDriver) Get(ctx context.Context, path string) (files.Node, error) {
+	nd, err := d.capi.ResolveNode(ctx, corepath.New(path))
+	if err != nil {
+		return nil, err
+	}
+	f, err := unixfile.NewUnixfsFile(ctx, d.capi.Dag(), nd)
+	if err != nil {
+		return nil, err
+	}
+	return withNodeModTime(f, nd), nil
+}
+
+// BlockHas reads directly from the node's blockstore
+func (d *nodeDriver) BlockHas(ctx context.Context, id cid.Cid) (bool, error) {
+	return d.node.Blockstore.Has(id)
+}
+
+// httpDriver drives a remote IPFS node over the HTTP API
+type httpDriver struct {
+	capiDriver
+}
+
+func newHTTPDriver(capi coreiface.CoreAPI) *httpDriver {
+	return &httpDriver{capiDriver: capiDriver{capi: capi}}
+}
+
+// IsPinned lists pins of path with the remote daemon's pin/ls endpoint. The
+// HTTP client's pin API doesn't support checking a single path
+func (d *httpDriver) IsPinned(ctx context.Context, path string) (bool, error) {
+	api, ok := d.capi.(*httpapi.HttpApi)
+	if !ok {
+		return false, fmt.Errorf("http driver has unexpected api client %T", d.capi)
+	}
+	out := struct {
+		Keys map[string]struct{ Type string }
+	}{}
+	if err := api.Request("pin/ls", path).Option("type", "all").Exec(ctx, &out); err != nil {
+		if errors.Is(typedError(err), qfs.ErrNotPinned) {
+			return false, nil
+		}
+		return false, err
+	}
+	for _, k := range out.Keys {
+		if explicitPin(k.Type) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Refs lists the DAG with the remote daemon's refs endpoint in a single
+// request, instead of a request per block
+func (d *httpDriver) Refs(ctx context.Context, root cid.Cid) ([]cid.Cid, error) {
+	api, ok := d.capi.(*httpapi.HttpApi)
+	if !ok {
+		return nil, fmt.Errorf("http driver has unexpected api client %T", d.capi)
+	}
+	res, err := api.Request("refs", pathFromHash(root.String())).
+		Option("recursive", true).
+		Option("unique", true).
+		Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	ids := []cid.Cid{root}
+	dec := json.NewDecoder(res.Output)
+	for {
+		var out struct{ Ref, Err string }
+		if err := dec.Decode(&out); err == io.EOF {
+			return ids, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("decoding refs response: %w", err)
+		}
+		if out.Err != "" {
+			return nil, errors.New(out.Err)
+		}
+		id, err := cid.Parse(out.Ref)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+}
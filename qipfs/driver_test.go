@@ -0,0 +1,69 @@
+package qipfs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	files "github.com/ipfs/go-ipfs-files"
+)
+
+func TestNodeDriver(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	f, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	drv := f.(*Filestore).drv
+
+	id, err := drv.Add(ctx, files.NewBytesFile([]byte("driver data")), addOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	has, err := drv.BlockHas(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !has {
+		t.Errorf("expected driver to have added block")
+	}
+
+	nd, err := drv.Get(ctx, pathFromHash(id.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(nd.(files.File))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "driver data" {
+		t.Errorf("data mismatch. want: %q got: %q", "driver data", string(data))
+	}
+
+	if err := drv.Pin(ctx, pathFromHash(id.String()), true); err != nil {
+		t.Fatal(err)
+	}
+	pins, err := drv.Pins(ctx, "recursive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for p := range pins {
+		if p.Err != nil {
+			t.Fatal(p.Err)
+		}
+		if p.Cid.Equals(id) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected pinned cid to be listed in recursive pins")
+	}
+}
@@ -0,0 +1,82 @@
+package qipfs
+
+import (
+	"context"
+	"io"
+
+	bserv "github.com/ipfs/go-blockservice"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	files "github.com/ipfs/go-ipfs-files"
+	merkledag "github.com/ipfs/go-merkledag"
+	"github.com/qri-io/qfs"
+)
+
+// DryRun computes the result of putting file with opts without storing or
+// pinning anything. The DAG is built in memory, so file content is read but
+// no blocks reach the repo or the network. Unlike Put, file may be a
+// directory. The result's Size is the total size of the DAG's blocks, the
+// bytes a put would store
+func (fst *Filestore) DryRun(ctx context.Context, file qfs.File, opts PutOptions) (qfs.PutResult, error) {
+	aopts, err := opts.addOptions()
+	if err != nil {
+		return qfs.PutResult{}, err
+	}
+	prefix, err := aopts.prefix()
+	if err != nil {
+		return qfs.PutResult{}, err
+	}
+	f, err := filesNode(ctx, file)
+	if err != nil {
+		return qfs.PutResult{}, err
+	}
+
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	dag := merkledag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+	nd, err := addNode(ctx, dag, f, prefix, aopts)
+	if err != nil {
+		return qfs.PutResult{}, err
+	}
+	size, err := nd.Size()
+	if err != nil {
+		return qfs.PutResult{}, err
+	}
+	return qfs.PutResult{
+		Cid:  nd.Cid(),
+		Size: int64(size),
+		Path: pathFromHash(nd.Cid().String()),
+	}, nil
+}
+
+// PredictPath computes the path Put would return for file with the
+// configured put options, without storing anything
+func (fst *Filestore) PredictPath(ctx context.Context, file qfs.File) (string, error) {
+	res, err := fst.DryRun(ctx, file, fst.putOptions())
+	if err != nil {
+		return "", err
+	}
+	return res.Path, nil
+}
+
+// filesNode converts a qfs file or directory to the go-ipfs-files node
+// addNode imports
+func filesNode(ctx context.Context, file qfs.File) (files.Node, error) {
+	if !file.IsDirectory() {
+		return files.NewReaderFile(contextReader{ctx: ctx, r: file}), nil
+	}
+	entries := map[string]files.Node{}
+	for {
+		ch, err := file.NextFile()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if entries[ch.FileName()], err = filesNode(ctx, ch); err != nil {
+			return nil, err
+		}
+	}
+	return files.NewMapDirectory(entries), nil
+}
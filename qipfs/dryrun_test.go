@@ -0,0 +1,93 @@
+package qipfs
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/qri-io/qfs"
+)
+
+func TestDryRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	f, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst := f.(*Filestore)
+
+	opts := PutOptions{CidVersion: 1}
+	data := []byte("dry run content")
+	res, err := fst.DryRun(ctx, qfs.NewMemfileBytes("a.txt", data), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has, err := fst.Has(ctx, res.Path); err != nil || has {
+		t.Errorf("expected dry run not to store content. has: %t, err: %v", has, err)
+	}
+	if res.Size < int64(len(data)) {
+		t.Errorf("expected size of at least %d. got: %d", len(data), res.Size)
+	}
+
+	key, err := fst.PutWithOptions(ctx, qfs.NewMemfileBytes("a.txt", data), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != res.Path {
+		t.Errorf("expected dry run path %q to match put path %q", res.Path, key)
+	}
+
+	// directories are built the way MemFS builds unixfs directories
+	newDir := func() qfs.File {
+		return qfs.NewMemdir("/",
+			qfs.NewMemfileBytes("a.txt", data),
+			qfs.NewMemdir("sub", qfs.NewMemfileBytes("b.txt", []byte("b"))),
+		)
+	}
+	res, err = fst.DryRun(ctx, newDir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := qfs.NewMemFS()
+	mem.UnixFS, mem.CidVersion = true, 1
+	memPath, err := mem.Put(ctx, newDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimPrefix(memPath, "/mem/") != res.Cid.String() {
+		t.Errorf("expected dry run cid %s to match mem path %q", res.Cid, memPath)
+	}
+}
+
+func TestPredictPath(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	f, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst := f.(*Filestore)
+
+	data := []byte("predicted content")
+	predicted, err := fst.PredictPath(ctx, qfs.NewMemfileBytes("a.txt", data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := fst.Put(ctx, qfs.NewMemfileBytes("a.txt", data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != predicted {
+		t.Errorf("expected predicted path %q to match put path %q", predicted, key)
+	}
+}
@@ -0,0 +1,179 @@
+package qipfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	format "github.com/ipfs/go-ipld-format"
+	httpapi "github.com/qri-io/go-ipfs-http-client"
+	"github.com/qri-io/qfs"
+)
+
+// readEndpointCooldown is how long a read endpoint that couldn't be reached
+// is skipped before it's tried again
+const readEndpointCooldown = 30 * time.Second
+
+// authTransport sets the Authorization header on every request
+type authTransport struct {
+	base http.RoundTripper
+	auth string
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", t.auth)
+	return t.base.RoundTrip(req)
+}
+
+// newAPIClient builds the http client used to talk to an IPFS HTTP API. auth,
+// when set, is sent as the Authorization header of every request
+func newAPIClient(cfg *StoreCfg, auth string) *http.Client {
+	if cfg.DisableHTTPCompression && auth == "" {
+		return http.DefaultClient
+	}
+	var rt http.RoundTripper = http.DefaultTransport
+	if auth != "" {
+		rt = &authTransport{base: rt, auth: auth}
+	}
+	if !cfg.DisableHTTPCompression {
+		rt = &qfs.CompressingTransport{
+			Base:                     rt,
+			UncompressibleMediaTypes: cfg.UncompressibleMediaTypes,
+		}
+	}
+	return &http.Client{Transport: rt}
+}
+
+// readEndpoint is a replica or gateway that serves reads
+type readEndpoint struct {
+	url string
+	drv *httpDriver
+
+	lk        sync.Mutex
+	downUntil time.Time
+}
+
+func (ep *readEndpoint) available(now time.Time) bool {
+	ep.lk.Lock()
+	defer ep.lk.Unlock()
+	return !now.Before(ep.downUntil)
+}
+
+func (ep *readEndpoint) markDown(now time.Time) {
+	ep.lk.Lock()
+	defer ep.lk.Unlock()
+	ep.downUntil = now.Add(readEndpointCooldown)
+}
+
+// splitDriver sends reads to a list of read endpoints & everything else to
+// the authoritative write endpoint. Reads fail over to the next endpoint on
+// error, and to the write endpoint when every read endpoint fails, so a
+// replica that's behind or down only costs latency. Endpoints that can't be
+// reached are skipped for readEndpointCooldown
+type splitDriver struct {
+	*httpDriver
+	reads []*readEndpoint
+	now   func() time.Time
+}
+
+var _ driver = (*splitDriver)(nil)
+
+func newSplitDriver(cfg *StoreCfg, write *httpDriver) (*splitDriver, error) {
+	d := &splitDriver{httpDriver: write, now: time.Now}
+	for _, u := range cfg.ReadURLs {
+		cli, err := httpapi.NewURLApiWithClient(u, newAPIClient(cfg, cfg.ReadAuth))
+		if err != nil {
+			return nil, err
+		}
+		d.reads = append(d.reads, &readEndpoint{url: u, drv: newHTTPDriver(cli)})
+	}
+	return d, nil
+}
+
+// read calls fn against read endpoints in order until one succeeds, falling
+// back to the write endpoint
+func (d *splitDriver) read(ctx context.Context, fn func(drv driver) error) error {
+	now := d.now()
+	eps := make([]*readEndpoint, 0, len(d.reads))
+	for _, ep := range d.reads {
+		if ep.available(now) {
+			eps = append(eps, ep)
+		}
+	}
+
+	for _, ep := range eps {
+		err := fn(ep.drv)
+		if err == nil {
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		log.Debugw("read endpoint failed", "url", ep.url, "err", err)
+		if isUnreachable(err) {
+			ep.markDown(d.now())
+		}
+	}
+	return fn(d.httpDriver)
+}
+
+// isUnreachable reports whether err means the endpoint couldn't be reached,
+// as opposed to the endpoint answering with an error
+func isUnreachable(err error) bool {
+	var uerr *url.Error
+	return errors.As(err, &uerr)
+}
+
+func (d *splitDriver) Get(ctx context.Context, path string) (nd files.Node, err error) {
+	err = d.read(ctx, func(drv driver) (err error) {
+		nd, err = drv.Get(ctx, path)
+		return err
+	})
+	return nd, err
+}
+
+func (d *splitDriver) DagResolve(ctx context.Context, path string) (nd format.Node, err error) {
+	err = d.read(ctx, func(drv driver) (err error) {
+		nd, err = drv.DagResolve(ctx, path)
+		return err
+	})
+	return nd, err
+}
+
+func (d *splitDriver) DagGet(ctx context.Context, id cid.Cid) (nd format.Node, err error) {
+	err = d.read(ctx, func(drv driver) (err error) {
+		nd, err = drv.DagGet(ctx, id)
+		return err
+	})
+	return nd, err
+}
+
+func (d *splitDriver) BlockGet(ctx context.Context, id cid.Cid) (r io.Reader, err error) {
+	err = d.read(ctx, func(drv driver) (err error) {
+		r, err = drv.BlockGet(ctx, id)
+		return err
+	})
+	return r, err
+}
+
+// BlockHas treats a read endpoint that doesn't have a block as a miss, since
+// replicas may lag behind the write endpoint
+func (d *splitDriver) BlockHas(ctx context.Context, id cid.Cid) (has bool, err error) {
+	err = d.read(ctx, func(drv driver) (err error) {
+		if has, err = drv.BlockHas(ctx, id); err == nil && !has {
+			return format.ErrNotFound
+		}
+		return err
+	})
+	if err == format.ErrNotFound {
+		return false, nil
+	}
+	return has, err
+}
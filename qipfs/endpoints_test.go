@@ -0,0 +1,385 @@
+package qipfs
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/qri-io/qfs"
+)
+
+// fakeAPI serves block/get & block/put like an IPFS HTTP API, recording the
+// commands & Authorization headers it receives
+type fakeAPI struct {
+	blocks map[string]string
+	// refs lists the refs of a path
+	refs map[string][]string
+	// pins maps pinned paths to their pin type
+	pins map[string]string
+
+	lk      sync.Mutex
+	calls   []string
+	auth    []string
+	queries []url.Values
+}
+
+func (a *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.lk.Lock()
+	a.calls = append(a.calls, r.URL.Path)
+	a.queries = append(a.queries, r.URL.Query())
+	a.auth = append(a.auth, r.Header.Get("Authorization"))
+	a.lk.Unlock()
+
+	switch r.URL.Path {
+	case "/api/v0/block/get":
+		data, ok := a.blocks[r.URL.Query().Get("arg")]
+		if !ok {
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("block not found"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte(data))
+	case "/api/v0/block/put":
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"Key":%q,"Size":4}`, testBlockCid(replicatedData).String())
+	case "/api/v0/block/stat":
+		arg := r.URL.Query().Get("arg")
+		data, ok := a.blocks[arg]
+		if !ok {
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("blockservice: key not found"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"Key":%q,"Size":%d}`, strings.TrimPrefix(arg, "/ipfs/"), len(data))
+	case "/api/v0/add":
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"Name":"data","Hash":%q,"Size":"24"}`, testBlockCid(replicatedData).String())
+	case "/api/v0/refs":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Chunked-Output", "1")
+		for _, ref := range a.refs[r.URL.Query().Get("arg")] {
+			fmt.Fprintf(w, "{\"Ref\":%q,\"Err\":\"\"}\n", ref)
+		}
+	case "/api/v0/pin/ls":
+		arg := r.URL.Query().Get("arg")
+		typ, ok := a.pins[arg]
+		if !ok {
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "path '%s' is not pinned", arg)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"Keys":{%q:{"Type":%q}}}`, strings.TrimPrefix(arg, "/ipfs/"), typ)
+	case "/api/v0/pin/add":
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"Pins":[%q]}`, testBlockCid(replicatedData).String())
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (a *fakeAPI) commands() ([]string, []string) {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+	return append([]string(nil), a.calls...), append([]string(nil), a.auth...)
+}
+
+const replicatedData = "replicated block"
+
+func testBlockCid(data string) cid.Cid {
+	mh, _ := multihash.Sum([]byte(data), multihash.SHA2_256, -1)
+	return cid.NewCidV1(cid.Raw, mh)
+}
+
+func TestSplitEndpoints(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	replicated := testBlockCid(replicatedData)
+	writeOnly := testBlockCid("write only")
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	downURL := down.URL
+	down.Close()
+
+	replica := &fakeAPI{blocks: map[string]string{"/ipfs/" + replicated.String(): replicatedData}}
+	replicaSrv := httptest.NewServer(replica)
+	defer replicaSrv.Close()
+
+	writer := &fakeAPI{blocks: map[string]string{
+		"/ipfs/" + replicated.String(): replicatedData,
+		"/ipfs/" + writeOnly.String():  "write only",
+	}}
+	writerSrv := httptest.NewServer(writer)
+	defer writerSrv.Close()
+
+	fs, err := NewFilesystem(ctx, map[string]interface{}{
+		"url":      writerSrv.URL,
+		"auth":     "Bearer write",
+		"readURLs": []string{downURL, replicaSrv.URL},
+		"readAuth": "Bearer read",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	drv := fs.(*Filestore).drv
+	if _, ok := drv.(*splitDriver); !ok {
+		t.Fatalf("expected split driver, got %T", drv)
+	}
+
+	r, err := drv.BlockGet(ctx, replicated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadAll(r); string(data) != replicatedData {
+		t.Errorf("block data mismatch. want %q, got %q", replicatedData, string(data))
+	}
+	if calls, _ := writer.commands(); len(calls) != 0 {
+		t.Errorf("expected read served by replica, writer got %v", calls)
+	}
+	if drv.(*splitDriver).reads[0].available(time.Now()) {
+		t.Error("expected unreachable read endpoint to be marked down")
+	}
+
+	// blocks the replica doesn't have fall back to the writer
+	r, err = drv.BlockGet(ctx, writeOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadAll(r); string(data) != "write only" {
+		t.Errorf("block data mismatch. want %q, got %q", "write only", string(data))
+	}
+
+	if _, err := drv.BlockPut(ctx, []byte(replicatedData), "raw"); err != nil {
+		t.Fatal(err)
+	}
+
+	replicaCalls, replicaAuth := replica.commands()
+	for i, call := range replicaCalls {
+		if call != "/api/v0/block/get" {
+			t.Errorf("replica received non-read command %q", call)
+		}
+		if replicaAuth[i] != "Bearer read" {
+			t.Errorf("replica auth mismatch. want %q, got %q", "Bearer read", replicaAuth[i])
+		}
+	}
+	writerCalls, writerAuth := writer.commands()
+	expect := []string{"/api/v0/block/get", "/api/v0/block/put"}
+	if len(writerCalls) != len(expect) {
+		t.Fatalf("writer commands mismatch. want %v, got %v", expect, writerCalls)
+	}
+	for i, call := range writerCalls {
+		if call != expect[i] {
+			t.Errorf("writer command %d mismatch. want %q, got %q", i, expect[i], call)
+		}
+		if writerAuth[i] != "Bearer write" {
+			t.Errorf("writer auth mismatch. want %q, got %q", "Bearer write", writerAuth[i])
+		}
+	}
+}
+
+func TestReadURLsRequireURL(t *testing.T) {
+	_, err := mapToConfig(map[string]interface{}{
+		"path":     "/tmp/repo",
+		"readURLs": []string{"http://localhost:5001"},
+	})
+	if err != ErrNoWriteURL {
+		t.Errorf("expected ErrNoWriteURL, got %v", err)
+	}
+}
+
+func TestHTTPPut(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	api := &fakeAPI{}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	fs, err := NewFilesystem(ctx, map[string]interface{}{"url": srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := fs.Put(ctx, qfs.NewMemfileBytes("data", []byte(replicatedData)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := "/ipfs/" + testBlockCid(replicatedData).String(); path != expect {
+		t.Errorf("expected put to return %q, got %q", expect, path)
+	}
+	if err := fs.(qfs.PinningFS).Pin(ctx, path, true); err != nil {
+		t.Fatal(err)
+	}
+
+	calls, _ := api.commands()
+	expect := []string{"/api/v0/add", "/api/v0/pin/add"}
+	if len(calls) != len(expect) || calls[0] != expect[0] || calls[1] != expect[1] {
+		t.Fatalf("expected commands %v, got %v", expect, calls)
+	}
+	api.lk.Lock()
+	defer api.lk.Unlock()
+	if pin := api.queries[0].Get("pin"); pin != "true" {
+		t.Errorf("expected add to pin, got pin=%q", pin)
+	}
+}
+
+func TestHTTPHas(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stored := testBlockCid(replicatedData)
+	missing := testBlockCid("missing")
+	api := &fakeAPI{blocks: map[string]string{"/ipfs/" + stored.String(): replicatedData}}
+	srv := httptest.NewServer(api)
+
+	fs, err := NewFilesystem(ctx, map[string]interface{}{"url": srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, expect := range map[string]bool{
+		stored.String():             true,
+		"/ipfs/" + stored.String():  true,
+		"/ipfs/" + missing.String(): false,
+	} {
+		has, err := fs.Has(ctx, key)
+		if err != nil {
+			t.Fatalf("%s: %s", key, err)
+		}
+		if has != expect {
+			t.Errorf("%s: expected has %t, got %t", key, expect, has)
+		}
+	}
+
+	api.lk.Lock()
+	for i, q := range api.queries {
+		if api.calls[i] != "/api/v0/block/stat" || q.Get("offline") != "true" {
+			t.Errorf("expected an offline block/stat, got %s?%s", api.calls[i], q.Encode())
+		}
+	}
+	api.lk.Unlock()
+
+	srv.Close()
+	if _, err := fs.Has(ctx, stored.String()); err == nil {
+		t.Error("expected an unreachable API to error, not report a miss")
+	}
+}
+
+func TestLocalHas(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	replicated := testBlockCid(replicatedData)
+	replica := &fakeAPI{blocks: map[string]string{"/ipfs/" + replicated.String(): replicatedData}}
+	replicaSrv := httptest.NewServer(replica)
+	defer replicaSrv.Close()
+	writer := &fakeAPI{blocks: map[string]string{}}
+	writerSrv := httptest.NewServer(writer)
+	defer writerSrv.Close()
+
+	fs, err := NewFilesystem(ctx, map[string]interface{}{
+		"url":      writerSrv.URL,
+		"readURLs": []string{replicaSrv.URL},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has, err := fs.Has(ctx, replicated.String()); err != nil || !has {
+		t.Errorf("expected replica to answer has. got: %t, %v", has, err)
+	}
+
+	calls, _ := replica.commands()
+	local := qfs.WithLocalHas(ctx)
+	if has, err := fs.Has(local, replicated.String()); err != nil || has {
+		t.Errorf("expected local has to miss the replicated block. got: %t, %v", has, err)
+	}
+	res, err := fs.(qfs.HasManyFS).HasMany(local, []string{replicated.String()})
+	if err != nil || res[replicated.String()] {
+		t.Errorf("expected local has many to miss the replicated block. got: %v, %v", res, err)
+	}
+	if after, _ := replica.commands(); len(after) != len(calls) {
+		t.Errorf("expected local checks not to reach the replica. got: %v", after[len(calls):])
+	}
+
+	writer.lk.Lock()
+	defer writer.lk.Unlock()
+	for i, q := range writer.queries {
+		if writer.calls[i] != "/api/v0/block/stat" || q.Get("offline") != "true" {
+			t.Errorf("expected an offline block/stat, got %s?%s", writer.calls[i], q.Encode())
+		}
+	}
+}
+
+func TestHTTPRefs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	root := testBlockCid("root")
+	children := []string{testBlockCid("a").String(), testBlockCid("b").String()}
+	api := &fakeAPI{refs: map[string][]string{"/ipfs/" + root.String(): children}}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	fs, err := NewFilesystem(ctx, map[string]interface{}{"url": srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := fs.(*Filestore).drv.Refs(ctx, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 3 || !ids[0].Equals(root) || ids[1].String() != children[0] || ids[2].String() != children[1] {
+		t.Errorf("unexpected refs: %v", ids)
+	}
+	calls, _ := api.commands()
+	if len(calls) != 1 {
+		t.Errorf("expected refs to be listed in one request. got: %v", calls)
+	}
+	api.lk.Lock()
+	defer api.lk.Unlock()
+	if q := api.queries[0]; q.Get("recursive") != "true" || q.Get("unique") != "true" {
+		t.Errorf("expected a recursive, unique refs request. got: %s", q.Encode())
+	}
+}
+
+func TestHTTPIsPinned(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	recursive, indirect := testBlockCid("recursive"), testBlockCid("indirect")
+	api := &fakeAPI{pins: map[string]string{
+		"/ipfs/" + recursive.String(): "recursive",
+		"/ipfs/" + indirect.String():  "indirect through " + recursive.String(),
+	}}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	fs, err := NewFilesystem(ctx, map[string]interface{}{"url": srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc := fs.(qfs.PinCheckingFS)
+	expect := map[string]bool{
+		recursive.String():            true,
+		indirect.String():             false,
+		testBlockCid("none").String(): false,
+	}
+	for id, want := range expect {
+		if got, err := pc.IsPinned(ctx, "/ipfs/"+id); err != nil || got != want {
+			t.Errorf("IsPinned(%s): want %t, got %t, %v", id, want, got, err)
+		}
+	}
+}
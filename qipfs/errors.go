@@ -0,0 +1,46 @@
+package qipfs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/qri-io/qfs"
+)
+
+// typedError wraps errors from go-ipfs in qfs sentinel errors, so callers can
+// check them with errors.Is. Errors from the HTTP API only carry a message,
+// so messages are matched as well as error values. Timeouts, rate limiting &
+// an unreachable API are qfs.ErrTransient
+func typedError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	switch {
+	case errors.Is(err, qfs.ErrNotFound), errors.Is(err, qfs.ErrNotPinned):
+		return err
+	case strings.Contains(msg, "not pinned"):
+		return fmt.Errorf("%w: %s", qfs.ErrNotPinned, msg)
+	case errors.Is(err, format.ErrNotFound),
+		errors.Is(err, blockstore.ErrNotFound),
+		errors.Is(err, os.ErrNotExist),
+		strings.Contains(msg, "not found"),
+		strings.Contains(msg, "file does not exist"),
+		strings.Contains(msg, "no link named"),
+		strings.Contains(msg, "could not resolve name"):
+		return fmt.Errorf("%w: %s", qfs.ErrNotFound, msg)
+	case errors.Is(err, qfs.ErrTransient):
+		return err
+	case isUnreachable(err),
+		strings.Contains(msg, "Too Many Requests"),
+		strings.Contains(msg, "Service Unavailable"),
+		strings.Contains(msg, "timed out"),
+		strings.Contains(msg, "timeout"):
+		return fmt.Errorf("%w: %s", qfs.ErrTransient, msg)
+	}
+	return err
+}
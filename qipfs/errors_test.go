@@ -0,0 +1,65 @@
+package qipfs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/qri-io/qfs"
+)
+
+func TestTypedErrors(t *testing.T) {
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	for _, lite := range []bool{false, true} {
+		ctx, cancel := context.WithCancel(context.Background())
+		f, err := NewFilesystem(ctx, map[string]interface{}{"path": path, "lite": lite})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fst := f.(*Filestore)
+
+		// a valid CID for content the offline node doesn't have
+		missing := "/ipfs/bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku"
+		if _, err := fst.Get(ctx, missing); !errors.Is(err, qfs.ErrNotFound) {
+			t.Errorf("lite=%t: expected Get of missing content to be ErrNotFound, got: %v", lite, err)
+		}
+
+		key, err := fst.AddFile(qfs.NewMemfileBytes("a.txt", []byte("unpinned")), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fst.Unpin(ctx, key, true); !errors.Is(err, qfs.ErrNotPinned) {
+			t.Errorf("lite=%t: expected Unpin of unpinned content to be ErrNotPinned, got: %v", lite, err)
+		}
+		if err := fst.Delete(ctx, key); err != nil {
+			t.Errorf("lite=%t: expected Delete of unpinned content to succeed, got: %v", lite, err)
+		}
+
+		cancel()
+		<-fst.Done()
+	}
+
+	if !errors.Is(ErrLiteUnsupported, qfs.ErrUnsupported) {
+		t.Error("expected ErrLiteUnsupported to be ErrUnsupported")
+	}
+}
+
+func TestTypedErrorTransient(t *testing.T) {
+	cases := []struct {
+		err       error
+		transient bool
+	}{
+		{errors.New("429 Too Many Requests"), true},
+		{errors.New("503 Service Unavailable"), true},
+		{errors.New("bitswap: request timed out"), true},
+		{errors.New("invalid path"), false},
+	}
+	for _, c := range cases {
+		if got := errors.Is(typedError(c.err), qfs.ErrTransient); got != c.transient {
+			t.Errorf("%q: expected transient=%t. got: %t", c.err, c.transient, got)
+		}
+	}
+}
@@ -3,14 +3,20 @@ package qipfs
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/ipfs/go-cid"
+	ipfs "github.com/ipfs/go-ipfs"
 	ipfs_config "github.com/ipfs/go-ipfs-config"
 	files "github.com/ipfs/go-ipfs-files"
 	ipfs_commands "github.com/ipfs/go-ipfs/commands"
@@ -23,9 +29,6 @@ import (
 	logging "github.com/ipfs/go-log"
 	unixfs "github.com/ipfs/go-unixfs"
 	coreiface "github.com/ipfs/interface-go-ipfs-core"
-	caopts "github.com/ipfs/interface-go-ipfs-core/options"
-	"github.com/ipfs/interface-go-ipfs-core/path"
-	corepath "github.com/ipfs/interface-go-ipfs-core/path"
 	httpapi "github.com/qri-io/go-ipfs-http-client"
 	"github.com/qri-io/qfs"
 )
@@ -41,7 +44,20 @@ type Filestore struct {
 
 	node       *core.IpfsNode
 	capi       coreiface.CoreAPI
+	drv        driver
 	httpClient *http.Client
+	blockCache qfs.BlockCache
+	cidFilter  *qfs.CIDFilter
+	// cidFilterStale is 1 while the CID filter may be missing blocks the
+	// node fetched
+	cidFilterStale int32
+	// events delivers puts, deletes, pin changes & garbage collections made
+	// through the filestore
+	events *qfs.EventBus
+	// pending queues content put with PinLater
+	pending *pendingPins
+	// offline is 1 while Get is restricted to local blocks
+	offline *int32
 
 	doneCh  chan struct{}
 	doneErr error
@@ -51,6 +67,12 @@ var (
 	_ qfs.Filesystem     = (*Filestore)(nil)
 	_ qfs.MerkleDagStore = (*Filestore)(nil)
 	_ qfs.CAFS           = (*Filestore)(nil)
+	_ qfs.BlockCacheUser = (*Filestore)(nil)
+	_ qfs.DescribingFS   = (*Filestore)(nil)
+	_ qfs.NameSystem     = (*Filestore)(nil)
+	_ qfs.Watcher        = (*Filestore)(nil)
+	_ qfs.PinCheckingFS  = (*Filestore)(nil)
+	_ qfs.PathPredictor  = (*Filestore)(nil)
 )
 
 // NewFilesystem creates a new local filesystem PathResolver
@@ -65,7 +87,7 @@ func NewFilesystem(ctx context.Context, cfgMap map[string]interface{}) (qfs.File
 		return newHTTPAddrFilesystem(ctx, cfg)
 	}
 
-	if err := LoadIPFSPluginsOnce(cfg.Path); err != nil {
+	if err := LoadIPFSPlugins(cfg.Path, cfg.PluginOptions()); err != nil {
 		return nil, err
 	}
 
@@ -80,17 +102,56 @@ func NewFilesystem(ctx context.Context, cfgMap map[string]interface{}) (qfs.File
 		return nil, err
 	}
 
-	node, err := core.NewNode(ctx, &cfg.BuildCfg)
-	if err != nil {
-		return nil, fmt.Errorf("qipfs: error creating ipfs node: %w", err)
+	if err := configureBootstrap(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Lite {
+		return newLiteFilesystem(ctx, cfg)
 	}
 
+	fst := &Filestore{
+		ctx:     ctx,
+		cfg:     cfg,
+		doneCh:  make(chan struct{}),
+		events:  &qfs.EventBus{},
+		pending: &pendingPins{},
+		offline: offlineFlag(cfg),
+	}
+
+	if cfg.Lazy {
+		fst.drv = newLazyDriver(fst.startNode)
+	} else if fst.drv, err = fst.startNode(); err != nil {
+		return nil, err
+	}
+
+	go fst.handleContextClose()
+	return fst, nil
+}
+
+// configureBootstrap sets the bootstrap peers of the opened repo's config in
+// memory, before a node is built from it
+func configureBootstrap(cfg *StoreCfg) error {
+	if !cfg.DisableBootstrap && len(cfg.BootstrapAddrs) == 0 {
+		return nil
+	}
+	repoCfg, err := cfg.Repo.Config()
+	if err != nil {
+		return err
+	}
 	if cfg.DisableBootstrap {
-		repoCfg, err := node.Repo.Config()
-		if err != nil {
-			return nil, err
-		}
 		repoCfg.Bootstrap = []string{}
+	} else {
+		repoCfg.Bootstrap = append([]string{}, cfg.BootstrapAddrs...)
+	}
+	return nil
+}
+
+// startNode constructs the in-process IPFS node
+func (fst *Filestore) startNode() (driver, error) {
+	cfg := fst.cfg
+	node, err := core.NewNode(fst.ctx, &cfg.BuildCfg)
+	if err != nil {
+		return nil, fmt.Errorf("qipfs: error creating ipfs node: %w", err)
 	}
 
 	if len(cfg.AdditionalSwarmListeningAddrs) != 0 {
@@ -106,32 +167,62 @@ func NewFilesystem(ctx context.Context, cfgMap map[string]interface{}) (qfs.File
 		return nil, err
 	}
 
-	fst := &Filestore{
-		ctx:    ctx,
-		cfg:    cfg,
-		node:   node,
-		capi:   capi,
-		doneCh: make(chan struct{}),
-	}
-
-	go fst.handleContextClose()
-	return fst, nil
+	fst.node = node
+	fst.capi = capi
+	return newNodeDriver(node, capi), nil
 }
 
 func newHTTPAddrFilesystem(ctx context.Context, cfg *StoreCfg) (qfs.Filesystem, error) {
-	client := http.DefaultClient
+	client := newAPIClient(cfg, cfg.Auth)
 	cli, err := httpapi.NewURLApiWithClient(cfg.URL, client)
 	if err != nil {
 		return nil, err
 	}
 
+	write := newHTTPDriver(cli)
+	var drv driver = write
+	if len(cfg.ReadURLs) > 0 {
+		split, err := newSplitDriver(cfg, write)
+		if err != nil {
+			return nil, err
+		}
+		drv = split
+	}
+
 	fst := &Filestore{
 		ctx:        ctx,
 		cfg:        cfg,
 		httpClient: client,
 
-		capi:   cli,
-		doneCh: make(chan struct{}),
+		capi:    cli,
+		drv:     drv,
+		doneCh:  make(chan struct{}),
+		events:  &qfs.EventBus{},
+		pending: &pendingPins{},
+		offline: offlineFlag(cfg),
+	}
+
+	go fst.handleContextClose()
+	return fst, nil
+}
+
+func newLiteFilesystem(ctx context.Context, cfg *StoreCfg) (qfs.Filesystem, error) {
+	if cfg.Repo == nil {
+		return nil, fmt.Errorf("lite ipfs filesystem requires a repo")
+	}
+	drv, err := newLiteDriver(ctx, cfg.Repo, cfg.Online)
+	if err != nil {
+		return nil, err
+	}
+
+	fst := &Filestore{
+		ctx:     ctx,
+		cfg:     cfg,
+		drv:     drv,
+		doneCh:  make(chan struct{}),
+		events:  &qfs.EventBus{},
+		pending: &pendingPins{},
+		offline: offlineFlag(cfg),
 	}
 
 	go fst.handleContextClose()
@@ -146,10 +237,14 @@ func NewFilesystemFromNode(ctx context.Context, node *core.IpfsNode) (qfs.Merkle
 	}
 
 	fst := &Filestore{
-		ctx:    ctx,
-		node:   node,
-		capi:   capi,
-		doneCh: make(chan struct{}),
+		ctx:     ctx,
+		node:    node,
+		capi:    capi,
+		drv:     newNodeDriver(node, capi),
+		doneCh:  make(chan struct{}),
+		events:  &qfs.EventBus{},
+		pending: &pendingPins{},
+		offline: offlineFlag(nil),
 	}
 
 	go fst.handleContextClose()
@@ -161,14 +256,23 @@ func (fst Filestore) Type() string { return FilestoreType }
 
 func (fst Filestore) IsContentAddressedFilesystem() {}
 
+// GetNode fetches the node for id. Path values name links to follow from
+// id, so GetNode(id, "a", "b") returns the node at /ipfs/<id>/a/b
 func (fs *Filestore) GetNode(id cid.Cid, path ...string) (qfs.DagNode, error) {
+	var (
+		node format.Node
+		err  error
+	)
 	if len(path) > 0 {
-		return nil, fmt.Errorf("unsupported: path values on ipfs.Filestore.GetNode")
+		node, err = fs.drv.DagResolve(fs.ctx, pathFromHash(id.String())+"/"+strings.Join(path, "/"))
+	} else {
+		node, err = fs.drv.DagGet(fs.ctx, id)
 	}
-	node, err := fs.capi.Dag().Get(fs.ctx, id)
 	if err != nil {
 		return nil, err
 	}
+	id = node.Cid()
+	fs.filterAdd(id)
 
 	size, err := node.Size()
 	if err != nil {
@@ -188,10 +292,11 @@ func (fs *Filestore) PutNode(links qfs.Links) (qfs.PutResult, error) {
 	for name, lnk := range links.Map() {
 		node.AddRawLink(name, lnk.IPLD())
 	}
-	err := fs.capi.Dag().Add(fs.ctx, node)
+	err := fs.drv.DagPut(fs.ctx, node)
 	if err != nil {
 		return qfs.PutResult{}, err
 	}
+	fs.filterAdd(node.Cid())
 	size, err := node.Size()
 	if err != nil {
 		return qfs.PutResult{}, err
@@ -203,25 +308,60 @@ func (fs *Filestore) PutNode(links qfs.Links) (qfs.PutResult, error) {
 	}, err
 }
 
+// SetBlockCache sets a block cache GetBlock consults before the node's
+// blockstore, and fills with blocks the node returns
+func (fs *Filestore) SetBlockCache(c qfs.BlockCache) {
+	fs.blockCache = c
+}
+
 func (fs *Filestore) GetBlock(id cid.Cid) (io.Reader, error) {
-	return fs.capi.Block().Get(fs.ctx, corepath.IpfsPath(id))
+	if fs.blockCache == nil {
+		r, err := fs.drv.BlockGet(fs.ctx, id)
+		if err != nil {
+			return nil, typedError(err)
+		}
+		fs.filterAdd(id)
+		return r, nil
+	}
+
+	if data, err := fs.blockCache.GetBlock(id); err == nil {
+		return bytes.NewReader(data), nil
+	}
+	r, err := fs.drv.BlockGet(fs.ctx, id)
+	if err != nil {
+		return nil, typedError(err)
+	}
+	fs.filterAdd(id)
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := fs.blockCache.PutBlock(id, data); err != nil {
+		log.Debugw("caching block", "cid", id.String(), "err", err)
+	}
+	return bytes.NewReader(data), nil
 }
 
 func (fs *Filestore) PutBlock(d []byte) (id cid.Cid, err error) {
-	bs, err := fs.capi.Block().Put(fs.ctx, bytes.NewBuffer(d), caopts.Block.Format("raw"))
-	if err != nil {
-		return cid.Cid{}, err
+	id, err = fs.drv.BlockPut(fs.ctx, d, "raw")
+	if err == nil {
+		fs.filterAdd(id)
 	}
-	return bs.Path().Root(), nil
+	return id, err
 }
 
 func (fs *Filestore) PutFile(f fs.File) (qfs.PutResult, error) {
-	path, err := fs.capi.Unixfs().Add(fs.ctx, files.NewReaderFile(f), caopts.Unixfs.CidVersion(0))
+	opts, err := fs.putOptions().addOptions()
 	if err != nil {
 		return qfs.PutResult{}, err
 	}
+	id, err := fs.drv.Add(fs.ctx, files.NewReaderFile(f), opts)
+	if err != nil {
+		return qfs.PutResult{}, err
+	}
+	fs.filterAddDAG(fs.ctx, id)
 
-	storedFile, err := fs.capi.Unixfs().Get(fs.ctx, path)
+	storedFile, err := fs.drv.Get(fs.ctx, pathFromHash(id.String()))
 	if err != nil {
 		return qfs.PutResult{}, err
 	}
@@ -232,13 +372,13 @@ func (fs *Filestore) PutFile(f fs.File) (qfs.PutResult, error) {
 	}
 
 	return qfs.PutResult{
-		Cid:  path.Root(),
+		Cid:  id,
 		Size: size,
 	}, nil
 }
 
 func (fs *Filestore) GetFile(root cid.Cid, path ...string) (io.ReadCloser, error) {
-	nd, err := fs.capi.Unixfs().Get(fs.ctx, corepath.IpfsPath(root))
+	nd, err := fs.drv.Get(fs.ctx, pathFromHash(root.String()))
 	if err != nil {
 		return nil, err
 	}
@@ -256,16 +396,45 @@ func (fst *Filestore) DoneErr() error {
 	return fst.doneErr
 }
 
-// CoreAPI exposes the Filestore's CoreAPI interface
+// CoreAPI exposes the Filestore's CoreAPI interface. Calling CoreAPI on a
+// lazy filestore constructs the node
 func (fst *Filestore) CoreAPI() coreiface.CoreAPI {
+	if err := fst.Warmup(fst.ctx); err != nil {
+		log.Debugw("starting lazy node", "err", err)
+	}
 	return fst.capi
 }
 
+// Describe reports the filestore's current capabilities. Filestores backed
+// by the HTTP API don't know the remote daemon's version
+func (fst *Filestore) Describe() qfs.Descriptor {
+	d := qfs.Descriptor{
+		Type:     FilestoreType,
+		Features: qfs.FeatureWritable | qfs.FeatureContentAddressed | qfs.FeaturePinning,
+	}
+	if !fst.UsingHTTPBacking() {
+		d.Version = ipfs.CurrentVersionNumber
+	}
+	if fst.Online() {
+		d.Features |= qfs.FeatureOnline
+	}
+	if _, lite := fst.drv.(*liteDriver); !lite {
+		d.Features |= qfs.FeatureNaming
+	}
+	return d
+}
+
 func (fst *Filestore) Online() bool {
 	if fst.UsingHTTPBacking() {
 		// TODO(b5): ping server?
 		return true
 	}
+	if ld, ok := fst.drv.(*liteDriver); ok {
+		return ld.host != nil
+	}
+	if ld, ok := fst.drv.(*lazyDriver); ok && !ld.started() {
+		return false
+	}
 	return fst.node.IsOnline
 }
 
@@ -274,6 +443,24 @@ func (fst *Filestore) GoOnline() error {
 		// already "online" if we're connected over HTTP
 		return nil
 	}
+	if _, ok := fst.drv.(*liteDriver); ok {
+		return fmt.Errorf("%w: going online after construction", ErrLiteUnsupported)
+	}
+	if ld, ok := fst.drv.(*lazyDriver); ok && !ld.started() {
+		// construct the node online from the start
+		fst.cfg.BuildCfg.Online = true
+		if err := fst.Warmup(fst.ctx); err != nil {
+			return err
+		}
+		if fst.cfg.EnableAPI {
+			go func() {
+				if err := fst.serveAPI(); err != nil {
+					log.Errorf("error serving IPFS HTTP api: %w", err)
+				}
+			}()
+		}
+		return nil
+	}
 
 	log.Debug("going online")
 	cfg := fst.cfg
@@ -293,6 +480,14 @@ func (fst *Filestore) GoOnline() error {
 		cfg:  cfg,
 		node: node,
 		capi: capi,
+		drv:  newNodeDriver(node, capi),
+
+		blockCache:     fst.blockCache,
+		cidFilter:      fst.cidFilter,
+		cidFilterStale: atomic.LoadInt32(&fst.cidFilterStale),
+		events:         fst.events,
+		pending:        fst.pending,
+		offline:        fst.offline,
 
 		doneCh:  fst.doneCh,
 		doneErr: fst.doneErr,
@@ -309,104 +504,152 @@ func (fst *Filestore) GoOnline() error {
 	return nil
 }
 
+// Has checks for a CID or /ipfs/ path to a CID in local storage. Has never
+// fetches content from the network, including when backed by a remote API.
+// Filestores with read endpoints check them too, unless ctx is set with
+// qfs.WithLocalHas
 func (fst *Filestore) Has(ctx context.Context, key string) (exists bool, err error) {
-	id, err := cid.Parse(key)
+	id, err := cid.Parse(strings.TrimPrefix(key, "/"+FilestoreType+"/"))
 	if err != nil {
 		return false, err
 	}
-	if fst.node != nil {
-		return fst.node.Blockstore.Has(id)
+	if fst.cidFilter == nil {
+		return fst.blockHas(ctx, id)
 	}
 
-	// fall back to offline checking
-	offline, err := fst.capi.WithOptions(caopts.Api.Offline(true))
-	if err != nil {
-		return false, err
+	if !fst.cidFilter.MayContain(id) {
+		if !fst.filterStale() {
+			return false, nil
+		}
+		// the filter may be missing fetched blocks, so misses are confirmed
+		if exists, err = fst.blockHas(ctx, id); exists {
+			fst.cidFilter.Add(id)
+		}
+		return exists, err
 	}
-	st, _ := offline.Block().Stat(ctx, path.New(key))
-	return st != nil, nil
+	exists, err = fst.blockHas(ctx, id)
+	if err == nil && !exists {
+		fst.cidFilter.RecordFalsePositive()
+	}
+	return exists, err
 }
 
-func (fst *Filestore) Get(ctx context.Context, key string) (qfs.File, error) {
-	return fst.getKey(ctx, key)
-}
+// Get fetches a file. Bare CID keys are read as /ipfs/ paths, so the returned
+// file's path always carries a prefix. /ipns/ paths are read from the content
+// the name currently points to, & the file is returned at that /ipfs/ path
+func (fst *Filestore) Get(ctx context.Context, key string) (f qfs.File, err error) {
+	if !strings.HasPrefix(key, "/") {
+		key = pathFromHash(key)
+	}
+	span, ctx := qfs.StartSpan(ctx, "get", fst.Type(), key)
+	defer func() { span.Finish(0, err) }()
 
-// Put adds a file and pins
-func (fst *Filestore) Put(ctx context.Context, file qfs.File) (key string, err error) {
-	hash, err := fst.AddFile(file, true)
+	if key, err = fst.resolveNamePath(ctx, key); err != nil {
+		return nil, err
+	}
+	drv, err := fst.readDriver()
 	if err != nil {
-		log.Infof("error adding bytes: %w", err)
-		return
+		return nil, err
+	}
+	if fst.cfg != nil && fst.cfg.VerifyContent {
+		f, err = fst.getVerified(ctx, drv, key)
+	} else {
+		f, err = fst.getKey(ctx, drv, key)
+	}
+	if err != nil {
+		return nil, err
 	}
-	return pathFromHash(hash), nil
+	fst.filterFetched()
+	return qfs.ProgressFile(f, qfs.ProgressFromContext(ctx)), nil
 }
 
-func (fst *Filestore) Delete(ctx context.Context, key string) error {
-	err := fst.Unpin(ctx, key, true)
-	if err != nil {
-		if err.Error() == "not pinned" {
-			return nil
+// Put adds a file and pins, chunking & hashing it with the configured
+// PutOptions
+func (fst *Filestore) Put(ctx context.Context, file qfs.File) (key string, err error) {
+	return fst.PutWithOptions(ctx, file, fst.putOptions())
+}
+
+// Delete unpins a path. Content queued to be pinned by PinLater puts has the
+// pin queued by the latest put dropped instead, undoing that put only.
+// Deleting content that isn't pinned is a no-op
+func (fst *Filestore) Delete(ctx context.Context, key string) (err error) {
+	span, ctx := qfs.StartSpan(ctx, "delete", fst.Type(), key)
+	defer func() { span.Finish(0, err) }()
+
+	if !fst.pending.remove(key) {
+		if err = fst.Unpin(ctx, key, true); err != nil && !errors.Is(err, qfs.ErrNotPinned) {
+			return err
 		}
 	}
+	fst.publish(qfs.EventDelete, key)
 	return nil
 }
 
-func (fst *Filestore) getKey(ctx context.Context, key string) (qfs.File, error) {
-	node, err := fst.capi.Unixfs().Get(ctx, path.New(key))
+func (fst *Filestore) getKey(ctx context.Context, drv driver, key string) (qfs.File, error) {
+	node, err := drv.Get(ctx, key)
 	if err != nil {
-		return nil, err
+		return nil, typedError(err)
 	}
 
-	if rdr, ok := node.(io.ReadCloser); ok {
-		return ipfsFile{path: key, r: rdr}, nil
+	rdr, ok := node.(io.ReadCloser)
+	if !ok {
+		return nil, fmt.Errorf("path is neither a file nor a directory")
 	}
 
-	return nil, fmt.Errorf("path is neither a file nor a directory")
+	return ipfsFile{path: key, r: rdr}, nil
 }
 
-func (fst *Filestore) Pin(ctx context.Context, cid string, recursive bool) error {
-	return fst.capi.Pin().Add(ctx, path.New(cid))
+// Pin pins a path, mirroring the pin to any configured remote pinning
+// services
+func (fst *Filestore) Pin(ctx context.Context, cid string, recursive bool) (err error) {
+	span, ctx := qfs.StartSpan(ctx, "pin", fst.Type(), cid)
+	defer func() { span.Finish(0, err) }()
+
+	return fst.pin(ctx, cid, "", recursive)
 }
 
-func (fst *Filestore) Unpin(ctx context.Context, cid string, recursive bool) error {
-	return fst.capi.Pin().Rm(ctx, path.New(cid))
+// pin pins path locally, then mirrors the pin to remote pinning services
+// under name
+func (fst *Filestore) pin(ctx context.Context, path, name string, recursive bool) error {
+	if err := fst.drv.Pin(ctx, path, recursive); err != nil {
+		return err
+	}
+	fst.filterAddPin(ctx, path, recursive)
+	fst.publish(qfs.EventPin, path)
+	return fst.mirrorPin(ctx, path, name)
+}
+
+// Unpin unpins a path, dropping its label & removing the pin from any
+// configured remote pinning services
+func (fst *Filestore) Unpin(ctx context.Context, cid string, recursive bool) (err error) {
+	span, ctx := qfs.StartSpan(ctx, "unpin", fst.Type(), cid)
+	defer func() { span.Finish(0, err) }()
+
+	if err := fst.drv.Unpin(ctx, cid, recursive); err != nil {
+		return typedError(err)
+	}
+	fst.publish(qfs.EventUnpin, cid)
+	if err := fst.unlabelPin(ctx, cid); err != nil {
+		return err
+	}
+	return fst.mirrorUnpin(ctx, cid)
+}
+
+// IsPinned reports whether a path has a recursive or direct pin on the node
+func (fst *Filestore) IsPinned(ctx context.Context, key string) (bool, error) {
+	pinned, err := fst.drv.IsPinned(ctx, key)
+	return pinned, typedError(err)
 }
 
 // PinsetDifference returns a map of "Recursive"-pinned hashes that are not in
-// the given set of hash keys. The returned set is a list of all data
+// the given set of hash keys. The returned set is a list of all data. Use
+// PinsetDiff for typed results in both directions
 func (fst *Filestore) PinsetDifference(ctx context.Context, set map[string]struct{}) (<-chan string, error) {
-	resCh := make(chan string, 10)
-	res, err := fst.capi.Pin().Ls(ctx, func(o *caopts.PinLsSettings) error {
-		o.Type = "recursive"
-		return nil
-	})
+	diffs, err := fst.PinsetDiff(ctx, set)
 	if err != nil {
 		return nil, err
 	}
-
-	go func() {
-		defer close(resCh)
-	LOOP:
-		for {
-			select {
-			case p, ok := <-res:
-				if !ok {
-					break LOOP
-				}
-
-				str := p.Path().String()
-				if _, ok := set[str]; !ok {
-					// send on channel if path is not in set
-					resCh <- str
-				}
-			case <-ctx.Done():
-				log.Debug(ctx.Err())
-				break LOOP
-			}
-		}
-	}()
-
-	return resCh, nil
+	return diffPaths(ctx, diffs, "recursive"), nil
 }
 
 func (fst *Filestore) handleContextClose() {
@@ -420,6 +663,20 @@ func (fst *Filestore) handleContextClose() {
 		return
 	}
 
+	if ld, ok := fst.drv.(*liteDriver); ok {
+		if err := ld.Close(); err != nil {
+			log.Error(err)
+		}
+		return
+	}
+	if ld, ok := fst.drv.(*lazyDriver); ok && ld.stop() {
+		// node was never constructed, only the repo needs closing
+		if err := fst.cfg.Repo.Close(); err != nil {
+			log.Error(err)
+		}
+		return
+	}
+
 	if err := fst.node.Repo.Close(); err != nil {
 		log.Error(err)
 	}
@@ -471,6 +728,9 @@ func (fs *Filestore) serveAPI() error {
 		ipfs_corehttp.WebUIOption,
 		ipfs_corehttp.CommandsOption(cmdCtx(fs.node, cfg.Path)),
 	}
+	if !cfg.DisableHTTPCompression {
+		opts = append([]ipfs_corehttp.ServeOption{compressionOption(cfg.UncompressibleMediaTypes)}, opts...)
+	}
 
 	// TODO (b5): I've added this fmt.Println because the corehttp package includes a println
 	// call to the affect of "API server listening on [addr]", which will be confusing to our
@@ -482,13 +742,53 @@ func (fs *Filestore) serveAPI() error {
 
 // AddFile adds a file to the top level IPFS Node
 func (fst *Filestore) AddFile(file qfs.File, pin bool) (hash string, err error) {
-	ctx := context.Background()
+	return fst.addFile(context.Background(), file, fst.putOptions(), pin)
+}
 
-	path, err := fst.capi.Unixfs().Add(ctx, files.NewReaderFile(file), caopts.Unixfs.CidVersion(0))
+// addFile streams file into the unixfs importer, which chunks & stores
+// content as it's read, so memory use is bounded by the chunk size no matter
+// how large the file is. Cancelling ctx stops the add mid-stream
+func (fst *Filestore) addFile(ctx context.Context, file qfs.File, opts PutOptions, pin bool) (string, error) {
+	aopts, err := opts.addOptions()
 	if err != nil {
 		return "", err
 	}
-	return path.Cid().String(), nil
+	var mtime time.Time
+	if opts.PreserveModTime {
+		mtime = file.ModTime()
+	}
+	// files with a modification time are pinned once the time is recorded
+	aopts.Pin = pin && mtime.IsZero()
+	r := qfs.ProgressReader(file, qfs.FileSize(file), opts.Progress)
+	id, err := fst.drv.Add(ctx, files.NewReaderFile(contextReader{ctx: ctx, r: r}), aopts)
+	if err != nil {
+		return "", err
+	}
+	if !mtime.IsZero() {
+		if id, err = withModTime(ctx, fst.drv, id, mtime); err != nil {
+			return "", err
+		}
+		if pin {
+			if err := fst.drv.Pin(ctx, pathFromHash(id.String()), true); err != nil {
+				return "", err
+			}
+		}
+	}
+	fst.filterAddDAG(ctx, id)
+	return id.String(), nil
+}
+
+// contextReader fails reads once ctx is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
 }
 
 func openRepo(ctx context.Context, cfg *StoreCfg) (ipfsrepo.Repo, error) {
@@ -506,6 +806,12 @@ func openRepo(ctx context.Context, cfg *StoreCfg) (ipfsrepo.Repo, error) {
 			return nil, errRepoLock
 		}
 		localRepo, err := fsrepo.Open(cfg.Path)
+		if err == fsrepo.ErrNeedMigration {
+			if err := autoMigrate(ctx, cfg); err != nil {
+				return nil, err
+			}
+			localRepo, err = fsrepo.Open(cfg.Path)
+		}
 		if err != nil {
 			if err == fsrepo.ErrNeedMigration {
 				return nil, ErrNeedMigration
@@ -519,7 +825,7 @@ func openRepo(ctx context.Context, cfg *StoreCfg) (ipfsrepo.Repo, error) {
 }
 
 func pathFromHash(hash string) string {
-	return fmt.Sprintf("/%s/%s", FilestoreType, hash)
+	return qfs.CanonicalPath(FilestoreType, hash)
 }
 
 type ipfsDagNode struct {
@@ -546,11 +852,16 @@ func (n ipfsDagNode) Links() qfs.Links {
 }
 
 type ipfsFile struct {
-	path string
-	r    io.ReadCloser
+	path  string
+	r     io.ReadCloser
+	mtime time.Time
 }
 
-var _ qfs.File = (*ipfsFile)(nil)
+var (
+	_ qfs.File         = (*ipfsFile)(nil)
+	_ qfs.SeekableFile = (*ipfsFile)(nil)
+	_ qfs.SizeFile     = (*ipfsFile)(nil)
+)
 
 // Read proxies to the response body reader
 func (f ipfsFile) Read(p []byte) (int, error) {
@@ -562,6 +873,25 @@ func (f ipfsFile) Close() error {
 	return f.r.Close()
 }
 
+// Seek implements the io.Seeker interface. unixfs files are seekable both
+// in-process and over the HTTP API
+func (f ipfsFile) Seek(offset int64, whence int) (int64, error) {
+	if s, ok := f.r.(io.Seeker); ok {
+		return s.Seek(offset, whence)
+	}
+	return 0, qfs.ErrNotSeekable
+}
+
+// Size returns the length of the file in bytes, or -1 if it's unknown
+func (f ipfsFile) Size() int64 {
+	if n, ok := f.r.(files.Node); ok {
+		if size, err := n.Size(); err == nil {
+			return size
+		}
+	}
+	return -1
+}
+
 // IsDirectory satisfies the qfs.File interface
 func (f ipfsFile) IsDirectory() bool {
 	return false
@@ -582,17 +912,30 @@ func (f ipfsFile) FullPath() string {
 	return f.path
 }
 
-// MediaType maps an ipfs CID to a media type. Media types are not yet
-// implemented for ipfs files
-// TODO (b5) - finish
+// MediaType sniffs the start of the file, falling back to a mime type based
+// on the extension of paths that name a file within a directory
 func (f ipfsFile) MediaType() string {
-	return ""
+	return qfs.SniffMediaType(f.path, f)
 }
 
-// ModTime gets the last time of modification. ipfs files are immutable
-// and will always have a ModTime of zero
+// ModTime returns the modification time recorded in the file's root unixfs
+// node, zero if none was recorded. Files read through a driver take the time
+// from the root node the driver fetched
 func (f ipfsFile) ModTime() time.Time {
-	return time.Time{}
+	if m, ok := f.r.(modTimeFile); ok {
+		return m.ModTime()
+	}
+	return f.mtime
+}
+
+// compressionOption gzips API responses for clients that accept it. Options
+// that follow register their handlers on the returned mux
+func compressionOption(uncompressible []string) ipfs_corehttp.ServeOption {
+	return func(_ *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		child := http.NewServeMux()
+		mux.Handle("/", qfs.CompressHandler(child, uncompressible))
+		return child, nil
+	}
 }
 
 // extracted from github.com/ipfs/go-ipfs/cmd/ipfswatch/main.go
@@ -615,5 +958,8 @@ func cmdCtx(node *core.IpfsNode, repoPath string) ipfs_commands.Context {
 //
 // Deprecated: use IPFSCoreAPI instead
 func (fst *Filestore) Node() *core.IpfsNode {
+	if err := fst.Warmup(fst.ctx); err != nil {
+		log.Debugw("starting lazy node", "err", err)
+	}
 	return fst.node
 }
@@ -3,13 +3,23 @@ package qipfs
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	bserv "github.com/ipfs/go-blockservice"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	files "github.com/ipfs/go-ipfs-files"
+	merkledag "github.com/ipfs/go-merkledag"
 	"github.com/qri-io/qfs"
 )
 
@@ -206,6 +216,37 @@ func TestPinsetDifference(t *testing.T) {
 	}
 }
 
+func TestIsPinned(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	f, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := f.(*Filestore)
+
+	if pinned, err := fs.IsPinned(ctx, "/ipfs/QmQPeNsJPyVWPFDVHb77w8G42Fvo15z4bG2X8D2GhfbSXc"); err != nil || !pinned {
+		t.Errorf("expected the repo's recursive pin to be pinned. got %t, %v", pinned, err)
+	}
+	unpinned, err := fs.PutWithOptions(ctx, qfs.NewMemfileBytes("a.txt", []byte("unpinned")), PutOptions{Pin: PinNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pinned, err := fs.IsPinned(ctx, unpinned); err != nil || pinned {
+		t.Errorf("expected %q not to be pinned. got %t, %v", unpinned, pinned, err)
+	}
+	if err := fs.Pin(ctx, unpinned, false); err != nil {
+		t.Fatal(err)
+	}
+	if pinned, err := fs.IsPinned(ctx, unpinned); err != nil || !pinned {
+		t.Errorf("expected a direct pin of %q to be pinned. got %t, %v", unpinned, pinned, err)
+	}
+}
+
 // TestDisableBootstrap should test that the DisableBootstrap option
 // does not permanently remove the bootstrap addrs from the ipfs config
 func TestDisableBootstrap(t *testing.T) {
@@ -251,6 +292,41 @@ func TestDisableBootstrap(t *testing.T) {
 }
 
 // InitTestRepo creates a repo at the given path
+func TestBootstrapAddrs(t *testing.T) {
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr := "/ip4/10.0.0.1/tcp/4001/p2p/QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN"
+	fs, err := NewFilesystem(ctx, map[string]interface{}{
+		"path":           path,
+		"bootstrapAddrs": []string{addr},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repoCfg, err := fs.(*Filestore).node.Repo.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{addr}, repoCfg.Bootstrap); diff != "" {
+		t.Errorf("node bootstrap mismatch (-want +got):\n%s", diff)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(path, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	onDisk := struct{ Bootstrap []string }{}
+	if err := json.Unmarshal(data, &onDisk); err != nil {
+		t.Fatal(err)
+	}
+	if len(onDisk.Bootstrap) == 0 || onDisk.Bootstrap[0] == addr {
+		t.Errorf("expected the repo config file to keep its bootstrap addrs, got %v", onDisk.Bootstrap)
+	}
+}
+
 func InitTestRepo(t *testing.T) string {
 	path, err := ioutil.TempDir("", t.Name())
 	if err != nil {
@@ -265,3 +341,385 @@ func InitTestRepo(t *testing.T) string {
 
 	return path
 }
+
+func TestGetBlockFillsCache(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	f, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst := f.(*Filestore)
+
+	dir, err := ioutil.TempDir("", "qipfs_block_cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cache, err := qfs.NewDiskBlockCache(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst.SetBlockCache(cache)
+
+	id, err := fst.PutBlock([]byte("cached block"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cache.HasBlock(id) {
+		t.Fatal("expected block to be cached only once read")
+	}
+	if _, err := fst.GetBlock(id); err != nil {
+		t.Fatal(err)
+	}
+	if !cache.HasBlock(id) {
+		t.Errorf("expected GetBlock to fill the block cache")
+	}
+}
+
+func TestCanonicalPaths(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	fst, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := fst.Put(ctx, qfs.NewMemfileBytes("a.txt", []byte("canonical")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, "/ipfs/") {
+		t.Errorf("expected put to return an /ipfs/ path, got %q", key)
+	}
+
+	for _, p := range []string{key, strings.TrimPrefix(key, "/ipfs/")} {
+		f, err := fst.Get(ctx, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.FullPath() != key {
+			t.Errorf("expected get of %q to return path %q, got %q", p, key, f.FullPath())
+		}
+	}
+}
+
+func TestGetNodePath(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	f, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst := f.(*Filestore)
+
+	leaf, err := fst.PutBlock([]byte("leaf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := fst.PutNode(qfs.NewLinks(qfs.Link{Name: "c", Cid: leaf, Size: 4, IsFile: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := fst.PutNode(qfs.NewLinks(qfs.Link{Name: "b", Cid: b.Cid, Size: b.Size}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := fst.PutNode(qfs.NewLinks(qfs.Link{Name: "a", Cid: a.Cid, Size: a.Size}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nd, err := fst.GetNode(root.Cid, "a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nd.Cid().Equals(b.Cid) {
+		t.Errorf("expected node at a/b to be %s, got %s", b.Cid, nd.Cid())
+	}
+	if lk := nd.Links().Get("c"); lk == nil || !lk.Cid.Equals(leaf) {
+		t.Errorf("expected node at a/b to link to c, got %v", nd.Links().Map())
+	}
+
+	nd, err = fst.GetNode(root.Cid, "a", "b", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nd.Cid().Equals(leaf) {
+		t.Errorf("expected node at a/b/c to be %s, got %s", leaf, nd.Cid())
+	}
+
+	if _, err := fst.GetNode(root.Cid, "a", "missing"); err == nil {
+		t.Error("expected resolving a missing link to fail")
+	}
+}
+
+func TestSeekFile(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	fst, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := fst.Put(ctx, qfs.NewMemfileBytes("a.txt", []byte("0123456789")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := fst.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if size := qfs.FileSize(f); size != 10 {
+		t.Errorf("size mismatch. want: 10 got: %d", size)
+	}
+	sf, ok := f.(qfs.SeekableFile)
+	if !ok {
+		t.Fatalf("expected ipfs file to be seekable")
+	}
+	if _, err := sf.Seek(4, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(sf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "456789" {
+		t.Errorf("read after seek mismatch. want %q, got %q", "456789", string(data))
+	}
+}
+
+func TestIPFSFileMediaType(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	fst, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := fst.Put(ctx, qfs.NewMemfileBytes("a.html", []byte("<html><body>hi</body></html>")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := fst.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if mt := f.MediaType(); mt != "text/html; charset=utf-8" {
+		t.Errorf("expected sniffed html media type. got: %q", mt)
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "<html>") {
+		t.Errorf("expected sniffing not to consume the file. got: %q", data)
+	}
+}
+
+// endlessReader produces bytes forever, calling stop once limit bytes have
+// been read
+type endlessReader struct {
+	read  int
+	limit int
+	stop  func()
+}
+
+func (r *endlessReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(r.read + i)
+	}
+	r.read += len(p)
+	if r.read >= r.limit {
+		r.stop()
+	}
+	return len(p), nil
+}
+
+func TestPutStreams(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	fst, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a file that never ends can only be added by streaming it, and the add
+	// stops when its context is cancelled
+	putCtx, stop := context.WithCancel(ctx)
+	r := &endlessReader{limit: 4 << 20, stop: stop}
+	if _, err := fst.Put(putCtx, qfs.NewMemfileReader("endless", r)); err == nil {
+		t.Fatal("expected cancelled put to fail")
+	}
+	if r.read < r.limit {
+		t.Errorf("expected put to stream at least %d bytes, read %d", r.limit, r.read)
+	}
+}
+
+func TestMemFSUnixFSPaths(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	fs, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst := fs.(*Filestore)
+
+	big := make([]byte, 300*1024)
+	for i := range big {
+		big[i] = byte(i % 251)
+	}
+
+	cases := []PutOptions{
+		{},
+		{CidVersion: 1},
+		{CidVersion: 1, RawLeaves: true, Chunker: "size-65536"},
+	}
+	for i, opts := range cases {
+		mem := qfs.NewMemFS()
+		mem.UnixFS = true
+		mem.CidVersion, mem.Chunker, mem.RawLeaves = opts.CidVersion, opts.Chunker, opts.RawLeaves
+
+		for _, data := range [][]byte{[]byte("this is file a"), big} {
+			ipfsPath, err := fst.PutWithOptions(ctx, qfs.NewMemfileBytes("data", data), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			memPath, err := mem.Put(ctx, qfs.NewMemfileBytes("data", data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.TrimPrefix(memPath, "/mem/") != strings.TrimPrefix(ipfsPath, "/ipfs/") {
+				t.Errorf("case %d: expected mem path %q to match ipfs path %q", i, memPath, ipfsPath)
+			}
+		}
+
+		// directories can't be put to the filestore, compare with the DAG ipfs
+		// add builds
+		aopts, err := opts.addOptions()
+		if err != nil {
+			t.Fatal(err)
+		}
+		prefix, err := aopts.prefix()
+		if err != nil {
+			t.Fatal(err)
+		}
+		bs := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+		dag := merkledag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+		expect, err := addNode(ctx, dag, files.NewMapDirectory(map[string]files.Node{
+			"a.txt":   files.NewBytesFile([]byte("this is file a")),
+			"big.bin": files.NewBytesFile(big),
+			"sub": files.NewMapDirectory(map[string]files.Node{
+				"b.txt": files.NewBytesFile([]byte("this is file b")),
+			}),
+		}), prefix, aopts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		memPath, err := mem.Put(ctx, qfs.NewMemdir("/",
+			qfs.NewMemfileBytes("a.txt", []byte("this is file a")),
+			qfs.NewMemfileBytes("big.bin", big),
+			qfs.NewMemdir("sub",
+				qfs.NewMemfileBytes("b.txt", []byte("this is file b")),
+			),
+		))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "/mem/" + expect.Cid().String(); memPath != want {
+			t.Errorf("case %d: expected directory path %q, got %q", i, want, memPath)
+		}
+	}
+}
+
+func TestHookFSRollback(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	f, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst := f.(*Filestore)
+	fs := qfs.NewHookFS(fst)
+
+	var put string
+	errBoom := errors.New("boom")
+	fs.OnPut(func(ctx context.Context, _ qfs.Filesystem, path string) error {
+		put = path
+		return errBoom
+	})
+	if _, err := fs.Put(ctx, qfs.NewMemfileBytes("a.txt", []byte("rolled back"))); !errors.Is(err, errBoom) {
+		t.Fatalf("expected put hook error. got: %v", err)
+	}
+	if put == "" {
+		t.Fatal("expected put hook to run")
+	}
+	// rolling back deletes the put, which unpins it
+	if err := fst.Unpin(ctx, put, true); !errors.Is(err, qfs.ErrNotPinned) {
+		t.Errorf("expected rolled back put to be unpinned. got: %v", err)
+	}
+
+	// content put with PinLater isn't pinned yet, rolling it back drops the
+	// queued pin
+	fst.cfg.PutOptions.Pin = PinLater
+	if _, err := fs.Put(ctx, qfs.NewMemfileBytes("b.txt", []byte("pinned later"))); !errors.Is(err, errBoom) {
+		t.Fatalf("expected put hook error. got: %v", err)
+	}
+	if pending := fst.PendingPins(); len(pending) != 0 {
+		t.Errorf("expected rolled back put not to be pending, got %v", pending)
+	}
+
+	// rolling back a put of content an earlier put queued keeps the earlier
+	// put's pin queued
+	kept, err := fst.Put(ctx, qfs.NewMemfileBytes("c.txt", []byte("queued twice")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Put(ctx, qfs.NewMemfileBytes("c.txt", []byte("queued twice"))); !errors.Is(err, errBoom) {
+		t.Fatalf("expected put hook error. got: %v", err)
+	}
+	if pending := fst.PendingPins(); len(pending) != 1 || pending[0] != kept {
+		t.Errorf("expected earlier put of %q to stay pending, got %v", kept, pending)
+	}
+	if err := fst.PinPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if pinned, err := fst.IsPinned(ctx, kept); err != nil || !pinned {
+		t.Errorf("expected %q to be pinned after flushing pending pins. got: %t, %v", kept, pinned, err)
+	}
+}
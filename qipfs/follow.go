@@ -0,0 +1,83 @@
+package qipfs
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/qri-io/qfs"
+)
+
+// PinManifest lists the store's recursive pins as a manifest suitable for
+// publishing to followers
+func (fst *Filestore) PinManifest(ctx context.Context, seq int64) (qfs.PinManifest, error) {
+	m := qfs.PinManifest{
+		Seq:       seq,
+		Published: time.Now(),
+		Pins:      []string{},
+	}
+
+	res, err := fst.drv.Pins(ctx, "recursive")
+	if err != nil {
+		return m, err
+	}
+	for p := range res {
+		if p.Err != nil {
+			return m, p.Err
+		}
+		m.Pins = append(m.Pins, pathFromHash(p.Cid.String()))
+	}
+	return m, nil
+}
+
+// AnnouncePins publishes the store's current pinset to followers listening
+// on a pubsub topic. Pubsub must be enabled on both leader & follower
+func (fst *Filestore) AnnouncePins(ctx context.Context, topic string, seq int64) error {
+	m, err := fst.PinManifest(ctx, seq)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return fst.drv.Publish(ctx, topic, data)
+}
+
+// PinsetSubscription creates a qfs.PinsetSource that receives pin manifests
+// announced on a pubsub topic
+func (fst *Filestore) PinsetSubscription(topic string) qfs.PinsetSource {
+	return &pubsubPinsetSource{fst: fst, topic: topic}
+}
+
+type pubsubPinsetSource struct {
+	fst   *Filestore
+	topic string
+}
+
+// Subscribe implements the qfs.PinsetSource interface
+func (s *pubsubPinsetSource) Subscribe(ctx context.Context) (<-chan qfs.PinManifest, error) {
+	msgs, err := s.fst.drv.Subscribe(ctx, s.topic)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan qfs.PinManifest)
+	go func() {
+		defer close(ch)
+		for msg := range msgs {
+			m := qfs.PinManifest{}
+			if err := json.Unmarshal(msg.Data, &m); err != nil {
+				log.Debugw("decoding pin manifest", "from", msg.From, "err", err)
+				continue
+			}
+
+			select {
+			case ch <- m:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
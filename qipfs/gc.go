@@ -0,0 +1,34 @@
+package qipfs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-ipfs/core/corerepo"
+	"github.com/qri-io/qfs"
+)
+
+// GC removes blocks that aren't pinned from the repo, returning the number of
+// blocks removed. A qfs.EventGC is published once collection completes. Only
+// filestores backed by an in-process node can collect garbage
+func (fst *Filestore) GC(ctx context.Context) (removed int, err error) {
+	span, ctx := qfs.StartSpan(ctx, "gc", fst.Type(), "")
+	defer func() { span.Finish(0, err) }()
+
+	if err := fst.Warmup(ctx); err != nil {
+		return 0, err
+	}
+	if fst.node == nil {
+		return 0, fmt.Errorf("%w: garbage collection without an in-process node", qfs.ErrUnsupported)
+	}
+
+	err = corerepo.CollectResult(ctx, corerepo.GarbageCollectAsync(fst.node, ctx), func(cid.Cid) {
+		removed++
+	})
+	if err != nil {
+		return removed, err
+	}
+	fst.events.Publish(ctx, qfs.Event{Type: qfs.EventGC, FS: fst.Type(), Path: "/ipfs"})
+	return removed, nil
+}
@@ -0,0 +1,64 @@
+package qipfs
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/qri-io/qfs"
+)
+
+func TestGC(t *testing.T) {
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst := f.(*Filestore)
+
+	var got []qfs.Event
+	fst.Events().AddSink(qfs.EventSinkFunc(func(ctx context.Context, e qfs.Event) error {
+		got = append(got, e)
+		return nil
+	}))
+
+	pinned, err := fst.Put(ctx, qfs.NewMemfileBytes("pinned.txt", []byte("keep me")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unpinned, err := fst.AddFile(qfs.NewMemfileBytes("unpinned.txt", []byte("collect me")), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := fst.GC(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed < 1 {
+		t.Errorf("expected at least one block to be collected. got: %d", removed)
+	}
+	if has, err := fst.Has(ctx, pinned); err != nil || !has {
+		t.Errorf("expected pinned content to survive collection. has: %t err: %v", has, err)
+	}
+	if has, err := fst.Has(ctx, unpinned); err != nil || has {
+		t.Errorf("expected unpinned content to be collected. has: %t err: %v", has, err)
+	}
+
+	expect := []qfs.EventType{qfs.EventPut, qfs.EventGC}
+	if len(got) != len(expect) {
+		t.Fatalf("expected events %v. got: %v", expect, got)
+	}
+	for i, typ := range expect {
+		if got[i].Type != typ {
+			t.Errorf("event %d: expected %s. got: %s", i, typ, got[i].Type)
+		}
+	}
+	if got[1].Path != "/ipfs" || got[1].FS != FilestoreType {
+		t.Errorf("unexpected gc event: %#v", got[1])
+	}
+}
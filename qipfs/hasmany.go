@@ -0,0 +1,81 @@
+package qipfs
+
+import (
+	"context"
+
+	"github.com/ipfs/go-cid"
+	"github.com/qri-io/qfs"
+)
+
+var _ qfs.HasManyFS = (*Filestore)(nil)
+
+// HasMany checks a batch of keys for existence without fetching from the
+// network. Keys the CID filter rules out are answered without a lookup,
+// unless the filter is stale, see SetCIDFilter. With
+// a local repo the blockstore is read directly, otherwise checks against the
+// remote API run concurrently. Like Has, read endpoints are skipped when ctx
+// is set with qfs.WithLocalHas
+func (fst *Filestore) HasMany(ctx context.Context, keys []string) (map[string]bool, error) {
+	res := make(map[string]bool, len(keys))
+	ids := make([]cid.Cid, 0, len(keys))
+	check := make([]string, 0, len(keys))
+	// filtered marks checks the CID filter ruled out while it's stale
+	filtered := make([]bool, 0, len(keys))
+	stale := fst.filterStale()
+	for _, key := range keys {
+		id, err := cid.Parse(key)
+		if err != nil {
+			return nil, err
+		}
+		maybe := fst.cidFilter == nil || fst.cidFilter.MayContain(id)
+		if !maybe && !stale {
+			res[key] = false
+			continue
+		}
+		ids = append(ids, id)
+		check = append(check, key)
+		filtered = append(filtered, !maybe)
+	}
+
+	found := make([]bool, len(ids))
+	if bs, err := fst.localBlockstore(); err == nil {
+		for i, id := range ids {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if found[i], err = bs.Has(id); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		err := pipeline(ctx, len(ids), func(ctx context.Context, i int) (err error) {
+			found[i], err = fst.blockHas(ctx, ids[i])
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i, key := range check {
+		res[key] = found[i]
+		switch {
+		case fst.cidFilter == nil:
+		case filtered[i] && found[i]:
+			fst.cidFilter.Add(ids[i])
+		case !filtered[i] && !found[i]:
+			fst.cidFilter.RecordFalsePositive()
+		}
+	}
+	return res, nil
+}
+
+// blockHas checks for a block. Contexts set with qfs.WithLocalHas skip the
+// read endpoints of a split driver, asking only the write endpoint's
+// blockstore
+func (fst *Filestore) blockHas(ctx context.Context, id cid.Cid) (bool, error) {
+	if sd, ok := fst.drv.(*splitDriver); ok && qfs.LocalHasFromContext(ctx) {
+		return sd.httpDriver.BlockHas(ctx, id)
+	}
+	return fst.drv.BlockHas(ctx, id)
+}
@@ -0,0 +1,51 @@
+package qipfs
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/qri-io/qfs"
+)
+
+func TestHasMany(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	f, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst := f.(*Filestore)
+
+	key, err := fst.Put(ctx, qfs.NewMemfileBytes("a.txt", []byte("has many")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	absent := "/ipfs/QmcBD4Mj1SNV37DtrLHYZ4HKDaSPWFv2HSwmcNpZVAMzmm"
+
+	check := func() {
+		t.Helper()
+		got, err := fst.HasMany(ctx, []string{key, absent})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got[key] || got[absent] {
+			t.Errorf("unexpected HasMany result: %v", got)
+		}
+	}
+	check()
+
+	fst.SetCIDFilter(qfs.NewCIDFilter(100, 0.01))
+	if err := fst.RebuildCIDFilter(ctx); err != nil {
+		t.Fatal(err)
+	}
+	check()
+
+	if _, err := fst.HasMany(ctx, []string{"not a cid"}); err == nil {
+		t.Errorf("expected invalid key to error")
+	}
+}
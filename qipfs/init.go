@@ -195,9 +195,25 @@ func addDefaultAssets(out io.Writer, repoRoot string) error {
 	return err
 }
 
+// PluginOptions configures IPFS plugin loading. Plugins are injected into
+// process-wide registries, so only the first set of options used to load
+// plugins takes effect
+type PluginOptions struct {
+	// LoadRepoPlugins loads all dynamic plugins from the repo's "plugins"
+	// directory & applies the "Plugins" section of the repo configuration.
+	// Off by default, which loads only the plugins compiled into go-ipfs.
+	// Embedded use should leave this off
+	LoadRepoPlugins bool
+	// Plugins whitelists dynamic plugins from the repo's "plugins" directory
+	// by name. Ignored when LoadRepoPlugins is true
+	Plugins []string
+}
+
 var (
 	pluginLoadLock  sync.Once
+	pluginLoadDone  = make(chan struct{})
 	pluginLoadError error
+	pluginLoadPath  string
 )
 
 // LoadIPFSPluginsOnce runs IPFS plugin initialization.
@@ -209,33 +225,70 @@ var (
 // the default plugin set is complied into go-ipfs (and subsequently, the
 // qri binary) by default
 func LoadIPFSPluginsOnce(path string) error {
-	body := func() {
-		pluginLoadError = loadPlugins(path)
+	return LoadIPFSPlugins(path, PluginOptions{})
+}
+
+// LoadIPFSPlugins loads plugins with the given options, blocking until
+// loading is complete. Only the first call loads plugins, subsequent calls
+// wait for & return the result of the first, even if they supply a different
+// repo path
+func LoadIPFSPlugins(path string, opts PluginOptions) error {
+	StartLoadingIPFSPlugins(path, opts)
+	<-pluginLoadDone
+	if pluginLoadPath != path && (opts.LoadRepoPlugins || len(opts.Plugins) > 0) {
+		log.Warnf("ipfs plugins were already loaded from %q, plugins from %q will not be loaded", pluginLoadPath, path)
 	}
-	pluginLoadLock.Do(body)
 	return pluginLoadError
 }
 
+// StartLoadingIPFSPlugins begins loading plugins in the background, returning
+// immediately. Calling this early in process startup lets plugin loading
+// overlap with other work instead of blocking filesystem construction
+func StartLoadingIPFSPlugins(path string, opts PluginOptions) {
+	pluginLoadLock.Do(func() {
+		pluginLoadPath = path
+		go func() {
+			pluginLoadError = loadPlugins(path, opts)
+			close(pluginLoadDone)
+		}()
+	})
+}
+
 // loadPlugins loads & injects plugins from a given repo path. This needs to be
 // called once per active process with a repo
 // NB: this implies that changing repo locations requires a process restart
-func loadPlugins(repoPath string) error {
-	// check if repo is accessible before loading plugins
-	pluginpath := filepath.Join(repoPath, "plugins")
-
-	var plugins *loader.PluginLoader
-	ok, err := checkPermissions(repoPath)
-	if err != nil {
-		return err
+func loadPlugins(repoPath string, opts PluginOptions) error {
+	if opts.LoadRepoPlugins || len(opts.Plugins) > 0 {
+		// check if repo is accessible before loading plugins
+		ok, err := checkPermissions(repoPath)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			opts = PluginOptions{}
+		}
 	}
-	if !ok {
-		pluginpath = ""
+
+	loaderRepo := ""
+	if opts.LoadRepoPlugins {
+		loaderRepo = repoPath
 	}
-	plugins, err = loader.NewPluginLoader(pluginpath)
+	plugins, err := loader.NewPluginLoader(loaderRepo)
 	if err != nil {
 		return fmt.Errorf("error loading plugins: %s", err)
 	}
 
+	if !opts.LoadRepoPlugins && len(opts.Plugins) > 0 {
+		dir, err := whitelistPluginDir(filepath.Join(repoPath, "plugins"), opts.Plugins)
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		if err := plugins.LoadDirectory(dir); err != nil {
+			return fmt.Errorf("error loading plugins: %s", err)
+		}
+	}
+
 	if err := plugins.Initialize(); err != nil {
 		return fmt.Errorf("error initializing plugins: %s", err)
 	}
@@ -247,6 +300,27 @@ func loadPlugins(repoPath string) error {
 	return nil
 }
 
+// whitelistPluginDir creates a temporary directory that links to only the
+// named plugin files within pluginDir
+func whitelistPluginDir(pluginDir string, names []string) (string, error) {
+	dir, err := ioutil.TempDir("", "qipfs_plugins")
+	if err != nil {
+		return "", err
+	}
+	for _, name := range names {
+		src := filepath.Join(pluginDir, name+".so")
+		if _, err := os.Stat(src); err != nil {
+			os.RemoveAll(dir)
+			return "", fmt.Errorf("whitelisted plugin %q: %w", name, err)
+		}
+		if err := os.Symlink(src, filepath.Join(dir, name+".so")); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
 func checkPermissions(path string) (bool, error) {
 	_, err := os.Open(path)
 	if os.IsNotExist(err) {
@@ -2,6 +2,7 @@ package qipfs
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
@@ -28,3 +29,34 @@ func TestInitRepo(t *testing.T) {
 		}
 	}
 }
+
+func TestWhitelistPluginDir(t *testing.T) {
+	pluginDir, err := ioutil.TempDir("", "qipfs_plugin_src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(pluginDir)
+	for _, name := range []string{"a.so", "b.so"} {
+		if err := ioutil.WriteFile(filepath.Join(pluginDir, name), []byte{}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir, err := whitelistPluginDir(pluginDir, []string{"b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Name() != "b.so" {
+		t.Errorf("expected only b.so to be linked, got: %v", infos)
+	}
+
+	if _, err := whitelistPluginDir(pluginDir, []string{"missing"}); err == nil {
+		t.Errorf("expected error whitelisting a missing plugin")
+	}
+}
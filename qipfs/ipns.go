@@ -0,0 +1,119 @@
+package qipfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/qri-io/qfs"
+)
+
+// DefaultIPNSKey is the key names are published with when no key is given,
+// the node's own identity key
+const DefaultIPNSKey = "self"
+
+// Publish points the IPNS name of the keyName key at id, returning the name
+// as an /ipns/ path. Lite filesystems return an error matching
+// qfs.ErrUnsupported
+func (fst *Filestore) Publish(ctx context.Context, id cid.Cid, keyName string) (name string, err error) {
+	span, ctx := qfs.StartSpan(ctx, "publish", fst.Type(), id.String())
+	defer func() { span.Finish(0, err) }()
+
+	if keyName == "" {
+		keyName = DefaultIPNSKey
+	}
+	return fst.drv.NamePublish(ctx, pathFromHash(id.String()), keyName)
+}
+
+// Resolve returns the CID an IPNS name points to. Names can be given with or
+// without an /ipns/ prefix
+func (fst *Filestore) Resolve(ctx context.Context, name string) (id cid.Cid, err error) {
+	span, ctx := qfs.StartSpan(ctx, "resolve", fst.Type(), name)
+	defer func() { span.Finish(0, err) }()
+
+	if id, err = fst.drv.NameResolve(ctx, name); err != nil {
+		return cid.Cid{}, typedError(err)
+	}
+	return id, nil
+}
+
+// resolveNamePath rewrites an /ipns/ path to the /ipfs/ path its name
+// currently points to. Other paths are returned as-is
+func (fst *Filestore) resolveNamePath(ctx context.Context, key string) (string, error) {
+	if !strings.HasPrefix(key, "/ipns/") {
+		return key, nil
+	}
+	name, rest := splitNamePath(key)
+	id, err := fst.Resolve(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	return pathFromHash(id.String()) + rest, nil
+}
+
+// splitNamePath separates the name in an /ipns/ path from the path within
+// the named content
+func splitNamePath(p string) (name, rest string) {
+	p = strings.TrimPrefix(p, "/ipns/")
+	if i := strings.IndexByte(p, '/'); i >= 0 {
+		return p[:i], p[i:]
+	}
+	return p, ""
+}
+
+// errNotDomain is returned resolving a name that can only be resolved by
+// IPNS, not by DNSLink
+var errNotDomain = errors.New("name is not a domain")
+
+// maxDNSLinkDepth bounds DNSLink records that point to other DNSLink names
+const maxDNSLinkDepth = 32
+
+// lookupTXT is a package variable so tests can stub DNS
+var lookupTXT = net.DefaultResolver.LookupTXT
+
+// resolveDNSLink resolves a domain name to the /ipfs/ path published in its
+// DNSLink TXT record, following records that point to other domains
+func resolveDNSLink(ctx context.Context, name string) (string, error) {
+	rest := ""
+	for i := 0; i < maxDNSLinkDepth; i++ {
+		domain, sub := splitNamePath(name)
+		if !strings.Contains(domain, ".") {
+			return "", fmt.Errorf("%w: %q", errNotDomain, domain)
+		}
+		link, err := lookupDNSLink(ctx, domain)
+		if err != nil {
+			return "", err
+		}
+		rest = sub + rest
+		switch {
+		case strings.HasPrefix(link, "/ipfs/"):
+			return link + rest, nil
+		case strings.HasPrefix(link, "/ipns/"):
+			name = link
+		default:
+			return "", fmt.Errorf("invalid dnslink %q for %s", link, domain)
+		}
+	}
+	return "", fmt.Errorf("resolving %q: too many dnslink redirects", name)
+}
+
+// lookupDNSLink reads the dnslink value for a domain, checking the _dnslink
+// subdomain before the domain itself
+func lookupDNSLink(ctx context.Context, domain string) (string, error) {
+	for _, host := range []string{"_dnslink." + domain, domain} {
+		records, err := lookupTXT(ctx, host)
+		if err != nil {
+			log.Debugw("looking up dnslink", "host", host, "err", err)
+			continue
+		}
+		for _, r := range records {
+			if strings.HasPrefix(r, "dnslink=") {
+				return strings.TrimSpace(strings.TrimPrefix(r, "dnslink=")), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%w: no dnslink record for %s", qfs.ErrNotFound, domain)
+}
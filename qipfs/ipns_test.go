@@ -0,0 +1,145 @@
+package qipfs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/qri-io/qfs"
+)
+
+func TestPublishResolve(t *testing.T) {
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fs, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns := fs.(qfs.NameSystem)
+
+	if !qfs.Describe(fs).Has(qfs.FeatureNaming) {
+		t.Error("expected ipfs filesystem to describe the naming feature")
+	}
+
+	var ids []cid.Cid
+	for _, data := range []string{"v1", "v2"} {
+		p, err := fs.Put(ctx, qfs.NewMemfileBytes("data", []byte(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := cid.Parse(strings.TrimPrefix(p, "/ipfs/"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	var name string
+	for _, id := range ids {
+		if name, err = ns.Publish(ctx, id, ""); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(name, "/ipns/") {
+			t.Errorf("expected an /ipns/ name, got %q", name)
+		}
+		got, err := ns.Resolve(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equals(id) {
+			t.Errorf("expected %q to resolve to %s, got %s", name, id, got)
+		}
+	}
+
+	if _, err := ns.Publish(ctx, ids[0], "missing-key"); err == nil {
+		t.Error("expected publishing with a missing key to fail")
+	}
+}
+
+func TestLitePublishUnsupported(t *testing.T) {
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fs, err := NewFilesystem(ctx, map[string]interface{}{"path": path, "lite": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.(qfs.NameSystem).Resolve(ctx, "/ipns/k51qzi5uqu5dlvj2baxnqndepeb86cbk3ng7n3i46uzyxzyqj2xjonzllnv0v8"); !errors.Is(err, qfs.ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported, got: %v", err)
+	}
+	if qfs.Describe(fs).Has(qfs.FeatureNaming) {
+		t.Error("expected lite filesystem not to describe the naming feature")
+	}
+}
+
+func TestDNSLink(t *testing.T) {
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fs, err := NewFilesystem(ctx, map[string]interface{}{"path": path, "lite": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := fs.(*Filestore).drv.Add(ctx, files.NewMapDirectory(map[string]files.Node{
+		"data.json": files.NewBytesFile([]byte(`{"a":1}`)),
+	}), addOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := pathFromHash(id.String())
+
+	records := map[string][]string{
+		"_dnslink.example.com": {"v=spf1 -all", "dnslink=" + dir},
+		"alias.example.org":    {"dnslink=/ipns/example.com"},
+	}
+	prev := lookupTXT
+	lookupTXT = func(ctx context.Context, host string) ([]string, error) {
+		if r, ok := records[host]; ok {
+			return r, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	defer func() { lookupTXT = prev }()
+
+	for _, p := range []string{"/ipns/example.com/data.json", "/ipns/alias.example.org/data.json"} {
+		f, err := fs.Get(ctx, p)
+		if err != nil {
+			t.Fatalf("getting %q: %s", p, err)
+		}
+		data, err := ioutil.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != `{"a":1}` {
+			t.Errorf("%q: unexpected content %q", p, data)
+		}
+		if want := dir + "/data.json"; f.FullPath() != want {
+			t.Errorf("expected file at resolved path %q, got %q", want, f.FullPath())
+		}
+	}
+
+	entries, err := qfs.ReadDir(ctx, fs, "/ipns/example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name != "data.json" {
+		t.Errorf("unexpected listing: %#v", entries)
+	}
+
+	if _, err := fs.Get(ctx, "/ipns/missing.example.com"); !errors.Is(err, qfs.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a domain without dnslink, got: %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package qipfs
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qri-io/qfs"
+)
+
+// Kubo wire compatibility tests run the filestore's HTTP backend against
+// real daemons to catch API drift (pin ls output, CID defaults) before users
+// do. They're opt-in & need docker:
+//
+//	QFS_KUBO_VERSIONS=v0.9.1,v0.12.2 go test ./qipfs -run TestKuboCompat
+//
+// QFS_KUBO_IMAGE overrides the docker image, which defaults to ipfs/go-ipfs.
+// Releases after v0.12 are published as ipfs/kubo
+const (
+	kuboVersionsEnv = "QFS_KUBO_VERSIONS"
+	kuboImageEnv    = "QFS_KUBO_IMAGE"
+	defaultKuboImg  = "ipfs/go-ipfs"
+)
+
+func TestKuboCompat(t *testing.T) {
+	versions := os.Getenv(kuboVersionsEnv)
+	if versions == "" {
+		t.Skipf("set %s to run kubo compatibility tests", kuboVersionsEnv)
+	}
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Fatalf("kubo compatibility tests require docker: %s", err)
+	}
+	image := os.Getenv(kuboImageEnv)
+	if image == "" {
+		image = defaultKuboImg
+	}
+
+	expect := localWireResults(t)
+	for _, v := range strings.Split(versions, ",") {
+		v = strings.TrimSpace(v)
+		t.Run(v, func(t *testing.T) {
+			url := startKubo(t, fmt.Sprintf("%s:%s", image, v))
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			f, err := NewFilesystem(ctx, map[string]interface{}{"url": url})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := runWireChecks(ctx, t, f.(*Filestore))
+			if got != expect {
+				t.Errorf("%s added content with a different CID. want: %q got: %q", v, expect, got)
+			}
+		})
+	}
+}
+
+// localWireResults runs the wire checks against an in-process node, giving
+// the CIDs every daemon version is expected to produce
+func localWireResults(t *testing.T) string {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	f, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runWireChecks(ctx, t, f.(*Filestore))
+}
+
+// runWireChecks exercises every filestore method that round-trips through
+// the IPFS API, returning the path of the content it added
+func runWireChecks(ctx context.Context, t *testing.T, fst *Filestore) string {
+	t.Helper()
+	data := []byte("kubo wire compatibility")
+
+	path, err := fst.Put(ctx, qfs.NewMemfileBytes("/ipfs/compat.txt", data))
+	if err != nil {
+		t.Fatalf("put: %s", err)
+	}
+
+	f, err := fst.Get(ctx, path)
+	if err != nil {
+		t.Fatalf("get: %s", err)
+	}
+	got, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatalf("reading file: %s", err)
+	}
+	if string(got) != string(data) {
+		t.Errorf("get data mismatch. want: %q got: %q", data, got)
+	}
+
+	if err := fst.Pin(ctx, path, true); err != nil {
+		t.Fatalf("pin: %s", err)
+	}
+	m, err := fst.PinManifest(ctx, 1)
+	if err != nil {
+		t.Fatalf("listing pins: %s", err)
+	}
+	found := false
+	for _, p := range m.Pins {
+		if p == path {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected %q in recursive pins. got: %v", path, m.Pins)
+	}
+
+	if err := fst.Delete(ctx, path); err != nil {
+		t.Errorf("delete: %s", err)
+	}
+	return path
+}
+
+// startKubo runs a daemon container, returning its API url. The container is
+// removed when the test ends
+func startKubo(t *testing.T, image string) string {
+	t.Helper()
+	out, err := exec.Command("docker", "run", "-d", "--rm", "-p", "127.0.0.1::5001", image).Output()
+	if err != nil {
+		t.Fatalf("starting %s: %s", image, err)
+	}
+	id := strings.TrimSpace(string(out))
+	t.Cleanup(func() {
+		exec.Command("docker", "rm", "-f", id).Run()
+	})
+
+	out, err = exec.Command("docker", "port", id, "5001/tcp").Output()
+	if err != nil {
+		t.Fatalf("reading api port of %s: %s", image, err)
+	}
+	addr := strings.TrimSpace(strings.Split(string(out), "\n")[0])
+	url := fmt.Sprintf("http://%s/api/v0", addr)
+
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		res, err := http.Post(url+"/version", "", nil)
+		if err == nil {
+			res.Body.Close()
+			if res.StatusCode == http.StatusOK {
+				return url
+			}
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	t.Fatalf("%s api didn't come up within 30s", image)
+	return ""
+}
@@ -0,0 +1,310 @@
+package qipfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/qri-io/qfs"
+)
+
+// Node lifecycle states reported by Stats
+const (
+	// StateNotStarted indicates a lazy filestore hasn't constructed its node
+	StateNotStarted = "not yet started"
+	// StateOffline indicates the node is running without network access
+	StateOffline = "offline"
+	// StateOnline indicates the node is connected to the network
+	StateOnline = "online"
+)
+
+// Stats describes the state of a filestore
+type Stats struct {
+	// State is one of StateNotStarted, StateOffline, or StateOnline
+	State string
+	// Lazy is true when node construction is deferred until first use
+	Lazy bool
+	// StartupDuration is the time a lazy filestore took to construct its node
+	StartupDuration time.Duration
+}
+
+// Stats reports the filestore's current state
+func (fst *Filestore) Stats() Stats {
+	st := Stats{State: StateOffline}
+	if ld, ok := fst.drv.(*lazyDriver); ok {
+		st.Lazy = true
+		st.StartupDuration = ld.startupDuration()
+		if !ld.started() {
+			st.State = StateNotStarted
+			return st
+		}
+	}
+	if fst.Online() {
+		st.State = StateOnline
+	}
+	return st
+}
+
+// Warmup constructs the IPFS node of a lazy filestore without waiting for
+// the first operation. Warmup is a no-op on filestores that aren't lazy or
+// have already started
+func (fst *Filestore) Warmup(ctx context.Context) error {
+	ld, ok := fst.drv.(*lazyDriver)
+	if !ok {
+		return nil
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := ld.load()
+		errCh <- err
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// lazyDriver defers constructing a driver until the first operation that
+// needs one
+type lazyDriver struct {
+	build func() (driver, error)
+
+	lk      sync.Mutex
+	drv     driver
+	err     error
+	startup time.Duration
+}
+
+var _ driver = (*lazyDriver)(nil)
+
+func newLazyDriver(build func() (driver, error)) *lazyDriver {
+	return &lazyDriver{build: build}
+}
+
+func (d *lazyDriver) load() (driver, error) {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	if d.drv != nil || d.err != nil {
+		return d.drv, d.err
+	}
+
+	log.Debug("constructing lazy ipfs node")
+	start := time.Now()
+	d.drv, d.err = d.build()
+	d.startup = time.Since(start)
+	return d.drv, d.err
+}
+
+// stop prevents a driver that hasn't started from ever starting, reporting
+// true if the driver was never constructed
+func (d *lazyDriver) stop() bool {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	if d.drv != nil {
+		return false
+	}
+	if d.err == nil {
+		d.err = errLazyClosed
+	}
+	return true
+}
+
+var errLazyClosed = errors.New("ipfs filesystem closed before node started")
+
+func (d *lazyDriver) started() bool {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	return d.drv != nil
+}
+
+func (d *lazyDriver) startupDuration() time.Duration {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	return d.startup
+}
+
+func (d *lazyDriver) Add(ctx context.Context, f files.Node, opts addOptions) (cid.Cid, error) {
+	drv, err := d.load()
+	if err != nil {
+		return cid.Cid{}, err
+	}
+	return drv.Add(ctx, f, opts)
+}
+
+func (d *lazyDriver) Get(ctx context.Context, path string) (files.Node, error) {
+	drv, err := d.load()
+	if err != nil {
+		return nil, err
+	}
+	return drv.Get(ctx, path)
+}
+
+func (d *lazyDriver) Ls(ctx context.Context, path string) ([]qfs.DirEntry, error) {
+	drv, err := d.load()
+	if err != nil {
+		return nil, err
+	}
+	return drv.Ls(ctx, path)
+}
+
+func (d *lazyDriver) DagGet(ctx context.Context, id cid.Cid) (format.Node, error) {
+	drv, err := d.load()
+	if err != nil {
+		return nil, err
+	}
+	return drv.DagGet(ctx, id)
+}
+
+func (d *lazyDriver) DagResolve(ctx context.Context, path string) (format.Node, error) {
+	drv, err := d.load()
+	if err != nil {
+		return nil, err
+	}
+	return drv.DagResolve(ctx, path)
+}
+
+func (d *lazyDriver) Refs(ctx context.Context, root cid.Cid) ([]cid.Cid, error) {
+	drv, err := d.load()
+	if err != nil {
+		return nil, err
+	}
+	return drv.Refs(ctx, root)
+}
+
+func (d *lazyDriver) DagPut(ctx context.Context, nd format.Node) error {
+	drv, err := d.load()
+	if err != nil {
+		return err
+	}
+	return drv.DagPut(ctx, nd)
+}
+
+func (d *lazyDriver) BlockGet(ctx context.Context, id cid.Cid) (io.Reader, error) {
+	drv, err := d.load()
+	if err != nil {
+		return nil, err
+	}
+	return drv.BlockGet(ctx, id)
+}
+
+func (d *lazyDriver) BlockPut(ctx context.Context, data []byte, format string) (cid.Cid, error) {
+	drv, err := d.load()
+	if err != nil {
+		return cid.Cid{}, err
+	}
+	return drv.BlockPut(ctx, data, format)
+}
+
+func (d *lazyDriver) BlockHas(ctx context.Context, id cid.Cid) (bool, error) {
+	drv, err := d.load()
+	if err != nil {
+		return false, err
+	}
+	return drv.BlockHas(ctx, id)
+}
+
+func (d *lazyDriver) Pin(ctx context.Context, path string, recursive bool) error {
+	drv, err := d.load()
+	if err != nil {
+		return err
+	}
+	return drv.Pin(ctx, path, recursive)
+}
+
+func (d *lazyDriver) Unpin(ctx context.Context, path string, recursive bool) error {
+	drv, err := d.load()
+	if err != nil {
+		return err
+	}
+	return drv.Unpin(ctx, path, recursive)
+}
+
+func (d *lazyDriver) Pins(ctx context.Context, pinType string) (<-chan pinInfo, error) {
+	drv, err := d.load()
+	if err != nil {
+		return nil, err
+	}
+	return drv.Pins(ctx, pinType)
+}
+
+func (d *lazyDriver) IsPinned(ctx context.Context, path string) (bool, error) {
+	drv, err := d.load()
+	if err != nil {
+		return false, err
+	}
+	return drv.IsPinned(ctx, path)
+}
+
+func (d *lazyDriver) Peers(ctx context.Context) ([]qfs.PeerInfo, error) {
+	drv, err := d.load()
+	if err != nil {
+		return nil, err
+	}
+	return drv.Peers(ctx)
+}
+
+func (d *lazyDriver) Connect(ctx context.Context, addr string) error {
+	drv, err := d.load()
+	if err != nil {
+		return err
+	}
+	return drv.Connect(ctx, addr)
+}
+
+func (d *lazyDriver) Disconnect(ctx context.Context, addr string) error {
+	drv, err := d.load()
+	if err != nil {
+		return err
+	}
+	return drv.Disconnect(ctx, addr)
+}
+
+func (d *lazyDriver) Publish(ctx context.Context, topic string, data []byte) error {
+	drv, err := d.load()
+	if err != nil {
+		return err
+	}
+	return drv.Publish(ctx, topic, data)
+}
+
+func (d *lazyDriver) Subscribe(ctx context.Context, topic string) (<-chan pubsubMessage, error) {
+	drv, err := d.load()
+	if err != nil {
+		return nil, err
+	}
+	return drv.Subscribe(ctx, topic)
+}
+
+func (d *lazyDriver) NamePublish(ctx context.Context, path, key string) (string, error) {
+	drv, err := d.load()
+	if err != nil {
+		return "", err
+	}
+	return drv.NamePublish(ctx, path, key)
+}
+
+func (d *lazyDriver) NameResolve(ctx context.Context, name string) (cid.Cid, error) {
+	drv, err := d.load()
+	if err != nil {
+		return cid.Cid{}, err
+	}
+	return drv.NameResolve(ctx, name)
+}
+
+// loadDriver returns the driver behind a lazy driver, constructing the node
+// if it hasn't started. Other drivers are returned as-is
+func (fst *Filestore) loadDriver() (driver, error) {
+	if ld, ok := fst.drv.(*lazyDriver); ok {
+		return ld.load()
+	}
+	return fst.drv, nil
+}
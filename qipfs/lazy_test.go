@@ -0,0 +1,62 @@
+package qipfs
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/qri-io/qfs"
+)
+
+func TestLazyFS(t *testing.T) {
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f, err := NewFilesystem(ctx, map[string]interface{}{
+		"path": path,
+		"lazy": true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst := f.(*Filestore)
+
+	if st := fst.Stats(); st.State != StateNotStarted || !st.Lazy {
+		t.Errorf("expected lazy filestore to be not started. got: %#v", st)
+	}
+	if fst.Online() {
+		t.Errorf("expected unstarted filestore to report offline")
+	}
+
+	if _, err := f.Put(ctx, qfs.NewMemfileBytes("/ipfs/a.txt", []byte("lazy"))); err != nil {
+		t.Fatal(err)
+	}
+	if st := fst.Stats(); st.State != StateOffline || st.StartupDuration == 0 {
+		t.Errorf("expected started offline filestore. got: %#v", st)
+	}
+	cancel()
+	<-fst.Done()
+
+	// a lazy filestore that never starts must still release the repo lock
+	ctx, cancel = context.WithCancel(context.Background())
+	f, err = NewFilesystem(ctx, map[string]interface{}{
+		"path": path,
+		"lazy": true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	<-f.(*Filestore).Done()
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	f, err = NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatalf("expected repo to be unlocked after closing unstarted lazy filestore: %s", err)
+	}
+	if err := f.(*Filestore).Warmup(ctx); err != nil {
+		t.Errorf("expected warmup on a non-lazy filestore to be a no-op. got: %s", err)
+	}
+}
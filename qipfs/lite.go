@@ -0,0 +1,476 @@
+package qipfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	bitswap "github.com/ipfs/go-bitswap"
+	bsnet "github.com/ipfs/go-bitswap/network"
+	blocks "github.com/ipfs/go-block-format"
+	bserv "github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	chunker "github.com/ipfs/go-ipfs-chunker"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	files "github.com/ipfs/go-ipfs-files"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	"github.com/ipfs/go-ipfs-pinner/dspinner"
+	ipfsrepo "github.com/ipfs/go-ipfs/repo"
+	format "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
+	ipfspath "github.com/ipfs/go-path"
+	"github.com/ipfs/go-path/resolver"
+	unixfs "github.com/ipfs/go-unixfs"
+	unixfile "github.com/ipfs/go-unixfs/file"
+	"github.com/ipfs/go-unixfs/importer/balanced"
+	"github.com/ipfs/go-unixfs/importer/helpers"
+	uio "github.com/ipfs/go-unixfs/io"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/host"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multihash"
+	"github.com/qri-io/qfs"
+)
+
+// ErrLiteUnsupported is returned by lite filesystems for operations that
+// require a full IPFS node
+var ErrLiteUnsupported = fmt.Errorf("%w by a lite ipfs filesystem", qfs.ErrUnsupported)
+
+// liteDriver implements driver with only a blockstore, pinner, and (when
+// online) bitswap over a DHT client. It skips the gateway, API server, MFS,
+// and the rest of the full node, making construction much cheaper for
+// contexts that only add, get, and pin
+type liteDriver struct {
+	repo   ipfsrepo.Repo
+	bstore blockstore.Blockstore
+	bserv  bserv.BlockService
+	dag    format.DAGService
+	pinner pin.Pinner
+	res    *resolver.Resolver
+
+	// host & dht are nil when offline
+	host host.Host
+	dht  *dht.IpfsDHT
+}
+
+var _ driver = (*liteDriver)(nil)
+
+func newLiteDriver(ctx context.Context, repo ipfsrepo.Repo, online bool) (*liteDriver, error) {
+	d := &liteDriver{
+		repo:   repo,
+		bstore: blockstore.NewBlockstore(repo.Datastore()),
+	}
+
+	if online {
+		if err := d.goOnline(ctx); err != nil {
+			return nil, err
+		}
+		d.bserv = bserv.New(d.bstore, bitswap.New(ctx, bsnet.NewFromIpfsHost(d.host, d.dht), d.bstore))
+	} else {
+		d.bserv = bserv.New(d.bstore, offline.Exchange(d.bstore))
+	}
+
+	d.dag = merkledag.NewDAGService(d.bserv)
+	d.res = &resolver.Resolver{DAG: d.dag, ResolveOnce: uio.ResolveUnixfsOnce}
+
+	var err error
+	if d.pinner, err = dspinner.New(ctx, repo.Datastore(), d.dag); err != nil {
+		return nil, fmt.Errorf("creating pinner: %w", err)
+	}
+	return d, nil
+}
+
+// goOnline creates a libp2p host with a client-only DHT, using the identity,
+// listening addresses & bootstrap peers from the repo configuration
+func (d *liteDriver) goOnline(ctx context.Context) error {
+	cfg, err := d.repo.Config()
+	if err != nil {
+		return err
+	}
+	sk, err := cfg.Identity.DecodePrivateKey("")
+	if err != nil {
+		return err
+	}
+
+	if d.host, err = libp2p.New(ctx,
+		libp2p.Identity(sk),
+		libp2p.ListenAddrStrings(cfg.Addresses.Swarm...),
+	); err != nil {
+		return fmt.Errorf("creating libp2p host: %w", err)
+	}
+
+	bootstrap, err := cfg.BootstrapPeers()
+	if err != nil {
+		return err
+	}
+	if d.dht, err = dht.New(ctx, d.host,
+		dht.Mode(dht.ModeClient),
+		dht.BootstrapPeers(bootstrap...),
+	); err != nil {
+		return fmt.Errorf("creating dht client: %w", err)
+	}
+	return d.dht.Bootstrap(ctx)
+}
+
+// Close releases all resources held by the driver, including the repo
+func (d *liteDriver) Close() error {
+	if d.dht != nil {
+		d.dht.Close()
+	}
+	if d.host != nil {
+		d.host.Close()
+	}
+	if err := d.bserv.Close(); err != nil {
+		log.Debugw("closing blockservice", "err", err)
+	}
+	return d.repo.Close()
+}
+
+func (d *liteDriver) Add(ctx context.Context, f files.Node, opts addOptions) (cid.Cid, error) {
+	prefix, err := opts.prefix()
+	if err != nil {
+		return cid.Cid{}, err
+	}
+
+	nd, err := addNode(ctx, d.dag, f, prefix, opts)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+
+	if opts.Pin {
+		if err := d.pinner.Pin(ctx, nd, true); err != nil {
+			return cid.Cid{}, err
+		}
+		if err := d.pinner.Flush(ctx); err != nil {
+			return cid.Cid{}, err
+		}
+	}
+	return nd.Cid(), nil
+}
+
+// prefix returns the CID builder for blocks added with these options
+func (opts addOptions) prefix() (cid.Builder, error) {
+	prefix, err := merkledag.PrefixForCidVersion(opts.CidVersion)
+	if err != nil {
+		return nil, err
+	}
+	prefix.MhType = opts.MhType
+	if opts.MhType == 0 {
+		prefix.MhType = multihash.SHA2_256
+	}
+	return prefix, nil
+}
+
+// addNode imports a file or directory into dag as unixfs, building the same
+// DAG go-ipfs does for the same options
+func addNode(ctx context.Context, dag format.DAGService, f files.Node, prefix cid.Builder, opts addOptions) (format.Node, error) {
+	switch f := f.(type) {
+	case files.Directory:
+		dir := uio.NewDirectory(dag)
+		dir.SetCidBuilder(prefix)
+
+		it := f.Entries()
+		for it.Next() {
+			ch, err := addNode(ctx, dag, it.Node(), prefix, opts)
+			if err != nil {
+				return nil, err
+			}
+			if err := dir.AddChild(ctx, it.Name(), ch); err != nil {
+				return nil, err
+			}
+		}
+		if it.Err() != nil {
+			return nil, it.Err()
+		}
+
+		nd, err := dir.GetNode()
+		if err != nil {
+			return nil, err
+		}
+		return nd, dag.Add(ctx, nd)
+	case files.File:
+		params := helpers.DagBuilderParams{
+			Maxlinks:   helpers.DefaultLinksPerBlock,
+			CidBuilder: prefix,
+			RawLeaves:  opts.RawLeaves,
+			Dagserv:    dag,
+		}
+		spl, err := chunker.FromString(f, opts.Chunker)
+		if err != nil {
+			return nil, err
+		}
+		db, err := params.New(spl)
+		if err != nil {
+			return nil, err
+		}
+		return balanced.Layout(db)
+	default:
+		return nil, fmt.Errorf("unsupported file type %T", f)
+	}
+}
+
+func (d *liteDriver) resolve(ctx context.Context, path string) (format.Node, error) {
+	p, err := ipfspath.ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	return d.res.ResolvePath(ctx, p)
+}
+
+func (d *liteDriver) Get(ctx context.Context, path string) (files.Node, error) {
+	nd, err := d.resolve(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := unixfile.NewUnixfsFile(ctx, d.dag, nd)
+	if err != nil {
+		return nil, err
+	}
+	return withNodeModTime(f, nd), nil
+}
+
+func (d *liteDriver) Ls(ctx context.Context, path string) ([]qfs.DirEntry, error) {
+	nd, err := d.resolve(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := uio.NewDirectoryFromNode(d.dag, nd)
+	if errors.Is(err, uio.ErrNotADir) {
+		return nil, qfs.ErrNotDirectory
+	} else if err != nil {
+		return nil, err
+	}
+	links, err := dir.Links(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]qfs.DirEntry, 0, len(links))
+	for _, l := range links {
+		e := qfs.DirEntry{Name: l.Name, Cid: l.Cid, Size: -1}
+		ch, err := d.dag.Get(ctx, l.Cid)
+		if err != nil {
+			return nil, err
+		}
+		switch ch := ch.(type) {
+		case *merkledag.RawNode:
+			e.Size = int64(len(ch.RawData()))
+		case *merkledag.ProtoNode:
+			fsn, err := unixfs.FSNodeFromBytes(ch.Data())
+			if err != nil {
+				return nil, err
+			}
+			if e.IsDir = isUnixfsDir(ch); !e.IsDir {
+				e.Size = int64(fsn.FileSize())
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (d *liteDriver) DagGet(ctx context.Context, id cid.Cid) (format.Node, error) {
+	return d.dag.Get(ctx, id)
+}
+
+func (d *liteDriver) DagPut(ctx context.Context, nd format.Node) error {
+	return d.dag.Add(ctx, nd)
+}
+
+func (d *liteDriver) DagResolve(ctx context.Context, path string) (format.Node, error) {
+	return d.resolve(ctx, path)
+}
+
+func (d *liteDriver) Refs(ctx context.Context, root cid.Cid) ([]cid.Cid, error) {
+	return walkRefs(ctx, d.dag, root)
+}
+
+func (d *liteDriver) BlockGet(ctx context.Context, id cid.Cid) (io.Reader, error) {
+	blk, err := d.bserv.GetBlock(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(blk.RawData()), nil
+}
+
+func (d *liteDriver) BlockPut(ctx context.Context, data []byte, codec string) (cid.Cid, error) {
+	var prefix cid.Prefix
+	switch codec {
+	case "raw":
+		prefix = cid.Prefix{Version: 1, Codec: cid.Raw, MhType: multihash.SHA2_256, MhLength: -1}
+	case "protobuf", "dag-pb", "v0":
+		prefix = merkledag.V0CidPrefix()
+	default:
+		return cid.Cid{}, fmt.Errorf("%w: block format %q", ErrLiteUnsupported, codec)
+	}
+
+	id, err := prefix.Sum(data)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+	blk, err := blocks.NewBlockWithCid(data, id)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+	return id, d.bserv.AddBlock(blk)
+}
+
+func (d *liteDriver) BlockHas(ctx context.Context, id cid.Cid) (bool, error) {
+	return d.bstore.Has(id)
+}
+
+func (d *liteDriver) Pin(ctx context.Context, path string, recursive bool) error {
+	nd, err := d.resolve(ctx, path)
+	if err != nil {
+		return err
+	}
+	if err := d.pinner.Pin(ctx, nd, recursive); err != nil {
+		return err
+	}
+	return d.pinner.Flush(ctx)
+}
+
+func (d *liteDriver) Unpin(ctx context.Context, path string, recursive bool) error {
+	nd, err := d.resolve(ctx, path)
+	if err != nil {
+		return err
+	}
+	if err := d.pinner.Unpin(ctx, nd.Cid(), recursive); err != nil {
+		return err
+	}
+	return d.pinner.Flush(ctx)
+}
+
+func (d *liteDriver) IsPinned(ctx context.Context, path string) (bool, error) {
+	nd, err := d.resolve(ctx, path)
+	if err != nil {
+		return false, err
+	}
+	reason, pinned, err := d.pinner.IsPinned(ctx, nd.Cid())
+	if err != nil {
+		return false, err
+	}
+	return pinned && explicitPin(reason), nil
+}
+
+func (d *liteDriver) Pins(ctx context.Context, pinType string) (<-chan pinInfo, error) {
+	var (
+		recursive, direct []cid.Cid
+		err               error
+	)
+	switch pinType {
+	case "recursive", "all":
+		if recursive, err = d.pinner.RecursiveKeys(ctx); err != nil {
+			return nil, err
+		}
+		if pinType == "recursive" {
+			break
+		}
+		fallthrough
+	case "direct":
+		if direct, err = d.pinner.DirectKeys(ctx); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: listing %q pins", ErrLiteUnsupported, pinType)
+	}
+
+	ch := make(chan pinInfo)
+	go func() {
+		defer close(ch)
+		send := func(ids []cid.Cid, t string) bool {
+			for _, id := range ids {
+				select {
+				case ch <- pinInfo{Cid: id, Type: t}:
+				case <-ctx.Done():
+					return false
+				}
+			}
+			return true
+		}
+		if send(recursive, "recursive") {
+			send(direct, "direct")
+		}
+	}()
+	return ch, nil
+}
+
+func (d *liteDriver) Peers(ctx context.Context) ([]qfs.PeerInfo, error) {
+	if d.host == nil {
+		return nil, errOffline
+	}
+	conns := d.host.Network().Conns()
+	peers := make([]qfs.PeerInfo, 0, len(conns))
+	for _, c := range conns {
+		peers = append(peers, qfs.PeerInfo{
+			ID:   c.RemotePeer().Pretty(),
+			Addr: c.RemoteMultiaddr().String(),
+		})
+	}
+	return peers, nil
+}
+
+func (d *liteDriver) Connect(ctx context.Context, addr string) error {
+	if d.host == nil {
+		return errOffline
+	}
+	pi, err := addrInfo(addr)
+	if err != nil {
+		return err
+	}
+	return d.host.Connect(ctx, *pi)
+}
+
+func (d *liteDriver) Disconnect(ctx context.Context, addr string) error {
+	if d.host == nil {
+		return errOffline
+	}
+	pi, err := addrInfo(addr)
+	if err != nil {
+		return err
+	}
+	return d.host.Network().ClosePeer(pi.ID)
+}
+
+func (d *liteDriver) Publish(ctx context.Context, topic string, data []byte) error {
+	return fmt.Errorf("%w: pubsub", ErrLiteUnsupported)
+}
+
+func (d *liteDriver) Subscribe(ctx context.Context, topic string) (<-chan pubsubMessage, error) {
+	return nil, fmt.Errorf("%w: pubsub", ErrLiteUnsupported)
+}
+
+func (d *liteDriver) NamePublish(ctx context.Context, path, key string) (string, error) {
+	return "", fmt.Errorf("%w: ipns", ErrLiteUnsupported)
+}
+
+// NameResolve only resolves DNSLink names, lite filesystems don't have the
+// routing needed to resolve IPNS keys
+func (d *liteDriver) NameResolve(ctx context.Context, name string) (cid.Cid, error) {
+	p, err := resolveDNSLink(ctx, name)
+	if errors.Is(err, errNotDomain) {
+		return cid.Cid{}, fmt.Errorf("%w: ipns keys", ErrLiteUnsupported)
+	} else if err != nil {
+		return cid.Cid{}, err
+	}
+	nd, err := d.resolve(ctx, p)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+	return nd.Cid(), nil
+}
+
+var errOffline = errors.New("ipfs filesystem is offline")
+
+func addrInfo(addr string) (*peer.AddrInfo, error) {
+	maddr, err := ma.NewMultiaddr(addr)
+	if err != nil {
+		return nil, fmt.Errorf("parsing multiaddr: %w", err)
+	}
+	return peer.AddrInfoFromP2pAddr(maddr)
+}
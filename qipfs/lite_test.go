@@ -0,0 +1,70 @@
+package qipfs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/qri-io/qfs"
+)
+
+func TestLiteFS(t *testing.T) {
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	data := []byte(`{"title":"lite"}`)
+
+	// add with a full node first to compare resulting hashes
+	fullCtx, closeFull := context.WithCancel(context.Background())
+	full, err := NewFilesystem(fullCtx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fullPath, err := full.Put(fullCtx, qfs.NewMemfileBytes("/ipfs/data.json", data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeFull()
+	<-full.(qfs.ReleasingFilesystem).Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lite, err := NewFilesystem(ctx, map[string]interface{}{
+		"path": path,
+		"lite": true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lite.(*Filestore).Online() {
+		t.Errorf("expected offline lite filesystem to report offline")
+	}
+
+	litePath, err := lite.Put(ctx, qfs.NewMemfileBytes("/ipfs/data.json", data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fullPath != litePath {
+		t.Errorf("lite & full node path mismatch. full: %q lite: %q", fullPath, litePath)
+	}
+
+	f, err := lite.Get(ctx, litePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(data) {
+		t.Errorf("data mismatch. want: %q got: %q", string(data), string(got))
+	}
+
+	if err := lite.(qfs.PinningFS).Pin(ctx, litePath, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := lite.Delete(ctx, litePath); err != nil {
+		t.Fatal(err)
+	}
+}
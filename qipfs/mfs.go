@@ -0,0 +1,322 @@
+package qipfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	gopath "path"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+	mfs "github.com/ipfs/go-mfs"
+	corepath "github.com/ipfs/interface-go-ipfs-core/path"
+	httpapi "github.com/qri-io/go-ipfs-http-client"
+	"github.com/qri-io/qfs"
+)
+
+var _ qfs.WritableFS = (*Filestore)(nil)
+
+// mfsDriver is implemented by drivers with access to the node's MFS (mutable
+// filesystem), the mutable namespace behind `ipfs files`. Lite nodes don't
+// have one
+type mfsDriver interface {
+	// filesCopy links the node at src, an /ipfs/ path or MFS path, into MFS
+	// at dst, creating dst's parent directories
+	filesCopy(ctx context.Context, src, dst string) error
+	// filesMove moves src to dst within MFS, creating dst's parent
+	// directories
+	filesMove(ctx context.Context, src, dst string) error
+	// filesRemove removes path & everything beneath it from MFS
+	filesRemove(ctx context.Context, path string) error
+	// filesStat returns the CID of the MFS entry at path
+	filesStat(ctx context.Context, path string) (cid.Cid, error)
+	// filesFlush persists changes beneath path, returning path's CID
+	filesFlush(ctx context.Context, path string) (cid.Cid, error)
+}
+
+// Copy links the file or directory at src into the node's MFS at dst. src is
+// an /ipfs/ path or an MFS path, dst is an MFS path like "/datasets/a.csv".
+// Parent directories of dst are created as needed. Copying only links
+// existing blocks, no content is read or re-added
+func (fst *Filestore) Copy(ctx context.Context, src, dst string) (err error) {
+	span, ctx := qfs.StartSpan(ctx, "copy", fst.Type(), src)
+	defer func() { span.Finish(0, err) }()
+
+	md, err := fst.mfsDriver()
+	if err != nil {
+		return err
+	}
+	if src, err = fst.resolveNamePath(ctx, src); err != nil {
+		return err
+	}
+	return typedError(md.filesCopy(ctx, src, dst))
+}
+
+// Rename moves src to dst within the node's MFS, creating dst's parent
+// directories. Both are MFS paths
+func (fst *Filestore) Rename(ctx context.Context, src, dst string) (err error) {
+	span, ctx := qfs.StartSpan(ctx, "rename", fst.Type(), src)
+	defer func() { span.Finish(0, err) }()
+
+	if isIPFSPath(src) || isIPFSPath(dst) {
+		return fmt.Errorf("%w: renaming immutable path %q", qfs.ErrReadOnly, src)
+	}
+	md, err := fst.mfsDriver()
+	if err != nil {
+		return err
+	}
+	return typedError(md.filesMove(ctx, src, dst))
+}
+
+// WriteMFS adds a file or directory & links it into the node's MFS at
+// mfsPath, replacing anything already there. Content is chunked & hashed
+// with the configured PutOptions. MFS content isn't pinned, the node keeps
+// it while it's linked into MFS
+func (fst *Filestore) WriteMFS(ctx context.Context, mfsPath string, file qfs.File) (err error) {
+	span, ctx := qfs.StartSpan(ctx, "writeMFS", fst.Type(), mfsPath)
+	defer func() { span.Finish(0, err) }()
+
+	md, err := fst.mfsDriver()
+	if err != nil {
+		return err
+	}
+	if err := checkMFSPath(mfsPath); err != nil {
+		return err
+	}
+
+	var key string
+	if file.IsDirectory() {
+		aopts, err := fst.putOptions().addOptions()
+		if err != nil {
+			return err
+		}
+		nd, err := filesNode(ctx, file)
+		if err != nil {
+			return err
+		}
+		id, err := fst.drv.Add(ctx, nd, aopts)
+		if err != nil {
+			return err
+		}
+		fst.filterAddDAG(ctx, id)
+		key = id.String()
+	} else if key, err = fst.addFile(ctx, file, fst.putOptions(), false); err != nil {
+		return err
+	}
+
+	if err := md.filesRemove(ctx, mfsPath); err != nil && !errors.Is(typedError(err), qfs.ErrNotFound) {
+		return typedError(err)
+	}
+	return typedError(md.filesCopy(ctx, pathFromHash(key), mfsPath))
+}
+
+// ReadMFS opens the file at mfsPath in the node's MFS. The returned file's
+// path is the /ipfs/ path of the content mfsPath currently links to
+func (fst *Filestore) ReadMFS(ctx context.Context, mfsPath string) (qfs.File, error) {
+	id, err := fst.statMFS(ctx, mfsPath)
+	if err != nil {
+		return nil, err
+	}
+	return fst.Get(ctx, pathFromHash(id.String()))
+}
+
+// LsMFS lists the directory at mfsPath in the node's MFS, sorted by name
+func (fst *Filestore) LsMFS(ctx context.Context, mfsPath string) ([]qfs.DirEntry, error) {
+	id, err := fst.statMFS(ctx, mfsPath)
+	if err != nil {
+		return nil, err
+	}
+	return fst.ReadDir(ctx, pathFromHash(id.String()))
+}
+
+// FlushMFS persists pending changes to the node's MFS, returning the CID of
+// the MFS root
+func (fst *Filestore) FlushMFS(ctx context.Context) (cid.Cid, error) {
+	md, err := fst.mfsDriver()
+	if err != nil {
+		return cid.Undef, err
+	}
+	id, err := md.filesFlush(ctx, "/")
+	return id, typedError(err)
+}
+
+func (fst *Filestore) statMFS(ctx context.Context, mfsPath string) (cid.Cid, error) {
+	md, err := fst.mfsDriver()
+	if err != nil {
+		return cid.Undef, err
+	}
+	if err := checkMFSPath(mfsPath); err != nil {
+		return cid.Undef, err
+	}
+	id, err := md.filesStat(ctx, mfsPath)
+	return id, typedError(err)
+}
+
+// checkMFSPath refuses paths that aren't MFS paths
+func checkMFSPath(p string) error {
+	if !strings.HasPrefix(p, "/") || isIPFSPath(p) {
+		return fmt.Errorf("invalid MFS path %q", p)
+	}
+	return nil
+}
+
+func (fst *Filestore) mfsDriver() (mfsDriver, error) {
+	drv, err := fst.loadDriver()
+	if err != nil {
+		return nil, err
+	}
+	md, ok := drv.(mfsDriver)
+	if !ok {
+		return nil, fmt.Errorf("%w: node has no MFS", qfs.ErrUnsupported)
+	}
+	return md, nil
+}
+
+func isIPFSPath(p string) bool {
+	return strings.HasPrefix(p, "/ipfs/") || strings.HasPrefix(p, "/ipns/")
+}
+
+func (d *nodeDriver) filesCopy(ctx context.Context, src, dst string) error {
+	nd, err := d.mfsNode(ctx, src)
+	if err != nil {
+		return err
+	}
+	if err := d.mkdirParents(dst); err != nil {
+		return err
+	}
+	if err := mfs.PutNode(d.node.FilesRoot, dst, nd); err != nil {
+		return err
+	}
+	_, err = mfs.FlushPath(ctx, d.node.FilesRoot, dst)
+	return err
+}
+
+// mfsNode resolves an /ipfs/ path or MFS path to a node
+func (d *nodeDriver) mfsNode(ctx context.Context, p string) (format.Node, error) {
+	if isIPFSPath(p) {
+		return d.capi.ResolveNode(ctx, corepath.New(p))
+	}
+	fsn, err := mfs.Lookup(d.node.FilesRoot, p)
+	if err != nil {
+		return nil, err
+	}
+	return fsn.GetNode()
+}
+
+// mkdirParents creates the parent directories of p
+func (d *nodeDriver) mkdirParents(p string) error {
+	dir := gopath.Dir(p)
+	if dir == "/" {
+		return nil
+	}
+	return mfs.Mkdir(d.node.FilesRoot, dir, mfs.MkdirOpts{Mkparents: true})
+}
+
+func (d *nodeDriver) filesMove(ctx context.Context, src, dst string) error {
+	if err := d.mkdirParents(dst); err != nil {
+		return err
+	}
+	if err := mfs.Mv(d.node.FilesRoot, src, dst); err != nil {
+		return err
+	}
+	_, err := mfs.FlushPath(ctx, d.node.FilesRoot, gopath.Dir(dst))
+	return err
+}
+
+func (d *nodeDriver) filesRemove(ctx context.Context, p string) error {
+	dir, name := gopath.Split(gopath.Clean(p))
+	if name == "" {
+		return fmt.Errorf("can't remove MFS root")
+	}
+	fsn, err := mfs.Lookup(d.node.FilesRoot, dir)
+	if err != nil {
+		return err
+	}
+	pdir, ok := fsn.(*mfs.Directory)
+	if !ok {
+		return fmt.Errorf("%s isn't a directory", dir)
+	}
+	if _, err := pdir.Child(name); err != nil {
+		return err
+	}
+	if err := pdir.Unlink(name); err != nil {
+		return err
+	}
+	return pdir.Flush()
+}
+
+func (d *nodeDriver) filesStat(ctx context.Context, p string) (cid.Cid, error) {
+	nd, err := d.mfsNode(ctx, p)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return nd.Cid(), nil
+}
+
+func (d *nodeDriver) filesFlush(ctx context.Context, p string) (cid.Cid, error) {
+	nd, err := mfs.FlushPath(ctx, d.node.FilesRoot, p)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return nd.Cid(), nil
+}
+
+func (d *httpDriver) filesCopy(ctx context.Context, src, dst string) error {
+	if err := d.mkdirParents(ctx, dst); err != nil {
+		return err
+	}
+	return d.exec(ctx, nil, "files/cp", src, dst)
+}
+
+func (d *httpDriver) filesMove(ctx context.Context, src, dst string) error {
+	if err := d.mkdirParents(ctx, dst); err != nil {
+		return err
+	}
+	return d.exec(ctx, nil, "files/mv", src, dst)
+}
+
+// mkdirParents creates the parent directories of p
+func (d *httpDriver) mkdirParents(ctx context.Context, p string) error {
+	dir := gopath.Dir(p)
+	if dir == "/" {
+		return nil
+	}
+	return d.exec(ctx, map[string]interface{}{"parents": true}, "files/mkdir", dir)
+}
+
+func (d *httpDriver) filesRemove(ctx context.Context, p string) error {
+	return d.exec(ctx, map[string]interface{}{"recursive": true}, "files/rm", p)
+}
+
+func (d *httpDriver) filesStat(ctx context.Context, p string) (cid.Cid, error) {
+	api, ok := d.capi.(*httpapi.HttpApi)
+	if !ok {
+		return cid.Undef, fmt.Errorf("http driver has unexpected api client %T", d.capi)
+	}
+	var out struct{ Hash string }
+	if err := api.Request("files/stat", p).Option("hash", true).Exec(ctx, &out); err != nil {
+		return cid.Undef, err
+	}
+	return cid.Decode(out.Hash)
+}
+
+func (d *httpDriver) filesFlush(ctx context.Context, p string) (cid.Cid, error) {
+	if err := d.exec(ctx, nil, "files/flush", p); err != nil {
+		return cid.Undef, err
+	}
+	return d.filesStat(ctx, p)
+}
+
+// exec sends an MFS command to the remote daemon
+func (d *httpDriver) exec(ctx context.Context, opts map[string]interface{}, cmd string, args ...string) error {
+	api, ok := d.capi.(*httpapi.HttpApi)
+	if !ok {
+		return fmt.Errorf("http driver has unexpected api client %T", d.capi)
+	}
+	req := api.Request(cmd, args...)
+	for k, v := range opts {
+		req = req.Option(k, v)
+	}
+	return req.Exec(ctx, nil)
+}
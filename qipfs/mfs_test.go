@@ -0,0 +1,151 @@
+package qipfs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/qri-io/qfs"
+)
+
+func TestCopyRename(t *testing.T) {
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fs, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst := fs.(*Filestore)
+
+	key, err := fst.Put(ctx, qfs.NewMemfileBytes("a.txt", []byte("alpha")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fst.Copy(ctx, key, "/data/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fst.Copy(ctx, "/data/a.txt", "/data/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fst.Rename(ctx, "/data/b.txt", "/moved/c.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	md, err := fst.mfsDriver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nd, err := md.(*nodeDriver).mfsNode(ctx, "/moved/c.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := fst.Get(ctx, pathFromHash(nd.Cid().String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadAll(f); string(data) != "alpha" {
+		t.Errorf("expected renamed copy to hold %q. got: %q", "alpha", data)
+	}
+	if pathFromHash(nd.Cid().String()) != key {
+		t.Errorf("expected copy to link the original content. want: %s got: %s", key, nd.Cid())
+	}
+	if _, err := md.(*nodeDriver).mfsNode(ctx, "/data/b.txt"); err == nil {
+		t.Error("expected renamed path to be removed")
+	}
+
+	if err := fst.Copy(ctx, "/data/missing", "/data/d.txt"); !errors.Is(err, qfs.ErrNotFound) {
+		t.Errorf("expected ErrNotFound copying a missing path. got: %v", err)
+	}
+	if err := fst.Rename(ctx, key, "/data/d.txt"); !errors.Is(err, qfs.ErrReadOnly) {
+		t.Errorf("expected ErrReadOnly renaming an /ipfs/ path. got: %v", err)
+	}
+
+	litePath := InitTestRepo(t)
+	defer os.RemoveAll(litePath)
+	lite, err := NewFilesystem(ctx, map[string]interface{}{"path": litePath, "lite": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lite.(*Filestore).Copy(ctx, key, "/data/a.txt"); !errors.Is(err, qfs.ErrUnsupported) {
+		t.Errorf("expected lite node copy to be unsupported. got: %v", err)
+	}
+}
+
+func TestMFS(t *testing.T) {
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fs, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst := fs.(*Filestore)
+
+	read := func(mfsPath string) string {
+		f, err := fst.ReadMFS(ctx, mfsPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		data, err := ioutil.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	if err := fst.WriteMFS(ctx, "/ds/body.csv", qfs.NewMemfileBytes("body.csv", []byte("a,b"))); err != nil {
+		t.Fatal(err)
+	}
+	if got := read("/ds/body.csv"); got != "a,b" {
+		t.Errorf("expected %q. got: %q", "a,b", got)
+	}
+	if err := fst.WriteMFS(ctx, "/ds/body.csv", qfs.NewMemfileBytes("body.csv", []byte("c,d"))); err != nil {
+		t.Fatal(err)
+	}
+	if got := read("/ds/body.csv"); got != "c,d" {
+		t.Errorf("expected write to replace the file. got: %q", got)
+	}
+
+	meta := qfs.NewMemdir("/meta", qfs.NewMemfileBytes("title.txt", []byte("title")))
+	if err := fst.WriteMFS(ctx, "/ds/meta", meta); err != nil {
+		t.Fatal(err)
+	}
+	if got := read("/ds/meta/title.txt"); got != "title" {
+		t.Errorf("expected %q. got: %q", "title", got)
+	}
+
+	entries, err := fst.LsMFS(ctx, "/ds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Name != "body.csv" || entries[0].Size != 3 || entries[1].Name != "meta" || !entries[1].IsDir {
+		t.Errorf("unexpected entries: %#v", entries)
+	}
+
+	root, err := fst.FlushMFS(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err = fst.ReadDir(ctx, pathFromHash(root.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name != "ds" {
+		t.Errorf("expected flushed root to hold the written tree. got: %#v", entries)
+	}
+
+	if _, err := fst.ReadMFS(ctx, "/ds/missing"); !errors.Is(err, qfs.ErrNotFound) {
+		t.Errorf("expected ErrNotFound reading a missing path. got: %v", err)
+	}
+	if err := fst.WriteMFS(ctx, "/ipfs/ds", qfs.NewMemfileBytes("a", nil)); err == nil {
+		t.Error("expected writing to an /ipfs/ path to fail")
+	}
+}
@@ -79,11 +79,7 @@ func InternalizeIPFSRepo(ipfsRepoPath, newRepoPath string) error {
 
 // Migrate runs an IPFS fsrepo migration
 func Migrate(ctx context.Context, ipfsDir string) error {
-	const httpUserAgent = "go-ipfs"
-
-	fetchDistPath := migrate.GetDistPathEnv(migrate.CurrentIpfsDist)
-	f := migrate.NewHttpFetcher(fetchDistPath, "", httpUserAgent, 0)
-	err := migrate.RunMigration(ctx, f, fsrepo.RepoVersion, ipfsDir, false)
+	_, err := MigrateWithOptions(ctx, ipfsDir, MigrateOptions{})
 	if err != nil {
 		fmt.Println("The migrations of fs-repo failed:")
 		fmt.Printf("  %s\n", err)
@@ -94,6 +90,110 @@ func Migrate(ctx context.Context, ipfsDir string) error {
 	return nil
 }
 
+// MigrationStep is a single fs-repo migration between adjacent repo versions
+type MigrationStep struct {
+	From int
+	To   int
+}
+
+// Name is the name of the fs-repo-migrations binary that runs the step
+func (s MigrationStep) Name() string {
+	return fmt.Sprintf("fs-repo-%d-to-%d", s.From, s.To)
+}
+
+// MigrationProgress reports a migration step starting or finishing
+type MigrationProgress struct {
+	Step MigrationStep
+	// Index is the position of Step in the migration, starting at 0
+	Index int
+	// Total is the number of steps in the migration
+	Total int
+	// Done is false as a step starts & true once it's finished
+	Done bool
+}
+
+// MigrateOptions configures a repo migration
+type MigrateOptions struct {
+	// DryRun plans the migration without fetching or running anything
+	DryRun bool
+	// Progress is called as each step starts & finishes
+	Progress func(MigrationProgress)
+	// Fetcher downloads migration binaries that aren't found on PATH.
+	// defaults to fetching from the IPFS_DIST_PATH environment variable, or
+	// the go-ipfs distribution site
+	Fetcher migrate.Fetcher
+}
+
+// PlanMigration lists the steps needed to migrate the repo at ipfsDir to the
+// repo version the embedded go-ipfs node expects. Repos that are already up
+// to date need no steps
+func PlanMigration(ipfsDir string) ([]MigrationStep, error) {
+	from, err := migrate.RepoVersion(ipfsDir)
+	if err != nil {
+		return nil, fmt.Errorf("reading repo version: %w", err)
+	}
+	to := fsrepo.RepoVersion
+	if from > to {
+		return nil, fmt.Errorf("repo version %d is newer than supported version %d", from, to)
+	}
+	steps := make([]MigrationStep, 0, to-from)
+	for v := from; v < to; v++ {
+		steps = append(steps, MigrationStep{From: v, To: v + 1})
+	}
+	return steps, nil
+}
+
+// MigrateWithOptions migrates the repo at ipfsDir one step at a time using
+// fs-repo-migrations binaries, returning the planned steps. Binaries found on
+// PATH are run as-is, others are downloaded. A failed step leaves the repo at
+// the version of the last step that succeeded
+func MigrateWithOptions(ctx context.Context, ipfsDir string, opts MigrateOptions) ([]MigrationStep, error) {
+	steps, err := PlanMigration(ipfsDir)
+	if err != nil || opts.DryRun {
+		return steps, err
+	}
+
+	f := opts.Fetcher
+	if f == nil {
+		const httpUserAgent = "go-ipfs"
+		fetchDistPath := migrate.GetDistPathEnv(migrate.CurrentIpfsDist)
+		f = migrate.NewHttpFetcher(fetchDistPath, "", httpUserAgent, 0)
+	}
+	report := func(p MigrationProgress) {
+		if opts.Progress != nil {
+			opts.Progress(p)
+		}
+	}
+
+	for i, step := range steps {
+		report(MigrationProgress{Step: step, Index: i, Total: len(steps)})
+		if err := migrate.RunMigration(ctx, f, step.To, ipfsDir, false); err != nil {
+			return steps, fmt.Errorf("running %s: %w", step.Name(), err)
+		}
+		report(MigrationProgress{Step: step, Index: i, Total: len(steps), Done: true})
+	}
+	return steps, nil
+}
+
+// autoMigrate migrates the configured repo if the config allows it
+func autoMigrate(ctx context.Context, cfg *StoreCfg) error {
+	if !cfg.AutoMigrate {
+		return ErrNeedMigration
+	}
+	steps, err := MigrateWithOptions(ctx, cfg.Path, MigrateOptions{
+		DryRun:   cfg.MigrationDryRun,
+		Progress: cfg.MigrationProgress,
+	})
+	if err != nil {
+		return err
+	}
+	if cfg.MigrationDryRun {
+		return fmt.Errorf("%w: dry run planned %d migrations", ErrNeedMigration, len(steps))
+	}
+	log.Infow("migrated repo", "path", cfg.Path, "version", fsrepo.RepoVersion)
+	return nil
+}
+
 func migrateToInternalIPFSConfig(repoReadPath, repoWritePath string) error {
 	cfg := map[string]interface{}{}
 	data, err := ioutil.ReadFile(filepath.Join(repoReadPath, configFilename))
@@ -0,0 +1,81 @@
+package qipfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
+	migrate "github.com/ipfs/go-ipfs/repo/fsrepo/migrations"
+)
+
+func TestAutoMigrate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake migration binaries are shell scripts")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+	from := fsrepo.RepoVersion - 1
+	if err := migrate.WriteRepoVersion(path, from); err != nil {
+		t.Fatal(err)
+	}
+
+	steps, err := PlanMigration(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectName := fmt.Sprintf("fs-repo-%d-to-%d", from, fsrepo.RepoVersion)
+	if len(steps) != 1 || steps[0].Name() != expectName {
+		t.Fatalf("expected a single step named %q, got %v", expectName, steps)
+	}
+
+	if _, err := NewFilesystem(ctx, map[string]interface{}{"path": path}); !errors.Is(err, ErrNeedMigration) {
+		t.Fatalf("expected ErrNeedMigration without auto migration, got: %v", err)
+	}
+
+	// a fake migration binary on PATH is used instead of downloading one
+	binDir, err := ioutil.TempDir("", "migration_bins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(binDir)
+	script := fmt.Sprintf("#!/bin/sh\nfor arg in \"$@\"; do\n  case \"$arg\" in -path=*) echo %d > \"${arg#-path=}/version\";; esac\ndone\n", fsrepo.RepoVersion)
+	if err := ioutil.WriteFile(filepath.Join(binDir, expectName), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	var progress []MigrationProgress
+	cfg := map[string]interface{}{
+		"path":              path,
+		"autoMigrate":       true,
+		"migrationDryRun":   true,
+		"migrationProgress": func(p MigrationProgress) { progress = append(progress, p) },
+	}
+	if _, err := NewFilesystem(ctx, cfg); !errors.Is(err, ErrNeedMigration) {
+		t.Fatalf("expected a dry run to return ErrNeedMigration, got: %v", err)
+	}
+	if v, _ := migrate.RepoVersion(path); v != from || len(progress) != 0 {
+		t.Fatalf("expected a dry run not to migrate. version: %d, progress: %v", v, progress)
+	}
+
+	cfg["migrationDryRun"] = false
+	if _, err := NewFilesystem(ctx, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := migrate.RepoVersion(path); v != fsrepo.RepoVersion {
+		t.Errorf("expected repo version %d after migrating, got %d", fsrepo.RepoVersion, v)
+	}
+	if len(progress) != 2 || progress[0].Done || !progress[1].Done || progress[1].Total != 1 {
+		t.Errorf("expected start & done progress for one step, got %v", progress)
+	}
+}
@@ -0,0 +1,253 @@
+package qipfs
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	format "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
+	unixfs "github.com/ipfs/go-unixfs"
+)
+
+// unixfs 1.5 stores modification times in field 8 of a node's unixfs data,
+// a UnixTime message of int64 seconds (field 1) & fixed32 nanoseconds
+// (field 2). The unixfs package this module builds on predates the field, so
+// it's encoded & decoded here. Older readers skip the field
+const (
+	mtimeField        = 8
+	mtimeSecondsField = 1
+	mtimeNanosField   = 2
+
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// withModTime returns the CID of a copy of the unixfs file at id that
+// records mtime, storing the copy's root node. Files with a raw root block
+// are wrapped in a unixfs file node, raw blocks have nowhere to store
+// metadata
+func withModTime(ctx context.Context, drv driver, id cid.Cid, mtime time.Time) (cid.Cid, error) {
+	nd, err := drv.DagGet(ctx, id)
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	var pn *merkledag.ProtoNode
+	switch n := nd.(type) {
+	case *merkledag.ProtoNode:
+		data, _, err := splitModTime(n.Data())
+		if err != nil {
+			return cid.Undef, err
+		}
+		pn = n.Copy().(*merkledag.ProtoNode)
+		pn.SetData(append(data, encodeModTime(mtime)...))
+		pn.SetCidBuilder(id.Prefix())
+	default:
+		if id.Type() != cid.Raw {
+			return cid.Undef, fmt.Errorf("can't record modification time of %s node", cid.CodecToStr[id.Type()])
+		}
+		fsn := unixfs.NewFSNode(unixfs.TFile)
+		fsn.AddBlockSize(uint64(len(nd.RawData())))
+		data, err := fsn.GetBytes()
+		if err != nil {
+			return cid.Undef, err
+		}
+		pn = merkledag.NodeWithData(append(data, encodeModTime(mtime)...))
+		if err := pn.AddRawLink("", &format.Link{Cid: id, Size: uint64(len(nd.RawData()))}); err != nil {
+			return cid.Undef, err
+		}
+		pre := id.Prefix()
+		pre.Codec = cid.DagProtobuf
+		pn.SetCidBuilder(pre)
+	}
+
+	if err := drv.DagPut(ctx, pn); err != nil {
+		return cid.Undef, err
+	}
+	return pn.Cid(), nil
+}
+
+// nodeModTime returns the modification time recorded in a unixfs node, zero
+// if the node doesn't record one
+func nodeModTime(nd format.Node) time.Time {
+	pn, ok := nd.(*merkledag.ProtoNode)
+	if !ok {
+		return time.Time{}
+	}
+	_, mtime, err := splitModTime(pn.Data())
+	if err != nil {
+		log.Debugf("decoding modification time of %s: %s", nd.Cid(), err)
+		return time.Time{}
+	}
+	return mtime
+}
+
+// modTimeFile is a unixfs file that reports the modification time recorded
+// in its root node. Drivers return files read from a root node they've
+// fetched as modTimeFiles, so reading the time doesn't fetch the root again
+type modTimeFile struct {
+	files.File
+	mtime *lazyModTime
+}
+
+// ModTime returns the modification time recorded in the file's root node
+func (f modTimeFile) ModTime() time.Time {
+	return f.mtime.get()
+}
+
+// lazyModTime resolves a modification time the first time it's read
+type lazyModTime struct {
+	once    sync.Once
+	resolve func() time.Time
+	mtime   time.Time
+}
+
+func (l *lazyModTime) get() time.Time {
+	l.once.Do(func() { l.mtime = l.resolve() })
+	return l.mtime
+}
+
+// withNodeModTime wraps a file read from nd with the modification time nd
+// records. Directories are returned as they are
+func withNodeModTime(f files.Node, nd format.Node) files.Node {
+	file, ok := f.(files.File)
+	if !ok {
+		return f
+	}
+	mtime := &lazyModTime{resolve: func() time.Time { return nodeModTime(nd) }}
+	return modTimeFile{File: file, mtime: mtime}
+}
+
+// withResolvedModTime wraps a file with the modification time recorded in
+// the root node at path, fetching the node only if the time is read
+func withResolvedModTime(ctx context.Context, drv driver, f files.Node, path string) files.Node {
+	file, ok := f.(files.File)
+	if !ok {
+		return f
+	}
+	mtime := &lazyModTime{resolve: func() time.Time {
+		nd, err := drv.DagResolve(ctx, path)
+		if err != nil {
+			log.Debugf("resolving modification time of %s: %s", path, err)
+			return time.Time{}
+		}
+		return nodeModTime(nd)
+	}}
+	return modTimeFile{File: file, mtime: mtime}
+}
+
+// encodeModTime encodes t as the mtime field of unixfs data
+func encodeModTime(t time.Time) []byte {
+	msg := appendTag(nil, mtimeSecondsField, wireVarint)
+	msg = appendUvarint(msg, uint64(t.Unix()))
+	if nsec := t.Nanosecond(); nsec != 0 {
+		msg = appendTag(msg, mtimeNanosField, wireFixed32)
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], uint32(nsec))
+		msg = append(msg, buf[:]...)
+	}
+	field := appendTag(nil, mtimeField, wireBytes)
+	field = appendUvarint(field, uint64(len(msg)))
+	return append(field, msg...)
+}
+
+// splitModTime separates the mtime field from the rest of serialized unixfs
+// data
+func splitModTime(data []byte) (rest []byte, mtime time.Time, err error) {
+	rest = make([]byte, 0, len(data))
+	for len(data) > 0 {
+		num, n, err := fieldLen(data)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		if num != mtimeField {
+			rest = append(rest, data[:n]...)
+			data = data[n:]
+			continue
+		}
+		tag, t := binary.Uvarint(data)
+		if tag&7 != wireBytes {
+			return nil, time.Time{}, fmt.Errorf("invalid mtime wire type %d", tag&7)
+		}
+		_, m := binary.Uvarint(data[t:])
+		if mtime, err = decodeUnixTime(data[t+m : n]); err != nil {
+			return nil, time.Time{}, err
+		}
+		data = data[n:]
+	}
+	return rest, mtime, nil
+}
+
+// decodeUnixTime decodes a UnixTime message
+func decodeUnixTime(msg []byte) (time.Time, error) {
+	var sec int64
+	var nsec uint32
+	for len(msg) > 0 {
+		num, n, err := fieldLen(msg)
+		if err != nil {
+			return time.Time{}, err
+		}
+		tag, m := binary.Uvarint(msg)
+		switch {
+		case num == mtimeSecondsField && tag&7 == wireVarint:
+			v, _ := binary.Uvarint(msg[m:])
+			sec = int64(v)
+		case num == mtimeNanosField && tag&7 == wireFixed32:
+			nsec = binary.LittleEndian.Uint32(msg[m:])
+		}
+		msg = msg[n:]
+	}
+	if nsec >= uint32(time.Second) {
+		return time.Time{}, fmt.Errorf("invalid mtime nanoseconds %d", nsec)
+	}
+	return time.Unix(sec, int64(nsec)), nil
+}
+
+// fieldLen returns the number of the protobuf field at the start of data &
+// the length of the field in bytes
+func fieldLen(data []byte) (num uint64, n int, err error) {
+	tag, n := binary.Uvarint(data)
+	if n <= 0 {
+		return 0, 0, fmt.Errorf("invalid field tag")
+	}
+	switch tag & 7 {
+	case wireVarint:
+		_, m := binary.Uvarint(data[n:])
+		if m <= 0 {
+			return 0, 0, fmt.Errorf("invalid varint")
+		}
+		n += m
+	case wireFixed64:
+		n += 8
+	case wireBytes:
+		l, m := binary.Uvarint(data[n:])
+		if m <= 0 {
+			return 0, 0, fmt.Errorf("invalid length")
+		}
+		n += m + int(l)
+	case wireFixed32:
+		n += 4
+	default:
+		return 0, 0, fmt.Errorf("unsupported wire type %d", tag&7)
+	}
+	if n > len(data) {
+		return 0, 0, fmt.Errorf("field %d overflows data", tag>>3)
+	}
+	return tag >> 3, n, nil
+}
+
+func appendTag(b []byte, num, wireType uint64) []byte {
+	return appendUvarint(b, num<<3|wireType)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
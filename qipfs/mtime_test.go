@@ -0,0 +1,139 @@
+package qipfs
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/qri-io/qfs"
+)
+
+func TestPreserveModTime(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	fs, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst := fs.(*Filestore)
+	drv := &resolveCountingDriver{driver: fst.drv}
+	fst.drv = drv
+
+	large := make([]byte, 600<<10)
+	rand.New(rand.NewSource(1)).Read(large)
+	mtime := time.Date(2019, 4, 1, 12, 30, 0, 500, time.UTC)
+
+	cases := []struct {
+		data []byte
+		opts PutOptions
+	}{
+		{[]byte("alpha"), PutOptions{}},
+		{[]byte("alpha"), PutOptions{CidVersion: 1, RawLeaves: true}},
+		{large, PutOptions{}},
+		{large, PutOptions{CidVersion: 1, RawLeaves: true}},
+	}
+	for i, c := range cases {
+		f := qfs.NewMemfileBytes("a.txt", c.data)
+		f.SetModTime(mtime)
+		plain, err := fst.PutWithOptions(ctx, f, c.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c.opts.PreserveModTime = true
+		f = qfs.NewMemfileBytes("a.txt", c.data)
+		f.SetModTime(mtime)
+		key, err := fst.PutWithOptions(ctx, f, c.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key == plain {
+			t.Errorf("case %d: expected recording a modification time to change the path", i)
+		}
+
+		drv.resolves = 0
+		got, err := fst.Get(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, c.data) {
+			t.Errorf("case %d: file content mismatch", i)
+		}
+		if !got.ModTime().Equal(mtime) {
+			t.Errorf("case %d: expected modification time %s. got: %s", i, mtime, got.ModTime())
+		}
+		if drv.resolves != 0 {
+			t.Errorf("case %d: expected the modification time to be read from the fetched root, got %d resolves", i, drv.resolves)
+		}
+
+		fi, err := fst.Stat(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Size() != int64(len(c.data)) || !fi.ModTime().Equal(mtime) {
+			t.Errorf("case %d: unexpected stat: size %d mod time %s", i, fi.Size(), fi.ModTime())
+		}
+		if err := fst.Unpin(ctx, key, true); err != nil {
+			t.Errorf("case %d: expected file to be pinned. got: %s", i, err)
+		}
+
+		got, err = fst.Get(ctx, plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.ModTime().IsZero() {
+			t.Errorf("case %d: expected no modification time. got: %s", i, got.ModTime())
+		}
+	}
+}
+
+// resolveCountingDriver counts DagResolve calls
+type resolveCountingDriver struct {
+	driver
+	resolves int
+}
+
+func (d *resolveCountingDriver) DagResolve(ctx context.Context, path string) (format.Node, error) {
+	d.resolves++
+	return d.driver.DagResolve(ctx, path)
+}
+
+func TestModTimeEncoding(t *testing.T) {
+	times := []time.Time{
+		time.Unix(0, 0),
+		time.Unix(1554121800, 0),
+		time.Unix(1554121800, 999999999),
+		time.Unix(-86400, 1),
+	}
+	prefix := []byte{0x08, 0x02, 0x18, 0x05}
+	for _, want := range times {
+		data := append(append([]byte{}, prefix...), encodeModTime(want)...)
+		rest, got, err := splitModTime(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(want) {
+			t.Errorf("expected %s. got: %s", want, got)
+		}
+		if !bytes.Equal(rest, prefix) {
+			t.Errorf("expected other fields to be kept. got: %x", rest)
+		}
+	}
+
+	if _, _, err := splitModTime([]byte{0x42, 0x05, 0x08}); err == nil {
+		t.Error("expected truncated data to fail")
+	}
+}
@@ -0,0 +1,113 @@
+package qipfs
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	bserv "github.com/ipfs/go-blockservice"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	merkledag "github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-path/resolver"
+	uio "github.com/ipfs/go-unixfs/io"
+	caopts "github.com/ipfs/interface-go-ipfs-core/options"
+	"github.com/qri-io/qfs"
+)
+
+// offlineDriver is implemented by drivers that can read without fetching
+// from the network. offline returns nil when the driver can't
+type offlineDriver interface {
+	offline() driver
+}
+
+// offline reads through the CoreAPI with the offline option. Over HTTP the
+// node behind the API answers from its own blockstore
+func (d *capiDriver) offline() driver {
+	api, err := d.capi.WithOptions(caopts.Api.Offline(true))
+	if err != nil {
+		log.Debugw("creating offline api", "err", err)
+		return nil
+	}
+	return &capiDriver{capi: api}
+}
+
+// offline reads every endpoint with the offline option
+func (d *splitDriver) offline() driver {
+	write, ok := d.httpDriver.capiDriver.offline().(*capiDriver)
+	if !ok {
+		return nil
+	}
+	off := &splitDriver{httpDriver: &httpDriver{capiDriver: *write}, now: d.now}
+	for _, ep := range d.reads {
+		drv, ok := ep.drv.capiDriver.offline().(*capiDriver)
+		if !ok {
+			return nil
+		}
+		off.reads = append(off.reads, &readEndpoint{url: ep.url, drv: &httpDriver{capiDriver: *drv}})
+	}
+	return off
+}
+
+// offline swaps bitswap for an exchange that only reads the blockstore
+func (d *liteDriver) offline() driver {
+	if d.host == nil {
+		return d
+	}
+	off := *d
+	off.bserv = bserv.New(d.bstore, offline.Exchange(d.bstore))
+	off.dag = merkledag.NewDAGService(off.bserv)
+	off.res = &resolver.Resolver{DAG: off.dag, ResolveOnce: uio.ResolveUnixfsOnce}
+	off.host, off.dht = nil, nil
+	return &off
+}
+
+func (d *lazyDriver) offline() driver {
+	drv, err := d.load()
+	if err != nil {
+		return nil
+	}
+	if od, ok := drv.(offlineDriver); ok {
+		return od.offline()
+	}
+	return nil
+}
+
+// offlineFlag returns the offline flag for a new filestore, set when cfg
+// starts the filestore offline
+func offlineFlag(cfg *StoreCfg) *int32 {
+	flag := new(int32)
+	if cfg != nil && cfg.Offline {
+		*flag = 1
+	}
+	return flag
+}
+
+// SetOffline toggles offline reads. While offline, Get only reads blocks
+// that are already stored locally, returning an error matching
+// qfs.ErrNotFound for content that would have to be fetched from the
+// network. Resolving /ipns/ names isn't affected
+func (fst *Filestore) SetOffline(offline bool) {
+	var v int32
+	if offline {
+		v = 1
+	}
+	atomic.StoreInt32(fst.offline, v)
+}
+
+// IsOffline reports whether Get is restricted to local blocks
+func (fst *Filestore) IsOffline() bool {
+	return atomic.LoadInt32(fst.offline) == 1
+}
+
+// readDriver returns the driver Get reads with, which never fetches from the
+// network while the filestore is offline
+func (fst *Filestore) readDriver() (driver, error) {
+	if !fst.IsOffline() {
+		return fst.drv, nil
+	}
+	if od, ok := fst.drv.(offlineDriver); ok {
+		if drv := od.offline(); drv != nil {
+			return drv, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: offline reads with ipfs driver %T", qfs.ErrUnsupported, fst.drv)
+}
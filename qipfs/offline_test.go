@@ -0,0 +1,64 @@
+package qipfs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/qri-io/qfs"
+)
+
+func TestOffline(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	f, err := NewFilesystem(ctx, map[string]interface{}{"path": path, "offline": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst := f.(*Filestore)
+	if !fst.IsOffline() {
+		t.Fatal("expected offline config to start the filestore offline")
+	}
+
+	key, err := fst.Put(ctx, qfs.NewMemfileBytes("local.txt", []byte("stored locally")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := fst.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "stored locally" {
+		t.Errorf("expected local content, got %q", data)
+	}
+
+	missing := pathFromHash(testBlockCid("never stored").String())
+	getCtx, cancelGet := context.WithTimeout(ctx, 5*time.Second)
+	defer cancelGet()
+	if _, err := fst.Get(getCtx, missing); !errors.Is(err, qfs.ErrNotFound) {
+		t.Errorf("expected missing content to return ErrNotFound while offline, got %v", err)
+	}
+
+	drv, err := fst.readDriver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if drv == fst.drv {
+		t.Error("expected offline reads to use an offline driver")
+	}
+	fst.SetOffline(false)
+	if drv, _ := fst.readDriver(); drv != fst.drv {
+		t.Error("expected online reads to use the filestore driver")
+	}
+}
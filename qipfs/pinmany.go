@@ -0,0 +1,93 @@
+package qipfs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/qri-io/qfs"
+)
+
+// PinMany recursively pins a set of paths or CIDs, mirroring each pin to any
+// configured remote pinning services. Pinning stops at the first error
+func (fst *Filestore) PinMany(ctx context.Context, cids []string) (err error) {
+	span, ctx := qfs.StartSpan(ctx, "pin-many", fst.Type(), "")
+	defer func() { span.Finish(0, err) }()
+
+	for _, c := range cids {
+		if err := fst.pin(ctx, c, "", true); err != nil {
+			return fmt.Errorf("pinning %s: %w", c, err)
+		}
+	}
+	return nil
+}
+
+// PinPending pins all content put with PinLater. Content that isn't pinned
+// because of an error stays queued for the next call
+func (fst *Filestore) PinPending(ctx context.Context) (err error) {
+	span, ctx := qfs.StartSpan(ctx, "pin-pending", fst.Type(), "")
+	defer func() { span.Finish(0, err) }()
+
+	pins := fst.pending.take()
+	for i, p := range pins {
+		if err := fst.pin(ctx, p.path, p.name, true); err != nil {
+			fst.pending.add(pins[i:]...)
+			return fmt.Errorf("pinning %s: %w", p.path, err)
+		}
+	}
+	return nil
+}
+
+// PendingPins lists the paths of content put with PinLater that hasn't been
+// pinned yet
+func (fst *Filestore) PendingPins() []string {
+	fst.pending.lk.Lock()
+	defer fst.pending.lk.Unlock()
+	paths := make([]string, len(fst.pending.pins))
+	for i, p := range fst.pending.pins {
+		paths[i] = p.path
+	}
+	return paths
+}
+
+// pendingPins is a queue of content waiting to be pinned
+type pendingPins struct {
+	lk   sync.Mutex
+	pins []pendingPin
+}
+
+type pendingPin struct {
+	path string
+	// name labels the pin on remote pinning services
+	name string
+}
+
+func (q *pendingPins) add(pins ...pendingPin) {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+	q.pins = append(q.pins, pins...)
+}
+
+// remove drops the most recently queued pin of path, reporting whether path
+// was queued. Each put queues its own pin, so pins queued by earlier puts of
+// the same content stay queued
+func (q *pendingPins) remove(path string) bool {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+	for i := len(q.pins) - 1; i >= 0; i-- {
+		if q.pins[i].path == path {
+			q.pins = append(q.pins[:i], q.pins[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// take empties the queue, returning its contents
+func (q *pendingPins) take() []pendingPin {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+	pins := q.pins
+	q.pins = nil
+	return pins
+}
@@ -0,0 +1,169 @@
+package qipfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/qri-io/qfs"
+)
+
+// pinLabelPrefix is the repo datastore namespace pin labels are kept under
+var pinLabelPrefix = ds.NewKey("/qfs/pin-labels")
+
+// PinInfo is a pin held by the node
+type PinInfo struct {
+	Cid cid.Cid
+	// Type is "recursive" or "direct"
+	Type string
+	// Name is the label given with PinWithName, empty for unlabelled pins
+	Name string
+}
+
+// datastoreDriver is implemented by drivers with access to the repo's
+// datastore. Filestores backed by the HTTP API don't have one
+type datastoreDriver interface {
+	datastore() ds.Datastore
+}
+
+func (d *nodeDriver) datastore() ds.Datastore { return d.node.Repo.Datastore() }
+func (d *liteDriver) datastore() ds.Datastore { return d.repo.Datastore() }
+
+// PinWithName recursively pins a path under a human-readable label, like the
+// name of the dataset the path belongs to. Labels are kept in the repo
+// datastore & mirrored to any configured remote pinning services. Filestores
+// backed by the HTTP API only keep labels on remote pinning services
+func (fst *Filestore) PinWithName(ctx context.Context, path, name string) (err error) {
+	span, ctx := qfs.StartSpan(ctx, "pin-with-name", fst.Type(), path)
+	defer func() { span.Finish(0, err) }()
+
+	labels, err := fst.pinLabels()
+	if err != nil {
+		return err
+	}
+	if labels == nil && (fst.cfg == nil || len(fst.cfg.RemotePins) == 0) {
+		return fmt.Errorf("%w: pin names need a repo datastore or remote pinning service", qfs.ErrUnsupported)
+	}
+	if err := fst.pin(ctx, path, name, true); err != nil {
+		return typedError(err)
+	}
+	if labels == nil {
+		return nil
+	}
+	id, err := fst.pinCid(ctx, path)
+	if err != nil {
+		return err
+	}
+	return labels.Put(pinLabelPrefix.ChildString(id.String()), []byte(name))
+}
+
+// ListPins lists the node's recursive & direct pins with their labels.
+// Labels come from the repo datastore, or from configured remote pinning
+// services for filestores backed by the HTTP API
+func (fst *Filestore) ListPins(ctx context.Context) ([]PinInfo, error) {
+	labels, err := fst.pinLabels()
+	if err != nil {
+		return nil, err
+	}
+	var remote map[cid.Cid]string
+	if labels == nil {
+		if remote, err = fst.remotePinNames(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	pins := []PinInfo{}
+	for _, pinType := range []string{"recursive", "direct"} {
+		res, err := fst.drv.Pins(ctx, pinType)
+		if err != nil {
+			return nil, err
+		}
+		for p := range res {
+			if p.Err != nil {
+				return nil, p.Err
+			}
+			pi := PinInfo{Cid: p.Cid, Type: p.Type, Name: remote[p.Cid]}
+			if labels != nil {
+				name, err := labels.Get(pinLabelPrefix.ChildString(p.Cid.String()))
+				if err != nil && !errors.Is(err, ds.ErrNotFound) {
+					return nil, err
+				}
+				pi.Name = string(name)
+			}
+			pins = append(pins, pi)
+		}
+	}
+	return pins, nil
+}
+
+// unlabelPin drops the label of an unpinned path
+func (fst *Filestore) unlabelPin(ctx context.Context, path string) error {
+	labels, err := fst.pinLabels()
+	if err != nil || labels == nil {
+		return err
+	}
+	id, err := fst.pinCid(ctx, path)
+	if err != nil {
+		return err
+	}
+	if err := labels.Delete(pinLabelPrefix.ChildString(id.String())); err != nil && !errors.Is(err, ds.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// pinLabels returns the datastore pin labels are kept in, nil when the
+// driver has no repo datastore
+func (fst *Filestore) pinLabels() (ds.Datastore, error) {
+	drv, err := fst.loadDriver()
+	if err != nil {
+		return nil, err
+	}
+	if dd, ok := drv.(datastoreDriver); ok {
+		return dd.datastore(), nil
+	}
+	return nil, nil
+}
+
+// pinCid returns the CID a pinned path refers to
+func (fst *Filestore) pinCid(ctx context.Context, path string) (cid.Cid, error) {
+	if id, err := cid.Parse(path); err == nil {
+		return id, nil
+	}
+	nd, err := fst.drv.DagResolve(ctx, path)
+	if err != nil {
+		return cid.Undef, typedError(err)
+	}
+	return nd.Cid(), nil
+}
+
+// remotePinNames collects pin names from configured remote pinning services.
+// The first service to name a CID wins
+func (fst *Filestore) remotePinNames(ctx context.Context) (map[cid.Cid]string, error) {
+	names := map[cid.Cid]string{}
+	if fst.cfg == nil || len(fst.cfg.RemotePins) == 0 {
+		return names, nil
+	}
+	svcs, err := fst.RemotePinServices()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range svcs {
+		pins, err := s.List(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range pins {
+			id, err := cid.Parse(p.Pin.Cid)
+			if err != nil || p.Pin.Name == "" {
+				continue
+			}
+			if _, ok := names[id]; !ok {
+				names[id] = p.Pin.Name
+			}
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,64 @@
+package qipfs
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/qri-io/qfs"
+)
+
+func TestPinWithName(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	f, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst := f.(*Filestore)
+
+	key, err := fst.Put(ctx, qfs.NewMemfileBytes("a.txt", []byte("a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fst.Unpin(ctx, key, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := fst.PinWithName(ctx, key, "peer/dataset"); err != nil {
+		t.Fatal(err)
+	}
+
+	names := func() map[string]string {
+		pins, err := fst.ListPins(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]string{}
+		for _, p := range pins {
+			got[pathFromHash(p.Cid.String())] = p.Name
+		}
+		return got
+	}
+
+	got := names()
+	if got[key] != "peer/dataset" {
+		t.Errorf("expected pin to be labelled %q. got: %q", "peer/dataset", got[key])
+	}
+	if name, ok := got["/ipfs/QmQPeNsJPyVWPFDVHb77w8G42Fvo15z4bG2X8D2GhfbSXc"]; !ok || name != "" {
+		t.Errorf("expected unlabelled repo pin to be listed. got: %v", got)
+	}
+
+	if err := fst.Unpin(ctx, key, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := fst.Pin(ctx, key, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(); got[key] != "" {
+		t.Errorf("expected unpinning to drop the label. got: %q", got[key])
+	}
+}
@@ -0,0 +1,178 @@
+package qipfs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	corepath "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+// PinDiff is a pin held by only one side of a reconciliation between a
+// pinset & a set of paths
+type PinDiff struct {
+	Cid cid.Cid
+	// Type is "recursive" or "direct" for pins held by the node, & the request
+	// status for pins held by a remote pinning service. Pins missing from the
+	// pinset have no type
+	Type string
+	// Name is the name a remote pinning service holds the pin under
+	Name string
+	// Missing is true for paths in the set the pinset doesn't hold, & false
+	// for pins the set doesn't list
+	Missing bool
+}
+
+// Path returns the pin's path in the "/ipld/<cid>" form PinsetDifference uses
+func (d PinDiff) Path() string {
+	return corepath.IpldPath(d.Cid).String()
+}
+
+// PinsetDiff compares the node's recursive & direct pins with a set of
+// paths, sending the pins the set doesn't list, then a Missing diff for each
+// path in the set the node doesn't pin. Set keys are "/ipld/", "/ipfs/" or
+// bare CIDs
+func (fst *Filestore) PinsetDiff(ctx context.Context, set map[string]struct{}) (<-chan PinDiff, error) {
+	want, err := pinsetCids(set)
+	if err != nil {
+		return nil, err
+	}
+	recursive, err := fst.drv.Pins(ctx, "recursive")
+	if err != nil {
+		return nil, err
+	}
+	direct, err := fst.drv.Pins(ctx, "direct")
+	if err != nil {
+		return nil, err
+	}
+
+	resCh := make(chan PinDiff, 10)
+	go func() {
+		defer close(resCh)
+		seen := map[cid.Cid]struct{}{}
+		for _, pins := range []<-chan pinInfo{recursive, direct} {
+			for p := range pins {
+				if p.Err != nil {
+					log.Debug(p.Err)
+					continue
+				}
+				if !sendPinDiff(ctx, resCh, want, seen, PinDiff{Cid: p.Cid, Type: p.Type}) {
+					return
+				}
+			}
+		}
+		sendMissingPins(ctx, resCh, want, seen)
+	}()
+	return resCh, nil
+}
+
+// RemotePinsetDiff is PinsetDiff against the pins of a configured remote
+// pinning service. Queued, pinning & pinned requests count as pins, a CID
+// with several requests is compared once
+func (fst *Filestore) RemotePinsetDiff(ctx context.Context, service string, set map[string]struct{}) (<-chan PinDiff, error) {
+	want, err := pinsetCids(set)
+	if err != nil {
+		return nil, err
+	}
+	svc, err := fst.remotePinService(service)
+	if err != nil {
+		return nil, err
+	}
+	pins, err := svc.List(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resCh := make(chan PinDiff, 10)
+	go func() {
+		defer close(resCh)
+		seen := map[cid.Cid]struct{}{}
+		for _, p := range pins {
+			id, err := cid.Parse(p.Pin.Cid)
+			if err != nil {
+				log.Debugw("remote pin has invalid cid", "service", service, "cid", p.Pin.Cid, "err", err)
+				continue
+			}
+			if !sendPinDiff(ctx, resCh, want, seen, PinDiff{Cid: id, Type: p.Status, Name: p.Pin.Name}) {
+				return
+			}
+		}
+		sendMissingPins(ctx, resCh, want, seen)
+	}()
+	return resCh, nil
+}
+
+// sendPinDiff records a pin as seen, sending it if want doesn't list it.
+// It returns false once ctx is done
+func sendPinDiff(ctx context.Context, ch chan<- PinDiff, want, seen map[cid.Cid]struct{}, d PinDiff) bool {
+	if _, ok := seen[d.Cid]; ok {
+		return true
+	}
+	seen[d.Cid] = struct{}{}
+	if _, ok := want[d.Cid]; ok {
+		return true
+	}
+	select {
+	case ch <- d:
+		return true
+	case <-ctx.Done():
+		log.Debug(ctx.Err())
+		return false
+	}
+}
+
+// sendMissingPins sends a Missing diff for each CID in want that wasn't seen,
+// in CID order
+func sendMissingPins(ctx context.Context, ch chan<- PinDiff, want, seen map[cid.Cid]struct{}) {
+	var missing []cid.Cid
+	for id := range want {
+		if _, ok := seen[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i].String() < missing[j].String() })
+	for _, id := range missing {
+		select {
+		case ch <- PinDiff{Cid: id, Missing: true}:
+		case <-ctx.Done():
+			log.Debug(ctx.Err())
+			return
+		}
+	}
+}
+
+// pinsetCids parses the CIDs of a set of paths
+func pinsetCids(set map[string]struct{}) (map[cid.Cid]struct{}, error) {
+	ids := make(map[cid.Cid]struct{}, len(set))
+	for p := range set {
+		str := strings.TrimPrefix(strings.TrimPrefix(p, "/ipld/"), "/ipfs/")
+		id, err := cid.Parse(str)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pinset path %q: %w", p, err)
+		}
+		ids[id] = struct{}{}
+	}
+	return ids, nil
+}
+
+// diffPaths sends the paths of pins the set doesn't list, dropping pins
+// missing from the pinset. A non-empty pinType only keeps pins of that type
+func diffPaths(ctx context.Context, diffs <-chan PinDiff, pinType string) <-chan string {
+	resCh := make(chan string, 10)
+	go func() {
+		defer close(resCh)
+		for d := range diffs {
+			if d.Missing || (pinType != "" && d.Type != pinType) {
+				continue
+			}
+			select {
+			case resCh <- d.Path():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return resCh
+}
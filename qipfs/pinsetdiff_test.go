@@ -0,0 +1,68 @@
+package qipfs
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qri-io/qfs"
+)
+
+func TestPinsetDiff(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	f, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst := f.(*Filestore)
+
+	kept, err := fst.Put(ctx, qfs.NewMemfileBytes("a.txt", []byte("a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	direct, err := fst.Put(ctx, qfs.NewMemfileBytes("b.txt", []byte("b")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fst.Unpin(ctx, direct, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := fst.Pin(ctx, direct, false); err != nil {
+		t.Fatal(err)
+	}
+	missing := "/ipld/QmXoypizjW3WknFiJnKLwHCnL72vedxjQkDDP1mXWo6uco"
+
+	set := map[string]struct{}{kept: {}, missing: {}}
+	diffs, err := fst.PinsetDiff(ctx, set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for d := range diffs {
+		if d.Missing {
+			got[d.Path()] = "missing"
+		} else {
+			got[d.Path()] = d.Type
+		}
+	}
+	expect := map[string]string{
+		"/ipld/QmQPeNsJPyVWPFDVHb77w8G42Fvo15z4bG2X8D2GhfbSXc": "recursive",
+		strings.Replace(direct, "/ipfs/", "/ipld/", 1):         "direct",
+		missing: "missing",
+	}
+	if diff := cmp.Diff(expect, got); diff != "" {
+		t.Errorf("result mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := fst.PinsetDiff(ctx, map[string]struct{}{"/ipld/nope": {}}); err == nil {
+		t.Error("expected a set with an invalid path to fail")
+	}
+}
@@ -0,0 +1,79 @@
+package qipfs
+
+import (
+	"context"
+	"fmt"
+
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/qri-io/qfs"
+)
+
+var _ qfs.PutManyFS = (*Filestore)(nil)
+
+// PutMany adds a batch of files in a single add & pins them with a single
+// recursive pin. See PutBatch
+func (fst *Filestore) PutMany(ctx context.Context, fs []qfs.File) ([]qfs.PutResult, error) {
+	_, res, err := fst.PutBatch(ctx, fs)
+	return res, err
+}
+
+// PutBatch adds a batch of files as the children of one directory, pinning
+// only the directory. Files are named by their index in the batch, and
+// results are returned in the order given. Files in the batch are pinned
+// indirectly, so they're removed by deleting the returned root path rather
+// than by deleting each file
+func (fst *Filestore) PutBatch(ctx context.Context, fs []qfs.File) (root string, res []qfs.PutResult, err error) {
+	opts, err := fst.putOptions().addOptions()
+	if err != nil {
+		return "", nil, err
+	}
+	opts.Pin = true
+
+	entries := make(map[string]files.Node, len(fs))
+	for i, f := range fs {
+		if f.IsDirectory() {
+			return "", nil, fmt.Errorf("%w: batches only hold files. path: %q", qfs.ErrNotFile, f.FullPath())
+		}
+		entries[batchName(i)] = files.NewReaderFile(contextReader{ctx: ctx, r: f})
+	}
+
+	id, err := fst.drv.Add(ctx, files.NewMapDirectory(entries), opts)
+	if err != nil {
+		return "", nil, err
+	}
+	fst.filterAddDAG(ctx, id)
+	root = pathFromHash(id.String())
+
+	listing, err := fst.drv.Ls(ctx, root)
+	if err != nil {
+		return "", nil, err
+	}
+	byName := make(map[string]qfs.DirEntry, len(listing))
+	for _, e := range listing {
+		byName[e.Name] = e
+	}
+	res = make([]qfs.PutResult, len(fs))
+	for i := range fs {
+		e, ok := byName[batchName(i)]
+		if !ok {
+			return "", nil, fmt.Errorf("batch %s is missing file %d", root, i)
+		}
+		res[i] = qfs.PutResult{Cid: e.Cid, Size: e.Size, Path: pathFromHash(e.Cid.String())}
+	}
+
+	for _, r := range res {
+		fst.publish(qfs.EventPut, r.Path)
+	}
+
+	// the batch is stored locally even if mirroring fails
+	if err := fst.mirrorPin(ctx, root, ""); err != nil {
+		log.Errorf("mirroring pin of %q: %s", root, err)
+	}
+	return root, res, nil
+}
+
+// batchName names the i'th file of a batch. Names are zero padded so the
+// directory lists in batch order
+func batchName(i int) string {
+	return fmt.Sprintf("%06d", i)
+}
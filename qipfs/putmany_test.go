@@ -0,0 +1,80 @@
+package qipfs
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/qri-io/qfs"
+)
+
+func TestPutBatch(t *testing.T) {
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	for _, lite := range []bool{false, true} {
+		ctx, cancel := context.WithCancel(context.Background())
+		f, err := NewFilesystem(ctx, map[string]interface{}{"path": path, "lite": lite})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fst := f.(*Filestore)
+
+		countPins := func() int {
+			pins, err := fst.drv.Pins(ctx, "recursive")
+			if err != nil {
+				t.Fatal(err)
+			}
+			n := 0
+			for range pins {
+				n++
+			}
+			return n
+		}
+		before := countPins()
+
+		batch := make([]qfs.File, 120)
+		for i := range batch {
+			batch[i] = qfs.NewMemfileBytes(fmt.Sprintf("%d.json", i), []byte(fmt.Sprintf(`{"lite":%t,"i":%d}`, lite, i)))
+		}
+		root, res, err := fst.PutBatch(ctx, batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res) != len(batch) {
+			t.Fatalf("lite=%t: expected %d results, got %d", lite, len(batch), len(res))
+		}
+		if after := countPins(); after != before+1 {
+			t.Errorf("lite=%t: expected a single new pin, pins went from %d to %d", lite, before, after)
+		}
+
+		for _, i := range []int{0, 57, 119} {
+			expect := fmt.Sprintf(`{"lite":%t,"i":%d}`, lite, i)
+			if res[i].Size != int64(len(expect)) {
+				t.Errorf("lite=%t: file %d size mismatch. want: %d got: %d", lite, i, len(expect), res[i].Size)
+			}
+			got, err := fst.Get(ctx, res[i].Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := ioutil.ReadAll(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != expect {
+				t.Errorf("lite=%t: file %d content mismatch. want: %q got: %q", lite, i, expect, data)
+			}
+		}
+
+		if err := fst.Delete(ctx, root); err != nil {
+			t.Fatal(err)
+		}
+		if after := countPins(); after != before {
+			t.Errorf("lite=%t: expected deleting the root to remove the pin", lite)
+		}
+		cancel()
+		<-fst.Done()
+	}
+}
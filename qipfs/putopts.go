@@ -0,0 +1,136 @@
+package qipfs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	chunker "github.com/ipfs/go-ipfs-chunker"
+	"github.com/multiformats/go-multihash"
+	"github.com/qri-io/qfs"
+)
+
+// PutOptions controls how file content is chunked & hashed when it's added.
+// Adding the same content with the same options always produces the same
+// CID, no matter which kind of node the filesystem runs. The zero value adds
+// files the way go-ipfs does by default: CIDv0, sha2-256, 256KiB chunks &
+// no raw leaves
+type PutOptions struct {
+	// Chunker splits files into blocks. Either "size-<bytes>" for fixed size
+	// chunks or "rabin-<min>-<avg>-<max>" for content-defined chunks.
+	// defaults to "size-262144"
+	Chunker string
+	// RawLeaves stores file data in raw blocks instead of wrapping leaves in
+	// unixfs nodes
+	RawLeaves bool
+	// HashFunction is the multihash name blocks are hashed with, like
+	// "sha2-256" or "blake2b-256". defaults to "sha2-256"
+	HashFunction string
+	// CidVersion is 0 or 1. CIDv0 only supports sha2-256 hashes
+	CidVersion int
+	// Pin sets when added content is pinned. defaults to PinNow
+	Pin PinMode
+	// PinName labels the pin mirrored to remote pinning services. defaults to
+	// the file's name
+	PinName string
+	// Progress reports bytes read from the file as it's added. defaults to
+	// the progress func of the put context, if any
+	Progress qfs.ProgressFunc
+	// Resumable adds files to a node behind the HTTP API block by block,
+	// skipping blocks the node already has. Putting a file again after a
+	// dropped connection only uploads the blocks that didn't make it. Costs
+	// a request per block, so it suits large files. Ignored by other
+	// filesystems
+	Resumable bool
+	// PreserveModTime records the modification time of files in their root
+	// unixfs node, as unixfs 1.5 mtime metadata. Files read back with Get
+	// report the recorded time from ModTime. Recording a time changes the
+	// file's CID, files with a zero ModTime are added without one
+	PreserveModTime bool
+}
+
+// PinMode sets when content added with Put is pinned
+type PinMode int
+
+const (
+	// PinNow pins content as it's added
+	PinNow PinMode = iota
+	// PinLater adds content unpinned & queues it to be pinned by the next
+	// call to PinPending, so bulk ingests can pin once they're done. Queued
+	// content can be garbage collected until it's pinned
+	PinLater
+	// PinNone adds content without pinning it
+	PinNone
+)
+
+// addOptions validates options, converting them to driver options
+func (o PutOptions) addOptions() (addOptions, error) {
+	if o.Pin < PinNow || o.Pin > PinNone {
+		return addOptions{}, fmt.Errorf("invalid pin mode %d", o.Pin)
+	}
+	if o.CidVersion != 0 && o.CidVersion != 1 {
+		return addOptions{}, fmt.Errorf("invalid cid version %d", o.CidVersion)
+	}
+	if _, err := chunker.FromString(bytes.NewReader(nil), o.Chunker); err != nil {
+		return addOptions{}, fmt.Errorf("invalid chunker %q: %w", o.Chunker, err)
+	}
+	mhType := uint64(multihash.SHA2_256)
+	if o.HashFunction != "" {
+		t, ok := multihash.Names[o.HashFunction]
+		if !ok {
+			return addOptions{}, fmt.Errorf("unknown hash function %q", o.HashFunction)
+		}
+		mhType = t
+	}
+	if o.CidVersion == 0 && mhType != multihash.SHA2_256 {
+		return addOptions{}, fmt.Errorf("cid version 0 requires sha2-256, got %q", o.HashFunction)
+	}
+	return addOptions{
+		CidVersion: o.CidVersion,
+		Chunker:    o.Chunker,
+		RawLeaves:  o.RawLeaves,
+		MhType:     mhType,
+		Resumable:  o.Resumable,
+	}, nil
+}
+
+// PutWithOptions adds a file like Put, chunking & hashing it with the given
+// options instead of the configured ones
+func (fst *Filestore) PutWithOptions(ctx context.Context, file qfs.File, opts PutOptions) (key string, err error) {
+	span, ctx := qfs.StartSpan(ctx, "put", fst.Type(), file.FullPath())
+	defer func() { span.Finish(0, err) }()
+
+	if opts.Progress == nil {
+		opts.Progress = qfs.ProgressFromContext(ctx)
+	}
+	hash, err := fst.addFile(ctx, file, opts, opts.Pin == PinNow)
+	if err != nil {
+		log.Infof("error adding bytes: %w", err)
+		return "", err
+	}
+	key = pathFromHash(hash)
+	fst.publish(qfs.EventPut, key)
+
+	name := opts.PinName
+	if name == "" {
+		name = file.FileName()
+	}
+	switch opts.Pin {
+	case PinNow:
+		// the file is stored locally even if mirroring fails
+		if err := fst.mirrorPin(ctx, key, name); err != nil {
+			log.Errorf("mirroring pin of %q: %s", key, err)
+		}
+	case PinLater:
+		fst.pending.add(pendingPin{path: key, name: name})
+	}
+	return key, nil
+}
+
+// putOptions returns the configured put options
+func (fst *Filestore) putOptions() PutOptions {
+	if fst.cfg == nil {
+		return PutOptions{}
+	}
+	return fst.cfg.PutOptions
+}
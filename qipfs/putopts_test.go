@@ -0,0 +1,201 @@
+package qipfs
+
+import (
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/qri-io/qfs"
+)
+
+func TestPutOptions(t *testing.T) {
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	data := make([]byte, 600<<10)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	cases := []struct {
+		opts    PutOptions
+		version uint64
+		mhType  uint64
+	}{
+		{PutOptions{}, 0, multihash.SHA2_256},
+		{PutOptions{Chunker: "size-65536"}, 0, multihash.SHA2_256},
+		{PutOptions{Chunker: "rabin-16384-65536-131072", CidVersion: 1}, 1, multihash.SHA2_256},
+		{PutOptions{RawLeaves: true, CidVersion: 1, HashFunction: "blake2b-256"}, 1, multihash.BLAKE2B_MIN + 31},
+	}
+
+	put := func(cfg map[string]interface{}) []string {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		fs, err := NewFilesystem(ctx, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			cancel()
+			<-fs.(qfs.ReleasingFilesystem).Done()
+		}()
+
+		var paths []string
+		for _, c := range cases {
+			p, err := fs.(*Filestore).PutWithOptions(ctx, qfs.NewMemfileBytes("data", data), c.opts)
+			if err != nil {
+				t.Fatalf("putting with %#v: %s", c.opts, err)
+			}
+			paths = append(paths, p)
+		}
+		return paths
+	}
+
+	full := put(map[string]interface{}{"path": path})
+	lite := put(map[string]interface{}{"path": path, "lite": true})
+
+	seen := map[string]bool{}
+	for i, c := range cases {
+		if full[i] != lite[i] {
+			t.Errorf("case %d: full & lite node path mismatch. full: %q lite: %q", i, full[i], lite[i])
+		}
+		if seen[full[i]] {
+			t.Errorf("case %d: expected options to change the path, got duplicate %q", i, full[i])
+		}
+		seen[full[i]] = true
+
+		id, err := cid.Parse(strings.TrimPrefix(full[i], "/ipfs/"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pre := id.Prefix(); pre.Version != c.version || pre.MhType != c.mhType {
+			t.Errorf("case %d: expected cid version %d, hash %x. got version %d, hash %x", i, c.version, c.mhType, pre.Version, pre.MhType)
+		}
+	}
+}
+
+func TestPutOptionsValidation(t *testing.T) {
+	bad := []PutOptions{
+		{CidVersion: 2},
+		{Chunker: "bananas"},
+		{HashFunction: "not-a-hash", CidVersion: 1},
+		{HashFunction: "sha3-256"},
+		{Pin: PinNone + 1},
+	}
+	for i, o := range bad {
+		if _, err := o.addOptions(); err == nil {
+			t.Errorf("case %d: expected error for options %#v", i, o)
+		}
+	}
+}
+
+func TestPutPinModes(t *testing.T) {
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst := f.(*Filestore)
+
+	pinned := func(key string) bool {
+		pins, err := fst.drv.Pins(ctx, "recursive")
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for p := range pins {
+			if pathFromHash(p.Cid.String()) == key {
+				found = true
+			}
+		}
+		return found
+	}
+	put := func(data string, mode PinMode) string {
+		key, err := fst.PutWithOptions(ctx, qfs.NewMemfileBytes("data.txt", []byte(data)), PutOptions{Pin: mode})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	now := put("pin now", PinNow)
+	later := put("pin later", PinLater)
+	none := put("pin none", PinNone)
+	if !pinned(now) {
+		t.Error("expected PinNow to pin")
+	}
+	if pinned(later) || pinned(none) {
+		t.Error("expected PinLater & PinNone not to pin on put")
+	}
+	if pending := fst.PendingPins(); len(pending) != 1 || pending[0] != later {
+		t.Errorf("expected %s to be pending, got %v", later, pending)
+	}
+
+	if err := fst.PinPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !pinned(later) {
+		t.Error("expected PinPending to pin queued content")
+	}
+	if pending := fst.PendingPins(); len(pending) != 0 {
+		t.Errorf("expected no pending pins, got %v", pending)
+	}
+	if pinned(none) {
+		t.Error("expected PinNone content to stay unpinned")
+	}
+
+	if err := fst.PinMany(ctx, []string{none, now}); err != nil {
+		t.Fatal(err)
+	}
+	if !pinned(none) {
+		t.Error("expected PinMany to pin")
+	}
+	if err := fst.PinMany(ctx, []string{"/ipfs/not-a-cid"}); err == nil {
+		t.Error("expected pinning an invalid path to fail")
+	}
+}
+
+func TestPutGetProgress(t *testing.T) {
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst := f.(*Filestore)
+
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(7)).Read(data)
+	var putDone, putTotal int64
+	opts := PutOptions{Progress: func(d, t int64) { putDone, putTotal = d, t }}
+	key, err := fst.PutWithOptions(ctx, qfs.NewMemfileBytes("data.bin", data), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if putDone != int64(len(data)) || putTotal != int64(len(data)) {
+		t.Errorf("expected put progress of %d bytes, got %d of %d", len(data), putDone, putTotal)
+	}
+
+	var getDone int64
+	getCtx := qfs.WithProgress(ctx, func(d, t int64) { getDone = d })
+	file, err := fst.Get(getCtx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(file); err != nil {
+		t.Fatal(err)
+	}
+	if getDone != int64(len(data)) {
+		t.Errorf("expected get progress of %d bytes, got %d", len(data), getDone)
+	}
+}
@@ -0,0 +1,44 @@
+package qipfs
+
+import (
+	"context"
+	"strings"
+
+	format "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
+	unixfs "github.com/ipfs/go-unixfs"
+	"github.com/qri-io/qfs"
+)
+
+var _ qfs.ReadDirFS = (*Filestore)(nil)
+
+// ReadDir lists a unixfs directory, fetching only the directory & the root
+// block of each child rather than traversing the whole DAG
+func (fst *Filestore) ReadDir(ctx context.Context, key string) ([]qfs.DirEntry, error) {
+	if !strings.HasPrefix(key, "/") {
+		key = pathFromHash(key)
+	}
+	key, err := fst.resolveNamePath(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := fst.drv.Ls(ctx, key)
+	if err != nil {
+		return nil, typedError(err)
+	}
+	qfs.SortDirEntries(entries)
+	return entries, nil
+}
+
+// isUnixfsDir reports whether nd is a unixfs directory or directory shard
+func isUnixfsDir(nd format.Node) bool {
+	pn, ok := nd.(*merkledag.ProtoNode)
+	if !ok {
+		return false
+	}
+	fsn, err := unixfs.FSNodeFromBytes(pn.Data())
+	if err != nil {
+		return false
+	}
+	return fsn.Type() == unixfs.TDirectory || fsn.Type() == unixfs.THAMTShard
+}
@@ -0,0 +1,62 @@
+package qipfs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/qri-io/qfs"
+)
+
+func TestReadDir(t *testing.T) {
+	for _, lite := range []bool{false, true} {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		path := InitTestRepo(t)
+		defer os.RemoveAll(path)
+
+		fs, err := NewFilesystem(ctx, map[string]interface{}{"path": path, "lite": lite})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fst := fs.(*Filestore)
+
+		dir := files.NewMapDirectory(map[string]files.Node{
+			"b.txt": files.NewBytesFile([]byte("bravo")),
+			"a.txt": files.NewBytesFile([]byte("a")),
+			"sub": files.NewMapDirectory(map[string]files.Node{
+				"c.txt": files.NewBytesFile([]byte("c")),
+			}),
+		})
+		id, err := fst.drv.Add(ctx, dir, addOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entries, err := fst.ReadDir(ctx, id.String())
+		if err != nil {
+			t.Fatalf("lite=%t: %s", lite, err)
+		}
+		if len(entries) != 3 {
+			t.Fatalf("lite=%t: expected 3 entries, got %#v", lite, entries)
+		}
+		expect := []struct {
+			name  string
+			size  int64
+			isDir bool
+		}{{"a.txt", 1, false}, {"b.txt", 5, false}, {"sub", -1, true}}
+		for i, e := range expect {
+			got := entries[i]
+			if got.Name != e.name || got.Size != e.size || got.IsDir != e.isDir || !got.Cid.Defined() {
+				t.Errorf("lite=%t: entry %d mismatch. want %v, got %#v", lite, i, e, got)
+			}
+		}
+
+		if _, err := fst.ReadDir(ctx, pathFromHash(entries[0].Cid.String())); !errors.Is(err, qfs.ErrNotDirectory) {
+			t.Errorf("lite=%t: expected listing a file to fail with ErrNotDirectory, got %v", lite, err)
+		}
+	}
+}
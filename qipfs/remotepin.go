@@ -0,0 +1,264 @@
+package qipfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-cid"
+)
+
+// remotePinPageSize is the number of pins requested per page when listing a
+// remote pinning service. 1000 is the largest page the API allows
+const remotePinPageSize = 1000
+
+// RemotePinCfg configures a remote pinning service that speaks the IPFS
+// Pinning Service API, like Pinata, web3.storage or Estuary
+type RemotePinCfg struct {
+	// Name identifies the service
+	Name string
+	// Endpoint is the API base URL, like "https://api.pinata.cloud/psa"
+	Endpoint string
+	// Token is the service access token
+	Token string
+}
+
+// Pin statuses reported by remote pinning services
+const (
+	RemotePinQueued  = "queued"
+	RemotePinPinning = "pinning"
+	RemotePinPinned  = "pinned"
+	RemotePinFailed  = "failed"
+)
+
+// RemotePinStatus is a pin request held by a remote pinning service
+type RemotePinStatus struct {
+	RequestID string    `json:"requestid"`
+	Status    string    `json:"status"`
+	Created   time.Time `json:"created"`
+	Pin       struct {
+		Cid  string `json:"cid"`
+		Name string `json:"name,omitempty"`
+	} `json:"pin"`
+}
+
+// RemotePinService is a client for a remote pinning service
+type RemotePinService struct {
+	cfg RemotePinCfg
+	cli *http.Client
+}
+
+// NewRemotePinService creates a pinning service client. A nil client uses
+// http.DefaultClient
+func NewRemotePinService(cfg RemotePinCfg, cli *http.Client) (*RemotePinService, error) {
+	if _, err := url.Parse(cfg.Endpoint); err != nil || cfg.Endpoint == "" {
+		return nil, fmt.Errorf("remote pinning service %q: invalid endpoint %q", cfg.Name, cfg.Endpoint)
+	}
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+	return &RemotePinService{cfg: cfg, cli: cli}, nil
+}
+
+// Name returns the configured service name
+func (s *RemotePinService) Name() string { return s.cfg.Name }
+
+func (s *RemotePinService) do(ctx context.Context, method, path string, body, res interface{}) error {
+	var rdr io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rdr = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, s.cfg.Endpoint+path, rdr)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if s.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.cfg.Token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.cli.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<16))
+		apiErr := struct {
+			Error struct {
+				Reason  string `json:"reason"`
+				Details string `json:"details"`
+			} `json:"error"`
+		}{}
+		msg := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error.Reason != "" {
+			msg = strings.TrimSpace(apiErr.Error.Reason + " " + apiErr.Error.Details)
+		}
+		return fmt.Errorf("remote pinning service %q: %s %s (%d): %s", s.cfg.Name, method, path, resp.StatusCode, msg)
+	}
+	if res == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(res)
+}
+
+// Add asks the service to pin id. Services pin asynchronously, so the
+// returned status is usually queued
+func (s *RemotePinService) Add(ctx context.Context, id cid.Cid, name string) (RemotePinStatus, error) {
+	body := map[string]string{"cid": id.String()}
+	if name != "" {
+		body["name"] = name
+	}
+	st := RemotePinStatus{}
+	err := s.do(ctx, http.MethodPost, "/pins", body, &st)
+	return st, err
+}
+
+// List returns every pin request with one of the given statuses. With no
+// statuses, pins that are queued, pinning or pinned are listed. When ids are
+// given, only requests for those CIDs are listed
+func (s *RemotePinService) List(ctx context.Context, statuses []string, ids ...cid.Cid) ([]RemotePinStatus, error) {
+	if len(statuses) == 0 {
+		statuses = []string{RemotePinQueued, RemotePinPinning, RemotePinPinned}
+	}
+	q := url.Values{
+		"status": {strings.Join(statuses, ",")},
+		"limit":  {fmt.Sprintf("%d", remotePinPageSize)},
+	}
+	if len(ids) > 0 {
+		strs := make([]string, len(ids))
+		for i, id := range ids {
+			strs[i] = id.String()
+		}
+		q.Set("cid", strings.Join(strs, ","))
+	}
+
+	var pins []RemotePinStatus
+	for {
+		page := struct {
+			Count   int               `json:"count"`
+			Results []RemotePinStatus `json:"results"`
+		}{}
+		if err := s.do(ctx, http.MethodGet, "/pins?"+q.Encode(), nil, &page); err != nil {
+			return nil, err
+		}
+		pins = append(pins, page.Results...)
+		// results are sorted newest first. page backwards through creation time
+		if len(page.Results) == 0 || len(pins) >= page.Count {
+			return pins, nil
+		}
+		q.Set("before", page.Results[len(page.Results)-1].Created.Format(time.RFC3339Nano))
+	}
+}
+
+// Remove deletes every pin request the service holds for id
+func (s *RemotePinService) Remove(ctx context.Context, id cid.Cid) error {
+	pins, err := s.List(ctx, []string{RemotePinQueued, RemotePinPinning, RemotePinPinned, RemotePinFailed}, id)
+	if err != nil {
+		return err
+	}
+	for _, p := range pins {
+		if err := s.do(ctx, http.MethodDelete, "/pins/"+url.PathEscape(p.RequestID), nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemotePinServices returns clients for the filestore's configured remote
+// pinning services
+func (fst *Filestore) RemotePinServices() ([]*RemotePinService, error) {
+	svcs := make([]*RemotePinService, 0, len(fst.cfg.RemotePins))
+	for _, cfg := range fst.cfg.RemotePins {
+		s, err := NewRemotePinService(cfg, nil)
+		if err != nil {
+			return nil, err
+		}
+		svcs = append(svcs, s)
+	}
+	return svcs, nil
+}
+
+// mirrorPin asks every configured remote pinning service to pin path
+func (fst *Filestore) mirrorPin(ctx context.Context, path, name string) error {
+	if fst.cfg == nil || len(fst.cfg.RemotePins) == 0 {
+		return nil
+	}
+	id, err := cid.Parse(path)
+	if err != nil {
+		return err
+	}
+	svcs, err := fst.RemotePinServices()
+	if err != nil {
+		return err
+	}
+	for _, s := range svcs {
+		if _, err := s.Add(ctx, id, name); err != nil {
+			return err
+		}
+		log.Debugw("mirrored pin", "service", s.Name(), "cid", id)
+	}
+	return nil
+}
+
+// mirrorUnpin removes pins for path from every configured remote pinning
+// service
+func (fst *Filestore) mirrorUnpin(ctx context.Context, path string) error {
+	if fst.cfg == nil || len(fst.cfg.RemotePins) == 0 {
+		return nil
+	}
+	id, err := cid.Parse(path)
+	if err != nil {
+		return err
+	}
+	svcs, err := fst.RemotePinServices()
+	if err != nil {
+		return err
+	}
+	for _, s := range svcs {
+		if err := s.Remove(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemotePinsetDifference is PinsetDifference against the pins of a
+// configured remote pinning service, listing paths the service pins that are
+// not in the given set
+func (fst *Filestore) RemotePinsetDifference(ctx context.Context, service string, set map[string]struct{}) (<-chan string, error) {
+	diffs, err := fst.RemotePinsetDiff(ctx, service, set)
+	if err != nil {
+		return nil, err
+	}
+	return diffPaths(ctx, diffs, ""), nil
+}
+
+// remotePinService returns the configured remote pinning service named name
+func (fst *Filestore) remotePinService(name string) (*RemotePinService, error) {
+	svcs, err := fst.RemotePinServices()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range svcs {
+		if s.Name() == name {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("no remote pinning service named %q", name)
+}
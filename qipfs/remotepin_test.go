@@ -0,0 +1,192 @@
+package qipfs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/qri-io/qfs"
+)
+
+// fakePinService implements enough of the IPFS Pinning Service API for
+// tests. Lists return at most two results a page to exercise paging
+type fakePinService struct {
+	lk   sync.Mutex
+	seq  int
+	pins []RemotePinStatus
+}
+
+func (s *fakePinService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":{"reason":"UNAUTHORIZED"}}`))
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/pins":
+		body := struct{ Cid, Name string }{}
+		json.NewDecoder(r.Body).Decode(&body)
+		s.seq++
+		p := RemotePinStatus{RequestID: fmt.Sprintf("req-%d", s.seq), Status: RemotePinQueued, Created: time.Unix(int64(s.seq), 0).UTC()}
+		p.Pin.Cid, p.Pin.Name = body.Cid, body.Name
+		s.pins = append(s.pins, p)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(p)
+	case r.Method == http.MethodGet && r.URL.Path == "/pins":
+		q := r.URL.Query()
+		before := time.Now()
+		if b := q.Get("before"); b != "" {
+			before, _ = time.Parse(time.RFC3339Nano, b)
+		}
+		var match []RemotePinStatus
+		for _, p := range s.pins {
+			if c := q.Get("cid"); c != "" && !strings.Contains(c, p.Pin.Cid) {
+				continue
+			}
+			if !strings.Contains(q.Get("status"), p.Status) {
+				continue
+			}
+			match = append(match, p)
+		}
+		sort.Slice(match, func(i, j int) bool { return match[i].Created.After(match[j].Created) })
+		res := []RemotePinStatus{}
+		for _, p := range match {
+			if p.Created.Before(before) && len(res) < 2 {
+				res = append(res, p)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"count": len(match), "results": res})
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/pins/"):
+		id := strings.TrimPrefix(r.URL.Path, "/pins/")
+		for i, p := range s.pins {
+			if p.RequestID == id {
+				s.pins = append(s.pins[:i], s.pins[i+1:]...)
+				w.WriteHeader(http.StatusAccepted)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestRemotePins(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	svc := &fakePinService{}
+	s := httptest.NewServer(svc)
+	defer s.Close()
+
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	f, err := NewFilesystem(ctx, map[string]interface{}{
+		"path": path,
+		"RemotePins": []map[string]interface{}{
+			{"Name": "fake", "Endpoint": s.URL, "Token": "token"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst := f.(*Filestore)
+
+	keys := []string{}
+	for _, data := range []string{"a", "b", "c"} {
+		key, err := fst.Put(ctx, qfs.NewMemfileBytes(data+".txt", []byte(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+	if len(svc.pins) != 3 || svc.pins[0].Pin.Name != "a.txt" {
+		t.Fatalf("expected puts to be mirrored to the remote service. got: %#v", svc.pins)
+	}
+
+	set := map[string]struct{}{strings.Replace(keys[0], "/ipfs/", "/ipld/", 1): {}}
+	diff, err := fst.RemotePinsetDifference(ctx, "fake", set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for p := range diff {
+		got = append(got, strings.Replace(p, "/ipld/", "/ipfs/", 1))
+	}
+	sort.Strings(got)
+	expect := []string{keys[1], keys[2]}
+	sort.Strings(expect)
+	if strings.Join(got, ",") != strings.Join(expect, ",") {
+		t.Errorf("remote pinset difference mismatch. want %v, got %v", expect, got)
+	}
+
+	missing := "/ipld/QmXoypizjW3WknFiJnKLwHCnL72vedxjQkDDP1mXWo6uco"
+	set[missing] = struct{}{}
+	diffs, err := fst.RemotePinsetDiff(ctx, "fake", set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	named := map[string]string{}
+	for d := range diffs {
+		switch {
+		case d.Missing:
+			named[d.Path()] = "missing"
+		case d.Type != RemotePinQueued:
+			t.Errorf("expected remote pin status %q. got: %q", RemotePinQueued, d.Type)
+		default:
+			named[strings.Replace(d.Path(), "/ipld/", "/ipfs/", 1)] = d.Name
+		}
+	}
+	if named[keys[1]] != "b.txt" || named[keys[2]] != "c.txt" || named[missing] != "missing" || len(named) != 3 {
+		t.Errorf("unexpected remote pinset diff: %v", named)
+	}
+	delete(set, missing)
+
+	if err := fst.Pin(ctx, keys[1], true); err != nil {
+		t.Fatal(err)
+	}
+	if err := fst.Unpin(ctx, keys[1], true); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range svc.pins {
+		if "/ipfs/"+p.Pin.Cid == keys[1] {
+			t.Errorf("expected unpin to remove every remote pin request for %s", keys[1])
+		}
+	}
+
+	if _, err := fst.RemotePinsetDifference(ctx, "missing", set); err == nil {
+		t.Error("expected an error reconciling against an unknown service")
+	}
+}
+
+func TestRemotePinServiceErrors(t *testing.T) {
+	s := httptest.NewServer(&fakePinService{})
+	defer s.Close()
+
+	svc, err := NewRemotePinService(RemotePinCfg{Name: "fake", Endpoint: s.URL, Token: "wrong"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.List(context.Background(), nil); err == nil || !strings.Contains(err.Error(), "UNAUTHORIZED") {
+		t.Errorf("expected unauthorized error, got %v", err)
+	}
+
+	if _, err := mapToConfig(map[string]interface{}{
+		"path":       "/repo",
+		"RemotePins": []map[string]interface{}{{"Name": "fake"}},
+	}); err == nil {
+		t.Error("expected config without a remote pin endpoint to fail validation")
+	}
+}
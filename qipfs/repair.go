@@ -0,0 +1,228 @@
+package qipfs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/qri-io/qfs"
+)
+
+// MissingBlock is a block a pinned root links to that isn't in the local
+// blockstore
+type MissingBlock struct {
+	Cid string `json:"cid"`
+	// Root is the pinned root the block was reached from
+	Root string `json:"root"`
+}
+
+// FsckReport describes the consistency of a repo's pins & blocks
+type FsckReport struct {
+	// Roots is the number of recursive pins walked
+	Roots int `json:"roots"`
+	// Reachable is the number of local blocks reachable from a pin
+	Reachable int `json:"reachable"`
+	// Missing lists blocks pinned roots reference that aren't stored locally
+	Missing []MissingBlock `json:"missing"`
+	// Orphans lists stored blocks that no pin reaches. Unpinned orphans are
+	// removed by garbage collection
+	Orphans []string `json:"orphans"`
+	// OrphanRoots is the subset of orphans no other orphan links to. Pinning
+	// every orphan root keeps all orphans
+	OrphanRoots []string `json:"orphanRoots"`
+}
+
+// Fsck walks every pin in the local blockstore without touching the network,
+// reporting blocks pins reference but are missing & blocks no pin reaches
+func (fst *Filestore) Fsck(ctx context.Context) (FsckReport, error) {
+	report := FsckReport{Missing: []MissingBlock{}, Orphans: []string{}, OrphanRoots: []string{}}
+	bs, err := fst.localBlockstore()
+	if err != nil {
+		return report, err
+	}
+
+	reachable := map[cid.Cid]struct{}{}
+	for _, pinType := range []string{"recursive", "direct"} {
+		pins, err := fst.drv.Pins(ctx, pinType)
+		if err != nil {
+			return report, err
+		}
+		for p := range pins {
+			if p.Err != nil {
+				return report, p.Err
+			}
+			root := p.Cid.String()
+			if pinType == "direct" {
+				if has, _ := bs.Has(p.Cid); has {
+					reachable[p.Cid] = struct{}{}
+				} else {
+					report.Missing = append(report.Missing, MissingBlock{Cid: root, Root: root})
+				}
+				continue
+			}
+			report.Roots++
+			err := walkLocal(ctx, bs, p.Cid, reachable, func(id cid.Cid) {
+				report.Missing = append(report.Missing, MissingBlock{Cid: id.String(), Root: root})
+			})
+			if err != nil {
+				return report, err
+			}
+		}
+	}
+	report.Reachable = len(reachable)
+
+	keys, err := bs.AllKeysChan(ctx)
+	if err != nil {
+		return report, err
+	}
+	orphans := map[cid.Cid]struct{}{}
+	for id := range keys {
+		if _, ok := reachable[id]; !ok {
+			orphans[id] = struct{}{}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return report, err
+	}
+
+	// any orphan another orphan links to isn't a root
+	roots := make(map[cid.Cid]struct{}, len(orphans))
+	for id := range orphans {
+		roots[id] = struct{}{}
+	}
+	for id := range orphans {
+		nd, err := getLocalNode(bs, id)
+		if err != nil {
+			log.Debugw("decoding orphan", "cid", id.String(), "err", err)
+			continue
+		}
+		for _, lnk := range nd.Links() {
+			delete(roots, lnk.Cid)
+		}
+	}
+
+	for id := range orphans {
+		report.Orphans = append(report.Orphans, id.String())
+	}
+	for id := range roots {
+		report.OrphanRoots = append(report.OrphanRoots, id.String())
+	}
+	sort.Strings(report.Orphans)
+	sort.Strings(report.OrphanRoots)
+	return report, nil
+}
+
+// walkLocal adds every locally stored block reachable from id to seen,
+// calling missing for each block that isn't stored
+func walkLocal(ctx context.Context, bs blockstore.Blockstore, id cid.Cid, seen map[cid.Cid]struct{}, missing func(id cid.Cid)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if _, ok := seen[id]; ok {
+		return nil
+	}
+
+	nd, err := getLocalNode(bs, id)
+	if err == blockstore.ErrNotFound {
+		missing(id)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("reading block %s: %w", id, err)
+	}
+	seen[id] = struct{}{}
+	for _, lnk := range nd.Links() {
+		if err := walkLocal(ctx, bs, lnk.Cid, seen, missing); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getLocalNode(bs blockstore.Blockstore, id cid.Cid) (format.Node, error) {
+	blk, err := bs.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	return format.Decode(blk)
+}
+
+// PinRepair describes changes made by RepairPins
+type PinRepair struct {
+	// Pinned lists roots that weren't pinned & now are
+	Pinned []string `json:"pinned"`
+	// Unpinned lists recursive pins removed because they weren't a root
+	Unpinned []string `json:"unpinned"`
+	// Failed maps roots that couldn't be pinned or unpinned to the error
+	Failed map[string]string `json:"failed"`
+}
+
+// RepairPins rebuilds the recursive pinset from a list of root paths. Every
+// root that isn't recursively pinned is pinned, fetching missing blocks if
+// the filestore is online. When prune is true recursive pins that aren't in
+// roots are removed, making the pinset match roots exactly. RepairPins
+// continues past roots that fail, reporting them in the result
+func (fst *Filestore) RepairPins(ctx context.Context, roots []string, prune bool) (PinRepair, error) {
+	res := PinRepair{Pinned: []string{}, Unpinned: []string{}, Failed: map[string]string{}}
+
+	pinned := map[cid.Cid]struct{}{}
+	pins, err := fst.drv.Pins(ctx, "recursive")
+	if err != nil {
+		return res, err
+	}
+	for p := range pins {
+		if p.Err != nil {
+			return res, p.Err
+		}
+		pinned[p.Cid] = struct{}{}
+	}
+
+	want := map[cid.Cid]struct{}{}
+	for _, root := range roots {
+		id, err := cid.Parse(root)
+		if err != nil {
+			res.Failed[root] = err.Error()
+			continue
+		}
+		want[id] = struct{}{}
+		if _, ok := pinned[id]; ok {
+			continue
+		}
+		if err := fst.drv.Pin(ctx, pathFromHash(id.String()), true); err != nil {
+			res.Failed[root] = err.Error()
+			continue
+		}
+		fst.filterAddDAG(ctx, id)
+		res.Pinned = append(res.Pinned, pathFromHash(id.String()))
+	}
+
+	if prune {
+		for id := range pinned {
+			if _, ok := want[id]; ok {
+				continue
+			}
+			p := pathFromHash(id.String())
+			if err := fst.drv.Unpin(ctx, p, true); err != nil {
+				res.Failed[p] = err.Error()
+				continue
+			}
+			res.Unpinned = append(res.Unpinned, p)
+		}
+		sort.Strings(res.Unpinned)
+	}
+	return res, ctx.Err()
+}
+
+// RepinManifest pins every root in a pin manifest that isn't already pinned,
+// restoring a repo from a known-good pinset
+func (fst *Filestore) RepinManifest(ctx context.Context, m qfs.PinManifest) (PinRepair, error) {
+	return fst.RepairPins(ctx, m.Pins, false)
+}
+
+// ReRootOrphans pins the orphan roots found by Fsck, keeping orphaned blocks
+// safe from garbage collection until they can be inspected
+func (fst *Filestore) ReRootOrphans(ctx context.Context, report FsckReport) (PinRepair, error) {
+	return fst.RepairPins(ctx, report.OrphanRoots, false)
+}
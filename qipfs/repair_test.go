@@ -0,0 +1,98 @@
+package qipfs
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/qri-io/qfs"
+)
+
+func TestFsckAndRepairPins(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	f, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst := f.(*Filestore)
+
+	key, err := fst.Put(ctx, qfs.NewMemfileBytes("a.txt", []byte("pinned content")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fst.Pin(ctx, key, true); err != nil {
+		t.Fatal(err)
+	}
+	orphan, err := fst.PutBlock([]byte("orphaned block"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := fst.Fsck(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Missing) != 0 {
+		t.Errorf("expected no missing blocks. got: %v", report.Missing)
+	}
+	if !containsString(report.OrphanRoots, orphan.String()) {
+		t.Errorf("expected %s to be an orphan root. got: %v", orphan, report.OrphanRoots)
+	}
+	root, err := cid.Parse(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if containsString(report.Orphans, root.String()) {
+		t.Errorf("pinned root reported as orphan")
+	}
+
+	res, err := fst.ReRootOrphans(ctx, report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsString(res.Pinned, pathFromHash(orphan.String())) {
+		t.Errorf("expected orphan to be pinned. got: %#v", res)
+	}
+
+	// prune the pinset down to the put file
+	res, err = fst.RepairPins(ctx, []string{key}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Pinned) != 0 || len(res.Failed) != 0 {
+		t.Errorf("expected root to already be pinned. got: %#v", res)
+	}
+	if !containsString(res.Unpinned, pathFromHash(orphan.String())) {
+		t.Errorf("expected orphan pin to be pruned. got: %#v", res)
+	}
+
+	// losing a block of a pinned root shows up as missing
+	bs, err := fst.localBlockstore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.DeleteBlock(root); err != nil {
+		t.Fatal(err)
+	}
+	if report, err = fst.Fsck(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Missing) != 1 || report.Missing[0].Cid != root.String() {
+		t.Errorf("expected root to be reported missing. got: %v", report.Missing)
+	}
+}
+
+func containsString(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
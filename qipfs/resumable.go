@@ -0,0 +1,99 @@
+package qipfs
+
+import (
+	"context"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	format "github.com/ipfs/go-ipld-format"
+	corepath "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+// resumableAttempts is the number of times a block upload is tried when the
+// API can't be reached
+const resumableAttempts = 3
+
+// resumableRetryDelay is the pause before retrying a block upload, multiplied
+// by the number of failed attempts
+const resumableRetryDelay = 250 * time.Millisecond
+
+// Add adds a file through the API's add command, or block by block with
+// resumable options
+func (d *httpDriver) Add(ctx context.Context, f files.Node, opts addOptions) (cid.Cid, error) {
+	if !opts.Resumable {
+		return d.capiDriver.Add(ctx, f, opts)
+	}
+	return d.resumableAdd(ctx, f, opts)
+}
+
+// resumableAdd chunks & builds the DAG for f locally, uploading each block
+// with block/put as it's built. Blocks the node already has are skipped, so
+// adding the same file again after an interrupted add only uploads the
+// blocks that didn't make it. The DAG is the same one the add command builds
+func (d *httpDriver) resumableAdd(ctx context.Context, f files.Node, opts addOptions) (cid.Cid, error) {
+	prefix, err := opts.prefix()
+	if err != nil {
+		return cid.Cid{}, err
+	}
+	dag := &resumableDAG{DAGService: d.capi.Dag(), has: d.BlockHas}
+	nd, err := addNode(ctx, dag, f, prefix, opts)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+	log.Debugw("resumable add", "cid", nd.Cid(), "uploaded", dag.uploaded, "skipped", dag.skipped)
+
+	if opts.Pin {
+		if err := d.capi.Pin().Add(ctx, corepath.IpfsPath(nd.Cid())); err != nil {
+			return cid.Cid{}, err
+		}
+	}
+	return nd.Cid(), nil
+}
+
+// resumableDAG uploads nodes with block/put, skipping nodes the remote
+// already has & retrying uploads that fail because the API can't be reached
+type resumableDAG struct {
+	format.DAGService
+	has func(ctx context.Context, id cid.Cid) (bool, error)
+
+	uploaded, skipped int
+}
+
+var _ format.DAGService = (*resumableDAG)(nil)
+
+// Add uploads nd unless the remote already has it
+func (d *resumableDAG) Add(ctx context.Context, nd format.Node) error {
+	if has, err := d.has(ctx, nd.Cid()); err == nil && has {
+		d.skipped++
+		return nil
+	}
+
+	var err error
+	for attempt := 1; attempt <= resumableAttempts; attempt++ {
+		if err = d.DAGService.Add(ctx, nd); err == nil {
+			d.uploaded++
+			return nil
+		}
+		if !isUnreachable(err) || attempt == resumableAttempts {
+			break
+		}
+		log.Debugw("retrying block upload", "cid", nd.Cid(), "attempt", attempt, "err", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * resumableRetryDelay):
+		}
+	}
+	return err
+}
+
+// AddMany uploads nodes in order
+func (d *resumableDAG) AddMany(ctx context.Context, nds []format.Node) error {
+	for _, nd := range nds {
+		if err := d.Add(ctx, nd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package qipfs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	bserv "github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	files "github.com/ipfs/go-ipfs-files"
+	merkledag "github.com/ipfs/go-merkledag"
+	"github.com/multiformats/go-multihash"
+	"github.com/qri-io/qfs"
+)
+
+// blockAPI stores blocks sent with block/put, answering block/get &
+// block/stat from the stored blocks. After failAfter puts, further puts
+// fail. dropNext drops the connection of the next put
+type blockAPI struct {
+	lk        sync.Mutex
+	blocks    map[string][]byte
+	puts      int
+	failAfter int
+	dropNext  bool
+}
+
+func (a *blockAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+
+	switch r.URL.Path {
+	case "/api/v0/block/stat":
+		id := strings.TrimPrefix(r.URL.Query().Get("arg"), "/ipfs/")
+		data, ok := a.blocks[id]
+		if !ok {
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("blockservice: key not found"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"Key":%q,"Size":%d}`, id, len(data))
+	case "/api/v0/block/get":
+		data, ok := a.blocks[strings.TrimPrefix(r.URL.Query().Get("arg"), "/ipfs/")]
+		if !ok {
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("blockservice: key not found"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(data)
+	case "/api/v0/block/put":
+		if a.dropNext {
+			a.dropNext = false
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		if a.failAfter >= 0 && a.puts >= a.failAfter {
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("upload failed"))
+			return
+		}
+		mr, err := r.MultipartReader()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		part, err := mr.NextPart()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data, _ := ioutil.ReadAll(part)
+		mh, _ := multihash.Sum(data, multihash.Names[r.URL.Query().Get("mhtype")], -1)
+		var id cid.Cid
+		switch r.URL.Query().Get("format") {
+		case "v0":
+			id = cid.NewCidV0(mh)
+		case "raw":
+			id = cid.NewCidV1(cid.Raw, mh)
+		default:
+			id = cid.NewCidV1(cid.DagProtobuf, mh)
+		}
+		a.blocks[id.String()] = data
+		a.puts++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"Key":%q,"Size":%d}`, id.String(), len(data))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestResumablePut(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	api := &blockAPI{blocks: map[string][]byte{}, failAfter: 3, dropNext: true}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	fs, err := NewFilesystem(ctx, map[string]interface{}{"url": srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst := fs.(*Filestore)
+
+	data := make([]byte, 1024*1024+100)
+	rand.New(rand.NewSource(1)).Read(data)
+	opts := PutOptions{Chunker: "size-262144", Pin: PinNone, Resumable: true}
+
+	aopts, err := opts.addOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix, err := aopts.prefix()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	local := merkledag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+	expect, err := addNode(ctx, local, files.NewBytesFile(data), prefix, aopts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fst.PutWithOptions(ctx, qfs.NewMemfileBytes("big", data), opts); err == nil {
+		t.Fatal("expected put to fail once uploads start failing")
+	}
+	api.lk.Lock()
+	uploaded := api.puts
+	api.failAfter = -1
+	api.lk.Unlock()
+	if uploaded != 3 {
+		t.Fatalf("expected 3 blocks uploaded before failing, got %d", uploaded)
+	}
+
+	path, err := fst.PutWithOptions(ctx, qfs.NewMemfileBytes("big", data), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := pathFromHash(expect.Cid().String()); path != want {
+		t.Errorf("expected resumed put to return %q, got %q", want, path)
+	}
+
+	// 5 leaves & a root
+	api.lk.Lock()
+	defer api.lk.Unlock()
+	if api.puts != 6 {
+		t.Errorf("expected resumed put to upload only missing blocks, 6 uploads in total, got %d", api.puts)
+	}
+	for id, stored := range api.blocks {
+		c, _ := cid.Decode(id)
+		blk, err := bs.Get(c)
+		if err != nil {
+			t.Errorf("uploaded block %s isn't part of the DAG", id)
+			continue
+		}
+		if !bytes.Equal(blk.RawData(), stored) {
+			t.Errorf("block %s data mismatch", id)
+		}
+	}
+}
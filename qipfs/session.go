@@ -0,0 +1,230 @@
+package qipfs
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	bserv "github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
+	ipfspath "github.com/ipfs/go-path"
+	"github.com/ipfs/go-path/resolver"
+	unixfile "github.com/ipfs/go-unixfs/file"
+	uio "github.com/ipfs/go-unixfs/io"
+	"github.com/qri-io/qfs"
+)
+
+// defaultSessionCacheSize is the number of dag nodes a session keeps in
+// memory. Sessions are meant to be short lived, so the cache only needs to
+// hold the directories & roots shared by related paths
+const defaultSessionCacheSize = 256
+
+// sessionDriver is implemented by drivers that can hand out their block
+// service. blockService returns nil when the driver can't provide one
+type sessionDriver interface {
+	blockService() bserv.BlockService
+}
+
+func (d *nodeDriver) blockService() bserv.BlockService { return d.node.Blocks }
+func (d *liteDriver) blockService() bserv.BlockService { return d.bserv }
+
+func (d *lazyDriver) blockService() bserv.BlockService {
+	drv, err := d.load()
+	if err != nil {
+		return nil
+	}
+	if sd, ok := drv.(sessionDriver); ok {
+		return sd.blockService()
+	}
+	return nil
+}
+
+// Session is a set of related reads that share a bitswap session and a small
+// cache of dag nodes. Peers that provide one block are asked for the next
+// before falling back to a provider search, and directories shared between
+// paths are resolved once. Filestores backed by the HTTP API don't have a
+// block service to share, and their sessions read through the filestore
+type Session struct {
+	fst    *Filestore
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// dag & res are nil for sessions that read through the filestore
+	dag   format.DAGService
+	res   *resolver.Resolver
+	cache *nodeCache
+}
+
+var _ qfs.Session = (*Session)(nil)
+
+// NewSession creates a session for a group of related reads. The session is
+// closed when ctx ends
+func (fst *Filestore) NewSession(ctx context.Context) (qfs.Session, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Session{fst: fst, ctx: ctx, cancel: cancel}
+
+	if sd, ok := fst.drv.(sessionDriver); ok {
+		if bs := sd.blockService(); bs != nil {
+			ng := merkledag.NewSession(ctx, merkledag.NewDAGService(bs))
+			s.cache = newNodeCache(ng, defaultSessionCacheSize)
+			s.dag = merkledag.NewReadOnlyDagService(s.cache)
+			s.res = &resolver.Resolver{DAG: s.dag, ResolveOnce: uio.ResolveUnixfsOnce}
+		}
+	}
+	return s, nil
+}
+
+// Get fetches a file within the session
+func (s *Session) Get(ctx context.Context, key string) (qfs.File, error) {
+	if s.ctx.Err() != nil {
+		return nil, qfs.ErrSessionClosed
+	}
+	if s.dag == nil {
+		return s.fst.Get(ctx, key)
+	}
+
+	f, err := resolveFile(ctx, s.dag, s.res, key)
+	if err == nil {
+		s.fst.filterFetched()
+	}
+	return f, err
+}
+
+// resolveFile reads the unixfs file at key from a dag service
+func resolveFile(ctx context.Context, dag format.DAGService, res *resolver.Resolver, key string) (qfs.File, error) {
+	p, err := ipfspath.ParsePath(key)
+	if err != nil {
+		return nil, err
+	}
+	nd, err := res.ResolvePath(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	node, err := unixfile.NewUnixfsFile(ctx, dag, nd)
+	if err != nil {
+		return nil, err
+	}
+
+	if rdr, ok := node.(io.ReadCloser); ok {
+		return ipfsFile{path: p.String(), r: rdr, mtime: nodeModTime(nd)}, nil
+	}
+	return nil, fmt.Errorf("path is neither a file nor a directory")
+}
+
+// Close ends the bitswap session & drops cached nodes
+func (s *Session) Close() error {
+	s.cancel()
+	if s.cache != nil {
+		s.cache.purge()
+	}
+	return nil
+}
+
+// nodeCache is a bounded, least-recently-used cache in front of a node getter
+type nodeCache struct {
+	format.NodeGetter
+	size int
+
+	lk    sync.Mutex
+	order *list.List
+	nodes map[cid.Cid]*list.Element
+	hits  int
+}
+
+func newNodeCache(ng format.NodeGetter, size int) *nodeCache {
+	return &nodeCache{
+		NodeGetter: ng,
+		size:       size,
+		order:      list.New(),
+		nodes:      map[cid.Cid]*list.Element{},
+	}
+}
+
+// Get returns a cached node, fetching from the underlying getter on a miss
+func (c *nodeCache) Get(ctx context.Context, id cid.Cid) (format.Node, error) {
+	span, ctx := qfs.StartSpan(ctx, "node", FilestoreType, id.String())
+	if nd, ok := c.get(id); ok {
+		span.SetCache(qfs.CacheHit)
+		span.Finish(int64(len(nd.RawData())), nil)
+		return nd, nil
+	}
+	span.SetCache(qfs.CacheMiss)
+	nd, err := c.NodeGetter.Get(ctx, id)
+	if err != nil {
+		span.Finish(0, err)
+		return nil, err
+	}
+	span.Finish(int64(len(nd.RawData())), nil)
+	c.add(nd)
+	return nd, nil
+}
+
+// GetMany fetches the nodes it doesn't have cached in a single batch
+func (c *nodeCache) GetMany(ctx context.Context, ids []cid.Cid) <-chan *format.NodeOption {
+	out := make(chan *format.NodeOption, len(ids))
+	var missing []cid.Cid
+	for _, id := range ids {
+		if nd, ok := c.get(id); ok {
+			out <- &format.NodeOption{Node: nd}
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		close(out)
+		return out
+	}
+
+	go func() {
+		defer close(out)
+		for opt := range c.NodeGetter.GetMany(ctx, missing) {
+			if opt.Err == nil {
+				c.add(opt.Node)
+			}
+			select {
+			case out <- opt:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func (c *nodeCache) get(id cid.Cid) (format.Node, bool) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	el, ok := c.nodes[id]
+	if !ok {
+		return nil, false
+	}
+	c.hits++
+	c.order.MoveToFront(el)
+	return el.Value.(format.Node), true
+}
+
+func (c *nodeCache) add(nd format.Node) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	if el, ok := c.nodes[nd.Cid()]; ok {
+		c.order.MoveToFront(el)
+		return
+	}
+	c.nodes[nd.Cid()] = c.order.PushFront(nd)
+	for c.order.Len() > c.size {
+		el := c.order.Back()
+		c.order.Remove(el)
+		delete(c.nodes, el.Value.(format.Node).Cid())
+	}
+}
+
+func (c *nodeCache) purge() {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.order.Init()
+	c.nodes = map[cid.Cid]*list.Element{}
+}
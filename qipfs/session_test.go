@@ -0,0 +1,75 @@
+package qipfs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/qri-io/qfs"
+)
+
+func TestSession(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	f, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst := f.(*Filestore)
+
+	dir := files.NewMapDirectory(map[string]files.Node{
+		"a.txt": files.NewBytesFile([]byte("a")),
+		"b.txt": files.NewBytesFile([]byte("b")),
+	})
+	id, err := fst.drv.Add(ctx, dir, addOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := pathFromHash(id.String())
+
+	sess, err := qfs.NewSession(ctx, fst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := sess.(*Session)
+
+	for _, name := range []string{"a.txt", "b.txt"} {
+		file, err := s.Get(ctx, root+"/"+name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != name[:1] {
+			t.Errorf("data mismatch. want: %q got: %q", name[:1], string(data))
+		}
+		file.Close()
+	}
+
+	if s.cache.hits == 0 {
+		t.Errorf("expected second get to resolve the shared root from the session cache")
+	}
+
+	tctx, tr := qfs.Trace(ctx)
+	if _, err := s.Get(tctx, root+"/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if r := tr.Finish(); r.CacheHits == 0 {
+		t.Errorf("expected traced session get to record cache hits. got: %#v", r)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, root+"/a.txt"); err != qfs.ErrSessionClosed {
+		t.Errorf("expected get on closed session to return ErrSessionClosed. got: %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package qipfs
+
+import (
+	"context"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	merkledag "github.com/ipfs/go-merkledag"
+	unixfs "github.com/ipfs/go-unixfs"
+	"github.com/qri-io/qfs"
+)
+
+var _ qfs.StatFS = (*Filestore)(nil)
+
+// Stat describes a file or directory by fetching only its root block. Stats
+// have a modification time only if one was recorded in the root unixfs node
+func (fst *Filestore) Stat(ctx context.Context, key string) (os.FileInfo, error) {
+	if !strings.HasPrefix(key, "/") {
+		key = pathFromHash(key)
+	}
+	key, err := fst.resolveNamePath(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	nd, err := fst.drv.DagResolve(ctx, key)
+	if err != nil {
+		return nil, typedError(err)
+	}
+
+	size, isDir := int64(-1), false
+	switch n := nd.(type) {
+	case *merkledag.ProtoNode:
+		if fsn, err := unixfs.FSNodeFromBytes(n.Data()); err == nil {
+			switch fsn.Type() {
+			case unixfs.TDirectory, unixfs.THAMTShard:
+				isDir = true
+			case unixfs.TFile, unixfs.TRaw:
+				size = int64(fsn.FileSize())
+			}
+		}
+	default:
+		if nd.Cid().Type() == cid.Raw {
+			size = int64(len(nd.RawData()))
+		}
+	}
+	return qfs.NewFileInfo(path.Base(key), size, nodeModTime(nd), isDir, nd.Cid()), nil
+}
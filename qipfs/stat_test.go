@@ -0,0 +1,61 @@
+package qipfs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/multiformats/go-multihash"
+	"github.com/qri-io/qfs"
+)
+
+func TestStat(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	fs, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst := fs.(*Filestore)
+
+	for _, raw := range []bool{false, true} {
+		dir := files.NewMapDirectory(map[string]files.Node{
+			"a.txt": files.NewBytesFile([]byte("alpha")),
+		})
+		id, err := fst.drv.Add(ctx, dir, addOptions{RawLeaves: raw})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fi, err := fst.Stat(ctx, id.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !fi.IsDir() || fi.Size() != -1 || !qfs.FileInfoCid(fi).Equals(id) {
+			t.Errorf("raw=%t: unexpected directory stat: dir %t size %d cid %s", raw, fi.IsDir(), fi.Size(), qfs.FileInfoCid(fi))
+		}
+
+		fi, err = fst.Stat(ctx, pathFromHash(id.String())+"/a.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.IsDir() || fi.Size() != 5 || fi.Name() != "a.txt" || !qfs.FileInfoCid(fi).Defined() {
+			t.Errorf("raw=%t: unexpected file stat: name %q dir %t size %d", raw, fi.Name(), fi.IsDir(), fi.Size())
+		}
+	}
+
+	missing, err := cid.V1Builder{Codec: cid.Raw, MhType: multihash.SHA2_256}.Sum([]byte("qipfs: missing from stat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fst.Stat(ctx, missing.String()); !errors.Is(err, qfs.ErrNotFound) {
+		t.Errorf("expected stat of missing content to fail with ErrNotFound. got: %v", err)
+	}
+}
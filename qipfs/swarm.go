@@ -0,0 +1,33 @@
+package qipfs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/qri-io/qfs"
+)
+
+var _ qfs.P2P = (*Filestore)(nil)
+
+// Peers lists the peers the node is connected to
+func (fst *Filestore) Peers(ctx context.Context) ([]qfs.PeerInfo, error) {
+	return fst.drv.Peers(ctx)
+}
+
+// ConnectPeer dials a peer at a multiaddr ending in /p2p/<peer id>, so
+// transfers can start with a peer known to have content instead of waiting
+// for a provider search
+func (fst *Filestore) ConnectPeer(ctx context.Context, addr string) error {
+	return fst.drv.Connect(ctx, addr)
+}
+
+// DisconnectPeer closes every connection to the peer with the given ID
+func (fst *Filestore) DisconnectPeer(ctx context.Context, peerID string) error {
+	id, err := peer.Decode(strings.TrimPrefix(peerID, "/p2p/"))
+	if err != nil {
+		return fmt.Errorf("parsing peer id: %w", err)
+	}
+	return fst.drv.Disconnect(ctx, "/p2p/"+id.Pretty())
+}
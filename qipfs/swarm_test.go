@@ -0,0 +1,79 @@
+package qipfs
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// testPeerID is a valid peer ID for swarm requests to a fake API
+const testPeerID = "QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN"
+
+// swarmAPI answers swarm commands like an IPFS HTTP API, recording the
+// arguments it receives
+type swarmAPI struct {
+	lk   sync.Mutex
+	args map[string][]string
+}
+
+func (a *swarmAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.lk.Lock()
+	a.args[r.URL.Path] = append(a.args[r.URL.Path], r.URL.Query()["arg"]...)
+	a.lk.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/api/v0/swarm/peers":
+		fmt.Fprintf(w, `{"Peers":[{"Addr":"/ip4/10.0.0.1/tcp/4001","Peer":%q}]}`, testPeerID)
+	case "/api/v0/swarm/connect", "/api/v0/swarm/disconnect":
+		fmt.Fprint(w, `{"Strings":[]}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestSwarm(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	api := &swarmAPI{args: map[string][]string{}}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	fs, err := NewFilesystem(ctx, map[string]interface{}{"url": srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst := fs.(*Filestore)
+
+	peers, err := fst.Peers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 1 || peers[0].ID != testPeerID || peers[0].Addr != "/ip4/10.0.0.1/tcp/4001" {
+		t.Errorf("unexpected peers: %v", peers)
+	}
+
+	addr := "/ip4/10.0.0.1/tcp/4001/p2p/" + testPeerID
+	if err := fst.ConnectPeer(ctx, addr); err != nil {
+		t.Fatal(err)
+	}
+	if err := fst.DisconnectPeer(ctx, testPeerID); err != nil {
+		t.Fatal(err)
+	}
+	if err := fst.DisconnectPeer(ctx, "not a peer id"); err == nil {
+		t.Error("expected an invalid peer id to fail")
+	}
+
+	api.lk.Lock()
+	defer api.lk.Unlock()
+	if got := api.args["/api/v0/swarm/connect"]; len(got) != 1 || got[0] != addr {
+		t.Errorf("expected connect to dial %q, got %v", addr, got)
+	}
+	if got := api.args["/api/v0/swarm/disconnect"]; len(got) != 1 || got[0] != "/p2p/"+testPeerID {
+		t.Errorf("expected disconnect of /p2p/%s, got %v", testPeerID, got)
+	}
+}
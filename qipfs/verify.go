@@ -0,0 +1,197 @@
+package qipfs
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	format "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-path/resolver"
+	uio "github.com/ipfs/go-unixfs/io"
+	"github.com/qri-io/qfs"
+)
+
+// blockstoreDriver is implemented by drivers with direct access to a local
+// blockstore. blockstore returns nil when the driver doesn't have one
+type blockstoreDriver interface {
+	blockstore() blockstore.Blockstore
+}
+
+func (d *nodeDriver) blockstore() blockstore.Blockstore { return d.node.Blockstore }
+func (d *liteDriver) blockstore() blockstore.Blockstore { return d.bstore }
+
+func (d *lazyDriver) blockstore() blockstore.Blockstore {
+	drv, err := d.load()
+	if err != nil {
+		return nil
+	}
+	if bd, ok := drv.(blockstoreDriver); ok {
+		return bd.blockstore()
+	}
+	return nil
+}
+
+// VerifyResult summarizes a Verify run
+type VerifyResult struct {
+	// Checked is the number of blocks hashed
+	Checked int
+	// Corrupt lists CIDs of blocks that failed verification
+	Corrupt []string
+}
+
+// Verify hashes every block in the local blockstore. Blocks that don't match
+// their CID are moved into q and removed from the blockstore, so later reads
+// fetch a good copy instead of returning corrupt data
+func (fst *Filestore) Verify(ctx context.Context, q *qfs.Quarantine) (VerifyResult, error) {
+	res := VerifyResult{Corrupt: []string{}}
+	bs, err := fst.localBlockstore()
+	if err != nil {
+		return res, err
+	}
+
+	keys, err := bs.AllKeysChan(ctx)
+	if err != nil {
+		return res, err
+	}
+	for id := range keys {
+		res.Checked++
+		blk, err := bs.Get(id)
+		var data []byte
+		if err == nil {
+			data = blk.RawData()
+			err = qfs.VerifyBlock(id, data)
+		}
+		if err == nil {
+			continue
+		}
+		if err != blockstore.ErrHashMismatch {
+			if _, corrupt := err.(*qfs.CorruptBlockError); !corrupt {
+				return res, fmt.Errorf("reading block %s: %w", id, err)
+			}
+		}
+
+		log.Debugw("block failed verification", "cid", id.String(), "err", err)
+		res.Corrupt = append(res.Corrupt, id.String())
+		if err := q.Add(id, data, FilestoreType, err.Error()); err != nil {
+			return res, fmt.Errorf("quarantining block %s: %w", id, err)
+		}
+		if err := bs.DeleteBlock(id); err != nil {
+			return res, fmt.Errorf("removing corrupt block %s: %w", id, err)
+		}
+	}
+	return res, ctx.Err()
+}
+
+// RepairQuarantined fetches a good copy of every block in q from the network,
+// storing verified blocks locally & releasing them from quarantine. The
+// filestore must be online to repair blocks. RepairQuarantined returns the
+// number of blocks repaired, continuing past blocks that fail to repair
+func (fst *Filestore) RepairQuarantined(ctx context.Context, q *qfs.Quarantine) (repaired int, err error) {
+	bs, err := fst.localBlockstore()
+	if err != nil {
+		return 0, err
+	}
+
+	fetch := func(ctx context.Context, id cid.Cid) ([]byte, error) {
+		r, err := fst.drv.BlockGet(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadAll(r)
+	}
+	store := func(id cid.Cid, data []byte) error {
+		blk, err := blocks.NewBlockWithCid(data, id)
+		if err != nil {
+			return err
+		}
+		return bs.Put(blk)
+	}
+
+	var firstErr error
+	for _, e := range q.List() {
+		if e.Source != FilestoreType {
+			continue
+		}
+		id, err := cid.Parse(e.Cid)
+		if err != nil {
+			return repaired, err
+		}
+		if err := q.Repair(ctx, id, fetch, store); err != nil {
+			log.Debugw("repairing quarantined block", "cid", e.Cid, "err", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		repaired++
+	}
+	return repaired, firstErr
+}
+
+func (fst *Filestore) localBlockstore() (blockstore.Blockstore, error) {
+	if bd, ok := fst.drv.(blockstoreDriver); ok {
+		if bs := bd.blockstore(); bs != nil {
+			return bs, nil
+		}
+	}
+	return nil, fmt.Errorf("verifying blocks requires a local ipfs repo")
+}
+
+// getVerified reads the file at key through a verifiedGetter, so every block
+// of the file is checked against its CID before it's used
+func (fst *Filestore) getVerified(ctx context.Context, drv driver, key string) (qfs.File, error) {
+	dag := merkledag.NewReadOnlyDagService(verifiedGetter{drv: drv})
+	res := &resolver.Resolver{DAG: dag, ResolveOnce: uio.ResolveUnixfsOnce}
+	f, err := resolveFile(ctx, dag, res, key)
+	return f, typedError(err)
+}
+
+// verifiedGetter fetches dag nodes as raw blocks, hashing each block before
+// decoding it. Drivers that fetch through an HTTP API trust the API to
+// return the right data, a verifiedGetter doesn't
+type verifiedGetter struct {
+	drv driver
+}
+
+var _ format.NodeGetter = verifiedGetter{}
+
+// Get fetches & verifies a single node
+func (g verifiedGetter) Get(ctx context.Context, id cid.Cid) (format.Node, error) {
+	r, err := g.drv.BlockGet(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := qfs.VerifyBlock(id, data); err != nil {
+		return nil, err
+	}
+	blk, err := blocks.NewBlockWithCid(data, id)
+	if err != nil {
+		return nil, err
+	}
+	return format.Decode(blk)
+}
+
+// GetMany fetches & verifies nodes in order
+func (g verifiedGetter) GetMany(ctx context.Context, ids []cid.Cid) <-chan *format.NodeOption {
+	out := make(chan *format.NodeOption, len(ids))
+	go func() {
+		defer close(out)
+		for _, id := range ids {
+			nd, err := g.Get(ctx, id)
+			select {
+			case out <- &format.NodeOption{Node: nd, Err: err}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,146 @@
+package qipfs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/qri-io/qfs"
+)
+
+func TestVerify(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	f, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst := f.(*Filestore)
+
+	dir, err := ioutil.TempDir("", "qipfs_quarantine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	q, err := qfs.NewQuarantine(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := fst.Verify(ctx, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Checked == 0 || len(res.Corrupt) != 0 {
+		t.Fatalf("expected a clean repo to verify. got: %#v", res)
+	}
+
+	// corrupt a block by replacing its data in the blockstore
+	id, err := fst.PutBlock([]byte("original"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := fst.localBlockstore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.DeleteBlock(id); err != nil {
+		t.Fatal(err)
+	}
+	blk, err := blocks.NewBlockWithCid([]byte("corrupted"), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.Put(blk); err != nil {
+		t.Fatal(err)
+	}
+
+	if res, err = fst.Verify(ctx, q); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Corrupt) != 1 {
+		t.Fatalf("expected one corrupt block. got: %#v", res)
+	}
+	if has, _ := bs.Has(id); has {
+		t.Errorf("expected corrupt block to be removed from the blockstore")
+	}
+	if !q.Has(id) {
+		t.Errorf("expected corrupt block to be quarantined")
+	}
+	if _, data, err := q.Inspect(id); err != nil || string(data) != "corrupted" {
+		t.Errorf("expected quarantine to hold corrupt data. got: %q %v", data, err)
+	}
+
+	// repair needs the network, which an offline node can't reach
+	if n, err := fst.RepairQuarantined(ctx, q); n != 0 || err == nil {
+		t.Errorf("expected offline repair to fail. got: %d %v", n, err)
+	}
+	if e := q.List(); len(e) != 1 || e[0].RepairErr == "" {
+		t.Errorf("expected failed repair to be recorded. got: %#v", e)
+	}
+}
+
+func TestVerifyContent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	f, err := NewFilesystem(ctx, map[string]interface{}{
+		"path":          path,
+		"verifyContent": true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fst := f.(*Filestore)
+
+	key, err := fst.Put(ctx, qfs.NewMemfileBytes("a.txt", []byte("verified content")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := fst.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "verified content" {
+		t.Errorf("content mismatch. got: %q", data)
+	}
+
+	// swap the file's block for different data
+	id, err := cid.Parse(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := fst.localBlockstore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.DeleteBlock(id); err != nil {
+		t.Fatal(err)
+	}
+	blk, err := blocks.NewBlockWithCid([]byte("tampered"), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.Put(blk); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fst.Get(ctx, key); !errors.Is(err, qfs.ErrIntegrity) {
+		t.Errorf("expected ErrIntegrity, got: %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package qipfs
+
+import (
+	"context"
+
+	"github.com/qri-io/qfs"
+)
+
+var _ qfs.EventEmitter = (*Filestore)(nil)
+
+// Watch sends an event for each put, delete, pin, unpin & garbage collection
+// made through this filestore at or beneath path. Changes made by other
+// processes sharing the repo aren't reported
+func (fst *Filestore) Watch(ctx context.Context, path string) (<-chan qfs.Event, error) {
+	return fst.events.Watch(ctx, path)
+}
+
+// Events returns the bus changes made through this filestore are published
+// to. Add sinks to the bus to react to changes without polling the pinset
+func (fst *Filestore) Events() *qfs.EventBus {
+	return fst.events
+}
+
+// publish notifies watchers of a change to path. Bare CIDs are reported as
+// /ipfs/ paths
+func (fst *Filestore) publish(t qfs.EventType, path string) {
+	fst.events.Publish(fst.ctx, qfs.Event{Type: t, FS: fst.Type(), Path: pathFromHash(path)})
+}
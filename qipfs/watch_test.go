@@ -0,0 +1,44 @@
+package qipfs
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/qri-io/qfs"
+)
+
+func TestWatch(t *testing.T) {
+	path := InitTestRepo(t)
+	defer os.RemoveAll(path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fs, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := fs.(qfs.Watcher).Watch(ctx, "/ipfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := fs.Put(ctx, qfs.NewMemfileBytes("data.txt", []byte("watch me")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []qfs.EventType{qfs.EventPut, qfs.EventUnpin, qfs.EventDelete}
+	for _, typ := range expect {
+		e := <-events
+		if e.Type != typ || e.Path != key {
+			t.Errorf("expected %s event for %s, got %s for %s", typ, key, e.Type, e.Path)
+		}
+		if e.FS != FilestoreType {
+			t.Errorf("expected event fs %q, got %q", FilestoreType, e.FS)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package qfs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// ErrIntegrity is returned by filesystems that verify content when fetched
+// data doesn't match the identifier it was requested by
+var ErrIntegrity = errors.New("content failed integrity check")
+
+// CorruptBlockError is returned when block data doesn't hash to its CID
+type CorruptBlockError struct {
+	Cid cid.Cid
+	// Actual is the CID the data hashes to
+	Actual cid.Cid
+}
+
+// Error implements the error interface
+func (e *CorruptBlockError) Error() string {
+	return fmt.Sprintf("block %s is corrupt: data hashes to %s", e.Cid, e.Actual)
+}
+
+// Unwrap makes corrupt blocks match ErrIntegrity with errors.Is
+func (e *CorruptBlockError) Unwrap() error { return ErrIntegrity }
+
+// VerifyBlock checks data hashes to id, returning a *CorruptBlockError if it
+// doesn't
+func VerifyBlock(id cid.Cid, data []byte) error {
+	actual, err := id.Prefix().Sum(data)
+	if err != nil {
+		return err
+	}
+	if string(actual.Hash()) != string(id.Hash()) {
+		return &CorruptBlockError{Cid: id, Actual: actual}
+	}
+	return nil
+}
+
+// QuarantineEntry describes a quarantined block
+type QuarantineEntry struct {
+	Cid string `json:"cid"`
+	// Source names the store the block was found in
+	Source string `json:"source"`
+	Reason string `json:"reason"`
+	Size   int64  `json:"size"`
+	// Detected is when the block was quarantined
+	Detected time.Time `json:"detected"`
+	// RepairErr is the last error encountered trying to repair the block
+	RepairErr string `json:"repairErr,omitempty"`
+}
+
+// ErrNotQuarantined is returned when looking up a block that isn't in
+// quarantine
+var ErrNotQuarantined = errors.New("block is not quarantined")
+
+// Quarantine holds blocks that failed verification, keeping the corrupt data
+// for inspection while it's removed from the store it was found in. Stores
+// repair quarantined blocks by fetching a good copy
+type Quarantine struct {
+	dir string
+
+	lk      sync.Mutex
+	entries map[string]QuarantineEntry
+}
+
+const quarantineIndexFile = "index.json"
+
+// NewQuarantine opens or creates a quarantine in dir
+func NewQuarantine(dir string) (*Quarantine, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating quarantine directory: %w", err)
+	}
+	q := &Quarantine{dir: dir, entries: map[string]QuarantineEntry{}}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, quarantineIndexFile))
+	if os.IsNotExist(err) {
+		return q, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &q.entries); err != nil {
+		return nil, fmt.Errorf("reading quarantine index: %w", err)
+	}
+	return q, nil
+}
+
+// Add quarantines corrupt block data found in source
+func (q *Quarantine) Add(id cid.Cid, data []byte, source, reason string) error {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+
+	if err := ioutil.WriteFile(filepath.Join(q.dir, id.String()), data, 0644); err != nil {
+		return err
+	}
+	q.entries[id.String()] = QuarantineEntry{
+		Cid:      id.String(),
+		Source:   source,
+		Reason:   reason,
+		Size:     int64(len(data)),
+		Detected: time.Now(),
+	}
+	return q.writeIndex()
+}
+
+// Has reports whether a block is quarantined
+func (q *Quarantine) Has(id cid.Cid) bool {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+	_, ok := q.entries[id.String()]
+	return ok
+}
+
+// List returns all quarantined blocks, oldest first
+func (q *Quarantine) List() []QuarantineEntry {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+	entries := make([]QuarantineEntry, 0, len(q.entries))
+	for _, e := range q.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Detected.Before(entries[j].Detected) })
+	return entries
+}
+
+// Inspect returns a quarantined block's entry & the corrupt data
+func (q *Quarantine) Inspect(id cid.Cid) (QuarantineEntry, []byte, error) {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+	e, ok := q.entries[id.String()]
+	if !ok {
+		return e, nil, ErrNotQuarantined
+	}
+	data, err := ioutil.ReadFile(filepath.Join(q.dir, id.String()))
+	return e, data, err
+}
+
+// Release removes a block from quarantine, discarding the corrupt data
+func (q *Quarantine) Release(id cid.Cid) error {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+	if _, ok := q.entries[id.String()]; !ok {
+		return ErrNotQuarantined
+	}
+	delete(q.entries, id.String())
+	if err := os.Remove(filepath.Join(q.dir, id.String())); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return q.writeIndex()
+}
+
+// Repair fetches a good copy of a quarantined block, verifies it, and hands
+// it to store. The block is released from quarantine once stored. Failed
+// repairs are recorded on the entry so they can be retried
+func (q *Quarantine) Repair(ctx context.Context, id cid.Cid, fetch func(ctx context.Context, id cid.Cid) ([]byte, error), store func(id cid.Cid, data []byte) error) (err error) {
+	if !q.Has(id) {
+		return ErrNotQuarantined
+	}
+	defer func() {
+		if err != nil {
+			q.recordRepairErr(id, err)
+		}
+	}()
+
+	data, err := fetch(ctx, id)
+	if err != nil {
+		return fmt.Errorf("fetching %s: %w", id, err)
+	}
+	if err := VerifyBlock(id, data); err != nil {
+		return err
+	}
+	if err := store(id, data); err != nil {
+		return fmt.Errorf("storing repaired block %s: %w", id, err)
+	}
+	return q.Release(id)
+}
+
+func (q *Quarantine) recordRepairErr(id cid.Cid, err error) {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+	e, ok := q.entries[id.String()]
+	if !ok {
+		return
+	}
+	e.RepairErr = err.Error()
+	q.entries[id.String()] = e
+	if err := q.writeIndex(); err != nil {
+		log.Debugw("writing quarantine index", "err", err)
+	}
+}
+
+// writeIndex persists entries. callers must hold the lock
+func (q *Quarantine) writeIndex() error {
+	data, err := json.Marshal(q.entries)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(q.dir, quarantineIndexFile), data, 0644)
+}
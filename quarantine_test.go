@@ -0,0 +1,117 @@
+package qfs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+)
+
+func TestQuarantine(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "qfs_quarantine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	good := []byte("good")
+	id, err := cid.V1Builder{Codec: cid.Raw, MhType: multihash.SHA2_256}.Sum(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyBlock(id, good); err != nil {
+		t.Fatal(err)
+	}
+	verr := VerifyBlock(id, []byte("bad"))
+	cerr := &CorruptBlockError{}
+	if !errors.As(verr, &cerr) {
+		t.Fatalf("expected CorruptBlockError. got: %v", verr)
+	}
+
+	q, err := NewQuarantine(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Add(id, []byte("bad"), "test", verr.Error()); err != nil {
+		t.Fatal(err)
+	}
+
+	// quarantine persists across opens
+	if q, err = NewQuarantine(dir); err != nil {
+		t.Fatal(err)
+	}
+	entries := q.List()
+	if len(entries) != 1 || entries[0].Source != "test" || entries[0].Size != 3 {
+		t.Fatalf("unexpected entries: %#v", entries)
+	}
+
+	fetchBad := func(context.Context, cid.Cid) ([]byte, error) { return []byte("still bad"), nil }
+	var stored []byte
+	store := func(_ cid.Cid, data []byte) error { stored = data; return nil }
+	if err := q.Repair(ctx, id, fetchBad, store); !errors.As(err, &cerr) {
+		t.Errorf("expected repair with bad data to fail verification. got: %v", err)
+	}
+	if !q.Has(id) || q.List()[0].RepairErr == "" {
+		t.Errorf("expected failed repair to leave block quarantined with an error")
+	}
+
+	fetchGood := func(context.Context, cid.Cid) ([]byte, error) { return good, nil }
+	if err := q.Repair(ctx, id, fetchGood, store); err != nil {
+		t.Fatal(err)
+	}
+	if string(stored) != "good" {
+		t.Errorf("expected repaired block to be stored. got: %q", stored)
+	}
+	if q.Has(id) {
+		t.Errorf("expected repaired block to be released")
+	}
+	if err := q.Release(id); !errors.Is(err, ErrNotQuarantined) {
+		t.Errorf("expected ErrNotQuarantined. got: %v", err)
+	}
+}
+
+func TestDiskBlockCacheQuarantinesCorruptBlocks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qfs_block_cache_quarantine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := NewDiskBlockCache(filepath.Join(dir, "cache"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewQuarantine(filepath.Join(dir, "quarantine"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetQuarantine(q)
+
+	data := []byte("block")
+	id, err := cid.V1Builder{Codec: cid.Raw, MhType: multihash.SHA2_256}.Sum(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.PutBlock(id, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "cache", blockCacheKey(id)), []byte("rot"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.GetBlock(id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected corrupt cached block to read as a miss. got: %v", err)
+	}
+	if c.HasBlock(id) {
+		t.Errorf("expected corrupt block to be dropped from the cache")
+	}
+	if !q.Has(id) {
+		t.Errorf("expected corrupt block to be quarantined")
+	}
+}
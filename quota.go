@@ -0,0 +1,305 @@
+package qfs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrQuotaExceeded matches errors returned by puts that would exceed a
+// quota
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaError is returned when a put would take a namespace past its quota
+type QuotaError struct {
+	Namespace string
+	// Quota is the namespace's limit in bytes
+	Quota int64
+	// Used is the bytes the namespace had written before the put
+	Used int64
+}
+
+// Error implements the error interface
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("namespace %q: %d of %d bytes used: %s", e.Namespace, e.Used, e.Quota, ErrQuotaExceeded)
+}
+
+// Unwrap makes quota errors match ErrQuotaExceeded with errors.Is
+func (e *QuotaError) Unwrap() error { return ErrQuotaExceeded }
+
+type quotaNamespaceCtxKey struct{}
+
+// WithQuotaNamespace sets the namespace puts made with ctx count against
+func WithQuotaNamespace(ctx context.Context, namespace string) context.Context {
+	return context.WithValue(ctx, quotaNamespaceCtxKey{}, namespace)
+}
+
+// QuotaNamespaceFromContext returns the namespace set by WithQuotaNamespace
+func QuotaNamespaceFromContext(ctx context.Context) (string, bool) {
+	ns, ok := ctx.Value(quotaNamespaceCtxKey{}).(string)
+	return ns, ok
+}
+
+// QuotaStore persists the bytes written by each namespace
+type QuotaStore interface {
+	Usage(namespace string) (int64, error)
+	SetUsage(namespace string, used int64) error
+}
+
+// MemQuotaStore keeps usage in memory
+type MemQuotaStore struct {
+	lk   sync.Mutex
+	used map[string]int64
+}
+
+var _ QuotaStore = (*MemQuotaStore)(nil)
+
+// NewMemQuotaStore creates an empty in-memory store
+func NewMemQuotaStore() *MemQuotaStore {
+	return &MemQuotaStore{used: map[string]int64{}}
+}
+
+// Usage returns the bytes namespace has written
+func (s *MemQuotaStore) Usage(namespace string) (int64, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.used[namespace], nil
+}
+
+// SetUsage records the bytes namespace has written
+func (s *MemQuotaStore) SetUsage(namespace string, used int64) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.used[namespace] = used
+	return nil
+}
+
+// FileQuotaStore keeps usage in memory, saving every change to a JSON file
+type FileQuotaStore struct {
+	path string
+	mem  *MemQuotaStore
+}
+
+var _ QuotaStore = (*FileQuotaStore)(nil)
+
+// NewFileQuotaStore loads usage saved at path, starting empty if there's no
+// file at path yet
+func NewFileQuotaStore(path string) (*FileQuotaStore, error) {
+	s := &FileQuotaStore{path: path, mem: NewMemQuotaStore()}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.mem.used); err != nil {
+		return nil, fmt.Errorf("reading quota usage: %w", err)
+	}
+	return s, nil
+}
+
+// Usage returns the bytes namespace has written
+func (s *FileQuotaStore) Usage(namespace string) (int64, error) {
+	return s.mem.Usage(namespace)
+}
+
+// SetUsage records the bytes namespace has written, replacing the file at
+// the store's path
+func (s *FileQuotaStore) SetUsage(namespace string, used int64) error {
+	s.mem.lk.Lock()
+	defer s.mem.lk.Unlock()
+	s.mem.used[namespace] = used
+	data, err := json.Marshal(s.mem.used)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// QuotaConfig configures a QuotaFS
+type QuotaConfig struct {
+	// Quota is the bytes each namespace may write. Zero or less is unlimited
+	Quota int64
+	// Quotas overrides Quota for specific namespaces
+	Quotas map[string]int64
+	// Namespace names the namespace a put counts against. defaults to the
+	// namespace set with WithQuotaNamespace, or the first segment of the put
+	// file's path
+	Namespace func(ctx context.Context, file File) string
+	// Store persists usage. defaults to a MemQuotaStore
+	Store QuotaStore
+}
+
+// QuotaFS wraps a filesystem, counting the bytes written to it by each
+// namespace & rejecting puts that would take a namespace past its quota with
+// a *QuotaError. Usage counts bytes written, so writing content twice counts
+// twice, and deletes don't return space to a namespace. Puts of files with
+// an unknown size are limited to the namespace's remaining quota as they're
+// read
+type QuotaFS struct {
+	Filesystem
+	cfg QuotaConfig
+
+	lk sync.Mutex
+	// reserved is the quota held by puts in progress
+	reserved map[string]int64
+}
+
+var _ Filesystem = (*QuotaFS)(nil)
+
+// NewQuotaFS wraps fs with quotas
+func NewQuotaFS(fs Filesystem, cfg QuotaConfig) *QuotaFS {
+	if cfg.Store == nil {
+		cfg.Store = NewMemQuotaStore()
+	}
+	if cfg.Namespace == nil {
+		cfg.Namespace = defaultQuotaNamespace
+	}
+	return &QuotaFS{Filesystem: fs, cfg: cfg, reserved: map[string]int64{}}
+}
+
+func defaultQuotaNamespace(ctx context.Context, file File) string {
+	if ns, ok := QuotaNamespaceFromContext(ctx); ok {
+		return ns
+	}
+	return strings.SplitN(strings.TrimPrefix(file.FullPath(), "/"), "/", 2)[0]
+}
+
+// Usage returns the bytes namespace has written
+func (q *QuotaFS) Usage(namespace string) (int64, error) {
+	return q.cfg.Store.Usage(namespace)
+}
+
+// quota returns the limit for namespace, zero or less for no limit
+func (q *QuotaFS) quota(namespace string) int64 {
+	if quota, ok := q.cfg.Quotas[namespace]; ok {
+		return quota
+	}
+	return q.cfg.Quota
+}
+
+// Put writes a file if its namespace has enough quota left, adding the bytes
+// written to the namespace's usage
+func (q *QuotaFS) Put(ctx context.Context, file File) (string, error) {
+	ns := q.cfg.Namespace(ctx, file)
+	quota := q.quota(ns)
+	if quota <= 0 {
+		return q.put(ctx, ns, file)
+	}
+
+	size := FileSize(file)
+	q.lk.Lock()
+	used, err := q.cfg.Store.Usage(ns)
+	if err != nil {
+		q.lk.Unlock()
+		return "", err
+	}
+	remaining := quota - used - q.reserved[ns]
+	if remaining <= 0 || size > remaining {
+		q.lk.Unlock()
+		return "", &QuotaError{Namespace: ns, Quota: quota, Used: used}
+	}
+	reserve := remaining
+	if size >= 0 {
+		reserve = size
+	}
+	q.reserved[ns] += reserve
+	q.lk.Unlock()
+
+	defer func() {
+		q.lk.Lock()
+		q.reserved[ns] -= reserve
+		q.lk.Unlock()
+	}()
+
+	limited := &quotaFile{File: file, c: &quotaCounter{limit: reserve, err: &QuotaError{Namespace: ns, Quota: quota, Used: used}}}
+	return q.put(ctx, ns, limited)
+}
+
+// put writes file, counting the bytes read from it against ns
+func (q *QuotaFS) put(ctx context.Context, ns string, file File) (string, error) {
+	counted, ok := file.(*quotaFile)
+	if !ok {
+		counted = &quotaFile{File: file, c: &quotaCounter{limit: -1}}
+	}
+	path, err := q.Filesystem.Put(ctx, counted)
+	if err != nil {
+		// filesystems don't all wrap read errors, report the quota error
+		// directly
+		if counted.c.exceeded() {
+			return "", counted.c.err
+		}
+		return "", err
+	}
+
+	q.lk.Lock()
+	defer q.lk.Unlock()
+	used, err := q.cfg.Store.Usage(ns)
+	if err != nil {
+		return "", err
+	}
+	if err := q.cfg.Store.SetUsage(ns, used+counted.c.read); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// quotaCounter counts bytes read from a file tree, failing reads past limit.
+// A limit below zero is unlimited
+type quotaCounter struct {
+	lk    sync.Mutex
+	read  int64
+	limit int64
+	err   error
+}
+
+func (c *quotaCounter) exceeded() bool {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	return c.limit >= 0 && c.read > c.limit
+}
+
+// quotaFile counts reads of a file & the files of a directory
+type quotaFile struct {
+	File
+	c *quotaCounter
+}
+
+func (f *quotaFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	f.c.lk.Lock()
+	defer f.c.lk.Unlock()
+	f.c.read += int64(n)
+	if f.c.limit >= 0 && f.c.read > f.c.limit {
+		return n, f.c.err
+	}
+	return n, err
+}
+
+func (f *quotaFile) NextFile() (File, error) {
+	ch, err := f.File.NextFile()
+	if err != nil {
+		return nil, err
+	}
+	return &quotaFile{File: ch, c: f.c}, nil
+}
@@ -0,0 +1,77 @@
+package qfs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQuotaFS(t *testing.T) {
+	ctx := context.Background()
+	fs := NewQuotaFS(NewMemFS(), QuotaConfig{
+		Quota:  10,
+		Quotas: map[string]int64{"big": 100},
+	})
+
+	if _, err := fs.Put(ctx, NewMemfileBytes("/alice/a.txt", []byte("123456"))); err != nil {
+		t.Fatal(err)
+	}
+	_, err := fs.Put(ctx, NewMemfileBytes("/alice/b.txt", []byte("123456")))
+	var qerr *QuotaError
+	if !errors.As(err, &qerr) || !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected a quota error. got: %v", err)
+	}
+	if qerr.Namespace != "alice" || qerr.Used != 6 || qerr.Quota != 10 {
+		t.Errorf("unexpected quota error: %#v", qerr)
+	}
+
+	// namespaces are counted separately, and can be set on the context
+	if _, err := fs.Put(ctx, NewMemfileBytes("/bob/a.txt", []byte("123456"))); err != nil {
+		t.Errorf("expected another namespace to have its own quota. got: %s", err)
+	}
+	bigCtx := WithQuotaNamespace(ctx, "big")
+	if _, err := fs.Put(bigCtx, NewMemfileBytes("/alice/c.txt", []byte(strings.Repeat("a", 50)))); err != nil {
+		t.Errorf("expected namespace override to use its own quota. got: %s", err)
+	}
+	if used, _ := fs.Usage("big"); used != 50 {
+		t.Errorf("expected 50 bytes used. got: %d", used)
+	}
+
+	// files of unknown size fail once they're read past the quota
+	unsized := NewMemfileReader("/carol/a.txt", strings.NewReader(strings.Repeat("a", 20)))
+	if _, err := fs.Put(ctx, unsized); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected unsized put past quota to fail. got: %v", err)
+	}
+	if used, _ := fs.Usage("carol"); used != 0 {
+		t.Errorf("expected a failed put not to count. got: %d", used)
+	}
+}
+
+func TestFileQuotaStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qfs_quota")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "usage.json")
+
+	store, err := NewFileQuotaStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetUsage("alice", 42); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewFileQuotaStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used, err := reloaded.Usage("alice"); err != nil || used != 42 {
+		t.Errorf("expected reloaded usage of 42. got: %d, %v", used, err)
+	}
+}
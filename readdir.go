@@ -0,0 +1,113 @@
+package qfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+)
+
+// DirEntry describes a child of a directory without opening it
+type DirEntry struct {
+	Name string
+	// Size is the length of a file in bytes, -1 for directories & files of
+	// unknown size
+	Size int64
+	// Cid is the content identifier of the entry, cid.Undef when the
+	// filesystem doesn't address content by CID
+	Cid   cid.Cid
+	IsDir bool
+}
+
+// ReadDirFS is an optional interface for filesystems that can list a
+// directory without reading its children
+type ReadDirFS interface {
+	ReadDir(ctx context.Context, path string) ([]DirEntry, error)
+}
+
+// ReadDir lists the directory at path, sorted by name. Filesystems that
+// implement ReadDirFS list directories directly, others fall back to reading
+// the directory with Get & NextFile
+func ReadDir(ctx context.Context, fs Filesystem, path string) ([]DirEntry, error) {
+	if rd, ok := fs.(ReadDirFS); ok {
+		return rd.ReadDir(ctx, path)
+	}
+
+	dir, err := fs.Get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+	if !dir.IsDirectory() {
+		return nil, ErrNotDirectory
+	}
+
+	entries := []DirEntry{}
+	for {
+		f, err := dir.NextFile()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		entries = append(entries, DirEntry{
+			Name:  f.FileName(),
+			Size:  FileSize(f),
+			IsDir: f.IsDirectory(),
+		})
+	}
+	SortDirEntries(entries)
+	return entries, nil
+}
+
+// SortDirEntries sorts entries by name
+func SortDirEntries(entries []DirEntry) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+}
+
+var _ ReadDirFS = (*MemFS)(nil)
+
+// ReadDir lists a directory in the store
+func (m *MemFS) ReadDir(ctx context.Context, key string) ([]DirEntry, error) {
+	key = strings.TrimPrefix(key, "/"+MemFilestoreType+"/")
+	parts := strings.Split(key, "/")
+
+	m.filesLk.Lock()
+	defer m.filesLk.Unlock()
+
+	f := m.Files[parts[0]]
+	for _, part := range parts[1:] {
+		dir, ok := f.(fsDir)
+		if !ok {
+			break
+		}
+		f = m.Files[dir.files[part]]
+	}
+	if f == nil {
+		return nil, ErrNotFound
+	}
+	dir, ok := f.(fsDir)
+	if !ok {
+		return nil, ErrNotDirectory
+	}
+
+	entries := make([]DirEntry, 0, len(dir.files))
+	for name, hash := range dir.files {
+		e := DirEntry{Name: name, Size: -1}
+		if id, err := cid.Decode(hash); err == nil {
+			e.Cid = id
+		}
+		switch ch := m.Files[hash].(type) {
+		case fsDir:
+			e.IsDir = true
+		case fsFile:
+			e.Size = int64(len(ch.data))
+		}
+		entries = append(entries, e)
+	}
+	SortDirEntries(entries)
+	return entries, nil
+}
@@ -0,0 +1,60 @@
+package qfs
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestReadDir(t *testing.T) {
+	ctx := context.Background()
+	fs := NewMemFS()
+	key, err := fs.Put(ctx, NewMemdir("/a",
+		NewMemfileBytes("b.txt", []byte("bravo")),
+		NewMemfileBytes("a.txt", []byte("a")),
+		NewMemdir("sub", NewMemfileBytes("c.txt", []byte("c"))),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []DirEntry{
+		{Name: "a.txt", Size: 1},
+		{Name: "b.txt", Size: 5},
+		{Name: "sub", Size: -1, IsDir: true},
+	}
+	ignoreCid := cmpopts.IgnoreFields(DirEntry{}, "Cid")
+
+	got, err := fs.ReadDir(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(expect, got, ignoreCid); diff != "" {
+		t.Errorf("entries mismatch (-want +got):\n%s", diff)
+	}
+	for _, e := range got {
+		if !e.Cid.Defined() {
+			t.Errorf("expected mem entry %q to have a cid", e.Name)
+		}
+	}
+
+	// filesystems that don't implement ReadDirFS are listed by reading the
+	// directory
+	got, err = ReadDir(ctx, struct{ Filesystem }{fs}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(expect, got, ignoreCid); diff != "" {
+		t.Errorf("fallback entries mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := fs.ReadDir(ctx, key+"/a.txt"); !errors.Is(err, ErrNotDirectory) {
+		t.Errorf("expected ErrNotDirectory listing a file, got %v", err)
+	}
+	if _, err := fs.ReadDir(ctx, "/mem/QmMissing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound listing a missing directory, got %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+package qfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// ErrRefProtected is returned when unpinning or deleting content a named ref
+// still references
+var ErrRefProtected = errors.New("content is referenced by a ref")
+
+// RefProtector tracks the roots named refs point to. Content reachable from
+// any ref root can't be unpinned or deleted through a ProtectedFS until the
+// ref moves, closing the window where cleanup jobs remove a head that was
+// just written
+type RefProtector struct {
+	lk   sync.RWMutex
+	refs map[string]string
+}
+
+// NewRefProtector creates an empty RefProtector
+func NewRefProtector() *RefProtector {
+	return &RefProtector{refs: map[string]string{}}
+}
+
+// SetRef points a named ref at root, releasing whatever it pointed to before
+func (p *RefProtector) SetRef(name, root string) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	p.refs[name] = root
+}
+
+// RemoveRef deletes a named ref
+func (p *RefProtector) RemoveRef(name string) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	delete(p.refs, name)
+}
+
+// Refs returns a copy of all refs, keyed by name
+func (p *RefProtector) Refs() map[string]string {
+	p.lk.RLock()
+	defer p.lk.RUnlock()
+	refs := make(map[string]string, len(p.refs))
+	for name, root := range p.refs {
+		refs[name] = root
+	}
+	return refs
+}
+
+// Protecting returns the name of a ref that references path. When store is a
+// MerkleDagStore, paths reachable by links from a ref root are also
+// protected. Refs are checked in name order
+func (p *RefProtector) Protecting(ctx context.Context, store Filesystem, path string) (ref string, protected bool, err error) {
+	refs := p.Refs()
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	target, _, targetIsCA := splitCAPath(path)
+	dag, isDag := store.(MerkleDagStore)
+	for _, name := range names {
+		root := refs[name]
+		if root == path {
+			return name, true, nil
+		}
+		if !targetIsCA {
+			continue
+		}
+		rootID, _, ok := splitCAPath(root)
+		if !ok {
+			continue
+		}
+		if rootID.Equals(target) {
+			return name, true, nil
+		}
+		if isDag {
+			reachable, err := reachableFrom(ctx, dag, rootID, target, map[cid.Cid]struct{}{})
+			if err != nil {
+				return "", false, fmt.Errorf("walking ref %q: %w", name, err)
+			}
+			if reachable {
+				return name, true, nil
+			}
+		}
+	}
+	return "", false, nil
+}
+
+// reachableFrom walks links from root looking for target
+func reachableFrom(ctx context.Context, dag MerkleDagStore, root, target cid.Cid, seen map[cid.Cid]struct{}) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if _, ok := seen[root]; ok {
+		return false, nil
+	}
+	seen[root] = struct{}{}
+
+	nd, err := dag.GetNode(root)
+	if err != nil {
+		return false, err
+	}
+	for _, lnk := range nd.Links().Slice() {
+		if lnk.Cid.Equals(target) {
+			return true, nil
+		}
+		if lnk.IsFile {
+			continue
+		}
+		if ok, err := reachableFrom(ctx, dag, lnk.Cid, target, seen); err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// ProtectedFS wraps a filesystem, refusing to unpin or delete content held
+// by a ref
+type ProtectedFS struct {
+	Filesystem
+	Refs *RefProtector
+}
+
+var (
+	_ Filesystem   = (*ProtectedFS)(nil)
+	_ PinningFS    = (*ProtectedFS)(nil)
+	_ DescribingFS = (*ProtectedFS)(nil)
+)
+
+// NewProtectedFS wraps fs with ref protection
+func NewProtectedFS(fs Filesystem, refs *RefProtector) *ProtectedFS {
+	return &ProtectedFS{Filesystem: fs, Refs: refs}
+}
+
+// Describe returns the wrapped filesystem's descriptor
+func (fs *ProtectedFS) Describe() Descriptor { return Describe(fs.Filesystem) }
+
+// Delete removes a file or directory from the filesystem unless a ref holds it
+func (fs *ProtectedFS) Delete(ctx context.Context, path string) error {
+	if err := fs.checkUnprotected(ctx, path); err != nil {
+		return err
+	}
+	return fs.Filesystem.Delete(ctx, path)
+}
+
+// Pin passes through to the wrapped filesystem
+func (fs *ProtectedFS) Pin(ctx context.Context, key string, recursive bool) error {
+	pfs, ok := fs.Filesystem.(PinningFS)
+	if !ok {
+		return fmt.Errorf("%s filesystem doesn't support pinning", fs.Type())
+	}
+	return pfs.Pin(ctx, key, recursive)
+}
+
+// Unpin removes a pin unless a ref holds the content
+func (fs *ProtectedFS) Unpin(ctx context.Context, key string, recursive bool) error {
+	pfs, ok := fs.Filesystem.(PinningFS)
+	if !ok {
+		return fmt.Errorf("%s filesystem doesn't support pinning", fs.Type())
+	}
+	if err := fs.checkUnprotected(ctx, key); err != nil {
+		return err
+	}
+	return pfs.Unpin(ctx, key, recursive)
+}
+
+func (fs *ProtectedFS) checkUnprotected(ctx context.Context, path string) error {
+	ref, protected, err := fs.Refs.Protecting(ctx, fs.Filesystem, path)
+	if err != nil {
+		return err
+	}
+	if protected {
+		return fmt.Errorf("%w: %q is held by ref %q", ErrRefProtected, path, ref)
+	}
+	return nil
+}
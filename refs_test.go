@@ -0,0 +1,76 @@
+package qfs
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// linkedPinFS is a pinning dag store with configurable links
+type linkedPinFS struct {
+	*MemFS
+	*memPinner
+	links map[cid.Cid][]Link
+}
+
+func (fs *linkedPinFS) GetNode(id cid.Cid, path ...string) (DagNode, error) {
+	return linkedNode{id: id, links: fs.links[id]}, nil
+}
+
+type linkedNode struct {
+	id    cid.Cid
+	links []Link
+}
+
+func (n linkedNode) Size() int64  { return 0 }
+func (n linkedNode) Cid() cid.Cid { return n.id }
+func (n linkedNode) Links() Links { return NewLinks(n.links...) }
+
+func TestProtectedFS(t *testing.T) {
+	ctx := context.Background()
+	mkcid := func(s string) cid.Cid {
+		id, err := cid.V0Builder{}.Sum([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	root, dir, leaf, other := mkcid("root"), mkcid("dir"), mkcid("leaf"), mkcid("other")
+	path := func(id cid.Cid) string { return "/mem/" + id.String() }
+
+	store := &linkedPinFS{
+		MemFS:     NewMemFS(),
+		memPinner: newMemPinner(),
+		links: map[cid.Cid][]Link{
+			root: {{Name: "dir", Cid: dir}},
+			dir:  {{Name: "leaf", Cid: leaf, IsFile: true}},
+		},
+	}
+	for _, id := range []cid.Cid{root, leaf, other} {
+		store.Pin(ctx, path(id), true)
+	}
+
+	refs := NewRefProtector()
+	refs.SetRef("me/dataset", path(root))
+	fs := NewProtectedFS(store, refs)
+
+	for _, id := range []cid.Cid{root, leaf} {
+		if err := fs.Unpin(ctx, path(id), true); !errors.Is(err, ErrRefProtected) {
+			t.Errorf("expected unpinning content reachable from a ref to fail. got: %v", err)
+		}
+	}
+	if err := fs.Delete(ctx, path(root)+"/dir"); !errors.Is(err, ErrRefProtected) {
+		t.Errorf("expected deleting a ref root to fail. got: %v", err)
+	}
+	if err := fs.Unpin(ctx, path(other), true); err != nil {
+		t.Errorf("expected unreferenced content to unpin. got: %s", err)
+	}
+
+	// moving the ref releases the old root
+	refs.SetRef("me/dataset", path(other))
+	if err := fs.Unpin(ctx, path(leaf), true); err != nil {
+		t.Errorf("expected content released by a ref move to unpin. got: %s", err)
+	}
+}
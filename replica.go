@@ -0,0 +1,203 @@
+package qfs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ipfs/go-cid"
+)
+
+// replicaCheckpointInterval is the number of blocks verified between
+// checkpoint writes
+const replicaCheckpointInterval = 256
+
+// BlockManifest lists every block of a replicated DAG. Replicators record the
+// blocks they copy so the target can be verified block by block
+type BlockManifest struct {
+	// Roots are the CIDs of the replicated DAG roots
+	Roots []string `json:"roots"`
+	// Blocks are the CIDs of every block to verify, roots included
+	Blocks []string `json:"blocks"`
+}
+
+// digest identifies a manifest's block list, so a checkpoint is never
+// applied to a different manifest
+func (m BlockManifest) digest() string {
+	h := sha256.New()
+	for _, b := range m.Blocks {
+		h.Write([]byte(b))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ReplicaReport describes a VerifyReplica run
+type ReplicaReport struct {
+	// Checked is the number of blocks read & hashed in this run
+	Checked int `json:"checked"`
+	// Resumed is the number of blocks a checkpoint showed were already
+	// verified, which weren't checked again
+	Resumed int `json:"resumed"`
+	// Missing lists blocks the target doesn't have
+	Missing []string `json:"missing"`
+	// Corrupt lists blocks whose content doesn't match their CID
+	Corrupt []string `json:"corrupt"`
+}
+
+// Verified reports whether every block in the manifest is present & intact
+// on the target. Sources shouldn't release their copy of a DAG until a
+// verification of the replica reports true
+func (r ReplicaReport) Verified() bool {
+	return len(r.Missing) == 0 && len(r.Corrupt) == 0
+}
+
+// replicaCheckpoint is the progress of a verification saved between runs
+type replicaCheckpoint struct {
+	Manifest string `json:"manifest"`
+	// Next is the index of the first manifest block not yet checked
+	Next int `json:"next"`
+	// Failed lists blocks before Next that failed & are checked again when
+	// verification resumes
+	Failed []string `json:"failed"`
+}
+
+// VerifyReplica confirms every block in manifest exists on target & hashes to
+// its CID. The target must be able to read blocks by CID. When checkpoint is
+// a file path, progress is saved there periodically & when VerifyReplica
+// returns, and a later call with the same manifest & checkpoint resumes where
+// the last call stopped, re-checking only blocks that failed. An empty
+// checkpoint verifies the whole manifest
+func VerifyReplica(ctx context.Context, target Filesystem, manifest BlockManifest, checkpoint string) (report ReplicaReport, err error) {
+	report = ReplicaReport{Missing: []string{}, Corrupt: []string{}}
+	store, ok := target.(MerkleDagStore)
+	if !ok {
+		return report, fmt.Errorf("verifying replica: %q filesystem can't read blocks", target.Type())
+	}
+
+	cp := replicaCheckpoint{Manifest: manifest.digest(), Failed: []string{}}
+	var retry []string
+	if checkpoint != "" {
+		prev := &replicaCheckpoint{}
+		found, err := loadCheckpoint(checkpoint, prev)
+		if err != nil {
+			return report, fmt.Errorf("reading replica checkpoint: %w", err)
+		}
+		if found && prev.Manifest == cp.Manifest && prev.Next <= len(manifest.Blocks) {
+			cp.Next = prev.Next
+			retry = prev.Failed
+			report.Resumed = prev.Next - len(prev.Failed)
+		}
+		defer func() {
+			if serr := saveCheckpoint(checkpoint, cp); err == nil {
+				err = serr
+			}
+		}()
+	}
+
+	for i, b := range retry {
+		ok, err := verifyReplicaBlock(ctx, store, b, &report)
+		if err != nil {
+			// blocks not yet re-checked are still pending
+			cp.Failed = append(cp.Failed, retry[i:]...)
+			return report, err
+		}
+		if !ok {
+			cp.Failed = append(cp.Failed, b)
+		}
+	}
+
+	for cp.Next < len(manifest.Blocks) {
+		b := manifest.Blocks[cp.Next]
+		ok, err := verifyReplicaBlock(ctx, store, b, &report)
+		if err != nil {
+			return report, err
+		}
+		if !ok {
+			cp.Failed = append(cp.Failed, b)
+		}
+		cp.Next++
+		if checkpoint != "" && cp.Next%replicaCheckpointInterval == 0 {
+			if err := saveCheckpoint(checkpoint, cp); err != nil {
+				return report, err
+			}
+		}
+	}
+	return report, nil
+}
+
+// verifyReplicaBlock checks a single block, recording failures in report.
+// Only errors that should stop verification are returned
+func verifyReplicaBlock(ctx context.Context, store MerkleDagStore, block string, report *ReplicaReport) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	id, err := cid.Parse(block)
+	if err != nil {
+		return false, fmt.Errorf("invalid manifest block %q: %w", block, err)
+	}
+
+	report.Checked++
+	data, err := GetBlockBytes(store, id)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return false, ctxErr
+		}
+		log.Debugw("replica block missing", "cid", block, "err", err)
+		report.Missing = append(report.Missing, block)
+		return false, nil
+	}
+	if err := VerifyBlock(id, data); err != nil {
+		var corrupt *CorruptBlockError
+		if !errors.As(err, &corrupt) {
+			return false, err
+		}
+		report.Corrupt = append(report.Corrupt, block)
+		return false, nil
+	}
+	return true, nil
+}
+
+// loadCheckpoint reads a JSON checkpoint at path into v, reporting whether
+// the checkpoint exists
+func loadCheckpoint(path string, v interface{}) (bool, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// saveCheckpoint writes v to path as JSON, replacing any existing file
+// atomically
+func saveCheckpoint(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
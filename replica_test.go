@@ -0,0 +1,102 @@
+package qfs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+)
+
+func TestVerifyReplica(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "replica")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	checkpoint := filepath.Join(dir, "checkpoint.json")
+
+	target := NewMemFS()
+	m := BlockManifest{}
+	for _, data := range []string{"a", "b", "c"} {
+		id, err := target.PutBlock([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Blocks = append(m.Blocks, id.String())
+	}
+	mh, _ := multihash.Sum([]byte("d"), multihash.SHA2_256, -1)
+	missing := cid.NewCidV0(mh)
+	m.Blocks = append(m.Blocks, missing.String())
+	m.Roots = []string{m.Blocks[0]}
+
+	report, err := VerifyReplica(ctx, target, m, checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Verified() {
+		t.Error("expected replica with a missing block to fail verification")
+	}
+	if report.Checked != 4 || len(report.Missing) != 1 || report.Missing[0] != missing.String() {
+		t.Errorf("unexpected report: %#v", report)
+	}
+
+	// resuming only re-checks the block that failed
+	if _, err := target.PutBlock([]byte("d")); err != nil {
+		t.Fatal(err)
+	}
+	report, err = VerifyReplica(ctx, target, m, checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Verified() {
+		t.Errorf("expected replica to verify. got: %#v", report)
+	}
+	if report.Checked != 1 || report.Resumed != 3 {
+		t.Errorf("expected resumed run to check 1 block & resume 3. got: %#v", report)
+	}
+
+	// without a checkpoint every block is checked, catching corruption
+	target.Files[m.Blocks[1]] = fsFile{data: []byte("rot")}
+	report, err = VerifyReplica(ctx, target, m, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Corrupt) != 1 || report.Corrupt[0] != m.Blocks[1] {
+		t.Errorf("expected corrupt block to be reported. got: %#v", report)
+	}
+}
+
+func TestVerifyReplicaCancelled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replica")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	checkpoint := filepath.Join(dir, "checkpoint.json")
+
+	target := NewMemFS()
+	id, err := target.PutBlock([]byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := BlockManifest{Roots: []string{id.String()}, Blocks: []string{id.String()}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := VerifyReplica(ctx, target, m, checkpoint); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	report, err := VerifyReplica(context.Background(), target, m, checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Checked != 1 || !report.Verified() {
+		t.Errorf("expected cancelled verification to resume from the start. got: %#v", report)
+	}
+}
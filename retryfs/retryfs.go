@@ -0,0 +1,380 @@
+// Package retryfs wraps a filesystem, retrying operations that fail with
+// transient errors. Retries back off exponentially with jitter, so many
+// clients retrying against the same IPFS node or remote API spread out
+// instead of retrying in lockstep.
+//
+// Backends mark errors worth retrying by wrapping qfs.ErrTransient. Network
+// timeouts & failed connections are transient too
+package retryfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	logging "github.com/ipfs/go-log"
+	"github.com/mitchellh/mapstructure"
+	"github.com/qri-io/qfs"
+)
+
+var log = logging.Logger("retryfs")
+
+// MiddlewareType names retry middleware in configuration
+const MiddlewareType = "retry"
+
+const (
+	// DefaultMaxAttempts is the number of attempts made at an operation when
+	// none is configured, including the first
+	DefaultMaxAttempts = 4
+	// DefaultMinBackoff is the delay before the first retry when none is
+	// configured
+	DefaultMinBackoff = 100 * time.Millisecond
+	// DefaultMaxBackoff caps the delay between retries when no cap is
+	// configured
+	DefaultMaxBackoff = 10 * time.Second
+)
+
+// Names of operations other than those of the qfs.FaultOp constants, for
+// Config.OpAttempts
+const (
+	OpHasMany  = "hasmany"
+	OpStat     = "stat"
+	OpReadDir  = "readdir"
+	OpPin      = "pin"
+	OpUnpin    = "unpin"
+	OpIsPinned = "ispinned"
+)
+
+// Config configures retries
+type Config struct {
+	// MaxAttempts caps the attempts made at each operation, including the
+	// first. defaults to DefaultMaxAttempts
+	MaxAttempts int
+	// OpAttempts overrides MaxAttempts for operations named by the
+	// qfs.FaultOp & Op constants. An op with 1 attempt is never retried
+	OpAttempts map[string]int
+	// MinBackoff is the delay before the first retry, doubling each retry.
+	// defaults to DefaultMinBackoff
+	MinBackoff time.Duration
+	// MaxBackoff caps the delay between retries. defaults to
+	// DefaultMaxBackoff
+	MaxBackoff time.Duration
+	// AttemptTimeout bounds each attempt. Attempts that time out are retried
+	// while the operation's context is live. Zero disables the timeout
+	AttemptTimeout time.Duration
+	// IsTransient reports whether an error is worth retrying. defaults to
+	// IsTransient
+	IsTransient func(err error) bool `mapstructure:"-"`
+}
+
+// FS retries operations on a wrapped filesystem. An FS has the same type &
+// descriptor as the filesystem it wraps, so it can stand in for it in a Mux.
+// Batched reads, stats, directory listings & pins are retried too, falling
+// back like the qfs package functions of the same names when the wrapped
+// filesystem doesn't support them.
+//
+// Retries never outlast the operation's context: an operation whose deadline
+// would pass before the next retry fails with the last error instead of
+// waiting. Puts are retried only if the failed attempt read nothing from the
+// file being put, files can't be rewound
+type FS struct {
+	qfs.Filesystem
+	cfg Config
+
+	retries int64
+}
+
+var (
+	_ qfs.Filesystem    = (*FS)(nil)
+	_ qfs.DescribingFS  = (*FS)(nil)
+	_ qfs.HasManyFS     = (*FS)(nil)
+	_ qfs.StatFS        = (*FS)(nil)
+	_ qfs.ReadDirFS     = (*FS)(nil)
+	_ qfs.PinningFS     = (*FS)(nil)
+	_ qfs.PinCheckingFS = (*FS)(nil)
+	_ qfs.Unwrapper     = (*FS)(nil)
+)
+
+// New wraps fs with retries
+func New(fs qfs.Filesystem, cfg Config) *FS {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultMaxAttempts
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = DefaultMinBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = DefaultMaxBackoff
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = cfg.MinBackoff
+	}
+	if cfg.IsTransient == nil {
+		cfg.IsTransient = IsTransient
+	}
+	return &FS{Filesystem: fs, cfg: cfg}
+}
+
+// NewMiddleware is a qfs.MiddlewareConstructor for retry middleware. cfg
+// keys match the fields of Config, durations are in nanoseconds
+func NewMiddleware(_ context.Context, cfgMap map[string]interface{}) (qfs.Middleware, error) {
+	cfg := Config{}
+	if err := mapstructure.Decode(cfgMap, &cfg); err != nil {
+		return nil, err
+	}
+	return func(fs qfs.Filesystem) qfs.Filesystem {
+		return New(fs, cfg)
+	}, nil
+}
+
+// IsTransient reports whether err is from a failure that may succeed if
+// retried: errors wrapping qfs.ErrTransient, network timeouts & failed
+// network operations
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, qfs.ErrTransient) {
+		return true
+	}
+	var nerr net.Error
+	if errors.As(err, &nerr) && nerr.Timeout() {
+		return true
+	}
+	var operr *net.OpError
+	return errors.As(err, &operr)
+}
+
+// Retries returns the number of retries made
+func (f *FS) Retries() int64 {
+	return atomic.LoadInt64(&f.retries)
+}
+
+// Has returns whether the `path` is mapped to a value
+func (f *FS) Has(ctx context.Context, path string) (has bool, err error) {
+	err = f.do(ctx, qfs.FaultOpHas, path, func(ctx context.Context) (func(), error) {
+		has, err = f.Filesystem.Has(ctx, path)
+		return nil, err
+	})
+	return has, err
+}
+
+// Get fetches a file. With an AttemptTimeout set, the timeout only bounds
+// resolving the file, the returned file can be read for as long as the
+// operation's context is live
+func (f *FS) Get(ctx context.Context, path string) (file qfs.File, err error) {
+	err = f.do(ctx, qfs.FaultOpGet, path, func(ctx context.Context) (func(), error) {
+		file, err = f.Filesystem.Get(ctx, path)
+		return func() { file.Close() }, err
+	})
+	return file, err
+}
+
+// Put places a file or directory on the filesystem
+func (f *FS) Put(ctx context.Context, file qfs.File) (path string, err error) {
+	tracked := &readTrackingFile{File: file, read: new(int32)}
+	err = f.do(ctx, qfs.FaultOpPut, file.FullPath(), func(ctx context.Context) (func(), error) {
+		path, err = f.Filesystem.Put(ctx, tracked)
+		if err != nil && tracked.touched() {
+			return nil, permanent{err}
+		}
+		return nil, err
+	})
+	return path, err
+}
+
+// Delete removes a file or directory from the filesystem
+func (f *FS) Delete(ctx context.Context, path string) error {
+	return f.do(ctx, qfs.FaultOpDelete, path, func(ctx context.Context) (func(), error) {
+		return nil, f.Filesystem.Delete(ctx, path)
+	})
+}
+
+// Describe returns the wrapped filesystem's descriptor
+func (f *FS) Describe() qfs.Descriptor { return qfs.Describe(f.Filesystem) }
+
+// Unwrap returns the wrapped filesystem, so its other capabilities can be
+// found with qfs.As
+func (f *FS) Unwrap() qfs.Filesystem { return f.Filesystem }
+
+// HasMany checks a batch of paths on the wrapped filesystem
+func (f *FS) HasMany(ctx context.Context, paths []string) (res map[string]bool, err error) {
+	err = f.do(ctx, OpHasMany, "", func(ctx context.Context) (func(), error) {
+		res, err = qfs.HasMany(ctx, f.Filesystem, paths)
+		return nil, err
+	})
+	return res, err
+}
+
+// Stat describes a path on the wrapped filesystem
+func (f *FS) Stat(ctx context.Context, path string) (fi os.FileInfo, err error) {
+	err = f.do(ctx, OpStat, path, func(ctx context.Context) (func(), error) {
+		fi, err = qfs.Stat(ctx, f.Filesystem, path)
+		return nil, err
+	})
+	return fi, err
+}
+
+// ReadDir lists a directory of the wrapped filesystem
+func (f *FS) ReadDir(ctx context.Context, path string) (entries []qfs.DirEntry, err error) {
+	err = f.do(ctx, OpReadDir, path, func(ctx context.Context) (func(), error) {
+		entries, err = qfs.ReadDir(ctx, f.Filesystem, path)
+		return nil, err
+	})
+	return entries, err
+}
+
+// Pin pins path on the wrapped filesystem. Filesystems that don't pin return
+// an error matching qfs.ErrUnsupported
+func (f *FS) Pin(ctx context.Context, path string, recursive bool) error {
+	p, ok := f.Filesystem.(qfs.PinningFS)
+	if !ok {
+		return fmt.Errorf("%w: %q filesystem doesn't pin", qfs.ErrUnsupported, f.Type())
+	}
+	return f.do(ctx, OpPin, path, func(ctx context.Context) (func(), error) {
+		return nil, p.Pin(ctx, path, recursive)
+	})
+}
+
+// Unpin unpins path on the wrapped filesystem. Filesystems that don't pin
+// return an error matching qfs.ErrUnsupported
+func (f *FS) Unpin(ctx context.Context, path string, recursive bool) error {
+	p, ok := f.Filesystem.(qfs.PinningFS)
+	if !ok {
+		return fmt.Errorf("%w: %q filesystem doesn't pin", qfs.ErrUnsupported, f.Type())
+	}
+	return f.do(ctx, OpUnpin, path, func(ctx context.Context) (func(), error) {
+		return nil, p.Unpin(ctx, path, recursive)
+	})
+}
+
+// IsPinned checks path's pins on the wrapped filesystem. Filesystems that
+// can't check pins return an error matching qfs.ErrUnsupported
+func (f *FS) IsPinned(ctx context.Context, path string) (pinned bool, err error) {
+	pc, ok := f.Filesystem.(qfs.PinCheckingFS)
+	if !ok {
+		return false, fmt.Errorf("%w: %q filesystem can't check pins", qfs.ErrUnsupported, f.Type())
+	}
+	err = f.do(ctx, OpIsPinned, path, func(ctx context.Context) (func(), error) {
+		pinned, err = pc.IsPinned(ctx, path)
+		return nil, err
+	})
+	return pinned, err
+}
+
+// permanent marks an error that can't be retried whatever its cause
+type permanent struct{ error }
+
+func (e permanent) Unwrap() error { return e.error }
+
+// do runs an operation until it succeeds, fails with an error that isn't
+// transient or runs out of attempts. op returns a func that closes the result
+// of a successful attempt, called if the attempt timed out before the result
+// could be used
+func (f *FS) do(ctx context.Context, op, path string, fn func(ctx context.Context) (func(), error)) error {
+	attempts := f.cfg.MaxAttempts
+	if n, ok := f.cfg.OpAttempts[op]; ok && n > 0 {
+		attempts = n
+	}
+	backoff := f.cfg.MinBackoff
+	for attempt := 1; ; attempt++ {
+		err := f.attempt(ctx, fn)
+		if p, ok := err.(permanent); ok {
+			return p.error
+		}
+		if err == nil || attempt >= attempts || ctx.Err() != nil || !f.cfg.IsTransient(err) {
+			return err
+		}
+
+		delay := jitter(backoff)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return err
+		}
+		log.Debugw("retrying", "op", op, "path", path, "attempt", attempt+1, "delay", delay, "err", err)
+		atomic.AddInt64(&f.retries, 1)
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+		if backoff *= 2; backoff > f.cfg.MaxBackoff {
+			backoff = f.cfg.MaxBackoff
+		}
+	}
+}
+
+// attempt runs fn, bounded by AttemptTimeout. The context of an attempt that
+// returns a result isn't cancelled once fn succeeds, so results like files
+// can keep using it
+func (f *FS) attempt(ctx context.Context, fn func(ctx context.Context) (func(), error)) error {
+	if f.cfg.AttemptTimeout <= 0 {
+		_, err := fn(ctx)
+		return err
+	}
+
+	actx, cancel := context.WithCancel(ctx)
+	var timedOut int32
+	t := time.AfterFunc(f.cfg.AttemptTimeout, func() {
+		atomic.StoreInt32(&timedOut, 1)
+		cancel()
+	})
+	closeResult, err := fn(actx)
+	if t.Stop() && err == nil {
+		if closeResult == nil {
+			cancel()
+		}
+		return nil
+	}
+	cancel()
+	if err == nil && closeResult != nil {
+		// the timeout fired as fn returned, the result may be unusable
+		closeResult()
+	}
+	if atomic.LoadInt32(&timedOut) == 1 && ctx.Err() == nil {
+		return fmt.Errorf("%w: attempt timed out after %s", qfs.ErrTransient, f.cfg.AttemptTimeout)
+	}
+	return err
+}
+
+// jitter picks a delay between half & all of d
+func jitter(d time.Duration) time.Duration {
+	half := int64(d / 2)
+	if half <= 0 {
+		return d
+	}
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// readTrackingFile records whether any of a file or directory has been read
+type readTrackingFile struct {
+	qfs.File
+	read *int32
+}
+
+func (f *readTrackingFile) touched() bool {
+	return atomic.LoadInt32(f.read) == 1
+}
+
+func (f *readTrackingFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	if n > 0 {
+		atomic.StoreInt32(f.read, 1)
+	}
+	return n, err
+}
+
+func (f *readTrackingFile) NextFile() (qfs.File, error) {
+	ch, err := f.File.NextFile()
+	if err != nil {
+		return nil, err
+	}
+	atomic.StoreInt32(f.read, 1)
+	return &readTrackingFile{File: ch, read: f.read}, nil
+}
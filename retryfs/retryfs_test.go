@@ -0,0 +1,176 @@
+package retryfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/qri-io/qfs"
+)
+
+var errFlaky = fmt.Errorf("%w: flaky", qfs.ErrTransient)
+
+func TestRetries(t *testing.T) {
+	ctx := context.Background()
+	mem := qfs.NewMemFS()
+	path, err := mem.Put(ctx, qfs.NewMemfileBytes("a.txt", []byte("a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	faulty := qfs.InjectFaults(mem,
+		qfs.FailNth(qfs.FaultOpGet, 1, errFlaky),
+		qfs.FailNth(qfs.FaultOpGet, 2, errFlaky),
+	)
+	fs := New(faulty, Config{MinBackoff: time.Millisecond})
+	if fs.Type() != mem.Type() {
+		t.Errorf("type mismatch. want: %q, got: %q", mem.Type(), fs.Type())
+	}
+	f, err := fs.Get(ctx, path)
+	if err != nil {
+		t.Fatalf("expected get to succeed on the third attempt. got: %s", err)
+	}
+	if data, _ := ioutil.ReadAll(f); string(data) != "a" {
+		t.Errorf("expected file data %q. got: %q", "a", data)
+	}
+	if fs.Retries() != 2 {
+		t.Errorf("expected 2 retries. got: %d", fs.Retries())
+	}
+
+	// errors that aren't transient aren't retried
+	errBoom := errors.New("boom")
+	faulty.Reset()
+	faulty.Add(qfs.FailNth(qfs.FaultOpDelete, 1, errBoom))
+	fs = New(faulty, Config{MinBackoff: time.Millisecond})
+	if err := fs.Delete(ctx, path); !errors.Is(err, errBoom) {
+		t.Errorf("expected delete to fail with the injected error. got: %v", err)
+	}
+	if fs.Retries() != 0 {
+		t.Errorf("expected no retries. got: %d", fs.Retries())
+	}
+
+	// attempts are capped per op
+	faulty.Reset()
+	faulty.Add(qfs.Fault{Op: qfs.FaultOpHas, Err: errFlaky})
+	fs = New(faulty, Config{MinBackoff: time.Millisecond, MaxAttempts: 5, OpAttempts: map[string]int{qfs.FaultOpHas: 2}})
+	if _, err := fs.Has(ctx, path); !errors.Is(err, qfs.ErrTransient) {
+		t.Errorf("expected has to fail with a transient error. got: %v", err)
+	}
+	if fs.Retries() != 1 {
+		t.Errorf("expected 1 retry. got: %d", fs.Retries())
+	}
+}
+
+func TestRetryDeadline(t *testing.T) {
+	ctx := context.Background()
+	faulty := qfs.InjectFaults(qfs.NewMemFS(), qfs.Fault{Op: qfs.FaultOpHas, Err: errFlaky})
+	fs := New(faulty, Config{MinBackoff: time.Second})
+
+	// retries that can't finish before the deadline aren't attempted
+	dctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := fs.Has(dctx, "/mem/a"); !errors.Is(err, errFlaky) {
+		t.Errorf("expected has to fail with the injected error. got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 40*time.Millisecond {
+		t.Errorf("expected has to fail without waiting for a retry. took: %s", elapsed)
+	}
+
+	// attempts that time out are retried
+	faulty.Reset()
+	faulty.Add(qfs.Fault{Op: qfs.FaultOpHas, Nth: 1, Delay: time.Hour})
+	fs = New(faulty, Config{MinBackoff: time.Millisecond, AttemptTimeout: 20 * time.Millisecond})
+	if _, err := fs.Has(ctx, "/mem/a"); err != nil {
+		t.Errorf("expected has to succeed after a timed out attempt. got: %s", err)
+	}
+	if fs.Retries() != 1 {
+		t.Errorf("expected 1 retry. got: %d", fs.Retries())
+	}
+}
+
+// readThenFailFS reads a byte of each put file before failing
+type readThenFailFS struct {
+	qfs.Filesystem
+	puts int
+}
+
+func (fs *readThenFailFS) Put(ctx context.Context, f qfs.File) (string, error) {
+	fs.puts++
+	f.Read(make([]byte, 1))
+	return "", errFlaky
+}
+
+func TestRetryPut(t *testing.T) {
+	ctx := context.Background()
+	faulty := qfs.InjectFaults(qfs.NewMemFS(), qfs.FailNth(qfs.FaultOpPut, 1, errFlaky))
+	fs := New(faulty, Config{MinBackoff: time.Millisecond})
+	if _, err := fs.Put(ctx, qfs.NewMemfileBytes("a.txt", []byte("a"))); err != nil {
+		t.Errorf("expected put that failed before reading the file to be retried. got: %s", err)
+	}
+
+	backend := &readThenFailFS{Filesystem: qfs.NewMemFS()}
+	fs = New(backend, Config{MinBackoff: time.Millisecond})
+	if _, err := fs.Put(ctx, qfs.NewMemfileBytes("a.txt", []byte("a"))); !errors.Is(err, errFlaky) {
+		t.Errorf("expected put to fail with the backend error. got: %v", err)
+	}
+	if backend.puts != 1 {
+		t.Errorf("expected put that read the file not to be retried. got: %d attempts", backend.puts)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	cases := []struct {
+		err       error
+		transient bool
+	}{
+		{nil, false},
+		{errors.New("boom"), false},
+		{qfs.ErrNotFound, false},
+		{errFlaky, true},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{fmt.Errorf("wrapped: %w", &net.DNSError{IsTimeout: true}), true},
+	}
+	for _, c := range cases {
+		if got := IsTransient(c.err); got != c.transient {
+			t.Errorf("%v: expected transient=%t. got: %t", c.err, c.transient, got)
+		}
+	}
+}
+
+func TestNewMiddleware(t *testing.T) {
+	mw, err := NewMiddleware(context.Background(), map[string]interface{}{
+		"maxAttempts": 2,
+		"opAttempts":  map[string]interface{}{qfs.FaultOpPut: 1},
+		"minBackoff":  time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, ok := mw(qfs.NewMemFS()).(*FS)
+	if !ok {
+		t.Fatal("expected middleware to return a *FS")
+	}
+	if fs.cfg.MaxAttempts != 2 || fs.cfg.OpAttempts[qfs.FaultOpPut] != 1 || fs.cfg.MinBackoff != time.Millisecond {
+		t.Errorf("unexpected config: %+v", fs.cfg)
+	}
+
+	ctx := context.Background()
+	if d := qfs.Describe(fs); !d.Has(qfs.FeatureContentAddressed) {
+		t.Errorf("expected retrying filesystem to keep its descriptor. got: %v", d)
+	}
+	path, err := fs.Put(ctx, qfs.NewMemfileBytes("a.txt", []byte("a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := qfs.Stat(ctx, fs, path); err != nil || fi.Size() != 1 {
+		t.Errorf("expected stat to reach the wrapped filesystem. err: %v", err)
+	}
+	if err := fs.Pin(ctx, path, true); !errors.Is(err, qfs.ErrUnsupported) {
+		t.Errorf("expected pinning a filesystem that doesn't pin to be unsupported. got: %v", err)
+	}
+}
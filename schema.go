@@ -0,0 +1,336 @@
+package qfs
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+)
+
+// LinkKind constrains what a schema field may link to
+type LinkKind int
+
+const (
+	// LinkAny accepts links to files and directories
+	LinkAny LinkKind = iota
+	// LinkFile requires a link to a file
+	LinkFile
+	// LinkDir requires a link to a directory
+	LinkDir
+)
+
+// String implements the fmt.Stringer interface
+func (k LinkKind) String() string {
+	switch k {
+	case LinkFile:
+		return "file"
+	case LinkDir:
+		return "directory"
+	default:
+		return "any"
+	}
+}
+
+// ValueKind constrains the value of a field in a dag-cbor node
+type ValueKind int
+
+const (
+	// ValueAny accepts any value
+	ValueAny ValueKind = iota
+	// ValueNull requires null
+	ValueNull
+	// ValueBool requires a boolean
+	ValueBool
+	// ValueInt requires an integer
+	ValueInt
+	// ValueFloat requires a floating point number
+	ValueFloat
+	// ValueString requires a string
+	ValueString
+	// ValueBytes requires a byte string
+	ValueBytes
+	// ValueList requires a list
+	ValueList
+	// ValueMap requires a map
+	ValueMap
+	// ValueLink requires a link
+	ValueLink
+)
+
+// String implements the fmt.Stringer interface
+func (k ValueKind) String() string {
+	switch k {
+	case ValueNull:
+		return "null"
+	case ValueBool:
+		return "bool"
+	case ValueInt:
+		return "int"
+	case ValueFloat:
+		return "float"
+	case ValueString:
+		return "string"
+	case ValueBytes:
+		return "bytes"
+	case ValueList:
+		return "list"
+	case ValueMap:
+		return "map"
+	case ValueLink:
+		return "link"
+	default:
+		return "any"
+	}
+}
+
+// valueKind returns the kind of a value decoded from dag-cbor
+func valueKind(v interface{}) ValueKind {
+	switch v.(type) {
+	case nil:
+		return ValueNull
+	case bool:
+		return ValueBool
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return ValueInt
+	case float32, float64:
+		return ValueFloat
+	case string:
+		return ValueString
+	case []byte:
+		return ValueBytes
+	case []interface{}:
+		return ValueList
+	case map[string]interface{}:
+		return ValueMap
+	case cid.Cid:
+		return ValueLink
+	default:
+		return ValueAny
+	}
+}
+
+// SchemaField describes a single named field of a node. Kind constrains
+// links of link set nodes, Value constrains fields of dag-cbor nodes
+type SchemaField struct {
+	Name     string
+	Kind     LinkKind
+	Value    ValueKind
+	Required bool
+}
+
+// NodeSchema describes the fields nodes of a given type must carry. Schemas
+// validate both the link sets put through a MerkleDagStore, constraining
+// link names, presence & kind, and dag-cbor nodes, constraining the keys of
+// the node's map & the kinds of their values
+type NodeSchema struct {
+	Type   string
+	Fields []SchemaField
+	// AllowExtra permits links that aren't named in Fields
+	AllowExtra bool
+}
+
+// ErrUnknownNodeType is returned when validating against an unregistered type
+var ErrUnknownNodeType = errors.New("unknown node type")
+
+// FieldError describes a single way a node fails its schema. Field is empty
+// for problems with the node as a whole
+type FieldError struct {
+	Field   string
+	Problem string
+}
+
+// ValidationError lists every problem found validating a node. It's returned
+// before the node is stored
+type ValidationError struct {
+	Type   string
+	Fields []FieldError
+}
+
+// Error implements the error interface
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		if f.Field == "" {
+			msgs[i] = f.Problem
+			continue
+		}
+		msgs[i] = fmt.Sprintf("%s: %s", f.Field, f.Problem)
+	}
+	return fmt.Sprintf("invalid %s node: %s", e.Type, strings.Join(msgs, "; "))
+}
+
+// SchemaRegistry holds node schemas by type
+type SchemaRegistry struct {
+	lk      sync.RWMutex
+	schemas map[string]NodeSchema
+}
+
+// NewSchemaRegistry creates a registry with the given schemas
+func NewSchemaRegistry(schemas ...NodeSchema) (*SchemaRegistry, error) {
+	r := &SchemaRegistry{schemas: map[string]NodeSchema{}}
+	for _, s := range schemas {
+		if err := r.Register(s); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Register adds a schema, replacing any schema of the same type
+func (r *SchemaRegistry) Register(s NodeSchema) error {
+	if s.Type == "" {
+		return fmt.Errorf("schema type is required")
+	}
+	seen := map[string]bool{}
+	for _, f := range s.Fields {
+		if f.Name == "" {
+			return fmt.Errorf("schema %q: field name is required", s.Type)
+		}
+		if seen[f.Name] {
+			return fmt.Errorf("schema %q: duplicate field %q", s.Type, f.Name)
+		}
+		seen[f.Name] = true
+	}
+
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	r.schemas[s.Type] = s
+	return nil
+}
+
+// Validate checks links against the schema registered for nodeType,
+// returning a *ValidationError if the links don't conform
+func (r *SchemaRegistry) Validate(nodeType string, links Links) error {
+	s, err := r.schema(nodeType)
+	if err != nil {
+		return err
+	}
+
+	verr := &ValidationError{Type: nodeType}
+	known := map[string]bool{}
+	for _, f := range s.Fields {
+		known[f.Name] = true
+		lnk := links.Get(f.Name)
+		if lnk == nil || lnk.IsEmpty() {
+			if f.Required {
+				verr.Fields = append(verr.Fields, FieldError{Field: f.Name, Problem: "required link is missing"})
+			}
+			continue
+		}
+		if (f.Kind == LinkFile && !lnk.IsFile) || (f.Kind == LinkDir && lnk.IsFile) {
+			verr.Fields = append(verr.Fields, FieldError{Field: f.Name, Problem: fmt.Sprintf("expected link to %s", f.Kind)})
+		}
+	}
+	if !s.AllowExtra {
+		for _, lnk := range links.SortedSlice() {
+			if !known[lnk.Name] {
+				verr.Fields = append(verr.Fields, FieldError{Field: lnk.Name, Problem: "unexpected link"})
+			}
+		}
+	}
+
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// ValidateCBOR checks a dag-cbor encoded node against the schema registered
+// for nodeType, returning a *ValidationError if the node isn't a map that
+// conforms
+func (r *SchemaRegistry) ValidateCBOR(nodeType string, data []byte) error {
+	s, err := r.schema(nodeType)
+	if err != nil {
+		return err
+	}
+
+	verr := &ValidationError{Type: nodeType}
+	var v interface{}
+	if err := cbornode.DecodeInto(data, &v); err != nil {
+		verr.Fields = append(verr.Fields, FieldError{Problem: fmt.Sprintf("decoding dag-cbor: %s", err)})
+		return verr
+	}
+	node, ok := v.(map[string]interface{})
+	if !ok {
+		verr.Fields = append(verr.Fields, FieldError{Problem: fmt.Sprintf("expected map, got %s", valueKind(v))})
+		return verr
+	}
+
+	known := map[string]bool{}
+	for _, f := range s.Fields {
+		known[f.Name] = true
+		val, ok := node[f.Name]
+		if !ok {
+			if f.Required {
+				verr.Fields = append(verr.Fields, FieldError{Field: f.Name, Problem: "required field is missing"})
+			}
+			continue
+		}
+		if kind := valueKind(val); f.Value != ValueAny && kind != f.Value {
+			verr.Fields = append(verr.Fields, FieldError{Field: f.Name, Problem: fmt.Sprintf("expected %s, got %s", f.Value, kind)})
+		}
+	}
+	if !s.AllowExtra {
+		keys := make([]string, 0, len(node))
+		for key := range node {
+			if !known[key] {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			verr.Fields = append(verr.Fields, FieldError{Field: key, Problem: "unexpected field"})
+		}
+	}
+
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// schema returns the schema registered for nodeType
+func (r *SchemaRegistry) schema(nodeType string) (NodeSchema, error) {
+	r.lk.RLock()
+	defer r.lk.RUnlock()
+	s, ok := r.schemas[nodeType]
+	if !ok {
+		return NodeSchema{}, fmt.Errorf("%w: %q", ErrUnknownNodeType, nodeType)
+	}
+	return s, nil
+}
+
+// ValidatingDagStore wraps a MerkleDagStore, checking typed nodes against a
+// schema registry before they're stored
+type ValidatingDagStore struct {
+	MerkleDagStore
+	Schemas *SchemaRegistry
+}
+
+// NewValidatingDagStore wraps store, validating with schemas
+func NewValidatingDagStore(store MerkleDagStore, schemas *SchemaRegistry) *ValidatingDagStore {
+	return &ValidatingDagStore{MerkleDagStore: store, Schemas: schemas}
+}
+
+// PutTypedNode validates links against the schema for nodeType and stores
+// them as a node if they conform
+func (s *ValidatingDagStore) PutTypedNode(nodeType string, links Links) (PutResult, error) {
+	if err := s.Schemas.Validate(nodeType, links); err != nil {
+		return PutResult{}, err
+	}
+	return s.MerkleDagStore.PutNode(links)
+}
+
+// PutTypedCBOR validates a dag-cbor encoded node against the schema for
+// nodeType and stores it as a block if it conforms. The block is addressed
+// the way the wrapped store's PutBlock addresses blocks
+func (s *ValidatingDagStore) PutTypedCBOR(nodeType string, data []byte) (cid.Cid, error) {
+	if err := s.Schemas.ValidateCBOR(nodeType, data); err != nil {
+		return cid.Cid{}, err
+	}
+	return s.MerkleDagStore.PutBlock(data)
+}
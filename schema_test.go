@@ -0,0 +1,121 @@
+package qfs
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	cid "github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/multiformats/go-multihash"
+)
+
+func TestValidatingDagStore(t *testing.T) {
+	reg, err := NewSchemaRegistry(NodeSchema{
+		Type: "dataset",
+		Fields: []SchemaField{
+			{Name: "meta", Kind: LinkFile, Required: true},
+			{Name: "body", Kind: LinkAny},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewValidatingDagStore(NewMemFS(), reg)
+
+	id, err := store.PutBlock([]byte("meta"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.PutTypedNode("dataset", NewLinks(Link{Name: "meta", Cid: id, IsFile: true})); err != nil {
+		t.Errorf("expected valid node to be stored. got: %s", err)
+	}
+
+	_, err = store.PutTypedNode("dataset", NewLinks(
+		Link{Name: "meta", Cid: id},
+		Link{Name: "extra", Cid: id, IsFile: true},
+	))
+	verr := &ValidationError{}
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected validation error. got: %v", err)
+	}
+	expect := []FieldError{
+		{Field: "meta", Problem: "expected link to file"},
+		{Field: "extra", Problem: "unexpected link"},
+	}
+	if diff := cmp.Diff(expect, verr.Fields); diff != "" {
+		t.Errorf("field errors mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := store.PutTypedNode("dataset", NewLinks()); err == nil {
+		t.Errorf("expected missing required link to fail validation")
+	}
+	if _, err := store.PutTypedNode("unknown", NewLinks(Link{Name: "a", Cid: cid.Cid{}})); !errors.Is(err, ErrUnknownNodeType) {
+		t.Errorf("expected ErrUnknownNodeType. got: %v", err)
+	}
+}
+
+func TestValidateCBOR(t *testing.T) {
+	reg, err := NewSchemaRegistry(NodeSchema{
+		Type: "meta",
+		Fields: []SchemaField{
+			{Name: "title", Value: ValueString, Required: true},
+			{Name: "keywords", Value: ValueList},
+			{Name: "body", Value: ValueLink},
+			{Name: "extra"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewValidatingDagStore(NewMemFS(), reg)
+
+	body, err := store.PutBlock([]byte("body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func(v interface{}) []byte {
+		nd, err := cbornode.WrapObject(v, multihash.SHA2_256, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return nd.RawData()
+	}
+
+	valid := encode(map[string]interface{}{"title": "a", "keywords": []string{"b"}, "body": body, "extra": 1})
+	id, err := store.PutTypedCBOR("meta", valid)
+	if err != nil {
+		t.Fatalf("expected valid node to be stored. got: %s", err)
+	}
+	if data, err := GetBlockBytes(store, id); err != nil || string(data) != string(valid) {
+		t.Errorf("expected stored node to be readable. err: %v", err)
+	}
+
+	_, err = store.PutTypedCBOR("meta", encode(map[string]interface{}{"keywords": "b", "body": "not a link", "unknown": true}))
+	verr := &ValidationError{}
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected validation error. got: %v", err)
+	}
+	expect := []FieldError{
+		{Field: "title", Problem: "required field is missing"},
+		{Field: "keywords", Problem: "expected list, got string"},
+		{Field: "body", Problem: "expected link, got string"},
+		{Field: "unknown", Problem: "unexpected field"},
+	}
+	if diff := cmp.Diff(expect, verr.Fields); diff != "" {
+		t.Errorf("field errors mismatch (-want +got):\n%s", diff)
+	}
+
+	for name, data := range map[string][]byte{
+		"not a map": encode([]string{"title"}),
+		"not cbor":  []byte("nope"),
+	} {
+		if err := reg.ValidateCBOR("meta", data); !errors.As(err, &verr) || verr.Fields[0].Field != "" {
+			t.Errorf("%s: expected a node validation error. got: %v", name, err)
+		}
+	}
+	if err := reg.ValidateCBOR("unknown", valid); !errors.Is(err, ErrUnknownNodeType) {
+		t.Errorf("expected ErrUnknownNodeType. got: %v", err)
+	}
+}
@@ -0,0 +1,225 @@
+package qfs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// ContextScoper is an optional interface for filesystems that can create
+// views of themselves bound to a context
+type ContextScoper interface {
+	WithContext(ctx context.Context) Filesystem
+}
+
+// ScopedFilesystem is a view of a filesystem bound to a context. Operations
+// on a scoped filesystem are cancelled when either the operation context or
+// the scope context ends. When the scope context ends all resources acquired
+// through the scope (open files, temp directories, registered release funcs)
+// are released, after which Done is closed
+type ScopedFilesystem struct {
+	Filesystem
+	ctx context.Context
+
+	lk        sync.Mutex
+	released  bool
+	files     map[*scopedFile]struct{}
+	releasers []func() error
+
+	doneCh  chan struct{}
+	doneErr error
+}
+
+var (
+	_ Filesystem          = (*ScopedFilesystem)(nil)
+	_ ReleasingFilesystem = (*ScopedFilesystem)(nil)
+	_ DescribingFS        = (*ScopedFilesystem)(nil)
+)
+
+// WithContext returns a view of fs whose operations and resources are bound
+// to ctx. Filesystems that implement ContextScoper create their own views
+func WithContext(ctx context.Context, fs Filesystem) Filesystem {
+	if scoper, ok := fs.(ContextScoper); ok {
+		return scoper.WithContext(ctx)
+	}
+	return NewScopedFilesystem(ctx, fs)
+}
+
+// NewScopedFilesystem wraps fs in a generic context-bound view
+func NewScopedFilesystem(ctx context.Context, fs Filesystem) *ScopedFilesystem {
+	s := &ScopedFilesystem{
+		Filesystem: fs,
+		ctx:        ctx,
+		files:      map[*scopedFile]struct{}{},
+		doneCh:     make(chan struct{}),
+	}
+	go func() {
+		<-ctx.Done()
+		s.release()
+	}()
+	return s
+}
+
+// Describe returns the scoped filesystem's descriptor
+func (s *ScopedFilesystem) Describe() Descriptor { return Describe(s.Filesystem) }
+
+// Has returns whether the `path` is mapped to a value
+func (s *ScopedFilesystem) Has(ctx context.Context, path string) (bool, error) {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+	return s.Filesystem.Has(ctx, path)
+}
+
+// Get fetches a file. Files are closed when the scope ends if the caller
+// hasn't closed them already
+func (s *ScopedFilesystem) Get(ctx context.Context, path string) (File, error) {
+	ctx, cancel := s.opContext(ctx)
+	f, err := s.Filesystem.Get(ctx, path)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	sf := &scopedFile{File: f, scope: s, cancel: cancel}
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if s.released {
+		sf.close()
+		return nil, s.ctx.Err()
+	}
+	s.files[sf] = struct{}{}
+	return sf, nil
+}
+
+// Put places a file or directory on the filesystem
+func (s *ScopedFilesystem) Put(ctx context.Context, file File) (string, error) {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+	return s.Filesystem.Put(ctx, file)
+}
+
+// Delete removes a file or directory from the filesystem
+func (s *ScopedFilesystem) Delete(ctx context.Context, path string) error {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+	return s.Filesystem.Delete(ctx, path)
+}
+
+// TempDir creates a temporary directory that is removed when the scope ends
+func (s *ScopedFilesystem) TempDir(pattern string) (string, error) {
+	dir, err := ioutil.TempDir("", pattern)
+	if err != nil {
+		return "", err
+	}
+	if err := s.OnRelease(func() error { return os.RemoveAll(dir) }); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// OnRelease registers a function to call when the scope ends. Backends use
+// this to tie sessions and other resources to the scope's lifetime. OnRelease
+// errors if the scope has already ended
+func (s *ScopedFilesystem) OnRelease(fn func() error) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if s.released {
+		return s.ctx.Err()
+	}
+	s.releasers = append(s.releasers, fn)
+	return nil
+}
+
+// Done implements the ReleasingFilesystem interface
+func (s *ScopedFilesystem) Done() <-chan struct{} {
+	return s.doneCh
+}
+
+// DoneErr returns the first error encountered while releasing resources, or
+// the scope context's error if release succeeded
+func (s *ScopedFilesystem) DoneErr() error {
+	return s.doneErr
+}
+
+// opContext derives a context that ends when either ctx or the scope ends
+func (s *ScopedFilesystem) opContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-s.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+func (s *ScopedFilesystem) release() {
+	s.lk.Lock()
+	s.released = true
+	files := s.files
+	s.files = nil
+	releasers := s.releasers
+	s.releasers = nil
+	s.lk.Unlock()
+
+	var err error
+	for f := range files {
+		if e := f.close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	// release in reverse order of registration
+	for i := len(releasers) - 1; i >= 0; i-- {
+		if e := releasers[i](); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	if err == nil {
+		err = s.ctx.Err()
+	}
+	s.doneErr = err
+	close(s.doneCh)
+}
+
+func (s *ScopedFilesystem) untrack(f *scopedFile) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	delete(s.files, f)
+}
+
+// scopedFile is a file acquired through a scope
+type scopedFile struct {
+	File
+	scope  *ScopedFilesystem
+	cancel context.CancelFunc
+	once   sync.Once
+	err    error
+}
+
+// Seek seeks the underlying file
+func (f *scopedFile) Seek(offset int64, whence int) (int64, error) {
+	return seekFile(f.File, offset, whence)
+}
+
+// Size returns the size of the underlying file
+func (f *scopedFile) Size() int64 { return FileSize(f.File) }
+
+// Close closes the underlying file & stops tracking it in the scope
+func (f *scopedFile) Close() error {
+	f.scope.untrack(f)
+	return f.close()
+}
+
+func (f *scopedFile) close() error {
+	f.once.Do(func() {
+		if !f.File.IsDirectory() {
+			f.err = f.File.Close()
+		}
+		f.cancel()
+	})
+	return f.err
+}
@@ -0,0 +1,94 @@
+package qfs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+type closeTrackingFile struct {
+	File
+	closed bool
+}
+
+func (f *closeTrackingFile) Close() error {
+	f.closed = true
+	return nil
+}
+
+type trackingFS struct {
+	*MemFS
+	files []*closeTrackingFile
+}
+
+func (t *trackingFS) Get(ctx context.Context, path string) (File, error) {
+	f, err := t.MemFS.Get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	tf := &closeTrackingFile{File: f}
+	t.files = append(t.files, tf)
+	return tf, nil
+}
+
+func TestScopedFilesystem(t *testing.T) {
+	base := &trackingFS{MemFS: NewMemFS()}
+	path, err := base.Put(context.Background(), NewMemfileBytes("a.txt", []byte("foo")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	scoped := WithContext(ctx, base).(*ScopedFilesystem)
+
+	closedByCaller, err := scoped.Get(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := closedByCaller.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := scoped.Get(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+
+	tmp, err := scoped.TempDir("scope_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	released := false
+	if err := scoped.OnRelease(func() error { released = true; return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	select {
+	case <-scoped.Done():
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for scope to release")
+	}
+
+	if !errors.Is(scoped.DoneErr(), context.Canceled) {
+		t.Errorf("expected context cancelled done error, got: %v", scoped.DoneErr())
+	}
+	for i, f := range base.files {
+		if !f.closed {
+			t.Errorf("file %d was not closed when scope ended", i)
+		}
+	}
+	if !released {
+		t.Errorf("expected release func to be called")
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("expected temp dir to be removed, stat error: %v", err)
+	}
+
+	if _, err := scoped.Get(context.Background(), path); err == nil {
+		t.Errorf("expected get after scope ends to fail")
+	}
+	if err := scoped.OnRelease(func() error { return nil }); err == nil {
+		t.Errorf("expected registering a release func after scope ends to fail")
+	}
+}
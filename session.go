@@ -0,0 +1,63 @@
+package qfs
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrSessionClosed is returned by reads on a session that has been closed
+var ErrSessionClosed = errors.New("session closed")
+
+// Session groups the reads of one logical request so a filesystem can share
+// fetch state (provider lookups, block caches) between them. Sessions must be
+// closed, and are closed automatically when their context ends
+type Session interface {
+	PathResolver
+	// Close releases all resources held by the session. Files acquired from
+	// the session may stop reading once the session is closed
+	Close() error
+}
+
+// SessionFS is an optional interface for filesystems that can share fetch
+// state across related reads
+type SessionFS interface {
+	NewSession(ctx context.Context) (Session, error)
+}
+
+// NewSession creates a session on fs. Filesystems that don't implement
+// SessionFS get a session that passes reads straight through
+func NewSession(ctx context.Context, fs PathResolver) (Session, error) {
+	if sfs, ok := fs.(SessionFS); ok {
+		return sfs.NewSession(ctx)
+	}
+	return &passthroughSession{ctx: ctx, fs: fs}, nil
+}
+
+// passthroughSession is a session that holds no state
+type passthroughSession struct {
+	ctx context.Context
+	fs  PathResolver
+
+	lk     sync.Mutex
+	closed bool
+}
+
+// Get fetches a file from the underlying filesystem
+func (s *passthroughSession) Get(ctx context.Context, path string) (File, error) {
+	s.lk.Lock()
+	closed := s.closed
+	s.lk.Unlock()
+	if closed || s.ctx.Err() != nil {
+		return nil, ErrSessionClosed
+	}
+	return s.fs.Get(ctx, path)
+}
+
+// Close implements the Session interface
+func (s *passthroughSession) Close() error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.closed = true
+	return nil
+}
@@ -0,0 +1,30 @@
+package qfs
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPassthroughSession(t *testing.T) {
+	ctx := context.Background()
+	fs := NewMemFS()
+	path, err := fs.Put(ctx, NewMemfileBytes("/a.txt", []byte("a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewSession(ctx, fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, path); err != nil {
+		t.Errorf("expected session get to succeed. got: %s", err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, path); err != ErrSessionClosed {
+		t.Errorf("expected ErrSessionClosed after close. got: %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package spec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"testing/fstest"
+
+	"github.com/ipfs/go-cid"
+	"github.com/qri-io/qfs"
+)
+
+// AssertMerkleDagStore checks block, node & file round trips through a
+// MerkleDagStore. newStore creates an empty store for a single test
+func AssertMerkleDagStore(t *testing.T, newStore func(t *testing.T) qfs.MerkleDagStore) {
+	cases := []struct {
+		name string
+		test func(t *testing.T, store qfs.MerkleDagStore)
+	}{
+		{"Blocks", testBlocks},
+		{"BlockBatches", testBlockBatches},
+		{"Nodes", testNodes},
+		{"Files", testFiles},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.test(t, newStore(t))
+		})
+	}
+}
+
+func testBlocks(t *testing.T, store qfs.MerkleDagStore) {
+	id, err := store.PutBlock([]byte("block"))
+	if err != nil {
+		t.Fatalf("putting block: %s", err)
+	}
+	again, err := store.PutBlock([]byte("block"))
+	if err != nil {
+		t.Fatalf("putting block: %s", err)
+	}
+	if !id.Equals(again) {
+		t.Errorf("expected the same block to have the same cid. got: %s, %s", id, again)
+	}
+
+	data, err := qfs.GetBlockBytes(store, id)
+	if err != nil {
+		t.Fatalf("getting block: %s", err)
+	}
+	if !bytes.Equal(data, []byte("block")) {
+		t.Errorf("expected block data %q. got: %q", "block", data)
+	}
+	if err := qfs.VerifyBlock(id, data); err != nil {
+		t.Errorf("expected block data to hash to its cid: %s", err)
+	}
+
+	if _, err := store.GetBlock(missingBlock(t)); !errors.Is(err, qfs.ErrNotFound) {
+		t.Errorf("expected getting a missing block to return an error matching qfs.ErrNotFound. got: %v", err)
+	}
+}
+
+func testBlockBatches(t *testing.T, store qfs.MerkleDagStore) {
+	ctx := context.Background()
+	blocks := [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+	ids, err := store.PutBlocks(ctx, blocks)
+	if err != nil {
+		t.Fatalf("putting blocks: %s", err)
+	}
+	if len(ids) != len(blocks) {
+		t.Fatalf("expected %d cids. got: %d", len(blocks), len(ids))
+	}
+
+	// request blocks in reverse to check results follow argument order
+	got, err := store.GetBlocks(ctx, []cid.Cid{ids[2], ids[1], ids[0]})
+	if err != nil {
+		t.Fatalf("getting blocks: %s", err)
+	}
+	for i, expect := range []string{"c", "b", "a"} {
+		if i >= len(got) || string(got[i]) != expect {
+			t.Errorf("expected block %d to be %q. got: %q", i, expect, got)
+			break
+		}
+	}
+
+	if _, err := store.GetBlocks(ctx, append(ids, missingBlock(t))); !errors.Is(err, qfs.ErrNotFound) {
+		t.Errorf("expected a batch with a missing block to return an error matching qfs.ErrNotFound. got: %v", err)
+	}
+}
+
+func testNodes(t *testing.T, store qfs.MerkleDagStore) {
+	a, err := store.PutBlock([]byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	links := qfs.NewLinks(qfs.Link{Name: "a", Cid: a, Size: 1, IsFile: true})
+	res, err := store.PutNode(links)
+	if err != nil {
+		t.Fatalf("putting node: %s", err)
+	}
+	again, err := store.PutNode(qfs.NewLinks(qfs.Link{Name: "a", Cid: a, Size: 1, IsFile: true}))
+	if err != nil {
+		t.Fatalf("putting node: %s", err)
+	}
+	if !res.Cid.Equals(again.Cid) {
+		t.Errorf("expected the same links to have the same cid. got: %s, %s", res.Cid, again.Cid)
+	}
+
+	nd, err := store.GetNode(res.Cid)
+	if err != nil {
+		t.Fatalf("getting node: %s", err)
+	}
+	if !nd.Cid().Equals(res.Cid) {
+		t.Errorf("expected node cid %s. got: %s", res.Cid, nd.Cid())
+	}
+	if lk := nd.Links().Get("a"); lk == nil || !lk.Cid.Equals(a) {
+		t.Errorf("expected node to link to %s as \"a\". got: %v", a, nd.Links().SortedSlice())
+	}
+
+	if _, err := store.GetNode(missingBlock(t)); !errors.Is(err, qfs.ErrNotFound) {
+		t.Errorf("expected getting a missing node to return an error matching qfs.ErrNotFound. got: %v", err)
+	}
+}
+
+func testFiles(t *testing.T, store qfs.MerkleDagStore) {
+	fsys := fstest.MapFS{"a.txt": &fstest.MapFile{Data: []byte("file a")}}
+	f, err := fsys.Open("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := store.PutFile(f)
+	if err != nil {
+		t.Fatalf("putting file: %s", err)
+	}
+	if res.Size != int64(len("file a")) {
+		t.Errorf("expected put size %d. got: %d", len("file a"), res.Size)
+	}
+
+	rc, err := store.GetFile(res.Cid)
+	if err != nil {
+		t.Fatalf("getting file: %s", err)
+	}
+	defer rc.Close()
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "file a" {
+		t.Errorf("expected file data %q. got: %q", "file a", data)
+	}
+}
+
+// missingBlock returns the cid of a block no store under test has
+func missingBlock(t *testing.T) cid.Cid {
+	id, err := cid.V0Builder{}.Sum([]byte("spec: missing block"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
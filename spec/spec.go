@@ -0,0 +1,228 @@
+// Package spec holds conformance tests for qfs interfaces. Backends run the
+// suites from their own tests to check they behave the way callers of the
+// interfaces expect:
+//
+//   func TestSpec(t *testing.T) {
+//     spec.AssertFilesystem(t, spec.Config{
+//       New: func(t *testing.T) qfs.Filesystem { return qfs.NewMemFS() },
+//     })
+//   }
+//
+// Operations a backend doesn't implement must fail with an error matching
+// qfs.ErrUnsupported. Tests that depend on them are skipped
+package spec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qri-io/qfs"
+)
+
+// Config configures a Filesystem conformance run
+type Config struct {
+	// New creates an empty filesystem for a single test. Required
+	New func(t *testing.T) qfs.Filesystem
+	// Root returns the directory files are named under for a single test.
+	// Filesystems that write files at their path, like localfs, return a
+	// temp directory. defaults to "/"
+	Root func(t *testing.T) string
+}
+
+// env is the state of a single conformance test
+type env struct {
+	ctx  context.Context
+	fs   qfs.Filesystem
+	root string
+	cfg  Config
+}
+
+// path names a file under the test root
+func (e env) path(name string) string {
+	return filepath.Join(e.root, name)
+}
+
+// missingPath returns a path the filesystem has never stored. Content-addressed
+// filesystems get the path content has in a second, empty filesystem
+func (e env) missingPath(t *testing.T) string {
+	if _, ok := e.fs.(qfs.CAFS); !ok {
+		return e.path("missing.txt")
+	}
+	path, err := e.cfg.New(t).Put(e.ctx, qfs.NewMemfileBytes(e.path("missing.txt"), []byte("spec: missing content")))
+	if err != nil {
+		t.Fatalf("putting content to a second filesystem: %s", err)
+	}
+	return path
+}
+
+// AssertFilesystem checks Put, Get, Has & Delete semantics. Content-addressed
+// filesystems are also checked for stable, content-derived paths
+func AssertFilesystem(t *testing.T, cfg Config) {
+	if cfg.New == nil {
+		t.Fatal("spec: Config.New is required")
+	}
+	if cfg.Root == nil {
+		cfg.Root = func(*testing.T) string { return "/" }
+	}
+
+	cases := []struct {
+		name string
+		cafs bool
+		test func(t *testing.T, e env)
+	}{
+		{"PutGetFile", false, testPutGetFile},
+		{"Has", false, testHas},
+		{"GetMissing", false, testGetMissing},
+		{"PutGetDirectory", false, testPutGetDirectory},
+		{"Delete", false, testDelete},
+		{"ContentPaths", true, testContentPaths},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			e := env{ctx: ctx, fs: cfg.New(t), root: cfg.Root(t), cfg: cfg}
+			if _, ok := e.fs.(qfs.CAFS); c.cafs && !ok {
+				t.Skip("not a content-addressed filesystem")
+			}
+			c.test(t, e)
+		})
+	}
+}
+
+func testPutGetFile(t *testing.T, e env) {
+	path := put(t, e, qfs.NewMemfileBytes(e.path("a.txt"), []byte("file a")))
+	f, err := e.fs.Get(e.ctx, path)
+	if err != nil {
+		t.Fatalf("getting put file: %s", err)
+	}
+	if f.IsDirectory() {
+		t.Errorf("expected a file, got a directory")
+	}
+	assertData(t, f, "file a")
+}
+
+func testHas(t *testing.T, e env) {
+	path := put(t, e, qfs.NewMemfileBytes(e.path("a.txt"), []byte("file a")))
+	if has, err := e.fs.Has(e.ctx, path); err != nil || !has {
+		t.Errorf("expected Has of put path to be true. got: %t, %v", has, err)
+	}
+	if has, err := e.fs.Has(e.ctx, e.missingPath(t)); err != nil || has {
+		t.Errorf("expected Has of missing path to be false without an error. got: %t, %v", has, err)
+	}
+}
+
+func testGetMissing(t *testing.T, e env) {
+	if _, err := e.fs.Get(e.ctx, e.missingPath(t)); !errors.Is(err, qfs.ErrNotFound) {
+		t.Errorf("expected getting a missing path to return an error matching qfs.ErrNotFound. got: %v", err)
+	}
+}
+
+func testPutGetDirectory(t *testing.T, e env) {
+	path, err := e.fs.Put(e.ctx, qfs.NewMemdir(e.path("dir"),
+		qfs.NewMemfileBytes("a.txt", []byte("file a")),
+		qfs.NewMemdir("sub",
+			qfs.NewMemfileBytes("b.txt", []byte("file b")),
+		),
+	))
+	if errors.Is(err, qfs.ErrUnsupported) {
+		t.Skip("directories are unsupported")
+	} else if err != nil {
+		t.Fatalf("putting directory: %s", err)
+	}
+
+	for name, data := range map[string]string{"a.txt": "file a", "sub/b.txt": "file b"} {
+		f, err := e.fs.Get(e.ctx, path+"/"+name)
+		if err != nil {
+			t.Errorf("getting %s: %s", name, err)
+			continue
+		}
+		assertData(t, f, data)
+	}
+
+	dir, err := e.fs.Get(e.ctx, path)
+	if errors.Is(err, qfs.ErrUnsupported) {
+		return
+	} else if err != nil {
+		t.Fatalf("getting directory: %s", err)
+	}
+	if !dir.IsDirectory() {
+		t.Fatal("expected getting a directory path to return a directory")
+	}
+	names := map[string]bool{}
+	for {
+		ch, err := dir.NextFile()
+		if err != nil {
+			break
+		}
+		names[ch.FileName()] = true
+	}
+	if !names["a.txt"] || !names["sub"] || len(names) != 2 {
+		t.Errorf("expected directory entries a.txt & sub. got: %v", names)
+	}
+
+	f, err := e.fs.Get(e.ctx, path+"/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.NextFile(); err == nil {
+		t.Error("expected NextFile on a file to fail")
+	}
+}
+
+func testDelete(t *testing.T, e env) {
+	path := put(t, e, qfs.NewMemfileBytes(e.path("a.txt"), []byte("file a")))
+	err := e.fs.Delete(e.ctx, path)
+	if errors.Is(err, qfs.ErrUnsupported) {
+		t.Skip("delete is unsupported")
+	} else if err != nil {
+		t.Fatalf("deleting: %s", err)
+	}
+	if has, err := e.fs.Has(e.ctx, path); err != nil || has {
+		t.Errorf("expected Has of deleted path to be false. got: %t, %v", has, err)
+	}
+	if _, err := e.fs.Get(e.ctx, path); !errors.Is(err, qfs.ErrNotFound) {
+		t.Errorf("expected getting a deleted path to return an error matching qfs.ErrNotFound. got: %v", err)
+	}
+}
+
+func testContentPaths(t *testing.T, e env) {
+	a := put(t, e, qfs.NewMemfileBytes(e.path("a.txt"), []byte("same content")))
+	b := put(t, e, qfs.NewMemfileBytes(e.path("b.txt"), []byte("same content")))
+	c := put(t, e, qfs.NewMemfileBytes(e.path("c.txt"), []byte("other content")))
+	if a != b {
+		t.Errorf("expected the same content to have the same path. got: %q, %q", a, b)
+	}
+	if a == c {
+		t.Errorf("expected different content to have different paths. got: %q for both", a)
+	}
+	if prefix := "/" + e.fs.Type() + "/"; !strings.HasPrefix(a, prefix) {
+		t.Errorf("expected path %q to start with %q", a, prefix)
+	}
+}
+
+// put stores a file, failing the test on error
+func put(t *testing.T, e env, f qfs.File) string {
+	t.Helper()
+	path, err := e.fs.Put(e.ctx, f)
+	if err != nil {
+		t.Fatalf("putting %s: %s", f.FullPath(), err)
+	}
+	return path
+}
+
+func assertData(t *testing.T, f qfs.File, expect string) {
+	t.Helper()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatalf("reading %s: %s", f.FullPath(), err)
+	}
+	if !bytes.Equal(data, []byte(expect)) {
+		t.Errorf("%s: expected data %q. got: %q", f.FullPath(), expect, data)
+	}
+}
@@ -0,0 +1,14 @@
+package spec
+
+import (
+	"testing"
+
+	"github.com/qri-io/qfs"
+)
+
+func TestMemFS(t *testing.T) {
+	AssertFilesystem(t, Config{
+		New: func(t *testing.T) qfs.Filesystem { return qfs.NewMemFS() },
+	})
+	AssertMerkleDagStore(t, func(t *testing.T) qfs.MerkleDagStore { return qfs.NewMemFS() })
+}
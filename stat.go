@@ -0,0 +1,133 @@
+package qfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/ipfs/go-cid"
+)
+
+// FileInfo describes a file or directory. FileInfo implements os.FileInfo,
+// adding the content identifier of entries on content-addressed filesystems
+type FileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	isDir   bool
+	cid     cid.Cid
+}
+
+var _ os.FileInfo = FileInfo{}
+
+// NewFileInfo creates a FileInfo. size should be -1 for directories & files
+// of unknown size, id should be cid.Undef for entries that aren't addressed
+// by CID
+func NewFileInfo(name string, size int64, modTime time.Time, isDir bool, id cid.Cid) FileInfo {
+	return FileInfo{name: name, size: size, modTime: modTime, isDir: isDir, cid: id}
+}
+
+// Name returns the base name of the entry
+func (fi FileInfo) Name() string { return fi.name }
+
+// Size is the length of a file in bytes, -1 for directories & files of
+// unknown size
+func (fi FileInfo) Size() int64 { return fi.size }
+
+// Mode returns file mode bits, qfs entries are readable by all
+func (fi FileInfo) Mode() os.FileMode {
+	if fi.isDir {
+		return os.ModeDir | 0555
+	}
+	return 0444
+}
+
+// ModTime returns the last modification time, zero when the filesystem
+// doesn't track modification times
+func (fi FileInfo) ModTime() time.Time { return fi.modTime }
+
+// IsDir reports whether the entry is a directory
+func (fi FileInfo) IsDir() bool { return fi.isDir }
+
+// Sys returns nil
+func (fi FileInfo) Sys() interface{} { return nil }
+
+// Cid returns the content identifier of the entry, cid.Undef when the
+// filesystem doesn't address content by CID
+func (fi FileInfo) Cid() cid.Cid { return fi.cid }
+
+// FileInfoCid returns the CID of an entry described by fi, cid.Undef if fi
+// doesn't carry one
+func FileInfoCid(fi os.FileInfo) cid.Cid {
+	if c, ok := fi.(interface{ Cid() cid.Cid }); ok {
+		return c.Cid()
+	}
+	return cid.Undef
+}
+
+// StatFile is an optional interface for files that can describe themselves.
+// *os.File implements StatFile
+type StatFile interface {
+	Stat() (os.FileInfo, error)
+}
+
+// StatFS is an optional interface for filesystems that can describe a path
+// without opening it
+type StatFS interface {
+	Stat(ctx context.Context, path string) (os.FileInfo, error)
+}
+
+// Stat describes the file or directory at path. Filesystems that implement
+// StatFS are asked directly, others fall back to opening path with Get &
+// describing the file with FileStat
+func Stat(ctx context.Context, fs Filesystem, path string) (os.FileInfo, error) {
+	if sfs, ok := fs.(StatFS); ok {
+		return sfs.Stat(ctx, path)
+	}
+	f, err := fs.Get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return FileStat(f)
+}
+
+// FileStat describes an open file. Files that implement StatFile describe
+// themselves, others are described by the File interface, without a CID
+func FileStat(f File) (os.FileInfo, error) {
+	if sf, ok := f.(StatFile); ok {
+		return sf.Stat()
+	}
+	size := int64(-1)
+	if !f.IsDirectory() {
+		size = FileSize(f)
+	}
+	return NewFileInfo(f.FileName(), size, f.ModTime(), f.IsDirectory(), cid.Undef), nil
+}
+
+var _ StatFS = (*MemFS)(nil)
+
+// Stat describes a file or directory in the store
+func (m *MemFS) Stat(ctx context.Context, key string) (os.FileInfo, error) {
+	m.filesLk.Lock()
+	defer m.filesLk.Unlock()
+	hash, f, err := m.entry(key)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := cid.Decode(hash)
+	if err != nil {
+		id = cid.Undef
+	}
+	name := path.Base(key)
+	switch file := f.(type) {
+	case fsDir:
+		return NewFileInfo(name, -1, time.Time{}, true, id), nil
+	case fsFile:
+		return NewFileInfo(name, int64(len(file.data)), time.Time{}, false, id), nil
+	}
+	return nil, fmt.Errorf("unexpected entry type %T", f)
+}
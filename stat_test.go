@@ -0,0 +1,67 @@
+package qfs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestStat(t *testing.T) {
+	ctx := context.Background()
+	fs := NewMemFS()
+	key, err := fs.Put(ctx, NewMemdir("/a",
+		NewMemfileBytes("b.txt", []byte("bravo")),
+		NewMemdir("sub", NewMemfileBytes("c.txt", []byte("c"))),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		path  string
+		name  string
+		size  int64
+		isDir bool
+	}{
+		{key, key[len("/mem/"):], -1, true},
+		{key + "/b.txt", "b.txt", 5, false},
+		{key + "/sub", "sub", -1, true},
+		{key + "/sub/c.txt", "c.txt", 1, false},
+	}
+	for _, c := range cases {
+		fi, err := fs.Stat(ctx, c.path)
+		if err != nil {
+			t.Fatalf("%s: %s", c.path, err)
+		}
+		if fi.Name() != c.name || fi.Size() != c.size || fi.IsDir() != c.isDir {
+			t.Errorf("%s: expected name %q size %d dir %t. got: %q %d %t", c.path, c.name, c.size, c.isDir, fi.Name(), fi.Size(), fi.IsDir())
+		}
+		if fi.IsDir() != (fi.Mode()&os.ModeDir != 0) {
+			t.Errorf("%s: mode %s doesn't match IsDir", c.path, fi.Mode())
+		}
+		if !FileInfoCid(fi).Defined() {
+			t.Errorf("%s: expected mem entry to have a cid", c.path)
+		}
+	}
+
+	if _, err := fs.Stat(ctx, key+"/missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected stat of a missing path to fail with ErrNotFound. got: %v", err)
+	}
+	if _, err := fs.Stat(ctx, key+"/b.txt/nope"); !errors.Is(err, ErrNotDirectory) {
+		t.Errorf("expected stat beneath a file to fail with ErrNotDirectory. got: %v", err)
+	}
+
+	// filesystems that don't implement StatFS are described by opening the
+	// path
+	fi, err := Stat(ctx, struct{ Filesystem }{fs}, key+"/b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Name() != "b.txt" || fi.Size() != 5 || fi.IsDir() {
+		t.Errorf("unexpected fallback stat: %q %d %t", fi.Name(), fi.Size(), fi.IsDir())
+	}
+	if FileInfoCid(fi).Defined() {
+		t.Error("expected fallback stat not to have a cid")
+	}
+}
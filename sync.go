@@ -0,0 +1,180 @@
+package qfs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// DefaultSyncWorkers is the number of paths Sync copies at once when no
+// worker count is given
+const DefaultSyncWorkers = 4
+
+// syncCheckpointInterval is the number of copies made between checkpoint
+// writes
+const syncCheckpointInterval = 64
+
+// SyncOptions configures Sync
+type SyncOptions struct {
+	// Paths lists the source paths to copy
+	Paths []string
+	// Workers is the number of paths copied at once. defaults to
+	// DefaultSyncWorkers
+	Workers int
+	// Checkpoint is a file that records finished copies. A later Sync with
+	// the same checkpoint skips paths an earlier run copied. Empty disables
+	// checkpointing
+	Checkpoint string
+}
+
+// SyncReport describes a Sync run
+type SyncReport struct {
+	// Copied maps each source path that's been copied to the path of its
+	// copy on the destination, including copies made by earlier runs
+	Copied map[string]string `json:"copied"`
+	// Skipped counts paths that weren't copied because a checkpoint showed
+	// an earlier run copied them, or the destination already had the content
+	Skipped int `json:"skipped"`
+}
+
+// syncCheckpoint is the progress of a sync saved between runs
+type syncCheckpoint struct {
+	Copied map[string]string `json:"copied"`
+}
+
+// Sync copies paths from src to dst. When both filesystems implement CARFS,
+// DAGs are moved as CAR streams, so content keeps its CID & content dst
+// already has isn't copied again. Otherwise each path is read with Get &
+// written with Put, which suits migrations between unlike stores, like IPFS
+// to an object store.
+//
+// Sync stops at the first error, returning it once in-flight copies finish.
+// With a checkpoint, a later call resumes by skipping paths already copied
+func Sync(ctx context.Context, src, dst Filesystem, opts SyncOptions) (report SyncReport, err error) {
+	report = SyncReport{Copied: map[string]string{}}
+	workers := opts.Workers
+	if workers < 1 {
+		workers = DefaultSyncWorkers
+	}
+
+	var lk sync.Mutex
+	cp := syncCheckpoint{Copied: map[string]string{}}
+	if opts.Checkpoint != "" {
+		if _, err := loadCheckpoint(opts.Checkpoint, &cp); err != nil {
+			return report, fmt.Errorf("reading sync checkpoint: %w", err)
+		}
+		if cp.Copied == nil {
+			cp.Copied = map[string]string{}
+		}
+		defer func() {
+			if serr := saveCheckpoint(opts.Checkpoint, cp); err == nil {
+				err = serr
+			}
+		}()
+	}
+
+	todo := make([]string, 0, len(opts.Paths))
+	for _, p := range opts.Paths {
+		if dstPath, ok := cp.Copied[p]; ok {
+			report.Copied[p] = dstPath
+			report.Skipped++
+			continue
+		}
+		todo = append(todo, p)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		firstErr error
+		copies   int
+		paths    = make(chan string)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range paths {
+				dstPath, skipped, err := syncPath(ctx, src, dst, p)
+
+				lk.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = fmt.Errorf("syncing %q: %w", p, err)
+					}
+					lk.Unlock()
+					continue
+				}
+				report.Copied[p] = dstPath
+				cp.Copied[p] = dstPath
+				if skipped {
+					report.Skipped++
+				}
+				copies++
+				if opts.Checkpoint != "" && copies%syncCheckpointInterval == 0 {
+					if err := saveCheckpoint(opts.Checkpoint, cp); err != nil {
+						log.Debugw("saving sync checkpoint", "err", err)
+					}
+				}
+				lk.Unlock()
+			}
+		}()
+	}
+
+	for _, p := range todo {
+		lk.Lock()
+		failed := firstErr != nil
+		lk.Unlock()
+		if failed || ctx.Err() != nil {
+			break
+		}
+		paths <- p
+	}
+	close(paths)
+	wg.Wait()
+
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	return report, firstErr
+}
+
+// syncPath copies a single path, reporting whether the copy was skipped
+// because dst already has the content
+func syncPath(ctx context.Context, src, dst Filesystem, path string) (dstPath string, skipped bool, err error) {
+	srcCAR, srcOK := src.(CARFS)
+	dstCAR, dstOK := dst.(CARFS)
+	if id, sub, ok := splitCAPath(path); srcOK && dstOK && ok && sub == "" {
+		dstPath = CanonicalPath(dst.Type(), id.String())
+		if has, err := dst.Has(ctx, dstPath); err == nil && has {
+			return dstPath, true, nil
+		}
+		return syncCAR(ctx, srcCAR, dstCAR, path)
+	}
+
+	f, err := src.Get(ctx, path)
+	if err != nil {
+		return "", false, err
+	}
+	defer f.Close()
+	dstPath, err = dst.Put(ctx, f)
+	return dstPath, false, err
+}
+
+// syncCAR streams the DAG at path from src to dst as a CAR archive
+func syncCAR(ctx context.Context, src, dst CARFS, path string) (string, bool, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(src.ExportCAR(ctx, path, pw))
+	}()
+	roots, err := dst.ImportCAR(ctx, pr)
+	// unblock the export if the import stopped reading early
+	pr.CloseWithError(io.ErrClosedPipe)
+	if err != nil {
+		return "", false, err
+	}
+	if len(roots) != 1 {
+		return "", false, fmt.Errorf("expected an archive with 1 root, got %d", len(roots))
+	}
+	return roots[0], false, nil
+}
@@ -0,0 +1,128 @@
+package qfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	src := NewMemFS()
+	var paths []string
+	for i := 0; i < 5; i++ {
+		p, err := src.Put(ctx, NewMemfileBytes(fmt.Sprintf("%d.txt", i), []byte(fmt.Sprintf("file %d", i))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, p)
+	}
+
+	dir, err := ioutil.TempDir("", "qfs_sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	checkpoint := filepath.Join(dir, "sync.json")
+
+	dst := NewMemFS()
+	boom := errors.New("boom")
+	faulty := InjectFaults(dst, FailNth(FaultOpPut, 3, boom))
+	opts := SyncOptions{Paths: paths, Workers: 1, Checkpoint: checkpoint}
+	report, err := Sync(ctx, src, faulty, opts)
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected the put error, got: %v", err)
+	}
+	if len(report.Copied) != 2 {
+		t.Fatalf("expected 2 copies before the failure, got %d", len(report.Copied))
+	}
+
+	opts.Workers = 3
+	report, err = Sync(ctx, src, faulty, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Copied) != len(paths) || report.Skipped != 2 {
+		t.Errorf("expected %d copies & 2 resumed, got %d copies & %d skipped", len(paths), len(report.Copied), report.Skipped)
+	}
+	for _, p := range paths {
+		f, err := dst.Get(ctx, report.Copied[p])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// carMemFS moves MemFS files as a stand-in for CAR archives
+type carMemFS struct {
+	*MemFS
+	imports int
+}
+
+func (c *carMemFS) ExportCAR(ctx context.Context, path string, w io.Writer) error {
+	f, err := c.Get(ctx, path)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func (c *carMemFS) ImportCAR(ctx context.Context, r io.Reader) ([]string, error) {
+	c.imports++
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	id, err := c.PutBlock(data)
+	if err != nil {
+		return nil, err
+	}
+	return []string{CanonicalPath(c.Type(), id.String())}, nil
+}
+
+func TestSyncCAR(t *testing.T) {
+	ctx := context.Background()
+	src, dst := &carMemFS{MemFS: NewMemFS()}, &carMemFS{MemFS: NewMemFS()}
+
+	var paths []string
+	for _, data := range []string{"a", "b"} {
+		id, err := src.PutBlock([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, CanonicalPath(src.Type(), id.String()))
+	}
+	if _, err := dst.PutBlock([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Sync(ctx, src, dst, SyncOptions{Paths: paths})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst.imports != 1 || report.Skipped != 1 {
+		t.Errorf("expected content dst has to be skipped. imports: %d, skipped: %d", dst.imports, report.Skipped)
+	}
+	for _, p := range paths {
+		if report.Copied[p] != p {
+			t.Errorf("expected %s to keep its CID, got %s", p, report.Copied[p])
+		}
+	}
+	f, err := dst.Get(ctx, paths[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadAll(f); !bytes.Equal(data, []byte("b")) {
+		t.Errorf("unexpected content %q", data)
+	}
+}
@@ -0,0 +1,169 @@
+package qfs
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// WriteTar writes a file or directory tree to w as a tar archive. Entries are
+// named relative to root, a single file is written as one entry named by its
+// FileName. Files of unknown size are buffered in memory to size their
+// headers
+func WriteTar(w io.Writer, root File) error {
+	tw := tar.NewWriter(w)
+	if err := writeTarEntry(tw, root, ""); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// WriteTarGz writes a gzip-compressed tar archive of a file or directory tree
+func WriteTarGz(w io.Writer, root File) error {
+	gw := gzip.NewWriter(w)
+	if err := WriteTar(gw, root); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+func writeTarEntry(tw *tar.Writer, f File, name string) error {
+	if f.IsDirectory() {
+		if name != "" {
+			hdr := &tar.Header{
+				Typeflag: tar.TypeDir,
+				Name:     name + "/",
+				Mode:     0755,
+				ModTime:  f.ModTime(),
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+		}
+		for {
+			child, err := f.NextFile()
+			if errors.Is(err, io.EOF) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if err := writeTarEntry(tw, child, path.Join(name, child.FileName())); err != nil {
+				return err
+			}
+		}
+	}
+
+	if name == "" {
+		name = f.FileName()
+	}
+	defer f.Close()
+	var r io.Reader = f
+	size := FileSize(f)
+	if size < 0 {
+		data, err := ioutil.ReadAll(f)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", name, err)
+		}
+		r, size = bytes.NewReader(data), int64(len(data))
+	}
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  f.ModTime(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := io.Copy(tw, r); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	return nil
+}
+
+// ReadTar reads a tar archive into an in-memory directory tree rooted at
+// "/". gzip-compressed archives are detected & decompressed. Entry names are
+// cleaned as rooted paths, so entries can't be placed outside the root. Only
+// directories & regular files are read, other entry types are skipped
+func ReadTar(r io.Reader) (*Memdir, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		r = gr
+	} else {
+		r = br
+	}
+
+	root := NewMemdir("/")
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return root, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		name := path.Clean("/" + hdr.Name)
+		if name == "/" {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			dir, err := tarDir(root, name)
+			if err != nil {
+				return nil, err
+			}
+			dir.modTime = hdr.ModTime
+		case tar.TypeReg, tar.TypeRegA:
+			parent, err := tarDir(root, path.Dir(name))
+			if err != nil {
+				return nil, err
+			}
+			data, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return nil, fmt.Errorf("reading %s: %w", hdr.Name, err)
+			}
+			f := NewMemfileBytes(name, data)
+			f.modTime = hdr.ModTime
+			parent.links = append(parent.links, f)
+		default:
+			log.Debugw("skipping tar entry", "name", hdr.Name, "type", hdr.Typeflag)
+		}
+	}
+}
+
+// tarDir returns the directory at dirpath in root, creating it & any missing
+// parents
+func tarDir(root *Memdir, dirpath string) (*Memdir, error) {
+	dir := root
+	for _, name := range strings.Split(strings.Trim(dirpath, "/"), "/") {
+		if name == "" {
+			continue
+		}
+		ch := dir.ChildDir(name)
+		if ch == nil {
+			for _, f := range dir.links {
+				if f.FileName() == name {
+					return nil, fmt.Errorf("%w: %s", ErrNotDirectory, path.Join(dir.path, name))
+				}
+			}
+			ch = NewMemdir(path.Join(dir.path, name))
+			dir.links = append(dir.links, ch)
+		}
+		dir = ch
+	}
+	return dir, nil
+}
@@ -0,0 +1,82 @@
+package qfs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestTarRoundTrip(t *testing.T) {
+	tree := func() File {
+		return NewMemdir("/export",
+			NewMemfileBytes("dataset.json", []byte(`{"name":"ds"}`)),
+			NewMemdir("body",
+				NewMemfileBytes("body.csv", []byte("a,b\n1,2\n")),
+				// unknown size is buffered
+				NewMemfileReader("stream.txt", bytes.NewReader([]byte("streamed"))),
+			),
+		)
+	}
+
+	for _, gz := range []bool{false, true} {
+		buf := &bytes.Buffer{}
+		write := WriteTar
+		if gz {
+			write = WriteTarGz
+		}
+		if err := write(buf, tree()); err != nil {
+			t.Fatal(err)
+		}
+
+		root, err := ReadTar(buf)
+		if err != nil {
+			t.Fatalf("gz=%t: %s", gz, err)
+		}
+		got := map[string]string{}
+		err = Walk(root, func(f File) error {
+			if f.IsDirectory() {
+				got[f.FullPath()] = "dir"
+				return nil
+			}
+			data, err := ioutil.ReadAll(f)
+			got[f.FullPath()] = string(data)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := map[string]string{
+			"/":                "dir",
+			"/dataset.json":    `{"name":"ds"}`,
+			"/body":            "dir",
+			"/body/body.csv":   "a,b\n1,2\n",
+			"/body/stream.txt": "streamed",
+		}
+		if len(got) != len(expect) {
+			t.Errorf("gz=%t: expected %v, got %v", gz, expect, got)
+		}
+		for p, v := range expect {
+			if got[p] != v {
+				t.Errorf("gz=%t: %s: expected %q, got %q", gz, p, v, got[p])
+			}
+		}
+	}
+}
+
+func TestTarSingleFile(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := WriteTar(buf, NewMemfileBytes("/a/b/data.json", []byte("{}"))); err != nil {
+		t.Fatal(err)
+	}
+	root, err := ReadTar(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := root.NextFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.FullPath() != "/data.json" {
+		t.Errorf("expected a single file to be named by its base, got %q", f.FullPath())
+	}
+}
@@ -0,0 +1,582 @@
+// Package tierfs composes an ordered list of filesystems into one. Reads try
+// each tier in order, so a local store can be backed by slower or more
+// distant copies, like local IPFS → an HTTP gateway → an object store mirror.
+// Writes go to the first tier, the primary, and can be replicated to the
+// other tiers in the background.
+//
+// Tiers that fail with an error other than qfs.ErrNotFound are marked down &
+// tried after healthy tiers until their cooldown passes. Replication copies
+// files to the same path they have on the primary, so it's meant for tiers
+// that address content the same way, like content-addressed filesystems of
+// the same type
+//
+// With a popularity tracker, reads are counted so content can be placed by
+// how often it's read: Promote copies the hottest content up to the primary
+// & Demote drops cold content from the primary once another tier holds it
+package tierfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log"
+	"github.com/qri-io/qfs"
+)
+
+var log = logging.Logger("tierfs")
+
+// DefaultCooldown is how long a tier that failed is tried after healthy
+// tiers when no cooldown is configured
+const DefaultCooldown = 30 * time.Second
+
+// DefaultColdThreshold is the estimated read count below which content is
+// cold when no threshold is configured
+const DefaultColdThreshold = 2
+
+// Config configures a tiered filesystem
+type Config struct {
+	// Replicate copies files put to the primary to every other tier in the
+	// background
+	Replicate bool
+	// Cooldown is how long a tier that failed is tried after healthy tiers,
+	// & how long failed replications wait before they're retried. defaults
+	// to DefaultCooldown
+	Cooldown time.Duration
+	// Popularity counts reads through the filesystem. Promote & Demote
+	// require a tracker
+	Popularity *qfs.Popularity
+	// ColdThreshold is the estimated read count below which a path is cold,
+	// see qfs.Popularity.IsCold. defaults to DefaultColdThreshold
+	ColdThreshold uint32
+}
+
+// TierStats counts activity on a single tier
+type TierStats struct {
+	// Type is the tier's filesystem type
+	Type string
+	// Hits counts Gets answered by this tier, Misses counts Gets the tier
+	// didn't have the path for
+	Hits   int64
+	Misses int64
+	// Errors counts failed operations other than misses
+	Errors int64
+	// Replicated counts files copied to this tier, ReplicationErrors counts
+	// failed copies
+	Replicated        int64
+	ReplicationErrors int64
+	// Healthy is false while the tier is cooling down after an error
+	Healthy bool
+	// LastErr is the tier's most recent error, if any
+	LastErr error
+}
+
+// FS reads from an ordered list of filesystems & writes to the first one. An
+// FS has the same type as its primary, so it can stand in for it in a Mux
+type FS struct {
+	tiers     []*tier
+	replicate bool
+	cooldown  time.Duration
+	now       func() time.Time
+	wake      chan struct{}
+	pop       *qfs.Popularity
+	cold      uint32
+
+	// replk serializes replication passes
+	replk sync.Mutex
+	lk    sync.Mutex
+	// queue lists puts waiting to replicate, in the order they were made
+	queue []replication
+	// deleted collects paths deleted while a replication pass is running, so
+	// the pass can drop them. it's nil between passes
+	deleted map[string]struct{}
+	// retrying is true while a retry of failed replications is scheduled
+	retrying bool
+}
+
+// tier is a filesystem & its health
+type tier struct {
+	fs qfs.Filesystem
+
+	lk        sync.Mutex
+	stats     TierStats
+	downUntil time.Time
+}
+
+// replication is a put that hasn't been copied to every tier yet
+type replication struct {
+	path string
+	// tiers are the indexes of tiers still missing the path
+	tiers []int
+}
+
+var (
+	_ qfs.Filesystem   = (*FS)(nil)
+	_ qfs.DescribingFS = (*FS)(nil)
+)
+
+// New composes tiers into one filesystem, the first tier is the primary.
+// Background replication stops when ctx ends
+func New(ctx context.Context, cfg Config, tiers ...qfs.Filesystem) (*FS, error) {
+	if len(tiers) == 0 {
+		return nil, fmt.Errorf("tierfs: at least one tier is required")
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = DefaultCooldown
+	}
+	if cfg.ColdThreshold == 0 {
+		cfg.ColdThreshold = DefaultColdThreshold
+	}
+	fs := &FS{
+		replicate: cfg.Replicate,
+		cooldown:  cfg.Cooldown,
+		now:       time.Now,
+		wake:      make(chan struct{}, 1),
+		pop:       cfg.Popularity,
+		cold:      cfg.ColdThreshold,
+	}
+	for _, t := range tiers {
+		fs.tiers = append(fs.tiers, &tier{fs: t, stats: TierStats{Type: t.Type()}})
+	}
+	if fs.replicate && len(fs.tiers) > 1 {
+		go fs.run(ctx)
+	}
+	return fs, nil
+}
+
+// Type returns the type of the primary filesystem
+func (fs *FS) Type() string { return fs.tiers[0].fs.Type() }
+
+// Describe returns the primary's descriptor
+func (fs *FS) Describe() qfs.Descriptor { return qfs.Describe(fs.tiers[0].fs) }
+
+// Stats returns a snapshot of each tier's activity, in tier order
+func (fs *FS) Stats() []TierStats {
+	now := fs.now()
+	stats := make([]TierStats, len(fs.tiers))
+	for i, t := range fs.tiers {
+		t.lk.Lock()
+		stats[i] = t.stats
+		stats[i].Healthy = !now.Before(t.downUntil)
+		t.lk.Unlock()
+	}
+	return stats
+}
+
+// order lists tiers to try, healthy tiers first, each group in tier order
+func (fs *FS) order() []*tier {
+	now := fs.now()
+	healthy := make([]*tier, 0, len(fs.tiers))
+	var down []*tier
+	for _, t := range fs.tiers {
+		t.lk.Lock()
+		ok := !now.Before(t.downUntil)
+		t.lk.Unlock()
+		if ok {
+			healthy = append(healthy, t)
+		} else {
+			down = append(down, t)
+		}
+	}
+	return append(healthy, down...)
+}
+
+// record updates a tier's stats & health with the result of an operation,
+// reporting whether err is a failure of the tier. Misses & cancelled
+// operations don't count against a tier's health
+func (fs *FS) record(ctx context.Context, t *tier, err error) (failed bool) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	switch {
+	case err == nil:
+		t.downUntil = time.Time{}
+		return false
+	case errors.Is(err, qfs.ErrNotFound):
+		t.stats.Misses++
+		return false
+	case ctx.Err() != nil:
+		return false
+	}
+	t.stats.Errors++
+	t.stats.LastErr = err
+	t.downUntil = fs.now().Add(fs.cooldown)
+	log.Debugw("tier failed", "type", t.stats.Type, "err", err)
+	return true
+}
+
+// Get reads a file from the first tier that has it. When no tier has the
+// file, Get returns an error matching qfs.ErrNotFound if every tier missed,
+// or the last tier error otherwise. Successful reads are counted by the
+// popularity tracker, if there is one
+func (fs *FS) Get(ctx context.Context, path string) (qfs.File, error) {
+	var lastErr error
+	for _, t := range fs.order() {
+		f, err := t.fs.Get(ctx, path)
+		if fs.record(ctx, t, err) {
+			lastErr = err
+		}
+		if err == nil {
+			t.lk.Lock()
+			t.stats.Hits++
+			t.lk.Unlock()
+			if fs.pop != nil {
+				fs.pop.Touch(path)
+			}
+			return f, nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, fmt.Errorf("%w: %s", qfs.ErrNotFound, path)
+}
+
+// Has reports whether any tier has path
+func (fs *FS) Has(ctx context.Context, path string) (bool, error) {
+	var lastErr error
+	for _, t := range fs.order() {
+		has, err := t.fs.Has(ctx, path)
+		if fs.record(ctx, t, err) {
+			lastErr = err
+			continue
+		}
+		if has {
+			return true, nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return false, ctxErr
+		}
+	}
+	return false, lastErr
+}
+
+// Put writes a file to the primary, queueing it for replication to the other
+// tiers when replication is enabled
+func (fs *FS) Put(ctx context.Context, file qfs.File) (string, error) {
+	primary := fs.tiers[0]
+	path, err := primary.fs.Put(ctx, file)
+	if fs.record(ctx, primary, err) || err != nil {
+		return "", err
+	}
+
+	if fs.replicate && len(fs.tiers) > 1 {
+		r := replication{path: path}
+		for i := 1; i < len(fs.tiers); i++ {
+			r.tiers = append(r.tiers, i)
+		}
+		fs.lk.Lock()
+		fs.queue = append(fs.queue, r)
+		if fs.deleted != nil {
+			delete(fs.deleted, path)
+		}
+		fs.lk.Unlock()
+		fs.signal()
+	}
+	return path, nil
+}
+
+// signal wakes the background replicator
+func (fs *FS) signal() {
+	select {
+	case fs.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Delete removes a path from the primary. With replication enabled the path
+// is removed from every tier, tiers that don't have it or can't delete are
+// skipped. A tier failing to delete doesn't stop the others, the first error
+// is returned. Pending replications of the path are dropped, including ones a
+// running replication pass has already taken from the queue
+func (fs *FS) Delete(ctx context.Context, path string) error {
+	fs.lk.Lock()
+	queue := fs.queue[:0]
+	for _, r := range fs.queue {
+		if r.path != path {
+			queue = append(queue, r)
+		}
+	}
+	fs.queue = queue
+	if fs.deleted != nil {
+		fs.deleted[path] = struct{}{}
+	}
+	fs.lk.Unlock()
+
+	primary := fs.tiers[0]
+	err := primary.fs.Delete(ctx, path)
+	if fs.record(ctx, primary, err) || err != nil {
+		return err
+	}
+	if !fs.replicate {
+		return nil
+	}
+	var firstErr error
+	for _, t := range fs.tiers[1:] {
+		if err := fs.deleteReplica(ctx, path, t); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// deleteReplica removes path from a secondary tier. tiers that don't have it
+// or can't delete are skipped
+func (fs *FS) deleteReplica(ctx context.Context, path string, t *tier) error {
+	err := t.fs.Delete(ctx, path)
+	if errors.Is(err, qfs.ErrReadOnly) || errors.Is(err, qfs.ErrUnsupported) {
+		return nil
+	}
+	if fs.record(ctx, t, err) {
+		return fmt.Errorf("deleting %q from %s tier: %w", path, t.stats.Type, err)
+	}
+	return nil
+}
+
+// wasDeleted reports whether path was deleted since the running replication
+// pass started
+func (fs *FS) wasDeleted(path string) bool {
+	fs.lk.Lock()
+	defer fs.lk.Unlock()
+	_, ok := fs.deleted[path]
+	return ok
+}
+
+// Pending returns the number of puts waiting to replicate
+func (fs *FS) Pending() int {
+	fs.lk.Lock()
+	defer fs.lk.Unlock()
+	return len(fs.queue)
+}
+
+// Hottest returns up to n of the most read paths, most popular first. It
+// returns nil without a popularity tracker
+func (fs *FS) Hottest(n int) []qfs.PopularityEntry {
+	if fs.pop == nil {
+		return nil
+	}
+	return fs.pop.Hottest(n)
+}
+
+// Promote copies up to n of the most read paths that aren't cold to the
+// primary from the first other tier that has them, so popular content is
+// read from the primary. It returns the promoted paths & the first error,
+// paths that fail to copy are skipped
+func (fs *FS) Promote(ctx context.Context, n int) ([]string, error) {
+	if fs.pop == nil {
+		return nil, errNoPopularity
+	}
+	primary := fs.tiers[0]
+	var (
+		promoted []string
+		firstErr error
+	)
+	for _, e := range fs.pop.Hottest(n) {
+		if err := ctx.Err(); err != nil {
+			return promoted, err
+		}
+		if fs.pop.IsCold(e.Key, fs.cold) {
+			continue
+		}
+		if has, err := primary.fs.Has(ctx, e.Key); fs.record(ctx, primary, err) || has {
+			continue
+		}
+		if err := fs.promoteOne(ctx, e.Key); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("promoting %q: %w", e.Key, err)
+			}
+			continue
+		}
+		promoted = append(promoted, e.Key)
+	}
+	return promoted, firstErr
+}
+
+// promoteOne copies path to the primary from the first other tier that has
+// it
+func (fs *FS) promoteOne(ctx context.Context, path string) error {
+	primary := fs.tiers[0]
+	for _, t := range fs.order() {
+		if t == primary {
+			continue
+		}
+		f, err := t.fs.Get(ctx, path)
+		if fs.record(ctx, t, err) || err != nil {
+			continue
+		}
+		_, err = primary.fs.Put(ctx, f)
+		f.Close()
+		fs.record(ctx, primary, err)
+		return err
+	}
+	return fmt.Errorf("%w: %s", qfs.ErrNotFound, path)
+}
+
+// Demote removes cold paths from the primary once another tier has them, so
+// the primary keeps popular content. paths are the candidates to demote,
+// paths waiting to replicate are kept. It returns the demoted paths & the
+// first error, paths that fail to delete are skipped
+func (fs *FS) Demote(ctx context.Context, paths []string) ([]string, error) {
+	if fs.pop == nil {
+		return nil, errNoPopularity
+	}
+	primary := fs.tiers[0]
+	var (
+		demoted  []string
+		firstErr error
+	)
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return demoted, err
+		}
+		if !fs.pop.IsCold(path, fs.cold) || fs.isPending(path) || !fs.hasReplica(ctx, path) {
+			continue
+		}
+		err := primary.fs.Delete(ctx, path)
+		if fs.record(ctx, primary, err) || err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("demoting %q: %w", path, err)
+			}
+			continue
+		}
+		demoted = append(demoted, path)
+	}
+	return demoted, firstErr
+}
+
+// hasReplica reports whether a tier other than the primary has path
+func (fs *FS) hasReplica(ctx context.Context, path string) bool {
+	for _, t := range fs.tiers[1:] {
+		if has, err := t.fs.Has(ctx, path); !fs.record(ctx, t, err) && has {
+			return true
+		}
+	}
+	return false
+}
+
+// isPending reports whether path is waiting to replicate
+func (fs *FS) isPending(path string) bool {
+	fs.lk.Lock()
+	defer fs.lk.Unlock()
+	for _, r := range fs.queue {
+		if r.path == path {
+			return true
+		}
+	}
+	return false
+}
+
+var errNoPopularity = fmt.Errorf("%w: tierfs has no popularity tracker", qfs.ErrUnsupported)
+
+// Flush replicates all pending puts, returning the first replication error
+func (fs *FS) Flush(ctx context.Context) error {
+	return fs.replicateQueue(ctx)
+}
+
+func (fs *FS) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-fs.wake:
+			if err := fs.replicateQueue(ctx); err != nil {
+				log.Debugw("tier replication", "err", err)
+			}
+		}
+	}
+}
+
+// replicateQueue copies queued puts to the tiers missing them. Copies that
+// fail stay queued & are retried once the cooldown passes
+func (fs *FS) replicateQueue(ctx context.Context) error {
+	fs.replk.Lock()
+	defer fs.replk.Unlock()
+
+	fs.lk.Lock()
+	queue := fs.queue
+	fs.queue = nil
+	fs.deleted = map[string]struct{}{}
+	fs.lk.Unlock()
+
+	var (
+		firstErr error
+		failed   []replication
+	)
+	for _, r := range queue {
+		remaining := r.tiers[:0:0]
+		for _, i := range r.tiers {
+			if fs.wasDeleted(r.path) {
+				break
+			}
+			if err := ctx.Err(); err != nil {
+				remaining = append(remaining, i)
+				continue
+			}
+			if err := fs.replicateOne(ctx, r.path, fs.tiers[i]); err != nil {
+				remaining = append(remaining, i)
+				if firstErr == nil {
+					firstErr = fmt.Errorf("replicating %q to %s tier: %w", r.path, fs.tiers[i].stats.Type, err)
+				}
+			} else if fs.wasDeleted(r.path) {
+				// the path was deleted while it was being copied, which
+				// can leave the copy behind
+				if err := fs.deleteReplica(ctx, r.path, fs.tiers[i]); err != nil {
+					log.Debugw("removing replica of deleted path", "err", err)
+				}
+			}
+		}
+		if len(remaining) > 0 && !fs.wasDeleted(r.path) {
+			failed = append(failed, replication{path: r.path, tiers: remaining})
+		}
+	}
+
+	fs.lk.Lock()
+	fs.deleted = nil
+	if len(failed) > 0 {
+		fs.queue = append(failed, fs.queue...)
+		if !fs.retrying && ctx.Err() == nil {
+			fs.retrying = true
+			time.AfterFunc(fs.cooldown, fs.retry)
+		}
+	}
+	fs.lk.Unlock()
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	return firstErr
+}
+
+// retry wakes the background replicator to retry failed replications
+func (fs *FS) retry() {
+	fs.lk.Lock()
+	fs.retrying = false
+	fs.lk.Unlock()
+	fs.signal()
+}
+
+// replicateOne copies path from the primary to t, unless t already has it
+func (fs *FS) replicateOne(ctx context.Context, path string, t *tier) error {
+	if has, err := t.fs.Has(ctx, path); err == nil && has {
+		return nil
+	}
+	f, err := fs.tiers[0].fs.Get(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = t.fs.Put(ctx, f)
+	fs.record(ctx, t, err)
+	t.lk.Lock()
+	if err != nil {
+		t.stats.ReplicationErrors++
+	} else {
+		t.stats.Replicated++
+	}
+	t.lk.Unlock()
+	return err
+}
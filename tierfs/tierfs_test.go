@@ -0,0 +1,299 @@
+package tierfs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/qri-io/qfs"
+)
+
+func TestGetFallsBack(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	primary, mirror := qfs.NewMemFS(), qfs.NewMemFS()
+	path, err := mirror.Put(ctx, qfs.NewMemfileBytes("a.txt", []byte("from the mirror")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	boom := errors.New("boom")
+	faulty := qfs.InjectFaults(primary, qfs.FailNth(qfs.FaultOpGet, 2, boom))
+
+	fs, err := New(ctx, Config{Cooldown: time.Minute}, faulty, mirror)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	fs.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		f, err := fs.Get(ctx, path)
+		if err != nil {
+			t.Fatalf("get %d: %s", i, err)
+		}
+		data, err := ioutil.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "from the mirror" {
+			t.Errorf("get %d: unexpected content %q", i, data)
+		}
+	}
+
+	stats := fs.Stats()
+	if stats[0].Misses != 1 || stats[0].Errors != 1 || stats[0].Healthy || !errors.Is(stats[0].LastErr, boom) {
+		t.Errorf("expected the primary to miss once, fail once & be marked down, got %+v", stats[0])
+	}
+	if stats[1].Hits != 3 || !stats[1].Healthy {
+		t.Errorf("expected the mirror to answer every get, got %+v", stats[1])
+	}
+	if order := fs.order(); order[0].fs != mirror {
+		t.Error("expected a tier that's down to be tried last")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if !fs.Stats()[0].Healthy {
+		t.Error("expected the primary to be healthy once its cooldown passes")
+	}
+
+	if _, err := fs.Get(ctx, "/mem/missing"); !errors.Is(err, qfs.ErrNotFound) {
+		t.Errorf("expected ErrNotFound when every tier misses, got: %v", err)
+	}
+	if has, err := fs.Has(ctx, path); err != nil || !has {
+		t.Errorf("expected has to find the mirrored path. has: %t, err: %v", has, err)
+	}
+}
+
+func TestReplicate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	primary, mirror := qfs.NewMemFS(), qfs.NewMemFS()
+	faultyMirror := qfs.InjectFaults(mirror, qfs.FailNth(qfs.FaultOpPut, 1, errors.New("mirror offline")))
+	fs, err := New(ctx, Config{Replicate: true}, primary, faultyMirror)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// hold off background replication until the put is checked
+	fs.replk.Lock()
+
+	path, err := fs.Put(ctx, qfs.NewMemfileBytes("a.txt", []byte("replicate me")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fs.Type() != primary.Type() {
+		t.Errorf("expected the primary's type, got %q", fs.Type())
+	}
+	if has, _ := mirror.Has(ctx, path); has {
+		t.Fatal("expected put to write only to the primary")
+	}
+	if fs.Pending() != 1 {
+		t.Fatalf("expected 1 pending replication, got %d", fs.Pending())
+	}
+	fs.replk.Unlock()
+
+	// the first attempt fails & stays queued, whether it's made by the
+	// background replicator or by Flush
+	for i := 0; fs.Flush(ctx) != nil; i++ {
+		if i == 2 {
+			t.Fatal("expected replication to succeed on retry")
+		}
+	}
+	if fs.Pending() != 0 {
+		t.Fatalf("expected no pending replications, got %d", fs.Pending())
+	}
+	if has, _ := mirror.Has(ctx, path); !has {
+		t.Error("expected the put to replicate to the mirror")
+	}
+	if stats := fs.Stats()[1]; stats.Replicated != 1 || stats.ReplicationErrors != 1 {
+		t.Errorf("expected one replication & one replication error, got %+v", stats)
+	}
+
+	if err := fs.Delete(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+	for i, tier := range []qfs.Filesystem{primary, mirror} {
+		if has, _ := tier.Has(ctx, path); has {
+			t.Errorf("expected delete to remove the path from tier %d", i)
+		}
+	}
+}
+
+func TestReplicateRetries(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	primary, mirror := qfs.NewMemFS(), qfs.NewMemFS()
+	faultyMirror := qfs.InjectFaults(mirror, qfs.FailNth(qfs.FaultOpPut, 1, errors.New("mirror offline")))
+	fs, err := New(ctx, Config{Replicate: true, Cooldown: 10 * time.Millisecond}, primary, faultyMirror)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := fs.Put(ctx, qfs.NewMemfileBytes("a.txt", []byte("replicate me")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// no further puts wake the replicator, the failed copy is retried once
+	// the cooldown passes
+	deadline := time.Now().Add(5 * time.Second)
+	for has, _ := mirror.Has(ctx, path); !has; has, _ = mirror.Has(ctx, path) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected failed replication to be retried")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if stats := fs.Stats()[1]; stats.Replicated != 1 || stats.ReplicationErrors != 1 {
+		t.Errorf("expected one replication & one replication error, got %+v", stats)
+	}
+}
+
+// blockingFS holds Puts until release is closed
+type blockingFS struct {
+	qfs.Filesystem
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingFS) Put(ctx context.Context, f qfs.File) (string, error) {
+	b.entered <- struct{}{}
+	<-b.release
+	return b.Filesystem.Put(ctx, f)
+}
+
+func TestDeleteDuringReplication(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	primary, mirror := qfs.NewMemFS(), qfs.NewMemFS()
+	blocking := &blockingFS{Filesystem: mirror, entered: make(chan struct{}), release: make(chan struct{})}
+	fs, err := New(ctx, Config{Replicate: true}, primary, blocking)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := fs.Put(ctx, qfs.NewMemfileBytes("a.txt", []byte("delete me")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the replication pass has taken the put from the queue
+	<-blocking.entered
+	if err := fs.Delete(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+	close(blocking.release)
+
+	if err := fs.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if fs.Pending() != 0 {
+		t.Errorf("expected no pending replications, got %d", fs.Pending())
+	}
+	if has, _ := mirror.Has(ctx, path); has {
+		t.Error("expected a path deleted during replication not to be left on the mirror")
+	}
+}
+
+func TestDeleteTriesEveryTier(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	primary, mirror, backup := qfs.NewMemFS(), qfs.NewMemFS(), qfs.NewMemFS()
+	boom := errors.New("boom")
+	faultyMirror := qfs.InjectFaults(mirror, qfs.FailNth(qfs.FaultOpDelete, 1, boom))
+	fs, err := New(ctx, Config{Replicate: true}, primary, faultyMirror, backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := fs.Put(ctx, qfs.NewMemfileBytes("a.txt", []byte("delete everywhere")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fs.Delete(ctx, path); !errors.Is(err, boom) {
+		t.Errorf("expected the mirror's delete error. got: %v", err)
+	}
+	if has, _ := mirror.Has(ctx, path); !has {
+		t.Error("expected the failed delete to leave the path on the mirror")
+	}
+	for i, tier := range []qfs.Filesystem{primary, backup} {
+		if has, _ := tier.Has(ctx, path); has {
+			t.Errorf("expected delete to remove the path from tier %d despite the mirror failing", i)
+		}
+	}
+}
+
+func TestPlaceByPopularity(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	primary, mirror := qfs.NewMemFS(), qfs.NewMemFS()
+	hot, err := mirror.Put(ctx, qfs.NewMemfileBytes("hot.txt", []byte("read often")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cold, err := mirror.Put(ctx, qfs.NewMemfileBytes("cold.txt", []byte("read once")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := primary.Put(ctx, qfs.NewMemfileBytes("cold.txt", []byte("read once"))); err != nil {
+		t.Fatal(err)
+	}
+
+	plain, err := New(ctx, Config{}, primary, mirror)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plain.Promote(ctx, 1); !errors.Is(err, qfs.ErrUnsupported) {
+		t.Errorf("expected promote without a tracker to be unsupported. got: %v", err)
+	}
+
+	pop := qfs.NewPopularity(qfs.DefaultPopularityConfig())
+	fs, err := New(ctx, Config{Popularity: pop, ColdThreshold: 3}, primary, mirror)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := fs.Get(ctx, hot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := fs.Get(ctx, cold); err != nil {
+		t.Fatal(err)
+	}
+	if hottest := fs.Hottest(1); len(hottest) != 1 || hottest[0].Key != hot {
+		t.Errorf("expected %q to be the hottest path. got: %v", hot, hottest)
+	}
+
+	promoted, err := fs.Promote(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(promoted) != 1 || promoted[0] != hot {
+		t.Errorf("expected only %q to be promoted. got: %v", hot, promoted)
+	}
+	if has, _ := primary.Has(ctx, hot); !has {
+		t.Error("expected promoted content on the primary")
+	}
+
+	demoted, err := fs.Demote(ctx, []string{hot, cold})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(demoted) != 1 || demoted[0] != cold {
+		t.Errorf("expected only %q to be demoted. got: %v", cold, demoted)
+	}
+	if has, _ := primary.Has(ctx, cold); has {
+		t.Error("expected demoted content to be removed from the primary")
+	}
+	if has, _ := mirror.Has(ctx, cold); !has {
+		t.Error("expected demoted content to stay on the mirror")
+	}
+}
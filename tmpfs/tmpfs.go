@@ -0,0 +1,408 @@
+// Package tmpfs is a content-addressed scratch filesystem for intermediate
+// outputs. Entries expire after a TTL, the filesystem is bounded in size, and
+// everything it holds is removed when the filesystem's context ends, so
+// scratch data never reaches a durable store
+package tmpfs
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log"
+	"github.com/mitchellh/mapstructure"
+	"github.com/multiformats/go-multihash"
+	"github.com/qri-io/qfs"
+)
+
+// FilestoreType uniquely identifies this filestore
+const FilestoreType = "tmpfs"
+
+var log = logging.Logger("tmpfs")
+
+const (
+	// DefaultTTL is how long entries live when no TTL is configured
+	DefaultTTL = time.Hour
+	// DefaultMaxSize is the size bound when none is configured
+	DefaultMaxSize = int64(1 << 30)
+)
+
+// ErrTooLarge is returned when putting a file larger than the filesystem's
+// size bound
+var ErrTooLarge = errors.New("file exceeds tmpfs size limit")
+
+// FSConfig adjusts the behaviour of an FS instance
+type FSConfig struct {
+	// Dir is the parent of the scratch directory, defaults to the system
+	// temp directory
+	Dir string
+	// MaxSize bounds the bytes stored. When a write would exceed the bound,
+	// the least recently used entries are evicted
+	MaxSize int64
+	// TTL is a duration string like "30m". Entries expire TTL after they were
+	// last written
+	TTL string
+}
+
+// DefaultFSConfig is the configuration state with no additional options
+// consumers of this package typically don't need to use this
+func DefaultFSConfig() *FSConfig {
+	return &FSConfig{
+		MaxSize: DefaultMaxSize,
+		TTL:     DefaultTTL.String(),
+	}
+}
+
+// if no cfgMap is given, return the default config
+func mapToConfig(cfgMap map[string]interface{}) (*FSConfig, error) {
+	cfg := DefaultFSConfig()
+	if cfgMap == nil {
+		return cfg, nil
+	}
+	if err := mapstructure.Decode(cfgMap, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// FS is a content-addressed scratch filesystem backed by a temp directory
+type FS struct {
+	dir     string
+	maxSize int64
+	ttl     time.Duration
+	now     func() time.Time
+
+	lk      sync.Mutex
+	size    int64
+	order   *list.List
+	entries map[string]*list.Element
+
+	doneCh  chan struct{}
+	doneErr error
+}
+
+type entry struct {
+	key     string
+	size    int64
+	expires time.Time
+}
+
+var (
+	_ qfs.Filesystem          = (*FS)(nil)
+	_ qfs.CAFS                = (*FS)(nil)
+	_ qfs.ReleasingFilesystem = (*FS)(nil)
+	_ qfs.HasManyFS           = (*FS)(nil)
+)
+
+// NewFilesystem creates a tmpfs from a config map. The filesystem and all
+// its contents are removed when ctx ends
+func NewFilesystem(ctx context.Context, cfgMap map[string]interface{}) (qfs.Filesystem, error) {
+	cfg, err := mapToConfig(cfgMap)
+	if err != nil {
+		return nil, err
+	}
+	return NewFS(ctx, cfg)
+}
+
+// NewFS creates a tmpfs. The filesystem and all its contents are removed
+// when ctx ends
+func NewFS(ctx context.Context, cfg *FSConfig) (*FS, error) {
+	ttl := DefaultTTL
+	if cfg.TTL != "" {
+		d, err := time.ParseDuration(cfg.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("parsing tmpfs ttl: %w", err)
+		}
+		ttl = d
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("tmpfs ttl must be greater than zero")
+	}
+	maxSize := cfg.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+
+	dir, err := ioutil.TempDir(cfg.Dir, "qfs-tmpfs-")
+	if err != nil {
+		return nil, fmt.Errorf("creating tmpfs directory: %w", err)
+	}
+
+	fs := &FS{
+		dir:     dir,
+		maxSize: maxSize,
+		ttl:     ttl,
+		now:     time.Now,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+		doneCh:  make(chan struct{}),
+	}
+	go fs.sweep(ctx)
+	return fs, nil
+}
+
+// Type distinguishes this filesystem from others by a unique string prefix
+func (fs *FS) Type() string { return FilestoreType }
+
+// IsContentAddressedFilesystem declares tmpfs paths are content hashes
+func (fs *FS) IsContentAddressedFilesystem() {}
+
+// Done implements the qfs.ReleasingFilesystem interface
+func (fs *FS) Done() <-chan struct{} { return fs.doneCh }
+
+// DoneErr implements the qfs.ReleasingFilesystem interface
+func (fs *FS) DoneErr() error { return fs.doneErr }
+
+// Size returns the number of bytes stored
+func (fs *FS) Size() int64 {
+	fs.lk.Lock()
+	defer fs.lk.Unlock()
+	return fs.size
+}
+
+// Has returns whether the store has an unexpired file with the given path
+func (fs *FS) Has(ctx context.Context, path string) (bool, error) {
+	key, err := pathKey(path)
+	if err != nil {
+		return false, err
+	}
+	fs.lk.Lock()
+	defer fs.lk.Unlock()
+	return fs.lookup(key) != nil, nil
+}
+
+// HasMany checks a batch of paths under a single lock
+func (fs *FS) HasMany(ctx context.Context, paths []string) (map[string]bool, error) {
+	keys := make([]string, len(paths))
+	for i, path := range paths {
+		key, err := pathKey(path)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = key
+	}
+
+	res := make(map[string]bool, len(paths))
+	fs.lk.Lock()
+	defer fs.lk.Unlock()
+	for i, key := range keys {
+		res[paths[i]] = fs.lookup(key) != nil
+	}
+	return res, nil
+}
+
+// Get fetches a file
+func (fs *FS) Get(ctx context.Context, path string) (qfs.File, error) {
+	key, err := pathKey(path)
+	if err != nil {
+		return nil, err
+	}
+	fs.lk.Lock()
+	e := fs.lookup(key)
+	fs.lk.Unlock()
+	if e == nil {
+		return nil, qfs.ErrNotFound
+	}
+
+	f, err := os.Open(filepath.Join(fs.dir, key))
+	if os.IsNotExist(err) {
+		return nil, qfs.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &file{File: f, path: path, size: e.size}, nil
+}
+
+// Put stores a file, returning a path derived from its content. Putting
+// content that's already stored refreshes its TTL. Directories aren't
+// supported
+func (fs *FS) Put(ctx context.Context, f qfs.File) (string, error) {
+	if f.IsDirectory() {
+		return "", fmt.Errorf("%w: tmpfs directories", qfs.ErrUnsupported)
+	}
+
+	tmp, err := ioutil.TempFile(fs.dir, ".put-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), io.LimitReader(f, fs.maxSize+1))
+	tmp.Close()
+	if err != nil {
+		return "", err
+	}
+	if size > fs.maxSize {
+		return "", fmt.Errorf("%w: limit is %d bytes", ErrTooLarge, fs.maxSize)
+	}
+
+	mh, err := multihash.Encode(h.Sum(nil), multihash.SHA2_256)
+	if err != nil {
+		return "", err
+	}
+	key := cid.NewCidV1(cid.Raw, mh).String()
+	path := fmt.Sprintf("/%s/%s", FilestoreType, key)
+
+	fs.lk.Lock()
+	defer fs.lk.Unlock()
+	if el, ok := fs.entries[key]; ok {
+		el.Value.(*entry).expires = fs.now().Add(fs.ttl)
+		fs.order.MoveToFront(el)
+		return path, nil
+	}
+
+	fs.removeExpired()
+	for fs.size+size > fs.maxSize && fs.order.Len() > 0 {
+		fs.remove(fs.order.Back())
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(fs.dir, key)); err != nil {
+		return "", err
+	}
+	fs.entries[key] = fs.order.PushFront(&entry{key: key, size: size, expires: fs.now().Add(fs.ttl)})
+	fs.size += size
+	return path, nil
+}
+
+// Delete removes a file
+func (fs *FS) Delete(ctx context.Context, path string) error {
+	key, err := pathKey(path)
+	if err != nil {
+		return err
+	}
+	fs.lk.Lock()
+	defer fs.lk.Unlock()
+	if el, ok := fs.entries[key]; ok {
+		fs.remove(el)
+	}
+	return nil
+}
+
+// lookup returns the entry for key, removing it if it's expired. callers must
+// hold the lock
+func (fs *FS) lookup(key string) *entry {
+	el, ok := fs.entries[key]
+	if !ok {
+		return nil
+	}
+	e := el.Value.(*entry)
+	if !fs.now().Before(e.expires) {
+		fs.remove(el)
+		return nil
+	}
+	fs.order.MoveToFront(el)
+	return e
+}
+
+// remove deletes an entry & its file. callers must hold the lock
+func (fs *FS) remove(el *list.Element) {
+	e := el.Value.(*entry)
+	if err := os.Remove(filepath.Join(fs.dir, e.key)); err != nil && !os.IsNotExist(err) {
+		log.Debugw("removing tmpfs entry", "key", e.key, "err", err)
+	}
+	fs.order.Remove(el)
+	delete(fs.entries, e.key)
+	fs.size -= e.size
+}
+
+// removeExpired drops all expired entries. callers must hold the lock
+func (fs *FS) removeExpired() {
+	now := fs.now()
+	for el := fs.order.Front(); el != nil; {
+		next := el.Next()
+		if !now.Before(el.Value.(*entry).expires) {
+			fs.remove(el)
+		}
+		el = next
+	}
+}
+
+// sweep removes expired entries periodically, deleting everything when ctx
+// ends
+func (fs *FS) sweep(ctx context.Context) {
+	interval := fs.ttl / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			fs.lk.Lock()
+			fs.removeExpired()
+			fs.lk.Unlock()
+		case <-ctx.Done():
+			fs.lk.Lock()
+			fs.doneErr = os.RemoveAll(fs.dir)
+			fs.order.Init()
+			fs.entries = map[string]*list.Element{}
+			fs.size = 0
+			fs.lk.Unlock()
+			close(fs.doneCh)
+			return
+		}
+	}
+}
+
+func pathKey(path string) (string, error) {
+	key := strings.TrimPrefix(path, "/"+FilestoreType+"/")
+	if key == path || key == "" || strings.Contains(key, "/") {
+		return "", fmt.Errorf("invalid tmpfs path: %q", path)
+	}
+	if _, err := cid.Decode(key); err != nil {
+		return "", fmt.Errorf("invalid tmpfs path %q: %w", path, err)
+	}
+	return key, nil
+}
+
+// file is a file stored in a tmpfs
+type file struct {
+	*os.File
+	path string
+	size int64
+}
+
+var (
+	_ qfs.File         = (*file)(nil)
+	_ qfs.SizeFile     = (*file)(nil)
+	_ qfs.SeekableFile = (*file)(nil)
+)
+
+// IsDirectory satisfies the qfs.File interface
+func (f *file) IsDirectory() bool { return false }
+
+// NextFile satisfies the qfs.File interface
+func (f *file) NextFile() (qfs.File, error) { return nil, qfs.ErrNotDirectory }
+
+// FileName returns a filename associated with this file
+func (f *file) FileName() string { return filepath.Base(f.path) }
+
+// FullPath returns the full path used when adding this file
+func (f *file) FullPath() string { return f.path }
+
+// MediaType returns a mime type based on file extension
+func (f *file) MediaType() string { return mime.TypeByExtension(filepath.Ext(f.path)) }
+
+// ModTime returns the time the file was written
+func (f *file) ModTime() time.Time {
+	fi, err := f.File.Stat()
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
+
+// Size returns the length of the file in bytes
+func (f *file) Size() int64 { return f.size }
@@ -0,0 +1,101 @@
+package tmpfs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/qri-io/qfs"
+	"github.com/qri-io/qfs/spec"
+)
+
+func TestTmpFS(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fs, err := NewFS(ctx, &FSConfig{MaxSize: 10, TTL: "1m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	fs.now = func() time.Time { return now }
+
+	a, err := fs.Put(ctx, qfs.NewMemfileBytes("a.txt", []byte("aaaa")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := fs.Put(ctx, qfs.NewMemfileBytes("other.txt", []byte("aaaa")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != again {
+		t.Errorf("expected identical content to share a path. got: %q, %q", a, again)
+	}
+	if qfs.PathKind(a) != FilestoreType {
+		t.Errorf("expected path kind %q. got: %q", FilestoreType, qfs.PathKind(a))
+	}
+
+	f, err := fs.Get(ctx, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "aaaa" {
+		t.Errorf("content mismatch. got: %q", string(data))
+	}
+
+	// exceeding the size bound evicts the least recently used entry
+	b, err := fs.Put(ctx, qfs.NewMemfileBytes("b.txt", []byte("bbbb")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Put(ctx, qfs.NewMemfileBytes("c.txt", []byte("cccc"))); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := fs.Has(ctx, a); has {
+		t.Errorf("expected oldest entry to be evicted")
+	}
+	if fs.Size() != 8 {
+		t.Errorf("expected size 8. got: %d", fs.Size())
+	}
+	if _, err := fs.Put(ctx, qfs.NewMemfileBytes("big.txt", []byte("0123456789a"))); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("expected ErrTooLarge. got: %v", err)
+	}
+
+	// entries expire after the ttl
+	now = now.Add(time.Minute)
+	if has, _ := fs.Has(ctx, b); has {
+		t.Errorf("expected entry to expire")
+	}
+	if _, err := fs.Get(ctx, b); !errors.Is(err, qfs.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for expired entry. got: %v", err)
+	}
+
+	// ending the context removes everything
+	cancel()
+	<-fs.Done()
+	if _, err := os.Stat(fs.dir); !os.IsNotExist(err) {
+		t.Errorf("expected tmpfs directory to be removed. got: %v", err)
+	}
+}
+
+func TestSpec(t *testing.T) {
+	spec.AssertFilesystem(t, spec.Config{
+		New: func(t *testing.T) qfs.Filesystem {
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+			fs, err := NewFS(ctx, &FSConfig{Dir: t.TempDir(), MaxSize: DefaultMaxSize, TTL: "1m"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return fs
+		},
+	})
+}
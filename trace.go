@@ -0,0 +1,249 @@
+package qfs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+)
+
+// Cache outcomes recorded on trace events
+const (
+	CacheHit  = "hit"
+	CacheMiss = "miss"
+)
+
+// TraceEvent is a single operation recorded by a Tracer
+type TraceEvent struct {
+	// Op names the operation, eg: "get", "put", "read", "node"
+	Op string `json:"op"`
+	// FS is the type of the filesystem that performed the operation
+	FS    string        `json:"fs,omitempty"`
+	Path  string        `json:"path,omitempty"`
+	Start time.Time     `json:"start"`
+	Took  time.Duration `json:"took"`
+	Bytes int64         `json:"bytes,omitempty"`
+	// Cache is CacheHit or CacheMiss for operations that consult a cache
+	Cache string `json:"cache,omitempty"`
+	Err   string `json:"err,omitempty"`
+}
+
+// TraceReport is the structured trace of everything done under a traced
+// context
+type TraceReport struct {
+	Start       time.Time     `json:"start"`
+	Took        time.Duration `json:"took"`
+	Bytes       int64         `json:"bytes"`
+	CacheHits   int           `json:"cacheHits"`
+	CacheMisses int           `json:"cacheMisses"`
+	Events      []TraceEvent  `json:"events"`
+}
+
+// Tracer records operations performed under a traced context
+type Tracer struct {
+	start time.Time
+
+	lk     sync.Mutex
+	events []TraceEvent
+}
+
+type tracerCtxKey struct{}
+
+// Trace activates tracing for all filesystem operations performed with the
+// returned context. Call Finish on the tracer for a report of what happened:
+//
+//	ctx, tr := qfs.Trace(ctx)
+//	f, err := fs.Get(ctx, path)
+//	...
+//	report := tr.Finish()
+func Trace(ctx context.Context) (context.Context, *Tracer) {
+	t := &Tracer{start: time.Now()}
+	return context.WithValue(ctx, tracerCtxKey{}, t), t
+}
+
+// TracerFromContext returns the tracer activated on ctx, or nil
+func TracerFromContext(ctx context.Context) *Tracer {
+	t, _ := ctx.Value(tracerCtxKey{}).(*Tracer)
+	return t
+}
+
+// Record adds an event to the trace
+func (t *Tracer) Record(e TraceEvent) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	t.events = append(t.events, e)
+}
+
+// Finish summarizes the trace. Events recorded after Finish are included in
+// later calls
+func (t *Tracer) Finish() TraceReport {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	r := TraceReport{
+		Start:  t.start,
+		Took:   time.Since(t.start),
+		Events: make([]TraceEvent, len(t.events)),
+	}
+	copy(r.Events, t.events)
+	for _, e := range t.events {
+		r.Bytes += e.Bytes
+		switch e.Cache {
+		case CacheHit:
+			r.CacheHits++
+		case CacheMiss:
+			r.CacheMisses++
+		}
+	}
+	return r
+}
+
+// TraceSpan times a single operation. Spans are reported to
+// opentracing.GlobalTracer, which discards them until a tracer is installed.
+// OpenTelemetry reports these spans through its opentracing bridge. Spans
+// started with a traced context are also recorded as events of its Tracer
+type TraceSpan struct {
+	t  *Tracer
+	e  TraceEvent
+	ot opentracing.Span
+}
+
+type traceSpanCtxKey struct{}
+
+// StartSpan starts a span for a filesystem operation, as a child of any span
+// carried by ctx. The returned context carries the new span, pass it to
+// nested calls so their spans nest under this one.
+//
+// A span for the same operation, filesystem & path as the span ctx carries
+// is folded into it & returned as nil, so a wrapper & the filesystem it wraps
+// can both span an operation. Unlike Trace, spans are always started, so
+// only operations that can stall on the network or disk should be spanned
+func StartSpan(ctx context.Context, op, fsType, path string) (*TraceSpan, context.Context) {
+	if p, ok := ctx.Value(traceSpanCtxKey{}).(*TraceSpan); ok && p.e.Op == op && p.e.FS == fsType && p.e.Path == path {
+		return nil, ctx
+	}
+	s := &TraceSpan{
+		t: TracerFromContext(ctx),
+		e: TraceEvent{Op: op, FS: fsType, Path: path, Start: time.Now()},
+	}
+	s.ot, ctx = opentracing.StartSpanFromContext(ctx, "qfs."+fsType+"."+op)
+	s.ot.SetTag("qfs.fs", fsType)
+	if path != "" {
+		s.ot.SetTag("qfs.path", path)
+	}
+	return s, context.WithValue(ctx, traceSpanCtxKey{}, s)
+}
+
+// SetCache records whether the operation was served from a cache
+func (s *TraceSpan) SetCache(outcome string) {
+	if s != nil {
+		s.e.Cache = outcome
+		s.ot.SetTag("qfs.cache", outcome)
+	}
+}
+
+// Finish ends the span, marking it as failed when err is non-nil. It's safe
+// to call on a nil span
+func (s *TraceSpan) Finish(bytes int64, err error) {
+	if s == nil {
+		return
+	}
+	s.e.Took = time.Since(s.e.Start)
+	s.e.Bytes = bytes
+	if bytes > 0 {
+		s.ot.SetTag("qfs.bytes", bytes)
+	}
+	if err != nil {
+		s.e.Err = err.Error()
+		ext.Error.Set(s.ot, true)
+		s.ot.LogFields(otlog.Error(err))
+	}
+	s.ot.Finish()
+	if s.t != nil {
+		s.t.Record(s.e)
+	}
+}
+
+// TraceFile wraps a file so reads are recorded as a "read" event when the
+// file is closed. Files are returned unwrapped when ctx isn't traced
+func TraceFile(ctx context.Context, fsType string, f File) File {
+	if TracerFromContext(ctx) == nil || f.IsDirectory() {
+		return f
+	}
+	span, _ := StartSpan(ctx, "read", fsType, f.FullPath())
+	return &tracedFile{File: f, span: span}
+}
+
+type tracedFile struct {
+	File
+	span  *TraceSpan
+	bytes int64
+	once  sync.Once
+}
+
+// Read counts bytes read from the underlying file
+func (f *tracedFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	f.bytes += int64(n)
+	return n, err
+}
+
+// Seek seeks the underlying file
+func (f *tracedFile) Seek(offset int64, whence int) (int64, error) {
+	return seekFile(f.File, offset, whence)
+}
+
+// Size returns the size of the underlying file
+func (f *tracedFile) Size() int64 { return FileSize(f.File) }
+
+// Close records the read
+func (f *tracedFile) Close() error {
+	err := f.File.Close()
+	f.once.Do(func() { f.span.Finish(f.bytes, err) })
+	return err
+}
+
+// tracingFS records operations on a filesystem
+type tracingFS struct {
+	Filesystem
+}
+
+// TraceFilesystem wraps fs, spanning its operations. Spans fs starts for the
+// same operations are folded into the wrapper's
+func TraceFilesystem(fs Filesystem) Filesystem {
+	return tracingFS{Filesystem: fs}
+}
+
+func (fs tracingFS) Has(ctx context.Context, path string) (bool, error) {
+	span, ctx := StartSpan(ctx, "has", fs.Type(), path)
+	has, err := fs.Filesystem.Has(ctx, path)
+	span.Finish(0, err)
+	return has, err
+}
+
+func (fs tracingFS) Get(ctx context.Context, path string) (File, error) {
+	span, ctx := StartSpan(ctx, "get", fs.Type(), path)
+	f, err := fs.Filesystem.Get(ctx, path)
+	span.Finish(0, err)
+	if err != nil {
+		return nil, err
+	}
+	return TraceFile(ctx, fs.Type(), f), nil
+}
+
+func (fs tracingFS) Put(ctx context.Context, file File) (string, error) {
+	span, ctx := StartSpan(ctx, "put", fs.Type(), file.FullPath())
+	path, err := fs.Filesystem.Put(ctx, file)
+	span.Finish(0, err)
+	return path, err
+}
+
+func (fs tracingFS) Delete(ctx context.Context, path string) error {
+	span, ctx := StartSpan(ctx, "delete", fs.Type(), path)
+	err := fs.Filesystem.Delete(ctx, path)
+	span.Finish(0, err)
+	return err
+}
@@ -0,0 +1,109 @@
+package qfs
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func TestTrace(t *testing.T) {
+	fs := TraceFilesystem(NewMemFS())
+
+	// untraced contexts record nothing
+	path, err := fs.Put(context.Background(), NewMemfileBytes("/a.txt", []byte("hello")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, tr := Trace(context.Background())
+	f, err := fs.Get(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if _, err := fs.Get(ctx, "/mem/missing"); err == nil {
+		t.Fatal("expected getting a missing path to error")
+	}
+
+	span, _ := StartSpan(ctx, "node", "mem", path)
+	span.SetCache(CacheHit)
+	span.Finish(0, nil)
+
+	r := tr.Finish()
+	ops := []string{}
+	for _, e := range r.Events {
+		ops = append(ops, e.Op)
+	}
+	expect := []string{"get", "read", "get", "node"}
+	if len(ops) != len(expect) {
+		t.Fatalf("expected events %v. got: %v", expect, ops)
+	}
+	for i := range expect {
+		if ops[i] != expect[i] {
+			t.Errorf("event %d: expected op %q. got: %q", i, expect[i], ops[i])
+		}
+	}
+	if r.Bytes != 5 {
+		t.Errorf("expected 5 bytes read. got: %d", r.Bytes)
+	}
+	if r.CacheHits != 1 {
+		t.Errorf("expected 1 cache hit. got: %d", r.CacheHits)
+	}
+	if r.Events[2].Err == "" {
+		t.Errorf("expected failed get to record its error")
+	}
+}
+
+func TestSpanReporting(t *testing.T) {
+	tracer := mocktracer.New()
+	prev := opentracing.GlobalTracer()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(prev)
+
+	ctx, tr := Trace(context.Background())
+	parent, ctx := StartSpan(ctx, "get", "mux", "/ipfs/QmFoo")
+	child, cctx := StartSpan(ctx, "get", "ipfs", "/ipfs/QmFoo")
+	// a span for the same operation is folded into the one ctx carries
+	if folded, fctx := StartSpan(cctx, "get", "ipfs", "/ipfs/QmFoo"); folded != nil || fctx != cctx {
+		t.Error("expected a span for the same operation to be folded")
+	}
+	child.SetCache(CacheMiss)
+	child.Finish(0, ErrNotFound)
+	parent.Finish(5, nil)
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 finished spans, got %d", len(spans))
+	}
+	c, p := spans[0], spans[1]
+	if p.OperationName != "qfs.mux.get" || c.OperationName != "qfs.ipfs.get" {
+		t.Errorf("unexpected operation names: %q, %q", p.OperationName, c.OperationName)
+	}
+	if c.ParentID != p.SpanContext.SpanID {
+		t.Error("expected span started from a spanned context to be a child")
+	}
+	if c.Tag("qfs.path") != "/ipfs/QmFoo" || c.Tag("qfs.fs") != "ipfs" || c.Tag("qfs.cache") != CacheMiss {
+		t.Errorf("unexpected tags: %v", c.Tags())
+	}
+	if c.Tag("error") != true || p.Tag("error") != nil {
+		t.Error("expected only the failed span to be tagged with an error")
+	}
+	if logs := c.Logs(); len(logs) != 1 {
+		t.Errorf("expected the error to be logged, got %v", logs)
+	}
+
+	// the same spans are recorded by the context's tracer
+	r := tr.Finish()
+	if len(r.Events) != 2 || r.Events[0].FS != "ipfs" || r.Events[1].FS != "mux" {
+		t.Fatalf("expected child & parent events. got: %#v", r.Events)
+	}
+	if r.Bytes != 5 || r.CacheMisses != 1 || r.Events[0].Err == "" {
+		t.Errorf("unexpected report: %#v", r)
+	}
+}
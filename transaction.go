@@ -0,0 +1,204 @@
+package qfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrTransactionDone is returned when using a transaction that has already
+// been committed or rolled back
+var ErrTransactionDone = errors.New("transaction is already done")
+
+// Transaction groups Puts across one or more filesystems so they're kept or
+// discarded together. Puts are written as they're made. Commit pins every
+// write to a filesystem that implements PinningFS, Rollback deletes every
+// write the transaction created. If pinning any write fails, Commit rolls
+// the whole transaction back
+//
+// A write to a path the filesystem already held is left in place by a
+// rollback. Filesystems that implement PinCheckingFS hold paths that are
+// pinned, others hold paths Has reports. Filesystems that implement
+// PathPredictor are checked at the path a Put will write to, which reads the
+// file into memory first. Others are checked at the path of the file they're
+// given, which only covers content-addressed files put under their own path
+type Transaction struct {
+	lk     sync.Mutex
+	done   bool
+	writes []txWrite
+}
+
+type txWrite struct {
+	fs   Filesystem
+	path string
+	// held is set when fs held path before the transaction wrote it
+	held bool
+}
+
+// NewTransaction starts a transaction
+func NewTransaction() *Transaction {
+	return &Transaction{}
+}
+
+// WithTransaction runs fn in a transaction, committing if fn succeeds &
+// rolling back if it returns an error
+func WithTransaction(ctx context.Context, fn func(tx *Transaction) error) error {
+	tx := NewTransaction()
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(ctx); rbErr != nil {
+			log.Errorf("rolling back transaction: %s", rbErr)
+		}
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Put writes a file to fs as part of the transaction. A failed Put leaves the
+// transaction open, callers decide whether to roll back
+func (tx *Transaction) Put(ctx context.Context, fs Filesystem, file File) (string, error) {
+	if tx.isDone() {
+		return "", ErrTransactionDone
+	}
+	want, held, file, err := heldBeforePut(ctx, fs, file)
+	if err != nil {
+		return "", err
+	}
+	path, err := fs.Put(ctx, file)
+	if err != nil {
+		return "", err
+	}
+	w := txWrite{fs: fs, path: path, held: held && path == want}
+
+	tx.lk.Lock()
+	if tx.done {
+		tx.lk.Unlock()
+		// the transaction ended while the write was in flight
+		if err := w.undo(ctx); err != nil {
+			log.Debugw("deleting write to finished transaction", "path", path, "err", err)
+		}
+		return "", ErrTransactionDone
+	}
+	tx.writes = append(tx.writes, w)
+	tx.lk.Unlock()
+	return path, nil
+}
+
+func (tx *Transaction) isDone() bool {
+	tx.lk.Lock()
+	defer tx.lk.Unlock()
+	return tx.done
+}
+
+// holds reports whether fs already holds path: pinned on filesystems that
+// can check pins, present on others. Errors count as not held
+func holds(ctx context.Context, fs Filesystem, path string) bool {
+	if path == "" {
+		return false
+	}
+	if pc, ok := fs.(PinCheckingFS); ok {
+		pinned, err := pc.IsPinned(ctx, path)
+		if err == nil {
+			return pinned
+		}
+		if !errors.Is(err, ErrUnsupported) {
+			log.Debugw("checking pin before transaction write", "path", path, "err", err)
+			return false
+		}
+	}
+	has, err := fs.Has(ctx, path)
+	if err != nil {
+		log.Debugw("checking path before transaction write", "path", path, "err", err)
+		return false
+	}
+	return has
+}
+
+// undo deletes a write the transaction created. Writes to held paths are
+// left in place
+func (w txWrite) undo(ctx context.Context) error {
+	if w.held {
+		return nil
+	}
+	if err := w.fs.Delete(ctx, w.path); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// Paths lists the paths written by the transaction, in the order they were
+// written
+func (tx *Transaction) Paths() []string {
+	tx.lk.Lock()
+	defer tx.lk.Unlock()
+	paths := make([]string, len(tx.writes))
+	for i, w := range tx.writes {
+		paths[i] = w.path
+	}
+	return paths
+}
+
+// Commit pins every write. Filesystems that don't pin keep writes as they
+// are. When a pin fails, pins made by the commit are removed & every write
+// the transaction created is deleted
+func (tx *Transaction) Commit(ctx context.Context) error {
+	tx.lk.Lock()
+	defer tx.lk.Unlock()
+	if tx.done {
+		return ErrTransactionDone
+	}
+	tx.done = true
+
+	for i, w := range tx.writes {
+		p, ok := w.fs.(PinningFS)
+		if !ok {
+			continue
+		}
+		err := p.Pin(ctx, w.path, true)
+		if err == nil || errors.Is(err, ErrUnsupported) {
+			continue
+		}
+
+		for _, pinned := range tx.writes[:i] {
+			if pinned.held {
+				continue
+			}
+			if p, ok := pinned.fs.(PinningFS); ok {
+				if err := p.Unpin(ctx, pinned.path, true); err != nil && !errors.Is(err, ErrNotPinned) && !errors.Is(err, ErrUnsupported) {
+					log.Debugw("unpinning during rollback", "path", pinned.path, "err", err)
+				}
+			}
+		}
+		if rbErr := tx.rollback(ctx); rbErr != nil {
+			log.Errorf("rolling back transaction: %s", rbErr)
+		}
+		return fmt.Errorf("pinning %s: %w", w.path, err)
+	}
+	return nil
+}
+
+// Rollback deletes every write the transaction created, most recent first.
+// Rollback attempts every delete, returning the first error encountered
+func (tx *Transaction) Rollback(ctx context.Context) error {
+	tx.lk.Lock()
+	defer tx.lk.Unlock()
+	if tx.done {
+		return ErrTransactionDone
+	}
+	tx.done = true
+	return tx.rollback(ctx)
+}
+
+func (tx *Transaction) rollback(ctx context.Context) error {
+	var firstErr error
+	for i := len(tx.writes) - 1; i >= 0; i-- {
+		w := tx.writes[i]
+		if err := w.undo(ctx); err != nil {
+			log.Debugw("deleting during rollback", "path", w.path, "err", err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("deleting %s: %w", w.path, err)
+			}
+		}
+	}
+	return firstErr
+}
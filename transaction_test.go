@@ -0,0 +1,172 @@
+package qfs
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// pinFS is a MemFS that records pins & can fail to pin a path
+type pinFS struct {
+	*MemFS
+	pinned  map[string]bool
+	failPin string
+}
+
+func (fs *pinFS) Pin(ctx context.Context, key string, recursive bool) error {
+	if key == fs.failPin {
+		return errors.New("pin failed")
+	}
+	fs.pinned[key] = true
+	return nil
+}
+
+func (fs *pinFS) Unpin(ctx context.Context, key string, recursive bool) error {
+	if !fs.pinned[key] {
+		return ErrNotPinned
+	}
+	delete(fs.pinned, key)
+	return nil
+}
+
+func TestTransactionCommit(t *testing.T) {
+	ctx := context.Background()
+	pinning := &pinFS{MemFS: NewMemFS(), pinned: map[string]bool{}}
+	plain := NewMemFS()
+
+	var a, b string
+	err := WithTransaction(ctx, func(tx *Transaction) (err error) {
+		if a, err = tx.Put(ctx, pinning, NewMemfileBytes("a.txt", []byte("a"))); err != nil {
+			return err
+		}
+		b, err = tx.Put(ctx, plain, NewMemfileBytes("b.txt", []byte("b")))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pinning.pinned[a] {
+		t.Errorf("expected commit to pin %q", a)
+	}
+	if has, _ := plain.Has(ctx, b); !has {
+		t.Errorf("expected commit to keep %q", b)
+	}
+}
+
+func TestTransactionRollback(t *testing.T) {
+	ctx := context.Background()
+	pinning := &pinFS{MemFS: NewMemFS(), pinned: map[string]bool{}}
+	plain := NewMemFS()
+
+	tx := NewTransaction()
+	a, err := tx.Put(ctx, pinning, NewMemfileBytes("a.txt", []byte("a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := tx.Put(ctx, plain, NewMemfileBytes("b.txt", []byte("b")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{a, b} {
+		if has, _ := plain.Has(ctx, p); has {
+			t.Errorf("expected rollback to delete %q", p)
+		}
+	}
+	if err := tx.Commit(ctx); !errors.Is(err, ErrTransactionDone) {
+		t.Errorf("expected commit after rollback to be ErrTransactionDone, got: %v", err)
+	}
+
+	// a failed pin rolls back pins already made & deletes every write
+	tx = NewTransaction()
+	a, _ = tx.Put(ctx, pinning, NewMemfileBytes("a.txt", []byte("a")))
+	c, _ := tx.Put(ctx, pinning, NewMemfileBytes("c.txt", []byte("c")))
+	pinning.failPin = c
+	if err := tx.Commit(ctx); err == nil {
+		t.Fatal("expected failed pin to fail the commit")
+	}
+	if len(pinning.pinned) != 0 {
+		t.Errorf("expected failed commit to unpin everything, pinned: %v", pinning.pinned)
+	}
+	if has, _ := pinning.Has(ctx, a); has {
+		t.Errorf("expected failed commit to delete %q", a)
+	}
+	if got := tx.Paths(); len(got) != 2 || got[0] != a || got[1] != c {
+		t.Errorf("unexpected transaction paths: %v", got)
+	}
+}
+
+// pinCheckFS is a pinFS that reports its pins
+type pinCheckFS struct {
+	*pinFS
+}
+
+func (fs *pinCheckFS) IsPinned(ctx context.Context, key string) (bool, error) {
+	return fs.pinned[key], nil
+}
+
+func TestTransactionKeepsHeldPaths(t *testing.T) {
+	ctx := context.Background()
+	pinning := &pinCheckFS{&pinFS{MemFS: NewMemFS(), pinned: map[string]bool{}}}
+
+	held, err := pinning.Put(ctx, NewMemfileBytes("held.txt", []byte("held")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinning.pinned[held] = true
+
+	tx := NewTransaction()
+	if _, err := tx.Put(ctx, pinning, NewMemfileBytes(held, []byte("held"))); err != nil {
+		t.Fatal(err)
+	}
+	created, err := tx.Put(ctx, pinning, NewMemfileBytes("new.txt", []byte("new")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := pinning.Has(ctx, held); !has || !pinning.pinned[held] {
+		t.Errorf("expected rollback to keep already pinned %q", held)
+	}
+	if has, _ := pinning.Has(ctx, created); has {
+		t.Errorf("expected rollback to delete %q", created)
+	}
+
+	// held content put again under a name that isn't its path is still held
+	tx = NewTransaction()
+	again, err := tx.Put(ctx, pinning, NewMemfileBytes("again.txt", []byte("held")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != held {
+		t.Fatalf("expected same content to put to %q. got: %q", held, again)
+	}
+	if err := tx.Rollback(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := pinning.Has(ctx, held); !has || !pinning.pinned[held] {
+		t.Errorf("expected rollback of a renamed put to keep already pinned %q", held)
+	}
+
+	// a failed commit doesn't unpin paths that were pinned before it
+	tx = NewTransaction()
+	tx.Put(ctx, pinning, NewMemfileBytes(held, []byte("held")))
+	failed, _ := tx.Put(ctx, pinning, NewMemfileBytes("fail.txt", []byte("fail")))
+	pinning.failPin = failed
+	if err := tx.Commit(ctx); err == nil {
+		t.Fatal("expected failed pin to fail the commit")
+	}
+	if !pinning.pinned[held] {
+		t.Errorf("expected failed commit to keep the pin on %q", held)
+	}
+
+	// puts are refused once the transaction is done
+	tx = NewTransaction()
+	tx.Rollback(ctx)
+	if _, err := tx.Put(ctx, pinning, NewMemfileBytes("late.txt", []byte("late"))); !errors.Is(err, ErrTransactionDone) {
+		t.Errorf("expected put after rollback to be ErrTransactionDone, got: %v", err)
+	}
+}
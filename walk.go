@@ -0,0 +1,100 @@
+package qfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"sync"
+)
+
+// SkipDir is returned by a WalkParallel visit function to skip a directory's
+// contents. It's the same value as filepath.SkipDir
+var SkipDir = fs.SkipDir
+
+// WalkParallel traverses a file tree top-down, calling visit on each file &
+// directory with its depth beneath root, which has depth 0. Directories are
+// visited before their children & listed concurrently by up to workers
+// goroutines, so visit must be safe to call concurrently. Siblings are
+// visited in order, but there's no ordering between directories.
+//
+// Returning SkipDir from a visit to a directory skips its contents, returning
+// SkipDir from a visit to a file skips the rest of the file's directory.
+// Any other error stops the walk & is returned once in-flight visits finish
+func WalkParallel(root File, workers int, visit func(f File, depth int) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+	if err := visit(root, 0); err != nil {
+		if errors.Is(err, SkipDir) {
+			return nil
+		}
+		return err
+	}
+	if !root.IsDirectory() {
+		return nil
+	}
+
+	w := &parallelWalk{visit: visit, sem: make(chan struct{}, workers)}
+	w.wg.Add(1)
+	go w.walkDir(root, 0)
+	w.wg.Wait()
+	return w.err
+}
+
+type parallelWalk struct {
+	visit func(f File, depth int) error
+	// sem bounds the number of directories being listed at once
+	sem chan struct{}
+	wg  sync.WaitGroup
+
+	lk  sync.Mutex
+	err error
+}
+
+// walkDir visits the children of dir, walking child directories in new
+// goroutines
+func (w *parallelWalk) walkDir(dir File, depth int) {
+	defer w.wg.Done()
+	w.sem <- struct{}{}
+	defer func() { <-w.sem }()
+
+	for !w.failed() {
+		f, err := dir.NextFile()
+		if errors.Is(err, io.EOF) {
+			return
+		} else if err != nil {
+			w.fail(err)
+			return
+		}
+
+		if err := w.visit(f, depth+1); err != nil {
+			if !errors.Is(err, SkipDir) {
+				w.fail(err)
+				return
+			}
+			if f.IsDirectory() {
+				continue
+			}
+			return
+		}
+		if f.IsDirectory() {
+			w.wg.Add(1)
+			go w.walkDir(f, depth+1)
+		}
+	}
+}
+
+// fail records the first error of the walk
+func (w *parallelWalk) fail(err error) {
+	w.lk.Lock()
+	defer w.lk.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+func (w *parallelWalk) failed() bool {
+	w.lk.Lock()
+	defer w.lk.Unlock()
+	return w.err != nil
+}
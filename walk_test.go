@@ -0,0 +1,112 @@
+package qfs
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func walkTestTree() *Memdir {
+	return NewMemdir("/a",
+		NewMemfileBytes("a.txt", []byte("foo")),
+		NewMemdir("/b",
+			NewMemfileBytes("c.txt", []byte("bar")),
+			NewMemdir("/d",
+				NewMemfileBytes("e.txt", []byte("baz")),
+			),
+		),
+		NewMemdir("/f",
+			NewMemfileBytes("g.txt", []byte("bat")),
+			NewMemfileBytes("h.txt", []byte("bop")),
+		),
+	)
+}
+
+func TestWalkParallel(t *testing.T) {
+	var (
+		lk      sync.Mutex
+		visited = map[string]int{}
+		active  int32
+		maxSeen int32
+	)
+	err := WalkParallel(walkTestTree(), 2, func(f File, depth int) error {
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		lk.Lock()
+		visited[f.FullPath()] = depth
+		if n > maxSeen {
+			maxSeen = n
+		}
+		lk.Unlock()
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := map[string]int{
+		"/a":           0,
+		"/a/a.txt":     1,
+		"/a/b":         1,
+		"/a/b/c.txt":   2,
+		"/a/b/d":       2,
+		"/a/b/d/e.txt": 3,
+		"/a/f":         1,
+		"/a/f/g.txt":   2,
+		"/a/f/h.txt":   2,
+	}
+	if diff := cmp.Diff(expect, visited); diff != "" {
+		t.Errorf("visited paths mismatch. (-want +got):\n%s", diff)
+	}
+	if maxSeen > 2 {
+		t.Errorf("expected at most 2 concurrent visits, saw %d", maxSeen)
+	}
+}
+
+func TestWalkParallelSkipDir(t *testing.T) {
+	var (
+		lk    sync.Mutex
+		paths []string
+	)
+	err := WalkParallel(walkTestTree(), 4, func(f File, depth int) error {
+		lk.Lock()
+		paths = append(paths, f.FullPath())
+		lk.Unlock()
+		switch f.FullPath() {
+		case "/a/b", "/a/f/g.txt":
+			return SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(paths)
+	expect := []string{"/a", "/a/a.txt", "/a/b", "/a/f", "/a/f/g.txt"}
+	if diff := cmp.Diff(expect, paths); diff != "" {
+		t.Errorf("visited paths mismatch. (-want +got):\n%s", diff)
+	}
+
+	if err := WalkParallel(walkTestTree(), 4, func(f File, depth int) error { return SkipDir }); err != nil {
+		t.Errorf("expected skipping the root to end the walk without error, got: %v", err)
+	}
+}
+
+func TestWalkParallelError(t *testing.T) {
+	errBoom := errors.New("boom")
+	err := WalkParallel(walkTestTree(), 4, func(f File, depth int) error {
+		if f.FullPath() == "/a/b/d/e.txt" {
+			return errBoom
+		}
+		return nil
+	})
+	if !errors.Is(err, errBoom) {
+		t.Errorf("expected the visit error, got: %v", err)
+	}
+}
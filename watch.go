@@ -0,0 +1,93 @@
+package qfs
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Watcher is an optional interface for filesystems that report changes as
+// they happen
+type Watcher interface {
+	// Watch sends an event for each change at or beneath path. The channel is
+	// closed when ctx ends
+	Watch(ctx context.Context, path string) (<-chan Event, error)
+}
+
+// watchBufferSize is the number of events a watcher can fall behind before
+// events are dropped
+const watchBufferSize = 64
+
+// WatchHub fans events out to watchers. Filesystems without native change
+// notification implement Watcher by publishing their own changes to a hub.
+// A hub is also an EventSink, so it can watch an EventBus. Publishing never
+// blocks: events for a watcher that has fallen watchBufferSize events behind
+// are dropped. The zero value is ready to use
+type WatchHub struct {
+	lk   sync.Mutex
+	subs map[*watchSub]struct{}
+}
+
+type watchSub struct {
+	path string
+	ch   chan Event
+}
+
+var (
+	_ Watcher   = (*WatchHub)(nil)
+	_ EventSink = (*WatchHub)(nil)
+)
+
+// Watch subscribes to events at or beneath path. An empty path or "/"
+// watches everything
+func (h *WatchHub) Watch(ctx context.Context, path string) (<-chan Event, error) {
+	sub := &watchSub{path: strings.TrimSuffix(path, "/"), ch: make(chan Event, watchBufferSize)}
+	h.lk.Lock()
+	if h.subs == nil {
+		h.subs = map[*watchSub]struct{}{}
+	}
+	h.subs[sub] = struct{}{}
+	h.lk.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		h.lk.Lock()
+		delete(h.subs, sub)
+		close(sub.ch)
+		h.lk.Unlock()
+	}()
+	return sub.ch, nil
+}
+
+// Publish sends an event to every watcher of its path, setting the event
+// time if unset
+func (h *WatchHub) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	h.lk.Lock()
+	defer h.lk.Unlock()
+	for sub := range h.subs {
+		if !WatchesPath(sub.path, e.Path) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			log.Debugw("dropping event for slow watcher", "type", e.Type, "path", e.Path)
+		}
+	}
+}
+
+// HandleEvent implements the EventSink interface
+func (h *WatchHub) HandleEvent(ctx context.Context, e Event) error {
+	h.Publish(e)
+	return nil
+}
+
+// WatchesPath reports whether a watch on root covers path
+func WatchesPath(root, path string) bool {
+	root = strings.TrimSuffix(root, "/")
+	return root == "" || path == root || strings.HasPrefix(path, root+"/")
+}
@@ -0,0 +1,57 @@
+package qfs
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWatchHub(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	hub := &WatchHub{}
+	all, err := hub.Watch(ctx, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := hub.Watch(ctx, "/mem/a/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hub.Publish(Event{Type: EventPut, Path: "/mem/ab"})
+	hub.Publish(Event{Type: EventPut, Path: "/mem/a/b"})
+
+	for _, p := range []string{"/mem/ab", "/mem/a/b"} {
+		if e := <-all; e.Path != p {
+			t.Errorf("expected event for %q, got %q", p, e.Path)
+		} else if e.Time.IsZero() {
+			t.Error("expected publishing to set the event time")
+		}
+	}
+	if e := <-sub; e.Path != "/mem/a/b" {
+		t.Errorf("expected only events beneath /mem/a, got %q", e.Path)
+	}
+
+	cancel()
+	if _, ok := <-sub; ok {
+		t.Error("expected the channel to close when the context ends")
+	}
+	hub.Publish(Event{Type: EventDelete, Path: "/mem/a/b"})
+}
+
+func TestWatchesPath(t *testing.T) {
+	cases := []struct {
+		root, path string
+		expect     bool
+	}{
+		{"", "/mem/a", true},
+		{"/mem/a", "/mem/a", true},
+		{"/mem/a/", "/mem/a/b", true},
+		{"/mem/a", "/mem/ab", false},
+		{"/mem/a/b", "/mem/a", false},
+	}
+	for _, c := range cases {
+		if got := WatchesPath(c.root, c.path); got != c.expect {
+			t.Errorf("WatchesPath(%q, %q): expected %t, got %t", c.root, c.path, c.expect, got)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package qfs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// WebhookSignatureHeader carries the hex-encoded HMAC-SHA256 of a webhook
+// request body, prefixed with "sha256="
+const WebhookSignatureHeader = "X-Qfs-Signature"
+
+// WebhookNotifier is an EventSink that POSTs each event as JSON to a URL.
+// Requests that fail with a network error or 5xx status are retried with
+// exponential backoff
+type WebhookNotifier struct {
+	URL string
+	// Secret signs request bodies when set, see WebhookSignatureHeader
+	Secret []byte
+	// Retries is the number of times to retry a failed delivery
+	Retries int
+	// Backoff is the delay before the first retry, doubling each attempt
+	Backoff time.Duration
+	Client  *http.Client
+}
+
+var _ EventSink = (*WebhookNotifier)(nil)
+
+// NewWebhookNotifier creates a notifier with default retry settings
+func NewWebhookNotifier(url string, secret []byte) *WebhookNotifier {
+	return &WebhookNotifier{
+		URL:     url,
+		Secret:  secret,
+		Retries: 3,
+		Backoff: 500 * time.Millisecond,
+		Client:  http.DefaultClient,
+	}
+}
+
+// HandleEvent implements the EventSink interface
+func (n *WebhookNotifier) HandleEvent(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	backoff := n.Backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := n.post(ctx, body)
+		if err == nil || !retry || attempt >= n.Retries {
+			return err
+		}
+		log.Debugw("retrying webhook", "url", n.URL, "attempt", attempt+1, "err", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (n *WebhookNotifier) post(ctx context.Context, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(n.Secret) > 0 {
+		req.Header.Set(WebhookSignatureHeader, SignWebhook(n.Secret, body))
+	}
+
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode >= 300 {
+		return res.StatusCode >= 500, fmt.Errorf("webhook %s responded with status %d", n.URL, res.StatusCode)
+	}
+	return false, nil
+}
+
+// SignWebhook returns the signature header value for a webhook body
+func SignWebhook(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook checks a signature header value matches body, for use by
+// webhook receivers
+func VerifyWebhook(secret, body []byte, signature string) bool {
+	return hmac.Equal([]byte(SignWebhook(secret, body)), []byte(signature))
+}
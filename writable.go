@@ -0,0 +1,95 @@
+package qfs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// WritableFS is an optional interface for filesystems that can copy & move
+// entries in place, without callers reading & re-putting content
+type WritableFS interface {
+	// Copy places the file or directory at src at dst as well
+	Copy(ctx context.Context, src, dst string) error
+	// Rename moves the file or directory at src to dst
+	Rename(ctx context.Context, src, dst string) error
+}
+
+var _ WritableFS = (*MemFS)(nil)
+
+// Copy stores the entry at src under the key dst, sharing its content. src
+// may name a file within a directory, dst must be a single key like
+// "/mem/a.txt". Entries stored under keys that aren't their hash fail
+// VerifyContent checks
+func (m *MemFS) Copy(ctx context.Context, src, dst string) error {
+	dstKey, err := memKey(dst)
+	if err != nil {
+		return err
+	}
+
+	m.filesLk.Lock()
+	defer m.filesLk.Unlock()
+	_, f, err := m.entry(src)
+	if err != nil {
+		return err
+	}
+	m.Files[dstKey] = f
+	return nil
+}
+
+// Rename moves the entry stored under the key src to the key dst. Like
+// Delete, Rename works on whole keys, not paths within directories
+func (m *MemFS) Rename(ctx context.Context, src, dst string) error {
+	srcKey, err := memKey(src)
+	if err != nil {
+		return err
+	}
+	dstKey, err := memKey(dst)
+	if err != nil {
+		return err
+	}
+
+	m.filesLk.Lock()
+	defer m.filesLk.Unlock()
+	f, ok := m.Files[srcKey]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(m.Files, srcKey)
+	m.Files[dstKey] = f
+	return nil
+}
+
+// entry looks up the entry at key, which may name a file within a
+// directory. Callers must hold filesLk
+func (m *MemFS) entry(key string) (hash string, f filer, err error) {
+	key = strings.TrimPrefix(key, fmt.Sprintf("/%s/", MemFilestoreType))
+	parts := strings.Split(key, "/")
+
+	hash = parts[0]
+	f = m.Files[hash]
+	for _, part := range parts[1:] {
+		dir, ok := f.(fsDir)
+		if !ok {
+			if f != nil {
+				return "", nil, ErrNotDirectory
+			}
+			break
+		}
+		hash = dir.files[part]
+		f = m.Files[hash]
+	}
+	if f == nil {
+		return "", nil, ErrNotFound
+	}
+	return hash, f, nil
+}
+
+// memKey trims the filesystem prefix from path, requiring a single key
+func memKey(path string) (string, error) {
+	key := strings.TrimPrefix(path, fmt.Sprintf("/%s/", MemFilestoreType))
+	if key == "" || strings.Contains(key, "/") {
+		return "", fmt.Errorf("%w: %q isn't a single key", ErrUnsupported, path)
+	}
+	return key, nil
+}
@@ -0,0 +1,48 @@
+package qfs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+func TestMemFSCopyRename(t *testing.T) {
+	ctx := context.Background()
+	fs := NewMemFS()
+	root, err := fs.Put(ctx, NewMemdir("/dir", NewMemfileBytes("a.txt", []byte("a"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fs.Copy(ctx, root+"/a.txt", "/mem/copy.txt"); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.Get(ctx, "/mem/copy.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadAll(f); string(data) != "a" {
+		t.Errorf("expected copied data %q. got: %q", "a", data)
+	}
+
+	if err := fs.Rename(ctx, "/mem/copy.txt", "/mem/moved.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := fs.Has(ctx, "/mem/copy.txt"); has {
+		t.Error("expected renamed key to be removed")
+	}
+	if has, _ := fs.Has(ctx, "/mem/moved.txt"); !has {
+		t.Error("expected entry under new key")
+	}
+
+	if err := fs.Copy(ctx, "/mem/missing", "/mem/b"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound copying a missing entry. got: %v", err)
+	}
+	if err := fs.Copy(ctx, "/mem/moved.txt", "/mem/dir/b"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported copying into a directory. got: %v", err)
+	}
+	if err := fs.Rename(ctx, root+"/a.txt", "/mem/b"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported renaming a path within a directory. got: %v", err)
+	}
+}
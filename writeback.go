@@ -0,0 +1,303 @@
+package qfs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WriteBackFS makes writes durable in a fast local staging filesystem and
+// replicates them to a remote filesystem in the background. A WriteBackFS
+// has the same type as its remote, so it can stand in for the remote in a
+// Mux.
+//
+// WriteBackFS guarantees read-your-writes: the path Put returns can be read
+// with Get & Has immediately, first from the staging area and, once
+// replication completes, from the remote copy.
+//
+// The replication queue is kept in memory. Staged content survives a restart
+// if the staging filesystem is durable, but writes that hadn't replicated are
+// no longer queued & have to be put again. Paths of replicated writes resolve
+// to their remote paths for the last maxWriteBackResolved writes
+type WriteBackFS struct {
+	remote  Filesystem
+	staging Filesystem
+	wake    chan struct{}
+
+	// replk serializes replication passes
+	replk sync.Mutex
+
+	lk sync.Mutex
+	// seq orders pending writes, so they replicate in the order they were made
+	seq int
+	// pending maps write-back paths to staged writes
+	pending map[string]stagedWrite
+	// replicated maps write-back paths to replicated writes
+	replicated map[string]stagedWrite
+}
+
+// stagedWrite is a write's sequence number & its path in the staging area,
+// or on the remote once replicated
+type stagedWrite struct {
+	seq  int
+	path string
+}
+
+const (
+	// writeBackRetryDelay is the pause before a failed replication pass is
+	// retried
+	writeBackRetryDelay = time.Second
+	// maxWriteBackResolved bounds the replicated writes a WriteBackFS keeps
+	// resolving to remote paths. Older write-back paths stop resolving
+	maxWriteBackResolved = 4096
+)
+
+var (
+	_ Filesystem   = (*WriteBackFS)(nil)
+	_ DescribingFS = (*WriteBackFS)(nil)
+)
+
+// stagedPathSegment marks paths that refer to a write-back filesystem's
+// staging area
+const stagedPathSegment = "staged"
+
+// NewWriteBackFS creates a write-back filesystem that replicates writes from
+// staging to remote until ctx ends
+func NewWriteBackFS(ctx context.Context, remote, staging Filesystem) *WriteBackFS {
+	fs := &WriteBackFS{
+		remote:     remote,
+		staging:    staging,
+		wake:       make(chan struct{}, 1),
+		pending:    map[string]stagedWrite{},
+		replicated: map[string]stagedWrite{},
+	}
+	go fs.run(ctx)
+	return fs
+}
+
+// Type returns the type of the remote filesystem
+func (fs *WriteBackFS) Type() string { return fs.remote.Type() }
+
+// Describe returns the remote's descriptor. Write-back filesystems accept
+// writes even when the remote is offline
+func (fs *WriteBackFS) Describe() Descriptor {
+	d := Describe(fs.remote)
+	d.Features |= FeatureWritable
+	return d
+}
+
+// Put writes a file to the staging area & queues it for replication. The
+// returned path stays valid after replication, use Resolve to get the
+// remote path once it's known
+func (fs *WriteBackFS) Put(ctx context.Context, file File) (string, error) {
+	stagedPath, err := fs.staging.Put(ctx, file)
+	if err != nil {
+		return "", err
+	}
+	path := fmt.Sprintf("/%s/%s/%s", fs.Type(), stagedPathSegment, strings.TrimPrefix(stagedPath, "/"))
+
+	fs.lk.Lock()
+	fs.seq++
+	fs.pending[path] = stagedWrite{seq: fs.seq, path: stagedPath}
+	fs.lk.Unlock()
+
+	select {
+	case fs.wake <- struct{}{}:
+	default:
+	}
+	return path, nil
+}
+
+// Get reads a file, consulting the staging area for writes that haven't
+// replicated yet
+func (fs *WriteBackFS) Get(ctx context.Context, path string) (File, error) {
+	local, path := fs.resolve(path)
+	if local {
+		return fs.staging.Get(ctx, path)
+	}
+	return fs.remote.Get(ctx, path)
+}
+
+// Has reports whether a path exists in either the staging area or the remote
+func (fs *WriteBackFS) Has(ctx context.Context, path string) (bool, error) {
+	local, path := fs.resolve(path)
+	if local {
+		return fs.staging.Has(ctx, path)
+	}
+	return fs.remote.Has(ctx, path)
+}
+
+// Delete removes a path. Deleting a write that hasn't replicated drops it
+// from the queue
+func (fs *WriteBackFS) Delete(ctx context.Context, path string) error {
+	fs.lk.Lock()
+	if w, ok := fs.pending[path]; ok {
+		delete(fs.pending, path)
+		shared := fs.stagedPathShared(w.path)
+		fs.lk.Unlock()
+		if shared {
+			return nil
+		}
+		return fs.staging.Delete(ctx, w.path)
+	}
+	remotePath := path
+	if w, ok := fs.replicated[path]; ok {
+		delete(fs.replicated, path)
+		remotePath = w.path
+	}
+	fs.lk.Unlock()
+	return fs.remote.Delete(ctx, remotePath)
+}
+
+// Resolve returns the remote path for a path returned by Put. ok is false
+// while the write is still pending
+func (fs *WriteBackFS) Resolve(path string) (remotePath string, ok bool) {
+	fs.lk.Lock()
+	defer fs.lk.Unlock()
+	if _, pending := fs.pending[path]; pending {
+		return "", false
+	}
+	if w, ok := fs.replicated[path]; ok {
+		return w.path, true
+	}
+	return path, true
+}
+
+// Pending returns the number of writes waiting to replicate
+func (fs *WriteBackFS) Pending() int {
+	fs.lk.Lock()
+	defer fs.lk.Unlock()
+	return len(fs.pending)
+}
+
+// Flush replicates all pending writes, returning the first replication error
+func (fs *WriteBackFS) Flush(ctx context.Context) error {
+	return fs.replicate(ctx)
+}
+
+// resolve maps a path to the filesystem & path that holds its content
+func (fs *WriteBackFS) resolve(path string) (local bool, resolved string) {
+	fs.lk.Lock()
+	defer fs.lk.Unlock()
+	if w, ok := fs.pending[path]; ok {
+		return true, w.path
+	}
+	if w, ok := fs.replicated[path]; ok {
+		return false, w.path
+	}
+	return false, path
+}
+
+// run replicates when woken by a write, retrying failed passes after
+// writeBackRetryDelay
+func (fs *WriteBackFS) run(ctx context.Context) {
+	var retry <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-fs.wake:
+		case <-retry:
+		}
+		retry = nil
+		if err := fs.replicate(ctx); err != nil {
+			log.Debugw("write-back replication", "err", err)
+			retry = time.After(writeBackRetryDelay)
+		}
+	}
+}
+
+// replicate copies pending writes to the remote in the order they were made.
+// failed writes stay pending for the next pass
+func (fs *WriteBackFS) replicate(ctx context.Context) error {
+	fs.replk.Lock()
+	defer fs.replk.Unlock()
+
+	fs.lk.Lock()
+	paths := make([]string, 0, len(fs.pending))
+	for path := range fs.pending {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool { return fs.pending[paths[i]].seq < fs.pending[paths[j]].seq })
+	fs.lk.Unlock()
+
+	var firstErr error
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fs.replicateOne(ctx, path); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("replicating %q: %w", path, err)
+		}
+	}
+	return firstErr
+}
+
+func (fs *WriteBackFS) replicateOne(ctx context.Context, path string) error {
+	fs.lk.Lock()
+	w, ok := fs.pending[path]
+	fs.lk.Unlock()
+	if !ok {
+		return nil
+	}
+
+	f, err := fs.staging.Get(ctx, w.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	remotePath, err := fs.remote.Put(ctx, f)
+	if err != nil {
+		return err
+	}
+
+	fs.lk.Lock()
+	_, stillPending := fs.pending[path]
+	if stillPending {
+		delete(fs.pending, path)
+		fs.replicated[path] = stagedWrite{seq: w.seq, path: remotePath}
+		fs.pruneReplicated()
+	}
+	shared := fs.stagedPathShared(w.path)
+	fs.lk.Unlock()
+
+	if !stillPending {
+		// deleted while replicating, remove the remote copy
+		return fs.remote.Delete(ctx, remotePath)
+	}
+	if shared {
+		return nil
+	}
+	return fs.staging.Delete(ctx, w.path)
+}
+
+// stagedPathShared reports whether a pending write still needs the staged
+// file at stagedPath. Content-addressed staging areas give identical writes
+// the same path. Callers must hold lk
+func (fs *WriteBackFS) stagedPathShared(stagedPath string) bool {
+	for _, other := range fs.pending {
+		if other.path == stagedPath {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneReplicated drops the oldest replicated writes once more than a
+// quarter over maxWriteBackResolved are kept. Callers must hold lk
+func (fs *WriteBackFS) pruneReplicated() {
+	if len(fs.replicated) <= maxWriteBackResolved+maxWriteBackResolved/4 {
+		return
+	}
+	paths := make([]string, 0, len(fs.replicated))
+	for path := range fs.replicated {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool { return fs.replicated[paths[i]].seq < fs.replicated[paths[j]].seq })
+	for _, path := range paths[:len(paths)-maxWriteBackResolved] {
+		delete(fs.replicated, path)
+	}
+}
@@ -0,0 +1,149 @@
+package qfs
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWriteBackReadYourWrites(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	remote := InjectFaults(NewMemFS(), FailNth(FaultOpPut, 1, ErrNotFound))
+	fs := NewWriteBackFS(ctx, remote, NewMemFS())
+
+	path, err := fs.Put(ctx, NewMemfileBytes("/a.txt", []byte("hello")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first replication attempt fails, the write must stay readable
+	expectContent(t, fs, path, "hello")
+	if err := fs.Flush(ctx); err != nil {
+		// the background pass didn't get to the failing attempt first
+		if err := fs.Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+		expectContent(t, fs, path, "hello")
+	}
+	remotePath, ok := fs.Resolve(path)
+	if !ok {
+		t.Fatal("expected write to resolve after flush")
+	}
+	if has, _ := remote.Has(ctx, remotePath); !has {
+		t.Errorf("expected remote to have replicated path %q", remotePath)
+	}
+	expectContent(t, fs, path, "hello")
+
+	if err := fs.Delete(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := remote.Has(ctx, remotePath); has {
+		t.Errorf("expected delete to remove the remote copy")
+	}
+}
+
+func expectContent(t *testing.T, fs Filesystem, path, expect string) {
+	t.Helper()
+	ctx := context.Background()
+	if has, err := fs.Has(ctx, path); err != nil || !has {
+		t.Fatalf("expected Has(%q) to be true. got: %t, %v", path, has, err)
+	}
+	f, err := fs.Get(ctx, path)
+	if err != nil {
+		t.Fatalf("getting %q: %s", path, err)
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != expect {
+		t.Errorf("content mismatch. want: %q got: %q", expect, string(data))
+	}
+}
+
+func TestWriteBackRetry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	remote := InjectFaults(NewMemFS(), FailNth(FaultOpPut, 1, ErrNotFound))
+	staging := &closeCountingFS{Filesystem: NewMemFS()}
+	fs := NewWriteBackFS(ctx, remote, staging)
+	if _, err := fs.Put(ctx, NewMemfileBytes("/a.txt", []byte("hello"))); err != nil {
+		t.Fatal(err)
+	}
+
+	// the failed first pass is retried without another write or flush
+	deadline := time.Now().Add(5 * writeBackRetryDelay)
+	for fs.Pending() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected a failed replication to be retried")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for opened, closed := staging.counts(); opened != closed; opened, closed = staging.counts() {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected every staged file read to be closed. opened %d, closed %d", opened, closed)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWriteBackPrunesResolved(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fs := NewWriteBackFS(ctx, NewMemFS(), NewMemFS())
+	var last string
+	for i := 0; i <= maxWriteBackResolved+maxWriteBackResolved/4; i++ {
+		path, err := fs.Put(ctx, NewMemfileBytes("/a.txt", []byte(fmt.Sprintf("write %d", i))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		last = path
+	}
+	if err := fs.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	fs.lk.Lock()
+	kept := len(fs.replicated)
+	fs.lk.Unlock()
+	if kept > maxWriteBackResolved+maxWriteBackResolved/4 {
+		t.Errorf("expected replicated writes to be pruned. kept %d", kept)
+	}
+	expectContent(t, fs, last, fmt.Sprintf("write %d", maxWriteBackResolved+maxWriteBackResolved/4))
+}
+
+// closeCountingFS counts the files Get opens & the ones closed
+type closeCountingFS struct {
+	Filesystem
+	opened, closed int32
+}
+
+func (fs *closeCountingFS) Get(ctx context.Context, path string) (File, error) {
+	f, err := fs.Filesystem.Get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt32(&fs.opened, 1)
+	return &closeCountingFile{File: f, closed: &fs.closed}, nil
+}
+
+func (fs *closeCountingFS) counts() (opened, closed int32) {
+	return atomic.LoadInt32(&fs.opened), atomic.LoadInt32(&fs.closed)
+}
+
+type closeCountingFile struct {
+	File
+	closed *int32
+}
+
+func (f *closeCountingFile) Close() error {
+	atomic.AddInt32(f.closed, 1)
+	return f.File.Close()
+}
@@ -0,0 +1,364 @@
+// Package zipfs reads a zip archive as a read-only filesystem, so archives
+// like exported datasets can be read through qfs without extracting them.
+// Paths are archive entry names prefixed with /zip/, the archive root is
+// /zip/. Directories are listed whether or not the archive has an explicit
+// entry for them
+package zipfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	logging "github.com/ipfs/go-log"
+	"github.com/mitchellh/mapstructure"
+	"github.com/qri-io/qfs"
+)
+
+// FilestoreType uniquely identifies this filestore
+const FilestoreType = "zip"
+
+var log = logging.Logger("zipfs")
+
+// FSConfig adjusts the behaviour of an FS instance
+type FSConfig struct {
+	// Path is the local path of the archive to read
+	Path string
+}
+
+// FS is a read-only filesystem of the contents of a zip archive
+type FS struct {
+	root   *node
+	closer io.Closer
+
+	doneCh  chan struct{}
+	doneErr error
+}
+
+// node is an entry in the archive's directory tree
+type node struct {
+	name string
+	// file is nil for directories
+	file     *zip.File
+	children []*node
+	modTime  time.Time
+}
+
+func (n *node) isDir() bool { return n.file == nil }
+
+var (
+	_ qfs.Filesystem          = (*FS)(nil)
+	_ qfs.ReadDirFS           = (*FS)(nil)
+	_ qfs.DescribingFS        = (*FS)(nil)
+	_ qfs.ReleasingFilesystem = (*FS)(nil)
+)
+
+// NewFilesystem opens the archive at the "path" key of a config map. The
+// archive is closed when ctx ends
+func NewFilesystem(ctx context.Context, cfgMap map[string]interface{}) (qfs.Filesystem, error) {
+	cfg := &FSConfig{}
+	if err := mapstructure.Decode(cfgMap, cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("zipfs: archive path is required")
+	}
+	fs, err := Open(cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		<-ctx.Done()
+		fs.doneErr = fs.Close()
+		close(fs.doneCh)
+	}()
+	return fs, nil
+}
+
+// Open reads the zip archive at a local path. Close the filesystem to close
+// the archive
+func Open(path string) (*FS, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", qfs.ErrNotFound, path)
+		}
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	fs, err := NewFS(f, fi.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	fs.closer = f
+	return fs, nil
+}
+
+// FromFile reads a zip archive from a qfs.File. Archives need random access,
+// files that don't support it are read into memory
+func FromFile(f qfs.File) (*FS, error) {
+	if f.IsDirectory() {
+		return nil, fmt.Errorf("%w: zip archive", qfs.ErrNotFile)
+	}
+	if ra, ok := f.(io.ReaderAt); ok {
+		if size := qfs.FileSize(f); size >= 0 {
+			fs, err := NewFS(ra, size)
+			if err != nil {
+				return nil, err
+			}
+			fs.closer = f
+			return fs, nil
+		}
+	}
+	data, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	return NewFS(bytes.NewReader(data), int64(len(data)))
+}
+
+// NewFS reads a zip archive of size bytes from r
+func NewFS(r io.ReaderAt, size int64) (*FS, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("reading zip archive: %w", err)
+	}
+	fs := &FS{root: &node{}, doneCh: make(chan struct{})}
+	for _, f := range zr.File {
+		fs.index(f)
+	}
+	sortTree(fs.root)
+	return fs, nil
+}
+
+// index adds an archive entry to the directory tree, creating parent
+// directories as needed. Names are cleaned as rooted paths, so entries like
+// "../a" can't point outside the archive root
+func (fs *FS) index(f *zip.File) {
+	name := path.Clean("/" + f.Name)
+	if name == "/" {
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(name, "/"), "/")
+	dir := fs.root
+	for i, part := range parts {
+		child := dir.child(part)
+		last := i == len(parts)-1
+		if child == nil {
+			child = &node{name: part}
+			dir.children = append(dir.children, child)
+		}
+		if last {
+			child.modTime = f.Modified
+			if !f.FileInfo().IsDir() && !strings.HasSuffix(f.Name, "/") {
+				child.file = f
+			}
+		} else if !child.isDir() {
+			log.Debugw("archive entry conflicts with a file", "name", f.Name)
+			return
+		}
+		dir = child
+	}
+}
+
+func (n *node) child(name string) *node {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func sortTree(n *node) {
+	sort.Slice(n.children, func(i, j int) bool { return n.children[i].name < n.children[j].name })
+	for _, c := range n.children {
+		sortTree(c)
+	}
+}
+
+// Type distinguishes this filesystem from others by a unique string prefix
+func (fs *FS) Type() string { return FilestoreType }
+
+// Describe reports zip filesystems as read-only
+func (fs *FS) Describe() qfs.Descriptor {
+	return qfs.Descriptor{Type: FilestoreType}
+}
+
+// Done implements the qfs.ReleasingFilesystem interface
+func (fs *FS) Done() <-chan struct{} { return fs.doneCh }
+
+// DoneErr implements the qfs.ReleasingFilesystem interface
+func (fs *FS) DoneErr() error { return fs.doneErr }
+
+// Close closes the underlying archive, if the filesystem opened it
+func (fs *FS) Close() error {
+	if fs.closer == nil {
+		return nil
+	}
+	return fs.closer.Close()
+}
+
+// lookup finds the node at a path. Paths may omit the /zip/ prefix
+func (fs *FS) lookup(p string) (*node, error) {
+	p = strings.TrimPrefix(entryPath(p), "/")
+	n := fs.root
+	if p == "" {
+		return n, nil
+	}
+	for _, part := range strings.Split(p, "/") {
+		if !n.isDir() {
+			return nil, fmt.Errorf("%w: %s", qfs.ErrNotDirectory, p)
+		}
+		if n = n.child(part); n == nil {
+			return nil, qfs.ErrNotFound
+		}
+	}
+	return n, nil
+}
+
+// Has returns whether the archive has an entry at path
+func (fs *FS) Has(ctx context.Context, p string) (bool, error) {
+	if _, err := fs.lookup(p); err != nil {
+		return false, nil
+	}
+	return true, nil
+}
+
+// Get returns the file or directory at path
+func (fs *FS) Get(ctx context.Context, p string) (qfs.File, error) {
+	n, err := fs.lookup(p)
+	if err != nil {
+		return nil, err
+	}
+	return newFile(fullPath(p), n), nil
+}
+
+// ReadDir lists the directory at path
+func (fs *FS) ReadDir(ctx context.Context, p string) ([]qfs.DirEntry, error) {
+	n, err := fs.lookup(p)
+	if err != nil {
+		return nil, err
+	}
+	if !n.isDir() {
+		return nil, qfs.ErrNotDirectory
+	}
+	entries := make([]qfs.DirEntry, len(n.children))
+	for i, c := range n.children {
+		entries[i] = qfs.DirEntry{Name: c.name, Size: -1, IsDir: c.isDir()}
+		if !c.isDir() {
+			entries[i].Size = int64(c.file.UncompressedSize64)
+		}
+	}
+	return entries, nil
+}
+
+// Put is not supported, zip filesystems are read-only
+func (fs *FS) Put(ctx context.Context, file qfs.File) (string, error) {
+	return "", qfs.ErrReadOnly
+}
+
+// Delete is not supported, zip filesystems are read-only
+func (fs *FS) Delete(ctx context.Context, p string) error {
+	return qfs.ErrReadOnly
+}
+
+// entryPath is the rooted path of an entry within the archive
+func entryPath(p string) string {
+	if p == "/"+FilestoreType {
+		return "/"
+	}
+	return path.Clean("/" + strings.TrimPrefix(p, "/"+FilestoreType+"/"))
+}
+
+// fullPath is the canonical form of a path
+func fullPath(p string) string {
+	return "/" + FilestoreType + entryPath(p)
+}
+
+func newFile(p string, n *node) qfs.File {
+	if n.isDir() {
+		return &dir{path: p, n: n}
+	}
+	return &file{path: p, f: n.file}
+}
+
+// file is a file in the archive, decompressed on first read
+type file struct {
+	path string
+	f    *zip.File
+	rc   io.ReadCloser
+}
+
+var (
+	_ qfs.File     = (*file)(nil)
+	_ qfs.SizeFile = (*file)(nil)
+)
+
+func (f *file) Read(p []byte) (int, error) {
+	if f.rc == nil {
+		rc, err := f.f.Open()
+		if err != nil {
+			return 0, err
+		}
+		f.rc = rc
+	}
+	return f.rc.Read(p)
+}
+
+func (f *file) Close() error {
+	if f.rc == nil {
+		return nil
+	}
+	return f.rc.Close()
+}
+
+func (f *file) FileName() string            { return path.Base(f.path) }
+func (f *file) FullPath() string            { return f.path }
+func (f *file) IsDirectory() bool           { return false }
+func (f *file) NextFile() (qfs.File, error) { return nil, qfs.ErrNotDirectory }
+func (f *file) ModTime() time.Time          { return f.f.Modified }
+func (f *file) MediaType() string           { return mime.TypeByExtension(path.Ext(f.path)) }
+func (f *file) Size() int64                 { return int64(f.f.UncompressedSize64) }
+
+// dir is a directory in the archive
+type dir struct {
+	path string
+	n    *node
+	i    int
+}
+
+var _ qfs.File = (*dir)(nil)
+
+func (d *dir) Read([]byte) (int, error) { return 0, qfs.ErrNotFile }
+func (d *dir) Close() error             { return nil }
+func (d *dir) FileName() string         { return path.Base(d.path) }
+func (d *dir) FullPath() string         { return d.path }
+func (d *dir) IsDirectory() bool        { return true }
+func (d *dir) ModTime() time.Time       { return d.n.modTime }
+func (d *dir) MediaType() string        { return "application/x-directory" }
+
+// NextFile returns the directory's children in name order
+func (d *dir) NextFile() (qfs.File, error) {
+	if d.i >= len(d.n.children) {
+		return nil, io.EOF
+	}
+	c := d.n.children[d.i]
+	d.i++
+	return newFile(path.Join(d.path, c.name), c), nil
+}
@@ -0,0 +1,139 @@
+package zipfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/qri-io/qfs"
+)
+
+func testArchive(t *testing.T) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	w := zip.NewWriter(buf)
+	for name, data := range map[string]string{
+		"data/a.json":    `{"a":1}`,
+		"data/b/c.txt":   "nested",
+		"empty/":         "",
+		"../escaped.txt": "escaped",
+	} {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(f, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestFS(t *testing.T) {
+	ctx := context.Background()
+	fs, err := FromFile(qfs.NewMemfileBytes("archive.zip", testArchive(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := fs.Get(ctx, "/zip/data/a.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"a":1}` || qfs.FileSize(f) != 7 || f.MediaType() != "application/json" {
+		t.Errorf("unexpected file: %q size %d type %q", data, qfs.FileSize(f), f.MediaType())
+	}
+
+	entries, err := fs.ReadDir(ctx, "/zip/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	if len(entries) != 3 || names[0] != "data" || names[1] != "empty" || names[2] != "escaped.txt" || !entries[0].IsDir || entries[2].Size != 7 {
+		t.Errorf("unexpected root listing: %#v", entries)
+	}
+
+	root, err := fs.Get(ctx, "/zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{}
+	err = qfs.Walk(root, func(f qfs.File) error {
+		paths = append(paths, f.FullPath())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"/zip/data/a.json", "/zip/data/b/c.txt", "/zip/data/b", "/zip/data", "/zip/empty", "/zip/escaped.txt", "/zip/"}
+	if len(paths) != len(expect) {
+		t.Fatalf("walk: expected %v, got %v", expect, paths)
+	}
+	for i := range expect {
+		if paths[i] != expect[i] {
+			t.Errorf("walk %d: expected %q, got %q", i, expect[i], paths[i])
+		}
+	}
+
+	if has, _ := fs.Has(ctx, "data/b/c.txt"); !has {
+		t.Error("expected paths without a /zip/ prefix to resolve")
+	}
+	if _, err := fs.Get(ctx, "/zip/missing"); !errors.Is(err, qfs.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got: %v", err)
+	}
+	if _, err := fs.ReadDir(ctx, "/zip/data/a.json"); !errors.Is(err, qfs.ErrNotDirectory) {
+		t.Errorf("expected ErrNotDirectory, got: %v", err)
+	}
+	if _, err := fs.Put(ctx, qfs.NewMemfileBytes("x", nil)); !errors.Is(err, qfs.ErrReadOnly) {
+		t.Errorf("expected ErrReadOnly, got: %v", err)
+	}
+}
+
+func TestNewFilesystem(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zipfs_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "archive.zip")
+	if err := ioutil.WriteFile(path, testArchive(t), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	fs, err := NewFilesystem(ctx, map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.Get(ctx, "/zip/data/b/c.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadAll(f); string(data) != "nested" {
+		t.Errorf("unexpected content %q", data)
+	}
+	f.Close()
+
+	cancel()
+	<-fs.(qfs.ReleasingFilesystem).Done()
+
+	if _, err := NewFilesystem(context.Background(), map[string]interface{}{"path": filepath.Join(dir, "missing.zip")}); !errors.Is(err, qfs.ErrNotFound) {
+		t.Errorf("expected ErrNotFound opening a missing archive, got: %v", err)
+	}
+}